@@ -0,0 +1,232 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+)
+
+// Change is a class of requests whose effect differs between two policy
+// sets. The principal and resource are either an entity type, standing for
+// the entities of the type which no policy names, or a specific entity.
+type Change struct {
+	Principal string `json:"principal"`
+	Action    string `json:"action"`
+	Resource  string `json:"resource"`
+	Old       Effect `json:"old"`
+	New       Effect `json:"new"`
+	// Policies are the ids of the new policies which may apply
+	Policies []string `json:"policies"`
+}
+
+// DiffReport is the result of comparing two policy sets
+type DiffReport struct {
+	// NewlyAllowed are requests which are now permitted, or may now be
+	// permitted depending on the conditions
+	NewlyAllowed []Change `json:"newlyAllowed"`
+	// NewlyDenied are requests which were permitted, or may have been, and
+	// now are denied or are only permitted depending on the conditions
+	NewlyDenied []Change `json:"newlyDenied"`
+	// Modified are requests which depend on the conditions in both sets but
+	// where different policies apply
+	Modified []Change `json:"modified"`
+}
+
+// IsEmpty reports if no differences were found
+func (r *DiffReport) IsEmpty() bool {
+	return len(r.NewlyAllowed) == 0 && len(r.NewlyDenied) == 0 && len(r.Modified) == 0
+}
+
+// allowRank orders the effects by how much they allow
+func allowRank(effect Effect) int {
+	switch effect {
+	case EffectPermit:
+		return 2
+	case EffectConditional:
+		return 1
+	}
+	return 0
+}
+
+// requestTarget is a principal or resource of the requests being compared,
+// uid is nil for the entities of the type not named by any policy
+type requestTarget struct {
+	kind string
+	uid  engine.EntityValue
+}
+
+func (t requestTarget) String() string {
+	if t.uid.IsZero() {
+		return t.kind
+	}
+	return t.uid.String()
+}
+
+// matchTarget checks a principal or resource constraint against the target
+func matchTarget(sdef *schema.Schema, c engine.ScopeConstraint, target requestTarget) applies {
+	if target.uid.IsZero() {
+		// the entities named by `==` are compared on their own
+		if c.Op == engine.OpEql && !c.Slot {
+			return applies{}
+		}
+		return matchEntityType(sdef, c, target.kind)
+	}
+	if c.IsType != "" && c.IsType != target.kind {
+		return applies{}
+	}
+	if c.Slot {
+		return applies{possible: true}
+	}
+
+	switch c.Op {
+	case engine.OpInvalid:
+		return applies{possible: true, always: true}
+	case engine.OpEql, engine.OpIn:
+		if containsEntity(c.Entities, target.uid) {
+			return applies{possible: true, always: true}
+		}
+		if c.Op == engine.OpIn {
+			// depends on the entity hierarchy
+			return matchEntityType(sdef, c, target.kind)
+		}
+	}
+	return applies{}
+}
+
+// requestApplies determines if the policy could apply to requests for the
+// principal, action and resource
+func requestApplies(sdef *schema.Schema, policy *engine.Policy, principal requestTarget, action engine.EntityValue, resource requestTarget) applies {
+	scope := policy.Scope()
+
+	result := applies{possible: true, always: len(policy.Conditions) == 0}
+	for _, item := range []applies{
+		matchTarget(sdef, scope.Principal, principal),
+		matchAction(sdef, scope.Action, action),
+		matchTarget(sdef, scope.Resource, resource),
+	} {
+		result.possible = result.possible && item.possible
+		result.always = result.always && item.always
+	}
+	result.always = result.always && result.possible
+
+	return result
+}
+
+// namedEntities collects the entities referenced by the principal and
+// resource scopes, by entity type
+func namedEntities(lists ...engine.PolicyList) map[string][]engine.EntityValue {
+	seen := map[string]bool{}
+	output := map[string][]engine.EntityValue{}
+	for _, policies := range lists {
+		for _, policy := range policies {
+			scope := policy.Scope()
+			for _, item := range append(scope.Principal.Entities, scope.Resource.Entities...) {
+				if seen[item.String()] {
+					continue
+				}
+				seen[item.String()] = true
+				output[item.EntityType()] = append(output[item.EntityType()], item)
+			}
+		}
+	}
+	for _, items := range output {
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].String() < items[j].String()
+		})
+	}
+	return output
+}
+
+// Compare reports the requests whose outcome changes between the old and new
+// policy sets. The requests are enumerated from the schema, each principal
+// and resource type is split into the entities named by the policies and
+// the rest of the entities of the type. As with Matrix the conditions aren't
+// evaluated, so a change between permit and conditional is reported as the
+// request may now be allowed or denied.
+func Compare(old, new engine.PolicyList, sdef *schema.Schema) (DiffReport, error) {
+	report := DiffReport{
+		NewlyAllowed: []Change{},
+		NewlyDenied:  []Change{},
+		Modified:     []Change{},
+	}
+	if sdef == nil {
+		return report, ErrSchemaRequired
+	}
+
+	named := namedEntities(old, new)
+	oldText := policyText(old)
+	newText := policyText(new)
+	targets := func(kinds []string) []requestTarget {
+		output := []requestTarget{}
+		for _, kind := range kinds {
+			output = append(output, requestTarget{kind: kind})
+			for _, uid := range named[kind] {
+				output = append(output, requestTarget{kind: kind, uid: uid})
+			}
+		}
+		return output
+	}
+
+	for _, action := range sdef.ActionEntities() {
+		principals, resources := actionTypes(sdef, action)
+
+		for _, principal := range targets(principals) {
+			for _, resource := range targets(resources) {
+				effect := func(policies engine.PolicyList) (Effect, []string) {
+					return combinedEffect(policies, func(policy *engine.Policy) applies {
+						return requestApplies(sdef, policy, principal, action, resource)
+					})
+				}
+				oldEffect, oldIds := effect(old)
+				newEffect, newIds := effect(new)
+
+				change := Change{
+					Principal: principal.String(),
+					Action:    action.String(),
+					Resource:  resource.String(),
+					Old:       oldEffect,
+					New:       newEffect,
+					Policies:  newIds,
+				}
+				switch {
+				case allowRank(newEffect) > allowRank(oldEffect):
+					report.NewlyAllowed = append(report.NewlyAllowed, change)
+				case allowRank(newEffect) < allowRank(oldEffect):
+					report.NewlyDenied = append(report.NewlyDenied, change)
+				case newEffect == EffectConditional && !samePolicies(oldIds, newIds, oldText, newText):
+					report.Modified = append(report.Modified, change)
+				}
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// samePolicies checks the same policies apply, a policy with the same id
+// whose text changed is a different policy
+func samePolicies(oldIds, newIds []string, oldText, newText map[string]string) bool {
+	if len(oldIds) != len(newIds) {
+		return false
+	}
+	for i := range oldIds {
+		if oldIds[i] != newIds[i] || oldText[oldIds[i]] != newText[newIds[i]] {
+			return false
+		}
+	}
+	return true
+}
+
+// policyText is the policy in a canonical form for comparison
+func policyText(policies engine.PolicyList) map[string]string {
+	output := map[string]string{}
+	for _, policy := range policies {
+		text := policy.Effect.String() + " " + engine.ExprString(policy.If)
+		for _, cond := range policy.Conditions {
+			text += " " + engine.ExprString(cond)
+		}
+		output[policy.Id] = text
+	}
+	return output
+}
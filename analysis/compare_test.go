@@ -0,0 +1,75 @@
+package analysis_test
+
+import (
+	"testing"
+
+	"github.com/koblas/cedar-go/analysis"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	old, err := parser.ParseRules(`
+	@id("view-all")
+	permit(principal, action == Action::"view", resource);
+
+	@id("admin-delete")
+	permit(principal in Group::"admin", action == Action::"delete", resource);
+
+	@id("owner-share")
+	permit(principal, action == Action::"share", resource) when { resource.owner == principal };
+	`)
+	require.NoError(t, err)
+
+	new, err := parser.ParseRules(`
+	@id("view-all")
+	permit(principal, action == Action::"view", resource);
+
+	@id("no-secret")
+	forbid(principal, action == Action::"view", resource == Photo::"secret");
+
+	@id("admin-delete")
+	permit(principal in Group::"admin", action == Action::"delete", resource);
+
+	@id("alice-delete")
+	permit(principal == User::"alice", action == Action::"delete", resource);
+
+	@id("owner-share")
+	permit(principal, action == Action::"share", resource) when { resource.owner == principal && context.mfa };
+	`)
+	require.NoError(t, err)
+
+	type change struct {
+		principal, action, resource string
+		old, new                    analysis.Effect
+	}
+	summary := func(changes []analysis.Change) []change {
+		output := []change{}
+		for _, item := range changes {
+			output = append(output, change{item.Principal, item.Action, item.Resource, item.Old, item.New})
+		}
+		return output
+	}
+
+	report, err := analysis.Compare(old, new, loadSchema(t))
+	require.NoError(t, err)
+
+	assert.Equal(t, []change{
+		{`User::"alice"`, `Action::"delete"`, "Photo", analysis.EffectConditional, analysis.EffectPermit},
+		{`User::"alice"`, `Action::"delete"`, `Photo::"secret"`, analysis.EffectConditional, analysis.EffectPermit},
+	}, summary(report.NewlyAllowed))
+	assert.Equal(t, []change{
+		{"User", `Action::"view"`, `Photo::"secret"`, analysis.EffectPermit, analysis.EffectForbid},
+		{`User::"alice"`, `Action::"view"`, `Photo::"secret"`, analysis.EffectPermit, analysis.EffectForbid},
+	}, summary(report.NewlyDenied))
+	assert.Len(t, report.Modified, 4)
+	assert.Equal(t, []string{"owner-share"}, report.Modified[0].Policies)
+
+	report, err = analysis.Compare(old, old, loadSchema(t))
+	require.NoError(t, err)
+	assert.True(t, report.IsEmpty())
+
+	_, err = analysis.Compare(old, new, nil)
+	require.ErrorIs(t, err, analysis.ErrSchemaRequired)
+}
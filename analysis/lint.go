@@ -0,0 +1,205 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+)
+
+const (
+	// An entity type which the schema doesn't declare
+	DiagnosticUnknownType DiagnosticKind = "unknown-type"
+	// An action which the schema doesn't declare
+	DiagnosticUnknownAction DiagnosticKind = "unknown-action"
+	// A condition or comparison whose result doesn't depend on the request
+	DiagnosticConstantCondition DiagnosticKind = "constant-condition"
+	// A `like` pattern which is likely a mistake
+	DiagnosticLikePattern DiagnosticKind = "like-pattern"
+)
+
+// nodeDiagnostic is a diagnostic positioned at the node, the policy position
+// is used for nodes which don't have one
+func nodeDiagnostic(policy *engine.Policy, node engine.Node, kind DiagnosticKind, message string) Diagnostic {
+	diag := newDiagnostic(policy, kind, message)
+	if pos := node.Pos(); pos.IsValid() {
+		diag.Position = pos
+	}
+	return diag
+}
+
+// isActionType checks for the entity type of actions, with or without a
+// namespace
+func isActionType(kind string) bool {
+	return kind == "Action" || strings.HasSuffix(kind, "::Action")
+}
+
+// FindUnknownTypes returns the references to entity types and actions, in
+// the scope or the conditions, which the schema doesn't declare. Each type or
+// action is reported once per policy.
+func FindUnknownTypes(policies engine.PolicyList, sdef *schema.Schema) []Diagnostic {
+	output := []Diagnostic{}
+	if sdef == nil {
+		return output
+	}
+	types := map[string]bool{}
+	for _, name := range sdef.EntityTypeNames() {
+		types[name] = true
+	}
+
+	for _, policy := range policies {
+		policy := policy
+		seen := map[string]bool{}
+		report := func(node engine.Node, kind DiagnosticKind, name string) {
+			if seen[name] {
+				return
+			}
+			seen[name] = true
+			message := "unknown entity type " + name
+			if kind == DiagnosticUnknownAction {
+				message = "unknown action " + name
+			}
+			output = append(output, nodeDiagnostic(policy, node, kind, message))
+		}
+
+		engine.Inspect(policy, func(node engine.Node) bool {
+			value, ok := node.(*engine.ValueNode)
+			if !ok {
+				return true
+			}
+			uid, ok := value.Value.(engine.EntityValue)
+			if !ok {
+				return true
+			}
+			kind := uid.EntityType()
+			switch {
+			case isActionType(kind):
+				if sdef.LookupAction(uid) == nil {
+					report(node, DiagnosticUnknownAction, uid.String())
+				}
+			case !types[kind]:
+				report(node, DiagnosticUnknownType, kind)
+			}
+			return true
+		})
+	}
+
+	return output
+}
+
+// FindConstantConditions returns the `when` and `unless` conditions which
+// are a literal boolean, and the comparisons between two literals, as their
+// result doesn't depend on the request.
+func FindConstantConditions(policies engine.PolicyList) []Diagnostic {
+	output := []Diagnostic{}
+	for _, policy := range policies {
+		for _, cond := range policy.Conditions {
+			value, ok := cond.Expr.(*engine.ValueNode)
+			if !ok {
+				continue
+			}
+			if result, ok := value.Value.(engine.BoolValue); ok {
+				output = append(output, nodeDiagnostic(policy, cond, DiagnosticConstantCondition,
+					fmt.Sprintf("%s condition is always %t", cond.Condition.String(), bool(result))))
+			}
+		}
+
+		engine.Inspect(policy, func(node engine.Node) bool {
+			expr, ok := node.(*engine.BinaryExpr)
+			if !ok {
+				return true
+			}
+			switch expr.Op {
+			case engine.OpEql, engine.OpNeq, engine.OpLss, engine.OpLeq, engine.OpGtr, engine.OpGeq:
+			default:
+				return true
+			}
+			_, left := expr.Left.(*engine.ValueNode)
+			_, right := expr.Right.(*engine.ValueNode)
+			if left && right {
+				output = append(output, nodeDiagnostic(policy, expr, DiagnosticConstantCondition,
+					fmt.Sprintf("%s compares two constants", engine.ExprString(expr))))
+			}
+			return true
+		})
+	}
+
+	return output
+}
+
+// FindSuspiciousPatterns returns the `like` patterns which are likely a
+// mistake: a pattern without a wildcard is an equality test, a pattern of
+// only wildcards matches every string and consecutive wildcards are
+// redundant.
+func FindSuspiciousPatterns(policies engine.PolicyList) []Diagnostic {
+	output := []Diagnostic{}
+	for _, policy := range policies {
+		engine.Inspect(policy, func(node engine.Node) bool {
+			expr, ok := node.(*engine.BinaryExpr)
+			if !ok || expr.Op != engine.OpLike {
+				return true
+			}
+			value, ok := expr.Right.(*engine.ValueNode)
+			if !ok {
+				return true
+			}
+			text, ok := value.Value.(engine.StrValue)
+			if !ok {
+				return true
+			}
+
+			if message := patternProblem(engine.CompilePattern(string(text)).Parts()); message != "" {
+				output = append(output, nodeDiagnostic(policy, expr, DiagnosticLikePattern,
+					fmt.Sprintf("like %q %s", string(text), message)))
+			}
+			return true
+		})
+	}
+
+	return output
+}
+
+func patternProblem(parts []string) string {
+	if len(parts) == 1 {
+		return "has no wildcard, use == instead"
+	}
+	if strings.Join(parts, "") == "" {
+		return "matches any string"
+	}
+	for _, part := range parts[1 : len(parts)-1] {
+		if part == "" {
+			return "has consecutive wildcards"
+		}
+	}
+	return ""
+}
+
+// Lint runs all of the checks of the package, the schema is optional and
+// enables the checks which depend on it
+func Lint(policies engine.PolicyList, sdef *schema.Schema) []Diagnostic {
+	output := []Diagnostic{}
+	output = append(output, FindUnknownTypes(policies, sdef)...)
+	output = append(output, FindUnreachablePolicies(policies, sdef)...)
+	output = append(output, FindShadowedPolicies(policies, sdef)...)
+	output = append(output, FindConstantConditions(policies)...)
+	output = append(output, FindSuspiciousPatterns(policies)...)
+	sortDiagnostics(output)
+
+	return output
+}
+
+// sortDiagnostics orders the diagnostics by position
+func sortDiagnostics(diags []Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i].Position, diags[j].Position
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
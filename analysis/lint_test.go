@@ -0,0 +1,99 @@
+package analysis_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/koblas/cedar-go/analysis"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func diagnosticMessages(diags []analysis.Diagnostic) []string {
+	output := []string{}
+	for _, item := range diags {
+		output = append(output, item.Message)
+	}
+	return output
+}
+
+func TestFindUnknownTypes(t *testing.T) {
+	sdef, err := schema.NewFromText(strings.NewReader(`
+	entity User;
+	entity Photo;
+	action view appliesTo { principal: User, resource: Photo };
+	`))
+	require.NoError(t, err)
+
+	policies, err := parser.ParseRules(`
+	@id("known") permit(principal == User::"alice", action == Action::"view", resource);
+	@id("unknown") permit(principal == Usr::"alice", action == Action::"edit", resource)
+	when { resource in Albm::"a" || resource in Albm::"b" };
+	`)
+	require.NoError(t, err)
+
+	assert.Empty(t, analysis.FindUnknownTypes(policies, nil))
+
+	diags := analysis.FindUnknownTypes(policies, sdef)
+	assert.Equal(t, []string{"unknown", "unknown", "unknown"}, diagnosticIds(diags))
+	assert.ElementsMatch(t, []string{
+		"unknown entity type Usr",
+		`unknown action Action::"edit"`,
+		"unknown entity type Albm",
+	}, diagnosticMessages(diags))
+}
+
+func TestFindConstantConditions(t *testing.T) {
+	policies, err := parser.ParseRules(`
+	@id("always") permit(principal, action, resource) when { true };
+	@id("never") permit(principal, action, resource) unless { true };
+	@id("constants") permit(principal, action, resource) when { principal.level > 2 && 1 == 2 };
+	@id("fine") permit(principal, action, resource) when { principal.level > 2 };
+	`)
+	require.NoError(t, err)
+
+	diags := analysis.FindConstantConditions(policies)
+	assert.Equal(t, []string{"always", "never", "constants"}, diagnosticIds(diags))
+	assert.Equal(t, []string{
+		"when condition is always true",
+		"unless condition is always true",
+		"1 == 2 compares two constants",
+	}, diagnosticMessages(diags))
+	assert.Equal(t, analysis.DiagnosticConstantCondition, diags[0].Kind)
+	assert.Equal(t, 4, diags[2].Position.Line)
+}
+
+func TestFindSuspiciousPatterns(t *testing.T) {
+	policies, err := parser.ParseRules(`
+	@id("equal") permit(principal, action, resource) when { resource.name like "photo.jpg" };
+	@id("any") permit(principal, action, resource) when { resource.name like "**" };
+	@id("double") permit(principal, action, resource) when { resource.name like "a**b" };
+	@id("escaped") permit(principal, action, resource) when { resource.name like "a\*b" };
+	@id("fine") permit(principal, action, resource) when { resource.name like "*.jpg" };
+	`)
+	require.NoError(t, err)
+
+	diags := analysis.FindSuspiciousPatterns(policies)
+	assert.Equal(t, []string{"equal", "any", "double", "escaped"}, diagnosticIds(diags))
+	assert.Equal(t, []string{
+		`like "photo.jpg" has no wildcard, use == instead`,
+		`like "**" matches any string`,
+		`like "a**b" has consecutive wildcards`,
+		`like "a\\*b" has no wildcard, use == instead`,
+	}, diagnosticMessages(diags))
+}
+
+func TestLint(t *testing.T) {
+	policies, err := parser.ParseRules(`
+	@id("b") permit(principal, action, resource) when { resource.name like "x" };
+	@id("a") permit(principal == User::"a", action, resource) when { principal == User::"b" };
+	`)
+	require.NoError(t, err)
+
+	diags := analysis.Lint(policies, nil)
+	assert.Equal(t, []string{"b", "a"}, diagnosticIds(diags))
+	assert.Equal(t, analysis.DiagnosticLikePattern, diags[0].Kind)
+	assert.Equal(t, analysis.DiagnosticUnreachable, diags[1].Kind)
+}
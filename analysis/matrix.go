@@ -0,0 +1,239 @@
+// Package analysis provides static analysis of policy sets, these are
+// tools that reason about the policies without evaluating a request.
+package analysis
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+)
+
+var ErrSchemaRequired = errors.New("schema is required for analysis")
+
+// Effect is the summary of the policies which apply to a set of requests
+type Effect string
+
+const (
+	// No permit policy can apply, the default deny always holds
+	EffectNone Effect = "none"
+	// A permit always applies and no forbid can apply
+	EffectPermit Effect = "permit"
+	// A forbid always applies
+	EffectForbid Effect = "forbid"
+	// The outcome depends on the specific entities or the conditions
+	EffectConditional Effect = "conditional"
+)
+
+// Cell is a single (principal type × action × resource type) entry
+type Cell struct {
+	Principal string   `json:"principal"`
+	Action    string   `json:"action"`
+	Resource  string   `json:"resource"`
+	Effect    Effect   `json:"effect"`
+	Policies  []string `json:"policies"`
+}
+
+// EffectMatrix is the summary of effects for all the request types
+// declared in the schema.
+type EffectMatrix struct {
+	Cells []Cell `json:"cells"`
+}
+
+// applies describes how a policy relates to a class of requests
+type applies struct {
+	possible bool // the policy may apply to some request
+	always   bool // the policy applies to every request
+}
+
+// matchEntityType checks a principal or resource constraint against an entity type
+func matchEntityType(sdef *schema.Schema, c engine.ScopeConstraint, kind string) applies {
+	if c.IsType != "" && c.IsType != kind {
+		return applies{}
+	}
+	if c.Slot {
+		return applies{possible: true}
+	}
+
+	switch c.Op {
+	case engine.OpInvalid:
+		return applies{possible: true, always: true}
+	case engine.OpEql:
+		for _, item := range c.Entities {
+			if item.EntityType() == kind {
+				return applies{possible: true}
+			}
+		}
+	case engine.OpIn:
+		for _, item := range c.Entities {
+			if item.EntityType() == kind || sdef.IsMemberOfType(kind, item.EntityType()) {
+				return applies{possible: true}
+			}
+		}
+	}
+
+	return applies{}
+}
+
+// matchAction checks an action constraint against a specific action
+func matchAction(sdef *schema.Schema, c engine.ScopeConstraint, action engine.EntityValue) applies {
+	switch c.Op {
+	case engine.OpInvalid:
+		return applies{possible: true, always: true}
+	case engine.OpEql:
+		for _, item := range c.Entities {
+			if item.String() == action.String() {
+				return applies{possible: true, always: true}
+			}
+		}
+	case engine.OpIn:
+		for _, item := range c.Entities {
+			if sdef.IsActionIn(action, item) {
+				return applies{possible: true, always: true}
+			}
+		}
+	}
+
+	return applies{}
+}
+
+// policyApplies determines if the policy could apply to requests of the given shape
+func policyApplies(sdef *schema.Schema, policy *engine.Policy, principal string, action engine.EntityValue, resource string) applies {
+	scope := policy.Scope()
+
+	result := applies{possible: true, always: len(policy.Conditions) == 0}
+	for _, item := range []applies{
+		matchEntityType(sdef, scope.Principal, principal),
+		matchAction(sdef, scope.Action, action),
+		matchEntityType(sdef, scope.Resource, resource),
+	} {
+		result.possible = result.possible && item.possible
+		result.always = result.always && item.always
+	}
+	result.always = result.always && result.possible
+
+	return result
+}
+
+// actionTypes returns the principal and resource types an action applies to
+func actionTypes(sdef *schema.Schema, action engine.EntityValue) ([]string, []string) {
+	all := sdef.EntityTypeNames()
+	def := sdef.LookupAction(action)
+	if def == nil {
+		return all, all
+	}
+
+	filter := func(has bool, types map[string]bool) []string {
+		if !has {
+			return all
+		}
+		output := []string{}
+		for _, name := range all {
+			if types[name] {
+				output = append(output, name)
+			}
+		}
+		return output
+	}
+
+	return filter(def.HasPrincipalTypes, def.PrincipalTypes), filter(def.HasResourceTypes, def.ResourceTypes)
+}
+
+func cellEffect(sdef *schema.Schema, policies engine.PolicyList, principal string, action engine.EntityValue, resource string) Cell {
+	effect, ids := combinedEffect(policies, func(policy *engine.Policy) applies {
+		return policyApplies(sdef, policy, principal, action, resource)
+	})
+
+	return Cell{
+		Principal: principal,
+		Action:    action.String(),
+		Resource:  resource,
+		Effect:    effect,
+		Policies:  ids,
+	}
+}
+
+// combinedEffect is the effect of the policies on a class of requests, with
+// the ids of the policies which may apply
+func combinedEffect(policies engine.PolicyList, match func(*engine.Policy) applies) (Effect, []string) {
+	ids := []string{}
+
+	var permit, forbid applies
+	for _, policy := range policies {
+		result := match(policy)
+		if !result.possible {
+			continue
+		}
+		ids = append(ids, policy.Id)
+
+		target := &permit
+		if policy.Effect == engine.EffectForbid {
+			target = &forbid
+		}
+		target.possible = true
+		target.always = target.always || result.always
+	}
+
+	switch {
+	case forbid.always:
+		return EffectForbid, ids
+	case !permit.possible:
+		return EffectNone, ids
+	case permit.always && !forbid.possible:
+		return EffectPermit, ids
+	}
+	return EffectConditional, ids
+}
+
+// Matrix produces the table of (principal type × action × resource type) to
+// the possible effects of the policy set. The schema is used to enumerate the
+// request types and to resolve the `in` hierarchy.
+func Matrix(policies engine.PolicyList, sdef *schema.Schema) (*EffectMatrix, error) {
+	if sdef == nil {
+		return nil, ErrSchemaRequired
+	}
+
+	matrix := EffectMatrix{Cells: []Cell{}}
+	for _, action := range sdef.ActionEntities() {
+		principals, resources := actionTypes(sdef, action)
+
+		for _, principal := range principals {
+			for _, resource := range resources {
+				matrix.Cells = append(matrix.Cells, cellEffect(sdef, policies, principal, action, resource))
+			}
+		}
+	}
+
+	return &matrix, nil
+}
+
+// WriteJSON outputs the matrix as a JSON document
+func (m *EffectMatrix) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(m)
+}
+
+// WriteCSV outputs the matrix as a CSV table with a header row, the
+// matching policy ids are joined with a ';'
+func (m *EffectMatrix) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+
+	if err := out.Write([]string{"principal", "action", "resource", "effect", "policies"}); err != nil {
+		return err
+	}
+	for _, cell := range m.Cells {
+		row := []string{cell.Principal, cell.Action, cell.Resource, string(cell.Effect), strings.Join(cell.Policies, ";")}
+		if err := out.Write(row); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+
+	return out.Error()
+}
@@ -0,0 +1,81 @@
+package analysis_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/koblas/cedar-go/analysis"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const photoSchema = `
+{
+  "": {
+    "entityTypes": {
+      "User": { "memberOfTypes": ["Group"] },
+      "Group": {},
+      "Photo": {}
+    },
+    "actions": {
+      "view": {
+        "appliesTo": { "principalTypes": ["User"], "resourceTypes": ["Photo"] }
+      },
+      "delete": {
+        "appliesTo": { "principalTypes": ["User"], "resourceTypes": ["Photo"] }
+      },
+      "share": {
+        "appliesTo": { "principalTypes": ["User"], "resourceTypes": ["Photo"] }
+      }
+    }
+  }
+}
+`
+
+func loadSchema(t *testing.T) *schema.Schema {
+	sdef, err := schema.NewFromJson(strings.NewReader(photoSchema))
+	require.NoError(t, err)
+	return sdef
+}
+
+func TestMatrix(t *testing.T) {
+	policies, err := parser.ParseRules(`
+	@id("view-all")
+	permit(principal, action == Action::"view", resource);
+
+	@id("admin-delete")
+	permit(principal in Group::"admin", action == Action::"delete", resource);
+
+	@id("no-share")
+	forbid(principal, action == Action::"share", resource);
+	`)
+	require.NoError(t, err)
+
+	matrix, err := analysis.Matrix(policies, loadSchema(t))
+	require.NoError(t, err)
+
+	effects := map[string]analysis.Effect{}
+	for _, cell := range matrix.Cells {
+		effects[cell.Action] = cell.Effect
+	}
+
+	assert.Equal(t, analysis.EffectPermit, effects[`Action::"view"`])
+	assert.Equal(t, analysis.EffectConditional, effects[`Action::"delete"`])
+	assert.Equal(t, analysis.EffectForbid, effects[`Action::"share"`])
+
+	buf := bytes.Buffer{}
+	require.NoError(t, matrix.WriteCSV(&buf))
+	assert.Contains(t, buf.String(), `User,"Action::""view""",Photo,permit,view-all`)
+
+	buf.Reset()
+	require.NoError(t, matrix.WriteJSON(&buf))
+	assert.Contains(t, buf.String(), `"effect": "conditional"`)
+}
+
+func TestMatrixNoSchema(t *testing.T) {
+	_, err := analysis.Matrix(nil, nil)
+	assert.ErrorIs(t, err, analysis.ErrSchemaRequired)
+}
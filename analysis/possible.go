@@ -0,0 +1,73 @@
+package analysis
+
+import (
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+)
+
+// Access is whether a principal may be permitted an action on a resource
+type Access string
+
+const (
+	// A permit always applies and no forbid can apply
+	AccessAlways Access = "always"
+	// No permit can apply, or a forbid always applies
+	AccessNever Access = "never"
+	// The outcome depends on the context, the entity hierarchy or the
+	// attributes of the entities
+	AccessConditional Access = "conditional"
+)
+
+// ActionAccess is the access to a single action
+type ActionAccess struct {
+	Action string `json:"action"`
+	Access Access `json:"access"`
+	// Policies are the ids of the policies which may apply
+	Policies []string `json:"policies"`
+}
+
+// PossibleActions reports for each action of the schema which applies to the
+// principal and resource types, whether the principal can be permitted the
+// action on the resource. The conditions and the context are treated as
+// unknown, as is the entity hierarchy beyond the entities named by the
+// policies. The actions are in the order of the schema's ActionEntities.
+func PossibleActions(policies engine.PolicyList, sdef *schema.Schema, principal, resource engine.EntityValue) ([]ActionAccess, error) {
+	if sdef == nil {
+		return nil, ErrSchemaRequired
+	}
+
+	ptarget := requestTarget{kind: principal.EntityType(), uid: principal}
+	rtarget := requestTarget{kind: resource.EntityType(), uid: resource}
+
+	output := []ActionAccess{}
+	for _, action := range sdef.ActionEntities() {
+		principals, resources := actionTypes(sdef, action)
+		if !containsString(principals, ptarget.kind) || !containsString(resources, rtarget.kind) {
+			continue
+		}
+
+		effect, ids := combinedEffect(policies, func(policy *engine.Policy) applies {
+			return requestApplies(sdef, policy, ptarget, action, rtarget)
+		})
+
+		access := AccessConditional
+		switch effect {
+		case EffectPermit:
+			access = AccessAlways
+		case EffectNone, EffectForbid:
+			access = AccessNever
+		}
+		output = append(output, ActionAccess{Action: action.String(), Access: access, Policies: ids})
+	}
+
+	return output, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package analysis_test
+
+import (
+	"testing"
+
+	"github.com/koblas/cedar-go/analysis"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPossibleActions(t *testing.T) {
+	policies, err := parser.ParseRules(`
+	@id("view-all")
+	permit(principal, action == Action::"view", resource);
+
+	@id("no-secret")
+	forbid(principal, action == Action::"view", resource == Photo::"secret");
+
+	@id("admin-delete")
+	permit(principal in Group::"admin", action == Action::"delete", resource);
+
+	@id("owner-share")
+	permit(principal, action == Action::"share", resource) when { context.mfa };
+	`)
+	require.NoError(t, err)
+
+	access := func(principal, resource engine.EntityValue) map[string]analysis.Access {
+		actions, err := analysis.PossibleActions(policies, loadSchema(t), principal, resource)
+		require.NoError(t, err)
+
+		output := map[string]analysis.Access{}
+		for _, item := range actions {
+			output[item.Action] = item.Access
+		}
+		return output
+	}
+
+	alice := engine.NewEntityValue("User", "alice")
+	assert.Equal(t, map[string]analysis.Access{
+		`Action::"delete"`: analysis.AccessConditional,
+		`Action::"share"`:  analysis.AccessConditional,
+		`Action::"view"`:   analysis.AccessAlways,
+	}, access(alice, engine.NewEntityValue("Photo", "beach")))
+	assert.Equal(t, map[string]analysis.Access{
+		`Action::"delete"`: analysis.AccessConditional,
+		`Action::"share"`:  analysis.AccessConditional,
+		`Action::"view"`:   analysis.AccessNever,
+	}, access(alice, engine.NewEntityValue("Photo", "secret")))
+
+	// No action applies to a group
+	assert.Empty(t, access(engine.NewEntityValue("Group", "admin"), engine.NewEntityValue("Photo", "beach")))
+
+	_, err = analysis.PossibleActions(policies, nil, alice, engine.NewEntityValue("Photo", "beach"))
+	require.ErrorIs(t, err, analysis.ErrSchemaRequired)
+}
@@ -0,0 +1,295 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/koblas/cedar-go/token"
+)
+
+// DiagnosticKind classifies a finding
+type DiagnosticKind string
+
+const (
+	// A permit which never applies without a forbid also applying
+	DiagnosticShadowed DiagnosticKind = "shadowed"
+	// A policy which can't apply to any request
+	DiagnosticUnreachable DiagnosticKind = "unreachable"
+)
+
+// Diagnostic is a finding about a single policy
+type Diagnostic struct {
+	Policy   string         `json:"policy"`
+	Position token.Position `json:"position"`
+	Kind     DiagnosticKind `json:"kind"`
+	Message  string         `json:"message"`
+	// Related are the ids of the other policies involved
+	Related []string `json:"related,omitempty"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Position, d.Policy, d.Message)
+}
+
+func newDiagnostic(policy *engine.Policy, kind DiagnosticKind, message string) Diagnostic {
+	return Diagnostic{
+		Policy:   policy.Id,
+		Position: policy.StartPos,
+		Kind:     kind,
+		Message:  message,
+	}
+}
+
+// FindShadowedPolicies returns the permit policies which can never fire
+// since a forbid applies to every request they apply to. A permit is shadowed
+// when it is a subset of a single forbid (see SubsetOf), or with a schema when
+// every request type the permit could apply to has a forbid without
+// conditions covering the whole type.
+func FindShadowedPolicies(policies engine.PolicyList, sdef *schema.Schema) []Diagnostic {
+	output := []Diagnostic{}
+	for _, policy := range policies {
+		if policy.Effect != engine.EffectPermit {
+			continue
+		}
+
+		related := []string{}
+		for _, forbid := range policies {
+			if forbid.Effect == engine.EffectForbid && SubsetOf(policy, forbid, sdef) {
+				related = append(related, forbid.Id)
+			}
+		}
+		if len(related) == 0 && sdef != nil {
+			related = forbiddenCells(sdef, policies, policy)
+		}
+		if len(related) == 0 {
+			continue
+		}
+
+		diag := newDiagnostic(policy, DiagnosticShadowed,
+			fmt.Sprintf("permit is always overridden by %s", strings.Join(related, ", ")))
+		diag.Related = related
+		output = append(output, diag)
+	}
+
+	return output
+}
+
+// forbiddenCells returns the forbid policies which apply when every request
+// type of the permit is always forbidden, otherwise nil
+func forbiddenCells(sdef *schema.Schema, policies engine.PolicyList, permit *engine.Policy) []string {
+	seen := map[string]bool{}
+	related := []string{}
+	cells := 0
+
+	for _, action := range sdef.ActionEntities() {
+		principals, resources := actionTypes(sdef, action)
+		for _, principal := range principals {
+			for _, resource := range resources {
+				if !policyApplies(sdef, permit, principal, action, resource).possible {
+					continue
+				}
+				cells++
+
+				forbidden := false
+				for _, forbid := range policies {
+					if forbid.Effect != engine.EffectForbid || !policyApplies(sdef, forbid, principal, action, resource).always {
+						continue
+					}
+					forbidden = true
+					if !seen[forbid.Id] {
+						seen[forbid.Id] = true
+						related = append(related, forbid.Id)
+					}
+					break
+				}
+				if !forbidden {
+					return nil
+				}
+			}
+		}
+	}
+
+	if cells == 0 {
+		return nil
+	}
+	return related
+}
+
+// FindUnreachablePolicies returns the policies which can't apply to any
+// request, as the scope and the conditions contradict each other (e.g.
+// `principal == User::"a"` with `when { principal == User::"b" }`), a
+// condition is always false, or with a schema the scope doesn't match any
+// request type the schema declares.
+func FindUnreachablePolicies(policies engine.PolicyList, sdef *schema.Schema) []Diagnostic {
+	output := []Diagnostic{}
+	for _, policy := range policies {
+		if reason := contradiction(policy); reason != "" {
+			output = append(output, newDiagnostic(policy, DiagnosticUnreachable, reason))
+			continue
+		}
+		if sdef != nil && !appliesToSchema(sdef, policy) {
+			output = append(output, newDiagnostic(policy, DiagnosticUnreachable,
+				"scope doesn't match any request type in the schema"))
+		}
+	}
+
+	return output
+}
+
+// appliesToSchema checks if the policy could apply to one of the request
+// types, a schema without actions can't be used to decide
+func appliesToSchema(sdef *schema.Schema, policy *engine.Policy) bool {
+	actions := sdef.ActionEntities()
+	if len(actions) == 0 {
+		return true
+	}
+	for _, action := range actions {
+		principals, resources := actionTypes(sdef, action)
+		for _, principal := range principals {
+			for _, resource := range resources {
+				if policyApplies(sdef, policy, principal, action, resource).possible {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// variableFacts are what the scope and `when` conditions require of one of
+// the request variables
+type variableFacts struct {
+	name   string
+	equals []engine.EntityValue
+	isType []string
+}
+
+func (f *variableFacts) addEqual(value engine.EntityValue) {
+	for _, item := range f.equals {
+		if item.String() == value.String() {
+			return
+		}
+	}
+	f.equals = append(f.equals, value)
+}
+
+func (f *variableFacts) addType(kind string) {
+	for _, item := range f.isType {
+		if item == kind {
+			return
+		}
+	}
+	f.isType = append(f.isType, kind)
+}
+
+// conflict describes why no value can satisfy the facts, empty if there
+// could be one
+func (f *variableFacts) conflict() string {
+	if len(f.equals) > 1 {
+		return fmt.Sprintf("%s can't be both %s and %s", f.name, f.equals[0].String(), f.equals[1].String())
+	}
+	if len(f.isType) > 1 {
+		return fmt.Sprintf("%s can't be both of type %s and %s", f.name, f.isType[0], f.isType[1])
+	}
+	if len(f.equals) == 1 && len(f.isType) == 1 && f.equals[0].EntityType() != f.isType[0] {
+		return fmt.Sprintf("%s %s is not of type %s", f.name, f.equals[0].String(), f.isType[0])
+	}
+	return ""
+}
+
+// contradiction checks the policy for requirements which can't all hold,
+// returning a description of the first one found
+func contradiction(policy *engine.Policy) string {
+	facts := map[engine.RunVar]*variableFacts{
+		engine.RunVarPrincipal: {name: "principal"},
+		engine.RunVarAction:    {name: "action"},
+		engine.RunVarResource:  {name: "resource"},
+	}
+
+	scope := policy.Scope()
+	for source, c := range map[engine.RunVar]engine.ScopeConstraint{
+		engine.RunVarPrincipal: scope.Principal,
+		engine.RunVarAction:    scope.Action,
+		engine.RunVarResource:  scope.Resource,
+	} {
+		if c.Op == engine.OpEql && len(c.Entities) == 1 {
+			facts[source].addEqual(c.Entities[0])
+		}
+		if c.IsType != "" {
+			facts[source].addType(c.IsType)
+		}
+	}
+
+	for _, cond := range policy.Conditions {
+		if cond.Condition != engine.ConditionWhen {
+			for _, item := range splitExpr(cond.Expr, engine.OpLor) {
+				if isTrue(item) {
+					return "unless condition is always true"
+				}
+			}
+			continue
+		}
+		for _, item := range splitExpr(cond.Expr, engine.OpLand) {
+			if isFalse(item) {
+				return "when condition is always false"
+			}
+			expr, ok := item.(*engine.BinaryExpr)
+			if !ok || (expr.Op != engine.OpEql && expr.Op != engine.OpIs) {
+				continue
+			}
+			source, value, ok := variableEntity(expr)
+			if !ok {
+				continue
+			}
+			if expr.Op == engine.OpEql {
+				facts[source].addEqual(value)
+			} else {
+				facts[source].addType(value.EntityType())
+			}
+		}
+	}
+
+	for _, source := range []engine.RunVar{engine.RunVarPrincipal, engine.RunVarAction, engine.RunVarResource} {
+		if reason := facts[source].conflict(); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// variableEntity matches `<variable> op <entity>`, for `==` the operands may
+// be either way around
+func variableEntity(expr *engine.BinaryExpr) (engine.RunVar, engine.EntityValue, bool) {
+	match := func(left, right engine.EvalNode) (engine.RunVar, engine.EntityValue, bool) {
+		ref, ok := left.(*engine.Reference)
+		if !ok {
+			return 0, engine.EntityValue{}, false
+		}
+		switch ref.Source {
+		case engine.RunVarPrincipal, engine.RunVarAction, engine.RunVarResource:
+		default:
+			return 0, engine.EntityValue{}, false
+		}
+		val, ok := right.(*engine.ValueNode)
+		if !ok {
+			return 0, engine.EntityValue{}, false
+		}
+		ent, ok := val.Value.(engine.EntityValue)
+		return ref.Source, ent, ok
+	}
+
+	if source, value, ok := match(expr.Left, expr.Right); ok {
+		return source, value, true
+	}
+	if expr.Op == engine.OpEql {
+		return match(expr.Right, expr.Left)
+	}
+	return 0, engine.EntityValue{}, false
+}
+
+func isFalse(node engine.EvalNode) bool {
+	val, ok := node.(*engine.ValueNode)
+	return ok && val.Value == engine.BoolValue(false)
+}
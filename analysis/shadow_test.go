@@ -0,0 +1,104 @@
+package analysis_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/koblas/cedar-go/analysis"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func diagnosticIds(diags []analysis.Diagnostic) []string {
+	output := []string{}
+	for _, item := range diags {
+		output = append(output, item.Policy)
+	}
+	return output
+}
+
+func TestFindShadowedPolicies(t *testing.T) {
+	sdef, err := schema.NewFromJson(strings.NewReader(`{
+	  "": {
+	    "entityTypes": { "User": {}, "Admin": {}, "Photo": {} },
+	    "actions": {
+	      "view": { "appliesTo": { "principalTypes": ["User", "Admin"], "resourceTypes": ["Photo"] } },
+	      "delete": { "appliesTo": { "principalTypes": ["User"], "resourceTypes": ["Photo"] } }
+	    }
+	  }
+	}`))
+	require.NoError(t, err)
+
+	policies, err := parser.ParseRules(`
+	@id("no-delete") forbid(principal, action == Action::"delete", resource);
+	@id("no-suspended") forbid(principal, action, resource) when { principal.suspended };
+
+	@id("delete-own") permit(principal, action == Action::"delete", resource)
+	when { resource.owner == principal };
+
+	@id("view-suspended") permit(principal, action, resource)
+	when { principal.suspended && resource.public };
+
+	@id("user-any") permit(principal is User, action, resource);
+
+	@id("view") permit(principal, action == Action::"view", resource);
+	`)
+	require.NoError(t, err)
+
+	t.Run("without schema", func(t *testing.T) {
+		diags := analysis.FindShadowedPolicies(policies, nil)
+		assert.Equal(t, []string{"delete-own", "view-suspended"}, diagnosticIds(diags))
+		assert.Equal(t, []string{"no-delete"}, diags[0].Related)
+		assert.Equal(t, analysis.DiagnosticShadowed, diags[0].Kind)
+		assert.Equal(t, 5, diags[0].Position.Line)
+	})
+
+	t.Run("with schema", func(t *testing.T) {
+		policies, err := parser.ParseRules(`
+		@id("no-delete") forbid(principal, action == Action::"delete", resource);
+		@id("no-view") forbid(principal, action == Action::"view", resource);
+
+		@id("admin-view") permit(principal == Admin::"root", action == Action::"view", resource);
+		@id("any-admin") permit(principal == Admin::"root", action, resource);
+		@id("user-any") permit(principal in Group::"staff", action, resource);
+		`)
+		require.NoError(t, err)
+
+		diags := analysis.FindShadowedPolicies(policies, sdef)
+		assert.Equal(t, []string{"admin-view", "any-admin"}, diagnosticIds(diags))
+		assert.Equal(t, []string{"no-view"}, diags[1].Related)
+	})
+}
+
+func TestFindUnreachablePolicies(t *testing.T) {
+	sdef, err := schema.NewFromJson(strings.NewReader(`{
+	  "": {
+	    "entityTypes": { "User": {}, "Photo": {} },
+	    "actions": {
+	      "view": { "appliesTo": { "principalTypes": ["User"], "resourceTypes": ["Photo"] } }
+	    }
+	  }
+	}`))
+	require.NoError(t, err)
+
+	policies, err := parser.ParseRules(`
+	@id("ok") permit(principal == User::"a", action, resource) when { resource.public };
+	@id("two-principals") permit(principal == User::"a", action, resource) when { principal == User::"b" };
+	@id("reversed") permit(principal, action, resource) when { User::"a" == principal && principal == User::"b" };
+	@id("two-actions") permit(principal, action == Action::"view", resource) when { action == Action::"edit" };
+	@id("false") permit(principal, action, resource) when { context.mfa && false };
+	@id("unless-true") forbid(principal, action, resource) unless { true };
+	@id("unknown-type") permit(principal == Group::"g", action, resource);
+	`)
+	require.NoError(t, err)
+
+	diags := analysis.FindUnreachablePolicies(policies, nil)
+	assert.Equal(t, []string{"two-principals", "reversed", "two-actions", "false", "unless-true"}, diagnosticIds(diags))
+	assert.Equal(t, `principal can't be both User::"a" and User::"b"`, diags[0].Message)
+
+	diags = analysis.FindUnreachablePolicies(policies, sdef)
+	assert.Equal(t, []string{"two-principals", "reversed", "two-actions", "false", "unless-true", "unknown-type"}, diagnosticIds(diags))
+	assert.Equal(t, analysis.DiagnosticUnreachable, diags[5].Kind)
+}
@@ -0,0 +1,186 @@
+package analysis
+
+import (
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+)
+
+// SubsetOf reports whether every request matched by inner is also matched by
+// outer, i.e. the space of requests inner applies to is within outer. The
+// check is sound but incomplete, true is only returned when it can be shown
+// from the scopes and a syntactic comparison of the conditions.
+//
+// The schema is optional, when provided it resolves action groups. Entity
+// hierarchies live in the store so `principal in Group::"a"` is only known to
+// be within the same group.
+func SubsetOf(inner, outer *engine.Policy, sdef *schema.Schema) bool {
+	innerScope := inner.Scope()
+	outerScope := outer.Scope()
+
+	if !entityWithin(innerScope.Principal, outerScope.Principal) ||
+		!actionWithin(sdef, innerScope.Action, outerScope.Action) ||
+		!entityWithin(innerScope.Resource, outerScope.Resource) {
+		return false
+	}
+
+	return conditionsImply(inner.Conditions, outer.Conditions)
+}
+
+// NotWithin returns the ids of the permit policies which are not a subset of
+// any of the baseline permit policies, for example to check that team
+// policies don't grant more than the organization allows.
+func NotWithin(policies, baseline engine.PolicyList, sdef *schema.Schema) []string {
+	output := []string{}
+	for _, policy := range policies {
+		if policy.Effect != engine.EffectPermit {
+			continue
+		}
+		within := false
+		for _, outer := range baseline {
+			if outer.Effect == engine.EffectPermit && SubsetOf(policy, outer, sdef) {
+				within = true
+				break
+			}
+		}
+		if !within {
+			output = append(output, policy.Id)
+		}
+	}
+	return output
+}
+
+// entityWithin checks a principal or resource constraint is at least as
+// narrow as the outer constraint
+func entityWithin(inner, outer engine.ScopeConstraint) bool {
+	if outer.IsAny() {
+		return true
+	}
+	if inner.Slot || outer.Slot {
+		return false
+	}
+
+	if outer.IsType != "" {
+		ofType := inner.IsType == outer.IsType
+		if !ofType && inner.Op == engine.OpEql && len(inner.Entities) != 0 {
+			ofType = true
+			for _, item := range inner.Entities {
+				ofType = ofType && item.EntityType() == outer.IsType
+			}
+		}
+		if !ofType {
+			return false
+		}
+	}
+
+	switch outer.Op {
+	case engine.OpEql, engine.OpIn:
+		// `==` only contains the entity itself, `in` also contains the
+		// descendants which can't be resolved without the store
+		if inner.Op == engine.OpInvalid || (outer.Op == engine.OpEql && inner.Op != engine.OpEql) {
+			return false
+		}
+		return allWithin(inner.Entities, func(item engine.EntityValue) bool {
+			return containsEntity(outer.Entities, item)
+		})
+	}
+
+	return true
+}
+
+// actionWithin checks the action constraint, action groups are resolved with
+// the schema when available
+func actionWithin(sdef *schema.Schema, inner, outer engine.ScopeConstraint) bool {
+	switch outer.Op {
+	case engine.OpInvalid:
+		return true
+	case engine.OpEql:
+		return inner.Op == engine.OpEql && allWithin(inner.Entities, func(item engine.EntityValue) bool {
+			return containsEntity(outer.Entities, item)
+		})
+	case engine.OpIn:
+		if inner.Op == engine.OpInvalid {
+			return false
+		}
+		return allWithin(inner.Entities, func(item engine.EntityValue) bool {
+			for _, group := range outer.Entities {
+				if item.String() == group.String() || (sdef != nil && sdef.IsActionIn(item, group)) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+
+	return false
+}
+
+func allWithin(entities []engine.EntityValue, fn func(engine.EntityValue) bool) bool {
+	if len(entities) == 0 {
+		return false
+	}
+	for _, item := range entities {
+		if !fn(item) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsEntity(entities []engine.EntityValue, target engine.EntityValue) bool {
+	for _, item := range entities {
+		if item.String() == target.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionsImply checks that the inner conditions imply the outer ones. Each
+// conjunct the outer `when` clauses require must also be required by inner,
+// and each disjunct the outer `unless` clauses exclude must also be excluded.
+func conditionsImply(inner, outer []*engine.PolicyCondition) bool {
+	required := map[string]bool{}
+	excluded := map[string]bool{}
+	for _, cond := range inner {
+		if cond.Condition == engine.ConditionWhen {
+			for _, item := range splitExpr(cond.Expr, engine.OpLand) {
+				required[engine.ExprString(item)] = true
+			}
+		} else {
+			for _, item := range splitExpr(cond.Expr, engine.OpLor) {
+				excluded[engine.ExprString(item)] = true
+			}
+		}
+	}
+
+	for _, cond := range outer {
+		if cond.Condition == engine.ConditionWhen {
+			for _, item := range splitExpr(cond.Expr, engine.OpLand) {
+				if !isTrue(item) && !required[engine.ExprString(item)] {
+					return false
+				}
+			}
+		} else {
+			for _, item := range splitExpr(cond.Expr, engine.OpLor) {
+				if !excluded[engine.ExprString(item)] {
+					return false
+				}
+			}
+		}
+	}
+
+	return true
+}
+
+// splitExpr breaks a chain of && or || into its operands
+func splitExpr(node engine.EvalNode, op engine.Operand) []engine.EvalNode {
+	if expr, ok := node.(*engine.BinaryExpr); ok && expr.Op == op {
+		return append(splitExpr(expr.Left, op), splitExpr(expr.Right, op)...)
+	}
+	return []engine.EvalNode{node}
+}
+
+func isTrue(node engine.EvalNode) bool {
+	val, ok := node.(*engine.ValueNode)
+	return ok && val.Value == engine.BoolValue(true)
+}
@@ -0,0 +1,79 @@
+package analysis_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/koblas/cedar-go/analysis"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubsetOf(t *testing.T) {
+	sdef, err := schema.NewFromJson(strings.NewReader(`{
+	  "": {
+	    "entityTypes": { "User": {}, "Photo": {} },
+	    "actions": {
+	      "read": {},
+	      "view": { "memberOf": [{ "id": "read" }] },
+	      "edit": {}
+	    }
+	  }
+	}`))
+	require.NoError(t, err)
+
+	cases := []struct {
+		name   string
+		inner  string
+		outer  string
+		expect bool
+	}{
+		{"identical", `permit(principal, action, resource);`, `permit(principal, action, resource);`, true},
+		{"narrower principal", `permit(principal == User::"a", action, resource);`, `permit(principal, action, resource);`, true},
+		{"wider principal", `permit(principal, action, resource);`, `permit(principal == User::"a", action, resource);`, false},
+		{"same group", `permit(principal in Group::"g", action, resource);`, `permit(principal in Group::"g", action, resource);`, true},
+		{"member of group", `permit(principal == Group::"g", action, resource);`, `permit(principal in Group::"g", action, resource);`, true},
+		{"unknown hierarchy", `permit(principal in Group::"a", action, resource);`, `permit(principal in Group::"g", action, resource);`, false},
+		{"in is wider than eq", `permit(principal in Group::"g", action, resource);`, `permit(principal == Group::"g", action, resource);`, false},
+		{"action in group", `permit(principal, action == Action::"view", resource);`, `permit(principal, action in Action::"read", resource);`, true},
+		{"action list", `permit(principal, action in [Action::"view", Action::"read"], resource);`, `permit(principal, action in Action::"read", resource);`, true},
+		{"action outside group", `permit(principal, action == Action::"edit", resource);`, `permit(principal, action in Action::"read", resource);`, false},
+		{"extra condition", `permit(principal, action, resource) when { context.mfa && resource.public };`, `permit(principal, action, resource) when { context.mfa };`, true},
+		{"missing condition", `permit(principal, action, resource);`, `permit(principal, action, resource) when { context.mfa };`, false},
+		{"unless excluded", `permit(principal, action, resource) unless { resource.private || principal.suspended };`, `permit(principal, action, resource) unless { principal.suspended };`, true},
+		{"unless not excluded", `permit(principal, action, resource);`, `permit(principal, action, resource) unless { principal.suspended };`, false},
+	}
+
+	for _, item := range cases {
+		item := item
+		t.Run(item.name, func(t *testing.T) {
+			inner, err := parser.ParseRules(item.inner)
+			require.NoError(t, err)
+			outer, err := parser.ParseRules(item.outer)
+			require.NoError(t, err)
+
+			assert.Equal(t, item.expect, analysis.SubsetOf(inner[0], outer[0], sdef))
+		})
+	}
+}
+
+func TestNotWithin(t *testing.T) {
+	baseline, err := parser.ParseRules(`
+	@id("org") permit(principal, action == Action::"view", resource) when { context.authenticated };
+	`)
+	require.NoError(t, err)
+	team, err := parser.ParseRules(`
+	@id("team-view") permit(principal in Team::"a", action == Action::"view", resource)
+	when { context.authenticated && resource.shared };
+
+	@id("team-edit") permit(principal in Team::"a", action == Action::"edit", resource)
+	when { context.authenticated };
+
+	@id("team-forbid") forbid(principal, action, resource);
+	`)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"team-edit"}, analysis.NotWithin(team, baseline, nil))
+}
@@ -2,27 +2,58 @@ package cedar
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/koblas/cedar-go/engine"
 	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/policystore"
 	"github.com/koblas/cedar-go/schema"
+	"gopkg.in/yaml.v3"
 )
 
+// ErrNoPolicies is returned for the requests of an authorizer created
+// WithRequireNonEmptyPolicies when it doesn't have any policies
+var ErrNoPolicies = errors.New("authorizer has no policies")
+
+// ErrInvalidContext is returned when the schema of the authorizer declares a
+// context for the action which the request context doesn't match, the error
+// also wraps the schema error such as a schema.NormalizeError
+var ErrInvalidContext = errors.New("request context doesn't match the schema")
+
 // Request is used to setup per-request variables to the authorization engine
 type Request struct {
 	Principal engine.EntityValue
 	Action    engine.EntityValue
 	Resource  engine.EntityValue
 	Context   *engine.VarValue
+	// Entities are consulted before the store of the authorizer, for data
+	// that comes with the request such as the principal built from a token
+	Entities engine.Store
+	// Tracer receives the events of the evaluation of the request, e.g. an
+	// engine.JSONTracer writing to a buffer attached to the request logs
+	Tracer engine.Tracer
 }
 
 // AuthDetail provides additional information about the authorized evaluation.
 type AuthDetail struct {
-	IsAllowed bool
-	Matches   []string
+	IsAllowed bool `json:"isAllowed"`
+	// Matches are the ids of the policies which determined the decision, in
+	// the order of the policies of the authorizer
+	Matches []string `json:"matches"`
+	// Annotations of the policies in Matches keyed by the policy id, such as
+	// an `@advice` on the forbid policy which denied the request
+	Annotations map[string]map[string]string `json:"annotations,omitempty"`
+	// Diagnostics breaks down which policies permitted, forbid, errored or
+	// were skipped for the request
+	Diagnostics engine.Diagnostics `json:"diagnostics"`
+	// NoPoliciesEvaluated is set when the authorizer had no policies, the
+	// request was denied by default rather than by a policy
+	NoPoliciesEvaluated bool `json:"noPoliciesEvaluated,omitempty"`
 }
 
 type Authorizer interface {
@@ -32,11 +63,31 @@ type Authorizer interface {
 //
 //
 
+// SchemaAuthorizer evaluates requests against its policies, it is safe for
+// concurrent use by multiple goroutines. Each evaluation has its own state and
+// sees the policies and store as they were when it started, SetPolicies and
+// SetStore may be called while requests are in flight. Policies and Store
+// must not be assigned directly once the authorizer is in use.
 type SchemaAuthorizer struct {
 	Policies engine.PolicyList
 	Schema   *schema.Schema
 	Store    engine.Store
 	trace    bool
+	coverage *engine.Coverage
+	// requirePolicies fails the requests when there are no policies
+	requirePolicies bool
+	limits          engine.EvalLimits
+	// compile evaluates the policies from their compiled form
+	compile bool
+	cache   *decisionCache
+	subs    subscribers
+	logger  *decisionLogger
+
+	// mu guards Policies, Store and the fields below
+	mu       sync.RWMutex
+	index    *engine.PolicyIndex
+	compiled *engine.CompiledPolicies
+	unwatch  func()
 }
 
 type EmptyStore struct{}
@@ -48,10 +99,30 @@ func StoreFromJson(reader io.Reader, sdef *schema.Schema) (engine.Store, error)
 		sdef = schema.NewEmptySchema()
 	}
 
+	return sdef.DecodeEntities(reader)
+}
+
+// StoreFromJsonStream decodes the entities of the JSON entity format one at a
+// time passing each to add, for example the Add method of a store. Large
+// entity dumps are ingested without holding the decoded document in memory.
+func StoreFromJsonStream(reader io.Reader, sdef *schema.Schema, add func(schema.EntityStoreItem) error) error {
+	if sdef == nil {
+		sdef = schema.NewEmptySchema()
+	}
+
+	return sdef.StreamEntities(reader, add)
+}
+
+// StoreFromYaml creates a store from YAML with the same structure as the
+// JSON entities format, for fixtures and seed data kept as YAML
+func StoreFromYaml(reader io.Reader, sdef *schema.Schema) (engine.Store, error) {
+	if sdef == nil {
+		sdef = schema.NewEmptySchema()
+	}
+
 	entities := schema.JsonEntities{}
-	err := json.NewDecoder(reader).Decode(&entities)
-	if err != nil {
-		panic(fmt.Errorf("unable to decode entities: %w", err))
+	if err := yaml.NewDecoder(reader).Decode(&entities); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unable to parse entities: %s: %w", err, schema.ErrInvalidEntityFormat)
 	}
 
 	return sdef.NormalizeEntites(entities)
@@ -61,7 +132,8 @@ func StoreFromJson(reader io.Reader, sdef *schema.Schema) (engine.Store, error)
 type Option func(*SchemaAuthorizer)
 
 // WithSchema add a schema definition to the engine this
-// is used to parse the input Context information
+// is used to parse the input Context information, the context of each
+// request is checked against the context declared for the action
 func WithSchema(s *schema.Schema) Option {
 	return func(sa *SchemaAuthorizer) {
 		sa.Schema = s
@@ -76,14 +148,75 @@ func WithStore(s engine.Store) Option {
 	}
 }
 
-// WithTracing enables basic evaluation tracing, useful for
-// development purposes
+// WithTracing prints a text trace of every evaluation to stdout, useful for
+// development purposes. Use Request.Tracer to capture the trace of a request.
 func WithTracing() Option {
 	return func(sa *SchemaAuthorizer) {
 		sa.trace = true
 	}
 }
 
+// WithCoverage records the policies, conditions and branches exercised by
+// the requests, see engine.Coverage. Decisions aren't cached while recording.
+func WithCoverage(coverage *engine.Coverage) Option {
+	return func(sa *SchemaAuthorizer) {
+		sa.coverage = coverage
+	}
+}
+
+// WithDecisionCache memoizes the authorization decisions for identical
+// requests, holding up to size entries each for at most ttl. The cache is
+// cleared when the policies or store are replaced via the authorizer or the
+// store publishes an update (see engine.StoreNotifier), other changes to the
+// store must call InvalidateCache.
+func WithDecisionCache(size int, ttl time.Duration) Option {
+	return func(sa *SchemaAuthorizer) {
+		if size > 0 && ttl > 0 {
+			sa.cache = newDecisionCache(size, ttl)
+		}
+	}
+}
+
+// WithRequireNonEmptyPolicies treats an empty policy list as a
+// misconfiguration, the requests fail with ErrNoPolicies rather than being
+// denied. This covers policies which are missing from the start as well as
+// a reload which replaced them with none.
+func WithRequireNonEmptyPolicies() Option {
+	return func(sa *SchemaAuthorizer) {
+		sa.requirePolicies = true
+	}
+}
+
+// WithEvalLimits caps the work of each request for policies which can't be
+// trusted, such as those written by tenants. A request which evaluates more
+// than maxExprNodes expressions or makes more than maxStoreCalls calls to
+// the store fails with an error wrapping engine.ErrEvalBudgetExceeded, a
+// zero limit is unlimited.
+func WithEvalLimits(maxExprNodes, maxStoreCalls int) Option {
+	return func(sa *SchemaAuthorizer) {
+		sa.limits = engine.EvalLimits{MaxExprNodes: maxExprNodes, MaxStoreCalls: maxStoreCalls}
+	}
+}
+
+// WithCompilation evaluates the policies from their compiled form, see
+// engine.Compile, for services where the evaluation is the hot path. The
+// policies are compiled again whenever they are replaced.
+func WithCompilation() Option {
+	return func(sa *SchemaAuthorizer) {
+		sa.compile = true
+	}
+}
+
+// WithCompiledPolicies evaluates policies which were compiled ahead of time,
+// they replace the policies passed to NewAuthorizer
+func WithCompiledPolicies(compiled *engine.CompiledPolicies) Option {
+	return func(sa *SchemaAuthorizer) {
+		sa.Policies = compiled.Policies()
+		sa.compiled = compiled
+		sa.compile = true
+	}
+}
+
 // NewAuthorizer constructs a authorization engine with pre-parsed
 // rules and options
 func NewAuthorizer(p engine.PolicyList, options ...Option) *SchemaAuthorizer {
@@ -95,6 +228,12 @@ func NewAuthorizer(p engine.PolicyList, options ...Option) *SchemaAuthorizer {
 	for _, opt := range options {
 		opt(&conf)
 	}
+	conf.index = engine.NewPolicyIndex(conf.Policies)
+	if conf.compile && !conf.compiled.IsFor(conf.Policies) {
+		conf.compiled = compilePolicies(conf.Policies)
+	}
+	conf.Subscribe(conf.onChange)
+	conf.watchStore()
 
 	return &conf
 }
@@ -102,38 +241,252 @@ func NewAuthorizer(p engine.PolicyList, options ...Option) *SchemaAuthorizer {
 // IsAuthorizedDetail provides additional detail from the evaluation engine about why the
 // result was formed. The `IsAuthorized“ is the perfered method that validation engines
 // should use
+//
+// Policies that fail to evaluate don't contribute to the decision and are reported in
+// Diagnostics.Errors, an error is only returned if the request couldn't be evaluated.
 func (auth *SchemaAuthorizer) IsAuthorizedDetail(ctx context.Context, request *Request) (*AuthDetail, error) {
+	if auth.logger == nil {
+		detail, _, err := auth.isAuthorizedDetail(ctx, request)
+		return detail, err
+	}
+
+	start := time.Now()
+	detail, cached, err := auth.isAuthorizedDetail(ctx, request)
+	auth.logDecision(request, start, detail, cached, err)
+	return detail, err
+}
+
+// isAuthorizedDetail is IsAuthorizedDetail also reporting whether the
+// decision came from the cache
+func (auth *SchemaAuthorizer) isAuthorizedDetail(ctx context.Context, request *Request) (*AuthDetail, bool, error) {
+	var key string
+	var generation uint64
+	// Per request entities make the decision specific to the request
+	if auth.cache != nil && !auth.trace && auth.coverage == nil && request.Tracer == nil && request.Entities == nil {
+		if k, ok := cacheKey(request); ok {
+			if detail, found := auth.cache.get(k); found {
+				return detail, true, nil
+			}
+			key = k
+			generation = auth.cache.current()
+		}
+	}
+
+	policies, index, authStore := auth.state()
+	if len(policies) == 0 && auth.requirePolicies {
+		return nil, false, ErrNoPolicies
+	}
+	if auth.Schema != nil {
+		if err := auth.Schema.ValidateContext(request.Context, request.Principal, request.Action, request.Resource); err != nil {
+			return nil, false, fmt.Errorf("%w: %w", ErrInvalidContext, err)
+		}
+	}
+	req := auth.engineRequest(request, authStore)
+	req.Tracer = request.Tracer
+	req.Coverage = auth.coverage
+	req.Index = index
+	req.Compiled = auth.compiledFor(policies)
+	if req.Tracer == nil && auth.trace {
+		req.Tracer = engine.NewTextTracer(os.Stdout)
+	}
+
+	result, err := engine.Eval(ctx, policies, &req)
+
+	if err != nil {
+		return nil, false, err
+	}
+	detail := AuthDetail{
+		IsAllowed:   result.Decision == engine.Allow,
+		Matches:     result.Reasons,
+		Annotations: matchAnnotations(policies, result.Reasons),
+		Diagnostics: result.Diagnostics,
+
+		NoPoliciesEvaluated: len(policies) == 0,
+	}
+	// Errors may be transient (e.g. a store failure) so aren't cached
+	if key != "" && len(detail.Diagnostics.Errors) == 0 {
+		auth.cache.put(key, &detail, generation)
+	}
+
+	return &detail, false, nil
+}
+
+// engineRequest is the request for the engine, the entities of the request
+// are consulted before the store of the authorizer
+func (auth *SchemaAuthorizer) engineRequest(request *Request, authStore engine.Store) engine.Request {
+	stores := []engine.Store{authStore}
+	if request.Entities != nil {
+		stores = append([]engine.Store{request.Entities}, stores...)
+	}
+	if auth.Schema != nil {
+		stores = append(stores, auth.Schema.ActionStore())
+	}
+	store := stores[0]
+	if len(stores) > 1 {
+		store = engine.NewChainedStore(stores...)
+	}
+
 	req := engine.Request{
 		Principal: request.Principal,
 		Action:    request.Action,
 		Resource:  request.Resource,
 		Context:   request.Context,
-		Store:     auth.Store,
-		Trace:     auth.trace,
+		Store:     store,
+		Limits:    auth.limits,
 	}
-
-	result, err := engine.Eval(ctx, auth.Policies, &req)
-
-	if err != nil {
-		return nil, err
+	if auth.Schema != nil {
+		req.Schema = auth.Schema
 	}
-	return &AuthDetail{
-		IsAllowed: result.Decision == engine.Allow,
-		Matches:   result.Reasons,
-	}, nil
+	return req
 }
 
 // IsAuthorized is the primary entry point that services should use to evaluate based on the
-// pre-loaded rules and store information.
+// pre-loaded rules and store information. If any policy failed to evaluate the request is
+// denied and the policy errors are returned.
 func (auth *SchemaAuthorizer) IsAuthorized(ctx context.Context, request *Request) (bool, error) {
 	detail, err := auth.IsAuthorizedDetail(ctx, request)
 	if err != nil {
 		return false, err
 	}
+	if len(detail.Diagnostics.Errors) != 0 {
+		errs := []error{}
+		for _, item := range detail.Diagnostics.Errors {
+			errs = append(errs, item.Err)
+		}
+		return false, errors.Join(errs...)
+	}
 
 	return detail.IsAllowed, nil
 }
 
+// matchAnnotations collects the annotations of the matching policies, the
+// policies are walked once as every policy of a large set may match
+func matchAnnotations(policies engine.PolicyList, matches []string) map[string]map[string]string {
+	if len(matches) == 0 {
+		return nil
+	}
+	matched := make(map[string]bool, len(matches))
+	for _, id := range matches {
+		matched[id] = true
+	}
+
+	var output map[string]map[string]string
+	for _, policy := range policies {
+		if !matched[policy.Id] || len(policy.Annotations) == 0 {
+			continue
+		}
+		if output == nil {
+			output = map[string]map[string]string{}
+		}
+		output[policy.Id] = policy.Annotations
+	}
+	return output
+}
+
+// state returns the current policies with their index and the store, a
+// request is evaluated with these even if they are replaced meanwhile
+func (auth *SchemaAuthorizer) state() (engine.PolicyList, *engine.PolicyIndex, engine.Store) {
+	auth.mu.RLock()
+	policies, index, store := auth.Policies, auth.index, auth.Store
+	auth.mu.RUnlock()
+
+	if !index.IsFor(policies) {
+		// The policies were assigned without SetPolicies
+		index = engine.NewPolicyIndex(policies)
+		auth.mu.Lock()
+		if index.IsFor(auth.Policies) {
+			auth.index = index
+		}
+		auth.mu.Unlock()
+	}
+
+	return policies, index, store
+}
+
+// compiledFor returns the compiled form of the policies, nil when they are
+// walked instead
+func (auth *SchemaAuthorizer) compiledFor(policies engine.PolicyList) *engine.CompiledPolicies {
+	if !auth.compile {
+		return nil
+	}
+
+	auth.mu.RLock()
+	compiled := auth.compiled
+	auth.mu.RUnlock()
+	if compiled.IsFor(policies) {
+		return compiled
+	}
+
+	// The policies were assigned without SetPolicies
+	compiled = compilePolicies(policies)
+	auth.mu.Lock()
+	if compiled.IsFor(auth.Policies) {
+		auth.compiled = compiled
+	}
+	auth.mu.Unlock()
+
+	return compiled
+}
+
+// compilePolicies compiles the policies, nil if they can't be in which case
+// they are walked and report the errors during evaluation
+func compilePolicies(policies engine.PolicyList) *engine.CompiledPolicies {
+	compiled, err := engine.Compile(policies)
+	if err != nil {
+		return nil
+	}
+	return compiled
+}
+
+// SetPolicies replaces the policies used for evaluation and notifies the
+// subscribers
+func (auth *SchemaAuthorizer) SetPolicies(p engine.PolicyList) {
+	index := engine.NewPolicyIndex(p)
+	var compiled *engine.CompiledPolicies
+	if auth.compile {
+		compiled = compilePolicies(p)
+	}
+
+	auth.mu.Lock()
+	change := policyChanges(auth.Policies, p)
+	auth.Policies = p
+	auth.index = index
+	auth.compiled = compiled
+	auth.mu.Unlock()
+
+	auth.subs.publish(change)
+}
+
+// SetStore replaces the entity store used for evaluation and notifies the
+// subscribers
+func (auth *SchemaAuthorizer) SetStore(s engine.Store) {
+	auth.mu.Lock()
+	auth.Store = s
+	auth.watchStore()
+	auth.mu.Unlock()
+
+	auth.subs.publish(Change{Kind: StoreChanged})
+}
+
+// LoadPolicies replaces the policies with those of the policy store. To
+// follow the store call it again from the store's Watch callback.
+func (auth *SchemaAuthorizer) LoadPolicies(ctx context.Context, store policystore.Store) error {
+	policies, err := policystore.Load(ctx, store)
+	if err != nil {
+		return err
+	}
+	auth.SetPolicies(policies)
+	return nil
+}
+
+// InvalidateCache drops all of the memoized decisions, this should be
+// called whenever the underlying data of the store changes.
+func (auth *SchemaAuthorizer) InvalidateCache() {
+	if auth.cache != nil {
+		auth.cache.clear()
+	}
+}
+
 // NewEntity constructs an engine.EntityValue object based on the kind (e.g. User or Action)
 // and the id (e.g. "alice" or "view")
 func NewEntity(kind, id string) engine.EntityValue {
@@ -141,7 +494,8 @@ func NewEntity(kind, id string) engine.EntityValue {
 }
 
 // ParsePolicies will parse the policy definition and return a runtime
-// evaluation engine for the data.
-func ParsePolicies(policies string) (engine.PolicyList, error) {
-	return parser.ParseRules(policies)
+// evaluation engine for the data. Two policies with the same id are an
+// error wrapping parser.ErrDuplicatePolicyId.
+func ParsePolicies(policies string, opts ...parser.Option) (engine.PolicyList, error) {
+	return parser.ParseRules(policies, opts...)
 }
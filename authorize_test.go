@@ -0,0 +1,450 @@
+package cedar_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreFromYaml(t *testing.T) {
+	store, err := cedar.StoreFromYaml(strings.NewReader(`
+- uid: { type: User, id: alice }
+  parents:
+    - { type: Group, id: staff }
+  attrs:
+    age: 42
+    ip: { __extn: { fn: ip, arg: 10.0.0.1 } }
+    manager: { __entity: { type: User, id: bob } }
+    tags: [a, b]
+- uid: { __entity: { type: User, id: bob } }
+`), nil)
+	require.NoError(t, err)
+
+	alice := cedar.NewEntity("User", "alice")
+	value, err := store.Get(alice, "age")
+	require.NoError(t, err)
+	assert.Equal(t, engine.IntValue(42), value)
+	value, err = store.Get(alice, "manager")
+	require.NoError(t, err)
+	assert.Equal(t, cedar.NewEntity("User", "bob"), value)
+	value, err = store.Get(alice, "tags")
+	require.NoError(t, err)
+	assert.Equal(t, engine.SetValue{engine.StrValue("a"), engine.StrValue("b")}, value)
+
+	policies, err := cedar.ParsePolicies(`permit(principal in Group::"staff", action, resource)
+		when { principal.ip.isInRange(ip("10.0.0.0/8")) };`)
+	require.NoError(t, err)
+	ok, err := cedar.NewAuthorizer(policies, cedar.WithStore(store)).IsAuthorized(context.TODO(), &cedar.Request{
+		Principal: alice,
+		Action:    cedar.NewEntity("Action", "view"),
+		Resource:  cedar.NewEntity("Photo", "vacation.jpg"),
+	})
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// an empty document has no entities
+	_, err = cedar.StoreFromYaml(strings.NewReader(""), nil)
+	require.NoError(t, err)
+
+	_, err = cedar.StoreFromYaml(strings.NewReader(`{ uid: alice }`), nil)
+	assert.ErrorIs(t, err, schema.ErrInvalidEntityFormat)
+	_, err = cedar.StoreFromYaml(strings.NewReader(`- uid: { type: User }`), nil)
+	assert.ErrorIs(t, err, schema.ErrInvalidEntityFormat)
+}
+
+func TestStoreFromJsonStream(t *testing.T) {
+	const entities = `[
+		{ "uid": { "type": "User", "id": "alice" }, "attrs": { "age": 42 }, "parents": [{ "type": "Group", "id": "staff" }] },
+		{ "uid": { "type": "User", "id": "bob" }, "attrs": {}, "parents": [] },
+		{ "uid": { "type": "User", "id": "carol" } }
+	]`
+
+	store := schema.EntityStore{}
+	seen := []string{}
+	err := cedar.StoreFromJsonStream(strings.NewReader(entities), nil, func(item schema.EntityStoreItem) error {
+		seen = append(seen, item.Entity().String())
+		return store.Add(item)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{`User::"alice"`, `User::"bob"`, `User::"carol"`}, seen)
+
+	value, err := store.Get(cedar.NewEntity("User", "alice"), "age")
+	require.NoError(t, err)
+	assert.Equal(t, engine.IntValue(42), value)
+	parents, err := store.GetParents(cedar.NewEntity("User", "alice"))
+	require.NoError(t, err)
+	assert.Contains(t, parents, cedar.NewEntity("Group", "staff"))
+
+	// an error from the callback stops the decoding
+	count := 0
+	errStop := errors.New("stop")
+	err = cedar.StoreFromJsonStream(strings.NewReader(entities), nil, func(item schema.EntityStoreItem) error {
+		count += 1
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, 1, count)
+
+	// entities before an invalid entity have already been processed
+	count = 0
+	err = cedar.StoreFromJsonStream(strings.NewReader(`[{ "uid": { "type": "User", "id": "a" } }, { "uid": {} }]`), nil,
+		func(item schema.EntityStoreItem) error {
+			count += 1
+			return nil
+		})
+	assert.ErrorIs(t, err, schema.ErrInvalidEntityFormat)
+	assert.Equal(t, 1, count)
+
+	assert.ErrorIs(t, store.Add(schema.NewEntityStoreItem(nil, nil, nil)), schema.ErrInvalidEntityFormat)
+}
+
+func TestRequestEntities(t *testing.T) {
+	shared, err := cedar.StoreFromJson(strings.NewReader(`[
+		{ "uid": { "type": "Group", "id": "staff" }, "parents": [{ "type": "Group", "id": "everyone" }] },
+		{ "uid": { "type": "Photo", "id": "vacation.jpg" }, "attrs": { "owner": { "__entity": { "type": "User", "id": "alice" } } } }
+	]`), nil)
+	require.NoError(t, err)
+	policies, err := cedar.ParsePolicies(`
+	permit(principal in Group::"everyone", action, resource)
+		when { resource.owner == principal && principal.verified };
+	`)
+	require.NoError(t, err)
+	auth := cedar.NewAuthorizer(policies, cedar.WithStore(shared), cedar.WithDecisionCache(10, time.Minute))
+
+	principal := func(verified bool) engine.Store {
+		store := schema.EntityStore{}
+		require.NoError(t, store.Add(schema.NewEntityStoreItem(
+			cedar.NewEntity("User", "alice"),
+			[]engine.EntityValue{cedar.NewEntity("Group", "staff")},
+			engine.NewVarValue(map[string]engine.NamedType{"verified": engine.BoolValue(verified)}),
+		)))
+		return store
+	}
+	request := func(entities engine.Store) *cedar.Request {
+		return &cedar.Request{
+			Principal: cedar.NewEntity("User", "alice"),
+			Action:    cedar.NewEntity("Action", "view"),
+			Resource:  cedar.NewEntity("Photo", "vacation.jpg"),
+			Entities:  entities,
+		}
+	}
+
+	ok, err := auth.IsAuthorized(context.TODO(), request(principal(true)))
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// the decision isn't cached as it depends on the request's entities
+	ok, err = auth.IsAuthorized(context.TODO(), request(principal(false)))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// without the entities the principal is unknown
+	detail, err := auth.IsAuthorizedDetail(context.TODO(), request(nil))
+	require.NoError(t, err)
+	assert.False(t, detail.IsAllowed)
+}
+
+func TestSchemaActionGroups(t *testing.T) {
+	sdef, err := schema.NewFromJson(strings.NewReader(`{
+	  "": {
+	    "entityTypes": { "User": {}, "Photo": {} },
+	    "actions": {
+	      "readOnly": {},
+	      "view": { "memberOf": [{ "id": "readOnly" }] },
+	      "thumbnail": { "memberOf": [{ "id": "view" }] },
+	      "edit": {}
+	    }
+	  }
+	}`))
+	require.NoError(t, err)
+	policies, err := cedar.ParsePolicies(`permit(principal, action in Action::"readOnly", resource);`)
+	require.NoError(t, err)
+
+	auth := cedar.NewAuthorizer(policies, cedar.WithSchema(sdef))
+	for action, expect := range map[string]bool{"readOnly": true, "view": true, "thumbnail": true, "edit": false} {
+		ok, err := auth.IsAuthorized(context.TODO(), &cedar.Request{
+			Principal: cedar.NewEntity("User", "alice"),
+			Action:    cedar.NewEntity("Action", action),
+			Resource:  cedar.NewEntity("Photo", "vacation.jpg"),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, expect, ok, action)
+	}
+}
+
+// Run with -race, requests are evaluated while the policies and store are
+// replaced and each request sees one consistent set of policies
+func TestConcurrentAuthorize(t *testing.T) {
+	allow, err := cedar.ParsePolicies(`
+	@id("allow") permit(principal, action, resource) when { principal.active && context.level > 1 };
+	`)
+	require.NoError(t, err)
+	deny, err := cedar.ParsePolicies(`
+	@id("deny-permit") permit(principal, action, resource);
+	@id("deny") forbid(principal, action, resource) unless { resource in Album::"public" };
+	`)
+	require.NoError(t, err)
+	store, err := cedar.StoreFromJson(strings.NewReader(`[
+		{ "uid": { "type": "User", "id": "alice" }, "attrs": { "active": true } }
+	]`), nil)
+	require.NoError(t, err)
+
+	coverage := engine.NewCoverage()
+	authorizers := []*cedar.SchemaAuthorizer{
+		cedar.NewAuthorizer(allow, cedar.WithStore(store), cedar.WithDecisionCache(100, time.Minute)),
+		cedar.NewAuthorizer(allow, cedar.WithStore(store), cedar.WithCoverage(coverage)),
+	}
+	reqContext, err := cedar.NewContextFromMap(map[string]any{"level": 2})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for _, auth := range authorizers {
+		auth := auth
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				if i%2 == 0 {
+					auth.SetPolicies(deny)
+				} else {
+					auth.SetPolicies(allow)
+				}
+				auth.SetStore(store)
+			}
+		}()
+
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func(traced bool) {
+				defer wg.Done()
+				for i := 0; i < 200; i++ {
+					req := cedar.Request{
+						Principal: cedar.NewEntity("User", "alice"),
+						Action:    cedar.NewEntity("Action", "view"),
+						Resource:  cedar.NewEntity("Photo", "a.jpg"),
+						Context:   reqContext,
+					}
+					var trace bytes.Buffer
+					if traced {
+						req.Tracer = engine.NewJSONTracer(&trace)
+					}
+					detail, err := auth.IsAuthorizedDetail(context.TODO(), &req)
+					if !assert.NoError(t, err) {
+						return
+					}
+					if detail.IsAllowed {
+						assert.Equal(t, []string{"allow"}, detail.Matches)
+					} else {
+						assert.Equal(t, []string{"deny"}, detail.Matches)
+					}
+				}
+			}(g%2 == 0)
+		}
+	}
+	wg.Wait()
+}
+
+func TestRequireNonEmptyPolicies(t *testing.T) {
+	request := &cedar.Request{
+		Principal: cedar.NewEntity("User", "alice"),
+		Action:    cedar.NewEntity("Action", "view"),
+		Resource:  cedar.NewEntity("Photo", "vacation.jpg"),
+	}
+
+	detail, err := cedar.NewAuthorizer(nil).IsAuthorizedDetail(context.TODO(), request)
+	require.NoError(t, err)
+	assert.False(t, detail.IsAllowed)
+	assert.True(t, detail.NoPoliciesEvaluated)
+
+	auth := cedar.NewAuthorizer(nil, cedar.WithRequireNonEmptyPolicies())
+	_, err = auth.IsAuthorized(context.TODO(), request)
+	assert.ErrorIs(t, err, cedar.ErrNoPolicies)
+
+	policies, err := cedar.ParsePolicies(`permit(principal, action, resource);`)
+	require.NoError(t, err)
+	auth.SetPolicies(policies)
+	detail, err = auth.IsAuthorizedDetail(context.TODO(), request)
+	require.NoError(t, err)
+	assert.True(t, detail.IsAllowed)
+	assert.False(t, detail.NoPoliciesEvaluated)
+}
+
+func TestContextValidation(t *testing.T) {
+	sdef, err := schema.NewFromText(strings.NewReader(`
+		entity User;
+		entity Photo;
+		action view appliesTo { principal: User, resource: Photo, context: { mfa: Bool, level?: Long, owner?: User } };
+		action list appliesTo { principal: User, resource: Photo };
+	`))
+	require.NoError(t, err)
+	policies, err := cedar.ParsePolicies(`permit(principal, action, resource);`)
+	require.NoError(t, err)
+	auth := cedar.NewAuthorizer(policies, cedar.WithSchema(sdef))
+
+	request := func(action string, context map[string]engine.NamedType) *cedar.Request {
+		req := &cedar.Request{
+			Principal: cedar.NewEntity("User", "alice"),
+			Action:    cedar.NewEntity("Action", action),
+			Resource:  cedar.NewEntity("Photo", "vacation.jpg"),
+		}
+		if context != nil {
+			req.Context = engine.NewVarValue(context)
+		}
+		return req
+	}
+
+	ok, err := auth.IsAuthorized(context.TODO(), request("view", map[string]engine.NamedType{
+		"mfa":   engine.BoolValue(true),
+		"owner": cedar.NewEntity("User", "bob"),
+	}))
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Actions without a declared context aren't checked
+	ok, err = auth.IsAuthorized(context.TODO(), request("list", nil))
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = auth.IsAuthorized(context.TODO(), request("view", nil))
+	assert.ErrorIs(t, err, cedar.ErrInvalidContext)
+
+	_, err = auth.IsAuthorized(context.TODO(), request("view", map[string]engine.NamedType{
+		"mfa":   engine.BoolValue(true),
+		"level": engine.StrValue("high"),
+	}))
+	assert.ErrorIs(t, err, cedar.ErrInvalidContext)
+	var normErr *schema.NormalizeError
+	require.ErrorAs(t, err, &normErr)
+	assert.Equal(t, schema.NormalizeError{Path: "context.level", Expected: "Long", Got: "String"}, *normErr)
+
+	_, err = auth.IsAuthorized(context.TODO(), request("view", map[string]engine.NamedType{
+		"mfa":   engine.BoolValue(true),
+		"owner": cedar.NewEntity("Photo", "a.jpg"),
+	}))
+	require.ErrorAs(t, err, &normErr)
+	assert.Equal(t, schema.NormalizeError{Path: "context.owner", Expected: "User", Got: "Photo"}, *normErr)
+}
+
+// The matches are in the order of the policies for every evaluation
+func TestMatchesOrder(t *testing.T) {
+	policies, err := cedar.ParsePolicies(`
+	@id("z") permit(principal, action, resource);
+	@id("m") permit(principal == User::"alice", action, resource);
+	@id("a") permit(principal in Group::"staff", action, resource);
+	@id("q") permit(principal, action == Action::"view", resource);
+	`)
+	require.NoError(t, err)
+	store, err := cedar.StoreFromJson(strings.NewReader(`[
+		{"uid": {"type": "User", "id": "alice"}, "attrs": {}, "parents": [{"type": "Group", "id": "staff"}]}
+	]`), nil)
+	require.NoError(t, err)
+
+	request := &cedar.Request{
+		Principal: cedar.NewEntity("User", "alice"),
+		Action:    cedar.NewEntity("Action", "view"),
+		Resource:  cedar.NewEntity("Photo", "vacation.jpg"),
+	}
+	for _, opts := range [][]cedar.Option{nil, {cedar.WithCompilation()}} {
+		auth := cedar.NewAuthorizer(policies, append(opts, cedar.WithStore(store))...)
+		for i := 0; i < 20; i++ {
+			detail, err := auth.IsAuthorizedDetail(context.TODO(), request)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"z", "m", "a", "q"}, detail.Matches)
+			assert.Equal(t, []string{"z", "m", "a", "q"}, detail.Diagnostics.Permits)
+		}
+	}
+}
+
+// Without a store the entities have no attributes
+func TestDefaultStore(t *testing.T) {
+	policies, err := cedar.ParsePolicies(`
+	@id("has") permit(principal, action, resource) when { principal has nickname };
+	@id("lookup") permit(principal, action, resource) when { principal.nickname == "al" };
+	`)
+	require.NoError(t, err)
+
+	request := &cedar.Request{
+		Principal: cedar.NewEntity("User", "alice"),
+		Action:    cedar.NewEntity("Action", "view"),
+		Resource:  cedar.NewEntity("Photo", "vacation.jpg"),
+	}
+	for _, opts := range [][]cedar.Option{nil, {cedar.WithCompilation()}} {
+		detail, err := cedar.NewAuthorizer(policies, opts...).IsAuthorizedDetail(context.TODO(), request)
+		require.NoError(t, err)
+		assert.False(t, detail.IsAllowed)
+		assert.Empty(t, detail.Matches)
+		require.Len(t, detail.Diagnostics.Errors, 1)
+		assert.Equal(t, "lookup", detail.Diagnostics.Errors[0].PolicyId)
+		assert.ErrorIs(t, detail.Diagnostics.Errors[0].Err, engine.ErrValueNotFound)
+	}
+}
+
+// An attribute which is stored but not declared exists, unless the schema
+// doesn't allow additional attributes
+func TestUndeclaredStoredAttribute(t *testing.T) {
+	sdef, err := schema.NewFromJson(strings.NewReader(`{"": {
+		"entityTypes": {
+			"User": {"shape": {"type": "Record", "attributes": {"name": {"type": "String"}}, "additionalAttributes": true}},
+			"Photo": {}
+		},
+		"actions": {"view": {"appliesTo": {"principalTypes": ["User"], "resourceTypes": ["Photo"]}}}
+	}}`))
+	require.NoError(t, err)
+	policies, err := cedar.ParsePolicies(`permit(principal, action, resource) when { principal has nickname && principal.nickname == "al" };`)
+	require.NoError(t, err)
+	store, err := cedar.StoreFromJson(strings.NewReader(`[
+		{"uid": {"type": "User", "id": "alice"}, "attrs": {"name": "alice", "nickname": "al"}, "parents": []}
+	]`), sdef)
+	require.NoError(t, err)
+
+	request := &cedar.Request{
+		Principal: cedar.NewEntity("User", "alice"),
+		Action:    cedar.NewEntity("Action", "view"),
+		Resource:  cedar.NewEntity("Photo", "vacation.jpg"),
+	}
+	for _, opts := range [][]cedar.Option{nil, {cedar.WithSchema(sdef)}, {cedar.WithSchema(sdef), cedar.WithCompilation()}} {
+		ok, err := cedar.NewAuthorizer(policies, append(opts, cedar.WithStore(store))...).IsAuthorized(context.TODO(), request)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+}
+
+// The records of a text schema are closed, so an undeclared attribute is
+// known not to exist without reading the store
+func TestUndeclaredAttributeTextSchema(t *testing.T) {
+	sdef, err := schema.NewFromText(strings.NewReader(`
+		entity User = { name: String };
+		entity Photo;
+		action view appliesTo { principal: User, resource: Photo };
+	`))
+	require.NoError(t, err)
+	policies, err := cedar.ParsePolicies(`permit(principal, action, resource) when { principal has age && principal.age > 18 };`)
+	require.NoError(t, err)
+
+	request := &cedar.Request{
+		Principal: cedar.NewEntity("User", "alice"),
+		Action:    cedar.NewEntity("Action", "view"),
+		Resource:  cedar.NewEntity("Photo", "vacation.jpg"),
+	}
+	for _, compile := range []bool{false, true} {
+		store := &countingStore{}
+		opts := []cedar.Option{cedar.WithSchema(sdef), cedar.WithStore(store)}
+		if compile {
+			opts = append(opts, cedar.WithCompilation())
+		}
+		ok, err := cedar.NewAuthorizer(policies, opts...).IsAuthorized(context.TODO(), request)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		assert.Zero(t, store.gets)
+	}
+}
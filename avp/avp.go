@@ -0,0 +1,202 @@
+// Package avp converts policies and schemas to and from the shapes of the
+// Amazon Verified Permissions API, so that a policy store can be mirrored
+// between AVP and evaluation with this library. The types marshal to the JSON
+// of the API requests and responses, no AWS SDK is needed.
+package avp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/schema"
+)
+
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// EntityIdentifier is an entity, as in the slots of a template linked policy
+type EntityIdentifier struct {
+	EntityType string `json:"entityType"`
+	EntityId   string `json:"entityId"`
+}
+
+// StaticPolicyDefinition is a policy without slots
+type StaticPolicyDefinition struct {
+	Description string `json:"description,omitempty"`
+	Statement   string `json:"statement"`
+}
+
+// TemplateLinkedPolicyDefinition is a template with its slots bound
+type TemplateLinkedPolicyDefinition struct {
+	PolicyTemplateId string            `json:"policyTemplateId"`
+	Principal        *EntityIdentifier `json:"principal,omitempty"`
+	Resource         *EntityIdentifier `json:"resource,omitempty"`
+}
+
+// PolicyDefinition is the definition of a CreatePolicy request, one of the
+// fields is set
+type PolicyDefinition struct {
+	Static         *StaticPolicyDefinition         `json:"static,omitempty"`
+	TemplateLinked *TemplateLinkedPolicyDefinition `json:"templateLinked,omitempty"`
+}
+
+// Policy is a policy of the store
+type Policy struct {
+	PolicyId   string           `json:"policyId"`
+	Definition PolicyDefinition `json:"definition"`
+}
+
+// PolicyTemplate is a template of the store
+type PolicyTemplate struct {
+	PolicyTemplateId string `json:"policyTemplateId"`
+	Description      string `json:"description,omitempty"`
+	Statement        string `json:"statement"`
+}
+
+// SchemaDefinition is the definition of a PutSchema request
+type SchemaDefinition struct {
+	CedarJson string `json:"cedarJson"`
+}
+
+// PolicyStore is the content of a policy store
+type PolicyStore struct {
+	Policies  []Policy         `json:"policies"`
+	Templates []PolicyTemplate `json:"templates"`
+}
+
+// ExportPolicies converts the policies of the source to the definitions of a
+// policy store, templates become a PolicyTemplate and the other policies a
+// static policy. The ids are those of the parsed policies, the statements are
+// the source text of each policy.
+func ExportPolicies(src string, opts ...parser.Option) (*PolicyStore, error) {
+	policies, err := parser.ParseRules(src, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	output := PolicyStore{Policies: []Policy{}, Templates: []PolicyTemplate{}}
+	for _, item := range policies {
+		start, end := item.SourceRange.Start.Offset, item.SourceRange.End.Offset+1
+		if start < 0 || end > len(src) || start >= end {
+			return nil, fmt.Errorf("%s: missing source: %w", item.Id, ErrInvalidPolicy)
+		}
+		statement := src[start:end]
+		description, _ := item.Annotation("description")
+
+		if item.IsTemplate() {
+			output.Templates = append(output.Templates, PolicyTemplate{
+				PolicyTemplateId: item.Id,
+				Description:      description,
+				Statement:        statement,
+			})
+			continue
+		}
+		output.Policies = append(output.Policies, Policy{
+			PolicyId: item.Id,
+			Definition: PolicyDefinition{Static: &StaticPolicyDefinition{
+				Description: description,
+				Statement:   statement,
+			}},
+		})
+	}
+
+	return &output, nil
+}
+
+// AddLinks adds the template links as template linked policies
+func (s *PolicyStore) AddLinks(links []engine.TemplateLink) {
+	for _, link := range links {
+		def := TemplateLinkedPolicyDefinition{PolicyTemplateId: link.TemplateId}
+		if value, found := link.Values[engine.SlotPrincipal]; found {
+			def.Principal = &EntityIdentifier{EntityType: value.EntityType(), EntityId: value.EntityId()}
+		}
+		if value, found := link.Values[engine.SlotResource]; found {
+			def.Resource = &EntityIdentifier{EntityType: value.EntityType(), EntityId: value.EntityId()}
+		}
+		s.Policies = append(s.Policies, Policy{
+			PolicyId:   link.LinkId,
+			Definition: PolicyDefinition{TemplateLinked: &def},
+		})
+	}
+}
+
+// PolicyList returns the policies of the store for evaluation, the static
+// policies and the templates linked by the template linked policies. The
+// templates themselves aren't returned. The policy ids are those of the store.
+func (s *PolicyStore) PolicyList() (engine.PolicyList, error) {
+	templates := engine.PolicyList{}
+	for _, item := range s.Templates {
+		policy, err := parsePolicy(item.PolicyTemplateId, item.Statement)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, policy)
+	}
+
+	output := engine.PolicyList{}
+	links := []engine.TemplateLink{}
+	for _, item := range s.Policies {
+		switch def := item.Definition; {
+		case def.Static != nil:
+			policy, err := parsePolicy(item.PolicyId, def.Static.Statement)
+			if err != nil {
+				return nil, err
+			}
+			output = append(output, policy)
+		case def.TemplateLinked != nil:
+			link := engine.TemplateLink{
+				TemplateId: def.TemplateLinked.PolicyTemplateId,
+				LinkId:     item.PolicyId,
+				Values:     map[string]engine.EntityValue{},
+			}
+			if value := def.TemplateLinked.Principal; value != nil {
+				link.Values[engine.SlotPrincipal] = engine.NewEntityValue(value.EntityType, value.EntityId)
+			}
+			if value := def.TemplateLinked.Resource; value != nil {
+				link.Values[engine.SlotResource] = engine.NewEntityValue(value.EntityType, value.EntityId)
+			}
+			links = append(links, link)
+		default:
+			return nil, fmt.Errorf("%s: missing definition: %w", item.PolicyId, ErrInvalidPolicy)
+		}
+	}
+
+	linked, err := engine.LinkTemplates(templates, links)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(output, linked...), nil
+}
+
+// parsePolicy parses the statement of a single policy
+func parsePolicy(id string, statement string) (*engine.Policy, error) {
+	policies, err := parser.ParseRules(statement)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", id, err, ErrInvalidPolicy)
+	}
+	if len(policies) != 1 {
+		return nil, fmt.Errorf("%s: expected a single policy got %d: %w", id, len(policies), ErrInvalidPolicy)
+	}
+	policy := policies[0]
+	policy.Id = id
+
+	return policy, nil
+}
+
+// ExportSchema returns the definition of the schema for PutSchema
+func ExportSchema(sdef *schema.Schema) (SchemaDefinition, error) {
+	data, err := json.Marshal(sdef)
+	if err != nil {
+		return SchemaDefinition{}, err
+	}
+	return SchemaDefinition{CedarJson: string(data)}, nil
+}
+
+// ImportSchema reads the schema of the definition, as returned by GetSchema
+func ImportSchema(def SchemaDefinition) (*schema.Schema, error) {
+	return schema.NewFromJson(bytes.NewReader([]byte(def.CedarJson)))
+}
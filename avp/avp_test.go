@@ -0,0 +1,107 @@
+package avp_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koblas/cedar-go/avp"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+)
+
+const source = `@id("view")
+@description("anyone can view")
+permit(principal, action == Action::"view", resource);
+
+@id("owner")
+permit(principal == ?principal, action, resource in ?resource);
+`
+
+func TestExportPolicies(t *testing.T) {
+	store, err := avp.ExportPolicies(source)
+	require.NoError(t, err)
+
+	require.Len(t, store.Policies, 1)
+	assert.Equal(t, "view", store.Policies[0].PolicyId)
+	assert.Equal(t, "anyone can view", store.Policies[0].Definition.Static.Description)
+	assert.True(t, strings.HasSuffix(store.Policies[0].Definition.Static.Statement, `permit(principal, action == Action::"view", resource);`))
+	require.Len(t, store.Templates, 1)
+	assert.Equal(t, "owner", store.Templates[0].PolicyTemplateId)
+
+	store.AddLinks([]engine.TemplateLink{{
+		TemplateId: "owner",
+		LinkId:     "alice-album",
+		Values: map[string]engine.EntityValue{
+			engine.SlotPrincipal: engine.NewEntityValue("User", "alice"),
+			engine.SlotResource:  engine.NewEntityValue("Album", "a"),
+		},
+	}})
+
+	data, err := json.Marshal(store.Policies[1])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"policyId": "alice-album", "definition": {"templateLinked": {
+		"policyTemplateId": "owner",
+		"principal": {"entityType": "User", "entityId": "alice"},
+		"resource": {"entityType": "Album", "entityId": "a"}
+	}}}`, string(data))
+
+	// The store round trips through JSON to policies which evaluate
+	data, err = json.Marshal(store)
+	require.NoError(t, err)
+	var mirror avp.PolicyStore
+	require.NoError(t, json.Unmarshal(data, &mirror))
+
+	policies, err := mirror.PolicyList()
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+	assert.Equal(t, "view", policies[0].Id)
+	assert.Equal(t, "alice-album", policies[1].Id)
+
+	result, err := engine.Eval(context.TODO(), policies, &engine.Request{
+		Principal: engine.NewEntityValue("User", "alice"),
+		Action:    engine.NewEntityValue("Action", "edit"),
+		Resource:  engine.NewEntityValue("Album", "a"),
+		Store:     schema.EntityStore{},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, engine.Allow, result.Decision)
+	assert.Equal(t, []string{"alice-album"}, result.Reasons)
+}
+
+func TestPolicyListErrors(t *testing.T) {
+	store := avp.PolicyStore{Policies: []avp.Policy{{PolicyId: "empty"}}}
+	_, err := store.PolicyList()
+	assert.ErrorIs(t, err, avp.ErrInvalidPolicy)
+
+	store = avp.PolicyStore{Policies: []avp.Policy{{
+		PolicyId:   "two",
+		Definition: avp.PolicyDefinition{Static: &avp.StaticPolicyDefinition{Statement: "permit(principal, action, resource); permit(principal, action, resource);"}},
+	}}}
+	_, err = store.PolicyList()
+	assert.ErrorIs(t, err, avp.ErrInvalidPolicy)
+
+	store = avp.PolicyStore{Policies: []avp.Policy{{
+		PolicyId:   "link",
+		Definition: avp.PolicyDefinition{TemplateLinked: &avp.TemplateLinkedPolicyDefinition{PolicyTemplateId: "missing"}},
+	}}}
+	_, err = store.PolicyList()
+	assert.ErrorIs(t, err, engine.ErrInvalidLink)
+}
+
+func TestSchemaDefinition(t *testing.T) {
+	sdef, err := schema.NewFromText(strings.NewReader(`entity User; entity Photo; action view appliesTo { principal: User, resource: Photo };`))
+	require.NoError(t, err)
+
+	def, err := avp.ExportSchema(sdef)
+	require.NoError(t, err)
+	assert.Contains(t, def.CedarJson, `"User"`)
+
+	again, err := avp.ImportSchema(def)
+	require.NoError(t, err)
+	assert.Equal(t, sdef.EntityTypeNames(), again.EntityTypeNames())
+}
@@ -0,0 +1,98 @@
+package cedar_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/require"
+)
+
+// benchStore is a user in a chain of groups depth deep, with documents
+// owned by the user
+func benchStore(b *testing.B, depth int) schema.EntityStore {
+	store := schema.EntityStore{}
+	var parents []engine.EntityValue
+	for i := 0; i < depth; i++ {
+		group := engine.NewEntityValue("Group", fmt.Sprintf("g%d", i))
+		require.NoError(b, store.Add(schema.NewEntityStoreItem(group, parents, nil)))
+		parents = []engine.EntityValue{group}
+	}
+	require.NoError(b, store.Add(schema.NewEntityStoreItem(
+		engine.NewEntityValue("User", "alice"),
+		parents,
+		engine.NewVarValue(map[string]engine.NamedType{"level": engine.IntValue(5)}),
+	)))
+	require.NoError(b, store.Add(schema.NewEntityStoreItem(
+		engine.NewEntityValue("Doc", "d1"),
+		nil,
+		engine.NewVarValue(map[string]engine.NamedType{"owner": engine.NewEntityValue("User", "alice")}),
+	)))
+	return store
+}
+
+func BenchmarkIsAuthorized(b *testing.B) {
+	request := &cedar.Request{
+		Principal: engine.NewEntityValue("User", "alice"),
+		Action:    engine.NewEntityValue("Action", "view"),
+		Resource:  engine.NewEntityValue("Doc", "d1"),
+		Context:   engine.NewVarValue(map[string]engine.NamedType{"mfa": engine.BoolValue(true)}),
+	}
+
+	for _, count := range []int{10, 100, 1000} {
+		rules := strings.Builder{}
+		for i := 0; i < count; i++ {
+			// Policies without a principal constraint can't be skipped by the index
+			fmt.Fprintf(&rules, "permit(principal, action == Action::\"view\", resource) when { principal in Group::\"g%d\" && principal.level > %d && context.mfa };\n", i%10, i%10)
+		}
+		policies, err := cedar.ParsePolicies(rules.String())
+		require.NoError(b, err)
+
+		for _, compile := range []bool{false, true} {
+			opts := []cedar.Option{cedar.WithStore(benchStore(b, 10))}
+			if compile {
+				opts = append(opts, cedar.WithCompilation())
+			}
+			auth := cedar.NewAuthorizer(policies, opts...)
+
+			b.Run(fmt.Sprintf("policies=%d/compiled=%t", count, compile), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := auth.IsAuthorized(context.TODO(), request); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDeepHierarchy(b *testing.B) {
+	request := &cedar.Request{
+		Principal: engine.NewEntityValue("User", "alice"),
+		Action:    engine.NewEntityValue("Action", "view"),
+		Resource:  engine.NewEntityValue("Doc", "d1"),
+	}
+	policies, err := cedar.ParsePolicies(`
+	permit(principal in Group::"g0", action, resource) when { resource.owner == principal };
+	forbid(principal, action, resource) when { principal in [Group::"x", Group::"y", Group::"z"] };
+	`)
+	require.NoError(b, err)
+
+	for _, depth := range []int{10, 100} {
+		auth := cedar.NewAuthorizer(policies, cedar.WithStore(benchStore(b, depth)))
+
+		b.Run(fmt.Sprintf("depth=%d", depth), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if ok, err := auth.IsAuthorized(context.TODO(), request); err != nil || !ok {
+					b.Fatal("expected allow", err)
+				}
+			}
+		})
+	}
+}
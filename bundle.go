@@ -0,0 +1,131 @@
+package cedar
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/koblas/cedar-go/token"
+)
+
+var ErrInvalidBundle = errors.New("invalid bundle")
+
+// bundleVersion is the version of the bundle format written by WriteBundle
+const bundleVersion = 1
+
+// Bundle is the policies, schema and entities of a deployment as a single
+// JSON document, so one artifact can be shipped or embedded. The CLI accepts
+// a bundle in place of its policy, schema and entity files.
+type Bundle struct {
+	// Policies are the source of the policy files keyed by the file name
+	Policies map[string]string
+	// Schema is optional
+	Schema *schema.Schema
+	// Entities are optional, in the JSON entity format
+	Entities json.RawMessage
+}
+
+// bundleJson is the document of a bundle, the schema is in the JSON schema
+// format
+type bundleJson struct {
+	Version  int               `json:"cedarBundle"`
+	Policies map[string]string `json:"policies"`
+	Schema   json.RawMessage   `json:"schema,omitempty"`
+	Entities json.RawMessage   `json:"entities,omitempty"`
+}
+
+// LoadBundle reads a bundle written by WriteBundle, the policies and
+// entities are checked when the bundle is loaded
+func LoadBundle(reader io.Reader) (*Bundle, error) {
+	input := bundleJson{}
+	decoder := json.NewDecoder(reader)
+	if err := decoder.Decode(&input); err != nil {
+		return nil, fmt.Errorf("unable to parse bundle: %s: %w", err, ErrInvalidBundle)
+	}
+	if input.Version != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d: %w", input.Version, ErrInvalidBundle)
+	}
+
+	bundle := Bundle{Policies: input.Policies, Entities: input.Entities}
+	if bundle.Policies == nil {
+		bundle.Policies = map[string]string{}
+	}
+	if len(input.Schema) != 0 && string(input.Schema) != "null" {
+		sdef, err := schema.NewFromJson(bytes.NewReader(input.Schema))
+		if err != nil {
+			return nil, fmt.Errorf("bundle schema: %w", err)
+		}
+		bundle.Schema = sdef
+	}
+
+	if _, err := bundle.PolicyList(); err != nil {
+		return nil, err
+	}
+	if _, err := bundle.Store(); err != nil {
+		return nil, err
+	}
+
+	return &bundle, nil
+}
+
+// WriteBundle writes the bundle as a JSON document
+func WriteBundle(writer io.Writer, bundle *Bundle) error {
+	output := bundleJson{
+		Version:  bundleVersion,
+		Policies: bundle.Policies,
+		Entities: bundle.Entities,
+	}
+	if output.Policies == nil {
+		output.Policies = map[string]string{}
+	}
+	if bundle.Schema != nil {
+		data, err := json.Marshal(bundle.Schema)
+		if err != nil {
+			return err
+		}
+		output.Schema = data
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(output)
+}
+
+// PolicyList parses the policy files of the bundle
+func (b *Bundle) PolicyList() (engine.PolicyList, error) {
+	return parser.ParseFiles(token.NewFileSet(), b.Policies)
+}
+
+// Store decodes the entities of the bundle with its schema, it is an empty
+// store when the bundle has no entities
+func (b *Bundle) Store() (engine.Store, error) {
+	if len(b.Entities) == 0 {
+		return schema.EntityStore{}, nil
+	}
+	return StoreFromJson(bytes.NewReader(b.Entities), b.Schema)
+}
+
+// NewAuthorizer creates an authorizer with the policies, schema and entities
+// of the bundle, the options are applied after those of the bundle
+func (b *Bundle) NewAuthorizer(options ...Option) (*SchemaAuthorizer, error) {
+	policies, err := b.PolicyList()
+	if err != nil {
+		return nil, err
+	}
+	store, err := b.Store()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []Option{WithStore(store)}
+	if b.Schema != nil {
+		opts = append(opts, WithSchema(b.Schema))
+	}
+
+	return NewAuthorizer(policies, append(opts, options...)...), nil
+}
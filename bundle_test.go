@@ -0,0 +1,79 @@
+package cedar_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundle(t *testing.T) {
+	sdef, err := schema.NewFromText(strings.NewReader(`
+	entity Group;
+	entity User in [Group];
+	entity Photo;
+	action view appliesTo { principal: User, resource: Photo };
+	`))
+	require.NoError(t, err)
+
+	bundle := cedar.Bundle{
+		Policies: map[string]string{
+			"view.cedar": `@id("view") permit(principal in Group::"friends", action == Action::"view", resource);`,
+		},
+		Schema: sdef,
+		Entities: []byte(`[
+			{"uid": {"type": "User", "id": "alice"}, "attrs": {}, "parents": [{"type": "Group", "id": "friends"}]}
+		]`),
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, cedar.WriteBundle(&buf, &bundle))
+
+	loaded, err := cedar.LoadBundle(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, bundle.Policies, loaded.Policies)
+	require.NotNil(t, loaded.Schema)
+	assert.Equal(t, sdef.EntityTypeNames(), loaded.Schema.EntityTypeNames())
+
+	auth, err := loaded.NewAuthorizer()
+	require.NoError(t, err)
+	ctxValue, err := cedar.NewContextFromMap(nil)
+	require.NoError(t, err)
+	ok, err := auth.IsAuthorized(context.TODO(), &cedar.Request{
+		Principal: engine.NewEntityValue("User", "alice"),
+		Action:    engine.NewEntityValue("Action", "view"),
+		Resource:  engine.NewEntityValue("Photo", "a"),
+		Context:   ctxValue,
+	})
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestLoadBundleErrors(t *testing.T) {
+	for name, input := range map[string]string{
+		"json":     `{`,
+		"version":  `{"cedarBundle": 2, "policies": {}}`,
+		"policy":   `{"cedarBundle": 1, "policies": {"a.cedar": "permit("}}`,
+		"entities": `{"cedarBundle": 1, "policies": {}, "entities": {}}`,
+	} {
+		_, err := cedar.LoadBundle(strings.NewReader(input))
+		assert.Error(t, err, name)
+	}
+
+	_, err := cedar.LoadBundle(strings.NewReader(`{"cedarBundle": 2}`))
+	assert.ErrorIs(t, err, cedar.ErrInvalidBundle)
+
+	// Schema and entities are optional
+	bundle, err := cedar.LoadBundle(strings.NewReader(`{"cedarBundle": 1, "policies": {"a.cedar": "permit(principal, action, resource);"}}`))
+	require.NoError(t, err)
+	assert.Nil(t, bundle.Schema)
+	policies, err := bundle.PolicyList()
+	require.NoError(t, err)
+	assert.Len(t, policies, 1)
+}
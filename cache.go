@@ -0,0 +1,121 @@
+package cedar
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// decisionCache is a LRU cache of authorization decisions where each entry
+// expires after a fixed TTL.
+type decisionCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List // front is the most recently used
+	// generation counts the clears, a decision made before a clear is
+	// stale and isn't stored
+	generation uint64
+}
+
+type cacheEntry struct {
+	key     string
+	detail  AuthDetail
+	expires time.Time
+}
+
+func newDecisionCache(size int, ttl time.Duration) *decisionCache {
+	return &decisionCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// cacheKey builds the key from the request, the context is hashed based on
+// the JSON form which has a stable key order.
+func cacheKey(request *Request) (string, bool) {
+	parts := []string{
+		fmt.Sprintf("%q%q", request.Principal.EntityType(), request.Principal.EntityId()),
+		fmt.Sprintf("%q%q", request.Action.EntityType(), request.Action.EntityId()),
+		fmt.Sprintf("%q%q", request.Resource.EntityType(), request.Resource.EntityId()),
+	}
+	if request.Context != nil {
+		data, err := json.Marshal(request.Context.AsJson())
+		if err != nil {
+			return "", false
+		}
+		sum := sha256.Sum256(data)
+		parts = append(parts, hex.EncodeToString(sum[:]))
+	}
+
+	return strings.Join(parts, "|"), true
+}
+
+func (c *decisionCache) get(key string) (*AuthDetail, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+
+	detail := entry.detail
+	return &detail, true
+}
+
+func (c *decisionCache) current() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+// put stores the decision unless the cache has been cleared since the
+// generation the decision was made in
+func (c *decisionCache) put(key string, detail *AuthDetail, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	entry := &cacheEntry{key: key, detail: *detail, expires: time.Now().Add(c.ttl)}
+	if elem, found := c.entries[key]; found {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *decisionCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[string]*list.Element{}
+	c.order.Init()
+	c.generation += 1
+}
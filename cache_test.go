@@ -0,0 +1,62 @@
+package cedar_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingStore struct {
+	engine.Store
+	gets int
+}
+
+func (s *countingStore) Get(entity engine.EntityValue, key string) (engine.EvalValue, error) {
+	s.gets += 1
+	return engine.BoolValue(true), nil
+}
+
+func TestDecisionCache(t *testing.T) {
+	policies, err := cedar.ParsePolicies(`permit(principal, action, resource) when { principal.active };`)
+	require.NoError(t, err)
+
+	store := &countingStore{}
+	auth := cedar.NewAuthorizer(policies,
+		cedar.WithStore(store),
+		cedar.WithDecisionCache(10, 50*time.Millisecond),
+	)
+	req := cedar.Request{
+		Principal: cedar.NewEntity("User", "alice"),
+		Action:    cedar.NewEntity("Action", "view"),
+		Resource:  cedar.NewEntity("Photo", "vacation.jpg"),
+		Context:   engine.NewVarValue(map[string]engine.NamedType{"ip": engine.StrValue("10.0.0.1")}),
+	}
+
+	for i := 0; i < 3; i++ {
+		result, err := auth.IsAuthorized(context.TODO(), &req)
+		require.NoError(t, err)
+		assert.True(t, result)
+	}
+	assert.Equal(t, 1, store.gets, "repeated requests are served from the cache")
+
+	// A different context is a different request
+	req.Context = engine.NewVarValue(map[string]engine.NamedType{"ip": engine.StrValue("10.0.0.2")})
+	_, err = auth.IsAuthorized(context.TODO(), &req)
+	require.NoError(t, err)
+	assert.Equal(t, 2, store.gets)
+
+	auth.InvalidateCache()
+	_, err = auth.IsAuthorized(context.TODO(), &req)
+	require.NoError(t, err)
+	assert.Equal(t, 3, store.gets)
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = auth.IsAuthorized(context.TODO(), &req)
+	require.NoError(t, err)
+	assert.Equal(t, 4, store.gets, "entries expire after the ttl")
+}
@@ -0,0 +1,87 @@
+package cedar
+
+import (
+	"github.com/koblas/cedar-go/engine"
+)
+
+// CandidateActions returns the actions of the schema which a permit policy
+// could allow on resources of the type. Requests for any other action are
+// always denied, so a gateway can reject them before loading the entities.
+//
+// The principal and the policy conditions aren't considered, so a candidate
+// may still never be permitted. Without a schema the actions can't be
+// enumerated and nil is returned.
+func (auth *SchemaAuthorizer) CandidateActions(resourceType string) []engine.EntityValue {
+	if auth.Schema == nil {
+		return nil
+	}
+	policies, index, _ := auth.state()
+
+	output := []engine.EntityValue{}
+	for _, action := range auth.Schema.ActionEntities() {
+		for pos, candidate := range index.ForResourceType(action, resourceType) {
+			policy := policies[pos]
+			if !candidate || policy.Effect != engine.EffectPermit {
+				continue
+			}
+			scope := policy.Scope()
+			if auth.actionMatches(scope.Action, action) && auth.resourceTypeMatches(scope.Resource, resourceType) {
+				output = append(output, action)
+				break
+			}
+		}
+	}
+
+	return output
+}
+
+// actionMatches checks the action scope of a policy against the action, the
+// action groups are resolved with the schema
+func (auth *SchemaAuthorizer) actionMatches(c engine.ScopeConstraint, action engine.EntityValue) bool {
+	switch c.Op {
+	case engine.OpEql:
+		for _, item := range c.Entities {
+			if item.String() == action.String() {
+				return true
+			}
+		}
+		return false
+	case engine.OpIn:
+		for _, group := range c.Entities {
+			if auth.Schema.IsActionIn(action, group) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// resourceTypeMatches checks whether a resource of the type could satisfy
+// the resource scope of a policy, `in` is resolved with the memberOfTypes of
+// the schema.
+func (auth *SchemaAuthorizer) resourceTypeMatches(c engine.ScopeConstraint, resourceType string) bool {
+	if c.Slot {
+		return true
+	}
+	if c.IsType != "" && c.IsType != resourceType {
+		return false
+	}
+	switch c.Op {
+	case engine.OpEql:
+		for _, item := range c.Entities {
+			if item.EntityType() == resourceType {
+				return true
+			}
+		}
+		return false
+	case engine.OpIn:
+		for _, item := range c.Entities {
+			if item.EntityType() == resourceType || auth.Schema.IsMemberOfType(resourceType, item.EntityType()) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package cedar_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCandidateActions(t *testing.T) {
+	sdef, err := schema.NewFromJson(strings.NewReader(`{
+	  "": {
+	    "entityTypes": {
+	      "User": {},
+	      "Album": {},
+	      "Photo": { "memberOfTypes": ["Album"] },
+	      "Document": {}
+	    },
+	    "actions": {
+	      "read": {},
+	      "view": { "memberOf": [{ "id": "read" }] },
+	      "edit": {},
+	      "delete": {}
+	    }
+	  }
+	}`))
+	require.NoError(t, err)
+
+	policies, err := cedar.ParsePolicies(`
+	permit(principal, action in Action::"read", resource in Album::"holiday");
+	permit(principal == User::"alice", action == Action::"edit", resource == Document::"plan")
+		when { context.mfa };
+	forbid(principal, action == Action::"delete", resource);
+	`)
+	require.NoError(t, err)
+
+	auth := cedar.NewAuthorizer(policies, cedar.WithSchema(sdef))
+	actions := func(names ...string) []engine.EntityValue {
+		output := []engine.EntityValue{}
+		for _, name := range names {
+			output = append(output, cedar.NewEntity("Action", name))
+		}
+		return output
+	}
+
+	assert.Equal(t, actions("read", "view"), auth.CandidateActions("Photo"))
+	assert.Equal(t, actions("read", "view"), auth.CandidateActions("Album"))
+	assert.Equal(t, actions("edit"), auth.CandidateActions("Document"))
+	assert.Equal(t, actions(), auth.CandidateActions("User"))
+
+	// Without a schema the actions aren't known
+	assert.Nil(t, cedar.NewAuthorizer(policies).CandidateActions("Photo"))
+}
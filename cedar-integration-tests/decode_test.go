@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/require"
+)
+
+type entityFixture struct {
+	path     string
+	schema   *schema.Schema
+	entities []byte
+}
+
+func loadEntityFixtures(tb testing.TB) []entityFixture {
+	paths, err := findAllJson()
+	require.NoError(tb, err)
+
+	fixtures := []entityFixture{}
+	for _, path := range paths {
+		if strings.Contains(path, "schema_") || strings.Contains(path, "schema.") {
+			continue
+		}
+		data, err := content.ReadFile(path)
+		require.NoError(tb, err)
+
+		spec := SpecDef{}
+		if err := json.Unmarshal(data, &spec); err != nil || spec.Entities == "" || spec.Schema == "" {
+			continue
+		}
+
+		entityData, err := content.ReadFile(strings.TrimPrefix(spec.Entities, "./"))
+		require.NoError(tb, err)
+		schemaData, err := content.ReadFile(strings.TrimPrefix(spec.Schema, "./"))
+		require.NoError(tb, err)
+		sdef, err := schema.NewFromJson(bytes.NewReader(schemaData))
+		if err != nil {
+			continue
+		}
+
+		fixtures = append(fixtures, entityFixture{path: path, schema: sdef, entities: entityData})
+	}
+
+	return fixtures
+}
+
+// Decoding to float64 loses precision for integers beyond 2^53, which the
+// direct decoder handles exactly
+var largeInt = regexp.MustCompile(`[0-9]{16,}`)
+
+// The direct decoder must produce the same store as the generic normalization
+func TestDecodeEntities(t *testing.T) {
+	for _, item := range loadEntityFixtures(t) {
+		if largeInt.Match(item.entities) {
+			continue
+		}
+		entities := schema.JsonEntities{}
+		require.NoError(t, json.Unmarshal(item.entities, &entities), item.path)
+
+		expected, expectedErr := item.schema.NormalizeEntites(entities)
+		actual, actualErr := item.schema.DecodeEntities(bytes.NewReader(item.entities))
+
+		if expectedErr != nil {
+			require.Error(t, actualErr, item.path)
+			continue
+		}
+		require.NoError(t, actualErr, item.path)
+		require.Equal(t, expected, actual, item.path)
+	}
+}
+
+func BenchmarkEntitiesNormalize(b *testing.B) {
+	fixtures := loadEntityFixtures(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, item := range fixtures {
+			entities := schema.JsonEntities{}
+			if err := json.Unmarshal(item.entities, &entities); err != nil {
+				b.Fatal(err)
+			}
+			_, _ = item.schema.NormalizeEntites(entities)
+		}
+	}
+}
+
+func BenchmarkEntitiesDecode(b *testing.B) {
+	fixtures := loadEntityFixtures(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, item := range fixtures {
+			_, _ = item.schema.DecodeEntities(bytes.NewReader(item.entities))
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	cedar "github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/require"
+)
+
+// hierarchyKnownFailures are specs which fail for reasons other than the
+// entity hierarchy
+var hierarchyKnownFailures = map[string]string{
+	"corpus_tests/dbeca91dba601740aa810e83bf915f68342b4576.json": "record equality (context == context)",
+}
+
+// TestHierarchy checks the policies that match each query, not only the
+// decision, for every spec where the policies use the `in` operator.
+func TestHierarchy(t *testing.T) {
+	paths, err := findAllJson()
+	require.NoError(t, err)
+
+	readFile := func(name string) []byte {
+		data, err := content.ReadFile(strings.TrimPrefix(name, "./"))
+		require.NoError(t, err)
+		return data
+	}
+
+	for _, path := range paths {
+		if strings.Contains(path, "schema") || strings.Contains(path, "sample-data") {
+			continue
+		}
+		spec := SpecDef{}
+		require.NoError(t, json.Unmarshal(readFile(path), &spec))
+		if spec.Policies == "" || spec.Entities == "" {
+			continue
+		}
+		policyData := string(readFile(spec.Policies))
+		if !strings.Contains(policyData, " in ") {
+			continue
+		}
+
+		t.Run(path, func(t *testing.T) {
+			if reason, found := hierarchyKnownFailures[path]; found {
+				t.Skip(reason)
+			}
+
+			sdef, err := schema.NewFromJson(bytes.NewReader(readFile(spec.Schema)))
+			require.NoError(t, err)
+			store, err := sdef.DecodeEntities(bytes.NewReader(readFile(spec.Entities)))
+			require.NoError(t, err)
+			policies, err := parser.ParseRules(policyData)
+			require.NoError(t, err)
+
+			auth := cedar.NewAuthorizer(policies, cedar.WithSchema(sdef), cedar.WithStore(store))
+			for _, query := range spec.Queries {
+				qcontext, err := sdef.NormalizeContext(query.Context, query.Principal, query.Action, query.Resource)
+				require.NoError(t, err, query.Description)
+
+				result, err := auth.IsAuthorizedDetail(context.TODO(), &cedar.Request{
+					Principal: query.Principal,
+					Resource:  query.Resource,
+					Action:    query.Action,
+					Context:   qcontext,
+				})
+				require.NoError(t, err, query.Description)
+
+				reasons := result.Diagnostics.Forbids
+				decision := "Deny"
+				if result.IsAllowed {
+					reasons = result.Diagnostics.Permits
+					decision = "Allow"
+				}
+				require.Equal(t, query.Decision, decision, query.Description)
+				require.ElementsMatch(t, query.Reasons, reasons, query.Description)
+			}
+		})
+	}
+}
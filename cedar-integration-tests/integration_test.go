@@ -5,8 +5,10 @@ import (
 	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -65,6 +67,35 @@ type SpecDef struct {
 	Queries        []SpecQuery
 }
 
+// The reference reports errors as "while evaluating policy `id`: message"
+var policyError = regexp.MustCompile("^while evaluating policy `([^`]*)`: (.*)")
+
+// expectedErrors returns the ids of the policies the reference implementation
+// failed to evaluate with a message starting with prefix
+func expectedErrors(messages []string, prefix string) []string {
+	ids := []string{}
+	for _, item := range messages {
+		if match := policyError.FindStringSubmatch(item); match != nil && strings.HasPrefix(match[2], prefix) {
+			ids = append(ids, match[1])
+		}
+	}
+	return ids
+}
+
+// resultErrors returns the ids of the policies which failed to evaluate
+// with target, or any error if target is nil
+func resultErrors(result *cedar.AuthDetail, target error) []string {
+	ids := []string{}
+	if result != nil {
+		for _, item := range result.Diagnostics.Errors {
+			if target == nil || errors.Is(item.Err, target) {
+				ids = append(ids, item.PolicyId)
+			}
+		}
+	}
+	return ids
+}
+
 func runTests(t *testing.T, dir string) {
 	paths, err := findAllJson()
 	require.NoError(t, err)
@@ -129,14 +160,20 @@ func runTests(t *testing.T, dir string) {
 			policy, err := parser.ParseRules(string(policyData))
 			require.NoError(t, err, "failed to parse policies")
 
-			schema, err := schema.NewFromJson(bytes.NewReader(schemaData))
+			sdef, err := schema.NewFromJson(bytes.NewReader(schemaData))
 			require.NoError(t, err, "failed to parse schema")
 
-			store, err := schema.NormalizeEntites(entities)
+			store, err := sdef.NormalizeEntites(entities)
+			if errors.Is(err, schema.ErrInvalidEntityFormat) {
+				// The entities of the tests which aren't expected to validate
+				// may not match the schema
+				require.False(t, spec.ShouldValidate, "entities don't match the schema: %s", err)
+				store, err = schema.NewEmptySchema().NormalizeEntites(entities)
+			}
 			require.NoError(t, err, "failed to load store - parse entities")
 
 			auth := cedar.NewAuthorizer(policy,
-				cedar.WithSchema(schema),
+				cedar.WithSchema(sdef),
 				cedar.WithStore(store),
 				// cedar.WithTracing(),
 			)
@@ -147,7 +184,7 @@ func runTests(t *testing.T, dir string) {
 					resource := query.Resource
 					action := query.Action
 
-					qcontext, err := schema.NormalizeContext(query.Context, principal, action, resource)
+					qcontext, err := sdef.NormalizeContext(query.Context, principal, action, resource)
 					require.NoError(t, err, "normalize context")
 
 					// fmt.Println("==== ", query.Description, path)
@@ -175,11 +212,18 @@ func runTests(t *testing.T, dir string) {
 					// 	}
 					// }
 
+					require.NoError(t, err)
+
 					resultStr := "Allow"
 					if result == nil || !result.IsAllowed {
 						resultStr = "Deny"
 					}
 					require.Equal(t, query.Decision, resultStr)
+					require.ElementsMatch(t,
+						expectedErrors(query.Errors, ""),
+						resultErrors(result, nil),
+						"policy errors")
+					require.ElementsMatch(t, expectedErrors(query.Errors, "integer overflow"), resultErrors(result, engine.ErrOverflow), "policy overflows")
 					if resultStr == "Allow" {
 						require.NoError(t, err)
 						require.NotNil(t, result, "Result is nil")
@@ -218,6 +262,29 @@ func TestIp(t *testing.T) {
 	runTests(t, "tests/ip/")
 }
 
+// TestIpCorpus runs the corpus tests with policies using the ip extension
+func TestIpCorpus(t *testing.T) {
+	paths, err := findAllJson()
+	require.NoError(t, err)
+
+	usesIp := regexp.MustCompile(`\bip\(|\.is(Ipv4|Ipv6|Loopback|Multicast|InRange)\(`)
+	for _, path := range paths {
+		if !strings.HasPrefix(path, "corpus_tests/") || strings.Contains(path, "schema_") {
+			continue
+		}
+		data, err := content.ReadFile(path)
+		require.NoError(t, err)
+		spec := SpecDef{}
+		require.NoError(t, json.Unmarshal(data, &spec))
+
+		policies, err := content.ReadFile(strings.TrimPrefix(spec.Policies, "./"))
+		require.NoError(t, err)
+		if usesIp.Match(policies) {
+			runTests(t, path)
+		}
+	}
+}
+
 func TestMulti(t *testing.T) {
 	runTests(t, "tests/multi/")
 }
@@ -235,3 +302,7 @@ func TestMulti(t *testing.T) {
 func TestNullTest(t *testing.T) {
 	runTests(t, "corpus_tests/226abd401950859a4fc3fe5f82182ed5cd403d17.json")
 }
+
+func TestOverflow(t *testing.T) {
+	runTests(t, "corpus_tests/7b316784cf9e60631768b35cb7a7e15ba6d01c05.json")
+}
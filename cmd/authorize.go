@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+)
+
+// authorizeOutput is the result printed by `authorize -output json`
+type authorizeOutput struct {
+	Decision string `json:"decision"`
+	// Matches are the ids of the policies which determined the decision
+	Matches []string `json:"matches"`
+	// Errors of the policies which failed to evaluate
+	Errors []authorizeError `json:"errors"`
+	// Error is set when the request couldn't be evaluated
+	Error string `json:"error,omitempty"`
+}
+
+type authorizeError struct {
+	PolicyId string `json:"policyId"`
+	Message  string `json:"message"`
+}
+
+// authorizeCommand evaluates a single request. The exit code is 0 when the
+// request is allowed, 1 when it is denied and 2 when it couldn't be evaluated.
+func authorizeCommand(args []string) int {
+	flags := flag.NewFlagSet("authorize", flag.ExitOnError)
+	policyFile := flags.String("policies", "", "file for policy data")
+	bundleFile := flags.String("bundle", "", "bundle file in place of the policy, schema and entities files")
+	entityFile := flags.String("entities", "", "file for entities data")
+	contextFile := flags.String("context", "", "file for the context of the request as a JSON object")
+	schemaFile := flags.String("schema", "", "file for schema definition")
+	principalStr := flags.String("principal", "", "principal entity e.g. User::\"alice\"")
+	actionStr := flags.String("action", "", "action entity e.g. Action::\"view\"")
+	resourceStr := flags.String("resource", "", "resource entity e.g. Photo::\"VacationPhoto94.jpg\"")
+	output := flags.String("output", "text", "output format, text or json")
+	flags.Parse(args)
+
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", *output)
+		return exitError
+	}
+
+	req := cedar.Request{}
+	for _, item := range []struct {
+		value  string
+		target *engine.EntityValue
+	}{
+		{*principalStr, &req.Principal},
+		{*actionStr, &req.Action},
+		{*resourceStr, &req.Resource},
+	} {
+		if item.value == "" {
+			continue
+		}
+		entity, err := engine.ParseEntity(item.value)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		*item.target = entity
+	}
+
+	var detail *cedar.AuthDetail
+	var err error
+	if *bundleFile != "" {
+		if *policyFile != "" || *schemaFile != "" || *entityFile != "" {
+			fmt.Fprintln(os.Stderr, "a bundle replaces the policy, schema and entities files")
+			return exitError
+		}
+		detail, err = authorizeBundle(&req, *bundleFile, *contextFile)
+	} else {
+		detail, err = authorize(&req, *policyFile, *schemaFile, *entityFile, *contextFile)
+	}
+	if err != nil {
+		writeAuthorizeResult(os.Stdout, *output, authorizeOutput{
+			Decision: engine.Deny.String(),
+			Matches:  []string{},
+			Errors:   []authorizeError{},
+			Error:    err.Error(),
+		})
+		return exitError
+	}
+
+	result := authorizeOutput{
+		Decision: engine.Deny.String(),
+		Matches:  detail.Matches,
+		Errors:   []authorizeError{},
+	}
+	if detail.IsAllowed {
+		result.Decision = engine.Allow.String()
+	}
+	if result.Matches == nil {
+		result.Matches = []string{}
+	}
+	for _, item := range detail.Diagnostics.Errors {
+		result.Errors = append(result.Errors, authorizeError{PolicyId: item.PolicyId, Message: item.Err.Error()})
+	}
+	writeAuthorizeResult(os.Stdout, *output, result)
+
+	if detail.IsAllowed {
+		return exitOK
+	}
+	return exitFail
+}
+
+func authorize(req *cedar.Request, policyFile, schemaFile, entityFile, contextFile string) (*cedar.AuthDetail, error) {
+	policies, err := loadPolicies(policyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []cedar.Option
+	sdef, err := loadSchema(schemaFile)
+	if err != nil {
+		return nil, err
+	}
+	if sdef != nil {
+		opts = append(opts, cedar.WithSchema(sdef))
+	}
+	if entityFile != "" {
+		store, err := loadEntities(entityFile, sdef)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, cedar.WithStore(store))
+	}
+
+	return authorizeRequest(cedar.NewAuthorizer(policies, opts...), req, sdef, contextFile)
+}
+
+// authorizeBundle evaluates the request with the policies, schema and
+// entities of a bundle
+func authorizeBundle(req *cedar.Request, bundleFile, contextFile string) (*cedar.AuthDetail, error) {
+	bundle, err := loadBundle(bundleFile)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := bundle.NewAuthorizer()
+	if err != nil {
+		return nil, err
+	}
+
+	return authorizeRequest(auth, req, bundle.Schema, contextFile)
+}
+
+func authorizeRequest(auth *cedar.SchemaAuthorizer, req *cedar.Request, sdef *schema.Schema, contextFile string) (*cedar.AuthDetail, error) {
+	var err error
+	if contextFile != "" {
+		req.Context, err = loadContext(contextFile, sdef, req.Principal, req.Action, req.Resource)
+	} else {
+		// as with Cedar the context defaults to an empty record
+		req.Context, err = cedar.NewContextFromMap(nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	detail, err := auth.IsAuthorizedDetail(context.Background(), req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to authorize: %w", err)
+	}
+	return detail, nil
+}
+
+func writeAuthorizeResult(w io.Writer, format string, result authorizeOutput) {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(result)
+		return
+	}
+
+	if result.Error != "" {
+		fmt.Fprintf(os.Stderr, "error: %s\n", result.Error)
+		return
+	}
+	if result.Decision == engine.Allow.String() {
+		fmt.Fprintln(w, "ALLOW")
+	} else {
+		fmt.Fprintln(w, "DENY")
+	}
+	for _, id := range result.Matches {
+		fmt.Fprintf(w, "\tmatched %s\n", id)
+	}
+	for _, item := range result.Errors {
+		fmt.Fprintf(w, "\terror %s: %s\n", item.PolicyId, item.Message)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/koblas/cedar-go"
+)
+
+// bundleCommand writes the policy files, schema and entities as a single
+// bundle, see cedar.LoadBundle
+func bundleCommand(args []string) int {
+	flags := flag.NewFlagSet("bundle", flag.ExitOnError)
+	schemaFile := flags.String("schema", "", "file for schema definition")
+	entityFile := flags.String("entities", "", "file for entities data")
+	outputFile := flags.String("o", "", "file for the bundle, standard output by default")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: cedar-go bundle [flags] policy-files...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "policy files must be provided")
+		return exitError
+	}
+
+	bundle := cedar.Bundle{Policies: map[string]string{}}
+	for _, filename := range flags.Args() {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to read policy file: %s\n", err)
+			return exitError
+		}
+		bundle.Policies[filepath.ToSlash(filename)] = string(data)
+	}
+	if _, err := bundle.PolicyList(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	sdef, err := loadSchema(*schemaFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	bundle.Schema = sdef
+
+	if *entityFile != "" {
+		data, err := os.ReadFile(*entityFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to read entity file: %s\n", err)
+			return exitError
+		}
+		bundle.Entities = data
+		if _, err := bundle.Store(); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to load entities: %s\n", err)
+			return exitError
+		}
+	}
+
+	output := os.Stdout
+	if *outputFile != "" {
+		fd, err := os.Create(*outputFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		defer fd.Close()
+		output = fd
+	}
+	if err := cedar.WriteBundle(output, &bundle); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return exitOK
+}
+
+// loadBundle reads a bundle written by the bundle command
+func loadBundle(filename string) (*cedar.Bundle, error) {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open bundle file: %w", err)
+	}
+	defer fd.Close()
+
+	bundle, err := cedar.LoadBundle(fd)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load bundle: %w", err)
+	}
+	return bundle, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/koblas/cedar-go/docs"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/token"
+)
+
+// docsCommand prints the Markdown documentation of the policies of the files
+func docsCommand(args []string) int {
+	flags := flag.NewFlagSet("docs", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: cedar-go docs file...")
+		return exitError
+	}
+
+	files := map[string]string{}
+	for _, filename := range flags.Args() {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		files[filename] = string(src)
+	}
+	policies, err := parser.ParseFiles(token.NewFileSet(), files)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	if err := docs.Markdown(os.Stdout, policies); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return exitOK
+}
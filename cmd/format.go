@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/koblas/cedar-go/cst"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/scanner"
+	"github.com/koblas/cedar-go/token"
+)
+
+// formatCommand prints the policy files in the canonical format, with -w the
+// files are rewritten and with -check the files which aren't formatted are
+// listed and the exit code is 1
+func formatCommand(args []string) int {
+	flags := flag.NewFlagSet("format", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the result to the file instead of stdout")
+	check := flags.Bool("check", false, "list the files which aren't formatted")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: cedar-go format [-w] [-check] file...")
+		return exitError
+	}
+
+	code := exitOK
+	for _, filename := range flags.Args() {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = exitError
+			continue
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), filename, src, parser.ParseComments)
+		if err != nil {
+			scanner.PrintError(os.Stderr, err)
+			code = exitError
+			continue
+		}
+		var buf bytes.Buffer
+		if err := cst.Fprint(&buf, file); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", filename, err)
+			code = exitError
+			continue
+		}
+
+		switch {
+		case *check:
+			if !bytes.Equal(src, buf.Bytes()) {
+				fmt.Println(filename)
+				if code == exitOK {
+					code = exitFail
+				}
+			}
+		case *write:
+			if bytes.Equal(src, buf.Bytes()) {
+				continue
+			}
+			if err := os.WriteFile(filename, buf.Bytes(), 0o644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				code = exitError
+			}
+		default:
+			os.Stdout.Write(buf.Bytes())
+		}
+	}
+	return code
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/koblas/cedar-go/analysis"
+	"github.com/koblas/cedar-go/cst"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/scanner"
+	"github.com/koblas/cedar-go/token"
+)
+
+// lintErrors are the kinds of findings which are errors, the others are
+// warnings
+var lintErrors = map[analysis.DiagnosticKind]bool{
+	analysis.DiagnosticUnknownType:   true,
+	analysis.DiagnosticUnknownAction: true,
+}
+
+// lintCommand reports the syntax errors of the policy files and the
+// findings of the static analysis, the policies of all of the files are
+// analysed together. The exit code is 1 if there was an error, or with
+// -strict a warning.
+func lintCommand(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	schemaFile := flags.String("schema", "", "file for schema definition, enables the schema checks")
+	strict := flags.Bool("strict", false, "treat warnings as errors")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: cedar-go lint [-schema file] [-strict] file...")
+		return exitError
+	}
+	sdef, err := loadSchema(*schemaFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	errors, warnings := 0, 0
+	var policies engine.PolicyList
+	for _, filename := range flags.Args() {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, filename, nil, parser.AllErrors)
+		if err != nil {
+			if list, ok := err.(scanner.ErrorList); ok {
+				for _, item := range list {
+					fmt.Printf("%s: error: %s\n", item.Pos, item.Msg)
+				}
+				errors += len(list)
+			} else {
+				fmt.Printf("%s: error: %s\n", filename, err)
+				errors += 1
+			}
+			continue
+		}
+		fset.Iterate(func(tfile *token.File) bool {
+			var items engine.PolicyList
+			if items, err = cst.ToAst(tfile, file); err == nil {
+				policies = append(policies, items...)
+			}
+			return true
+		})
+		if err != nil {
+			fmt.Printf("%s: error: %s\n", filename, err)
+			errors += 1
+		}
+	}
+
+	for _, item := range analysis.Lint(policies, sdef) {
+		severity := "warning"
+		if lintErrors[item.Kind] {
+			severity = "error"
+			errors += 1
+		} else {
+			warnings += 1
+		}
+		fmt.Printf("%s: %s: %s: %s\n", item.Position, severity, item.Policy, item.Message)
+	}
+
+	if errors != 0 || (*strict && warnings != 0) {
+		return exitFail
+	}
+	return exitOK
+}
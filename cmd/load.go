@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/schema"
+)
+
+// Exit codes shared by the subcommands, a deny or a failed check is 1 so
+// scripts can tell it apart from being unable to run
+const (
+	exitOK    = 0
+	exitFail  = 1
+	exitError = 2
+)
+
+func loadPolicies(filename string) (engine.PolicyList, error) {
+	if filename == "" {
+		return nil, fmt.Errorf("policy file must be provided")
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read policy file: %w", err)
+	}
+	policies, err := parser.ParseRules(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse policies: %w", err)
+	}
+	return policies, nil
+}
+
+// loadSchema reads a JSON schema, or the text format for a .cedarschema
+// file, there is no schema if the filename is empty
+func loadSchema(filename string) (*schema.Schema, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	fd, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open schema file: %w", err)
+	}
+	defer fd.Close()
+
+	var sdef *schema.Schema
+	if strings.HasSuffix(filename, ".cedarschema") {
+		sdef, err = schema.NewFromText(fd)
+	} else {
+		sdef, err = schema.NewFromJson(fd)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read schema file: %w", err)
+	}
+	return sdef, nil
+}
+
+func loadEntities(filename string, sdef *schema.Schema) (engine.Store, error) {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open entity file: %w", err)
+	}
+	defer fd.Close()
+
+	store, err := cedar.StoreFromJson(fd, sdef)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load entities: %w", err)
+	}
+	return store, nil
+}
+
+// loadContext reads a JSON object, with a schema it is checked against the
+// context of the action
+func loadContext(filename string, sdef *schema.Schema, principal, action, resource engine.EntityValue) (*engine.VarValue, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read context file: %w", err)
+	}
+	var input map[string]any
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, fmt.Errorf("unable to parse context file: %w", err)
+	}
+	if sdef == nil {
+		return cedar.NewContextFromMap(input)
+	}
+	context, err := sdef.NormalizeContext(input, principal, action, resource)
+	if err != nil {
+		return nil, fmt.Errorf("invalid context: %w", err)
+	}
+	return context, nil
+}
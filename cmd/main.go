@@ -1,93 +1,75 @@
 package main
 
 import (
-	"context"
-	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/koblas/cedar-go"
-	"github.com/koblas/cedar-go/engine"
-	"github.com/koblas/cedar-go/parser"
-	"github.com/koblas/cedar-go/schema"
 )
 
-func main() {
-	policyFile := flag.String("policies", "", "file for policy data")
-	entityFile := flag.String("entities", "", "file for entities data")
-	// contextFile := flag.String("context", "", "file for context data")
-	schemaFile := flag.String("schema", "", "file for schema definition")
-	principalStr := flag.String("principal", "", "principal entity e.g. User::\"alice\"")
-	actionStr := flag.String("action", "", "action entity e.g. Action::\"view\"")
-	resourceStr := flag.String("resource", "", "resource entity e.g. Photo::\"VacationPhoto94.jpg\"")
-
-	flag.Parse()
-
-	if *policyFile == "" {
-		panic(fmt.Errorf("policy file must provided"))
-	}
-
-	policyData, err := os.ReadFile(*policyFile)
-	if err != nil {
-		panic(fmt.Errorf("unable to read policy file: %w", err))
-	}
-	policy, err := parser.ParseRules(string(policyData))
-	if err != nil {
-		panic(fmt.Errorf("unable to parse policies: %w", err))
-	}
+const usage = `usage: cedar-go <command> [arguments]
 
-	var opts []cedar.Option
-	var sdef *schema.Schema
-	if *schemaFile != "" {
-		fd, err := os.Open(*schemaFile)
-		if err != nil {
-			panic(fmt.Errorf("unable to open schema file: %w", err))
-		}
-		defer fd.Close()
-		sdef, err = schema.NewFromJson(fd)
-		if err != nil {
-			panic(fmt.Errorf("unable to read schema file: %w", err))
-		}
+The commands are:
 
-		opts = append(opts, cedar.WithSchema(sdef))
-	}
+	authorize    evaluate a request against the policies
+	validate     check the policies against a schema
+	lint         report syntax errors and likely mistakes in policy files
+	format       print the policies in the canonical format
+	check-parse  report the syntax errors of policy files
+	repl         evaluate requests and expressions interactively
+	test         run the declarative policy tests
+	bundle       write the policies, schema and entities as a single file
+	docs         print the documentation of the policies as Markdown
+	version      print the engine version information
 
-	if *entityFile != "" {
-		fd, err := os.Open(*entityFile)
-		if err != nil {
-			panic(fmt.Errorf("unable to open entity file: %w", err))
-		}
-		defer fd.Close()
+Use "cedar-go <command> -h" for the arguments of a command.
+`
 
-		store, err := cedar.StoreFromJson(fd, sdef)
-		if err != nil {
-			panic(fmt.Errorf("unable load entities: %w", err))
-		}
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
 
-		opts = append(opts, cedar.WithStore(store))
+func run(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitError
 	}
 
-	auth := cedar.NewAuthorizer(policy, opts...)
-
-	req := cedar.Request{}
-	if *principalStr != "" {
-		req.Principal = engine.NewEntityFromString(*principalStr)
-	}
-	if *actionStr != "" {
-		req.Action = engine.NewEntityFromString(*actionStr)
-	}
-	if *resourceStr != "" {
-		req.Resource = engine.NewEntityFromString(*resourceStr)
+	switch args[0] {
+	case "authorize":
+		return authorizeCommand(args[1:])
+	case "validate":
+		return validateCommand(args[1:])
+	case "lint":
+		return lintCommand(args[1:])
+	case "format":
+		return formatCommand(args[1:])
+	case "check-parse":
+		return checkParseCommand(args[1:])
+	case "repl":
+		return replCommand(args[1:])
+	case "test":
+		return testCommand(args[1:])
+	case "bundle":
+		return bundleCommand(args[1:])
+	case "docs":
+		return docsCommand(args[1:])
+	case "version", "-version", "--version":
+		info := cedar.Version()
+		fmt.Printf("cedar-go %s (language %s, flags %s)\n", info.Module, strings.Join(info.Language, ", "), strings.Join(info.Flags, ", "))
+		return exitOK
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return exitOK
 	}
 
-	result, err := auth.IsAuthorized(context.Background(), &req)
-	if err != nil {
-		panic(fmt.Errorf("unable authorize: %w", err))
+	// Flags without a command are the arguments of authorize, as before
+	// there were commands
+	if strings.HasPrefix(args[0], "-") {
+		return authorizeCommand(args)
 	}
 
-	if result {
-		fmt.Println("ALLOW")
-	} else {
-		fmt.Println("DENY")
-	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+	return exitError
 }
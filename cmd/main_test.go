@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runCapture runs the command line and returns what it wrote to stdout with
+// its exit code
+func runCapture(t *testing.T, args []string) (string, int) {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- data
+	}()
+
+	code := run(args)
+	writer.Close()
+	return string(<-output), code
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	policyFile := filepath.Join(dir, "policies.cedar")
+	require.NoError(t, os.WriteFile(policyFile, []byte(`permit(principal == User::"alice", action, resource);`), 0o600))
+	request := func(principal string) []string {
+		return []string{"-policies", policyFile, "-principal", principal, "-action", `Action::"view"`, "-resource", `Doc::"a"`}
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		output string
+		code   int
+	}{
+		{
+			name:   "allow",
+			args:   append([]string{"authorize"}, request(`User::"alice"`)...),
+			output: "ALLOW\n\tmatched policy0\n",
+			code:   exitOK,
+		},
+		{
+			name:   "deny",
+			args:   append([]string{"authorize"}, request(`User::"bob"`)...),
+			output: "DENY\n",
+			code:   exitFail,
+		},
+		{
+			name:   "error",
+			args:   []string{"authorize", "-principal", `User::"alice"`},
+			output: "",
+			code:   exitError,
+		},
+		{
+			name:   "json allow",
+			args:   append([]string{"authorize", "--output", "json"}, request(`User::"alice"`)...),
+			output: "{\n  \"decision\": \"Allow\",\n  \"matches\": [\n    \"policy0\"\n  ],\n  \"errors\": []\n}\n",
+			code:   exitOK,
+		},
+		{
+			name:   "json deny",
+			args:   append([]string{"authorize", "--output", "json"}, request(`User::"bob"`)...),
+			output: "{\n  \"decision\": \"Deny\",\n  \"matches\": [],\n  \"errors\": []\n}\n",
+			code:   exitFail,
+		},
+		{
+			name:   "json error",
+			args:   []string{"authorize", "--output", "json"},
+			output: "{\n  \"decision\": \"Deny\",\n  \"matches\": [],\n  \"errors\": [],\n  \"error\": \"policy file must be provided\"\n}\n",
+			code:   exitError,
+		},
+		{
+			name:   "flags without a command",
+			args:   request(`User::"alice"`),
+			output: "ALLOW\n\tmatched policy0\n",
+			code:   exitOK,
+		},
+		{
+			name:   "flags without a command deny",
+			args:   request(`User::"bob"`),
+			output: "DENY\n",
+			code:   exitFail,
+		},
+		{
+			name:   "unknown command",
+			args:   []string{"bogus"},
+			output: "",
+			code:   exitError,
+		},
+		{
+			name:   "no command",
+			args:   []string{},
+			output: "",
+			code:   exitError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, code := runCapture(t, test.args)
+			assert.Equal(t, test.output, output)
+			assert.Equal(t, test.code, code)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/koblas/cedar-go/cst"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/scanner"
+	"github.com/koblas/cedar-go/token"
+)
+
+// checkParseCommand reports the syntax errors of the policy files, the exit
+// code is 1 if any file doesn't parse
+func checkParseCommand(args []string) int {
+	flags := flag.NewFlagSet("check-parse", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: cedar-go check-parse file...")
+		return exitError
+	}
+
+	code := exitOK
+	for _, filename := range flags.Args() {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, filename, src, parser.AllErrors)
+		if list, ok := err.(scanner.ErrorList); ok {
+			// Print the line of each error with a caret under the column
+			for _, item := range parser.NewParseErrors(list, src) {
+				fmt.Println(item)
+				if snippet := item.Snippet(); snippet != "" {
+					fmt.Println(snippet)
+				}
+			}
+			code = exitFail
+			continue
+		}
+		if err == nil {
+			fset.Iterate(func(tfile *token.File) bool {
+				_, err = cst.ToAst(tfile, file)
+				return true
+			})
+		}
+		if err != nil {
+			fmt.Println(err)
+			code = exitFail
+		}
+	}
+	return code
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/schema"
+)
+
+const replHelp = `Enter a request to authorize or an expression to evaluate:
+
+	User::"alice" Action::"view" Photo::"a.jpg" { mfa: true }
+	principal in Group::"admins" && context.mfa
+
+Expressions are evaluated with the variables of the last request. The
+commands are:
+
+	:trace     toggle printing the evaluation of each expression
+	:request   print the current request
+	:help      print this message
+	:quit      exit
+`
+
+// replEntity matches an entity literal such as User::"alice"
+const replEntity = `(?:[A-Za-z_][A-Za-z0-9_]*::)+"(?:[^"\\]|\\.)*"`
+
+// replRequest matches the principal, action and resource of a request
+// followed by an optional context record
+var replRequest = regexp.MustCompile(`^(` + replEntity + `)\s+(` + replEntity + `)\s+(` + replEntity + `)\s*(\{.*\})?$`)
+
+type repl struct {
+	auth    *cedar.SchemaAuthorizer
+	store   engine.Store
+	request cedar.Request
+	trace   bool
+	out     io.Writer
+}
+
+// replCommand reads requests and expressions from stdin and prints the
+// decision or value of each of them
+func replCommand(args []string) int {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	policyFile := flags.String("policies", "", "file for policy data")
+	entityFile := flags.String("entities", "", "file for entities data")
+	schemaFile := flags.String("schema", "", "file for schema definition")
+	trace := flags.Bool("trace", false, "print the evaluation of each expression")
+	flags.Parse(args)
+
+	policies := engine.PolicyList{}
+	if *policyFile != "" {
+		var err error
+		if policies, err = loadPolicies(*policyFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	}
+	sdef, err := loadSchema(*schemaFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	var store engine.Store = schema.EntityStore{}
+	if *entityFile != "" {
+		if store, err = loadEntities(*entityFile, sdef); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	}
+	opts := []cedar.Option{cedar.WithStore(store)}
+	if sdef != nil {
+		opts = append(opts, cedar.WithSchema(sdef))
+		store = engine.NewChainedStore(store, sdef.ActionStore())
+	}
+
+	r := repl{
+		auth:  cedar.NewAuthorizer(policies, opts...),
+		store: store,
+		trace: *trace,
+		out:   os.Stdout,
+	}
+	if r.request.Context, err = cedar.NewContextFromMap(nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	fmt.Fprintf(r.out, "%d policies loaded, type :help for help\n", len(policies))
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Fprint(r.out, "> ")
+		if !scanner.Scan() || !r.handle(strings.TrimSpace(scanner.Text())) {
+			break
+		}
+	}
+	fmt.Fprintln(r.out)
+	return exitOK
+}
+
+// handle processes a line of input, returning false to exit
+func (r *repl) handle(line string) bool {
+	switch line {
+	case "":
+	case ":quit", ":q", ":exit":
+		return false
+	case ":help":
+		fmt.Fprint(r.out, replHelp)
+	case ":trace":
+		r.trace = !r.trace
+		fmt.Fprintf(r.out, "trace %t\n", r.trace)
+	case ":request":
+		fmt.Fprintf(r.out, "principal %s\naction %s\nresource %s\ncontext %s\n",
+			r.request.Principal, r.request.Action, r.request.Resource, r.request.Context)
+	default:
+		if strings.HasPrefix(line, ":") {
+			fmt.Fprintf(r.out, "unknown command %s\n", line)
+		} else if match := replRequest.FindStringSubmatch(line); match != nil {
+			r.authorize(match[1:])
+		} else {
+			r.evaluate(line)
+		}
+	}
+	return true
+}
+
+func (r *repl) tracer() engine.Tracer {
+	if r.trace {
+		return engine.NewTextTracer(r.out)
+	}
+	return nil
+}
+
+// eval evaluates the expression with the variables of the current request
+func (r *repl) eval(text string, tracer engine.Tracer) (engine.EvalValue, error) {
+	node, err := parser.ParseExpr(text)
+	if err != nil {
+		return nil, err
+	}
+	return engine.EvalExpr(context.Background(), node, &engine.Request{
+		Principal: r.request.Principal,
+		Action:    r.request.Action,
+		Resource:  r.request.Resource,
+		Context:   r.request.Context,
+		Store:     r.store,
+		Tracer:    tracer,
+	})
+}
+
+// authorize replaces the current request and prints its decision, parts are
+// the principal, action, resource and context
+func (r *repl) authorize(parts []string) {
+	request := cedar.Request{Tracer: r.tracer()}
+	for i, target := range []*engine.EntityValue{&request.Principal, &request.Action, &request.Resource} {
+		value, err := r.eval(parts[i], nil)
+		if err != nil {
+			fmt.Fprintf(r.out, "error: %s\n", err)
+			return
+		}
+		entity, ok := value.(engine.EntityValue)
+		if !ok {
+			fmt.Fprintf(r.out, "error: expected an entity got %s\n", value.TypeName())
+			return
+		}
+		*target = entity
+	}
+
+	request.Context = r.request.Context
+	if parts[3] != "" {
+		value, err := r.eval(parts[3], nil)
+		if err != nil {
+			fmt.Fprintf(r.out, "error: %s\n", err)
+			return
+		}
+		record, ok := value.(*engine.VarValue)
+		if !ok {
+			fmt.Fprintf(r.out, "error: context must be a record got %s\n", value.TypeName())
+			return
+		}
+		request.Context = record
+	}
+	r.request = request
+	r.request.Tracer = nil
+
+	detail, err := r.auth.IsAuthorizedDetail(context.Background(), &request)
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %s\n", err)
+		return
+	}
+	if detail.IsAllowed {
+		fmt.Fprintln(r.out, "ALLOW")
+	} else {
+		fmt.Fprintln(r.out, "DENY")
+	}
+	for _, id := range detail.Matches {
+		fmt.Fprintf(r.out, "\tmatched %s\n", id)
+	}
+	for _, item := range detail.Diagnostics.Errors {
+		fmt.Fprintf(r.out, "\terror %s: %s\n", item.PolicyId, item.Err)
+	}
+}
+
+func (r *repl) evaluate(text string) {
+	value, err := r.eval(text, r.tracer())
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %s\n", err)
+		return
+	}
+	if str, ok := value.(engine.StrValue); ok {
+		fmt.Fprintf(r.out, "%q\n", string(str))
+		return
+	}
+	fmt.Fprintln(r.out, value.String())
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/policytest"
+)
+
+// testCommand runs the declarative policy tests, e.g. `cedar-go test ./policies/...`
+func testCommand(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	verbose := flags.Bool("v", false, "print the result of every test case")
+	cover := flags.Bool("cover", false, "report the policies, conditions and branches not exercised")
+	flags.Parse(args)
+
+	patterns := flags.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	files, err := policytest.Find(patterns...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to find tests: %s\n", err)
+		return 2
+	}
+
+	passed, failed := 0, 0
+	for _, file := range files {
+		suite, err := policytest.Load(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "FAIL %s\n\t%s\n", file, err)
+			failed += 1
+			continue
+		}
+		var results []policytest.Result
+		var report *engine.CoverageReport
+		if *cover {
+			results, report, err = suite.RunCoverage(context.Background())
+		} else {
+			results, err = suite.Run(context.Background())
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "FAIL %s\n\t%s\n", file, err)
+			failed += 1
+			continue
+		}
+		for _, result := range results {
+			if result.Passed {
+				passed += 1
+				if *verbose {
+					fmt.Printf("ok   %s: %s\n", result.Suite, result.Case)
+				}
+				continue
+			}
+			failed += 1
+			fmt.Printf("FAIL %s: %s\n\t%s\n", result.Suite, result.Case, result.Message)
+		}
+		if report != nil {
+			fmt.Printf("%s: ", file)
+			report.Write(os.Stdout)
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed != 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/koblas/cedar-go/analysis"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+)
+
+// validateCommand checks the policies against the schema, the exit code is 1
+// if a problem was found
+func validateCommand(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	policyFile := flags.String("policies", "", "file for policy data")
+	schemaFile := flags.String("schema", "", "file for schema definition")
+	bundleFile := flags.String("bundle", "", "bundle file in place of the policy and schema files")
+	flags.Parse(args)
+
+	var policies engine.PolicyList
+	var sdef *schema.Schema
+	var err error
+	if *bundleFile != "" {
+		policies, sdef, err = loadBundlePolicies(*bundleFile)
+	} else {
+		policies, sdef, err = loadValidateFiles(*policyFile, *schemaFile)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if sdef == nil {
+		fmt.Fprintln(os.Stderr, "schema file must be provided")
+		return exitError
+	}
+
+	problems := validatePolicies(policies, sdef)
+	for _, item := range problems {
+		fmt.Println(item)
+	}
+	if len(problems) != 0 {
+		return exitFail
+	}
+	return exitOK
+}
+
+func loadValidateFiles(policyFile, schemaFile string) (engine.PolicyList, *schema.Schema, error) {
+	if schemaFile == "" {
+		return nil, nil, nil
+	}
+	policies, err := loadPolicies(policyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	sdef, err := loadSchema(schemaFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return policies, sdef, nil
+}
+
+func loadBundlePolicies(bundleFile string) (engine.PolicyList, *schema.Schema, error) {
+	bundle, err := loadBundle(bundleFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	policies, err := bundle.PolicyList()
+	if err != nil {
+		return nil, nil, err
+	}
+	return policies, bundle.Schema, nil
+}
+
+// validatePolicies reports the entity types and actions which the schema
+// doesn't declare, and the policies which can't apply to any request of the
+// schema
+func validatePolicies(policies engine.PolicyList, sdef *schema.Schema) []string {
+	problems := []string{}
+	for _, item := range analysis.FindUnknownTypes(policies, sdef) {
+		problems = append(problems, item.String())
+	}
+	for _, item := range analysis.FindUnreachablePolicies(policies, sdef) {
+		problems = append(problems, item.String())
+	}
+
+	return problems
+}
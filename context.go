@@ -0,0 +1,48 @@
+package cedar
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+)
+
+// NewContextFromMap builds the request context from a map, as produced by
+// decoding JSON into a map[string]any. Entity and extension values use the
+// JSON forms {"__entity": {...}} and {"__extn": {...}}. Without a schema
+// numbers are always a Long.
+func NewContextFromMap(input map[string]any) (*engine.VarValue, error) {
+	if input == nil {
+		input = map[string]any{}
+	}
+	return schema.NewEmptySchema().NormalizeContext(input, engine.EntityValue{}, engine.EntityValue{}, engine.EntityValue{})
+}
+
+// EntityRef is a struct field type for an attribute which references an
+// entity, see NewContextFromStruct
+type EntityRef = schema.EntityRef
+
+// NewContextFromStruct builds the request context from a struct or pointer
+// to a struct. The attribute names are the field names with the first letter
+// lower cased, unless there is a `cedar:"name"` tag. As with encoding/json:
+//
+//   - `cedar:"-"` and unexported fields are skipped
+//   - `cedar:",omitempty"` skips a field with an empty value
+//   - the fields of an embedded struct of an exported type are promoted to
+//     the record, unless the struct has a name in its tag
+//
+// Structs and maps are records, slices and arrays are sets, integers are a
+// Long and a float is a Long when it is a whole number. A time.Time is a
+// Long of the Unix time in seconds, a net.IP is an ipaddr and an EntityRef or
+// engine.EntityValue is an entity.
+func NewContextFromStruct(input any) (*engine.VarValue, error) {
+	v := reflect.ValueOf(input)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("context must be a struct got %s: %w", v.Kind().String(), schema.ErrUnsupportedType)
+	}
+	return schema.NewEmptySchema().NormalizeContext(input, engine.EntityValue{}, engine.EntityValue{}, engine.EntityValue{})
+}
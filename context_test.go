@@ -0,0 +1,169 @@
+package cedar_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewContext(t *testing.T) {
+	policies, err := cedar.ParsePolicies(`
+		permit(principal, action, resource)
+		when { context.mfa && context.level >= 2 && context.owner == User::"alice" };
+	`)
+	require.NoError(t, err)
+	auth := cedar.NewAuthorizer(policies)
+
+	isAllowed := func(t *testing.T, ctx *cedar.Request) bool {
+		ok, err := auth.IsAuthorized(context.TODO(), ctx)
+		require.NoError(t, err)
+		return ok
+	}
+
+	t.Run("map", func(t *testing.T) {
+		vars, err := cedar.NewContextFromMap(map[string]any{
+			"mfa":   true,
+			"level": 3,
+			"owner": map[string]any{"__entity": map[string]any{"type": "User", "id": "alice"}},
+		})
+		require.NoError(t, err)
+		assert.True(t, isAllowed(t, &cedar.Request{Context: vars}))
+	})
+
+	t.Run("nil map", func(t *testing.T) {
+		vars, err := cedar.NewContextFromMap(nil)
+		require.NoError(t, err)
+		_, found := vars.Get("mfa")
+		assert.False(t, found)
+	})
+
+	t.Run("invalid map", func(t *testing.T) {
+		_, err := cedar.NewContextFromMap(map[string]any{
+			"owner": map[string]any{"__entity": map[string]any{"type": "User"}},
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("struct", func(t *testing.T) {
+		type request struct {
+			MFA   bool `cedar:"mfa"`
+			Level int
+			Tags  []string
+		}
+		vars, err := cedar.NewContextFromStruct(&request{MFA: true, Level: 1, Tags: []string{"a"}})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{
+			"mfa":   engine.BoolValue(true),
+			"level": engine.IntValue(1),
+			"tags":  []any{engine.StrValue("a")},
+		}, vars.AsJson())
+	})
+
+	t.Run("not a struct", func(t *testing.T) {
+		_, err := cedar.NewContextFromStruct(map[string]any{})
+		require.ErrorIs(t, err, schema.ErrUnsupportedType)
+	})
+}
+
+type AuditInfo struct {
+	Reason string `cedar:"reason,omitempty"`
+	Ticket string
+}
+
+func TestNewContextFromStructMapping(t *testing.T) {
+	type request struct {
+		AuditInfo
+		*cedar.EntityRef `cedar:"-"`
+		Owner            cedar.EntityRef
+		Device           engine.EntityValue `cedar:"device,omitempty"`
+		Now              time.Time
+		Source           net.IP `cedar:"src"`
+		Ticket           string `cedar:"ticket,omitempty"`
+		Note             string `cedar:",omitempty"`
+		Secret           string `cedar:"-"`
+		internal         string
+	}
+
+	t.Run("mapping", func(t *testing.T) {
+		now := time.Date(2024, 10, 15, 11, 35, 0, 0, time.UTC)
+		vars, err := cedar.NewContextFromStruct(request{
+			AuditInfo: AuditInfo{Ticket: "T-1"},
+			Owner:     cedar.EntityRef{Type: "User", Id: "alice"},
+			Now:       now,
+			Source:    net.ParseIP("10.0.0.1"),
+			Secret:    "hidden",
+			internal:  "hidden",
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]any{
+			"owner":  map[string]any{"__entity": map[string]string{"type": "User", "id": "alice"}},
+			"now":    engine.IntValue(now.Unix()),
+			"src":    map[string]any{"__extn": map[string]string{"fn": "ip", "arg": "10.0.0.1"}},
+			"ticket": engine.StrValue("T-1"),
+		}, vars.AsJson())
+	})
+
+	t.Run("outer field hides embedded", func(t *testing.T) {
+		vars, err := cedar.NewContextFromStruct(request{
+			AuditInfo: AuditInfo{Reason: "audit", Ticket: "T-1"},
+			Owner:     cedar.EntityRef{Type: "User", Id: "alice"},
+			Source:    net.ParseIP("::1"),
+			Ticket:    "T-2",
+			Note:      "note",
+			Device:    cedar.NewEntity("Device", "laptop"),
+		})
+		require.NoError(t, err)
+
+		for key, expect := range map[string]engine.NamedType{
+			"reason": engine.StrValue("audit"),
+			"ticket": engine.StrValue("T-2"),
+			"note":   engine.StrValue("note"),
+			"device": cedar.NewEntity("Device", "laptop"),
+		} {
+			value, found := vars.Get(key)
+			require.True(t, found, key)
+			assert.Equal(t, expect, value, key)
+		}
+	})
+
+	t.Run("evaluate", func(t *testing.T) {
+		policies, err := cedar.ParsePolicies(`
+			permit(principal, action, resource)
+			when {
+				context.owner == principal &&
+				context.now >= 1704067200 &&
+				context.now < 1735686000 &&
+				context.src.isInRange(ip("10.0.0.0/8"))
+			};
+		`)
+		require.NoError(t, err)
+		auth := cedar.NewAuthorizer(policies)
+
+		vars, err := cedar.NewContextFromStruct(&request{
+			Owner:  cedar.EntityRef{Type: "User", Id: "alice"},
+			Now:    time.Date(2024, 6, 1, 0, 0, 0, 0, time.FixedZone("EST", -5*3600)),
+			Source: net.ParseIP("10.1.2.3"),
+		})
+		require.NoError(t, err)
+
+		ok, err := auth.IsAuthorized(context.TODO(), &cedar.Request{
+			Principal: cedar.NewEntity("User", "alice"),
+			Context:   vars,
+		})
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("missing entity type", func(t *testing.T) {
+		_, err := cedar.NewContextFromStruct(request{Owner: cedar.EntityRef{Id: "alice"}})
+		require.ErrorIs(t, err, schema.ErrInvalidEntityFormat)
+	})
+}
@@ -3,9 +3,12 @@ package cst
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 
 	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/scanner"
 	"github.com/koblas/cedar-go/token"
 )
 
@@ -25,136 +28,60 @@ func toEvalNode(file *token.File, node any, msg string) (engine.EvalNode, error)
 	return builder.ToAst(file)
 }
 
-func isHexDigit(ch rune) bool {
-	return (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
-}
-
-func hexValue(b rune) int {
-	c := rune(b)
-	switch {
-	case '0' <= c && c <= '9':
-		return int(c - '0')
-	case 'a' <= c && c <= 'f':
-		return int(c - 'a' + 10)
-	case 'A' <= c && c <= 'F':
-		return int(c - 'A' + 10)
-	}
-	return 0
-}
-
-// Unquote a quoted string
-func unquote(str string) string {
-	// short circuts
-	if str[0] != '"' || str[len(str)-1] != '"' {
-		return str
-	}
-	inQuote := false
-	for _, ch := range str {
-		if ch == '\\' {
-			inQuote = true
-			break
-		}
-	}
-	if !inQuote {
-		return str[1 : len(str)-1]
+// stringValue returns the value of a string literal, with invalid escapes
+// reported at their position. Other literals are returned as written.
+func stringValue(file *token.File, lit *BasicLit, pattern bool) (string, error) {
+	if lit.Kind != token.STRINGLIT || !strings.HasPrefix(lit.Value, `"`) {
+		return lit.Value, nil
 	}
-
-	// Hard work
-	news := []rune{}
-	inQuote = false
-
-	index := 0
-	next := func() {
-		index += 1
+	unquote := scanner.Unquote
+	if pattern {
+		unquote = scanner.UnquotePattern
 	}
-	runeStr := []rune(str[1 : len(str)-1])
-
-	for ; index < len(runeStr); next() {
-		ch := runeStr[index]
-		if !inQuote {
-			if ch == '\\' {
-				inQuote = true
-			} else {
-				news = append(news, ch)
-			}
-		} else {
-			inQuote = false
-			switch ch {
-			case '\\':
-				news = append(news, '\\')
-			case '0':
-				news = append(news, '\000')
-			case '\'':
-				news = append(news, '\'')
-			case 't':
-				news = append(news, '\t')
-			case '"':
-				news = append(news, '"')
-			case 'r':
-				news = append(news, '\r')
-			case 'n':
-				news = append(news, '\n')
-			case 'u':
-				next() // skip 'u'
-				if index == len(runeStr) {
-					news = append(news, 'u')
-					continue
-				}
-				if runeStr[index] != '{' {
-					news = append(news, 'u')
-					news = append(news, runeStr[index])
-					continue
-				}
-				data := []rune{}
-				value := 0
-				for next(); index < len(runeStr) && isHexDigit(runeStr[index]); next() {
-					data = append(data, runeStr[index])
-					value = value<<4 + hexValue(runeStr[index])
-				}
-				if index >= len(runeStr) || runeStr[index] != '}' {
-					// invalid end, append everything
-					news = append(news, '\\', 'u', '{')
-					news = append(news, data...)
-					if index < len(runeStr) {
-						news = append(news, runeStr[index])
-					}
-				} else {
-					news = append(news, rune(value))
-				}
-			}
-		}
+	value, err := unquote(lit.Value)
+	var escErr *scanner.EscapeError
+	if errors.As(err, &escErr) {
+		return "", fmt.Errorf("%s: %w", file.Position(lit.ValuePos+token.Pos(escErr.Offset)), err)
 	}
-
-	return string(news)
+	return value, err
 }
 
-var (
-	trueValue = &engine.ValueNode{
-		Value: engine.BoolValue(true),
-	}
-	falseValue = &engine.ValueNode{
-		Value: engine.BoolValue(false),
-	}
-)
+// trueValue is the scope of a policy without a constraint, it's compared by
+// identity so a literal `true` is never mistaken for it
+var trueValue = &engine.ValueNode{
+	Value: engine.BoolValue(true),
+}
 
 func (n *BasicLit) ToAst(file *token.File) (engine.EvalNode, error) {
 	switch n.Kind {
 	case token.STRINGLIT:
+		value, err := stringValue(file, n, false)
+		if err != nil {
+			return nil, err
+		}
 		return &engine.ValueNode{
-			Value: engine.StrValue(unquote(n.Value)),
+			StartPos: file.Position(n.Pos()),
+			Value:    engine.StrValue(value),
 		}, nil
 	case token.INT:
-		value, err := strconv.Atoi(n.Value)
+		value, err := strconv.ParseInt(n.Value, 10, 64)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%s: invalid long %s: %w", file.Position(n.Pos()), n.Value, engine.ErrOverflow)
 		}
 		return &engine.ValueNode{
-			Value: engine.IntValue(value),
+			StartPos: file.Position(n.Pos()),
+			Value:    engine.IntValue(value),
 		}, nil
 	case token.TRUE:
-		return trueValue, nil
+		return &engine.ValueNode{
+			StartPos: file.Position(n.Pos()),
+			Value:    engine.BoolValue(true),
+		}, nil
 	case token.FALSE:
-		return falseValue, nil
+		return &engine.ValueNode{
+			StartPos: file.Position(n.Pos()),
+			Value:    engine.BoolValue(false),
+		}, nil
 
 	// This needs to do a variable lookup from the runtime context
 	case token.PRINCIPAL:
@@ -179,13 +106,10 @@ func (n *BasicLit) ToAst(file *token.File) (engine.EvalNode, error) {
 		}, nil
 
 	case token.IDENTIFER:
-		return &engine.Identifier{
-			StartPos: file.Position(n.Pos()),
-			Value:    n.Value,
-		}, nil
+		return engine.NewIdentifier(file.Position(n.Pos()), n.Value), nil
 	}
 
-	panic(fmt.Sprintf("%s: invalid literal type %v", file.Position(n.Pos()), n.Kind.String()))
+	return nil, fmt.Errorf("%s: invalid literal type %s: %w", file.Position(n.Pos()), n.Kind.String(), ErrInternal)
 }
 
 func (n *EntityName) ToAst(file *token.File) (engine.EvalNode, error) {
@@ -195,16 +119,70 @@ func (n *EntityName) ToAst(file *token.File) (engine.EvalNode, error) {
 		parts = append(parts, item.Value)
 	}
 
-	parts = append(parts, unquote(n.Path[l].Value))
+	id, err := stringValue(file, &n.Path[l], false)
+	if err != nil {
+		return nil, err
+	}
 
-	value := engine.EntityValue(parts)
+	value := engine.NewEntityValue(strings.Join(parts, engine.ENTITY_PATH_SEP), id)
 
 	return &engine.ValueNode{
-		Value: value,
+		StartPos: file.Position(n.Pos()),
+		Value:    value,
+	}, nil
+}
+
+// ToAst converts `x is T in y` to `x is T && x in y`
+func (n *IsExpr) ToAst(file *token.File) (engine.EvalNode, error) {
+	left, err := toEvalNode(file, n.X, "left")
+	if err != nil {
+		return nil, err
+	}
+	parts := []string{}
+	for _, item := range n.Type.Path {
+		parts = append(parts, item.Value)
+	}
+	isExpr := &engine.BinaryExpr{
+		StartPos: file.Position(n.IsPos),
+		Op:       engine.OpIs,
+		Left:     left,
+		Right: &engine.ValueNode{
+			StartPos: file.Position(n.Type.Pos()),
+			Value:    engine.NewEntityValue(strings.Join(parts, engine.ENTITY_PATH_SEP), ""),
+		},
+	}
+	if n.In == nil {
+		return isExpr, nil
+	}
+
+	right, err := toEvalNode(file, n.In, "right")
+	if err != nil {
+		return nil, err
+	}
+	return &engine.BinaryExpr{
+		StartPos: file.Position(n.IsPos),
+		Op:       engine.OpLand,
+		Left:     isExpr,
+		Right: &engine.BinaryExpr{
+			StartPos: file.Position(n.InPos),
+			Op:       engine.OpIn,
+			Left:     left,
+			Right:    right,
+		},
 	}, nil
 }
 
 func (n *UnaryExpr) ToAst(file *token.File) (engine.EvalNode, error) {
+	// The smallest long is only representable as a negated literal
+	if lit, ok := n.X.(*BasicLit); ok && n.Op == token.SUB && lit.Kind == token.INT {
+		if value, err := strconv.ParseInt("-"+lit.Value, 10, 64); err == nil && value == math.MinInt64 {
+			return &engine.ValueNode{
+				StartPos: file.Position(n.Pos()),
+				Value:    engine.IntValue(value),
+			}, nil
+		}
+	}
+
 	left, err := toEvalNode(file, n.X, "left")
 	if err != nil {
 		return nil, err
@@ -217,7 +195,7 @@ func (n *UnaryExpr) ToAst(file *token.File) (engine.EvalNode, error) {
 	case token.NOT:
 		opcode = engine.OpNot
 	default:
-		return nil, fmt.Errorf("unimplemented unary opcode %s: %w", n.Op.String(), ErrInternal)
+		return nil, fmt.Errorf("%s: unimplemented unary opcode %s: %w", file.Position(n.Pos()), n.Op.String(), ErrInternal)
 	}
 
 	return &engine.UnaryExpr{
@@ -232,9 +210,23 @@ func (n *BinaryExpr) ToAst(file *token.File) (engine.EvalNode, error) {
 	if err != nil {
 		return nil, err
 	}
-	right, err := toEvalNode(file, n.Y, "right")
-	if err != nil {
-		return nil, err
+	if path, ok := n.Y.(*MemberExpr); ok && n.Op == token.HAS {
+		return hasPath(file, n.OpPos, left, path)
+	}
+	var right engine.EvalNode
+	var compiled *engine.Pattern
+	if lit, ok := n.Y.(*BasicLit); ok && n.Op == token.LIKE && lit.Kind == token.STRINGLIT {
+		pattern, err := stringValue(file, lit, true)
+		if err != nil {
+			return nil, err
+		}
+		right = &engine.ValueNode{StartPos: file.Position(lit.Pos()), Value: engine.StrValue(pattern)}
+		compiled = engine.CompilePattern(pattern)
+	} else {
+		right, err = toEvalNode(file, n.Y, "right")
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	var opcode engine.Operand
@@ -278,7 +270,7 @@ func (n *BinaryExpr) ToAst(file *token.File) (engine.EvalNode, error) {
 		opcode = engine.OpHas
 
 	default:
-		return nil, fmt.Errorf("unimplemented binary opcode %s: %w", n.Op.String(), ErrInternal)
+		return nil, fmt.Errorf("%s: unimplemented binary opcode %s: %w", file.Position(n.OpPos), n.Op.String(), ErrInternal)
 	}
 
 	return &engine.BinaryExpr{
@@ -286,9 +278,58 @@ func (n *BinaryExpr) ToAst(file *token.File) (engine.EvalNode, error) {
 		Op:       opcode,
 		Left:     left,
 		Right:    right,
+		Pattern:  compiled,
 	}, nil
 }
 
+// hasPath converts `x has a.b.c` to `x has a && x.a has b && x.a.b has c`,
+// which is false rather than an error when an attribute is missing
+func hasPath(file *token.File, pos token.Pos, left engine.EvalNode, path *MemberExpr) (engine.EvalNode, error) {
+	first, ok := path.Primary.(*BasicLit)
+	if !ok {
+		return nil, fmt.Errorf("%s: invalid attribute path: %w", file.Position(path.Pos()), ErrInternal)
+	}
+	names := []*BasicLit{first}
+	for _, item := range path.Access {
+		if item.IsFunc || item.IsRef {
+			return nil, fmt.Errorf("%s: invalid attribute path: %w", file.Position(item.Pos()), ErrInternal)
+		}
+		names = append(names, item.Ident)
+	}
+
+	var result engine.EvalNode
+	for _, name := range names {
+		attr, err := name.ToAst(file)
+		if err != nil {
+			return nil, err
+		}
+		check := &engine.BinaryExpr{
+			StartPos: file.Position(pos),
+			Op:       engine.OpHas,
+			Left:     left,
+			Right:    attr,
+		}
+		if result == nil {
+			result = check
+		} else {
+			result = &engine.BinaryExpr{
+				StartPos: file.Position(pos),
+				Op:       engine.OpLand,
+				Left:     result,
+				Right:    check,
+			}
+		}
+		left = &engine.BinaryExpr{
+			StartPos: file.Position(name.Pos()),
+			Op:       engine.OpLookup,
+			Left:     left,
+			Right:    attr,
+		}
+	}
+
+	return result, nil
+}
+
 func (n *ParenExpr) ToAst(file *token.File) (engine.EvalNode, error) {
 	return toEvalNode(file, n.X, "left")
 }
@@ -320,7 +361,11 @@ func (n *ReceiverInits) ToAst(file *token.File) (engine.EvalNode, error) {
 	for _, item := range n.Exprs {
 		var key string
 		if item.Literal.Kind == token.STRINGLIT {
-			key = unquote(item.Literal.Value)
+			value, err := stringValue(file, item.Literal, false)
+			if err != nil {
+				return nil, err
+			}
+			key = value
 		} else if item.Literal.Kind == token.IDENTIFER {
 			key = item.Literal.Value
 		}
@@ -368,7 +413,7 @@ func (n *MemberExpr) ToAst(file *token.File) (engine.EvalNode, error) {
 	for _, item := range n.Access {
 		lit, err := item.Ident.ToAst(file)
 		if err != nil {
-			return nil, fmt.Errorf("MemberExpr: invalid condition type %T: %w", n.Primary, ErrInternal)
+			return nil, fmt.Errorf("%s: invalid member %s: %w", file.Position(item.Pos()), item.Ident.Value, err)
 		}
 
 		if item.IsFunc {
@@ -383,19 +428,33 @@ func (n *MemberExpr) ToAst(file *token.File) (engine.EvalNode, error) {
 			}
 
 			left = &engine.FunctionCall{
-				StartPos: file.Position(n.Pos()),
+				StartPos: file.Position(item.Pos()),
 				Name:     item.Ident.Value,
 				Self:     left,
 				Args:     args,
 			}
 		} else {
 			left = &engine.BinaryExpr{
-				StartPos: file.Position(n.Pos()),
+				StartPos: file.Position(item.Pos()),
 				Op:       engine.OpLookup,
 				Left:     left,
 				Right:    lit,
 			}
 		}
+
+		// `.name["attr"]` is parsed as a single access
+		if item.IsRef && item.Index != nil {
+			index, err := item.Index.ToAst(file)
+			if err != nil {
+				return nil, err
+			}
+			left = &engine.BinaryExpr{
+				StartPos: file.Position(item.Index.Pos()),
+				Op:       engine.OpLookup,
+				Left:     left,
+				Right:    index,
+			}
+		}
 	}
 
 	return left, nil
@@ -438,6 +497,7 @@ func (n *Condition) ToAst(file *token.File) (*engine.PolicyCondition, error) {
 	}
 
 	return &engine.PolicyCondition{
+		StartPos:  file.Position(n.ConditionPos),
 		Condition: condition,
 		Expr:      aexpr,
 	}, nil
@@ -464,16 +524,17 @@ func (n *Variable) ToAst(file *token.File) (engine.EvalNode, error) {
 	var expr engine.EvalNode
 	if opcode != engine.OpInvalid {
 		var right engine.EvalNode
-		if n.SetExpr != nil {
+		switch {
+		case n.Slot == token.PRINCIPAL_SLOT:
+			right = &engine.Reference{StartPos: file.Position(n.RelPos), Source: engine.RunVarSlotPrincipal}
+		case n.Slot == token.RESOURCE_SLOT:
+			right = &engine.Reference{StartPos: file.Position(n.RelPos), Source: engine.RunVarSlotResource}
+		case n.SetExpr != nil:
 			right, err = n.SetExpr.ToAst(file)
-			if err != nil {
-				return nil, err
-			}
-		} else {
+		case len(n.Entities) != 0:
 			right, err = n.Entities[0].ToAst(file)
-			if err != nil {
-				return nil, err
-			}
+		default:
+			return nil, fmt.Errorf("%s: missing entity in scope: %w", file.Position(n.Pos()), ErrInternal)
 		}
 		if err != nil {
 			return nil, err
@@ -495,15 +556,20 @@ func (n *Variable) ToAst(file *token.File) (engine.EvalNode, error) {
 			return nil, err
 		}
 		isExpr := &engine.BinaryExpr{
-			Op:    engine.OpIs,
-			Left:  source,
-			Right: rval,
+			StartPos: file.Position(n.IsPos),
+			Op:       engine.OpIs,
+			Left:     source,
+			Right:    rval,
 		}
 
 		expr = &engine.IfExpr{
-			If:   isExpr,
-			Then: expr,
-			Else: falseValue,
+			StartPos: file.Position(n.IsPos),
+			If:       isExpr,
+			Then:     expr,
+			Else: &engine.ValueNode{
+				StartPos: file.Position(n.IsPos),
+				Value:    engine.BoolValue(false),
+			},
 		}
 	}
 
@@ -512,12 +578,25 @@ func (n *Variable) ToAst(file *token.File) (engine.EvalNode, error) {
 
 func (n *PolicyStmt) ToAst(file *token.File) (*engine.Policy, error) {
 	var annotations map[string]string
+	var order []string
 
 	if len(n.Annotations) != 0 {
 		annotations = make(map[string]string)
 
 		for _, item := range n.Annotations {
-			annotations[item.Ident.Value] = item.Value.Value
+			// An annotation without a value is the empty string
+			var value string
+			if item.Lparen.IsValid() {
+				var err error
+				if value, err = stringValue(file, &item.Value, false); err != nil {
+					return nil, err
+				}
+			}
+			if _, found := annotations[item.Ident.Value]; found {
+				return nil, fmt.Errorf("%s: duplicate annotation @%s: %w", file.Position(item.TokPos), item.Ident.Value, ErrInternal)
+			}
+			annotations[item.Ident.Value] = value
+			order = append(order, item.Ident.Value)
 		}
 	}
 
@@ -561,21 +640,28 @@ func (n *PolicyStmt) ToAst(file *token.File) (*engine.Policy, error) {
 			continue
 		}
 		ifExpr = &engine.BinaryExpr{
-			Op:    engine.OpLand,
-			Left:  c,
-			Right: ifExpr,
+			StartPos: c.Pos(),
+			Op:       engine.OpLand,
+			Left:     c,
+			Right:    ifExpr,
 		}
 	}
 	if ifExpr == nil {
 		ifExpr = trueValue
 	}
 
+	start := file.Position(n.Pos())
 	return &engine.Policy{
-		StartPos:    file.Position(n.Pos()),
-		Effect:      effect,
-		If:          ifExpr,
-		Conditions:  conditions,
-		Annotations: annotations,
+		StartPos:        start,
+		Effect:          effect,
+		If:              ifExpr,
+		Conditions:      conditions,
+		Annotations:     annotations,
+		AnnotationOrder: order,
+		Provenance: engine.Provenance{
+			SourceFile:  start.Filename,
+			SourceRange: engine.SourceRange{Start: start, End: file.Position(n.End())},
+		},
 	}, nil
 }
 
@@ -608,3 +694,8 @@ func ToAst(file *token.File, node Node) (engine.PolicyList, error) {
 
 	return b.ToAst(file)
 }
+
+// ExprToAst converts an expression, as parsed on its own, to its AST
+func ExprToAst(file *token.File, node Expr) (engine.EvalNode, error) {
+	return toEvalNode(file, node, "expression")
+}
@@ -1,26 +1,97 @@
-package cst
+package cst_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koblas/cedar-go/cst"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/token"
 )
 
-var stringCases = []struct {
-	input  string
-	expect string
-}{
-	{`"abc"`, "abc"},
-	{`"\n"`, "\n"},
-	{`"\0"`, "\000"},
-	{`"\u{6}"`, "\u0006"},
-	{`"\u{6"`, "\\u{6"},
-	{`"\u{2}1\u{1b}\"\u{2}\u{2}\u{2}\u{2}"`, "\u00021\u001b\"\u0002\u0002\u0002\u0002"},
+func TestBasicLitToAstError(t *testing.T) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("bad.cedar", -1, 10)
+
+	lit := &cst.BasicLit{ValuePos: file.Pos(3), Kind: token.LPAREN, Value: "("}
+	assert.NotPanics(t, func() {
+		_, err := lit.ToAst(file)
+		assert.ErrorIs(t, err, cst.ErrInternal)
+		assert.ErrorContains(t, err, "bad.cedar:1:4")
+	})
 }
 
-func TestUnquote(t *testing.T) {
-	for _, item := range stringCases {
-		output := unquote(item.input)
-		assert.Equal(t, item.expect, output)
+type visitCounter map[string]int
+
+func (v visitCounter) Visit(node cst.Node) cst.Visitor {
+	switch node.(type) {
+	case *cst.Comment:
+		v["comment"] += 1
+	case *cst.Condition:
+		v["condition"] += 1
+	case *cst.Variable:
+		v["variable"] += 1
+	case *cst.MemberAccess:
+		v["member"] += 1
+	}
+	return v
+}
+
+func TestWalk(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "walk.cedar", []byte(`
+	// first
+	permit(principal, action, resource)
+	when { context["ip"].isLoopback() } // second
+	unless { context.level > 3 };
+	`), parser.ParseComments)
+	require.NoError(t, err)
+
+	counts := visitCounter{}
+	assert.NotPanics(t, func() {
+		cst.Walk(counts, file)
+	})
+	assert.Equal(t, visitCounter{"comment": 2, "condition": 2, "variable": 3, "member": 3}, counts)
+}
+
+func TestAstPositions(t *testing.T) {
+	policies, err := parser.ParseRules(`permit(
+	principal is User in Group::"admins",
+	action == Action::"view",
+	resource
+) when {
+	principal is User && context.tags.contains("a") && context.name like "x*" && -1 < 2
+} unless { if false then {a: [1]}.a == [1] else true };`)
+	require.NoError(t, err)
+
+	engine.InspectPolicies(policies, func(node engine.Node) bool {
+		if expr, ok := node.(engine.EvalNode); ok {
+			assert.NotZero(t, expr.Pos().Line, "%T %s", node, engine.ExprString(expr))
+		}
+		return true
+	})
+}
+
+func TestScopeErrorPosition(t *testing.T) {
+	policies, err := parser.ParseRules(`permit(
+	principal is User in ?principal,
+	action,
+	resource
+);`)
+	require.NoError(t, err)
+
+	request := engine.Request{
+		Principal:     engine.NewEntityValue("User", "alice"),
+		Action:        engine.NewEntityValue("Action", "view"),
+		Resource:      engine.NewEntityValue("Photo", "a"),
+		SlotPrincipal: engine.IntValue(1),
 	}
+	result, err := engine.Eval(context.TODO(), policies, &request)
+	require.NoError(t, err)
+	require.Len(t, result.Diagnostics.Errors, 1)
+	assert.ErrorContains(t, result.Diagnostics.Errors[0].Err, "2:2:")
 }
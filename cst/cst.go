@@ -242,12 +242,25 @@ type (
 
 	// A BinaryExpr node represents a binary expression.
 	BinaryExpr struct {
+		// From is the position of X, it's recorded by the parser so that Pos
+		// of a long chain such as `1 + 2 + ...` doesn't walk down the chain
+		From  token.Pos
 		X     Expr        // left operand
 		OpPos token.Pos   // position of Op
 		Op    token.Token // operator
 		Y     Expr        // right operand
 	}
 
+	// An IsExpr node represents a type test, optionally combined with an
+	// `in` test of the same operand.
+	IsExpr struct {
+		X     Expr      // operand
+		IsPos token.Pos // position of "is"
+		Type  *Path     // entity type
+		InPos token.Pos // position of "in", if any
+		In    Expr      // entity or set of entities of the `in`, if any
+	}
+
 	IfExpr struct {
 		IfPos     token.Pos // position of Op
 		Condition Expr      // conditonal expression
@@ -326,7 +339,12 @@ func (x *BasicLit) End() token.Pos { return token.Pos(int(x.ValuePos) + len(x.Va
 func (x *UnaryExpr) Pos() token.Pos { return x.OpPos }
 func (x *UnaryExpr) End() token.Pos { return x.X.End() }
 
-func (x *BinaryExpr) Pos() token.Pos { return x.X.Pos() }
+func (x *BinaryExpr) Pos() token.Pos {
+	if x.From.IsValid() {
+		return x.From
+	}
+	return x.X.Pos()
+}
 func (x *BinaryExpr) End() token.Pos { return x.Y.End() }
 
 func (x *Variable) Pos() token.Pos { return x.NameLit.Pos() }
@@ -360,6 +378,14 @@ func (x *MemberExpr) End() token.Pos {
 	return x.Access[len(x.Access)-1].RparenPos
 }
 
+func (x *IsExpr) Pos() token.Pos { return x.X.Pos() }
+func (x *IsExpr) End() token.Pos {
+	if x.In != nil {
+		return x.In.End()
+	}
+	return x.Type.End()
+}
+
 func (x *IfExpr) Pos() token.Pos { return x.IfPos }
 func (x *IfExpr) End() token.Pos { return x.Else.End() }
 
@@ -396,6 +422,7 @@ func (x *Condition) End() token.Pos { return x.Rbrace }
 func (*BasicLit) exprNode()      {}
 func (*BadExpr) exprNode()       {}
 func (*BinaryExpr) exprNode()    {}
+func (*IsExpr) exprNode()        {}
 func (*Condition) exprNode()     {}
 func (*EntityName) exprNode()    {}
 func (*FunctionCall) exprNode()  {}
@@ -439,6 +466,18 @@ type File struct {
 	Comments   []*CommentGroup // list of all comments in the source file
 }
 
+// Policies returns the policy statements of the file in order, the policies
+// converted by ToAst are in the same order
+func (f *File) Policies() []*PolicyStmt {
+	result := []*PolicyStmt{}
+	for _, item := range f.Statements {
+		if stmt, ok := item.(*PolicyStmt); ok {
+			result = append(result, stmt)
+		}
+	}
+	return result
+}
+
 func (f *File) Pos() token.Pos {
 	if f.Statements != nil && len(f.Statements) != 0 {
 		return f.Statements[0].Pos()
@@ -0,0 +1,254 @@
+package cst
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/koblas/cedar-go/token"
+)
+
+// ErrBadNode is returned when printing a tree which has syntax errors
+var ErrBadNode = errors.New("unable to print a tree with syntax errors")
+
+// printer writes the canonical form of the nodes, the literals are written
+// as they were in the source and parentheses are kept so the output parses
+// to the same tree.
+type printer struct {
+	buf      bytes.Buffer
+	comments []*CommentGroup
+	err      error
+}
+
+// Fprint writes the policies of the file in the canonical format: a clause
+// of the scope per line, a condition per line and a blank line between the
+// policies. The comments of the file are written before the policy they
+// appear in, so a comment within a policy is moved above it.
+func Fprint(w io.Writer, file *File) error {
+	p := printer{comments: file.Comments}
+
+	for i, stmt := range file.Statements {
+		if i != 0 {
+			p.buf.WriteString("\n")
+		}
+		if stmt == nil {
+			return ErrBadNode
+		}
+		p.flushComments(stmt.End())
+		p.stmt(stmt)
+		if p.err != nil {
+			return p.err
+		}
+	}
+	if len(p.comments) != 0 && len(file.Statements) != 0 {
+		p.buf.WriteString("\n")
+	}
+	p.flushComments(token.Pos(-1))
+
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+// PolicyText returns the canonical form of a policy without its comments
+func PolicyText(stmt *PolicyStmt) (string, error) {
+	p := printer{}
+	p.stmt(stmt)
+	return p.buf.String(), p.err
+}
+
+// flushComments writes the comment groups which end before pos, or all of
+// them for a negative pos
+func (p *printer) flushComments(pos token.Pos) {
+	for len(p.comments) != 0 && (pos < 0 || p.comments[0].End() <= pos) {
+		for _, item := range p.comments[0].List {
+			p.buf.WriteString(item.Text)
+			p.buf.WriteString("\n")
+		}
+		p.comments = p.comments[1:]
+	}
+}
+
+func (p *printer) print(args ...string) {
+	for _, arg := range args {
+		p.buf.WriteString(arg)
+	}
+}
+
+func (p *printer) bad(node Node) {
+	if p.err == nil {
+		p.err = fmt.Errorf("%T: %w", node, ErrBadNode)
+	}
+}
+
+func (p *printer) stmt(node Decl) {
+	stmt, ok := node.(*PolicyStmt)
+	if !ok || stmt.Scope == nil {
+		p.bad(node)
+		return
+	}
+
+	for _, item := range stmt.Annotations {
+		if item.Lparen.IsValid() {
+			p.print("@", item.Ident.Value, "(", item.Value.Value, ")\n")
+		} else {
+			p.print("@", item.Ident.Value, "\n")
+		}
+	}
+	p.print(stmt.Effect.String(), " (\n")
+	p.print("  ")
+	p.variable(&stmt.Scope.Principal)
+	p.print(",\n  ")
+	p.variable(&stmt.Scope.Action)
+	p.print(",\n  ")
+	p.variable(&stmt.Scope.Resource)
+	p.print("\n)")
+	for _, item := range stmt.Conditions {
+		p.print("\n", item.Condition.String(), " { ")
+		p.expr(item.Expr)
+		p.print(" }")
+	}
+	p.print(";\n")
+}
+
+func (p *printer) variable(node *Variable) {
+	p.print(node.NameLit.Kind.String())
+	if node.IsCheck != nil {
+		p.print(" is ")
+		p.path(node.IsCheck.Path[:len(node.IsCheck.Path)-1])
+	}
+	if node.RelOp == token.ILLEGAL {
+		return
+	}
+	p.print(" ", node.RelOp.String(), " ")
+	switch {
+	case node.Slot != token.ILLEGAL:
+		p.print(node.Slot.String())
+	case node.SetExpr != nil:
+		p.expr(node.SetExpr)
+	case len(node.Entities) != 0:
+		p.expr(node.Entities[0])
+	default:
+		p.bad(node)
+	}
+}
+
+func (p *printer) path(path []BasicLit) {
+	for i, item := range path {
+		if i != 0 {
+			p.print("::")
+		}
+		p.print(item.Value)
+	}
+}
+
+func (p *printer) exprList(exprs []Expr) {
+	for i, item := range exprs {
+		if i != 0 {
+			p.print(", ")
+		}
+		p.expr(item)
+	}
+}
+
+func (p *printer) expr(node Expr) {
+	switch n := node.(type) {
+	case *BasicLit:
+		switch n.Kind {
+		case token.STRINGLIT, token.INT, token.IDENTIFER:
+			p.print(n.Value)
+		default:
+			p.print(n.Kind.String())
+		}
+	case *EntityName:
+		p.path(n.Path)
+	case *Path:
+		p.path(n.Path)
+	case *UnaryExpr:
+		p.print(n.Op.String())
+		p.expr(n.X)
+	case *BinaryExpr:
+		p.expr(n.X)
+		p.print(" ", n.Op.String(), " ")
+		p.expr(n.Y)
+	case *IsExpr:
+		p.expr(n.X)
+		p.print(" is ")
+		p.path(n.Type.Path)
+		if n.In != nil {
+			p.print(" in ")
+			p.expr(n.In)
+		}
+	case *IfExpr:
+		p.print("if ")
+		p.expr(n.Condition)
+		p.print(" then ")
+		p.expr(n.Then)
+		p.print(" else ")
+		p.expr(n.Else)
+	case *ParenExpr:
+		p.print("(")
+		p.expr(n.X)
+		p.print(")")
+	case *SetExpr:
+		p.print("[")
+		p.exprList(n.Exprs)
+		p.print("]")
+	case *ReceiverInits:
+		if len(n.Exprs) == 0 {
+			p.print("{}")
+			return
+		}
+		p.print("{ ")
+		for i, item := range n.Exprs {
+			if i != 0 {
+				p.print(", ")
+			}
+			p.print(item.Literal.Value, ": ")
+			p.expr(item.Expr)
+		}
+		p.print(" }")
+	case *FunctionCall:
+		p.path(n.Ref.Path)
+		p.print("(")
+		p.exprList(n.Args)
+		p.print(")")
+	case *MemberExpr:
+		p.expr(n.Primary)
+		for _, item := range n.Access {
+			p.access(item)
+		}
+	default:
+		p.bad(node)
+	}
+}
+
+func (p *printer) access(node *MemberAccess) {
+	if node.Ident.Kind == token.STRINGLIT {
+		p.print("[", node.Ident.Value, "]")
+		return
+	}
+	p.print(".", node.Ident.Value)
+	switch {
+	case node.IsFunc:
+		p.print("(")
+		p.exprList(node.Args)
+		p.print(")")
+	case node.IsRef:
+		p.print("[")
+		if node.Index != nil {
+			p.print(node.Index.Value)
+		}
+		p.print("]")
+	}
+}
+
+// Sprint returns the canonical form of the file, see Fprint
+func Sprint(file *File) (string, error) {
+	var builder strings.Builder
+	if err := Fprint(&builder, file); err != nil {
+		return "", err
+	}
+	return builder.String(), nil
+}
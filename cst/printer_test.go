@@ -0,0 +1,75 @@
+package cst_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koblas/cedar-go/cst"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/token"
+)
+
+func TestFprint(t *testing.T) {
+	source := `// the owner
+@id("owner")
+permit(principal == User::"alice", action in [Action::"view",Action::"edit"],
+  resource in Album::"jane")
+when { resource.owner == principal && (context.size + 1) * 2 < 10 }
+unless { !context has mfa || context["ip"].isLoopback() || principal is Photos::User in Group::"g" };
+@ignoreErrors @id("deny")
+forbid(principal == ?principal, action, resource)
+when { if principal.tags.contains("x") then {a: [1, -2], "b c": ip("10.0.0.1")} == {} else resource.name like "*.jpg" }; // trailing
+`
+	expected := `// the owner
+@id("owner")
+permit (
+  principal == User::"alice",
+  action in [Action::"view", Action::"edit"],
+  resource in Album::"jane"
+)
+when { resource.owner == principal && (context.size + 1) * 2 < 10 }
+unless { !context has mfa || context["ip"].isLoopback() || principal is Photos::User in Group::"g" };
+
+@ignoreErrors
+@id("deny")
+forbid (
+  principal == ?principal,
+  action,
+  resource
+)
+when { if principal.tags.contains("x") then { a: [1, -2], "b c": ip("10.0.0.1") } == {} else resource.name like "*.jpg" };
+
+// trailing
+`
+
+	file, err := parser.ParseFile(token.NewFileSet(), "", source, parser.ParseComments)
+	require.NoError(t, err)
+	output, err := cst.Sprint(file)
+	require.NoError(t, err)
+	assert.Equal(t, expected, output)
+
+	// The canonical form is stable
+	file, err = parser.ParseFile(token.NewFileSet(), "", output, parser.ParseComments)
+	require.NoError(t, err)
+	again, err := cst.Sprint(file)
+	require.NoError(t, err)
+	assert.Equal(t, output, again)
+}
+
+func TestFprintHasPath(t *testing.T) {
+	source := "permit (\n  principal,\n  action,\n  resource\n)\nwhen { resource has owner.email && context has \"x y\" };\n"
+
+	file, err := parser.ParseFile(token.NewFileSet(), "", source, 0)
+	require.NoError(t, err)
+	output, err := cst.Sprint(file)
+	require.NoError(t, err)
+	assert.Equal(t, source, output)
+}
+
+func TestFprintSyntaxError(t *testing.T) {
+	file, _ := parser.ParseFile(token.NewFileSet(), "", `allow(principal, action, resource);`, 0)
+	_, err := cst.Sprint(file)
+	assert.ErrorIs(t, err, cst.ErrBadNode)
+}
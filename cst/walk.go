@@ -14,16 +14,30 @@ func Walk(visitor Visitor, node Node) {
 	switch n := node.(type) {
 	case (*Comment):
 		// nothing
+	case (*CommentGroup):
+		for _, item := range n.List {
+			Walk(visitor, item)
+		}
 	case (*BadStmt):
 		// nothing
 	// case (*AnnotationSpec): // NOT a Node
 	case (*PolicyStmt):
+		if n.Scope != nil {
+			Walk(visitor, n.Scope)
+		}
 		for _, item := range n.Conditions {
 			Walk(visitor, item)
 		}
+	case (*Condition):
+		if n.Expr != nil {
+			Walk(visitor, n.Expr)
+		}
 
 	case (*BadExpr):
 	case (*ScopeNew):
+		Walk(visitor, &n.Principal)
+		Walk(visitor, &n.Action)
+		Walk(visitor, &n.Resource)
 	case (*Variable):
 		if n.SetExpr != nil {
 			Walk(visitor, n.SetExpr)
@@ -34,6 +48,12 @@ func Walk(visitor Visitor, node Node) {
 	case (*BinaryExpr):
 		Walk(visitor, n.X)
 		Walk(visitor, n.Y)
+	case (*IsExpr):
+		Walk(visitor, n.X)
+		Walk(visitor, n.Type)
+		if n.In != nil {
+			Walk(visitor, n.In)
+		}
 	case (*IfExpr):
 		Walk(visitor, n.Condition)
 		Walk(visitor, n.Then)
@@ -48,7 +68,7 @@ func Walk(visitor Visitor, node Node) {
 		if n.Ident != nil {
 			Walk(visitor, n.Ident)
 		}
-		if n.Ident != nil {
+		if n.Index != nil {
 			Walk(visitor, n.Index)
 		}
 		if len(n.Args) != 0 {
@@ -0,0 +1,113 @@
+package cedar
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"time"
+
+	"github.com/koblas/cedar-go/engine"
+)
+
+// DecisionLog is the record of an authorization passed to the decision
+// logger, its JSON form is suitable for shipping to a log pipeline
+type DecisionLog struct {
+	Timestamp time.Time `json:"timestamp"`
+	// RequestHash identifies identical requests, it is the hash of the
+	// principal, action, resource and context
+	RequestHash string `json:"requestHash"`
+	Principal   string `json:"principal"`
+	Action      string `json:"action"`
+	Resource    string `json:"resource"`
+	Decision    string `json:"decision"`
+	// Matches are the ids of the policies which determined the decision
+	Matches []string `json:"matches"`
+	// Errors of the policies which failed to evaluate
+	Errors []DecisionLogError `json:"errors,omitempty"`
+	// Error is set when the request couldn't be evaluated, the decision is
+	// then Deny
+	Error   string        `json:"error,omitempty"`
+	Latency time.Duration `json:"latency"`
+	// Cached is set when the decision came from the decision cache
+	Cached bool `json:"cached,omitempty"`
+}
+
+type DecisionLogError struct {
+	PolicyId string `json:"policyId"`
+	Message  string `json:"message"`
+}
+
+// decisionLogger holds the callback and the sampling of the decisions
+type decisionLogger struct {
+	fn   func(DecisionLog)
+	rate float64
+}
+
+// WithDecisionLogger calls fn with the DecisionLog of each authorization,
+// for example to ship every decision to a SIEM. The callback runs on the
+// goroutine of the request, so it should hand the record off rather than
+// block. See WithDecisionSampling to log a fraction of the decisions.
+func WithDecisionLogger(fn func(DecisionLog)) Option {
+	return func(sa *SchemaAuthorizer) {
+		rate := 1.0
+		if sa.logger != nil {
+			rate = sa.logger.rate
+		}
+		sa.logger = &decisionLogger{fn: fn, rate: rate}
+	}
+}
+
+// WithDecisionSampling logs a random fraction, between 0 and 1, of the
+// decisions of WithDecisionLogger. Requests which couldn't be evaluated or
+// had policy errors are always logged.
+func WithDecisionSampling(rate float64) Option {
+	return func(sa *SchemaAuthorizer) {
+		if sa.logger == nil {
+			sa.logger = &decisionLogger{}
+		}
+		sa.logger.rate = rate
+	}
+}
+
+// logDecision reports the outcome of the request to the decision logger
+func (auth *SchemaAuthorizer) logDecision(request *Request, start time.Time, detail *AuthDetail, cached bool, err error) {
+	logger := auth.logger
+	if logger.fn == nil {
+		return
+	}
+	failed := err != nil || len(detail.Diagnostics.Errors) != 0
+	if !failed && logger.rate < 1 && rand.Float64() >= logger.rate {
+		return
+	}
+
+	entry := DecisionLog{
+		Timestamp: start,
+		Principal: request.Principal.String(),
+		Action:    request.Action.String(),
+		Resource:  request.Resource.String(),
+		Decision:  engine.Deny.String(),
+		Matches:   []string{},
+		Latency:   time.Since(start),
+		Cached:    cached,
+	}
+	if key, ok := cacheKey(request); ok {
+		sum := sha256.Sum256([]byte(key))
+		entry.RequestHash = hex.EncodeToString(sum[:])
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		logger.fn(entry)
+		return
+	}
+
+	if detail.IsAllowed {
+		entry.Decision = engine.Allow.String()
+	}
+	if detail.Matches != nil {
+		entry.Matches = detail.Matches
+	}
+	for _, item := range detail.Diagnostics.Errors {
+		entry.Errors = append(entry.Errors, DecisionLogError{PolicyId: item.PolicyId, Message: item.Err.Error()})
+	}
+	logger.fn(entry)
+}
@@ -0,0 +1,87 @@
+package cedar_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecisionLogger(t *testing.T) {
+	policies, err := cedar.ParsePolicies(`
+	@id("view")
+	permit(principal, action == Action::"view", resource);
+	@id("broken")
+	permit(principal, action == Action::"edit", resource) when { context.missing };
+	`)
+	require.NoError(t, err)
+
+	logs := []cedar.DecisionLog{}
+	auth := cedar.NewAuthorizer(policies,
+		cedar.WithDecisionCache(10, time.Minute),
+		cedar.WithDecisionLogger(func(entry cedar.DecisionLog) {
+			logs = append(logs, entry)
+		}),
+	)
+
+	request := func(action string) *cedar.Request {
+		context, err := cedar.NewContextFromMap(nil)
+		require.NoError(t, err)
+		return &cedar.Request{
+			Principal: engine.NewEntityValue("User", "alice"),
+			Action:    engine.NewEntityValue("Action", action),
+			Resource:  engine.NewEntityValue("Photo", "a"),
+			Context:   context,
+		}
+	}
+
+	for _, action := range []string{"view", "view", "edit"} {
+		_, err := auth.IsAuthorizedDetail(context.TODO(), request(action))
+		require.NoError(t, err)
+	}
+
+	require.Len(t, logs, 3)
+	assert.Equal(t, "Allow", logs[0].Decision)
+	assert.Equal(t, []string{"view"}, logs[0].Matches)
+	assert.Equal(t, `User::"alice"`, logs[0].Principal)
+	assert.NotEmpty(t, logs[0].RequestHash)
+	assert.False(t, logs[0].Cached)
+
+	// The same request has the same hash
+	assert.True(t, logs[1].Cached)
+	assert.Equal(t, logs[0].RequestHash, logs[1].RequestHash)
+
+	assert.Equal(t, "Deny", logs[2].Decision)
+	assert.NotEqual(t, logs[0].RequestHash, logs[2].RequestHash)
+	require.Len(t, logs[2].Errors, 1)
+	assert.Equal(t, "broken", logs[2].Errors[0].PolicyId)
+}
+
+func TestDecisionSampling(t *testing.T) {
+	policies, err := cedar.ParsePolicies(`permit(principal, action, resource);`)
+	require.NoError(t, err)
+
+	count := 0
+	auth := cedar.NewAuthorizer(policies,
+		cedar.WithDecisionSampling(0),
+		cedar.WithDecisionLogger(func(entry cedar.DecisionLog) {
+			count++
+		}),
+		cedar.WithRequireNonEmptyPolicies(),
+	)
+	for i := 0; i < 10; i++ {
+		_, err := auth.IsAuthorized(context.TODO(), &cedar.Request{})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 0, count)
+
+	// Requests which couldn't be evaluated are always logged
+	auth.SetPolicies(engine.PolicyList{})
+	_, err = auth.IsAuthorized(context.TODO(), &cedar.Request{})
+	assert.ErrorIs(t, err, cedar.ErrNoPolicies)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,221 @@
+// Package docs renders policies as Markdown documentation, with the scope
+// and conditions of each policy in prose, for review by readers who don't
+// write Cedar. The `@description` annotation of a policy is its summary.
+package docs
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/koblas/cedar-go/engine"
+)
+
+// Markdown writes a section for each policy with its id, description, the
+// rule in prose, the conditions and the other annotations
+func Markdown(w io.Writer, policies engine.PolicyList) error {
+	var buf strings.Builder
+
+	buf.WriteString("# Policies\n")
+	for _, policy := range policies {
+		buf.WriteString("\n## " + policy.Id + "\n\n")
+		if description, found := policy.Annotation("description"); found && description != "" {
+			buf.WriteString(description + "\n\n")
+		}
+		buf.WriteString(Scope(policy) + "\n")
+
+		if len(policy.Conditions) != 0 {
+			buf.WriteString("\nConditions:\n\n")
+			for _, item := range policy.Conditions {
+				buf.WriteString("- " + item.Condition.String() + " " + Expr(item.Expr) + "\n")
+			}
+		}
+
+		annotations := []string{}
+		for _, key := range annotationKeys(policy) {
+			if key == "id" || key == "description" {
+				continue
+			}
+			if value := policy.Annotations[key]; value != "" {
+				annotations = append(annotations, fmt.Sprintf("- `@%s`: %s\n", key, value))
+			} else {
+				annotations = append(annotations, fmt.Sprintf("- `@%s`\n", key))
+			}
+		}
+		if len(annotations) != 0 {
+			buf.WriteString("\nAnnotations:\n\n" + strings.Join(annotations, ""))
+		}
+
+		if pos := policy.StartPos; pos.IsValid() {
+			buf.WriteString(fmt.Sprintf("\nDefined at `%s`.\n", pos))
+		}
+	}
+
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// annotationKeys returns the annotation keys in source order, or sorted when
+// the order isn't known
+func annotationKeys(policy *engine.Policy) []string {
+	if len(policy.AnnotationOrder) == len(policy.Annotations) {
+		return policy.AnnotationOrder
+	}
+	keys := make([]string, 0, len(policy.Annotations))
+	for key := range policy.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Scope describes the scope of the policy as a sentence, e.g.
+//
+//	Allows any `User` in `Group::"admin"` to perform the `view` action on any resource.
+func Scope(policy *engine.Policy) string {
+	scope := policy.Scope()
+
+	verb := "Allows"
+	if policy.Effect == engine.EffectForbid {
+		verb = "Forbids"
+	}
+
+	return fmt.Sprintf("%s %s to %s on %s.", verb,
+		entityPhrase("principal", scope.Principal),
+		actionPhrase(scope.Action),
+		entityPhrase("resource", scope.Resource),
+	)
+}
+
+// entityPhrase describes the constraint of the principal or resource
+func entityPhrase(name string, c engine.ScopeConstraint) string {
+	kind := name
+	if c.IsType != "" {
+		kind = code(c.IsType)
+	}
+
+	switch {
+	case c.Slot && c.Op == engine.OpEql:
+		return "the " + name + " of each template link"
+	case c.Slot:
+		return "any " + kind + " in the " + name + " of each template link"
+	case c.Op == engine.OpEql:
+		return entityList(c.Entities, "or")
+	case c.Op == engine.OpIn:
+		return "any " + kind + " in " + entityList(c.Entities, "or")
+	}
+	return "any " + kind
+}
+
+// actionPhrase describes the action constraint, actions are named by their id
+func actionPhrase(c engine.ScopeConstraint) string {
+	ids := []string{}
+	for _, item := range c.Entities {
+		ids = append(ids, code(item.EntityId()))
+	}
+
+	switch c.Op {
+	case engine.OpEql:
+		return "perform the " + joinWords(ids, "or") + " action"
+	case engine.OpIn:
+		return "perform any action in " + joinWords(ids, "or")
+	}
+	return "perform any action"
+}
+
+func entityList(entities []engine.EntityValue, conj string) string {
+	items := []string{}
+	for _, item := range entities {
+		items = append(items, code(item.String()))
+	}
+	return joinWords(items, conj)
+}
+
+// joinWords joins the items as in "a, b or c"
+func joinWords(items []string, conj string) string {
+	switch len(items) {
+	case 0:
+		return ""
+	case 1:
+		return items[0]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " " + conj + " " + items[len(items)-1]
+}
+
+// code formats the text as inline code
+func code(text string) string {
+	return "`" + text + "`"
+}
+
+// comparisons are the prose of the binary operators
+var comparisons = map[engine.Operand]string{
+	engine.OpEql:  "is",
+	engine.OpNeq:  "is not",
+	engine.OpLss:  "is less than",
+	engine.OpLeq:  "is at most",
+	engine.OpGtr:  "is greater than",
+	engine.OpGeq:  "is at least",
+	engine.OpIn:   "is in",
+	engine.OpLike: "matches",
+}
+
+// methods are the prose of the set methods
+var methods = map[string]string{
+	"contains":    "contains",
+	"containsAll": "contains all of",
+	"containsAny": "contains any of",
+}
+
+// Expr describes an expression in prose, e.g. `principal.level > 2 &&
+// context.mfa` is
+//
+//	`principal.level` is greater than `2` and `context.mfa` is true
+//
+// The operands are shown as code, expressions without a prose form are shown
+// as code entirely.
+func Expr(node engine.EvalNode) string {
+	switch n := node.(type) {
+	case *engine.BinaryExpr:
+		switch n.Op {
+		case engine.OpLand:
+			return group(n.Left, engine.OpLand) + " and " + group(n.Right, engine.OpLand)
+		case engine.OpLor:
+			return group(n.Left, engine.OpLor) + " or " + group(n.Right, engine.OpLor)
+		case engine.OpHas:
+			return code(engine.ExprString(n.Left)) + " has the attribute " + code(engine.ExprString(n.Right))
+		case engine.OpIs:
+			if val, ok := n.Right.(*engine.ValueNode); ok {
+				if ent, ok := val.Value.(engine.EntityValue); ok {
+					return code(engine.ExprString(n.Left)) + " is a " + code(ent.EntityType())
+				}
+			}
+		case engine.OpLookup:
+			return code(engine.ExprString(n)) + " is true"
+		}
+		if text, found := comparisons[n.Op]; found {
+			return code(engine.ExprString(n.Left)) + " " + text + " " + code(engine.ExprString(n.Right))
+		}
+	case *engine.UnaryExpr:
+		if n.Op == engine.OpNot {
+			return "not (" + Expr(n.Left) + ")"
+		}
+	case *engine.FunctionCall:
+		if text, found := methods[n.Name]; found && n.Self != nil && len(n.Args) == 1 {
+			return code(engine.ExprString(n.Self)) + " " + text + " " + code(engine.ExprString(n.Args[0]))
+		}
+	case *engine.IfExpr:
+		return "if " + Expr(n.If) + " then " + Expr(n.Then) + ", otherwise " + Expr(n.Else)
+	}
+
+	return code(engine.ExprString(node))
+}
+
+// group describes an operand of `and` or `or`, in parentheses when it is the
+// other of the two
+func group(node engine.EvalNode, op engine.Operand) string {
+	if n, ok := node.(*engine.BinaryExpr); ok && (n.Op == engine.OpLand || n.Op == engine.OpLor) && n.Op != op {
+		return "(" + Expr(node) + ")"
+	}
+	return Expr(node)
+}
@@ -0,0 +1,63 @@
+package docs_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koblas/cedar-go/docs"
+	"github.com/koblas/cedar-go/parser"
+)
+
+func TestScope(t *testing.T) {
+	tests := map[string]string{
+		`permit(principal, action, resource);`: "Allows any principal to perform any action on any resource.",
+		`forbid(principal == User::"bob", action == Action::"delete", resource is Photo in Album::"a");`:     "Forbids `User::\"bob\"` to perform the `delete` action on any `Photo` in `Album::\"a\"`.",
+		`permit(principal is User in Group::"admin", action in [Action::"view", Action::"edit"], resource);`: "Allows any `User` in `Group::\"admin\"` to perform any action in `view` or `edit` on any resource.",
+		`permit(principal == ?principal, action, resource in ?resource);`:                                    "Allows the principal of each template link to perform any action on any resource in the resource of each template link.",
+	}
+	for src, expected := range tests {
+		policies, err := parser.ParseRules(src)
+		require.NoError(t, err)
+		assert.Equal(t, expected, docs.Scope(policies[0]), src)
+	}
+}
+
+func TestExpr(t *testing.T) {
+	tests := map[string]string{
+		`principal.level > 2 && context.mfa`:                       "`principal.level` is greater than `2` and `context.mfa` is true",
+		`(context.a == 1 || context.b != 2) && !(principal has d)`: "(`context.a` is `1` or `context.b` is not `2`) and not (`principal` has the attribute `d`)",
+		`resource.tags.containsAny(["a", "b"])`:                    "`resource.tags` contains any of `[\"a\", \"b\"]`",
+		`principal is User && resource.name like "*x"`:             "`principal` is a `User` and `resource.name` matches `\"*x\"`",
+		`ip(context.addr).isLoopback()`:                            "`ip(context.addr).isLoopback()`",
+	}
+	for src, expected := range tests {
+		node, err := parser.ParseExpr(src)
+		require.NoError(t, err)
+		assert.Equal(t, expected, docs.Expr(node), src)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	policies, err := parser.ParseRules(`@id("admins")
+@description("Administrators can do anything")
+@owner("security")
+permit(principal in Group::"admin", action, resource)
+unless { context.readOnly };
+`)
+	require.NoError(t, err)
+
+	var buf strings.Builder
+	require.NoError(t, docs.Markdown(&buf, policies))
+	assert.Equal(t, "# Policies\n"+
+		"\n## admins\n\n"+
+		"Administrators can do anything\n\n"+
+		"Allows any principal in `Group::\"admin\"` to perform any action on any resource.\n"+
+		"\nConditions:\n\n"+
+		"- unless `context.readOnly` is true\n"+
+		"\nAnnotations:\n\n"+
+		"- `@owner`: security\n"+
+		"\nDefined at `1:1`.\n", buf.String())
+}
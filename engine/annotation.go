@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// Annotation returns the value of the named annotation on the policy
+func (n *Policy) Annotation(key string) (string, bool) {
+	value, found := n.Annotations[key]
+	return value, found
+}
+
+// JsonAnnotations are the annotations of a policy, they are marshalled in the
+// order of Keys
+type JsonAnnotations struct {
+	Keys   []string
+	Values map[string]string
+}
+
+var _ json.Marshaler = (*JsonAnnotations)(nil)
+
+func (a *JsonAnnotations) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range a.Keys {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(a.Values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonAnnotations returns the annotations of the policy in source order, nil
+// if it has none
+func (n *Policy) jsonAnnotations() *JsonAnnotations {
+	if len(n.Annotations) == 0 {
+		return nil
+	}
+
+	keys := n.AnnotationOrder
+	if len(keys) != len(n.Annotations) {
+		// Built without an order, fall back to sorting
+		keys = make([]string, 0, len(n.Annotations))
+		for key := range n.Annotations {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	}
+	return &JsonAnnotations{Keys: keys, Values: n.Annotations}
+}
+
+// FindByAnnotation returns the policies which have the annotation set to value
+func (p PolicyList) FindByAnnotation(key, value string) PolicyList {
+	output := PolicyList{}
+	for _, policy := range p {
+		if found, ok := policy.Annotation(key); ok && found == value {
+			output = append(output, policy)
+		}
+	}
+	return output
+}
+
+// FindById returns the policy with the given id, or nil
+func (p PolicyList) FindById(id string) *Policy {
+	for _, policy := range p {
+		if policy.Id == id {
+			return policy
+		}
+	}
+	return nil
+}
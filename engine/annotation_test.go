@@ -0,0 +1,77 @@
+package engine_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/koblas/cedar-go"
+	ast "github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindByAnnotation(t *testing.T) {
+	policies, err := parser.ParseRules(`
+	@id("view") @team("photos")
+	permit(principal, action == Action::"view", resource);
+
+	@id("edit") @team("photos")
+	permit(principal, action == Action::"edit", resource);
+
+	@id("mfa") @advice("must-use-mfa")
+	forbid(principal, action, resource) unless { context.mfa };
+	`)
+	require.NoError(t, err)
+
+	found := policies.FindByAnnotation("team", "photos")
+	require.Len(t, found, 2)
+	assert.Equal(t, "view", found[0].Id)
+	assert.Equal(t, "edit", found[1].Id)
+	assert.Empty(t, policies.FindByAnnotation("team", "albums"))
+
+	value, ok := policies.FindById("mfa").Annotation("advice")
+	assert.True(t, ok)
+	assert.Equal(t, "must-use-mfa", value)
+	assert.Nil(t, policies.FindById("missing"))
+
+	detail, err := cedar.NewAuthorizer(policies).IsAuthorizedDetail(context.TODO(), &cedar.Request{
+		Principal: cedar.NewEntity("User", "alice"),
+		Action:    cedar.NewEntity("Action", "view"),
+		Resource:  cedar.NewEntity("Photo", "a.jpg"),
+		Context:   ast.NewVarValue(map[string]ast.NamedType{"mfa": ast.BoolValue(false)}),
+	})
+	require.NoError(t, err)
+	assert.False(t, detail.IsAllowed)
+	assert.Equal(t, []string{"mfa"}, detail.Diagnostics.Forbids)
+	assert.Equal(t, "must-use-mfa", detail.Annotations["mfa"]["advice"])
+	assert.Equal(t, "photos", detail.Annotations["view"]["team"])
+}
+
+func TestAnnotationOrder(t *testing.T) {
+	policies, err := parser.ParseRules(`
+	@id("deny") @ignoreErrors @advice("use mfa") @a("")
+	forbid(principal, action, resource);
+	`)
+	require.NoError(t, err)
+
+	value, ok := policies[0].Annotation("ignoreErrors")
+	assert.True(t, ok)
+	assert.Equal(t, "", value)
+	assert.Equal(t, []string{"id", "ignoreErrors", "advice", "a"}, policies[0].AnnotationOrder)
+
+	data, err := ast.ToJson(policies)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"annotations":{"id":"deny","ignoreErrors":"","advice":"use mfa","a":""}`)
+
+	// Policies built without an order are sorted
+	data, err = ast.ToJson(ast.PolicyList{{
+		Effect:      ast.EffectPermit,
+		Annotations: map[string]string{"b": "2", "a": "1"},
+	}})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"annotations":{"a":"1","b":"2"}`)
+
+	_, err = parser.ParseRules(`@id("a") @id("b") permit(principal, action, resource);`)
+	assert.ErrorContains(t, err, "duplicate annotation @id")
+}
@@ -142,7 +142,8 @@ type (
 // Nodes
 type (
 	ValueNode struct {
-		Value EvalValue
+		StartPos token.Position
+		Value    EvalValue
 	}
 
 	// This can either be a SET or an argument LIST
@@ -164,6 +165,8 @@ type (
 		Op       Operand
 		Left     EvalNode
 		Right    EvalNode
+		// Pattern is the compiled Right of a `like` with a literal pattern
+		Pattern *Pattern
 	}
 
 	Reference struct {
@@ -175,6 +178,9 @@ type (
 	Identifier struct {
 		StartPos token.Position
 		Value    string
+
+		// value is the boxed Value when built by NewIdentifier
+		value EvalValue
 	}
 
 	FunctionCall struct {
@@ -214,11 +220,22 @@ type (
 		If          EvalNode
 		Conditions  []*PolicyCondition
 		Annotations map[string]string
+		// AnnotationOrder is the keys of Annotations in source order, an
+		// annotation without a value has the empty string
+		AnnotationOrder []string
+
+		Provenance
 	}
 
 	PolicyList []*Policy
 )
 
+// NewIdentifier creates the node of an attribute name, e.g. `name` of
+// `principal.name`, whose value is boxed once rather than on every evaluation
+func NewIdentifier(pos token.Position, value string) *Identifier {
+	return &Identifier{StartPos: pos, Value: value, value: IdentifierValue(value)}
+}
+
 // Things that can be evaluated
 func (*BinaryExpr) exprNode()      {}
 func (*FunctionCall) exprNode()    {}
@@ -241,3 +258,6 @@ func (n *PolicyCondition) Pos() token.Position { return n.StartPos }
 func (n *Reference) Pos() token.Position       { return n.StartPos }
 func (n *UnaryExpr) Pos() token.Position       { return n.StartPos }
 func (n *VariableDef) Pos() token.Position     { return n.StartPos }
+
+// Values built rather than parsed, such as linked slots, have no position
+func (n *ValueNode) Pos() token.Position { return n.StartPos }
@@ -0,0 +1,99 @@
+package engine
+
+import "errors"
+
+// chainedStore layers stores over one another, see NewChainedStore
+type chainedStore struct {
+	stores []Store
+}
+
+var _ Store = (*chainedStore)(nil)
+var _ TagStore = (*chainedStore)(nil)
+var _ StoreNotifier = (*chainedStore)(nil)
+
+// NewChainedStore combines the stores into one. Attributes and tags come from
+// the first store which has a value for them, while the parents from every
+// store are merged so a hierarchy may span the stores. A request scoped store,
+// such as the principal built from a token, can then overlay a shared store.
+func NewChainedStore(stores ...Store) Store {
+	return &chainedStore{stores: stores}
+}
+
+func (c *chainedStore) Get(entity EntityValue, attr string) (EvalValue, error) {
+	for _, store := range c.stores {
+		value, err := store.Get(entity, attr)
+		if errors.Is(err, ErrValueNotFound) || (err == nil && value == nil) {
+			continue
+		}
+		return value, err
+	}
+	return nil, ErrValueNotFound
+}
+
+// GetTag returns the tag from the first store which has it
+func (c *chainedStore) GetTag(entity EntityValue, tag string) (EvalValue, error) {
+	for _, store := range c.stores {
+		tags, ok := store.(TagStore)
+		if !ok {
+			continue
+		}
+		value, err := tags.GetTag(entity, tag)
+		if errors.Is(err, ErrValueNotFound) || (err == nil && value == nil) {
+			continue
+		}
+		return value, err
+	}
+	return nil, ErrValueNotFound
+}
+
+// GetParents repeats the lookup for each new ancestor found, the parents of
+// an entity in one store may have their own parents in another. A store
+// returns every ancestor it knows, so an entity is only looked up again in
+// the stores which haven't already returned it.
+func (c *chainedStore) GetParents(entity EntityValue) ([]EntityValue, error) {
+	seen := map[string]bool{entity.String(): true}
+	output := []EntityValue{entity}
+	// covered[i] holds the entities whose ancestors in store i are known
+	covered := make([]map[string]bool, len(c.stores))
+	for i := range covered {
+		covered[i] = map[string]bool{}
+	}
+
+	for idx := 0; idx < len(output); idx++ {
+		item := output[idx]
+
+		for i, store := range c.stores {
+			if covered[i][item.String()] {
+				continue
+			}
+			parents, err := store.GetParents(item)
+			if err != nil {
+				return nil, err
+			}
+			for _, parent := range parents {
+				covered[i][parent.String()] = true
+				if !seen[parent.String()] {
+					seen[parent.String()] = true
+					output = append(output, parent)
+				}
+			}
+		}
+	}
+
+	return output[1:], nil
+}
+
+// Subscribe forwards the updates of each of the stores which report them
+func (c *chainedStore) Subscribe(fn func(changed []EntityValue)) func() {
+	cancels := []func(){}
+	for _, store := range c.stores {
+		if notifier, ok := store.(StoreNotifier); ok {
+			cancels = append(cancels, notifier.Subscribe(fn))
+		}
+	}
+	return func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}
+}
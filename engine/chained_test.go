@@ -0,0 +1,99 @@
+package engine_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainedStore(t *testing.T) {
+	sdef := schema.NewEmptySchema()
+	shared, err := sdef.DecodeEntities(strings.NewReader(`[
+		{ "uid": { "type": "User", "id": "alice" }, "attrs": { "name": "Alice", "level": 1 } },
+		{ "uid": { "type": "Group", "id": "staff" }, "parents": [{ "type": "Group", "id": "everyone" }] },
+		{ "uid": { "type": "Photo", "id": "vacation.jpg" }, "attrs": { "owner": { "__entity": { "type": "User", "id": "alice" } } } }
+	]`))
+	require.NoError(t, err)
+	// the principal as described by a token
+	overlay, err := sdef.DecodeEntities(strings.NewReader(`[
+		{ "uid": { "type": "User", "id": "alice" }, "attrs": { "level": 3 }, "parents": [{ "type": "Group", "id": "staff" }] }
+	]`))
+	require.NoError(t, err)
+
+	store := engine.NewChainedStore(overlay, shared)
+	alice := engine.NewEntityValue("User", "alice")
+
+	value, err := store.Get(alice, "level")
+	require.NoError(t, err)
+	assert.Equal(t, engine.IntValue(3), value)
+	value, err = store.Get(alice, "name")
+	require.NoError(t, err)
+	assert.Equal(t, engine.StrValue("Alice"), value)
+	_, err = store.Get(alice, "email")
+	assert.ErrorIs(t, err, engine.ErrValueNotFound)
+
+	// the hierarchy continues from the overlay into the shared store
+	parents, err := store.GetParents(alice)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []engine.EntityValue{
+		engine.NewEntityValue("Group", "staff"),
+		engine.NewEntityValue("Group", "everyone"),
+	}, parents)
+
+	policies, err := cedar.ParsePolicies(`
+	permit(principal in Group::"everyone", action, resource)
+		when { resource.owner == principal && principal.level > 2 };
+	`)
+	require.NoError(t, err)
+	ok, err := cedar.NewAuthorizer(policies, cedar.WithStore(store)).IsAuthorized(context.TODO(), &cedar.Request{
+		Principal: alice,
+		Action:    cedar.NewEntity("Action", "view"),
+		Resource:  cedar.NewEntity("Photo", "vacation.jpg"),
+	})
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// updates of the layers are forwarded
+	mutable := schema.NewMutableEntityStore(nil)
+	changed := 0
+	cancel := engine.NewChainedStore(mutable, schema.NewEmptyStore()).(engine.StoreNotifier).Subscribe(func([]engine.EntityValue) {
+		changed += 1
+	})
+	require.NoError(t, mutable.AddEntity(schema.NewEntityStoreItem(alice, nil, nil)))
+	cancel()
+	require.NoError(t, mutable.AddEntity(schema.NewEntityStoreItem(alice, nil, nil)))
+	assert.Equal(t, 1, changed)
+}
+
+func TestChainedStoreDeepHierarchy(t *testing.T) {
+	const depth = 50
+	alice := engine.NewEntityValue("User", "alice")
+	groups := make([]engine.EntityValue, depth)
+	for i := range groups {
+		groups[i] = engine.NewEntityValue("Group", fmt.Sprintf("g%d", i))
+	}
+
+	entities := schema.EntityStore{}
+	for i := 0; i < depth-1; i++ {
+		require.NoError(t, entities.Add(schema.NewEntityStoreItem(groups[i], groups[i+1:i+2], nil)))
+	}
+	overlay := &countingStore{Store: schema.EntityStore{}}
+	require.NoError(t, overlay.Store.(schema.EntityStore).Add(schema.NewEntityStoreItem(alice, groups[:1], nil)))
+	shared := &countingStore{Store: entities}
+
+	parents, err := engine.NewChainedStore(overlay, shared).GetParents(alice)
+	require.NoError(t, err)
+	assert.Equal(t, groups, parents)
+
+	// the shared store returns the whole chain for the first group, the
+	// groups it returned aren't looked up in it again
+	assert.Equal(t, 2, shared.parents)
+	assert.Equal(t, depth, overlay.parents)
+}
@@ -0,0 +1,101 @@
+package engine_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/koblas/cedar-go"
+	ast "github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompile(t *testing.T) {
+	store, err := schema.NewEmptySchema().NormalizeEntites(schema.JsonEntities{
+		{
+			Uid:     schema.JsonEntityValue{"type": "User", "id": "alice"},
+			Parents: []schema.JsonEntityValue{{"type": "Group", "id": "staff"}},
+			Attrs:   map[string]any{"level": 5, "name": "alice", "tags": []any{"a", "b"}},
+		},
+	})
+	require.NoError(t, err)
+
+	// The compiled policies make the same decisions with the same errors
+	conditions := []string{
+		`principal.level > 3 && principal in Group::"staff"`,
+		`principal.level > 3 || principal.missing`,
+		`!(principal has nickname) && principal.name like "al*"`,
+		`if context.flag then principal.tags.contains("a") else false`,
+		`{ a: 1, b: [principal.level, -2] }.b.containsAll([5])`,
+		`resource.owner == principal`,
+		`principal.level + "x" == 1`,
+		`ip("10.0.0.1").isInRange(ip("10.0.0.0/8")) && principal is User`,
+		`context.flag && principal.missing`,
+		`context.flag`,
+	}
+	for idx, cond := range conditions {
+		for _, flag := range []bool{true, false} {
+			src := fmt.Sprintf(`permit(principal, action, resource) when { %s };
+			forbid(principal, action, resource) unless { principal.level < 10 };`, cond)
+			policies, err := parser.ParseRules(src)
+			require.NoError(t, err)
+			compiled, err := ast.Compile(policies)
+			require.NoError(t, err)
+
+			request := ast.Request{
+				Principal: ast.NewEntityValue("User", "alice"),
+				Action:    ast.NewEntityValue("Action", "view"),
+				Resource:  ast.NewEntityValue("Photo", "a.jpg"),
+				Context:   ast.NewVarValue(map[string]ast.NamedType{"flag": ast.BoolValue(flag)}),
+				Store:     store,
+			}
+			walked, err := ast.Eval(context.TODO(), policies, &request)
+			require.NoError(t, err)
+
+			request.Compiled = compiled
+			result, err := ast.Eval(context.TODO(), compiled.Policies(), &request)
+			require.NoError(t, err)
+
+			name := fmt.Sprintf("%d/%t", idx, flag)
+			assert.Equal(t, walked.Decision, result.Decision, name)
+			assert.Equal(t, walked.Reasons, result.Reasons, name)
+			assert.Equal(t, walked.Diagnostics.Skipped, result.Diagnostics.Skipped, name)
+			require.Equal(t, len(walked.Diagnostics.Errors), len(result.Diagnostics.Errors), name)
+			for pos, item := range walked.Diagnostics.Errors {
+				assert.Equal(t, item.Err.Error(), result.Diagnostics.Errors[pos].Err.Error(), name)
+			}
+		}
+	}
+}
+
+func TestCompiledAuthorizer(t *testing.T) {
+	policies, err := parser.ParseRules(`permit(principal == User::"alice", action, resource) when { context.mfa };`)
+	require.NoError(t, err)
+	compiled, err := ast.Compile(policies)
+	require.NoError(t, err)
+
+	request := &cedar.Request{
+		Principal: ast.NewEntityValue("User", "alice"),
+		Context:   ast.NewVarValue(map[string]ast.NamedType{"mfa": ast.BoolValue(true)}),
+	}
+	for _, auth := range []*cedar.SchemaAuthorizer{
+		cedar.NewAuthorizer(nil, cedar.WithCompiledPolicies(compiled)),
+		cedar.NewAuthorizer(policies, cedar.WithCompilation()),
+	} {
+		ok, err := auth.IsAuthorized(context.TODO(), request)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		// Replaced policies are compiled again
+		auth.SetPolicies(nil)
+		ok, err = auth.IsAuthorized(context.TODO(), request)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	}
+
+	_, err = ast.Compile(ast.PolicyList{nil})
+	assert.ErrorIs(t, err, ast.ErrCompile)
+}
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/koblas/cedar-go/token"
+)
+
+// Coverage records the policies, conditions and branches exercised by the
+// requests evaluated with it (see Request.Coverage), it is safe for
+// concurrent use. Report lists what was never exercised.
+type Coverage struct {
+	mu sync.Mutex
+	// counts of the two outcomes of each node:
+	//   Policy: the scope matched, the policy was satisfied
+	//   PolicyCondition: the expression was false, true
+	//   IfExpr: the else, then branch was taken
+	//   BinaryExpr (&& and ||): short circuited, the right side was evaluated
+	hits map[Node]*[2]int
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{hits: map[Node]*[2]int{}}
+}
+
+func (c *Coverage) record(node Node, outcome int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts, found := c.hits[node]
+	if !found {
+		counts = &[2]int{}
+		c.hits[node] = counts
+	}
+	counts[outcome] += 1
+}
+
+func (c *Coverage) recordBool(node Node, value bool) {
+	if value {
+		c.record(node, 1)
+	} else {
+		c.record(node, 0)
+	}
+}
+
+func (c *Coverage) counts(node Node) [2]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if counts, found := c.hits[node]; found {
+		return *counts
+	}
+	return [2]int{}
+}
+
+// CoverageItem is an outcome which was never exercised
+type CoverageItem struct {
+	PolicyId string
+	Position token.Position
+	// Description of the outcome, e.g. `when { context.mfa } never true`
+	Description string
+}
+
+func (i CoverageItem) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Position, i.PolicyId, i.Description)
+}
+
+// CoverageReport summarizes the coverage of a policy list
+type CoverageReport struct {
+	// Number of outcomes of the policies, conditions and branches
+	Outcomes int
+	// Number of those outcomes which were exercised
+	Covered int
+	// Policies which were never satisfied
+	UncoveredPolicies []string
+	// Outcomes which were never exercised
+	Uncovered []CoverageItem
+}
+
+// Percent is the percentage of the outcomes covered
+func (r *CoverageReport) Percent() float64 {
+	if r.Outcomes == 0 {
+		return 100
+	}
+	return 100 * float64(r.Covered) / float64(r.Outcomes)
+}
+
+// Write prints the summary followed by the uncovered outcomes
+func (r *CoverageReport) Write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "coverage: %.1f%% of %d outcomes\n", r.Percent(), r.Outcomes); err != nil {
+		return err
+	}
+	for _, item := range r.Uncovered {
+		if _, err := fmt.Fprintf(w, "\t%s\n", item.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// coverageVisitor enumerates the branches within the conditions
+type coverageVisitor struct {
+	coverage *Coverage
+	policy   *Policy
+	report   *CoverageReport
+}
+
+func (v *coverageVisitor) outcomes(node Node, descriptions ...string) {
+	counts := v.coverage.counts(node)
+	for i, text := range descriptions {
+		v.report.Outcomes += 1
+		if counts[i] != 0 {
+			v.report.Covered += 1
+			continue
+		}
+		v.report.Uncovered = append(v.report.Uncovered, CoverageItem{
+			PolicyId:    v.policy.Id,
+			Position:    node.Pos(),
+			Description: text,
+		})
+	}
+}
+
+func (v *coverageVisitor) Visit(node Node) Visitor {
+	switch n := node.(type) {
+	case *PolicyCondition:
+		text := ExprString(n)
+		v.outcomes(n, text+" never false", text+" never true")
+	case *IfExpr:
+		text := "if " + ExprString(n.If)
+		v.outcomes(n, text+" never took else", text+" never took then")
+	case *BinaryExpr:
+		if n.Op == OpLand || n.Op == OpLor {
+			text := ExprString(n)
+			v.outcomes(n, text+" never short circuited", text+" never evaluated the right side")
+		}
+	}
+	return v
+}
+
+// Report lists the outcomes of the policies which weren't exercised, the
+// branches are only reported within the conditions as the scope is covered
+// by the policy being matched.
+func (c *Coverage) Report(policies PolicyList) *CoverageReport {
+	report := CoverageReport{
+		UncoveredPolicies: []string{},
+		Uncovered:         []CoverageItem{},
+	}
+
+	for _, policy := range policies {
+		visitor := coverageVisitor{coverage: c, policy: policy, report: &report}
+		visitor.outcomes(policy, "scope never matched", "never satisfied")
+		if c.counts(policy)[1] == 0 {
+			report.UncoveredPolicies = append(report.UncoveredPolicies, policy.Id)
+		}
+		for _, cond := range policy.Conditions {
+			Walk(&visitor, cond)
+		}
+	}
+
+	return &report
+}
@@ -0,0 +1,63 @@
+package engine_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoverage(t *testing.T) {
+	policies, err := parser.ParseRules(`
+	@id("p")
+	permit(principal, action, resource)
+	when { context.a || context.b }
+	unless { if context.c then context.d else false };
+
+	@id("never")
+	forbid(principal == User::"mallory", action, resource);
+	`)
+	require.NoError(t, err)
+
+	coverage := engine.NewCoverage()
+	auth := cedar.NewAuthorizer(policies, cedar.WithCoverage(coverage))
+
+	for _, input := range []map[string]any{
+		{"a": true, "b": false, "c": false, "d": false},
+		{"a": false, "b": false, "c": true, "d": false},
+	} {
+		vars, err := cedar.NewContextFromMap(input)
+		require.NoError(t, err)
+		_, err = auth.IsAuthorized(context.TODO(), &cedar.Request{
+			Principal: cedar.NewEntity("User", "alice"),
+			Action:    cedar.NewEntity("Action", "view"),
+			Resource:  cedar.NewEntity("Photo", "a.jpg"),
+			Context:   vars,
+		})
+		require.NoError(t, err)
+	}
+
+	report := coverage.Report(policies)
+	assert.Equal(t, []string{"never"}, report.UncoveredPolicies)
+	assert.Equal(t, 12, report.Outcomes)
+	assert.Equal(t, 9, report.Covered)
+
+	descriptions := []string{}
+	for _, item := range report.Uncovered {
+		descriptions = append(descriptions, item.PolicyId+": "+item.Description)
+	}
+	assert.Equal(t, []string{
+		"p: unless { if context.c then context.d else false } never true",
+		"never: scope never matched",
+		"never: never satisfied",
+	}, descriptions)
+
+	var out bytes.Buffer
+	require.NoError(t, report.Write(&out))
+	assert.Contains(t, out.String(), "coverage: 75.0% of 12 outcomes\n")
+}
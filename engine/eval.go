@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+
+	"github.com/koblas/cedar-go/token"
 )
 
 type EvalValue interface {
@@ -16,6 +18,7 @@ type policyResult struct {
 	Permit       bool
 	Forbid       bool
 	RulesMatched []string
+	Diagnostics  Diagnostics
 }
 
 type RuntimeRequest struct {
@@ -23,12 +26,14 @@ type RuntimeRequest struct {
 	Ctx context.Context
 	// Scope properties
 	Store   Store
+	Schema  AttributeSchema
 	Context *VarValue
 
 	// computed values
-	principalValue EntityValue
-	resourceValue  EntityValue
-	actionValue    EntityValue
+	// the entities are boxed once rather than for each reference
+	principalValue EvalValue
+	resourceValue  EvalValue
+	actionValue    EvalValue
 
 	//
 	//
@@ -37,112 +42,221 @@ type RuntimeRequest struct {
 
 	//
 	functionTable map[string]Function
-
-	// Debugging
-	Trace  bool
-	indent int
+	// mask of the policies to evaluate from the index, nil for all
+	candidates []bool
+	// records the outcomes when measuring coverage
+	coverage *Coverage
+
+	// receives the evaluation events, nil when not tracing
+	tracer Tracer
+	depth  int
+
+	// counts the work of the evaluation against the limits of the request
+	budget budget
+	// caches the store results, Store refers to it when there is a store
+	memo memoStore
+	// the compiled form of the policies being evaluated, nil to walk them
+	compiled *CompiledPolicies
 }
 
 type EvalNode interface {
+	Node
 	evalNode(*RuntimeRequest) (EvalValue, error)
 }
 
 var ErrEvalError = errors.New("eval error")
 var ErrTypeError = errors.New("type error")
 
+// EvalError is returned when a policy fails to evaluate, it identifies the
+// policy and the expression that caused the failure.
+type EvalError struct {
+	PolicyID string
+	Position token.Position
+	// Expr is the failing expression rendered in a Cedar like syntax
+	Expr string
+	// Op is the operator or function name that failed, with the types of
+	// the operands it was given
+	Op       string
+	Operands []string
+	Cause    error
+}
+
+func (e *EvalError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Position.String(), e.Cause)
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Cause
+}
+
+// nodeError attaches the position of the node to the error, unless the
+// error has already been located by a more specific expression
+func nodeError(n ExprNode, err error) error {
+	var evalErr *EvalError
+	if errors.As(err, &evalErr) {
+		return err
+	}
+
+	output := EvalError{
+		Position: n.Pos(),
+		Cause:    err,
+	}
+	if expr, ok := n.(EvalNode); ok {
+		output.Expr = ExprString(expr)
+	}
+
+	return &output
+}
+
+// operandError is nodeError which also records the failing operation and
+// the types of its operands
+func operandError(n ExprNode, op string, err error, operands ...EvalValue) error {
+	located := nodeError(n, err)
+	output, ok := located.(*EvalError)
+	if !ok || output.Cause != err {
+		return located
+	}
+	output.Op = op
+	for _, item := range operands {
+		if item != nil {
+			output.Operands = append(output.Operands, item.TypeName())
+		}
+	}
+
+	return output
+}
+
 func evalError(n ExprNode, msg string) error {
-	return fmt.Errorf("%s: %s: %w", n.Pos().String(), msg, ErrEvalError)
+	return nodeError(n, fmt.Errorf("%s: %w", msg, ErrEvalError))
 }
 
 func asBool(n ExprNode, v EvalValue) (bool, error) {
 	value, ok := v.(BoolValue)
 	if !ok {
-		return false, fmt.Errorf("%s: expected bool got %s: %w", n.Pos().String(), v.TypeName(), ErrEvalError)
+		return false, evalError(n, fmt.Sprintf("expected bool got %s", v.TypeName()))
 	}
 
 	return bool(value), nil
 }
 
-func printTrace(indent int, format string, args ...any) {
-	const dots = ". . . . . . . . . . . . . . . . . . . . . . . . . . . . . . . . "
-	const n = len(dots)
-	i := 2 * indent
-	for i > n {
-		fmt.Print(dots)
-		i -= n
+// eval evaluates the node reporting the result to the tracer, the children
+// of a node are evaluated with eval rather than evalNode
+func (request *RuntimeRequest) eval(node EvalNode) (EvalValue, error) {
+	if err := request.budget.expr(); err != nil {
+		return nil, err
+	}
+	if request.tracer == nil {
+		return node.evalNode(request)
 	}
-	// i <= n
-	fmt.Print(dots[0:i])
-	fmt.Printf(format, args...)
-	fmt.Print("\n")
-}
 
-func trace(r *RuntimeRequest, format string, args ...any) *RuntimeRequest {
-	printTrace(r.indent, format+"%s", append(args, "(")...)
-	r.indent += 1
-	return r
-}
+	request.depth += 1
+	value, err := node.evalNode(request)
+	request.depth -= 1
+	request.tracer.OnExprEval(node, value, err, request.depth)
 
-func un(r *RuntimeRequest) {
-	r.indent -= 1
-	printTrace(r.indent, ")")
+	return value, err
 }
 
 //
 //
 
 func (n *ValueNode) evalNode(request *RuntimeRequest) (EvalValue, error) {
-	if request.Trace {
-		printTrace(request.indent, "%s[%s]", n.Value.TypeName(), n.Value)
-	}
 	return n.Value, nil
 }
 
 func (n *UnaryExpr) evalNode(request *RuntimeRequest) (EvalValue, error) {
-	if request.Trace {
-		defer un(trace(request, "UnaryExpr[%s]", n.Op.String()))
-	}
-	result, err := n.Left.evalNode(request)
+	result, err := request.eval(n.Left)
 	if err != nil {
 		return nil, err
 	}
+	return n.apply(result)
+}
+
+// apply applies the operator to the value of the operand
+func (n *UnaryExpr) apply(result EvalValue) (EvalValue, error) {
 	switch n.Op {
 	case OpSub:
 		ltype, ok := result.(MathType)
 		if !ok {
-			return nil, evalError(n, "LHS does not support logic ops")
+			return nil, operandError(n, n.Op.String(), fmt.Errorf("LHS does not support logic ops: %w", ErrEvalError), result)
 		}
 
-		return ltype.OpUnaryMinus()
+		value, err := ltype.OpUnaryMinus()
+		if err != nil {
+			return nil, operandError(n, n.Op.String(), err, result)
+		}
+		return value, nil
 	case OpNot:
 		ltype, ok := result.(LogicType)
 		if !ok {
-			return nil, evalError(n, "LHS does not support logic ops")
+			return nil, operandError(n, n.Op.String(), fmt.Errorf("LHS does not support logic ops: %w", ErrEvalError), result)
 		}
 
-		return ltype.OpNot()
+		value, err := ltype.OpNot()
+		if err != nil {
+			return nil, operandError(n, n.Op.String(), err, result)
+		}
+		return value, nil
 	}
-	return nil, fmt.Errorf("unknown unary op: %s", n.StartPos)
+	return nil, evalError(n, fmt.Sprintf("unknown unary op %s", n.Op.String()))
 }
 
 func (n *BinaryExpr) evalNode(request *RuntimeRequest) (EvalValue, error) {
-	if request.Trace {
-		defer un(trace(request, "BinaryExpr[%s]", n.Op.String()))
+	if n.Op == OpLand || n.Op == OpLor {
+		return n.evalLogical(request)
 	}
-	left, err := n.Left.evalNode(request)
+
+	left, err := request.eval(n.Left)
 	if err != nil {
 		return nil, err
 	}
-	var right EvalValue
-	if n.Op != OpLand && n.Op != OpLor {
-		// Delay evaluation for logical operations
-		r, err := n.Right.evalNode(request)
-		if err != nil {
-			return nil, err
-		}
-		right = r
+	right, err := request.eval(n.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := n.evalOp(request, left, right)
+	if err != nil {
+		return nil, operandError(n, n.Op.String(), err, left, right)
+	}
+
+	return result, nil
+}
+
+// evalLogical evaluates `&&` and `||`, the right hand side is only evaluated
+// when the left hand side doesn't decide the result. Both sides must be
+// booleans.
+func (n *BinaryExpr) evalLogical(request *RuntimeRequest) (EvalValue, error) {
+	left, err := request.eval(n.Left)
+	if err != nil {
+		return nil, err
+	}
+	lval, ok := left.(BoolValue)
+	if !ok {
+		err := fmt.Errorf("expected bool got %s: %w", left.TypeName(), ErrTypeMismatch)
+		return nil, operandError(n, n.Op.String(), err, left)
+	}
+	// false && ... and true || ... never look at the right hand side
+	if bool(lval) == (n.Op == OpLor) {
+		request.coverage.record(n, 0)
+		return lval, nil
+	}
+
+	request.coverage.record(n, 1)
+	right, err := request.eval(n.Right)
+	if err != nil {
+		return nil, err
 	}
+	rval, ok := right.(BoolValue)
+	if !ok {
+		err := fmt.Errorf("expected bool got %s: %w", right.TypeName(), ErrTypeMismatch)
+		return nil, operandError(n, n.Op.String(), err, left, right)
+	}
+
+	return rval, nil
+}
 
+func (n *BinaryExpr) evalOp(request *RuntimeRequest, left, right EvalValue) (EvalValue, error) {
 	switch n.Op {
 	case OpEql, OpNeq:
 		r, err := left.OpEqual(right)
@@ -207,37 +321,6 @@ func (n *BinaryExpr) evalNode(request *RuntimeRequest) (EvalValue, error) {
 			return nil, evalError(n, msg)
 		}
 		return rtype.OpLss(left)
-	// Boolean operators
-	case OpLand, OpLor:
-		ltype, ok := left.(LogicType)
-		if !ok {
-			msg := fmt.Sprintf("type error: not supported %s %s",
-				left.TypeName(), n.Op.String())
-			return nil, evalError(n, msg)
-		}
-
-		// Short circuit these
-		lval, err := asBool(n, left)
-		if err != nil {
-			return nil, err
-		}
-		if n.Op == OpLor && lval {
-			return left, nil
-		}
-		if n.Op == OpAdd && !lval {
-			return left, nil
-		}
-		// Now process the right hand side
-		right, err := n.Right.evalNode(request)
-		if err != nil {
-			return nil, err
-		}
-
-		if n.Op == OpLand {
-			return ltype.OpLand(right)
-		}
-		return ltype.OpLor(right)
-
 	case OpIs:
 		ltype, ok := left.(IsType)
 		if !ok {
@@ -265,6 +348,9 @@ func (n *BinaryExpr) evalNode(request *RuntimeRequest) (EvalValue, error) {
 				left.TypeName(), n.Op.String(), right.TypeName())
 			return nil, evalError(n, msg)
 		}
+		if str, ok := left.(StrValue); ok && n.Pattern != nil {
+			return BoolValue(n.Pattern.Match(string(str))), nil
+		}
 
 		return ltype.OpLike(right)
 
@@ -275,6 +361,10 @@ func (n *BinaryExpr) evalNode(request *RuntimeRequest) (EvalValue, error) {
 			return nil, evalError(n, msg)
 		}
 
+		if request.isUndeclared(left, right) {
+			return BoolValue(false), nil
+		}
+
 		return ltype.OpHas(right, request.Store)
 
 	case OpLookup:
@@ -284,17 +374,43 @@ func (n *BinaryExpr) evalNode(request *RuntimeRequest) (EvalValue, error) {
 			return nil, evalError(n, msg)
 		}
 
-		return ltype.OpLookup(right, request.Store)
+		if request.isUndeclared(left, right) {
+			return nil, fmt.Errorf("attribute %s not declared for %s: %w", right, left, ErrValueNotFound)
+		}
+
+		result, err := ltype.OpLookup(right, request.Store)
+		if _, isRecord := left.(*VarValue); isRecord && errors.Is(err, ErrValueNotFound) {
+			// name the record by the expression, e.g. `principal.address`
+			name, _ := valueAsString(right)
+			return nil, fmt.Errorf("attribute %q does not exist on record %s: %w", name, ExprString(n.Left), ErrValueNotFound)
+		}
+		return result, err
 	}
 
 	return nil, evalError(n, fmt.Sprintf("Unexpected binary op %s", n.Op.String()))
 }
 
-func (n *IfExpr) evalNode(request *RuntimeRequest) (EvalValue, error) {
-	if request.Trace {
-		defer un(trace(request, "IfExpr"))
+// isUndeclared uses the schema to determine if the attribute can't exist on
+// the entity, avoiding a round trip to the store
+func (request *RuntimeRequest) isUndeclared(left, right EvalValue) bool {
+	if request.Schema == nil {
+		return false
+	}
+	entity, ok := left.(EntityValue)
+	if !ok || entity.IsZero() {
+		return false
+	}
+	attr, err := valueAsString(right)
+	if err != nil {
+		return false
 	}
-	cond, err := n.If.evalNode(request)
+	declared, known := request.Schema.HasAttribute(entity.EntityType(), attr)
+
+	return known && !declared
+}
+
+func (n *IfExpr) evalNode(request *RuntimeRequest) (EvalValue, error) {
+	cond, err := request.eval(n.If)
 	if err != nil {
 		return nil, err
 	}
@@ -302,27 +418,19 @@ func (n *IfExpr) evalNode(request *RuntimeRequest) (EvalValue, error) {
 	if err != nil {
 		return nil, err
 	}
+	request.coverage.recordBool(n, value)
 	expr := n.Then
-	branch := "Then"
 	if !value {
-		branch = "Else"
 		expr = n.Else
 	}
-	if request.Trace {
-		defer un(trace(request, "If%s", branch))
-	}
 
-	return expr.evalNode(request)
+	return request.eval(expr)
 }
 
 func (n *FunctionCall) evalNode(request *RuntimeRequest) (EvalValue, error) {
-	if request.Trace {
-		defer un(trace(request, "Function[%s]", n.Name))
-	}
-
 	var left EvalValue
 	if n.Self != nil {
-		lval, err := n.Self.evalNode(request)
+		lval, err := request.eval(n.Self)
 		if err != nil {
 			return nil, err
 		}
@@ -331,45 +439,48 @@ func (n *FunctionCall) evalNode(request *RuntimeRequest) (EvalValue, error) {
 
 	var args []EvalValue
 	for _, arg := range n.Args {
-		val, err := arg.evalNode(request)
+		val, err := request.eval(arg)
 		if err != nil {
 			return nil, err
 		}
 		args = append(args, val)
 	}
 
-	handler, found := request.functionTable[n.Name]
-	if !found {
-		return nil, fmt.Errorf("function named %s not found: %w", n.Name, ErrEvalError)
+	return n.call(request, left, args)
+}
+
+// call applies the function to the values of its receiver and arguments
+func (n *FunctionCall) call(request *RuntimeRequest, left EvalValue, args []EvalValue) (EvalValue, error) {
+	var result EvalValue
+	var err error
+	if handler, found := storeFunctionTable[n.Name]; found {
+		result, err = handler(request.Store, left, args)
+	} else if handler, found := request.functionTable[n.Name]; found {
+		result, err = handler(left, args)
+	} else {
+		return nil, evalError(n, fmt.Sprintf("function named %s not found", n.Name))
 	}
-	result, err := handler(left, args)
 	if err != nil {
-		return nil, err
+		return nil, operandError(n, n.Name, err, append([]EvalValue{left}, args...)...)
 	}
 
 	return result, nil
 }
 
 func (n *ListExpr) evalNode(request *RuntimeRequest) (EvalValue, error) {
-	if request.Trace {
-		defer un(trace(request, "ListExpr"))
-	}
 	values := []NamedType{}
 	for _, item := range n.Exprs {
-		val, err := item.evalNode(request)
+		val, err := request.eval(item)
 		if err != nil {
 			return nil, err
 		}
 		values = append(values, val)
 	}
 
-	return SetValue(values), nil
+	return NewSetValue(values...), nil
 }
 
 func (n *Reference) evalNode(request *RuntimeRequest) (EvalValue, error) {
-	if request.Trace {
-		printTrace(request.indent, "ReferenceExpr[%s]", n.Source.String())
-	}
 	if n.Source == RunVarContext {
 		// TODO - shouldn't happen
 		return request.Context, nil
@@ -395,7 +506,7 @@ func (n *VariableDef) evalNode(request *RuntimeRequest) (EvalValue, error) {
 	data := map[string]NamedType{}
 
 	for _, item := range n.Pairs {
-		value, err := item.Value.evalNode(request)
+		value, err := request.eval(item.Value)
 		if err != nil {
 			return nil, err
 		}
@@ -407,18 +518,15 @@ func (n *VariableDef) evalNode(request *RuntimeRequest) (EvalValue, error) {
 }
 
 func (n *Identifier) evalNode(request *RuntimeRequest) (EvalValue, error) {
-	if request.Trace {
-		printTrace(request.indent, "Identifier[%s]", n.Value)
+	if n.value != nil {
+		return n.value, nil
 	}
 	// This feels like a hack
 	return IdentifierValue(n.Value), nil
 }
 
 func (n *PolicyCondition) evalNode(request *RuntimeRequest) (EvalValue, error) {
-	if request.Trace {
-		defer un(trace(request, "PolicyCondition[%s]", n.Condition.String()))
-	}
-	result, err := n.Expr.evalNode(request)
+	result, err := request.eval(n.Expr)
 	if err != nil {
 		return nil, err
 	}
@@ -426,6 +534,7 @@ func (n *PolicyCondition) evalNode(request *RuntimeRequest) (EvalValue, error) {
 	if err != nil {
 		return nil, err
 	}
+	request.coverage.recordBool(n, boolValue)
 
 	if n.Condition == ConditionWhen {
 		return BoolValue(boolValue), nil
@@ -434,38 +543,68 @@ func (n *PolicyCondition) evalNode(request *RuntimeRequest) (EvalValue, error) {
 	return BoolValue(!boolValue), nil
 }
 
-func (n *Policy) evalNode(request *RuntimeRequest) (*policyResult, error) {
-	if request.Trace {
-		defer un(trace(request, "Policy[id=%s, type=%s]", n.Id, n.Effect.String()))
+// evalNode returns the result by value, a policy is evaluated for each
+// request and the result doesn't outlive the evaluation of the list
+func (n *Policy) evalNode(request *RuntimeRequest) (policyResult, error) {
+	result, err := n.evalPolicy(request)
+	if err != nil {
+		return policyResult{}, n.policyError(err)
 	}
 
-	if r, err := n.If.evalNode(request); err != nil {
-		return nil, err
+	return result, nil
+}
+
+// policyError reports the error with the policy that raised it
+func (n *Policy) policyError(err error) error {
+	var evalErr *EvalError
+	if !errors.As(err, &evalErr) {
+		evalErr = &EvalError{Position: n.StartPos, Cause: err}
+		err = evalErr
+	}
+	evalErr.PolicyID = n.Id
+	return err
+}
+
+// stopped is the error of the request's context once it is done or of the
+// budget once it is exceeded, the evaluation stops at the policy
+func (n *Policy) stopped(request *RuntimeRequest) error {
+	err := contextErr(request.Ctx)
+	if err == nil {
+		err = request.budget.exceeded
+	}
+	if err != nil {
+		return &EvalError{PolicyID: n.Id, Position: n.StartPos, Cause: err}
+	}
+	return nil
+}
+
+func (n *Policy) evalPolicy(request *RuntimeRequest) (policyResult, error) {
+	if r, err := request.eval(n.If); err != nil {
+		return policyResult{}, err
 	} else if v, err := asBool(n, r); err != nil {
-		return nil, err
+		return policyResult{}, err
 	} else if !v {
-		return &policyResult{}, nil
+		return policyResult{}, nil
 	}
+	request.coverage.record(n, 0)
 
 	evalResult := true
 	for _, item := range n.Conditions {
-		result, err := item.evalNode(request)
+		result, err := request.eval(item)
 		if err != nil {
-			return nil, err
+			return policyResult{}, err
 		}
 		boolValue, err := asBool(n, result)
 		if err != nil {
-			return nil, err
+			return policyResult{}, err
 		}
 		evalResult = evalResult && boolValue
-		// if request.Trace {
-		// 	fmt.Printf("PolicyCondition(%s) = %v", item.Condition.String(), boolValue)
-		// }
 	}
 
 	forbid := false
 	permit := false
 	if evalResult {
+		request.coverage.record(n, 1)
 		if n.Effect == EffectForbid {
 			forbid = true
 		} else if n.Effect == EffectPermit {
@@ -473,7 +612,7 @@ func (n *Policy) evalNode(request *RuntimeRequest) (*policyResult, error) {
 		}
 	}
 
-	return &policyResult{
+	return policyResult{
 		Evaluated: true,
 		Forbid:    forbid,
 		Permit:    permit,
@@ -481,21 +620,38 @@ func (n *Policy) evalNode(request *RuntimeRequest) (*policyResult, error) {
 }
 
 func (p PolicyList) evalNode(request *RuntimeRequest) (*policyResult, error) {
-	if request.Trace {
-		defer un(trace(request, "PolicyList"))
-	}
 	allowed := false
 	forbid := false
 
 	var matches []string
 	var elist []error
-	for _, item := range p {
-		res, err := item.evalNode(request)
+	diag := Diagnostics{}
+	for pos, item := range p {
+		if err := item.stopped(request); err != nil {
+			return nil, err
+		}
+		if request.candidates != nil && !request.candidates[pos] {
+			diag.Skipped = append(diag.Skipped, item.Id)
+			continue
+		}
+		if request.tracer != nil {
+			request.tracer.OnPolicyStart(item)
+		}
+		var res policyResult
+		var err error
+		if request.compiled != nil {
+			res, err = request.compiled.evalPolicy(pos, request)
+		} else {
+			res, err = item.evalNode(request)
+		}
 		if err != nil {
 			elist = append(elist, err)
+			diag.Errors = append(diag.Errors, PolicyError{PolicyId: item.Id, Filename: item.StartPos.Filename, Err: err})
+			diag.addProvenance(item)
 			continue
 		}
 		if !res.Evaluated {
+			diag.Skipped = append(diag.Skipped, item.Id)
 			continue
 		}
 		// fmt.Println(res)
@@ -503,8 +659,23 @@ func (p PolicyList) evalNode(request *RuntimeRequest) (*policyResult, error) {
 		forbid = forbid || res.Forbid
 		allowed = allowed || res.Permit
 
+		if res.Forbid {
+			diag.Forbids = append(diag.Forbids, item.Id)
+		} else if res.Permit {
+			diag.Permits = append(diag.Permits, item.Id)
+		} else {
+			diag.Skipped = append(diag.Skipped, item.Id)
+		}
 		if res.Forbid || res.Permit {
 			matches = append(matches, item.Id)
+			diag.addProvenance(item)
+		}
+	}
+
+	// The last policy may have been cut short
+	if len(p) != 0 {
+		if err := p[len(p)-1].stopped(request); err != nil {
+			return nil, err
 		}
 	}
 
@@ -519,6 +690,7 @@ func (p PolicyList) evalNode(request *RuntimeRequest) (*policyResult, error) {
 			Decision:     Allow,
 			Permit:       true,
 			RulesMatched: matches,
+			Diagnostics:  diag,
 		}, err
 	}
 
@@ -526,5 +698,6 @@ func (p PolicyList) evalNode(request *RuntimeRequest) (*policyResult, error) {
 		Decision:     Deny,
 		Forbid:       true,
 		RulesMatched: matches,
+		Diagnostics:  diag,
 	}, err
 }
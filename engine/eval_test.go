@@ -2,7 +2,10 @@ package engine_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math"
+	"strings"
 	"testing"
 
 	"github.com/koblas/cedar-go"
@@ -217,6 +220,7 @@ func TestOps(t *testing.T) {
 		{"1 - 1 == 0", true},
 		{"1 * 1 == 1", true},
 		{"1 - 2 == -1", true},
+		{"5 - 3 - 1 == 1", true},
 		// Not in language
 		// {"1 / 1 == 1", true},
 		// {"3 % 2 == 1", true},
@@ -251,6 +255,124 @@ func TestOps(t *testing.T) {
 	}
 }
 
+func TestInOperator(t *testing.T) {
+	store, err := schema.NewEmptySchema().NormalizeEntites(schema.JsonEntities{
+		{
+			Uid:     schema.JsonEntityValue{"type": "User", "id": "alice"},
+			Parents: []schema.JsonEntityValue{{"type": "Group", "id": "staff"}},
+		},
+		{
+			Uid:     schema.JsonEntityValue{"type": "Group", "id": "staff"},
+			Parents: []schema.JsonEntityValue{{"type": "Group", "id": "all"}},
+		},
+	})
+	require.NoError(t, err)
+
+	expressions := []struct {
+		expr   string
+		expect bool
+		err    bool
+	}{
+		{expr: `User::"alice" in Group::"staff"`, expect: true},
+		{expr: `User::"alice" in Group::"all"`, expect: true},
+		{expr: `User::"alice" in [Group::"other", Group::"all"]`, expect: true},
+		{expr: `Group::"all" in User::"alice"`, expect: false},
+		{expr: `User::"bob" in Group::"staff"`, expect: false},
+		// An entity is in itself, even when it isn't in the store
+		{expr: `User::"bob" in User::"bob"`, expect: true},
+		{expr: `User::"bob" in [User::"bob"]`, expect: true},
+		{expr: `User::"bob" in []`, expect: false},
+		// The left hand side must be an entity
+		{expr: `[User::"alice"] in Group::"staff"`, err: true},
+		{expr: `"alice" in Group::"staff"`, err: true},
+		{expr: `User::"alice" in "staff"`, err: true},
+		{expr: `User::"alice" in [Group::"staff", 1]`, err: true},
+	}
+
+	req := cedar.Request{
+		Principal: ast.NewEntityValue("User", "alice"),
+		Resource:  ast.NewEntityValue("Photo", "vacation.jpg"),
+		Action:    ast.NewEntityValue("Action", "view"),
+	}
+	eval := func(store ast.Store, expr string) (bool, error) {
+		policy, err := parser.ParseRules(fmt.Sprintf(`permit(principal, action, resource) when { %s };`, expr))
+		require.NoError(t, err, expr)
+
+		return cedar.NewAuthorizer(policy, cedar.WithStore(store)).IsAuthorized(context.TODO(), &req)
+	}
+
+	for _, item := range expressions {
+		result, err := eval(store, item.expr)
+		if item.err {
+			assert.Error(t, err, item.expr)
+			continue
+		}
+		require.NoError(t, err, item.expr)
+		assert.Equal(t, item.expect, result, item.expr)
+	}
+
+	// Without any store data
+	result, err := eval(schema.NewEmptyStore(), `User::"bob" in [Group::"staff", User::"bob"]`)
+	require.NoError(t, err)
+	assert.True(t, result)
+}
+
+func TestIsOperator(t *testing.T) {
+	store, err := schema.NewEmptySchema().NormalizeEntites(schema.JsonEntities{
+		{
+			Uid:     schema.JsonEntityValue{"type": "Photos::User", "id": "alice"},
+			Parents: []schema.JsonEntityValue{{"type": "Group", "id": "staff"}},
+		},
+		{
+			Uid:     schema.JsonEntityValue{"type": "Photo", "id": "a.jpg"},
+			Parents: []schema.JsonEntityValue{{"type": "Album", "id": "trip"}},
+		},
+	})
+	require.NoError(t, err)
+
+	policies := []struct {
+		policy string
+		expect bool
+	}{
+		{`permit(principal is Photos::User, action, resource);`, true},
+		{`permit(principal is User, action, resource);`, false},
+		{`permit(principal, action, resource is Photo);`, true},
+		{`permit(principal is Photos::User in Group::"staff", action, resource);`, true},
+		{`permit(principal is Photos::User in Group::"other", action, resource);`, false},
+		{`permit(principal is Group in Group::"staff", action, resource);`, false},
+		{`permit(principal is Photos::User in Photos::User::"alice", action, resource);`, true},
+		{`permit(principal, action, resource is Photo in Album::"trip");`, true},
+		{`permit(principal, action, resource is Album in Album::"trip");`, false},
+		{`permit(principal, action, resource) when { principal is Photos::User };`, true},
+		{`permit(principal, action, resource) when { resource is Photo in Album::"trip" };`, true},
+		{`permit(principal, action, resource) when { resource is Photo in Album::"other" };`, false},
+		{`permit(principal, action, resource) when { !(principal is Photo) && resource is Photo };`, true},
+	}
+
+	req := cedar.Request{
+		Principal: ast.NewEntityValue("Photos::User", "alice"),
+		Resource:  ast.NewEntityValue("Photo", "a.jpg"),
+		Action:    ast.NewEntityValue("Action", "view"),
+	}
+	for _, item := range policies {
+		policy, err := parser.ParseRules(item.policy)
+		require.NoError(t, err, item.policy)
+
+		result, err := cedar.NewAuthorizer(policy, cedar.WithStore(store)).IsAuthorized(context.TODO(), &req)
+		require.NoError(t, err, item.policy)
+		assert.Equal(t, item.expect, result, item.policy)
+	}
+
+	for _, policy := range []string{
+		`permit(principal is User == User::"alice", action, resource);`,
+		`permit(principal is User::"alice", action, resource);`,
+		`permit(principal is, action, resource);`,
+	} {
+		_, err := parser.ParseRules(policy)
+		assert.Error(t, err, policy)
+	}
+}
+
 func TestFuncCall(t *testing.T) {
 	entityData := schema.JsonEntities{
 		{
@@ -293,3 +415,614 @@ func TestFuncCall(t *testing.T) {
 
 	require.True(t, result)
 }
+
+// tagStore adds the tags of the entities to a store
+type tagStore struct {
+	ast.Store
+	tags map[string]map[string]ast.EvalValue
+}
+
+func (s tagStore) GetTag(entity ast.EntityValue, tag string) (ast.EvalValue, error) {
+	value, found := s.tags[entity.String()][tag]
+	if !found {
+		return nil, ast.ErrValueNotFound
+	}
+	return value, nil
+}
+
+func TestNewerMethods(t *testing.T) {
+	request := &ast.Request{
+		Principal: ast.NewEntityValue("User", "alice"),
+		Action:    ast.NewEntityValue("Action", "view"),
+		Resource:  ast.NewEntityValue("Photo", "a.jpg"),
+		Store: tagStore{
+			Store: schema.EntityStore{},
+			tags: map[string]map[string]ast.EvalValue{
+				`User::"alice"`: {"dept": ast.StrValue("eng")},
+			},
+		},
+	}
+
+	cases := []struct {
+		expr  string
+		value ast.EvalValue
+	}{
+		{`[].isEmpty()`, ast.BoolValue(true)},
+		{`[1].isEmpty()`, ast.BoolValue(false)},
+		{`principal.hasTag("dept")`, ast.BoolValue(true)},
+		{`principal.hasTag("team")`, ast.BoolValue(false)},
+		{`resource.hasTag("dept")`, ast.BoolValue(false)},
+		{`principal.getTag("dept")`, ast.StrValue("eng")},
+		{`principal.hasTag("dept") && principal.getTag("dept") == "eng"`, ast.BoolValue(true)},
+	}
+	for _, item := range cases {
+		node, err := parser.ParseExpr(item.expr)
+		require.NoError(t, err, item.expr)
+		value, err := ast.EvalExpr(context.TODO(), node, request)
+		require.NoError(t, err, item.expr)
+		assert.Equal(t, item.value, value, item.expr)
+	}
+
+	errors := []string{
+		`principal.getTag("team")`,
+		`"abc".isEmpty()`,
+		`[1].isEmpty(1)`,
+		`"alice".hasTag("dept")`,
+		`principal.getTag(1)`,
+	}
+	for _, expr := range errors {
+		node, err := parser.ParseExpr(expr)
+		require.NoError(t, err, expr)
+		_, err = ast.EvalExpr(context.TODO(), node, request)
+		assert.Error(t, err, expr)
+	}
+
+	// A store without tags has none
+	request.Store = schema.EntityStore{}
+	node, err := parser.ParseExpr(`principal.hasTag("dept")`)
+	require.NoError(t, err)
+	value, err := ast.EvalExpr(context.TODO(), node, request)
+	require.NoError(t, err)
+	assert.Equal(t, ast.BoolValue(false), value)
+}
+
+type countingStore struct {
+	ast.Store
+	gets    int
+	parents int
+}
+
+func (s *countingStore) Get(entity ast.EntityValue, key string) (ast.EvalValue, error) {
+	s.gets += 1
+	return s.Store.Get(entity, key)
+}
+
+func (s *countingStore) GetParents(entity ast.EntityValue) ([]ast.EntityValue, error) {
+	s.parents += 1
+	return s.Store.GetParents(entity)
+}
+
+func TestSchemaAttributeShortCircuit(t *testing.T) {
+	sdef, err := schema.NewFromJson(strings.NewReader(`{
+		"": {
+			"entityTypes": {
+				"User": {
+					"shape": {
+						"type": "Record",
+						"additionalAttributes": false,
+						"attributes": { "active": { "type": "Boolean" } }
+					}
+				}
+			},
+			"actions": {}
+		}
+	}`))
+	require.NoError(t, err)
+
+	entities, err := sdef.NormalizeEntites(schema.JsonEntities{
+		{
+			Uid:   schema.JsonEntityValue{"type": "User", "id": "alice"},
+			Attrs: map[string]any{"active": true},
+		},
+	})
+	require.NoError(t, err)
+
+	req := cedar.Request{
+		Principal: ast.NewEntityValue("User", "alice"),
+		Resource:  ast.NewEntityValue("Photo", "vacation.jpg"),
+		Action:    ast.NewEntityValue("Action", "view"),
+	}
+
+	policy, err := parser.ParseRules(`
+	permit(principal, action, resource)
+	when { principal.active && !(principal has nickname) };
+	forbid(principal, action, resource)
+	when { principal has manager };
+	`)
+	require.NoError(t, err)
+
+	store := &countingStore{Store: entities}
+	auth := cedar.NewAuthorizer(policy, cedar.WithSchema(sdef), cedar.WithStore(store))
+	result, err := auth.IsAuthorized(context.TODO(), &req)
+	require.NoError(t, err)
+	assert.True(t, result)
+	assert.Equal(t, 1, store.gets, "only the declared attribute should be fetched")
+
+	policy, err = parser.ParseRules(`
+	permit(principal, action, resource) when { principal.nickname == "al" };
+	`)
+	require.NoError(t, err)
+
+	auth = cedar.NewAuthorizer(policy, cedar.WithSchema(sdef), cedar.WithStore(store))
+	_, err = auth.IsAuthorized(context.TODO(), &req)
+	assert.ErrorIs(t, err, ast.ErrValueNotFound)
+	assert.Equal(t, 1, store.gets)
+	assert.Equal(t, `2:55: attribute nickname not declared for User::"alice": value not found in store`, err.Error())
+}
+
+func TestDiagnostics(t *testing.T) {
+	policy, err := parser.ParseRules(`
+	@id("allow-bob")
+	permit(principal == User::"bob", action, resource);
+
+	@id("allow-alice")
+	permit(principal == User::"alice", action, resource);
+
+	@id("deny-bob")
+	forbid(principal, action, resource) when { principal == User::"bob" };
+	`)
+	require.NoError(t, err)
+
+	detail, err := cedar.NewAuthorizer(policy).IsAuthorizedDetail(context.TODO(), bobRequest)
+	require.NoError(t, err)
+
+	assert.False(t, detail.IsAllowed)
+	assert.Equal(t, []string{"allow-bob"}, detail.Diagnostics.Permits)
+	assert.Equal(t, []string{"deny-bob"}, detail.Diagnostics.Forbids)
+	assert.Equal(t, []string{"allow-alice"}, detail.Diagnostics.Skipped)
+	assert.Empty(t, detail.Diagnostics.Errors)
+}
+
+func TestEvalErrorDetail(t *testing.T) {
+	policy, err := parser.ParseRules(`
+	@id("ok")
+	permit(principal, action, resource);
+
+	@id("bad-math")
+	permit(principal, action, resource)
+	when { 1 + "two" == 3 };
+	`)
+	require.NoError(t, err)
+
+	auth := cedar.NewAuthorizer(policy)
+	detail, err := auth.IsAuthorizedDetail(context.TODO(), emptyRequest)
+	require.NoError(t, err)
+
+	// The decision is made from the policies that evaluated
+	assert.True(t, detail.IsAllowed)
+	assert.Equal(t, []string{"ok"}, detail.Diagnostics.Permits)
+	require.Len(t, detail.Diagnostics.Errors, 1)
+	assert.Equal(t, "bad-math", detail.Diagnostics.Errors[0].PolicyId)
+
+	// The simple interface fails closed
+	allowed, err := auth.IsAuthorized(context.TODO(), emptyRequest)
+	assert.False(t, allowed)
+	require.Error(t, err)
+
+	var evalErr *ast.EvalError
+	require.ErrorAs(t, err, &evalErr)
+	assert.Equal(t, "bad-math", evalErr.PolicyID)
+	assert.Equal(t, 7, evalErr.Position.Line)
+	assert.Equal(t, `1 + "two"`, evalErr.Expr)
+	assert.ErrorIs(t, err, ast.ErrTypeMismatch)
+}
+
+func TestMethodWithoutReceiver(t *testing.T) {
+	// A method called as a function has no receiver, it's a type error
+	// rather than a crash
+	for _, call := range []string{
+		`isEmpty()`,
+		`contains(1)`,
+		`containsAll([1])`,
+		`containsAny([1])`,
+		`hasTag("a")`,
+		`getTag("a")`,
+		`isLoopback()`,
+		`lessThan(decimal("1.0"))`,
+	} {
+		policy, err := parser.ParseRules(`permit(principal, action, resource) when { ` + call + ` };`)
+		require.NoError(t, err, call)
+
+		for _, compile := range []bool{false, true} {
+			opts := []cedar.Option{}
+			if compile {
+				opts = append(opts, cedar.WithCompilation())
+			}
+			detail, err := cedar.NewAuthorizer(policy, opts...).IsAuthorizedDetail(context.TODO(), emptyRequest)
+			require.NoError(t, err, call)
+			assert.False(t, detail.IsAllowed, call)
+			require.Len(t, detail.Diagnostics.Errors, 1, call)
+			assert.ErrorIs(t, detail.Diagnostics.Errors[0].Err, ast.ErrTypeMismatch, call)
+		}
+	}
+}
+
+func TestEvalErrorJson(t *testing.T) {
+	policy, err := parser.ParseRules(`
+	@id("bad-math")
+	permit(principal, action, resource)
+	when { 1 + "two" == 3 };
+	`)
+	require.NoError(t, err)
+
+	detail, err := cedar.NewAuthorizer(policy).IsAuthorizedDetail(context.TODO(), emptyRequest)
+	require.NoError(t, err)
+	require.Len(t, detail.Diagnostics.Errors, 1)
+
+	errDetail := detail.Diagnostics.Errors[0].Detail()
+	assert.Equal(t, "+", errDetail.Op)
+	assert.Equal(t, []string{"long", "string"}, errDetail.Operands)
+
+	data, err := json.Marshal(detail.Diagnostics)
+	require.NoError(t, err)
+
+	var output struct {
+		Errors []map[string]any `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(data, &output))
+	require.Len(t, output.Errors, 1)
+	assert.Equal(t, "bad-math", output.Errors[0]["policyId"])
+	assert.Equal(t, `1 + "two"`, output.Errors[0]["expr"])
+	assert.Equal(t, "+", output.Errors[0]["op"])
+	assert.Equal(t, []any{"long", "string"}, output.Errors[0]["operandTypes"])
+	assert.Equal(t, float64(4), output.Errors[0]["position"].(map[string]any)["line"])
+	assert.NotContains(t, output.Errors[0]["message"], "4:")
+}
+
+func TestEvalExpr(t *testing.T) {
+	request := &ast.Request{
+		Principal: ast.NewEntityValue("User", "alice"),
+		Action:    ast.NewEntityValue("Action", "view"),
+		Resource:  ast.NewEntityValue("Photo", "a.jpg"),
+		Store:     schema.EntityStore{},
+	}
+
+	node, err := parser.ParseExpr(`principal == User::"alice" && [1, 2].contains(2)`)
+	require.NoError(t, err)
+	value, err := ast.EvalExpr(context.TODO(), node, request)
+	require.NoError(t, err)
+	assert.Equal(t, ast.BoolValue(true), value)
+
+	node, err = parser.ParseExpr(`resource.owner`)
+	require.NoError(t, err)
+	_, err = ast.EvalExpr(context.TODO(), node, request)
+	assert.Error(t, err)
+
+	_, err = parser.ParseExpr(`1 + `)
+	assert.Error(t, err)
+	_, err = parser.ParseExpr(`1 2`)
+	assert.Error(t, err)
+}
+
+func TestLogicalShortCircuit(t *testing.T) {
+	request := &ast.Request{
+		Principal: ast.NewEntityValue("User", "alice"),
+		Store:     schema.EntityStore{},
+	}
+
+	expressions := []struct {
+		expr   string
+		expect ast.EvalValue
+	}{
+		{"false && 1", ast.BoolValue(false)},
+		{"false && principal.missing", ast.BoolValue(false)},
+		{"true || 1", ast.BoolValue(true)},
+		{"true || principal.missing", ast.BoolValue(true)},
+		{"true && false", ast.BoolValue(false)},
+		{"false || true", ast.BoolValue(true)},
+		{"true && 1", nil},
+		{"false || 1", nil},
+		{"1 && false", nil},
+		{"1 || true", nil},
+		{"true && principal.missing", nil},
+	}
+
+	for _, item := range expressions {
+		item := item
+		t.Run(item.expr, func(t *testing.T) {
+			node, err := parser.ParseExpr(item.expr)
+			require.NoError(t, err)
+
+			value, err := ast.EvalExpr(context.TODO(), node, request)
+			if item.expect == nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, item.expect, value)
+		})
+	}
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	request := &ast.Request{Store: schema.EntityStore{}}
+
+	expressions := []struct {
+		expr   string
+		expect ast.EvalValue
+	}{
+		{"9223372036854775807", ast.IntValue(math.MaxInt64)},
+		{"-9223372036854775808", ast.IntValue(math.MinInt64)},
+		{"9223372036854775806 + 1", ast.IntValue(math.MaxInt64)},
+		{"9223372036854775807 + 1", nil},
+		{"-9223372036854775807 - 1", ast.IntValue(math.MinInt64)},
+		{"-9223372036854775807 - 2", nil},
+		{"1 - -9223372036854775807", nil},
+		{"4611686018427387904 * 2", nil},
+		{"-4611686018427387904 * 2", ast.IntValue(math.MinInt64)},
+		{"-1 * -9223372036854775808", nil},
+		{"-(-9223372036854775808)", nil},
+	}
+
+	for _, item := range expressions {
+		item := item
+		t.Run(item.expr, func(t *testing.T) {
+			node, err := parser.ParseExpr(item.expr)
+			require.NoError(t, err)
+
+			value, err := ast.EvalExpr(context.TODO(), node, request)
+			if item.expect == nil {
+				assert.ErrorIs(t, err, ast.ErrOverflow)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, item.expect, value)
+		})
+	}
+
+	_, err := parser.ParseExpr("9223372036854775808")
+	assert.ErrorIs(t, err, ast.ErrOverflow)
+}
+
+func TestLookupErrors(t *testing.T) {
+	alice := ast.NewEntityValue("User", "alice")
+	request := &ast.Request{
+		Principal: alice,
+		Store: schema.EntityStore{
+			alice.String(): schema.NewEntityStoreItem(alice, nil, ast.NewVarValue(map[string]ast.NamedType{
+				"address": ast.NewVarValue(map[string]ast.NamedType{"city": ast.StrValue("Paris")}),
+			})),
+		},
+		Context: ast.NewVarValue(map[string]ast.NamedType{}),
+	}
+
+	expressions := []struct {
+		expr    string
+		message string
+	}{
+		{"principal.name", `1:11: attribute "name" does not exist on entity User::"alice"`},
+		{"principal.address.street", `1:19: attribute "street" does not exist on record principal.address`},
+		{`principal["address"]["zip"]`, `1:22: attribute "zip" does not exist on record principal["address"]`},
+		{"context.\n  mfa", `2:3: attribute "mfa" does not exist on record context`},
+	}
+
+	for _, item := range expressions {
+		item := item
+		t.Run(item.expr, func(t *testing.T) {
+			node, err := parser.ParseExpr(item.expr)
+			require.NoError(t, err)
+
+			_, err = ast.EvalExpr(context.TODO(), node, request)
+			assert.ErrorIs(t, err, ast.ErrValueNotFound)
+			assert.ErrorContains(t, err, item.message)
+		})
+	}
+}
+
+// ancestorStore is a store following the contract of GetParents, it only
+// returns the ancestors
+type ancestorStore map[string][]ast.EntityValue
+
+func (s ancestorStore) Get(key ast.EntityValue, attr string) (ast.EvalValue, error) {
+	return nil, ast.ErrValueNotFound
+}
+
+func (s ancestorStore) GetParents(key ast.EntityValue) ([]ast.EntityValue, error) {
+	return s[key.String()], nil
+}
+
+func TestInReflexive(t *testing.T) {
+	alice := ast.NewEntityValue("User", "alice")
+	staff := ast.NewEntityValue("Group", "staff")
+	request := &ast.Request{
+		Principal: alice,
+		Store:     ancestorStore{alice.String(): {staff}},
+	}
+
+	expressions := map[string]bool{
+		`principal in User::"alice"`:                     true,
+		`principal in [Group::"other", User::"alice"]`:   true,
+		`principal in Group::"staff"`:                    true,
+		`Group::"staff" in Group::"staff"`:               true,
+		`Group::"staff" in User::"alice"`:                false,
+		`User::"unknown" in User::"unknown"`:             true,
+		`User::"unknown" in [User::"unknown"]`:           true,
+		`principal in [Group::"other", Group::"staff"]`:  true,
+		`principal in [Group::"other", User::"someone"]`: false,
+	}
+	for expr, expected := range expressions {
+		node, err := parser.ParseExpr(expr)
+		require.NoError(t, err)
+		value, err := ast.EvalExpr(context.TODO(), node, request)
+		require.NoError(t, err, expr)
+		assert.Equal(t, ast.BoolValue(expected), value, expr)
+	}
+
+	// The ancestors of an entity in a cycle don't include the entity
+	group := ast.NewEntityValue("Group", "a")
+	store := schema.EntityStore{
+		alice.String(): schema.NewEntityStoreItem(alice, []ast.EntityValue{group}, nil),
+		group.String(): schema.NewEntityStoreItem(group, []ast.EntityValue{alice}, nil),
+	}
+	parents, err := store.GetParents(alice)
+	require.NoError(t, err)
+	assert.Equal(t, []ast.EntityValue{group}, parents)
+}
+
+func TestStoreMemoization(t *testing.T) {
+	entities, err := schema.NewEmptySchema().NormalizeEntites(schema.JsonEntities{
+		{
+			Uid:     schema.JsonEntityValue{"type": "User", "id": "alice"},
+			Parents: []schema.JsonEntityValue{{"type": "Group", "id": "staff"}},
+			Attrs:   map[string]any{"level": 5},
+		},
+	})
+	require.NoError(t, err)
+
+	policy, err := parser.ParseRules(`
+	permit(principal in Group::"staff", action, resource)
+	when { principal.level > 3 && principal.level < 10 };
+	forbid(principal in Group::"staff", action, resource)
+	when { principal.level > 8 };
+	`)
+	require.NoError(t, err)
+
+	store := &countingStore{Store: entities}
+	auth := cedar.NewAuthorizer(policy, cedar.WithStore(store))
+	result, err := auth.IsAuthorized(context.TODO(), bobRequest)
+	require.NoError(t, err)
+	assert.False(t, result)
+
+	req := cedar.Request{
+		Principal: ast.NewEntityValue("User", "alice"),
+		Action:    ast.NewEntityValue("Action", "view"),
+		Resource:  ast.NewEntityValue("Photo", "a.jpg"),
+	}
+	store.gets = 0
+	result, err = auth.IsAuthorized(context.TODO(), &req)
+	require.NoError(t, err)
+	assert.True(t, result)
+	assert.Equal(t, 1, store.gets, "attribute is fetched once per evaluation")
+
+	// The cache doesn't outlive the evaluation
+	_, err = auth.IsAuthorized(context.TODO(), &req)
+	require.NoError(t, err)
+	assert.Equal(t, 2, store.gets)
+}
+
+func BenchmarkNestedContextLookup(b *testing.B) {
+	// context.k0.k1.k2.k3.k4 is a record 5 levels deep with 4 keys per level
+	var build func(depth int) map[string]any
+	build = func(depth int) map[string]any {
+		record := map[string]any{}
+		for i := 0; i < 4; i++ {
+			key := fmt.Sprintf("k%d", i)
+			if depth <= 1 {
+				record[key] = float64(i)
+			} else {
+				record[key] = build(depth - 1)
+			}
+		}
+		return record
+	}
+	policy, err := parser.ParseRules(`
+	permit(principal, action, resource)
+	when { context.k0.k1.k2.k3.k3 == 3 && context has k2 && context.k2.k2 has k1 };
+	`)
+	require.NoError(b, err)
+	data := build(5)
+	auth := cedar.NewAuthorizer(policy)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ctx, err := schema.NewEmptySchema().NormalizeContext(data, nil, nil, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		req := cedar.Request{
+			Principal: ast.NewEntityValue("User", "alice"),
+			Action:    ast.NewEntityValue("Action", "view"),
+			Resource:  ast.NewEntityValue("Photo", "a.jpg"),
+			Context:   ctx,
+		}
+		allowed, err := auth.IsAuthorized(context.TODO(), &req)
+		if err != nil || !allowed {
+			b.Fatal(allowed, err)
+		}
+	}
+}
+
+type cancellingStore struct {
+	ast.Store
+	cancel context.CancelFunc
+}
+
+func (s *cancellingStore) Get(entity ast.EntityValue, key string) (ast.EvalValue, error) {
+	s.cancel()
+	return s.Store.Get(entity, key)
+}
+
+func TestEvalContextDone(t *testing.T) {
+	policy, err := parser.ParseRules(`
+	permit(principal, action, resource) when { principal.active };
+	permit(principal, action, resource) when { principal.admin };
+	`)
+	require.NoError(t, err)
+
+	store := schema.EntityStore{}
+	require.NoError(t, store.Add(schema.NewEntityStoreItem(
+		ast.NewEntityValue("User", "alice"),
+		nil,
+		ast.NewVarValue(map[string]ast.NamedType{"active": ast.BoolValue(true), "admin": ast.BoolValue(false)}),
+	)))
+	req := ast.Request{Principal: ast.NewEntityValue("User", "alice"), Store: store}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ast.Eval(ctx, policy, &req)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// The store isn't called once the context is done
+	ctx, cancel = context.WithCancel(context.Background())
+	counting := &countingStore{Store: &cancellingStore{Store: store, cancel: cancel}}
+	req.Store = counting
+	_, err = ast.Eval(ctx, policy, &req)
+	var evalErr *ast.EvalError
+	require.ErrorAs(t, err, &evalErr)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, "policy1", evalErr.PolicyID)
+	assert.Equal(t, 1, counting.gets)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	_, err = cedar.NewAuthorizer(policy, cedar.WithStore(store)).IsAuthorized(ctx, &cedar.Request{Principal: req.Principal})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestEvalLimits(t *testing.T) {
+	policy, err := parser.ParseRules(`
+	permit(principal, action, resource) when { principal.active && 1 + 2 + 3 + 4 == 10 };
+	permit(principal, action, resource) when { principal.admin };
+	`)
+	require.NoError(t, err)
+
+	store := schema.EntityStore{}
+	require.NoError(t, store.Add(schema.NewEntityStoreItem(
+		ast.NewEntityValue("User", "alice"),
+		nil,
+		ast.NewVarValue(map[string]ast.NamedType{"active": ast.BoolValue(true), "admin": ast.BoolValue(false)}),
+	)))
+	request := &cedar.Request{Principal: ast.NewEntityValue("User", "alice")}
+
+	ok, err := cedar.NewAuthorizer(policy, cedar.WithStore(store), cedar.WithEvalLimits(100, 10)).IsAuthorized(context.TODO(), request)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = cedar.NewAuthorizer(policy, cedar.WithStore(store), cedar.WithEvalLimits(5, 0)).IsAuthorized(context.TODO(), request)
+	assert.ErrorIs(t, err, ast.ErrEvalBudgetExceeded)
+
+	// The second policy needs another call to the store
+	_, err = cedar.NewAuthorizer(policy, cedar.WithStore(store), cedar.WithEvalLimits(0, 1)).IsAuthorized(context.TODO(), request)
+	assert.ErrorIs(t, err, ast.ErrEvalBudgetExceeded)
+}
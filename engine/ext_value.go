@@ -2,32 +2,37 @@ package engine
 
 import (
 	"fmt"
-	"net"
-	"strconv"
+	"math"
+	"net/netip"
+	"strings"
 )
 
-// IP Value
+// IP Value, an address or a range of addresses. A single address is stored
+// as a prefix covering all of the bits of the address.
 type IpValue struct {
-	addr net.IP
-	cidr *net.IPNet
+	prefix netip.Prefix
 }
 
 var _ NamedType = (*IpValue)(nil)
 
+// NewIpValue parses an IPv4 or IPv6 address, optionally followed by the
+// prefix length of a range. Zones are not supported.
 func NewIpValue(arg string) (*IpValue, error) {
-	if ip := net.ParseIP(arg); ip != nil {
-		return &IpValue{addr: ip}, nil
+	var prefix netip.Prefix
+	if strings.Contains(arg, "/") {
+		var err error
+		if prefix, err = netip.ParsePrefix(arg); err != nil {
+			return nil, fmt.Errorf("ip address %q is not valid: %w", arg, ErrTypeMismatch)
+		}
+	} else {
+		addr, err := netip.ParseAddr(arg)
+		if err != nil || addr.Zone() != "" {
+			return nil, fmt.Errorf("ip address %q is not valid: %w", arg, ErrTypeMismatch)
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
 	}
 
-	ip, cidr, err := net.ParseCIDR(string(arg))
-	if err != nil {
-		return nil, fmt.Errorf("ip address is not valid: %w", ErrTypeMismatch)
-	}
-	if ip == nil {
-		return nil, fmt.Errorf("ip address is not valid: %w", ErrTypeMismatch)
-	}
-
-	return &IpValue{addr: ip, cidr: cidr}, nil
+	return &IpValue{prefix: prefix}, nil
 }
 
 func (v1 *IpValue) TypeName() string {
@@ -35,19 +40,25 @@ func (v1 *IpValue) TypeName() string {
 }
 
 func (v1 *IpValue) String() string {
-	if v1.cidr != nil {
-		return v1.cidr.String()
+	if v1.prefix.IsSingleIP() {
+		return v1.prefix.Addr().String()
 	}
-	return v1.addr.String()
+	return v1.prefix.String()
 }
 
+// OpEqual compares the address and the prefix length, a single address is
+// equal to the range containing only it
 func (v1 *IpValue) OpEqual(input NamedType) (BoolValue, error) {
 	v2, ok := input.(*IpValue)
 	if !ok {
-		return false, fmt.Errorf("expected ip got %s: %w", input.TypeName(), ErrTypeMismatch)
+		return false, nil
 	}
 
-	return BoolValue(v1.cidr == v2.cidr && v1.String() == v2.String()), nil
+	return v1.prefix == v2.prefix, nil
+}
+
+func (v1 *IpValue) HashKey() string {
+	return "ipaddr:" + v1.prefix.String()
 }
 
 func (v1 *IpValue) AsJson() any {
@@ -59,8 +70,44 @@ func (v1 *IpValue) AsJson() any {
 	}
 }
 
+// IsIpv4 reports whether the value is an IPv4 address or range
+func (v1 *IpValue) IsIpv4() bool {
+	return v1.prefix.Addr().Is4()
+}
+
+// IsIpv6 reports whether the value is an IPv6 address or range, including
+// the IPv4-mapped IPv6 addresses
+func (v1 *IpValue) IsIpv6() bool {
+	return v1.prefix.Addr().Is6()
+}
+
+// IsLoopback reports whether all of the addresses of the value are loopback
+// addresses, 127.0.0.0/8 or ::1
+func (v1 *IpValue) IsLoopback() bool {
+	if v1.IsIpv4() {
+		return v1.prefix.Bits() >= 8 && v1.prefix.Addr().IsLoopback()
+	}
+	return v1.prefix.IsSingleIP() && v1.prefix.Addr().IsLoopback()
+}
+
+// IsMulticast reports whether all of the addresses of the value are
+// multicast addresses, 224.0.0.0/4 or ff00::/8
+func (v1 *IpValue) IsMulticast() bool {
+	bits := 8
+	if v1.IsIpv4() {
+		bits = 4
+	}
+	return v1.prefix.Bits() >= bits && v1.prefix.Addr().IsMulticast()
+}
+
+// IsInRange reports whether all of the addresses of the value are in the
+// range, an address is only in a range of the same version
+func (v1 *IpValue) IsInRange(other *IpValue) bool {
+	return v1.prefix.Bits() >= other.prefix.Bits() && other.prefix.Contains(v1.prefix.Addr())
+}
+
 // Internal helper for function to get the type back
-func asNetIp(input NamedType) (*IpValue, error) {
+func asNetIp(input EvalValue) (*IpValue, error) {
 	if input == nil {
 		return nil, fmt.Errorf("expected ip got nil: %w", ErrTypeMismatch)
 	}
@@ -72,37 +119,87 @@ func asNetIp(input NamedType) (*IpValue, error) {
 	return val, nil
 }
 
-// Decimal Value
-type DecimalValue float64
+// Decimal Value, a fixed point number with four fraction digits stored as
+// the number of ten thousandths
+type DecimalValue int64
 
 var _ NamedType = (*DecimalValue)(nil)
 
+// decimalDigits is the maximum number of fraction digits of a decimal, and
+// decimalScale the value of one
+const (
+	decimalDigits = 4
+	decimalScale  = 10000
+)
+
+// NewDecimalValue parses a decimal, it has an optional minus sign, at least
+// one integer digit, a decimal point and between one and four fraction
+// digits. A value outside of the range of a decimal is an overflow.
 func NewDecimalValue(arg string) (DecimalValue, error) {
-	fval, err := strconv.ParseFloat(arg, 64)
-	if err != nil {
-		return 0, fmt.Errorf("unable to parse decimal: %s: %w", err, ErrTypeMismatch)
+	text, negative := strings.CutPrefix(arg, "-")
+	whole, fraction, found := strings.Cut(text, ".")
+	if !found || !isDigits(whole) || !isDigits(fraction) || len(fraction) > decimalDigits {
+		return 0, fmt.Errorf("unable to parse decimal: %q: %w", arg, ErrTypeMismatch)
 	}
 
-	return DecimalValue(fval), nil
+	// The magnitude is accumulated unsigned so the most negative decimal
+	// can be parsed
+	limit := uint64(math.MaxInt64)
+	if negative {
+		limit += 1
+	}
+	var value uint64
+	for i, digits := 0, whole+fraction+strings.Repeat("0", decimalDigits-len(fraction)); i < len(digits); i++ {
+		digit := uint64(digits[i] - '0')
+		if value > (limit-digit)/10 {
+			return 0, fmt.Errorf("decimal %s is out of range: %w", arg, ErrOverflow)
+		}
+		value = value*10 + digit
+	}
+
+	if negative {
+		return DecimalValue(-value), nil
+	}
+	return DecimalValue(value), nil
+}
+
+// isDigits reports whether text is a non empty string of ASCII digits
+func isDigits(text string) bool {
+	for _, ch := range text {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return text != ""
 }
 
 func (v1 DecimalValue) TypeName() string {
 	return "decimal"
 }
 
+// String formats the decimal with four fraction digits, the result can be
+// parsed by NewDecimalValue
 func (v1 DecimalValue) String() string {
-	return fmt.Sprintf("%f", v1)
+	sign, value := "", uint64(v1)
+	if v1 < 0 {
+		sign, value = "-", -value
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, value/decimalScale, decimalDigits, value%decimalScale)
 }
 
 func (v1 DecimalValue) OpEqual(input NamedType) (BoolValue, error) {
 	v2, ok := input.(DecimalValue)
 	if !ok {
-		return false, fmt.Errorf("expected decimal got %s: %w", input.TypeName(), ErrTypeMismatch)
+		return false, nil
 	}
 
 	return v1 == v2, nil
 }
 
+func (v1 DecimalValue) HashKey() string {
+	return "decimal:" + v1.String()
+}
+
 func (v1 DecimalValue) AsJson() any {
 	return map[string]any{
 		"__extn": map[string]string{
@@ -113,14 +210,14 @@ func (v1 DecimalValue) AsJson() any {
 }
 
 // Internal helper for function to get the type back
-func asFloat(input NamedType) (float64, error) {
+func asDecimal(input EvalValue) (DecimalValue, error) {
 	if input == nil {
-		return 0, fmt.Errorf("expected ip got nil: %w", ErrTypeMismatch)
+		return 0, fmt.Errorf("expected decimal got nil: %w", ErrTypeMismatch)
 	}
 	val, ok := input.(DecimalValue)
 	if !ok {
 		return 0, fmt.Errorf("expected decimal got %s: %w", input.TypeName(), ErrTypeMismatch)
 	}
 
-	return float64(val), nil
+	return val, nil
 }
@@ -24,78 +24,32 @@ var functionTable = map[string]Function{
 		return NewIpValue(string(val))
 	},
 	"isIpv4": func(left EvalValue, args []EvalValue) (EvalValue, error) {
-		if len(args) != 0 {
-			return nil, fmt.Errorf("expected no arguments got %d: %w", len(args), ErrTypeMismatch)
-		}
-
-		val, err := asNetIp(left)
-		if err != nil {
-			return nil, err
-		}
-
-		return BoolValue(val.addr.To4() != nil), nil
+		return ipPredicate(left, args, (*IpValue).IsIpv4)
 	},
 	"isIpv6": func(left EvalValue, args []EvalValue) (EvalValue, error) {
-		if len(args) != 0 {
-			return nil, fmt.Errorf("expected no arguments got %d: %w", len(args), ErrTypeMismatch)
-		}
-
-		// val, ok := left.(IpValue)
-		// if !ok {
-		// 	return nil, fmt.Errorf("expected ip got %s: %w", left.TypeName(), ErrTypeMismatch)
-		// }
-
-		// If it parsed, it's v6
-		return BoolValue(true), nil
+		return ipPredicate(left, args, (*IpValue).IsIpv6)
 	},
 	"isLoopback": func(left EvalValue, args []EvalValue) (EvalValue, error) {
-		if len(args) != 0 {
-			return nil, fmt.Errorf("expected no arguments got %d: %w", len(args), ErrTypeMismatch)
-		}
-
-		val, err := asNetIp(left)
-		if err != nil {
-			return nil, err
-		}
-
-		return BoolValue(val.addr.IsLoopback()), nil
+		return ipPredicate(left, args, (*IpValue).IsLoopback)
 	},
 	"isMulticast": func(left EvalValue, args []EvalValue) (EvalValue, error) {
-		if len(args) != 0 {
-			return nil, fmt.Errorf("expected no arguments got %d: %w", len(args), ErrTypeMismatch)
-		}
-
-		val, err := asNetIp(left)
-		if err != nil {
-			return nil, err
-		}
-
-		return BoolValue(val.addr.IsMulticast()), nil
+		return ipPredicate(left, args, (*IpValue).IsMulticast)
 	},
 	"isInRange": func(left EvalValue, args []EvalValue) (EvalValue, error) {
 		if len(args) != 1 {
 			return nil, fmt.Errorf("func[isInRange]: expected one argument got %d: %w", len(args), ErrTypeMismatch)
 		}
 
-		arg, ok := args[0].(*IpValue)
-		if !ok {
-			return nil, fmt.Errorf("func[isInRange]: expected string got %s: %w", arg.TypeName(), ErrTypeMismatch)
-		}
-
-		if arg.cidr == nil {
-			return BoolValue(false), nil
-		}
-
 		val, err := asNetIp(left)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("func[isInRange]: %w", err)
 		}
-
-		if val.cidr != nil {
-			return nil, fmt.Errorf("func[isInRange]: cannot compare cidr address on left: %w", ErrTypeMismatch)
+		arg, err := asNetIp(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("func[isInRange]: %w", err)
 		}
 
-		return BoolValue(arg.cidr.Contains(val.addr)), nil
+		return BoolValue(val.IsInRange(arg)), nil
 	},
 	//
 	// Decmial Functions
@@ -114,174 +68,172 @@ var functionTable = map[string]Function{
 		return NewDecimalValue(string(val))
 	},
 	"lessThan": func(left EvalValue, args []EvalValue) (EvalValue, error) {
+		return compareDecimals(left, args, func(lval, rval DecimalValue) bool { return lval < rval })
+	},
+	"lessThanOrEqual": func(left EvalValue, args []EvalValue) (EvalValue, error) {
+		return compareDecimals(left, args, func(lval, rval DecimalValue) bool { return lval <= rval })
+	},
+	"greaterThan": func(left EvalValue, args []EvalValue) (EvalValue, error) {
+		return compareDecimals(left, args, func(lval, rval DecimalValue) bool { return lval > rval })
+	},
+	"greaterThanOrEqual": func(left EvalValue, args []EvalValue) (EvalValue, error) {
+		return compareDecimals(left, args, func(lval, rval DecimalValue) bool { return lval >= rval })
+	},
+
+	// Set operators
+	"contains": func(left EvalValue, args []EvalValue) (EvalValue, error) {
 		if len(args) != 1 {
 			return nil, fmt.Errorf("expected one argument got %d: %w", len(args), ErrTypeMismatch)
 		}
 
-		arg, ok := args[0].(DecimalValue)
-		if !ok {
-			return nil, fmt.Errorf("expected decimal got %s: %w", arg.TypeName(), ErrTypeMismatch)
-		}
-
-		lval, err := asFloat(left)
-		if err != nil {
-			return nil, err
-		}
-		rval, err := asFloat(arg)
+		lval, err := asSet(left)
 		if err != nil {
 			return nil, err
 		}
 
-		return BoolValue(lval < rval), nil
+		return BoolValue(lval.Contains(args[0])), nil
 	},
-	"lessThanOrEqual": func(left EvalValue, args []EvalValue) (EvalValue, error) {
-		if len(args) != 1 {
-			return nil, fmt.Errorf("expected one argument got %d: %w", len(args), ErrTypeMismatch)
-		}
-
-		arg, ok := args[0].(DecimalValue)
-		if !ok {
-			return nil, fmt.Errorf("expected decimal got %s: %w", arg.TypeName(), ErrTypeMismatch)
-		}
 
-		lval, err := asFloat(left)
-		if err != nil {
-			return nil, err
-		}
-		rval, err := asFloat(arg)
+	"containsAll": func(left EvalValue, args []EvalValue) (EvalValue, error) {
+		lval, rval, err := setArgs(left, args)
 		if err != nil {
 			return nil, err
 		}
 
-		return BoolValue(lval <= rval), nil
+		return BoolValue(lval.ContainsAll(rval)), nil
 	},
-	"greaterThan": func(left EvalValue, args []EvalValue) (EvalValue, error) {
-		if len(args) != 1 {
-			return nil, fmt.Errorf("expected one argument got %d: %w", len(args), ErrTypeMismatch)
-		}
 
-		arg, ok := args[0].(DecimalValue)
-		if !ok {
-			return nil, fmt.Errorf("expected decimal got %s: %w", arg.TypeName(), ErrTypeMismatch)
-		}
-
-		lval, err := asFloat(left)
-		if err != nil {
-			return nil, err
-		}
-		rval, err := asFloat(arg)
+	"containsAny": func(left EvalValue, args []EvalValue) (EvalValue, error) {
+		lval, rval, err := setArgs(left, args)
 		if err != nil {
 			return nil, err
 		}
 
-		return BoolValue(lval > rval), nil
+		return BoolValue(lval.ContainsAny(rval)), nil
 	},
-	"greaterThanOrEqual": func(left EvalValue, args []EvalValue) (EvalValue, error) {
-		if len(args) != 1 {
-			return nil, fmt.Errorf("expected one argument got %d: %w", len(args), ErrTypeMismatch)
-		}
 
-		arg, ok := args[0].(DecimalValue)
-		if !ok {
-			return nil, fmt.Errorf("expected decimal got %s: %w", arg.TypeName(), ErrTypeMismatch)
+	"isEmpty": func(left EvalValue, args []EvalValue) (EvalValue, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("expected no arguments got %d: %w", len(args), ErrTypeMismatch)
 		}
 
-		lval, err := asFloat(left)
-		if err != nil {
-			return nil, err
-		}
-		rval, err := asFloat(arg)
+		lval, err := asSet(left)
 		if err != nil {
 			return nil, err
 		}
 
-		return BoolValue(lval >= rval), nil
+		return BoolValue(len(lval) == 0), nil
 	},
+}
 
-	// Set operators
-	"contains": func(left EvalValue, args []EvalValue) (EvalValue, error) {
-		if len(args) != 1 {
-			return nil, fmt.Errorf("expected one argument got %d: %w", len(args), ErrTypeMismatch)
-		}
-
-		lval, ok := left.(SetValue)
-		if !ok {
-			return nil, fmt.Errorf("expected set got %s: %w", left.TypeName(), ErrTypeMismatch)
-		}
+// storeFunction is a method which reads the entity store
+type storeFunction func(store Store, left EvalValue, args []EvalValue) (EvalValue, error)
 
-		for _, item := range lval {
-			cmp, _ := item.OpEqual(args[0])
-			if cmp {
-				return BoolValue(true), nil
-			}
+var storeFunctionTable = map[string]storeFunction{
+	//
+	// Entity tag Functions
+	//
+	"hasTag": func(store Store, left EvalValue, args []EvalValue) (EvalValue, error) {
+		entity, tag, err := tagArgs(left, args)
+		if err != nil {
+			return nil, err
 		}
 
-		return BoolValue(false), nil
+		return entity.HasTag(tag, store)
 	},
-
-	"containsAll": func(left EvalValue, args []EvalValue) (EvalValue, error) {
-		if len(args) != 1 {
-			return nil, fmt.Errorf("expected one argument got %d: %w", len(args), ErrTypeMismatch)
-		}
-
-		lval, ok := left.(SetValue)
-		if !ok {
-			return nil, fmt.Errorf("expected set got %s: %w", left.TypeName(), ErrTypeMismatch)
-		}
-		rval, ok := args[0].(SetValue)
-		if !ok {
-			return nil, fmt.Errorf("expected set argument got %s: %w", left.TypeName(), ErrTypeMismatch)
+	"getTag": func(store Store, left EvalValue, args []EvalValue) (EvalValue, error) {
+		entity, tag, err := tagArgs(left, args)
+		if err != nil {
+			return nil, err
 		}
 
-		looking := map[NamedType]bool{}
-		for _, item := range rval {
-			looking[item] = true
-		}
+		return entity.GetTag(tag, store)
+	},
+}
 
-		for _, item := range lval {
-			for look := range looking {
-				// Ignore type errors
-				if found, _ := item.OpEqual(look); found {
-					delete(looking, item)
-					break
-				}
-			}
-
-			if len(looking) == 0 {
-				return BoolValue(true), nil
-			}
-		}
+// tagArgs checks the receiver of the tag methods is an entity and the
+// argument is a string
+func tagArgs(left EvalValue, args []EvalValue) (EntityValue, string, error) {
+	if len(args) != 1 {
+		return EntityValue{}, "", fmt.Errorf("expected one argument got %d: %w", len(args), ErrTypeMismatch)
+	}
+
+	if left == nil {
+		return EntityValue{}, "", fmt.Errorf("expected entity got nil: %w", ErrTypeMismatch)
+	}
+	entity, ok := left.(EntityValue)
+	if !ok {
+		return EntityValue{}, "", fmt.Errorf("expected entity got %s: %w", left.TypeName(), ErrTypeMismatch)
+	}
+	tag, ok := args[0].(StrValue)
+	if !ok {
+		return EntityValue{}, "", fmt.Errorf("expected string argument got %s: %w", args[0].TypeName(), ErrTypeMismatch)
+	}
+
+	return entity, string(tag), nil
+}
 
-		return BoolValue(false), nil
-	},
+// asSet checks the receiver of a set method, which is nil when the method
+// is called as a function
+func asSet(input EvalValue) (SetValue, error) {
+	if input == nil {
+		return nil, fmt.Errorf("expected set got nil: %w", ErrTypeMismatch)
+	}
+	val, ok := input.(SetValue)
+	if !ok {
+		return nil, fmt.Errorf("expected set got %s: %w", input.TypeName(), ErrTypeMismatch)
+	}
+
+	return val, nil
+}
 
-	"containsAny": func(left EvalValue, args []EvalValue) (EvalValue, error) {
-		if len(args) != 1 {
-			return nil, fmt.Errorf("expected one argument got %d: %w", len(args), ErrTypeMismatch)
-		}
+// setArgs checks the receiver and the argument of the set methods are sets
+func setArgs(left EvalValue, args []EvalValue) (SetValue, SetValue, error) {
+	if len(args) != 1 {
+		return nil, nil, fmt.Errorf("expected one argument got %d: %w", len(args), ErrTypeMismatch)
+	}
+
+	lval, err := asSet(left)
+	if err != nil {
+		return nil, nil, err
+	}
+	rval, ok := args[0].(SetValue)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected set argument got %s: %w", args[0].TypeName(), ErrTypeMismatch)
+	}
+
+	return lval, rval, nil
+}
 
-		lval, ok := left.(SetValue)
-		if !ok {
-			return nil, fmt.Errorf("expected set got %s: %w", left.TypeName(), ErrTypeMismatch)
-		}
-		rval, ok := args[0].(SetValue)
-		if !ok {
-			return nil, fmt.Errorf("expected set argument got %s: %w", left.TypeName(), ErrTypeMismatch)
-		}
+// ipPredicate implements the ip methods without arguments
+func ipPredicate(left EvalValue, args []EvalValue, predicate func(*IpValue) bool) (EvalValue, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("expected no arguments got %d: %w", len(args), ErrTypeMismatch)
+	}
 
-		looking := map[NamedType]bool{}
-		for _, item := range rval {
-			looking[item] = true
-		}
+	val, err := asNetIp(left)
+	if err != nil {
+		return nil, err
+	}
 
-		for _, item := range lval {
-			for _, look := range rval {
-				if found, _ := item.OpEqual(look); found {
-					return BoolValue(true), nil
-				}
-			}
-		}
+	return BoolValue(predicate(val)), nil
+}
 
-		return BoolValue(false), nil
-	},
+// compareDecimals implements the decimal comparison methods, both the
+// receiver and the argument must be decimals
+func compareDecimals(left EvalValue, args []EvalValue, cmp func(lval, rval DecimalValue) bool) (EvalValue, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected one argument got %d: %w", len(args), ErrTypeMismatch)
+	}
+
+	lval, err := asDecimal(left)
+	if err != nil {
+		return nil, err
+	}
+	rval, err := asDecimal(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return BoolValue(cmp(lval, rval)), nil
 }
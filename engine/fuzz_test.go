@@ -0,0 +1,59 @@
+package engine_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/parser"
+)
+
+func FuzzEval(f *testing.F) {
+	entities := `[
+		{"uid": {"type": "User", "id": "alice"}, "attrs": {"age": 21, "tags": ["a", "b"], "manager": {"__entity": {"type": "User", "id": "bob"}}}, "parents": [{"type": "Group", "id": "staff"}]},
+		{"uid": {"type": "Photo", "id": "a.jpg"}, "attrs": {"owner": {"__entity": {"type": "User", "id": "alice"}}, "size": {"w": 10, "h": 20}}, "parents": []}
+	]`
+	for _, seed := range []struct{ policy, context string }{
+		{`permit(principal, action, resource);`, `{}`},
+		{`permit(principal in Group::"staff", action == Action::"view", resource) when { resource.owner == principal };`, `{}`},
+		{`forbid(principal, action, resource) unless { context.mfa && principal.age >= 18 };`, `{"mfa": true}`},
+		{`permit(principal, action, resource) when { principal.tags.contains("a") && resource.size.w * 2 < resource.size.h };`, `{}`},
+		{`permit(principal, action, resource) when { if context has ip then ip(context.ip).isLoopback() else principal.manager.age > 30 };`, `{"ip": "127.0.0.1"}`},
+		{`permit(principal, action, resource) when { decimal(context.d).lessThan(decimal("1.5")) || resource.name like "*.jpg" };`, `{"d": "1.25"}`},
+		{`permit(principal, action, resource) when { {a: [1, -2], b: principal}.b in Group::"staff" };`, `{}`},
+		{`permit(principal, action, resource) when { isEmpty() || contains(1) || containsAll([1]) || containsAny([1]) };`, `{}`},
+		{`permit(principal, action, resource) when { hasTag("a") && getTag("a") == 1 };`, `{}`},
+	} {
+		f.Add(seed.policy, entities, seed.context)
+	}
+
+	f.Fuzz(func(t *testing.T, policy, entities, contextJson string) {
+		policies, err := parser.ParseRules(policy)
+		if err != nil {
+			return
+		}
+		store, err := cedar.StoreFromJson(strings.NewReader(entities), nil)
+		if err != nil {
+			return
+		}
+		var input map[string]any
+		if err := json.Unmarshal([]byte(contextJson), &input); err != nil {
+			return
+		}
+		vars, err := cedar.NewContextFromMap(input)
+		if err != nil {
+			return
+		}
+
+		// Errors are expected, the evaluation is only required not to panic
+		auth := cedar.NewAuthorizer(policies, cedar.WithStore(store))
+		auth.IsAuthorizedDetail(context.TODO(), &cedar.Request{
+			Principal: cedar.NewEntity("User", "alice"),
+			Action:    cedar.NewEntity("Action", "view"),
+			Resource:  cedar.NewEntity("Photo", "a.jpg"),
+			Context:   vars,
+		})
+	})
+}
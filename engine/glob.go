@@ -7,72 +7,91 @@ import (
 // The character which is treated like a glob
 const GLOB = "*"
 
-// Glob will test a string pattern, potentially containing globs, against a
-// subject string. The result is a simple true/false, determining whether or
-// not the glob pattern matched the subject text.
-func Glob(pattern, subj string) bool {
-	// Empty pattern can only match empty subject
-	if pattern == "" {
-		return subj == pattern
-	}
-
-	// If the pattern _is_ a glob, it matches everything
-	if pattern == GLOB {
-		return true
-	}
+// Pattern is a compiled `like` pattern, it is the literal text between each
+// of the wildcards.
+type Pattern struct {
+	parts []string
+}
 
+// CompilePattern compiles the text of a pattern, a '*' is a wildcard while
+// `\*` and `\\` are a literal star and backslash.
+func CompilePattern(pattern string) *Pattern {
 	parts := []string{}
 
+	var accum strings.Builder
 	inEscape := false
-	accum := ""
 	for _, ch := range pattern {
 		if inEscape {
 			inEscape = false
-			accum += string(ch)
+			if ch != '*' && ch != '\\' {
+				// not an escape, keep the backslash
+				accum.WriteByte('\\')
+			}
+			accum.WriteRune(ch)
 		} else if ch == '*' {
-			parts = append(parts, accum)
-			accum = ""
+			parts = append(parts, accum.String())
+			accum.Reset()
 		} else if ch == '\\' {
 			inEscape = true
 		} else {
-			accum += string(ch)
+			accum.WriteRune(ch)
 		}
 	}
 	if inEscape {
-		accum += "\\"
+		accum.WriteByte('\\')
 	}
-	parts = append(parts, accum)
+	parts = append(parts, accum.String())
+
+	return &Pattern{parts: parts}
+}
 
-	if len(parts) == 1 {
+// Match reports whether the subject matches the pattern
+func (p *Pattern) Match(subj string) bool {
+	if len(p.parts) == 1 {
 		// No globs in pattern, so test for equality
-		return subj == parts[0]
+		return subj == p.parts[0]
 	}
 
-	end := len(parts) - 1
-	leadingGlob := parts[0] == ""
-	trailingGlob := parts[end] == ""
-
-	// Go over the leading parts and ensure they match.
-	for i := 0; i < end; i++ {
-		idx := strings.Index(subj, parts[i])
+	// The first section is anchored to the start
+	if !strings.HasPrefix(subj, p.parts[0]) {
+		return false
+	}
+	subj = subj[len(p.parts[0]):]
 
-		switch i {
-		case 0:
-			// Check the first section. Requires special handling.
-			if !leadingGlob && idx != 0 {
-				return false
-			}
-		default:
-			// Check that the middle parts match.
-			if idx < 0 {
-				return false
-			}
+	// The middle sections match at their leftmost position, which leaves
+	// the most text for the sections that follow.
+	end := len(p.parts) - 1
+	for _, part := range p.parts[1:end] {
+		idx := strings.Index(subj, part)
+		if idx < 0 {
+			return false
 		}
+		subj = subj[idx+len(part):]
+	}
+
+	// The last section is anchored to the end
+	return strings.HasSuffix(subj, p.parts[end])
+}
+
+// Parts returns the literal text between the wildcards, a pattern without
+// wildcards has a single part
+func (p *Pattern) Parts() []string {
+	return append([]string{}, p.parts...)
+}
 
-		// Trim evaluated text from subj as we loop over the pattern.
-		subj = subj[idx+len(parts[i]):]
+// String returns the pattern text
+func (p *Pattern) String() string {
+	parts := make([]string, len(p.parts))
+	for i, part := range p.parts {
+		part = strings.ReplaceAll(part, `\`, `\\`)
+		parts[i] = strings.ReplaceAll(part, `*`, `\*`)
 	}
+	return strings.Join(parts, GLOB)
+}
 
-	// Reached the last section. Requires special handling.
-	return trailingGlob || strings.HasSuffix(subj, parts[end])
+// Glob will test a string pattern, potentially containing globs, against a
+// subject string. The result is a simple true/false, determining whether or
+// not the glob pattern matched the subject text.
+func Glob(pattern, subj string) bool {
+	return CompilePattern(pattern).Match(subj)
 }
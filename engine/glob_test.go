@@ -3,6 +3,7 @@ package engine_test
 import (
 	"fmt"
 	"testing"
+	"unicode/utf8"
 
 	ast "github.com/koblas/cedar-go/engine"
 	"github.com/stretchr/testify/assert"
@@ -49,3 +50,94 @@ func TestGlob(t *testing.T) {
 		})
 	}
 }
+
+func TestCompilePattern(t *testing.T) {
+	pattern := ast.CompilePattern(`a\*b*c\\`)
+
+	assert.True(t, pattern.Match(`a*bxxc\`))
+	assert.False(t, pattern.Match(`axbxxc\`))
+	assert.Equal(t, `a\*b*c\\`, pattern.String())
+}
+
+// patternElem is a character or, when wildcard is set, a '*'
+type patternElem struct {
+	wildcard bool
+	ch       rune
+}
+
+func referenceElems(pattern string) []patternElem {
+	elems := []patternElem{}
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '*':
+			elems = append(elems, patternElem{wildcard: true})
+		case runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == '*' || runes[i+1] == '\\'):
+			i += 1
+			elems = append(elems, patternElem{ch: runes[i]})
+		default:
+			elems = append(elems, patternElem{ch: runes[i]})
+		}
+	}
+	return elems
+}
+
+// referenceMatch is the wildcard matching algorithm of the Rust
+// implementation of Cedar, which works on characters with backtracking.
+func referenceMatch(pattern []patternElem, input string) bool {
+	if len(pattern) == 0 {
+		return input == ""
+	}
+	text := []rune(input)
+
+	i, j := 0, 0
+	starIdx, tmpIdx := 0, 0
+	containsStar := false
+	for i < len(text) && (!containsStar || starIdx != len(pattern)-1) {
+		if j < len(pattern) && pattern[j].wildcard {
+			containsStar = true
+			starIdx = j
+			tmpIdx = i
+			j += 1
+		} else if j < len(pattern) && pattern[j].ch == text[i] {
+			i += 1
+			j += 1
+		} else if containsStar {
+			j = starIdx + 1
+			i = tmpIdx + 1
+			tmpIdx = i
+		} else {
+			return false
+		}
+	}
+	for j < len(pattern) && pattern[j].wildcard {
+		j += 1
+	}
+	return j == len(pattern)
+}
+
+func FuzzPattern(f *testing.F) {
+	f.Add("ham*", "ham and eggs")
+	f.Add("*h*a*m*", "ham")
+	f.Add("a*a", "a")
+	f.Add("*ab*b", "abab")
+	f.Add(`string\*with\*stars`, "string*with*stars")
+	f.Add(`\\*`, `\afterslash`)
+	f.Add("**", "")
+	f.Add("*é*", "café")
+
+	f.Fuzz(func(t *testing.T, pattern, subj string) {
+		if !utf8.ValidString(pattern) || !utf8.ValidString(subj) {
+			t.Skip()
+		}
+		compiled := ast.CompilePattern(pattern)
+		expect := referenceMatch(referenceElems(pattern), subj)
+
+		if got := compiled.Match(subj); got != expect {
+			t.Fatalf("%q like %q: got %v expected %v", subj, pattern, got, expect)
+		}
+		if got := ast.CompilePattern(compiled.String()).Match(subj); got != expect {
+			t.Fatalf("%q like %q (%q): got %v expected %v", subj, pattern, compiled.String(), got, expect)
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package engine
+
+// PolicyIndex slices a policy list by the principal type, action and
+// resource type found in the policy scopes. During evaluation only the
+// policies which could apply to the request are evaluated.
+type PolicyIndex struct {
+	policies PolicyList
+
+	principals scopeIndex
+	actions    scopeIndex
+	resources  scopeIndex
+}
+
+// scopeIndex maps a key to the positions of the policies constrained to it,
+// policies without a usable constraint are in any.
+type scopeIndex struct {
+	keyed map[string][]int
+	any   []int
+}
+
+func (s *scopeIndex) add(keys []string, idx int) {
+	if keys == nil {
+		s.any = append(s.any, idx)
+		return
+	}
+	for _, key := range keys {
+		s.keyed[key] = append(s.keyed[key], idx)
+	}
+}
+
+// mark increments the count of each candidate policy
+func (s *scopeIndex) mark(key string, counts []int) {
+	for _, idx := range s.any {
+		counts[idx] += 1
+	}
+	for _, idx := range s.keyed[key] {
+		counts[idx] += 1
+	}
+}
+
+// typeKeys returns the entity types a principal or resource constraint is
+// limited to, nil for any type.  The `in` operator can match entities of any
+// type so only `==` and `is` are used.
+func typeKeys(c ScopeConstraint) []string {
+	if c.IsType != "" {
+		return []string{c.IsType}
+	}
+	if c.Op == OpEql && !c.Slot && len(c.Entities) == 1 {
+		return []string{c.Entities[0].EntityType()}
+	}
+	return nil
+}
+
+// actionKeys returns the actions the constraint is limited to, nil for any.
+// Action groups are resolved at runtime so only `==` is used.
+func actionKeys(c ScopeConstraint) []string {
+	if c.Op == OpEql && len(c.Entities) == 1 {
+		return []string{c.Entities[0].String()}
+	}
+	return nil
+}
+
+func entityTypeKey(v EntityValue) string {
+	return v.EntityType()
+}
+
+// NewPolicyIndex builds the index for the list of policies
+func NewPolicyIndex(p PolicyList) *PolicyIndex {
+	idx := PolicyIndex{
+		policies:   p,
+		principals: scopeIndex{keyed: map[string][]int{}},
+		actions:    scopeIndex{keyed: map[string][]int{}},
+		resources:  scopeIndex{keyed: map[string][]int{}},
+	}
+
+	for pos, policy := range p {
+		scope := policy.Scope()
+		idx.principals.add(typeKeys(scope.Principal), pos)
+		idx.actions.add(actionKeys(scope.Action), pos)
+		idx.resources.add(typeKeys(scope.Resource), pos)
+	}
+
+	return &idx
+}
+
+// IsFor reports whether the index was built for this policy list
+func (idx *PolicyIndex) IsFor(p PolicyList) bool {
+	if idx == nil || len(idx.policies) != len(p) {
+		return false
+	}
+	return len(p) == 0 || &idx.policies[0] == &p[0]
+}
+
+// Candidates returns a mask of the policies which could apply to the request
+func (idx *PolicyIndex) Candidates(principal, action, resource EntityValue) []bool {
+	counts := make([]int, len(idx.policies))
+	idx.principals.mark(entityTypeKey(principal), counts)
+	idx.actions.mark(actionKey(action), counts)
+	idx.resources.mark(entityTypeKey(resource), counts)
+
+	mask := make([]bool, len(counts))
+	for pos, count := range counts {
+		mask[pos] = count == 3
+	}
+
+	return mask
+}
+
+// ForResourceType returns a mask of the policies which could apply to a
+// request for the action on a resource of the given type, from any principal
+func (idx *PolicyIndex) ForResourceType(action EntityValue, resourceType string) []bool {
+	counts := make([]int, len(idx.policies))
+	idx.actions.mark(actionKey(action), counts)
+	idx.resources.mark(resourceType, counts)
+
+	mask := make([]bool, len(counts))
+	for pos, count := range counts {
+		mask[pos] = count == 2
+	}
+
+	return mask
+}
+
+func actionKey(action EntityValue) string {
+	if action.IsZero() {
+		return ""
+	}
+	return action.String()
+}
@@ -0,0 +1,88 @@
+package engine_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/koblas/cedar-go"
+	ast "github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyIndex(t *testing.T) {
+	policies, err := parser.ParseRules(`
+	permit(principal == User::"alice", action == Action::"view", resource);
+	permit(principal == Admin::"root", action, resource == Photo::"a.jpg");
+	permit(principal in Group::"staff", action in [Action::"view", Action::"edit"], resource);
+	forbid(principal, action == Action::"delete", resource == Album::"private");
+	`)
+	require.NoError(t, err)
+
+	index := ast.NewPolicyIndex(policies)
+	assert.True(t, index.IsFor(policies))
+	assert.False(t, index.IsFor(policies[1:]))
+
+	mask := index.Candidates(
+		ast.NewEntityValue("User", "bob"),
+		ast.NewEntityValue("Action", "view"),
+		ast.NewEntityValue("Photo", "a.jpg"),
+	)
+	assert.Equal(t, []bool{true, false, true, false}, mask)
+
+	mask = index.Candidates(
+		ast.NewEntityValue("Admin", "root"),
+		ast.NewEntityValue("Action", "delete"),
+		ast.NewEntityValue("Album", "private"),
+	)
+	assert.Equal(t, []bool{false, false, true, true}, mask)
+}
+
+func TestPolicyIndexEval(t *testing.T) {
+	policies, err := parser.ParseRules(`
+	@id("alice")
+	permit(principal == User::"alice", action == Action::"view", resource);
+	@id("bob")
+	permit(principal == User::"bob", action == Action::"view", resource);
+	@id("admin")
+	permit(principal == Admin::"root", action, resource);
+	`)
+	require.NoError(t, err)
+
+	detail, err := cedar.NewAuthorizer(policies).IsAuthorizedDetail(context.TODO(), &cedar.Request{
+		Principal: ast.NewEntityValue("User", "bob"),
+		Action:    ast.NewEntityValue("Action", "view"),
+		Resource:  ast.NewEntityValue("Photo", "a.jpg"),
+	})
+	require.NoError(t, err)
+	assert.True(t, detail.IsAllowed)
+	assert.Equal(t, []string{"bob"}, detail.Diagnostics.Permits)
+	assert.Equal(t, []string{"alice", "admin"}, detail.Diagnostics.Skipped)
+}
+
+func BenchmarkPolicyIndex(b *testing.B) {
+	rules := strings.Builder{}
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&rules, "permit(principal == User::\"u%d\", action == Action::\"a%d\", resource == Doc%d::\"x\") when { context.ok };\n", i, i%50, i%20)
+	}
+	policies, err := parser.ParseRules(rules.String())
+	require.NoError(b, err)
+
+	auth := cedar.NewAuthorizer(policies)
+	req := &cedar.Request{
+		Principal: ast.NewEntityValue("User", "u1234"),
+		Action:    ast.NewEntityValue("Action", "a34"),
+		Resource:  ast.NewEntityValue("Doc14", "x"),
+		Context:   ast.NewVarValue(map[string]ast.NamedType{"ok": ast.BoolValue(true)}),
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if ok, err := auth.IsAuthorized(context.TODO(), req); err != nil || !ok {
+			b.Fatal("expected allow", err)
+		}
+	}
+}
@@ -2,7 +2,11 @@ package engine
 
 import (
 	"context"
-	"strings"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
 )
 
 type EntityRef struct {
@@ -15,17 +19,32 @@ type Request struct {
 	Ctx context.Context
 	// Scope properties
 	Store   Store
+	Schema  AttributeSchema
 	Context *VarValue
 	// request properties
 	Principal EntityValue
 	Resource  EntityValue
 	Action    EntityValue
 
+	// Index when built for the policy list limits evaluation to the
+	// policies that could apply to the request
+	Index *PolicyIndex
+	// Compiled when built for the policy list is evaluated in place of
+	// walking the policies
+	Compiled *CompiledPolicies
+
 	// Slot Variables (e.g. runtime variables)
 	SlotPrincipal NamedType
 	SlotResource  NamedType
 
-	Trace bool // print debugging
+	// Deprecated: use Tracer, Trace prints a text trace to stdout
+	Trace bool
+	// Tracer when set receives the events of the evaluation
+	Tracer Tracer
+	// Coverage when set records the outcomes of the evaluation
+	Coverage *Coverage
+	// Limits bounds the work of the evaluation
+	Limits EvalLimits
 }
 
 type Decision int
@@ -42,23 +61,125 @@ func (d Decision) String() string {
 	return "Deny"
 }
 
+// PolicyError records the error raised while evaluating a policy
+type PolicyError struct {
+	PolicyId string
+	// Filename is the file the policy was parsed from, if it was named
+	Filename string
+	Err      error
+}
+
+func (e PolicyError) Error() string {
+	if e.Filename != "" {
+		return fmt.Sprintf("policy %s in %s: %s", e.PolicyId, e.Filename, e.Err)
+	}
+	return fmt.Sprintf("policy %s: %s", e.PolicyId, e.Err)
+}
+
+func (e PolicyError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorPosition is the location of the failing expression in the policy source
+type ErrorPosition struct {
+	Filename string `json:"filename,omitempty"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Offset   int    `json:"offset"`
+}
+
+// ErrorDetail is the structured form of a PolicyError
+type ErrorDetail struct {
+	PolicyId string         `json:"policyId"`
+	Filename string         `json:"filename,omitempty"`
+	Message  string         `json:"message"`
+	Position *ErrorPosition `json:"position,omitempty"`
+	Expr     string         `json:"expr,omitempty"`
+	Op       string         `json:"op,omitempty"`
+	Operands []string       `json:"operandTypes,omitempty"`
+}
+
+// Detail breaks the error down into its parts, the message is the
+// underlying cause without the position prefix.
+func (e PolicyError) Detail() ErrorDetail {
+	detail := ErrorDetail{
+		PolicyId: e.PolicyId,
+		Filename: e.Filename,
+	}
+	if e.Err != nil {
+		detail.Message = e.Err.Error()
+	}
+
+	var evalErr *EvalError
+	if errors.As(e.Err, &evalErr) {
+		if evalErr.Cause != nil {
+			detail.Message = evalErr.Cause.Error()
+		}
+		if evalErr.Position.IsValid() {
+			detail.Position = &ErrorPosition{
+				Filename: evalErr.Position.Filename,
+				Line:     evalErr.Position.Line,
+				Column:   evalErr.Position.Column,
+				Offset:   evalErr.Position.Offset,
+			}
+		}
+		detail.Expr = evalErr.Expr
+		detail.Op = evalErr.Op
+		detail.Operands = evalErr.Operands
+	}
+
+	return detail
+}
+
+func (e PolicyError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.Detail())
+}
+
+// Diagnostics describes the contribution of each policy to the decision
+type Diagnostics struct {
+	// Permit policies that were satisfied
+	Permits []string `json:"permits"`
+	// Forbid policies that were satisfied
+	Forbids []string `json:"forbids"`
+	// Policies which failed to evaluate
+	Errors []PolicyError `json:"errors"`
+	// Policies where the scope or conditions did not match the request
+	Skipped []string `json:"skipped"`
+	// Provenance of the policies which matched or failed, keyed by the
+	// policy id, for those with a source file, version or creation time
+	Provenance map[string]Provenance `json:"provenance,omitempty"`
+}
+
+// Result is the outcome of Eval. The policies are evaluated in the order of
+// the PolicyList, so Reasons and the lists of the Diagnostics are in that
+// order, for parsed policies the order of the source, and the same for every
+// evaluation of the request.
 type Result struct {
 	Decision     Decision
 	RulesMatched bool
 	Reasons      []string
+	Diagnostics  Diagnostics
 }
 
 func (e EntityRef) ToValue() EntityValue {
-	parts := strings.Split(e.Type, "::")
-	parts = append(parts, e.Id)
+	return NewEntityValue(e.Type, e.Id)
+}
 
-	return EntityValue(parts)
+// runtimePool reuses the state of the evaluations, a request is evaluated
+// for every authorization so this saves its allocations
+var runtimePool = sync.Pool{
+	New: func() any { return &RuntimeRequest{} },
 }
 
-func Eval(ctx context.Context, p PolicyList, request *Request) (*Result, error) {
-	runtime := RuntimeRequest{
+// newRuntime prepares the evaluation of the request, release returns it to
+// the pool once the evaluation is done
+func newRuntime(ctx context.Context, request *Request) *RuntimeRequest {
+	runtime := runtimePool.Get().(*RuntimeRequest)
+	memo := runtime.memo
+
+	*runtime = RuntimeRequest{
 		Ctx:            ctx,
-		Store:          request.Store,
+		Schema:         request.Schema,
 		Context:        request.Context,
 		principalValue: request.Principal,
 		resourceValue:  request.Resource,
@@ -66,11 +187,49 @@ func Eval(ctx context.Context, p PolicyList, request *Request) (*Result, error)
 		principalSlot:  request.SlotPrincipal,
 		resourceSlot:   request.SlotResource,
 		functionTable:  functionTable,
-		Trace:          request.Trace,
+		coverage:       request.Coverage,
+		tracer:         request.Tracer,
+		budget:         budget{limits: request.Limits},
+		memo:           memo,
+	}
+	if request.Store != nil {
+		runtime.memo.reset(ctx, &runtime.budget, request.Store)
+		runtime.Store = &runtime.memo
+	}
+	if runtime.tracer == nil && request.Trace {
+		runtime.tracer = NewTextTracer(os.Stdout)
 	}
 
-	result, err := p.evalNode(&runtime)
-	if err != nil {
+	return runtime
+}
+
+// release returns the runtime to the pool, nothing may refer to it after
+func (r *RuntimeRequest) release() {
+	memo := r.memo
+	memo.release()
+	*r = RuntimeRequest{memo: memo}
+	runtimePool.Put(r)
+}
+
+func Eval(ctx context.Context, p PolicyList, request *Request) (*Result, error) {
+	var candidates []bool
+	if request.Index.IsFor(p) {
+		candidates = request.Index.Candidates(request.Principal, request.Action, request.Resource)
+	}
+
+	runtime := newRuntime(ctx, request)
+	defer runtime.release()
+	runtime.candidates = candidates
+	// The tracer and coverage follow each expression of the policies
+	if request.Compiled.IsFor(p) && runtime.tracer == nil && runtime.coverage == nil {
+		runtime.compiled = request.Compiled
+	}
+
+	// Policy errors are reported in the diagnostics, the decision is
+	// made from the policies which evaluated successfully. There is no
+	// result when the context was done before all of them were evaluated.
+	result, err := p.evalNode(runtime)
+	if result == nil {
 		return nil, err
 	}
 
@@ -79,9 +238,24 @@ func Eval(ctx context.Context, p PolicyList, request *Request) (*Result, error)
 		decision = Allow
 	}
 
-	return &Result{
+	output := Result{
 		Decision:     decision,
 		RulesMatched: result.Evaluated,
 		Reasons:      result.RulesMatched,
-	}, nil
+		Diagnostics:  result.Diagnostics,
+	}
+	if runtime.tracer != nil {
+		runtime.tracer.OnDecision(&output)
+	}
+
+	return &output, nil
+}
+
+// EvalExpr evaluates a single expression with the variables of the request,
+// the tracer of the request receives the evaluation of the expression
+func EvalExpr(ctx context.Context, node EvalNode, request *Request) (EvalValue, error) {
+	runtime := newRuntime(ctx, request)
+	defer runtime.release()
+
+	return runtime.eval(node)
 }
@@ -9,7 +9,7 @@ import (
 var ErrInvalidJsonNode = errors.New("node doesn't support json")
 
 type jsonBuilder interface {
-	ToJson() any
+	ToJson() (any, error)
 }
 
 // General types
@@ -48,38 +48,54 @@ type JsonCondition struct {
 }
 
 type JsonPolicy struct {
-	Effect      string            `json:"effect"`
-	Principal   *JsonVariable     `json:"principal"`
-	Action      *JsonVariable     `json:"action"`
-	Resource    *JsonVariable     `json:"resource"`
-	Conditions  []*JsonCondition  `json:"conditions,omitempty"`
-	Annotations map[string]string `json:"annotations,omitempty"`
+	Effect      string           `json:"effect"`
+	Principal   *JsonVariable    `json:"principal"`
+	Action      *JsonVariable    `json:"action"`
+	Resource    *JsonVariable    `json:"resource"`
+	Conditions  []*JsonCondition `json:"conditions,omitempty"`
+	Annotations *JsonAnnotations `json:"annotations,omitempty"`
 }
 
-// / -------
-func (n *ValueNode) ToJson() any {
-	if value, ok := n.Value.(BoolValue); ok {
-		return value
-	}
-	if value, ok := n.Value.(StrValue); ok {
-		return value
-	}
-	if value, ok := n.Value.(IntValue); ok {
-		return value
+// jsonError reports a node which can't be converted
+func jsonError(node Node) error {
+	if node == nil {
+		return fmt.Errorf("missing expression: %w", ErrInvalidJsonNode)
 	}
-	if value, ok := n.Value.(EntityValue); ok {
-		return value.String()
+	return fmt.Errorf("%s: %T: %w", node.Pos(), node, ErrInvalidJsonNode)
+}
+
+// exprJson converts an expression which is expected to be a jsonBuilder
+func exprJson(node EvalNode) (any, error) {
+	builder, ok := node.(jsonBuilder)
+	if !ok || builder == nil {
+		return nil, jsonError(node)
 	}
-	if _, ok := n.Value.(SetValue); ok {
-		// values := []any{}
-		panic("not implemented")
-		// for _, item := range value {
-		// 	values = append(values, item.ToJson())
-		// }
-		// return values
+	return builder.ToJson()
+}
+
+func listJson(nodes []EvalNode) ([]any, error) {
+	output := make([]any, 0, len(nodes))
+	for _, item := range nodes {
+		value, err := exprJson(item)
+		if err != nil {
+			return nil, err
+		}
+		output = append(output, value)
 	}
+	return output, nil
+}
 
-	panic(fmt.Sprintf("invalid result type %v", n))
+// / -------
+func (n *ValueNode) ToJson() (any, error) {
+	switch value := n.Value.(type) {
+	case BoolValue, StrValue, IntValue:
+		return value, nil
+	case EntityValue:
+		return value.String(), nil
+	case nil:
+		return nil, jsonError(n)
+	}
+	return n.Value.AsJson(), nil
 }
 
 func (n *EntityRef) ToJson() *JsonEntityType {
@@ -89,82 +105,150 @@ func (n *EntityRef) ToJson() *JsonEntityType {
 	}
 }
 
-func (n *UnaryExpr) ToJson() any {
-	arg, _ := n.Left.(jsonBuilder)
-	if arg == nil {
-		panic(fmt.Sprintf("left expr no ToJson %T", n.Left))
+func (n *Reference) ToJson() (any, error) {
+	return &JsonExpr{"Var": n.Source.String()}, nil
+}
+
+func (n *Identifier) ToJson() (any, error) {
+	return n.Value, nil
+}
+
+func (n *UnaryExpr) ToJson() (any, error) {
+	arg, err := exprJson(n.Left)
+	if err != nil {
+		return nil, err
 	}
 	return &JsonExpr{
 		n.Op.String(): map[string]any{
-			"arg": arg.ToJson(),
+			"arg": arg,
 		},
-	}
+	}, nil
 }
 
-func (n *BinaryExpr) ToJson() any {
-	left, _ := n.Left.(jsonBuilder)
-	right, _ := n.Right.(jsonBuilder)
-	if left == nil {
-		panic(fmt.Sprintf("left expr no ToJson %T", n.Left))
+func (n *BinaryExpr) ToJson() (any, error) {
+	left, err := exprJson(n.Left)
+	if err != nil {
+		return nil, err
 	}
-	if right == nil {
-		panic(fmt.Sprintf("right expr no ToJson %T", n.Right))
+	right, err := exprJson(n.Right)
+	if err != nil {
+		return nil, err
 	}
 	return &JsonExpr{
 		n.Op.String(): map[string]any{
-			"left":  left.ToJson(),
-			"right": right.ToJson(),
+			"left":  left,
+			"right": right,
+		},
+	}, nil
+}
+
+func (n *IfExpr) ToJson() (any, error) {
+	values, err := listJson([]EvalNode{n.If, n.Then, n.Else})
+	if err != nil {
+		return nil, err
+	}
+	return &JsonExpr{
+		"if-then-else": map[string]any{
+			"if":   values[0],
+			"then": values[1],
+			"else": values[2],
 		},
+	}, nil
+}
+
+func (n *ListExpr) ToJson() (any, error) {
+	values, err := listJson(n.Exprs)
+	if err != nil {
+		return nil, err
 	}
+	return &JsonExpr{"Set": values}, nil
 }
 
-func (n *PolicyCondition) ToJson() *JsonCondition {
-	var expr JsonExpr
-	if b, ok := n.Expr.(jsonBuilder); ok {
-		value := b.ToJson()
-		if value, ok := value.(map[string]any); ok {
-			expr = value
-		} else {
-			panic(fmt.Sprintf("invalid ToJson return %v", n.Expr))
+func (n *VariableDef) ToJson() (any, error) {
+	values := map[string]any{}
+	for _, item := range n.Pairs {
+		value, err := exprJson(item.Value)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		panic(fmt.Sprintf("Missing ToJson %v", n.Expr))
+		values[item.Key] = value
+	}
+	return &JsonExpr{"Record": values}, nil
+}
+
+// ToJson of a function call has the receiver of a method as the first
+// argument
+func (n *FunctionCall) ToJson() (any, error) {
+	args := n.Args
+	if n.Self != nil {
+		args = append([]EvalNode{n.Self}, args...)
+	}
+	values, err := listJson(args)
+	if err != nil {
+		return nil, err
+	}
+	return &JsonExpr{n.Name: values}, nil
+}
+
+func (n *PolicyCondition) ToJson() (*JsonCondition, error) {
+	value, err := exprJson(n.Expr)
+	if err != nil {
+		return nil, err
+	}
+
+	var expr JsonExpr
+	switch value := value.(type) {
+	case *JsonExpr:
+		expr = *value
+	default:
+		expr = JsonExpr{"Value": value}
 	}
 
 	return &JsonCondition{
 		Kind: n.Condition.String(),
 		Body: expr,
-	}
+	}, nil
 }
 
 // func (n *PolicyStmt) ToJson() *JsonPolicy {
-func (n *Policy) ToJson() any {
+func (n *Policy) ToJson() (any, error) {
 	var conditions []*JsonCondition
 	for _, item := range n.Conditions {
-		conditions = append(conditions, item.ToJson())
+		value, err := item.ToJson()
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %w", n.Id, err)
+		}
+		conditions = append(conditions, value)
 	}
 
 	return &JsonPolicy{
 		Effect:      n.Effect.String(),
 		Conditions:  conditions,
-		Annotations: n.Annotations,
-	}
+		Annotations: n.jsonAnnotations(),
+	}, nil
 }
 
-func (n PolicyList) ToJson() any {
+func (n PolicyList) ToJson() (any, error) {
 	result := []any{}
 
 	for _, item := range n {
-		result = append(result, item.ToJson())
+		value, err := item.ToJson()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
 	}
 
-	return result
+	return result, nil
 }
 
 /// ------
 
 func ToJson(policies PolicyList) ([]byte, error) {
-	data := policies.ToJson()
+	data, err := policies.ToJson()
+	if err != nil {
+		return nil, err
+	}
 
 	return json.Marshal(data)
 }
@@ -0,0 +1,52 @@
+package engine_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	ast "github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToJson(t *testing.T) {
+	policies, err := parser.ParseRules(`
+	@id("photos")
+	permit(principal, action, resource)
+	when { resource.tags.containsAny(["a", "b"]) && context.size < 10 }
+	unless { if context.admin then false else {ok: true}.ok };
+	`)
+	require.NoError(t, err)
+
+	data, err := ast.ToJson(policies)
+	require.NoError(t, err)
+
+	var output []map[string]any
+	require.NoError(t, json.Unmarshal(data, &output))
+	require.Len(t, output, 1)
+	assert.Equal(t, "permit", output[0]["effect"])
+
+	conditions := output[0]["conditions"].([]any)
+	require.Len(t, conditions, 2)
+	assert.Contains(t, string(data), `"containsAny":[`)
+	assert.Contains(t, string(data), `"Set":["a","b"]`)
+	assert.Contains(t, string(data), `"if-then-else"`)
+	assert.Contains(t, string(data), `"Record":{"ok":true}`)
+}
+
+func TestToJsonError(t *testing.T) {
+	policy := &ast.Policy{
+		Id:     "broken",
+		Effect: ast.EffectPermit,
+		Conditions: []*ast.PolicyCondition{
+			{Condition: ast.ConditionWhen, Expr: &ast.BinaryExpr{Op: ast.OpLand}},
+		},
+	}
+
+	assert.NotPanics(t, func() {
+		_, err := ast.ToJson(ast.PolicyList{policy})
+		assert.ErrorIs(t, err, ast.ErrInvalidJsonNode)
+		assert.ErrorContains(t, err, "broken")
+	})
+}
@@ -0,0 +1,45 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrEvalBudgetExceeded = errors.New("evaluation budget exceeded")
+
+// EvalLimits bounds the work of an evaluation so that a policy can't use
+// unbounded CPU, a zero limit is unlimited. Once a limit is reached the
+// evaluation stops with an error wrapping ErrEvalBudgetExceeded.
+type EvalLimits struct {
+	// MaxExprNodes is the number of expressions evaluated across all of
+	// the policies
+	MaxExprNodes int
+	// MaxStoreCalls is the number of calls to the store, a repeated lookup
+	// of the same value is only counted once
+	MaxStoreCalls int
+}
+
+// budget counts the work of an evaluation against its limits
+type budget struct {
+	limits     EvalLimits
+	exprNodes  int
+	storeCalls int
+	// exceeded is set once a limit is reached
+	exceeded error
+}
+
+func (b *budget) expr() error {
+	b.exprNodes += 1
+	if b.limits.MaxExprNodes > 0 && b.exprNodes > b.limits.MaxExprNodes && b.exceeded == nil {
+		b.exceeded = fmt.Errorf("more than %d expressions: %w", b.limits.MaxExprNodes, ErrEvalBudgetExceeded)
+	}
+	return b.exceeded
+}
+
+func (b *budget) store() error {
+	b.storeCalls += 1
+	if b.limits.MaxStoreCalls > 0 && b.storeCalls > b.limits.MaxStoreCalls && b.exceeded == nil {
+		b.exceeded = fmt.Errorf("more than %d store calls: %w", b.limits.MaxStoreCalls, ErrEvalBudgetExceeded)
+	}
+	return b.exceeded
+}
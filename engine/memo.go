@@ -0,0 +1,137 @@
+package engine
+
+import "context"
+
+// memoStore caches the results of the underlying store for the duration of
+// a single evaluation, so the same (entity, attribute) pair referenced by
+// multiple conditions or policies is only fetched once.
+type memoStore struct {
+	ctx     context.Context
+	budget  *budget
+	store   Store
+	values  map[memoKey]memoValue
+	tags    map[memoKey]memoValue
+	parents map[string]memoParents
+}
+
+// The canonical form of an entity is unique for any type and id, so it is
+// used as the key directly
+type memoKey struct {
+	entity string
+	attr   string
+}
+
+type memoValue struct {
+	value EvalValue
+	err   error
+}
+
+type memoParents struct {
+	parents []EntityValue
+	err     error
+}
+
+// maxPooledMemo is the most entries of a map kept for the next evaluation
+const maxPooledMemo = 1024
+
+var _ Store = (*memoStore)(nil)
+var _ TagStore = (*memoStore)(nil)
+
+// reset prepares the store for an evaluation, the maps are kept from the
+// previous one so they don't have to grow again
+func (m *memoStore) reset(ctx context.Context, budget *budget, store Store) {
+	m.ctx = ctx
+	m.budget = budget
+	m.store = store
+	if m.values == nil {
+		m.values = map[memoKey]memoValue{}
+		m.tags = map[memoKey]memoValue{}
+		m.parents = map[string]memoParents{}
+	}
+}
+
+// release drops the results of the evaluation, maps which grew large are
+// let go rather than kept around
+func (m *memoStore) release() {
+	m.ctx, m.budget, m.store = nil, nil, nil
+	if len(m.values) > maxPooledMemo || len(m.tags) > maxPooledMemo || len(m.parents) > maxPooledMemo {
+		m.values, m.tags, m.parents = nil, nil, nil
+		return
+	}
+	for key := range m.values {
+		delete(m.values, key)
+	}
+	for key := range m.tags {
+		delete(m.tags, key)
+	}
+	for key := range m.parents {
+		delete(m.parents, key)
+	}
+}
+
+func (m *memoStore) Get(entity EntityValue, attr string) (EvalValue, error) {
+	key := memoKey{entity: entity.uid(), attr: attr}
+	if item, found := m.values[key]; found {
+		return item.value, item.err
+	}
+
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	value, err := m.store.Get(entity, attr)
+	m.values[key] = memoValue{value: value, err: err}
+
+	return value, err
+}
+
+func (m *memoStore) GetParents(entity EntityValue) ([]EntityValue, error) {
+	key := entity.uid()
+	if item, found := m.parents[key]; found {
+		return item.parents, item.err
+	}
+
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	parents, err := m.store.GetParents(entity)
+	m.parents[key] = memoParents{parents: parents, err: err}
+
+	return parents, err
+}
+
+func (m *memoStore) GetTag(entity EntityValue, tag string) (EvalValue, error) {
+	key := memoKey{entity: entity.uid(), attr: tag}
+	if item, found := m.tags[key]; found {
+		return item.value, item.err
+	}
+
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	var value EvalValue
+	err := ErrValueNotFound
+	if tags, ok := m.store.(TagStore); ok {
+		value, err = tags.GetTag(entity, tag)
+	}
+	m.tags[key] = memoValue{value: value, err: err}
+
+	return value, err
+}
+
+// check is called before each call of the underlying store
+func (m *memoStore) check() error {
+	if err := contextErr(m.ctx); err != nil {
+		return err
+	}
+	return m.budget.store()
+}
+
+// contextErr returns the error of the context once it is done, a store
+// isn't called for an evaluation which has been cancelled. The errors aren't
+// memoized as they are about the request rather than the entity.
+func contextErr(ctx context.Context) error {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ExprString renders an expression node in a Cedar like syntax, this is
+// intended for error messages and diagnostics rather than round tripping.
+func ExprString(node EvalNode) string {
+	switch n := node.(type) {
+	case *ValueNode:
+		if n.Value == nil {
+			return "<nil>"
+		}
+		if str, ok := n.Value.(StrValue); ok {
+			return strconv.Quote(string(str))
+		}
+		return n.Value.String()
+	case *Reference:
+		return n.Source.String()
+	case *Identifier:
+		return n.Value
+	case *UnaryExpr:
+		return n.Op.String() + ExprString(n.Left)
+	case *BinaryExpr:
+		switch n.Op {
+		case OpLookup:
+			// a string key is from the index form, e.g. `context["x-id"]`
+			if _, ok := n.Right.(*ValueNode); ok {
+				return ExprString(n.Left) + "[" + ExprString(n.Right) + "]"
+			}
+			return ExprString(n.Left) + "." + ExprString(n.Right)
+		case OpIs:
+			if val, ok := n.Right.(*ValueNode); ok {
+				if ent, ok := val.Value.(EntityValue); ok {
+					return ExprString(n.Left) + " is " + ent.EntityType()
+				}
+			}
+		}
+		return fmt.Sprintf("%s %s %s", ExprString(n.Left), n.Op.String(), ExprString(n.Right))
+	case *ListExpr:
+		return "[" + exprList(n.Exprs) + "]"
+	case *FunctionCall:
+		if n.Self != nil {
+			return fmt.Sprintf("%s.%s(%s)", ExprString(n.Self), n.Name, exprList(n.Args))
+		}
+		return fmt.Sprintf("%s(%s)", n.Name, exprList(n.Args))
+	case *IfExpr:
+		return fmt.Sprintf("if %s then %s else %s", ExprString(n.If), ExprString(n.Then), ExprString(n.Else))
+	case *VariableDef:
+		parts := []string{}
+		for _, item := range n.Pairs {
+			parts = append(parts, fmt.Sprintf("%q: %s", item.Key, ExprString(item.Value)))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case *PolicyCondition:
+		return fmt.Sprintf("%s { %s }", n.Condition.String(), ExprString(n.Expr))
+	}
+
+	return fmt.Sprintf("%T", node)
+}
+
+func exprList(nodes []EvalNode) string {
+	parts := []string{}
+	for _, item := range nodes {
+		parts = append(parts, ExprString(item))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/koblas/cedar-go/token"
+)
+
+// SourceRange is the text of a policy in its source, from the start of its
+// annotations to its closing ';'
+type SourceRange struct {
+	Start token.Position
+	End   token.Position
+}
+
+// String returns the range as `file:line:column-line:column`
+func (r SourceRange) String() string {
+	if !r.Start.IsValid() {
+		return ""
+	}
+	return fmt.Sprintf("%s-%d:%d", r.Start.String(), r.End.Line, r.End.Column)
+}
+
+// MarshalText writes the range in the form of String
+func (r SourceRange) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// Provenance is the origin of a policy, so that audit events can reference
+// the revision of the policy which made a decision. The parser sets the
+// SourceFile and SourceRange, the Version and CreatedAt are up to the
+// application, see PolicyList.WithVersion.
+type Provenance struct {
+	SourceFile  string      `json:"sourceFile,omitempty"`
+	SourceRange SourceRange `json:"sourceRange"`
+	Version     string      `json:"version,omitempty"`
+	CreatedAt   time.Time   `json:"createdAt"`
+}
+
+// hasRevision reports whether the provenance identifies the policy beyond
+// its position in the source
+func (p *Provenance) hasRevision() bool {
+	return p.SourceFile != "" || p.Version != "" || !p.CreatedAt.IsZero()
+}
+
+// WithVersion returns copies of the policies with the version and creation
+// time set, the policies are otherwise unchanged
+func (p PolicyList) WithVersion(version string, createdAt time.Time) PolicyList {
+	output := make(PolicyList, 0, len(p))
+	for _, item := range p {
+		policy := *item
+		policy.Version = version
+		policy.CreatedAt = createdAt
+		output = append(output, &policy)
+	}
+	return output
+}
+
+// addProvenance records the provenance of a policy which matched or failed,
+// policies without a revision are left out
+func (d *Diagnostics) addProvenance(policy *Policy) {
+	if !policy.hasRevision() {
+		return
+	}
+	if d.Provenance == nil {
+		d.Provenance = map[string]Provenance{}
+	}
+	d.Provenance[policy.Id] = policy.Provenance
+}
@@ -0,0 +1,58 @@
+package engine_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	ast "github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvenance(t *testing.T) {
+	policies, err := parser.ParseFiles(token.NewFileSet(), map[string]string{
+		"photos.cedar": "@id(\"view\")\npermit(principal, action, resource)\nwhen { true };\n\n@id(\"never\")\nforbid(principal, action, resource) when { false };\n",
+	})
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+
+	assert.Equal(t, "photos.cedar", policies[0].SourceFile)
+	assert.Equal(t, "photos.cedar:1:1-3:14", policies[0].SourceRange.String())
+	assert.Equal(t, "photos.cedar:5:1-6:51", policies[1].SourceRange.String())
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 42, time.UTC)
+	versioned := policies.WithVersion("v7", created)
+	assert.Equal(t, "", policies[0].Version)
+	assert.Equal(t, "v7", versioned[0].Version)
+
+	result, err := ast.Eval(context.TODO(), versioned, &ast.Request{
+		Principal: ast.NewEntityValue("User", "alice"),
+		Action:    ast.NewEntityValue("Action", "view"),
+		Resource:  ast.NewEntityValue("Photo", "a.jpg"),
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Diagnostics.Provenance, 1)
+	provenance := result.Diagnostics.Provenance["view"]
+	assert.Equal(t, "v7", provenance.Version)
+	assert.Equal(t, created, provenance.CreatedAt)
+
+	data, err := json.Marshal(provenance)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"sourceFile": "photos.cedar",
+		"sourceRange": "photos.cedar:1:1-3:14",
+		"version": "v7",
+		"createdAt": "2024-05-01T12:00:00.000000042Z"
+	}`, string(data))
+
+	// Without a revision there is nothing to report
+	policies, err = parser.ParseRules(`permit(principal, action, resource);`)
+	require.NoError(t, err)
+	result, err = ast.Eval(context.TODO(), policies, &ast.Request{})
+	require.NoError(t, err)
+	assert.Nil(t, result.Diagnostics.Provenance)
+}
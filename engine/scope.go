@@ -0,0 +1,104 @@
+package engine
+
+// ScopeConstraint describes the restriction placed on one of the
+// principal, action or resource variables in the policy head.
+type ScopeConstraint struct {
+	// Op is OpInvalid when the variable is unconstrained, otherwise
+	// either OpEql or OpIn
+	Op Operand
+	// Entities referenced by the constraint, for `action in [...]` this
+	// will contain more than one value
+	Entities []EntityValue
+	// IsType is the entity type named in an `is` check
+	IsType string
+	// Slot is set when the constraint references a template slot
+	Slot bool
+}
+
+// PolicyScope is the decomposed form of the policy head
+// (e.g. `permit(principal == User::"alice", action, resource is Photo)`)
+type PolicyScope struct {
+	Principal ScopeConstraint
+	Action    ScopeConstraint
+	Resource  ScopeConstraint
+}
+
+// IsAny returns true if the constraint places no restriction on the variable
+func (c ScopeConstraint) IsAny() bool {
+	return c.Op == OpInvalid && c.IsType == ""
+}
+
+// Scope recovers the scope constraints from the compiled `If` expression
+// of the policy.
+func (n *Policy) Scope() PolicyScope {
+	scope := PolicyScope{}
+
+	var visit func(node EvalNode)
+	visit = func(node EvalNode) {
+		switch v := node.(type) {
+		case *BinaryExpr:
+			if v.Op == OpLand {
+				visit(v.Left)
+				visit(v.Right)
+				return
+			}
+			scopeConstraint(&scope, v)
+		case *IfExpr:
+			// `is` checks are reformulated as `if principal is T then <expr> else false`
+			if check, ok := v.If.(*BinaryExpr); ok && check.Op == OpIs {
+				if c := scopeVariable(&scope, check.Left); c != nil {
+					if val, ok := check.Right.(*ValueNode); ok {
+						if ent, ok := val.Value.(EntityValue); ok {
+							c.IsType = ent.EntityType()
+						}
+					}
+				}
+			}
+			visit(v.Then)
+		}
+	}
+	visit(n.If)
+
+	return scope
+}
+
+func scopeVariable(scope *PolicyScope, node EvalNode) *ScopeConstraint {
+	ref, ok := node.(*Reference)
+	if !ok {
+		return nil
+	}
+	switch ref.Source {
+	case RunVarPrincipal:
+		return &scope.Principal
+	case RunVarAction:
+		return &scope.Action
+	case RunVarResource:
+		return &scope.Resource
+	}
+	return nil
+}
+
+func scopeConstraint(scope *PolicyScope, expr *BinaryExpr) {
+	c := scopeVariable(scope, expr.Left)
+	if c == nil || (expr.Op != OpEql && expr.Op != OpIn) {
+		return
+	}
+	c.Op = expr.Op
+
+	switch right := expr.Right.(type) {
+	case *ValueNode:
+		if ent, ok := right.Value.(EntityValue); ok {
+			c.Entities = append(c.Entities, ent)
+		}
+	case *ListExpr:
+		for _, item := range right.Exprs {
+			if val, ok := item.(*ValueNode); ok {
+				if ent, ok := val.Value.(EntityValue); ok {
+					c.Entities = append(c.Entities, ent)
+				}
+			}
+		}
+	case *Reference:
+		c.Slot = right.Source == RunVarSlotPrincipal || right.Source == RunVarSlotResource
+	}
+}
@@ -0,0 +1,299 @@
+package engine
+
+import (
+	"sort"
+)
+
+// EntityNeeds is the data of an entity which may be read from the Store
+type EntityNeeds struct {
+	// Entity is zero for the needs of the indirect entities
+	Entity EntityValue
+	// Attributes are read by `.`, `has` and the lookups, AllAttributes is
+	// set when the name isn't known before evaluation
+	Attributes    []string
+	AllAttributes bool
+	// Tags are read by `hasTag` and `getTag`, AllTags is set when the name
+	// isn't known before evaluation
+	Tags    []string
+	AllTags bool
+	// Ancestors are read by `in`
+	Ancestors bool
+}
+
+// EntityManifest is the part of the entity data which may be read while
+// evaluating a request.
+type EntityManifest struct {
+	// Entities are the needs of the entities known before evaluation, the
+	// request entities and those named by the policies, sorted by uid
+	Entities []EntityNeeds
+	// Indirect are the needs of the entities which are only known during
+	// evaluation, such as those reached through an attribute or the
+	// context, nil when there are none
+	Indirect *EntityNeeds
+}
+
+// UIDs returns the entities of the manifest
+func (m *EntityManifest) UIDs() []EntityValue {
+	output := make([]EntityValue, 0, len(m.Entities))
+	for _, item := range m.Entities {
+		output = append(output, item.Entity)
+	}
+	return output
+}
+
+// EntitySlice statically determines the entities, attributes, tags and
+// ancestors which could be read evaluating the request, so that only they
+// need to be loaded into the Store. The conditions aren't evaluated, so the
+// manifest is a superset of what a single evaluation reads. The policies
+// whose scope can't match the request types are skipped.
+func EntitySlice(policies PolicyList, request *Request) *EntityManifest {
+	index := request.Index
+	if !index.IsFor(policies) {
+		index = NewPolicyIndex(policies)
+	}
+
+	s := slicer{
+		request:  request,
+		entities: map[string]*sliceNeeds{},
+	}
+	for pos, ok := range index.Candidates(request.Principal, request.Action, request.Resource) {
+		if !ok {
+			continue
+		}
+		policy := policies[pos]
+		if policy.If != nil {
+			s.expr(policy.If)
+		}
+		for _, item := range policy.Conditions {
+			s.expr(item)
+		}
+	}
+
+	return s.manifest()
+}
+
+// sliceNeeds collects the needs of an entity
+type sliceNeeds struct {
+	entity        EntityValue
+	attributes    map[string]bool
+	allAttributes bool
+	tags          map[string]bool
+	allTags       bool
+	ancestors     bool
+}
+
+func (n *sliceNeeds) needs() EntityNeeds {
+	return EntityNeeds{
+		Entity:        n.entity,
+		Attributes:    sortedNames(n.attributes),
+		AllAttributes: n.allAttributes,
+		Tags:          sortedNames(n.tags),
+		AllTags:       n.allTags,
+		Ancestors:     n.ancestors,
+	}
+}
+
+func sortedNames(values map[string]bool) []string {
+	output := []string{}
+	for key := range values {
+		output = append(output, key)
+	}
+	sort.Strings(output)
+	return output
+}
+
+// sliceTarget is what an expression may evaluate to, the known entities,
+// whether it may be an entity only known during evaluation and whether it may
+// be a record, whose lookups don't read the store
+type sliceTarget struct {
+	entities []EntityValue
+	indirect bool
+	record   bool
+}
+
+func (t sliceTarget) union(other sliceTarget) sliceTarget {
+	return sliceTarget{
+		entities: append(append([]EntityValue{}, t.entities...), other.entities...),
+		indirect: t.indirect || other.indirect,
+		record:   t.record || other.record,
+	}
+}
+
+// slicer holds the state for building the manifest
+type slicer struct {
+	request  *Request
+	entities map[string]*sliceNeeds
+	indirect *sliceNeeds
+}
+
+// each calls fn with the needs of the entities of the target
+func (s *slicer) each(target sliceTarget, fn func(*sliceNeeds)) {
+	for _, entity := range target.entities {
+		if entity.IsZero() {
+			continue
+		}
+		item, found := s.entities[entity.String()]
+		if !found {
+			item = &sliceNeeds{entity: entity, attributes: map[string]bool{}, tags: map[string]bool{}}
+			s.entities[entity.String()] = item
+		}
+		fn(item)
+	}
+	if target.indirect {
+		if s.indirect == nil {
+			s.indirect = &sliceNeeds{attributes: map[string]bool{}, tags: map[string]bool{}}
+		}
+		fn(s.indirect)
+	}
+}
+
+// literalName returns the attribute or tag name, false when it's computed
+func literalName(node EvalNode) (string, bool) {
+	switch n := node.(type) {
+	case *Identifier:
+		return n.Value, true
+	case *ValueNode:
+		if str, ok := n.Value.(StrValue); ok {
+			return string(str), true
+		}
+	}
+	return "", false
+}
+
+func slotTarget(value NamedType) sliceTarget {
+	if entity, ok := value.(EntityValue); ok {
+		return sliceTarget{entities: []EntityValue{entity}}
+	}
+	return sliceTarget{}
+}
+
+// expr records the needs of the expression and returns what it may evaluate to
+func (s *slicer) expr(node EvalNode) sliceTarget {
+	switch n := node.(type) {
+	case *ValueNode:
+		if entity, ok := n.Value.(EntityValue); ok {
+			return sliceTarget{entities: []EntityValue{entity}}
+		}
+	case *Reference:
+		switch n.Source {
+		case RunVarPrincipal:
+			return sliceTarget{entities: []EntityValue{s.request.Principal}}
+		case RunVarAction:
+			return sliceTarget{entities: []EntityValue{s.request.Action}}
+		case RunVarResource:
+			return sliceTarget{entities: []EntityValue{s.request.Resource}}
+		case RunVarSlotPrincipal:
+			return slotTarget(s.request.SlotPrincipal)
+		case RunVarSlotResource:
+			return slotTarget(s.request.SlotResource)
+		case RunVarContext:
+			return sliceTarget{record: true}
+		}
+	case *PolicyCondition:
+		s.expr(n.Expr)
+	case *UnaryExpr:
+		s.expr(n.Left)
+	case *BinaryExpr:
+		return s.binary(n)
+	case *IfExpr:
+		s.expr(n.If)
+		return s.expr(n.Then).union(s.expr(n.Else))
+	case *ListExpr:
+		result := sliceTarget{}
+		for _, item := range n.Exprs {
+			result = result.union(s.expr(item))
+		}
+		return result
+	case *VariableDef:
+		// A lookup of the record may be any of the values
+		result := sliceTarget{record: true}
+		for _, item := range n.Pairs {
+			result = result.union(s.expr(item.Value))
+		}
+		return result
+	case *FunctionCall:
+		return s.call(n)
+	}
+
+	return sliceTarget{}
+}
+
+func (s *slicer) binary(n *BinaryExpr) sliceTarget {
+	left := s.expr(n.Left)
+	s.expr(n.Right)
+
+	switch n.Op {
+	case OpLookup, OpHas:
+		name, known := literalName(n.Right)
+		s.each(left, func(item *sliceNeeds) {
+			if known {
+				item.attributes[name] = true
+			} else {
+				item.allAttributes = true
+			}
+		})
+		if n.Op == OpLookup {
+			// The attribute may be an entity, or a value of a record literal
+			result := sliceTarget{indirect: true}
+			if left.record {
+				result.entities = left.entities
+			}
+			return result
+		}
+	case OpIn:
+		s.each(left, func(item *sliceNeeds) {
+			item.ancestors = true
+		})
+	}
+
+	return sliceTarget{}
+}
+
+func (s *slicer) call(n *FunctionCall) sliceTarget {
+	var self sliceTarget
+	if n.Self != nil {
+		self = s.expr(n.Self)
+	}
+	for _, item := range n.Args {
+		s.expr(item)
+	}
+
+	if n.Name != "hasTag" && n.Name != "getTag" {
+		return sliceTarget{}
+	}
+
+	name, known := "", false
+	if len(n.Args) == 1 {
+		name, known = literalName(n.Args[0])
+	}
+	s.each(self, func(item *sliceNeeds) {
+		if known {
+			item.tags[name] = true
+		} else {
+			item.allTags = true
+		}
+	})
+	if n.Name == "getTag" {
+		return sliceTarget{indirect: true}
+	}
+	return sliceTarget{}
+}
+
+func (s *slicer) manifest() *EntityManifest {
+	keys := make([]string, 0, len(s.entities))
+	for key := range s.entities {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	output := EntityManifest{Entities: make([]EntityNeeds, 0, len(keys))}
+	for _, key := range keys {
+		output.Entities = append(output.Entities, s.entities[key].needs())
+	}
+	if s.indirect != nil {
+		needs := s.indirect.needs()
+		output.Indirect = &needs
+	}
+
+	return &output
+}
@@ -0,0 +1,62 @@
+package engine_test
+
+import (
+	"testing"
+
+	ast "github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntitySlice(t *testing.T) {
+	policies, err := parser.ParseRules(`
+	permit(principal in Group::"staff", action == Action::"view", resource)
+	when { resource.owner == principal || principal has dept }
+	unless { resource.owner.suspended };
+
+	permit(principal, action == Action::"view", resource is Photo)
+	when { context.device.trusted && principal.hasTag("level") && Album::"shared".public };
+
+	permit(principal, action == Action::"delete", resource)
+	when { principal.admin };
+	`)
+	require.NoError(t, err)
+
+	manifest := ast.EntitySlice(policies, &ast.Request{
+		Principal: ast.NewEntityValue("User", "alice"),
+		Action:    ast.NewEntityValue("Action", "view"),
+		Resource:  ast.NewEntityValue("Photo", "beach"),
+	})
+
+	assert.Equal(t, []ast.EntityValue{
+		ast.NewEntityValue("Album", "shared"),
+		ast.NewEntityValue("Photo", "beach"),
+		ast.NewEntityValue("User", "alice"),
+	}, manifest.UIDs())
+
+	needs := map[string]ast.EntityNeeds{}
+	for _, item := range manifest.Entities {
+		needs[item.Entity.String()] = item
+	}
+	assert.Equal(t, []string{"dept"}, needs[`User::"alice"`].Attributes)
+	assert.Equal(t, []string{"level"}, needs[`User::"alice"`].Tags)
+	assert.True(t, needs[`User::"alice"`].Ancestors)
+	assert.Equal(t, []string{"owner"}, needs[`Photo::"beach"`].Attributes)
+	assert.False(t, needs[`Photo::"beach"`].Ancestors)
+	assert.Equal(t, []string{"public"}, needs[`Album::"shared"`].Attributes)
+
+	// The owner and the device are only known during evaluation
+	require.NotNil(t, manifest.Indirect)
+	assert.Equal(t, []string{"suspended", "trusted"}, manifest.Indirect.Attributes)
+
+	// Only the policy for the delete action applies
+	manifest = ast.EntitySlice(policies, &ast.Request{
+		Principal: ast.NewEntityValue("User", "alice"),
+		Action:    ast.NewEntityValue("Action", "delete"),
+		Resource:  ast.NewEntityValue("Photo", "beach"),
+	})
+	assert.Nil(t, manifest.Indirect)
+	require.Len(t, manifest.Entities, 1)
+	assert.Equal(t, []string{"admin"}, manifest.Entities[0].Attributes)
+}
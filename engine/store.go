@@ -16,8 +16,36 @@ type Store interface {
 	// the event the key is not found in the store (this is to
 	// support `has` operations).
 	Get(EntityValue, string) (EvalValue, error)
-	// GetParents does a transitive lookup for a given entity as
-	// a child of some other entity. i.e. `principal in Group::"admin"`
-	// This returns a list of all transitive entitys.
+	// GetParents returns the ancestors of the entity, its parents and
+	// their parents transitively, for `principal in Group::"admin"`. The
+	// entity itself isn't an ancestor, that an entity is `in` itself is
+	// handled by the evaluator, and an entity the store doesn't know has
+	// no ancestors. The order should only depend on the content of the
+	// store, the built-in stores return the nearest ancestors first and
+	// sort those at the same distance.
 	GetParents(EntityValue) ([]EntityValue, error)
 }
+
+// TagStore is implemented by stores which hold the tags of entities, they
+// are read by the `hasTag` and `getTag` methods. GetTag should return
+// `ErrValueNotFound` when the entity doesn't have the tag, a Store which
+// doesn't implement it has no tags.
+type TagStore interface {
+	GetTag(EntityValue, string) (EvalValue, error)
+}
+
+// AttributeSchema provides static knowledge of the attributes declared on
+// entity types, when present the evaluator uses it to answer `has` and
+// attribute lookups for undeclared attributes without calling the Store.
+type AttributeSchema interface {
+	// HasAttribute reports whether the attribute is declared for the entity
+	// type, known is false if the schema doesn't describe the entity type.
+	HasAttribute(entityType, attr string) (declared bool, known bool)
+}
+
+// StoreNotifier is implemented by stores whose data can change after they
+// are created, subscribers are called after each successful update with the
+// entities that changed.
+type StoreNotifier interface {
+	Subscribe(fn func(changed []EntityValue)) (cancel func())
+}
@@ -0,0 +1,220 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var ErrInvalidLink = errors.New("invalid template link")
+
+// The names of the template slots in a TemplateLink
+const (
+	SlotPrincipal = "?principal"
+	SlotResource  = "?resource"
+)
+
+// TemplateLink binds the slots of a template to entities, creating a policy
+// with the id LinkId. The JSON form is that of the templateLinks of a Cedar
+// policy set, e.g.
+//
+//	{"templateId": "t0", "newId": "link0", "values": {"?principal": {"type": "User", "id": "alice"}}}
+type TemplateLink struct {
+	TemplateId string
+	LinkId     string
+	Values     map[string]EntityValue
+}
+
+type jsonTemplateLink struct {
+	TemplateId string                     `json:"templateId"`
+	LinkId     string                     `json:"newId"`
+	Values     map[string]json.RawMessage `json:"values"`
+}
+
+// MarshalJSON writes the link in the Cedar policy set format
+func (l TemplateLink) MarshalJSON() ([]byte, error) {
+	values := make(map[string]JsonEntityType, len(l.Values))
+	for slot, entity := range l.Values {
+		values[slot] = JsonEntityType{Type: entity.EntityType(), Id: entity.EntityId()}
+	}
+
+	return json.Marshal(struct {
+		TemplateId string                    `json:"templateId"`
+		LinkId     string                    `json:"newId"`
+		Values     map[string]JsonEntityType `json:"values"`
+	}{l.TemplateId, l.LinkId, values})
+}
+
+// UnmarshalJSON reads the link, the entities are either `{"type": ..., "id": ...}`
+// or wrapped in `{"__entity": ...}`
+func (l *TemplateLink) UnmarshalJSON(data []byte) error {
+	var input jsonTemplateLink
+	if err := json.Unmarshal(data, &input); err != nil {
+		return err
+	}
+
+	values := make(map[string]EntityValue, len(input.Values))
+	for slot, raw := range input.Values {
+		var entity struct {
+			JsonEntityType
+			Entity *JsonEntityType `json:"__entity"`
+		}
+		if err := json.Unmarshal(raw, &entity); err != nil {
+			return fmt.Errorf("slot %s: %s: %w", slot, err, ErrInvalidLink)
+		}
+		if entity.Entity != nil {
+			entity.JsonEntityType = *entity.Entity
+		}
+		if entity.Type == "" {
+			return fmt.Errorf("slot %s: missing entity type: %w", slot, ErrInvalidLink)
+		}
+		values[slot] = NewEntityValue(entity.Type, entity.Id)
+	}
+
+	*l = TemplateLink{TemplateId: input.TemplateId, LinkId: input.LinkId, Values: values}
+	return nil
+}
+
+// Slots returns the template slots used by the policy, a policy without
+// slots isn't a template
+func (n *Policy) Slots() []string {
+	seen := map[string]bool{}
+	InspectPolicies(PolicyList{n}, func(node Node) bool {
+		if ref, ok := node.(*Reference); ok {
+			switch ref.Source {
+			case RunVarSlotPrincipal:
+				seen[SlotPrincipal] = true
+			case RunVarSlotResource:
+				seen[SlotResource] = true
+			}
+		}
+		return true
+	})
+
+	output := make([]string, 0, len(seen))
+	for slot := range seen {
+		output = append(output, slot)
+	}
+	sort.Strings(output)
+	return output
+}
+
+// IsTemplate reports whether the policy has slots
+func (n *Policy) IsTemplate() bool {
+	return len(n.Slots()) != 0
+}
+
+// Link creates the policy of the template with the slots bound to the
+// entities, every slot of the template must have a value and there can't be
+// values for other slots. The template isn't changed.
+func (n *Policy) Link(linkId string, values map[string]EntityValue) (*Policy, error) {
+	slots := n.Slots()
+	if len(slots) == 0 {
+		return nil, fmt.Errorf("policy %s isn't a template: %w", n.Id, ErrInvalidLink)
+	}
+	used := map[string]bool{}
+	for _, slot := range slots {
+		if value, found := values[slot]; !found || value.IsZero() {
+			return nil, fmt.Errorf("template %s: missing value for %s: %w", n.Id, slot, ErrInvalidLink)
+		}
+		used[slot] = true
+	}
+	for slot := range values {
+		if !used[slot] {
+			return nil, fmt.Errorf("template %s: unexpected slot %s: %w", n.Id, slot, ErrInvalidLink)
+		}
+	}
+
+	linked := *n
+	linked.Id = linkId
+	linked.If = linkNode(n.If, values)
+	linked.Conditions = make([]*PolicyCondition, 0, len(n.Conditions))
+	for _, item := range n.Conditions {
+		linked.Conditions = append(linked.Conditions, linkNode(item, values).(*PolicyCondition))
+	}
+
+	return &linked, nil
+}
+
+// linkNode returns a copy of the expression with the slot references
+// replaced by their values, the leaves of the tree are shared
+func linkNode(node EvalNode, values map[string]EntityValue) EvalNode {
+	switch n := node.(type) {
+	case *Reference:
+		switch n.Source {
+		case RunVarSlotPrincipal:
+			return &ValueNode{Value: values[SlotPrincipal]}
+		case RunVarSlotResource:
+			return &ValueNode{Value: values[SlotResource]}
+		}
+	case *PolicyCondition:
+		output := *n
+		output.Expr = linkNode(n.Expr, values)
+		return &output
+	case *UnaryExpr:
+		output := *n
+		output.Left = linkNode(n.Left, values)
+		return &output
+	case *BinaryExpr:
+		output := *n
+		output.Left = linkNode(n.Left, values)
+		output.Right = linkNode(n.Right, values)
+		return &output
+	case *IfExpr:
+		output := *n
+		output.If = linkNode(n.If, values)
+		output.Then = linkNode(n.Then, values)
+		output.Else = linkNode(n.Else, values)
+		return &output
+	case *ListExpr:
+		output := *n
+		output.Exprs = make([]EvalNode, 0, len(n.Exprs))
+		for _, item := range n.Exprs {
+			output.Exprs = append(output.Exprs, linkNode(item, values))
+		}
+		return &output
+	case *FunctionCall:
+		output := *n
+		if n.Self != nil {
+			output.Self = linkNode(n.Self, values)
+		}
+		output.Args = make([]EvalNode, 0, len(n.Args))
+		for _, item := range n.Args {
+			output.Args = append(output.Args, linkNode(item, values))
+		}
+		return &output
+	case *VariableDef:
+		output := *n
+		output.Pairs = make([]VariablePair, 0, len(n.Pairs))
+		for _, item := range n.Pairs {
+			output.Pairs = append(output.Pairs, VariablePair{Key: item.Key, Value: linkNode(item.Value, values)})
+		}
+		return &output
+	}
+	return node
+}
+
+// LinkTemplates creates the policies of the links, the templates are found
+// by their id in the list
+func LinkTemplates(templates PolicyList, links []TemplateLink) (PolicyList, error) {
+	byId := make(map[string]*Policy, len(templates))
+	for _, item := range templates {
+		byId[item.Id] = item
+	}
+
+	output := make(PolicyList, 0, len(links))
+	for _, link := range links {
+		template, found := byId[link.TemplateId]
+		if !found {
+			return nil, fmt.Errorf("link %s: template %s not found: %w", link.LinkId, link.TemplateId, ErrInvalidLink)
+		}
+		policy, err := template.Link(link.LinkId, link.Values)
+		if err != nil {
+			return nil, fmt.Errorf("link %s: %w", link.LinkId, err)
+		}
+		output = append(output, policy)
+	}
+
+	return output, nil
+}
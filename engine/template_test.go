@@ -0,0 +1,73 @@
+package engine_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	ast "github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateLinks(t *testing.T) {
+	templates, err := parser.ParseRules(`
+	@id("viewer")
+	permit(principal == ?principal, action == Action::"view", resource in ?resource);
+
+	@id("static")
+	permit(principal, action == Action::"list", resource);
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"?principal", "?resource"}, templates[0].Slots())
+	assert.False(t, templates[1].IsTemplate())
+
+	var links []ast.TemplateLink
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"templateId": "viewer", "newId": "alice-album", "values": {
+			"?principal": {"type": "User", "id": "alice"},
+			"?resource": {"__entity": {"type": "Album", "id": "trip"}}
+		}}
+	]`), &links))
+
+	policies, err := ast.LinkTemplates(templates, links)
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+	assert.Equal(t, "alice-album", policies[0].Id)
+	assert.False(t, policies[0].IsTemplate())
+	assert.Equal(t, []ast.EntityValue{ast.NewEntityValue("User", "alice")}, policies[0].Scope().Principal.Entities)
+	// The template is unchanged
+	assert.True(t, templates[0].IsTemplate())
+
+	result, err := ast.Eval(context.TODO(), policies, &ast.Request{
+		Principal: ast.NewEntityValue("User", "alice"),
+		Action:    ast.NewEntityValue("Action", "view"),
+		Resource:  ast.NewEntityValue("Album", "trip"),
+		Store:     ast.NewChainedStore(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ast.Allow, result.Decision)
+
+	data, err := json.Marshal(links)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"templateId": "viewer", "newId": "alice-album", "values": {
+		"?principal": {"type": "User", "id": "alice"},
+		"?resource": {"type": "Album", "id": "trip"}
+	}}]`, string(data))
+
+	invalid := []ast.TemplateLink{
+		{TemplateId: "missing", LinkId: "a"},
+		{TemplateId: "static", LinkId: "a"},
+		{TemplateId: "viewer", LinkId: "a", Values: map[string]ast.EntityValue{"?principal": ast.NewEntityValue("User", "alice")}},
+		{TemplateId: "viewer", LinkId: "a", Values: map[string]ast.EntityValue{
+			"?principal": ast.NewEntityValue("User", "alice"),
+			"?resource":  ast.NewEntityValue("Album", "trip"),
+			"?other":     ast.NewEntityValue("User", "bob"),
+		}},
+	}
+	for _, link := range invalid {
+		_, err := ast.LinkTemplates(templates, []ast.TemplateLink{link})
+		assert.ErrorIs(t, err, ast.ErrInvalidLink, link.TemplateId)
+	}
+}
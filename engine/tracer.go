@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Tracer receives the events of an evaluation in the order they happen, a
+// tracer is used by a single evaluation at a time so it can capture the
+// trace of a request.
+type Tracer interface {
+	// OnPolicyStart is called before the policy is evaluated
+	OnPolicyStart(policy *Policy)
+	// OnExprEval is called once an expression has been evaluated, the
+	// children of an expression are reported before it with a greater depth
+	OnExprEval(node EvalNode, value EvalValue, err error, depth int)
+	// OnDecision is called with the result of the evaluation
+	OnDecision(result *Result)
+}
+
+// TextTracer writes an indented line for each event
+type TextTracer struct {
+	w io.Writer
+}
+
+var _ Tracer = (*TextTracer)(nil)
+
+func NewTextTracer(w io.Writer) *TextTracer {
+	return &TextTracer{w: w}
+}
+
+func (t *TextTracer) OnPolicyStart(policy *Policy) {
+	fmt.Fprintf(t.w, "policy %s %s at %s\n", policy.Id, policy.Effect.String(), policy.StartPos.String())
+}
+
+func (t *TextTracer) OnExprEval(node EvalNode, value EvalValue, err error, depth int) {
+	indent := strings.Repeat(". ", depth+1)
+	if err != nil {
+		fmt.Fprintf(t.w, "%s%s error: %s\n", indent, ExprString(node), err)
+		return
+	}
+	fmt.Fprintf(t.w, "%s%s = %s\n", indent, ExprString(node), traceValue(value))
+}
+
+func (t *TextTracer) OnDecision(result *Result) {
+	fmt.Fprintf(t.w, "decision %s reasons [%s]\n", result.Decision.String(), strings.Join(result.Reasons, ", "))
+}
+
+func traceValue(value EvalValue) string {
+	if value == nil {
+		return "<nil>"
+	}
+	if str, ok := value.(StrValue); ok {
+		return fmt.Sprintf("%q", string(str))
+	}
+	return value.String()
+}
+
+// TraceEvent is an event written by the JSONTracer
+type TraceEvent struct {
+	// Event is one of "policy", "expr" or "decision"
+	Event    string   `json:"event"`
+	PolicyId string   `json:"policyId,omitempty"`
+	Effect   string   `json:"effect,omitempty"`
+	Position string   `json:"position,omitempty"`
+	Expr     string   `json:"expr,omitempty"`
+	Depth    int      `json:"depth,omitempty"`
+	Value    any      `json:"value,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Decision string   `json:"decision,omitempty"`
+	Reasons  []string `json:"reasons,omitempty"`
+}
+
+// JSONTracer writes each event as a line of JSON (see TraceEvent)
+type JSONTracer struct {
+	enc *json.Encoder
+	// the policy being evaluated
+	policyId string
+}
+
+var _ Tracer = (*JSONTracer)(nil)
+
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{enc: json.NewEncoder(w)}
+}
+
+func (t *JSONTracer) OnPolicyStart(policy *Policy) {
+	t.policyId = policy.Id
+	t.enc.Encode(TraceEvent{
+		Event:    "policy",
+		PolicyId: policy.Id,
+		Effect:   policy.Effect.String(),
+		Position: policy.StartPos.String(),
+	})
+}
+
+func (t *JSONTracer) OnExprEval(node EvalNode, value EvalValue, err error, depth int) {
+	event := TraceEvent{
+		Event:    "expr",
+		PolicyId: t.policyId,
+		Expr:     ExprString(node),
+		Depth:    depth,
+	}
+	if pos := node.Pos(); pos.IsValid() {
+		event.Position = pos.String()
+	}
+	if err != nil {
+		event.Error = err.Error()
+	} else if value != nil {
+		event.Value = value.AsJson()
+	}
+	t.enc.Encode(event)
+}
+
+func (t *JSONTracer) OnDecision(result *Result) {
+	t.policyId = ""
+	t.enc.Encode(TraceEvent{
+		Event:    "decision",
+		Decision: result.Decision.String(),
+		Reasons:  result.Reasons,
+	})
+}
@@ -0,0 +1,82 @@
+package engine_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracer(t *testing.T) {
+	policies, err := parser.ParseRules(`@id("mfa")
+permit(principal, action, resource) when { context.mfa || context.level > 2 };`)
+	require.NoError(t, err)
+	auth := cedar.NewAuthorizer(policies)
+
+	vars, err := cedar.NewContextFromMap(map[string]any{"mfa": false, "level": 3})
+	require.NoError(t, err)
+	authorize := func(tracer engine.Tracer) {
+		ok, err := auth.IsAuthorized(context.TODO(), &cedar.Request{
+			Principal: cedar.NewEntity("User", "alice"),
+			Action:    cedar.NewEntity("Action", "view"),
+			Resource:  cedar.NewEntity("Photo", "a.jpg"),
+			Context:   vars,
+			Tracer:    tracer,
+		})
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+
+	t.Run("text", func(t *testing.T) {
+		var out bytes.Buffer
+		authorize(engine.NewTextTracer(&out))
+
+		assert.Equal(t, strings.Join([]string{
+			"policy mfa permit at 1:1",
+			". true = true",
+			". . . . context = {\"level\": 3, \"mfa\": false}",
+			". . . . mfa = mfa",
+			". . . context.mfa = false",
+			". . . . . context = {\"level\": 3, \"mfa\": false}",
+			". . . . . level = level",
+			". . . . context.level = 3",
+			". . . . 2 = 2",
+			". . . context.level > 2 = true",
+			". . context.mfa || context.level > 2 = true",
+			". when { context.mfa || context.level > 2 } = true",
+			"decision Allow reasons [mfa]",
+			"",
+		}, "\n"), out.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var out bytes.Buffer
+		authorize(engine.NewJSONTracer(&out))
+
+		events := []engine.TraceEvent{}
+		dec := json.NewDecoder(&out)
+		for dec.More() {
+			var event engine.TraceEvent
+			require.NoError(t, dec.Decode(&event))
+			events = append(events, event)
+		}
+		require.NotEmpty(t, events)
+
+		first, last := events[0], events[len(events)-1]
+		assert.Equal(t, engine.TraceEvent{Event: "policy", PolicyId: "mfa", Effect: "permit", Position: "1:1"}, first)
+		assert.Equal(t, engine.TraceEvent{Event: "decision", Decision: "Allow", Reasons: []string{"mfa"}}, last)
+
+		cond := events[len(events)-2]
+		assert.Equal(t, "expr", cond.Event)
+		assert.Equal(t, "mfa", cond.PolicyId)
+		assert.Equal(t, "when { context.mfa || context.level > 2 }", cond.Expr)
+		assert.Equal(t, true, cond.Value)
+	})
+}
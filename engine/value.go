@@ -4,8 +4,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/koblas/cedar-go/scanner"
+	"github.com/koblas/cedar-go/token"
 )
 
 // Basic type interface for all values
@@ -13,9 +20,18 @@ type NamedType interface {
 	TypeName() string
 	String() string
 	AsJson() any
+	// OpEqual is false, rather than an error, for a value of another type
 	OpEqual(input NamedType) (BoolValue, error)
 }
 
+// Types with a key identifying their value for sets, two values are equal
+// exactly when their keys are. Keys include the type so that values of
+// different types never share a key. Types which don't implement HashType
+// are keyed by their type name and String.
+type HashType interface {
+	HashKey() string
+}
+
 // Types that can do math operations (presently only ints)
 type MathType interface {
 	OpUnaryMinus() (NamedType, error)
@@ -66,6 +82,8 @@ type VariableType interface {
 }
 
 var ErrTypeMismatch = errors.New("type mismatch")
+var ErrOverflow = errors.New("integer overflow")
+var ErrDivisionByZero = errors.New("division by zero")
 
 type BoolValue bool
 
@@ -79,7 +97,7 @@ func (v1 BoolValue) TypeName() string {
 func (v1 BoolValue) OpEqual(input NamedType) (BoolValue, error) {
 	v2, ok := input.(BoolValue)
 	if !ok {
-		return false, fmt.Errorf("expected boolean got %s: %w", input.TypeName(), ErrTypeMismatch)
+		return false, nil
 	}
 
 	return v1 == v2, nil
@@ -96,6 +114,10 @@ func (v1 BoolValue) AsJson() any {
 	return v1
 }
 
+func (v1 BoolValue) HashKey() string {
+	return "bool:" + v1.String()
+}
+
 func (v1 BoolValue) OpLand(input NamedType) (BoolValue, error) {
 	v2, ok := input.(BoolValue)
 	if !ok {
@@ -120,7 +142,9 @@ func (v1 BoolValue) OpNot() (BoolValue, error) {
 
 // ---------
 
-type IntValue int
+// IntValue is a Cedar long, a signed 64 bit integer where arithmetic which
+// overflows is an error rather than wrapping
+type IntValue int64
 
 var _ NamedType = (*IntValue)(nil)
 var _ MathType = (*IntValue)(nil)
@@ -133,7 +157,7 @@ func (v1 IntValue) TypeName() string {
 func (v1 IntValue) OpEqual(input NamedType) (BoolValue, error) {
 	v2, ok := input.(IntValue)
 	if !ok {
-		return false, fmt.Errorf("expected long got %s: %w", input.TypeName(), ErrTypeMismatch)
+		return false, nil
 	}
 
 	return BoolValue(v1 == v2), nil
@@ -149,6 +173,10 @@ func (v1 IntValue) AsJson() any {
 	return v1
 }
 
+func (v1 IntValue) HashKey() string {
+	return "long:" + v1.String()
+}
+
 // Integer Comparison
 
 func (v1 IntValue) OpLss(input NamedType) (BoolValue, error) {
@@ -171,7 +199,10 @@ func (v1 IntValue) OpLeq(input NamedType) (BoolValue, error) {
 
 // Integer Math
 func (v1 IntValue) OpUnaryMinus() (NamedType, error) {
-	return IntValue(-int(v1)), nil
+	if v1 == math.MinInt64 {
+		return nil, fmt.Errorf("-%s: %w", v1, ErrOverflow)
+	}
+	return -v1, nil
 }
 
 func (v1 IntValue) OpAdd(input NamedType) (NamedType, error) {
@@ -180,7 +211,10 @@ func (v1 IntValue) OpAdd(input NamedType) (NamedType, error) {
 		return nil, fmt.Errorf("expected long got %s: %w", input.TypeName(), ErrTypeMismatch)
 	}
 
-	return IntValue(v1 + v2), nil
+	if (v2 > 0 && v1 > math.MaxInt64-v2) || (v2 < 0 && v1 < math.MinInt64-v2) {
+		return nil, fmt.Errorf("%s + %s: %w", v1, v2, ErrOverflow)
+	}
+	return v1 + v2, nil
 }
 
 func (v1 IntValue) OpSub(input NamedType) (NamedType, error) {
@@ -189,7 +223,10 @@ func (v1 IntValue) OpSub(input NamedType) (NamedType, error) {
 		return nil, fmt.Errorf("expected int got %s: %w", input.TypeName(), ErrTypeMismatch)
 	}
 
-	return IntValue(v1 - v2), nil
+	if (v2 < 0 && v1 > math.MaxInt64+v2) || (v2 > 0 && v1 < math.MinInt64+v2) {
+		return nil, fmt.Errorf("%s - %s: %w", v1, v2, ErrOverflow)
+	}
+	return v1 - v2, nil
 }
 
 func (v1 IntValue) OpMul(input NamedType) (NamedType, error) {
@@ -198,25 +235,38 @@ func (v1 IntValue) OpMul(input NamedType) (NamedType, error) {
 		return nil, fmt.Errorf("expected int got %s: %w", input.TypeName(), ErrTypeMismatch)
 	}
 
-	return IntValue(v1 * v2), nil
+	result := v1 * v2
+	if v1 != 0 && (result/v1 != v2 || (v1 == -1 && v2 == math.MinInt64)) {
+		return nil, fmt.Errorf("%s * %s: %w", v1, v2, ErrOverflow)
+	}
+	return result, nil
 }
 
 func (v1 IntValue) OpQuo(input NamedType) (NamedType, error) {
 	v2, ok := input.(IntValue)
 	if !ok {
-		return nil, fmt.Errorf("expected boolean got %s: %w", input.TypeName(), ErrTypeMismatch)
+		return nil, fmt.Errorf("expected long got %s: %w", input.TypeName(), ErrTypeMismatch)
+	}
+	if v2 == 0 {
+		return nil, fmt.Errorf("%s / %s: %w", v1, v2, ErrDivisionByZero)
+	}
+	if v1 == math.MinInt64 && v2 == -1 {
+		return nil, fmt.Errorf("%s / %s: %w", v1, v2, ErrOverflow)
 	}
 
-	return IntValue(v1 / v2), nil
+	return v1 / v2, nil
 }
 
 func (v1 IntValue) OpRem(input NamedType) (NamedType, error) {
 	v2, ok := input.(IntValue)
 	if !ok {
-		return nil, fmt.Errorf("expected boolean got %s: %w", input.TypeName(), ErrTypeMismatch)
+		return nil, fmt.Errorf("expected long got %s: %w", input.TypeName(), ErrTypeMismatch)
+	}
+	if v2 == 0 {
+		return nil, fmt.Errorf("%s %% %s: %w", v1, v2, ErrDivisionByZero)
 	}
 
-	return IntValue(v1 % v2), nil
+	return v1 % v2, nil
 }
 
 // ---------
@@ -233,7 +283,7 @@ func (v1 StrValue) TypeName() string {
 func (v1 StrValue) OpEqual(input NamedType) (BoolValue, error) {
 	v2, ok := input.(StrValue)
 	if !ok {
-		return false, fmt.Errorf("expected string got %s: %w", input.TypeName(), ErrTypeMismatch)
+		return false, nil
 	}
 
 	return BoolValue(v1 == v2), nil
@@ -247,6 +297,10 @@ func (v1 StrValue) AsJson() any {
 	return v1
 }
 
+func (v1 StrValue) HashKey() string {
+	return "string:" + strconv.Quote(string(v1))
+}
+
 func (v1 StrValue) OpLike(input NamedType) (BoolValue, error) {
 	v2, ok := input.(StrValue)
 	if !ok {
@@ -258,6 +312,13 @@ func (v1 StrValue) OpLike(input NamedType) (BoolValue, error) {
 
 // ---------
 
+// EntityValue is the UID of an entity, its namespaced type and id. It holds
+// the canonical `Type::"id"` form, with the id quoted and escaped as in a
+// policy, built once when the value is constructed with NewEntityValue. It
+// keys the stores and the `in` checks, so String doesn't allocate, equality
+// is a single string comparison and two distinct entities never share a key.
+// A nil EntityValue isn't an entity. The parts of the type followed by the
+// id, e.g. EntityValue{"Photos::User", "alice"}, are accepted as well.
 type EntityValue []string
 
 const ENTITY_PATH_SEP = "::"
@@ -268,12 +329,94 @@ var _ IsType = (*EntityValue)(nil)
 var _ VariableType = (*EntityValue)(nil)
 
 func NewEntityValue(kind string, id string) EntityValue {
-	parts := strings.Split(kind, ENTITY_PATH_SEP)
+	return EntityValue{entityKey(kind, id)}
+}
+
+// entityKey is the canonical form of the uid
+func entityKey(kind string, id string) string {
+	return kind + ENTITY_PATH_SEP + scanner.Quote(id)
+}
+
+// uid returns the canonical form of the entity, it is empty for the zero
+// value
+func (v1 EntityValue) uid() string {
+	switch len(v1) {
+	case 0:
+		return ""
+	case 1:
+		return v1[0]
+	}
+	return entityKey(strings.Join(v1[:len(v1)-1], ENTITY_PATH_SEP), v1[len(v1)-1])
+}
 
-	return append(parts, id)
+// typeLen is the length of the type of the canonical form, the type can't
+// contain a quote so it ends at the first `::"`
+func typeLen(uid string) int {
+	return strings.Index(uid, ENTITY_PATH_SEP+"\"")
 }
 
+// NewEntityPath constructs an entity from the parts of its type followed by
+// its id, e.g. ["Photos", "User", "alice"]
+func NewEntityPath(parts ...string) EntityValue {
+	if len(parts) == 0 {
+		return EntityValue{}
+	}
+	return NewEntityValue(strings.Join(parts[:len(parts)-1], ENTITY_PATH_SEP), parts[len(parts)-1])
+}
+
+// ParseEntity parses an entity in the Cedar syntax, e.g.
+// `Photos::User::"alice"`. The id is a string literal, so it may contain `::`
+// or escaped quotes.
+func ParseEntity(value string) (EntityValue, error) {
+	value = strings.TrimSpace(value)
+	// The types can't contain a quote, the first one starts the id
+	idx := strings.Index(value, ENTITY_PATH_SEP+"\"")
+	if idx < 0 {
+		return EntityValue{}, fmt.Errorf("%q: expected Type::\"id\": %w", value, ErrInvalidEntityFormat)
+	}
+
+	kind := value[:idx]
+	for _, part := range strings.Split(kind, ENTITY_PATH_SEP) {
+		if !isEntityIdent(part) {
+			return EntityValue{}, fmt.Errorf("%q: invalid entity type %q: %w", value, kind, ErrInvalidEntityFormat)
+		}
+	}
+
+	lit := value[idx+len(ENTITY_PATH_SEP):]
+	for i := 1; i < len(lit)-1; i++ {
+		if lit[i] == '\\' {
+			i += 1
+		} else if lit[i] == '"' {
+			return EntityValue{}, fmt.Errorf("%q: unexpected text after the id: %w", value, ErrInvalidEntityFormat)
+		}
+	}
+	id, err := scanner.Unquote(lit)
+	if err != nil {
+		return EntityValue{}, fmt.Errorf("%q: invalid id: %s: %w", value, err, ErrInvalidEntityFormat)
+	}
+
+	return NewEntityValue(kind, id), nil
+}
+
+// isEntityIdent reports whether the name is a part of an entity type
+func isEntityIdent(name string) bool {
+	if name == "" || token.IsReserved(name) {
+		return false
+	}
+	for i, c := range name {
+		if !unicode.IsLetter(c) && c != '_' && (i == 0 || !unicode.IsDigit(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewEntityFromString parses an entity in the Cedar syntax as ParseEntity,
+// text which isn't valid is split at the last `::` as the type and id
 func NewEntityFromString(value string) EntityValue {
+	if entity, err := ParseEntity(value); err == nil {
+		return entity
+	}
 	parts := strings.Split(value, ENTITY_PATH_SEP)
 
 	id := parts[len(parts)-1]
@@ -281,23 +424,49 @@ func NewEntityFromString(value string) EntityValue {
 		id = id[1 : len(id)-1]
 	}
 
-	return append(parts[0:len(parts)-1], id)
+	return NewEntityValue(strings.Join(parts[0:len(parts)-1], ENTITY_PATH_SEP), id)
+}
+
+// IsZero is true for the zero EntityValue, which isn't an entity
+func (v1 EntityValue) IsZero() bool {
+	return v1.uid() == ""
 }
 
 // EntityType returns the namespaced type name for this entity
 func (v1 EntityValue) EntityType() string {
-	if v1 == nil {
+	uid := v1.uid()
+	idx := typeLen(uid)
+	if idx < 0 {
 		return ""
 	}
-	return strings.Join(v1[0:len(v1)-1], ENTITY_PATH_SEP)
+	return uid[:idx]
 }
 
-// EntityType returns the Id value for this entity
+// EntityId returns the Id value for this entity
 func (v1 EntityValue) EntityId() string {
-	if v1 == nil {
+	uid := v1.uid()
+	idx := typeLen(uid)
+	if idx < 0 {
 		return ""
 	}
-	return v1[len(v1)-1]
+	lit := uid[idx+len(ENTITY_PATH_SEP):]
+	if !strings.ContainsRune(lit, '\\') {
+		return lit[1 : len(lit)-1]
+	}
+	id, _ := scanner.Unquote(lit)
+	return id
+}
+
+// Path returns the parts of the type followed by the id
+func (v1 EntityValue) Path() []string {
+	if v1.IsZero() {
+		return nil
+	}
+	parts := []string{}
+	if kind := v1.EntityType(); kind != "" {
+		parts = strings.Split(kind, ENTITY_PATH_SEP)
+	}
+	return append(parts, v1.EntityId())
 }
 
 func (v1 EntityValue) TypeName() string {
@@ -307,35 +476,44 @@ func (v1 EntityValue) TypeName() string {
 func (v1 EntityValue) OpEqual(input NamedType) (BoolValue, error) {
 	v2, ok := input.(EntityValue)
 	if !ok {
-		return false, fmt.Errorf("expected entity got %s: %w", input.TypeName(), ErrTypeMismatch)
-	}
-
-	if len(v1) != len(v2) {
 		return false, nil
 	}
-	for idx, val := range v1 {
-		if v2[idx] != val {
-			return BoolValue(false), nil
-		}
-	}
 
-	return BoolValue(true), nil
+	return BoolValue(v1.uid() == v2.uid()), nil
 }
 
+// String is the canonical form, `Type::"id"`, which ParseEntity reads back
 func (v1 EntityValue) String() string {
-	return v1.EntityType() + ENTITY_PATH_SEP + "\"" + v1.EntityId() + "\""
+	if uid := v1.uid(); uid != "" {
+		return uid
+	}
+	return ENTITY_PATH_SEP + "\"\""
+}
+
+func (v1 EntityValue) HashKey() string {
+	return "entity:" + v1.String()
 }
 
 func (v1 EntityValue) AsJson() any {
-	l := len(v1) - 1
 	return map[string]any{
 		"__entity": map[string]string{
 			"type": v1.EntityType(),
-			"id":   v1[l],
+			"id":   v1.EntityId(),
 		},
 	}
 }
 
+// MarshalJSON writes the entity in the `__entity` form of AsJson, which
+// UnmarshalJSON reads back. The zero value is null.
+func (v1 EntityValue) MarshalJSON() ([]byte, error) {
+	if v1.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(v1.AsJson())
+}
+
+// UnmarshalJSON reads an entity either as `{"type": ..., "id": ...}` or in the
+// `__entity` form, null leaves the value unchanged
 func (v1 *EntityValue) UnmarshalJSON(data []byte) error {
 	type TypeId struct {
 		Id   *string `json:"id"`
@@ -359,8 +537,11 @@ func (v1 *EntityValue) UnmarshalJSON(data []byte) error {
 	id := record.Id
 	kind := record.Type
 	if record.Entity != nil {
-		id = record.Id
-		kind = record.Type
+		if id != nil || kind != nil {
+			return fmt.Errorf("expected either __entity or type and id: %w", ErrInvalidEntityFormat)
+		}
+		id = record.Entity.Id
+		kind = record.Entity.Type
 	}
 	if id == nil {
 		return fmt.Errorf("missing 'id' property: %w", ErrInvalidEntityFormat)
@@ -374,31 +555,53 @@ func (v1 *EntityValue) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// OpIn checks if the entity is a descendant of, or is, the entity (or one of
+// the set of entities) on the right. A set on the left is an error, which is
+// raised by the evaluator as sets don't support `in`.
 func (v1 EntityValue) OpIn(input NamedType, store Store) (BoolValue, error) {
-	parents, err := store.GetParents(v1)
-	if err != nil {
-		return false, err
-	}
-
-	entities := map[string]bool{}
+	// The sets on the right of an `in` are short, they are scanned rather
+	// than building a lookup for every check
+	var target string
+	var targets SetValue
+	key := v1.uid()
 	if rval, ok := input.(EntityValue); ok {
-		entities[rval.String()] = true
+		if rval.uid() == key {
+			return true, nil
+		}
+		target = rval.uid()
 	} else if rval, ok := input.(SetValue); ok {
 		for _, item := range rval {
 			val, ok := item.(EntityValue)
 			if !ok {
 				return false, fmt.Errorf("expected entity got %s: %w", item.TypeName(), ErrTypeMismatch)
 			}
-			entities[val.String()] = true
+			// An entity is in itself even if the store has no record of it
+			if val.uid() == key {
+				return true, nil
+			}
 		}
+		targets = rval
 	} else {
 		return false, fmt.Errorf("expected entity or set got %s: %w", input.TypeName(), ErrTypeMismatch)
 	}
 
+	if store == nil {
+		return false, nil
+	}
+
+	parents, err := store.GetParents(v1)
+	if err != nil {
+		return false, err
+	}
 	for _, item := range parents {
-		if entities[item.String()] {
+		if targets == nil && item.uid() == target {
 			return true, nil
 		}
+		for _, value := range targets {
+			if value.(EntityValue).uid() == item.uid() {
+				return true, nil
+			}
+		}
 	}
 
 	return false, nil
@@ -410,21 +613,8 @@ func (v1 EntityValue) OpIs(input NamedType) (BoolValue, error) {
 		return false, fmt.Errorf("expected identifier got %s: %w", input.TypeName(), ErrTypeMismatch)
 	}
 
-	// For the moment the last portion of the "Is" value is a empty string, so drop it
-	l := len(rval) - 1
-	if rval[l] == "" {
-		rval = rval[0:l]
-	}
-	for idx, part := range rval {
-		if idx >= len(v1) {
-			return false, nil
-		}
-		if part != v1[idx] {
-			return false, nil
-		}
-	}
-
-	return true, nil
+	// The type of an `is` is an entity with an empty id
+	return BoolValue(v1.EntityType() == rval.EntityType()), nil
 }
 
 func valueAsString(input NamedType) (string, error) {
@@ -460,7 +650,7 @@ func (v1 EntityValue) OpLookup(input NamedType, store Store) (EvalValue, error)
 	}
 	val, err := store.Get(v1, str)
 	if errors.Is(err, ErrValueNotFound) {
-		return nil, err
+		return nil, fmt.Errorf("attribute %q does not exist on entity %s: %w", str, v1, ErrValueNotFound)
 	} else if err != nil {
 		return nil, fmt.Errorf("value not found: %w", err)
 	}
@@ -468,42 +658,135 @@ func (v1 EntityValue) OpLookup(input NamedType, store Store) (EvalValue, error)
 	return val, nil
 }
 
+// HasTag reports whether the entity has the tag in the store
+func (v1 EntityValue) HasTag(tag string, store Store) (BoolValue, error) {
+	tags, ok := store.(TagStore)
+	if !ok {
+		return false, nil
+	}
+
+	_, err := tags.GetTag(v1, tag)
+	if errors.Is(err, ErrValueNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("tag not found: %w", err)
+	}
+
+	return true, nil
+}
+
+// GetTag returns the value of the tag from the store
+func (v1 EntityValue) GetTag(tag string, store Store) (EvalValue, error) {
+	tags, ok := store.(TagStore)
+	if !ok {
+		return nil, fmt.Errorf("tag not found \"%s\": %w", tag, ErrValueNotFound)
+	}
+
+	val, err := tags.GetTag(v1, tag)
+	if errors.Is(err, ErrValueNotFound) {
+		return nil, fmt.Errorf("tag not found \"%s\": %w", tag, err)
+	} else if err != nil {
+		return nil, fmt.Errorf("tag not found: %w", err)
+	}
+
+	return val, nil
+}
+
 // ---------
 
 type SetValue []NamedType
 
 var _ NamedType = (*SetValue)(nil)
+var _ HashType = (*SetValue)(nil)
+
+// NewSetValue creates a set of the values without the duplicates, the first
+// of equal values is kept
+func NewSetValue(values ...NamedType) SetValue {
+	seen := make(map[string]bool, len(values))
+	result := make(SetValue, 0, len(values))
+	for _, item := range values {
+		key := hashKey(item)
+		if !seen[key] {
+			seen[key] = true
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// hashKey returns the key of the value for sets
+func hashKey(value NamedType) string {
+	if hashed, ok := value.(HashType); ok {
+		return hashed.HashKey()
+	}
+	return value.TypeName() + ":" + value.String()
+}
+
+// keys returns the set of the keys of the elements, duplicates are ignored
+func (v1 SetValue) keys() map[string]bool {
+	keys := make(map[string]bool, len(v1))
+	for _, item := range v1 {
+		keys[hashKey(item)] = true
+	}
+	return keys
+}
 
 func (v1 SetValue) TypeName() string {
 	return "set"
 }
 
+// OpEqual reports whether the sets have the same elements, regardless of
+// their order and of duplicates
 func (v1 SetValue) OpEqual(input NamedType) (BoolValue, error) {
 	v2, ok := input.(SetValue)
 	if !ok {
-		return false, fmt.Errorf("expected set got %s: %w", input.TypeName(), ErrTypeMismatch)
+		return false, nil
 	}
 
-	if len(v1) != len(v2) {
-		return false, nil
+	return BoolValue(v1.HashKey() == v2.HashKey()), nil
+}
+
+// Contains reports whether an element of the set is equal to the value
+func (v1 SetValue) Contains(value NamedType) bool {
+	key := hashKey(value)
+	for _, item := range v1 {
+		if hashKey(item) == key {
+			return true
+		}
 	}
+	return false
+}
 
-	// Just for completless
-	for _, val := range v1 {
-		found := false
-		for _, bval := range v2 {
-			if equal, err := val.OpEqual(bval); equal {
-				found = true
-				break
-			} else if err != nil {
-				return false, err
-			}
+// ContainsAll reports whether every element of other is in the set
+func (v1 SetValue) ContainsAll(other SetValue) bool {
+	keys := v1.keys()
+	for _, item := range other {
+		if !keys[hashKey(item)] {
+			return false
 		}
-		if !found {
-			return false, nil
+	}
+	return true
+}
+
+// ContainsAny reports whether an element of other is in the set
+func (v1 SetValue) ContainsAny(other SetValue) bool {
+	keys := v1.keys()
+	for _, item := range other {
+		if keys[hashKey(item)] {
+			return true
 		}
 	}
-	return BoolValue(true), nil
+	return false
+}
+
+// HashKey is built from the sorted keys of the distinct elements
+func (v1 SetValue) HashKey() string {
+	keys := make([]string, 0, len(v1))
+	for key := range v1.keys() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return "set:[" + strings.Join(keys, ",") + "]"
 }
 
 func (v1 SetValue) String() string {
@@ -540,10 +823,14 @@ func (v1 IdentifierValue) AsJson() any {
 	return string(v1)
 }
 
+func (v1 IdentifierValue) HashKey() string {
+	return "identifier:" + string(v1)
+}
+
 func (v1 IdentifierValue) OpEqual(input NamedType) (BoolValue, error) {
 	v2, ok := input.(IdentifierValue)
 	if !ok {
-		return false, fmt.Errorf("expected set got %s: %w", input.TypeName(), ErrTypeMismatch)
+		return false, nil
 	}
 
 	return string(v1) == string(v2), nil
@@ -554,6 +841,12 @@ func (v1 IdentifierValue) OpEqual(input NamedType) (BoolValue, error) {
 type VarValue struct {
 	// self     NamedType
 	children map[string]NamedType
+
+	// pending holds the source of a lazy record, attributes are converted
+	// into children on first access
+	mu      sync.Mutex
+	pending map[string]any
+	convert func(value any) (NamedType, error)
 }
 
 var _ NamedType = (*VarValue)(nil)
@@ -565,10 +858,96 @@ func NewVarValue(data map[string]NamedType) *VarValue {
 	}
 }
 
+// NewLazyVarValue creates a record whose attributes are converted from the
+// source the first time they are read. Large records, such as deeply nested
+// contexts, then only pay for the attributes the policies reference. The
+// source must not be modified once the record is created.
+func NewLazyVarValue(source map[string]any, convert func(value any) (NamedType, error)) *VarValue {
+	return &VarValue{
+		children: map[string]NamedType{},
+		pending:  source,
+		convert:  convert,
+	}
+}
+
+// child returns the attribute, converting it from the source if needed
+func (v1 *VarValue) child(id string) (NamedType, bool, error) {
+	if v1.pending == nil {
+		val, ok := v1.children[id]
+		return val, ok, nil
+	}
+
+	v1.mu.Lock()
+	defer v1.mu.Unlock()
+
+	if val, ok := v1.children[id]; ok {
+		return val, true, nil
+	}
+	raw, ok := v1.pending[id]
+	if !ok {
+		return nil, false, nil
+	}
+	val, err := v1.convert(raw)
+	if err != nil {
+		return nil, true, err
+	}
+	v1.children[id] = val
+
+	return val, true, nil
+}
+
+// all returns every attribute, converting those not yet read
+func (v1 *VarValue) all() map[string]NamedType {
+	if v1.pending == nil {
+		return v1.children
+	}
+
+	output := make(map[string]NamedType, len(v1.pending))
+	for key := range v1.pending {
+		if val, _, err := v1.child(key); err == nil {
+			output[key] = val
+		}
+	}
+	return output
+}
+
+// Keys returns the names of the attributes in sorted order
+func (v1 *VarValue) Keys() []string {
+	keys := make([]string, 0, len(v1.children)+len(v1.pending))
+	if v1.pending != nil {
+		// the children are converted from the source
+		for key := range v1.pending {
+			keys = append(keys, key)
+		}
+	} else {
+		for key := range v1.children {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func (v1 *VarValue) Get(id string) (NamedType, bool) {
-	val, ok := v1.children[id]
+	val, ok, err := v1.child(id)
 
-	return val, ok
+	return val, ok && err == nil
+}
+
+// With returns a copy of the record with the attribute set to value, or
+// removed when value is nil. The record itself is unchanged.
+func (v1 *VarValue) With(id string, value NamedType) *VarValue {
+	current := v1.all()
+	children := make(map[string]NamedType, len(current)+1)
+	for key, val := range current {
+		children[key] = val
+	}
+	if value == nil {
+		delete(children, id)
+	} else {
+		children[id] = value
+	}
+	return NewVarValue(children)
 }
 
 func (v1 *VarValue) TypeName() string {
@@ -576,20 +955,47 @@ func (v1 *VarValue) TypeName() string {
 }
 
 func (v1 *VarValue) String() string {
-	// TODO
-	return "<<TBD>>"
+	children := v1.all()
+	keys := make([]string, 0, len(children))
+	for key := range children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	values := []string{}
+	for _, key := range keys {
+		values = append(values, strconv.Quote(key)+": "+children[key].String())
+	}
+	return "{" + strings.Join(values, ", ") + "}"
 }
 
 func (v1 *VarValue) AsJson() any {
 	result := map[string]any{}
 
-	for k, v := range v1.children {
+	for k, v := range v1.all() {
 		result[k] = v.AsJson()
 	}
 
 	return result
 }
 
+// HashKey is built from the sorted attribute names and the keys of their
+// values
+func (v1 *VarValue) HashKey() string {
+	children := v1.all()
+	keys := make([]string, 0, len(children))
+	for key := range children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, strconv.Quote(key)+":"+hashKey(children[key]))
+	}
+	return "record:{" + strings.Join(values, ",") + "}"
+}
+
 // func (v1 *VarValue) UnmarshalJSON(data []byte) error {
 // 	raw := map[string]any{}
 
@@ -612,38 +1018,67 @@ func (v1 *VarValue) AsJson() any {
 // 	return nil
 // }
 
+// OpEqual reports whether the records have the same attributes with equal
+// values, attribute values of different types are unequal rather than an
+// error
 func (v1 *VarValue) OpEqual(input NamedType) (BoolValue, error) {
-	return false, nil
-}
+	v2, ok := input.(*VarValue)
+	if !ok {
+		return false, nil
+	}
+	if v1 == v2 {
+		return true, nil
+	}
 
-func (v1 *VarValue) OpLookup(input NamedType, store Store) (EvalValue, error) {
-	if val, ok := input.(StrValue); ok {
-		child, found := v1.children[string(val)]
-		if !found {
-			return nil, fmt.Errorf("lookup key not found \"%s\": %w", val, ErrValueNotFound)
-		}
-		return child, nil
+	children1, children2 := v1.all(), v2.all()
+	if len(children1) != len(children2) {
+		return false, nil
 	}
-	if val, ok := input.(IdentifierValue); ok {
-		child, found := v1.children[string(val)]
-		if !found {
-			return nil, fmt.Errorf("lookup key not found \"%s\": %w", val, ErrValueNotFound)
+	for key, val := range children1 {
+		other, found := children2[key]
+		if !found || hashKey(val) != hashKey(other) {
+			return false, nil
 		}
-		return child, nil
+	}
+	return true, nil
+}
+
+func (v1 *VarValue) OpLookup(input NamedType, store Store) (EvalValue, error) {
+	var key string
+	switch val := input.(type) {
+	case StrValue:
+		key = string(val)
+	case IdentifierValue:
+		key = string(val)
+	default:
+		return nil, fmt.Errorf("invalid type: %s: %w", input.TypeName(), ErrUnsupportedType)
 	}
 
-	return nil, fmt.Errorf("invalid type: %s: %w", input.TypeName(), ErrUnsupportedType)
+	child, found, err := v1.child(key)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("attribute %q does not exist on record: %w", key, ErrValueNotFound)
+	}
+	return child, nil
 }
 
 func (v1 *VarValue) OpHas(input NamedType, store Store) (BoolValue, error) {
-	if val, ok := input.(StrValue); ok {
-		_, found := v1.children[string(val)]
-		return BoolValue(found), nil
+	var key string
+	switch val := input.(type) {
+	case StrValue:
+		key = string(val)
+	case IdentifierValue:
+		key = string(val)
+	default:
+		return BoolValue(false), fmt.Errorf("invalid type: %s: %w", input.TypeName(), ErrUnsupportedType)
 	}
-	if val, ok := input.(IdentifierValue); ok {
-		_, found := v1.children[string(val)]
+
+	if v1.pending != nil {
+		_, found := v1.pending[key]
 		return BoolValue(found), nil
 	}
-
-	return BoolValue(false), fmt.Errorf("invalid type: %s: %w", input.TypeName(), ErrUnsupportedType)
+	_, found := v1.children[key]
+	return BoolValue(found), nil
 }
@@ -0,0 +1,398 @@
+package engine_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	ast "github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityValue(t *testing.T) {
+	entity := ast.NewEntityValue("Photos::User", "alice")
+	assert.Equal(t, "Photos::User", entity.EntityType())
+	assert.Equal(t, "alice", entity.EntityId())
+	assert.Equal(t, `Photos::User::"alice"`, entity.String())
+	assert.Equal(t, []string{"Photos", "User", "alice"}, entity.Path())
+	assert.False(t, entity.IsZero())
+
+	// All of the constructors produce the same value
+	assert.Equal(t, entity, ast.NewEntityPath("Photos", "User", "alice"))
+	assert.Equal(t, entity, ast.NewEntityFromString(`Photos::User::"alice"`))
+	assert.NotEqual(t, entity, ast.NewEntityValue("Photos", "User::alice"))
+
+	// The parts of the type followed by the id are the same entity
+	legacy := ast.EntityValue{"Photos", "User", "alice"}
+	assert.Equal(t, entity.String(), legacy.String())
+	equal, err := entity.OpEqual(legacy)
+	require.NoError(t, err)
+	assert.True(t, bool(equal))
+
+	// The id is escaped, so the canonical form reads back as the same entity
+	for _, id := range []string{`say "hi"`, `back\slash`, `a::"b"`, "line\nbreak", ""} {
+		entity := ast.NewEntityValue("User", id)
+		assert.Equal(t, id, entity.EntityId(), id)
+		assert.Equal(t, "User", entity.EntityType(), id)
+		parsed, err := ast.ParseEntity(entity.String())
+		require.NoError(t, err, entity.String())
+		assert.Equal(t, entity, parsed, id)
+	}
+	assert.Equal(t, `User::"say \"hi\""`, ast.NewEntityValue("User", `say "hi"`).String())
+	assert.NotEqual(t, ast.NewEntityValue("User", `a" || "b`).String(), ast.NewEntityValue("User", `a\" || \"b`).String())
+
+	equal, err = entity.OpEqual(ast.NewEntityValue("Photos::User", "alice"))
+	require.NoError(t, err)
+	assert.True(t, bool(equal))
+
+	var zero ast.EntityValue
+	assert.True(t, zero.IsZero())
+	assert.Equal(t, "", zero.EntityType())
+	assert.Equal(t, "", zero.EntityId())
+	assert.Nil(t, zero.Path())
+}
+
+func TestParseEntity(t *testing.T) {
+	valid := map[string]ast.EntityValue{
+		`User::"alice"`:             ast.NewEntityValue("User", "alice"),
+		` Photos::User::"alice" `:   ast.NewEntityValue("Photos::User", "alice"),
+		`User::"a::b"`:              ast.NewEntityValue("User", "a::b"),
+		`User::"say \"hi\""`:        ast.NewEntityValue("User", `say "hi"`),
+		`User::"back\\slash"`:       ast.NewEntityValue("User", `back\slash`),
+		`User::"\u{e9}t\u{e9}"`:     ast.NewEntityValue("User", "été"),
+		`User::""`:                  ast.NewEntityValue("User", ""),
+		`Ns::Action::"read::all\""`: ast.NewEntityValue("Ns::Action", `read::all"`),
+	}
+	for input, expected := range valid {
+		entity, err := ast.ParseEntity(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, expected, entity, input)
+		assert.Equal(t, expected, ast.NewEntityFromString(input), input)
+	}
+
+	for _, input := range []string{
+		``,
+		`alice`,
+		`User::alice`,
+		`::"alice"`,
+		`User::::"alice"`,
+		`1User::"alice"`,
+		`if::"alice"`,
+		`User::"alice`,
+		`User::"al"ice"`,
+		`User::"alice" extra`,
+		`User::"\q"`,
+	} {
+		_, err := ast.ParseEntity(input)
+		assert.ErrorIs(t, err, ast.ErrInvalidEntityFormat, input)
+	}
+}
+
+func TestEntityValueJSON(t *testing.T) {
+	entity := ast.NewEntityValue("Photos::User", "alice")
+
+	data, err := json.Marshal(entity)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"__entity": {"type": "Photos::User", "id": "alice"}}`, string(data))
+
+	// Both forms are read, as fields of a struct or on their own
+	var request struct {
+		Principal ast.EntityValue   `json:"principal"`
+		Resource  ast.EntityValue   `json:"resource"`
+		Parents   []ast.EntityValue `json:"parents"`
+		Missing   ast.EntityValue   `json:"missing"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"principal": {"__entity": {"type": "Photos::User", "id": "alice"}},
+		"resource": {"type": "Photos::User", "id": "alice"},
+		"parents": [{"type": "Group", "id": "a"}, {"__entity": {"type": "Group", "id": "b"}}],
+		"missing": null
+	}`), &request))
+	assert.Equal(t, entity, request.Principal)
+	assert.Equal(t, entity, request.Resource)
+	assert.Equal(t, []ast.EntityValue{ast.NewEntityValue("Group", "a"), ast.NewEntityValue("Group", "b")}, request.Parents)
+	assert.True(t, request.Missing.IsZero())
+
+	// The round trip keeps the value
+	data, err = json.Marshal(request)
+	require.NoError(t, err)
+	var again struct {
+		Principal ast.EntityValue   `json:"principal"`
+		Resource  ast.EntityValue   `json:"resource"`
+		Parents   []ast.EntityValue `json:"parents"`
+		Missing   ast.EntityValue   `json:"missing"`
+	}
+	require.NoError(t, json.Unmarshal(data, &again))
+	assert.Equal(t, request, again)
+
+	var value ast.EntityValue
+	for _, input := range []string{
+		`{"__entity": {"type": "User"}}`,
+		`{"__entity": {"id": "alice"}}`,
+		`{"type": "User"}`,
+		`{"type": "User", "id": "a", "__entity": {"type": "User", "id": "b"}}`,
+	} {
+		assert.ErrorIs(t, json.Unmarshal([]byte(input), &value), ast.ErrInvalidEntityFormat, input)
+	}
+}
+
+func TestDecimalValue(t *testing.T) {
+	values := []struct {
+		text   string
+		expect string
+	}{
+		{"1.5", "1.5000"},
+		{"0.0001", "0.0001"},
+		{"-0.25", "-0.2500"},
+		{"-0.0", "0.0000"},
+		{"12.3400", "12.3400"},
+		{"922337203685477.5807", "922337203685477.5807"},
+		{"-922337203685477.5808", "-922337203685477.5808"},
+	}
+	for _, item := range values {
+		value, err := ast.NewDecimalValue(item.text)
+		require.NoError(t, err, item.text)
+		assert.Equal(t, item.expect, value.String())
+
+		// The JSON form parses back to the same value
+		arg := value.AsJson().(map[string]any)["__extn"].(map[string]string)["arg"]
+		parsed, err := ast.NewDecimalValue(arg)
+		require.NoError(t, err)
+		assert.Equal(t, value, parsed)
+	}
+
+	for _, text := range []string{"1", "1.", ".5", "1.23456", "+1.0", "1e3", "1.0.0", "- 1.0", "一.0", ""} {
+		_, err := ast.NewDecimalValue(text)
+		assert.ErrorIs(t, err, ast.ErrTypeMismatch, text)
+	}
+	for _, text := range []string{"922337203685477.5808", "-922337203685477.5809", "1000000000000000.0"} {
+		_, err := ast.NewDecimalValue(text)
+		assert.ErrorIs(t, err, ast.ErrOverflow, text)
+	}
+
+	expressions := []struct {
+		expr   string
+		expect ast.EvalValue
+	}{
+		{`decimal("1.5") == decimal("1.5000")`, ast.BoolValue(true)},
+		{`decimal("0.1") == decimal("0.10001")`, nil},
+		{`decimal("-1.5").lessThan(decimal("-1.4999"))`, ast.BoolValue(true)},
+		{`decimal("1.5").lessThanOrEqual(decimal("1.50"))`, ast.BoolValue(true)},
+		{`decimal("1.5").greaterThan(decimal("1.5"))`, ast.BoolValue(false)},
+		{`decimal("1.5").greaterThanOrEqual(decimal("-2.0"))`, ast.BoolValue(true)},
+		{`decimal("1.5").lessThan(1)`, nil},
+		{`decimal("1.5") < decimal("2.5")`, nil},
+	}
+	request := &ast.Request{Store: schema.EntityStore{}}
+	for _, item := range expressions {
+		node, err := parser.ParseExpr(item.expr)
+		require.NoError(t, err)
+
+		value, err := ast.EvalExpr(context.TODO(), node, request)
+		if item.expect == nil {
+			assert.Error(t, err, item.expr)
+			continue
+		}
+		require.NoError(t, err, item.expr)
+		assert.Equal(t, item.expect, value, item.expr)
+	}
+}
+
+func TestIpValue(t *testing.T) {
+	for _, text := range []string{"1.2.3", "1.2.3.4/33", "01.2.3.4", "fe80::1%eth0", "::1/129", "host", ""} {
+		_, err := ast.NewIpValue(text)
+		assert.ErrorIs(t, err, ast.ErrTypeMismatch, text)
+	}
+
+	expressions := []struct {
+		expr   string
+		expect bool
+	}{
+		{`ip("127.0.0.1") == ip("127.0.0.1")`, true},
+		{`ip("127.0.0.1") == ip("127.0.0.1/32")`, true},
+		{`ip("10.0.0.0/8") == ip("10.0.0.0/8")`, true},
+		{`ip("10.1.0.0/8") == ip("10.0.0.0/8")`, false},
+		{`ip("10.0.0.0/8") == ip("10.0.0.0/16")`, false},
+		{`ip("::1") == ip("0:0:0:0:0:0:0:1")`, true},
+		{`ip("127.0.0.1").isIpv4()`, true},
+		{`ip("127.0.0.1").isIpv6()`, false},
+		{`ip("::ffff:127.0.0.1").isIpv6()`, true},
+		{`ip("ffee::/64").isIpv6()`, true},
+		{`ip("127.1.2.3").isLoopback()`, true},
+		{`ip("127.0.0.0/4").isLoopback()`, false},
+		{`ip("::1").isLoopback()`, true},
+		{`ip("::2").isLoopback()`, false},
+		{`ip("239.255.255.255").isMulticast()`, true},
+		{`ip("224.0.0.0/3").isMulticast()`, false},
+		{`ip("ff02::/16").isMulticast()`, true},
+		{`ip("10.1.2.3").isInRange(ip("10.0.0.0/8"))`, true},
+		{`ip("10.1.0.0/16").isInRange(ip("10.0.0.0/8"))`, true},
+		{`ip("10.0.0.0/8").isInRange(ip("10.0.0.0/8"))`, true},
+		{`ip("10.0.0.0/7").isInRange(ip("10.0.0.0/8"))`, false},
+		{`ip("10.1.2.3").isInRange(ip("10.1.2.3"))`, true},
+		{`ip("11.1.2.3").isInRange(ip("10.0.0.0/8"))`, false},
+		{`ip("::ffff:10.1.2.3").isInRange(ip("10.0.0.0/8"))`, false},
+	}
+	request := &ast.Request{Store: schema.EntityStore{}}
+	for _, item := range expressions {
+		node, err := parser.ParseExpr(item.expr)
+		require.NoError(t, err)
+
+		value, err := ast.EvalExpr(context.TODO(), node, request)
+		require.NoError(t, err, item.expr)
+		assert.Equal(t, ast.BoolValue(item.expect), value, item.expr)
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	set := ast.NewSetValue(ast.IntValue(1), ast.StrValue("1"), ast.IntValue(1), ast.NewEntityValue("User", "alice"))
+	assert.Equal(t, ast.SetValue{ast.IntValue(1), ast.StrValue("1"), ast.NewEntityValue("User", "alice")}, set)
+	assert.True(t, set.Contains(ast.NewEntityValue("User", "alice")))
+	assert.False(t, set.Contains(ast.BoolValue(true)))
+
+	expressions := []struct {
+		expr   string
+		expect bool
+	}{
+		{`[1, 2, 2] == [2, 1]`, true},
+		{`[1, 2] == [1, 2, 3]`, false},
+		{`[1, "a"] == ["a", 1, 1]`, true},
+		{`[1] == ["1"]`, false},
+		{`[[1, 2], [3]] == [[3], [2, 1]]`, true},
+		{`[decimal("1.5")] == [decimal("1.50")]`, true},
+		{`[ip("10.0.0.1")] == [ip("10.0.0.1/32")]`, true},
+		{`[1, "a", User::"alice"].contains(User::"alice")`, true},
+		{`[1, "a"].contains(true)`, false},
+		{`[[1, 2]].contains([2, 1])`, true},
+		{`[{a: 1, b: [2]}].contains({b: [2], a: 1})`, true},
+		{`[{a: 1}].contains({a: 1, b: 2})`, false},
+		{`[1, 2, 3].containsAll([3, 3, 1])`, true},
+		{`[1, 2].containsAll([1, 4])`, false},
+		{`[1, 2].containsAll([])`, true},
+		{`[].containsAll([1])`, false},
+		{`[1, 2].containsAny(["x", 2])`, true},
+		{`[1, 2].containsAny([])`, false},
+		{`[].containsAny([1])`, false},
+	}
+	request := &ast.Request{Store: schema.EntityStore{}}
+	for _, item := range expressions {
+		node, err := parser.ParseExpr(item.expr)
+		require.NoError(t, err)
+
+		value, err := ast.EvalExpr(context.TODO(), node, request)
+		require.NoError(t, err, item.expr)
+		assert.Equal(t, ast.BoolValue(item.expect), value, item.expr)
+	}
+}
+
+// Values of different types are never equal, as in Cedar
+func TestEqualDifferentTypes(t *testing.T) {
+	request := &ast.Request{
+		Principal: ast.NewEntityValue("User", "alice"),
+		Store:     schema.EntityStore{},
+	}
+	for _, expr := range []string{
+		`1 == "1"`,
+		`true == 1`,
+		`"User::\"alice\"" == principal`,
+		`principal == "alice"`,
+		`[1] == {a: 1}`,
+		`{} == []`,
+		`ip("127.0.0.1") == "127.0.0.1"`,
+		`decimal("1.0") == 1`,
+	} {
+		node, err := parser.ParseExpr(expr)
+		require.NoError(t, err, expr)
+
+		value, err := ast.EvalExpr(context.TODO(), node, request)
+		require.NoError(t, err, expr)
+		assert.Equal(t, ast.BoolValue(false), value, expr)
+
+		node, err = parser.ParseExpr(strings.Replace(expr, "==", "!=", 1))
+		require.NoError(t, err, expr)
+		value, err = ast.EvalExpr(context.TODO(), node, request)
+		require.NoError(t, err, expr)
+		assert.Equal(t, ast.BoolValue(true), value, expr)
+	}
+}
+
+func TestVarValueEqual(t *testing.T) {
+	record := ast.NewVarValue(map[string]ast.NamedType{
+		"owner": ast.NewEntityValue("User", "alice"),
+		"tags":  ast.SetValue{ast.StrValue("a"), ast.StrValue("b")},
+	})
+	equal, err := record.OpEqual(record.With("tags", ast.SetValue{ast.StrValue("b"), ast.StrValue("a")}))
+	require.NoError(t, err)
+	assert.True(t, bool(equal))
+
+	equal, err = record.OpEqual(ast.SetValue{})
+	require.NoError(t, err)
+	assert.False(t, bool(equal))
+
+	expressions := []struct {
+		expr   string
+		expect bool
+	}{
+		{`{} == {}`, true},
+		{`{a: 1, b: "x"} == {b: "x", a: 1}`, true},
+		{`{a: 1} == {a: 1, b: 2}`, false},
+		{`{a: 1, b: 2} == {a: 1}`, false},
+		{`{a: 1} == {b: 1}`, false},
+		{`{a: 1} == {a: "1"}`, false},
+		{`{a: {b: {c: [1, 2]}}} == {a: {b: {c: [2, 1]}}}`, true},
+		{`{a: {b: {c: [1, 2]}}} == {a: {b: {c: [1]}}}`, false},
+		{`{a: User::"alice"} == {a: User::"alice"}`, true},
+		{`{a: User::"alice"} == {a: Admin::"alice"}`, false},
+		{`{a: [{b: 1}]} == {a: [{b: 1}]}`, true},
+		{`{a: 1} != {a: 2}`, true},
+		{`context == {mfa: true}`, true},
+	}
+	request := &ast.Request{
+		Store:   schema.EntityStore{},
+		Context: ast.NewVarValue(map[string]ast.NamedType{"mfa": ast.BoolValue(true)}),
+	}
+	for _, item := range expressions {
+		node, err := parser.ParseExpr(item.expr)
+		require.NoError(t, err)
+
+		value, err := ast.EvalExpr(context.TODO(), node, request)
+		require.NoError(t, err, item.expr)
+		assert.Equal(t, ast.BoolValue(item.expect), value, item.expr)
+	}
+}
+
+func BenchmarkEntityIn(b *testing.B) {
+	store := schema.EntityStore{}
+	parent := ast.EntityValue{}
+	for i := 0; i < 10; i++ {
+		group := ast.NewEntityValue("Group", fmt.Sprintf("g%d", i))
+		var parents []ast.EntityValue
+		if !parent.IsZero() {
+			parents = append(parents, parent)
+		}
+		require.NoError(b, store.Add(schema.NewEntityStoreItem(group, parents, nil)))
+		parent = group
+	}
+	require.NoError(b, store.Add(schema.NewEntityStoreItem(ast.NewEntityValue("User", "alice"), []ast.EntityValue{parent}, nil)))
+
+	node, err := parser.ParseExpr(`principal in Group::"g0" && principal in [Group::"g5", Group::"x"]`)
+	require.NoError(b, err)
+	request := &ast.Request{
+		Principal: ast.NewEntityValue("User", "alice"),
+		Store:     store,
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		value, err := ast.EvalExpr(context.TODO(), node, request)
+		if err != nil || value != ast.BoolValue(true) {
+			b.Fatal(value, err)
+		}
+	}
+}
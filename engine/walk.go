@@ -0,0 +1,81 @@
+package engine
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk, if
+// the visitor returned is not nil the children of the node are walked with it.
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the policy or expression tree in depth-first order. This
+// covers the whole policy including the scope, which is compiled into `If`.
+func Walk(visitor Visitor, node Node) {
+	if visitor = visitor.Visit(node); visitor == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Policy:
+		if n.If != nil {
+			Walk(visitor, n.If)
+		}
+		for _, item := range n.Conditions {
+			Walk(visitor, item)
+		}
+	case *PolicyCondition:
+		Walk(visitor, n.Expr)
+
+	case *ValueNode:
+	case *Reference:
+	case *Identifier:
+	case *UnaryExpr:
+		Walk(visitor, n.Left)
+	case *BinaryExpr:
+		Walk(visitor, n.Left)
+		Walk(visitor, n.Right)
+	case *IfExpr:
+		Walk(visitor, n.If)
+		Walk(visitor, n.Then)
+		Walk(visitor, n.Else)
+	case *ListExpr:
+		for _, item := range n.Exprs {
+			Walk(visitor, item)
+		}
+	case *FunctionCall:
+		if n.Self != nil {
+			Walk(visitor, n.Self)
+		}
+		for _, item := range n.Args {
+			Walk(visitor, item)
+		}
+	case *VariableDef:
+		for _, item := range n.Pairs {
+			Walk(visitor, item.Value)
+		}
+	default:
+		panic(fmt.Sprintf("engine.Walk: unexpected node type %T", n))
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree in depth-first order calling f for each node,
+// the children of a node are skipped when f returns false.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// InspectPolicies calls Inspect for each of the policies in the list
+func InspectPolicies(policies PolicyList, f func(Node) bool) {
+	for _, policy := range policies {
+		Inspect(policy, f)
+	}
+}
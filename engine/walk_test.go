@@ -0,0 +1,51 @@
+package engine_test
+
+import (
+	"testing"
+
+	ast "github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalk(t *testing.T) {
+	policies, err := parser.ParseRules(`
+	permit(principal == User::"alice", action, resource in Album::"trip")
+	when { resource.owner == principal && context.level > 3 }
+	unless { principal.tags.contains(Tag::"blocked") };
+	`)
+	require.NoError(t, err)
+
+	entities := []string{}
+	attributes := []string{}
+	ast.InspectPolicies(policies, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.ValueNode:
+			if ent, ok := n.Value.(ast.EntityValue); ok {
+				entities = append(entities, ent.String())
+			}
+		case *ast.BinaryExpr:
+			if n.Op == ast.OpLookup {
+				if ident, ok := n.Right.(*ast.Identifier); ok {
+					attributes = append(attributes, ident.Value)
+				}
+			}
+		}
+		return true
+	})
+
+	assert.ElementsMatch(t, []string{`User::"alice"`, `Album::"trip"`, `Tag::"blocked"`}, entities)
+	assert.ElementsMatch(t, []string{"owner", "level", "tags"}, attributes)
+
+	// Returning false prunes the children, context is only used in the conditions
+	sawContext := false
+	ast.Inspect(policies[0], func(node ast.Node) bool {
+		if ref, ok := node.(*ast.Reference); ok && ref.Source == ast.RunVarContext {
+			sawContext = true
+		}
+		_, isCondition := node.(*ast.PolicyCondition)
+		return !isCondition
+	})
+	assert.False(t, sawContext)
+}
@@ -0,0 +1,257 @@
+package cedar
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/koblas/cedar-go/engine"
+)
+
+// DenyExplanation is the reason a request wasn't allowed, see ExplainDeny
+type DenyExplanation struct {
+	IsAllowed bool `json:"isAllowed"`
+	// Forbids are the ids of the forbid policies which matched the request
+	Forbids []string `json:"forbids"`
+	// Permits explain why each of the permit policies didn't apply
+	Permits []PolicyExplanation `json:"permits"`
+}
+
+// PolicyExplanation is the clause of a permit policy which didn't hold for
+// the request, or the error of the policy
+type PolicyExplanation struct {
+	PolicyId string `json:"policyId"`
+	// Clause is "scope", "when" or "unless"
+	Clause string `json:"clause,omitempty"`
+	// Expr is the expression of the clause which was false, or for an
+	// unless clause true, narrowed down to the operand of `&&` or `||`
+	// which decided it
+	Expr     string `json:"expr,omitempty"`
+	Position string `json:"position,omitempty"`
+	// Values are those of the operands of the expression for the request
+	Values []ExplainValue `json:"values,omitempty"`
+	// Error is set when the policy failed to evaluate
+	Error string `json:"error,omitempty"`
+}
+
+// ExplainValue is the value of an expression for the request
+type ExplainValue struct {
+	Expr  string `json:"expr"`
+	Value string `json:"value"`
+}
+
+// ExplainDeny evaluates the request and reports the forbid policies which
+// matched it and, for each permit policy which didn't, the scope constraint or
+// condition which didn't hold with the values involved. It is meant for
+// support tooling rather than the request path, the decision cache isn't used
+// and the policies are evaluated again clause by clause.
+func (auth *SchemaAuthorizer) ExplainDeny(ctx context.Context, request *Request) (*DenyExplanation, error) {
+	policies, _, authStore := auth.state()
+	if auth.Schema != nil {
+		if err := auth.Schema.ValidateContext(request.Context, request.Principal, request.Action, request.Resource); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidContext, err)
+		}
+	}
+
+	req := auth.engineRequest(request, authStore)
+	result, err := engine.Eval(ctx, policies, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	output := DenyExplanation{
+		IsAllowed: result.Decision == engine.Allow,
+		Forbids:   result.Diagnostics.Forbids,
+		Permits:   []PolicyExplanation{},
+	}
+	if output.Forbids == nil {
+		output.Forbids = []string{}
+	}
+
+	permits := map[string]bool{}
+	for _, id := range result.Diagnostics.Permits {
+		permits[id] = true
+	}
+	failed := map[string]error{}
+	for _, item := range result.Diagnostics.Errors {
+		failed[item.PolicyId] = item.Err
+	}
+
+	for _, policy := range policies {
+		if policy.Effect != engine.EffectPermit || permits[policy.Id] {
+			continue
+		}
+		if err, found := failed[policy.Id]; found {
+			output.Permits = append(output.Permits, PolicyExplanation{PolicyId: policy.Id, Error: err.Error()})
+			continue
+		}
+		output.Permits = append(output.Permits, explainPolicy(ctx, policy, &req))
+	}
+
+	return &output, nil
+}
+
+// explainPolicy finds the first clause of the policy which doesn't hold
+func explainPolicy(ctx context.Context, policy *engine.Policy, req *engine.Request) PolicyExplanation {
+	output := PolicyExplanation{PolicyId: policy.Id}
+
+	for _, clause := range conjuncts(policy.If) {
+		if value, err := engine.EvalExpr(ctx, clause, req); err != nil {
+			output.Error = err.Error()
+			return output
+		} else if value != engine.BoolValue(true) {
+			return explainClause(ctx, output, "scope", decisive(ctx, clause, false, req), req)
+		}
+	}
+
+	for _, cond := range policy.Conditions {
+		want := cond.Condition == engine.ConditionWhen
+		value, err := engine.EvalExpr(ctx, cond.Expr, req)
+		if err != nil {
+			output.Error = err.Error()
+			return output
+		}
+		if value != engine.BoolValue(want) {
+			return explainClause(ctx, output, cond.Condition.String(), decisive(ctx, cond.Expr, !want, req), req)
+		}
+	}
+
+	return output
+}
+
+func explainClause(ctx context.Context, output PolicyExplanation, clause string, node engine.EvalNode, req *engine.Request) PolicyExplanation {
+	output.Clause = clause
+	output.Expr = engine.ExprString(node)
+	if pos := node.Pos(); pos.IsValid() {
+		output.Position = pos.String()
+	}
+	output.Values = operandValues(ctx, node, req)
+	return output
+}
+
+// conjuncts splits the scope of a policy into its constraints
+func conjuncts(node engine.EvalNode) []engine.EvalNode {
+	if n, ok := node.(*engine.BinaryExpr); ok && n.Op == engine.OpLand {
+		return append(conjuncts(n.Left), conjuncts(n.Right)...)
+	}
+	return []engine.EvalNode{node}
+}
+
+// decisive narrows the expression, which evaluated to value, down to the
+// operand which decided it: the false operand of `&&` or the true one of
+// `||`. An `is` check of the scope is the check when it failed.
+func decisive(ctx context.Context, node engine.EvalNode, value bool, req *engine.Request) engine.EvalNode {
+	switch n := node.(type) {
+	case *engine.BinaryExpr:
+		if (n.Op == engine.OpLand && !value) || (n.Op == engine.OpLor && value) {
+			for _, item := range []engine.EvalNode{n.Left, n.Right} {
+				if result, err := engine.EvalExpr(ctx, item, req); err == nil && result == engine.BoolValue(value) {
+					return decisive(ctx, item, value, req)
+				}
+			}
+		}
+	case *engine.UnaryExpr:
+		if n.Op == engine.OpNot {
+			if _, ok := n.Left.(*engine.BinaryExpr); ok {
+				return n
+			}
+		}
+	case *engine.IfExpr:
+		if result, err := engine.EvalExpr(ctx, n.If, req); err == nil {
+			if result == engine.BoolValue(false) {
+				return n.If
+			}
+			return decisive(ctx, n.Then, value, req)
+		}
+	}
+	return node
+}
+
+// operandValues evaluates the operands of the expression which aren't
+// literals, or the expression itself when it has no operands
+func operandValues(ctx context.Context, node engine.EvalNode, req *engine.Request) []ExplainValue {
+	var operands []engine.EvalNode
+	switch n := node.(type) {
+	case *engine.BinaryExpr:
+		if n.Op == engine.OpLookup {
+			operands = []engine.EvalNode{n}
+		} else {
+			operands = []engine.EvalNode{n.Left, n.Right}
+		}
+	case *engine.UnaryExpr:
+		operands = []engine.EvalNode{n.Left}
+	case *engine.FunctionCall:
+		if n.Self != nil {
+			operands = append(operands, n.Self)
+		}
+		operands = append(operands, n.Args...)
+	default:
+		operands = []engine.EvalNode{n}
+	}
+
+	output := []ExplainValue{}
+	for _, item := range operands {
+		if _, ok := item.(*engine.ValueNode); ok {
+			continue
+		}
+		value, err := engine.EvalExpr(ctx, item, req)
+		text := ""
+		if err != nil {
+			text = "error: " + err.Error()
+		} else {
+			text = explainValue(value)
+		}
+		output = append(output, ExplainValue{Expr: engine.ExprString(item), Value: text})
+	}
+	return output
+}
+
+func explainValue(value engine.EvalValue) string {
+	if value == nil {
+		return "<nil>"
+	}
+	if str, ok := value.(engine.StrValue); ok {
+		return strconv.Quote(string(str))
+	}
+	return value.String()
+}
+
+// String describes the clause, e.g.
+//
+//	view: scope action == Action::"view" is false (action = Action::"edit")
+func (e PolicyExplanation) String() string {
+	if e.Error != "" {
+		return fmt.Sprintf("%s: error: %s", e.PolicyId, e.Error)
+	}
+	expect := "false"
+	if e.Clause == engine.ConditionUnless.String() {
+		expect = "true"
+	}
+	text := fmt.Sprintf("%s: %s %s is %s", e.PolicyId, e.Clause, e.Expr, expect)
+	if len(e.Values) != 0 {
+		values := []string{}
+		for _, item := range e.Values {
+			values = append(values, item.Expr+" = "+item.Value)
+		}
+		text += " (" + strings.Join(values, ", ") + ")"
+	}
+	return text
+}
+
+// String describes the decision with a line for each policy
+func (e *DenyExplanation) String() string {
+	var buf strings.Builder
+	if e.IsAllowed {
+		buf.WriteString("allowed\n")
+	} else {
+		buf.WriteString("denied\n")
+	}
+	for _, id := range e.Forbids {
+		fmt.Fprintf(&buf, "forbid %s matched\n", id)
+	}
+	for _, item := range e.Permits {
+		fmt.Fprintf(&buf, "permit %s\n", item)
+	}
+	return buf.String()
+}
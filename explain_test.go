@@ -0,0 +1,81 @@
+package cedar_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainDeny(t *testing.T) {
+	policies, err := cedar.ParsePolicies(`
+	@id("view")
+	permit(principal, action == Action::"view", resource);
+	@id("owner")
+	permit(principal, action, resource is Photo) when { context.mfa && resource.owner == principal };
+	@id("trusted")
+	permit(principal, action, resource) unless { context.network == "public" || context.mfa };
+	@id("broken")
+	permit(principal, action, resource) when { context.missing };
+	@id("suspended")
+	forbid(principal, action, resource) when { context.suspended };
+	`)
+	require.NoError(t, err)
+
+	store, err := cedar.StoreFromJson(strings.NewReader(`[
+		{"uid": {"type": "Photo", "id": "a"}, "attrs": {"owner": {"__entity": {"type": "User", "id": "bob"}}}, "parents": []}
+	]`), nil)
+	require.NoError(t, err)
+	auth := cedar.NewAuthorizer(policies, cedar.WithStore(store))
+
+	reqContext, err := cedar.NewContextFromMap(map[string]any{"mfa": true, "network": "public", "suspended": true})
+	require.NoError(t, err)
+	explanation, err := auth.ExplainDeny(context.TODO(), &cedar.Request{
+		Principal: engine.NewEntityValue("User", "alice"),
+		Action:    engine.NewEntityValue("Action", "edit"),
+		Resource:  engine.NewEntityValue("Photo", "a"),
+		Context:   reqContext,
+	})
+	require.NoError(t, err)
+
+	assert.False(t, explanation.IsAllowed)
+	assert.Equal(t, []string{"suspended"}, explanation.Forbids)
+	require.Len(t, explanation.Permits, 4)
+
+	view := explanation.Permits[0]
+	assert.Equal(t, "scope", view.Clause)
+	assert.Equal(t, `action == Action::"view"`, view.Expr)
+	assert.Equal(t, []cedar.ExplainValue{{Expr: "action", Value: `Action::"edit"`}}, view.Values)
+
+	owner := explanation.Permits[1]
+	assert.Equal(t, "when", owner.Clause)
+	assert.Equal(t, "resource.owner == principal", owner.Expr)
+	assert.Equal(t, []cedar.ExplainValue{
+		{Expr: "resource.owner", Value: `User::"bob"`},
+		{Expr: "principal", Value: `User::"alice"`},
+	}, owner.Values)
+
+	trusted := explanation.Permits[2]
+	assert.Equal(t, "unless", trusted.Clause)
+	assert.Equal(t, `context.network == "public"`, trusted.Expr)
+	assert.Equal(t, `trusted: unless context.network == "public" is true (context.network = "public")`, trusted.String())
+
+	assert.Equal(t, "broken", explanation.Permits[3].PolicyId)
+	assert.NotEmpty(t, explanation.Permits[3].Error)
+
+	assert.Contains(t, explanation.String(), "denied\nforbid suspended matched\npermit view: scope")
+
+	// A failed `is` check is reported rather than the constraint it guards
+	explanation, err = auth.ExplainDeny(context.TODO(), &cedar.Request{
+		Principal: engine.NewEntityValue("User", "alice"),
+		Action:    engine.NewEntityValue("Action", "edit"),
+		Resource:  engine.NewEntityValue("Album", "a"),
+		Context:   reqContext,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "resource is Photo", explanation.Permits[1].Expr)
+}
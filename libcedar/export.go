@@ -0,0 +1,35 @@
+//go:build cgo
+
+package main
+
+// #include <stdlib.h>
+import "C"
+
+import (
+	"unsafe"
+)
+
+// call runs fn on the input, the output is allocated with malloc
+func call(input *C.char, fn func([]byte) []byte) *C.char {
+	return C.CString(string(recoverCall(fn, []byte(C.GoString(input)))))
+}
+
+//export cedar_authorize
+func cedar_authorize(input *C.char) *C.char {
+	return call(input, authorizeJson)
+}
+
+//export cedar_parse
+func cedar_parse(input *C.char) *C.char {
+	return call(input, parseJson)
+}
+
+//export cedar_validate
+func cedar_validate(input *C.char) *C.char {
+	return call(input, validateJson)
+}
+
+//export cedar_free
+func cedar_free(output *C.char) {
+	C.free(unsafe.Pointer(output))
+}
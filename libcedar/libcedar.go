@@ -0,0 +1,263 @@
+// Package main is libcedar, a C shared library of the authorizer for services
+// which aren't written in Go, such as Python or Ruby, to embed rather than
+// running a sidecar. It's built with
+//
+//	go build -buildmode=c-shared -o libcedar.so ./libcedar
+//
+// which also writes the libcedar.h header. Each function takes a JSON
+// document and returns a JSON document, which the caller releases with
+// cedar_free:
+//
+//	char *cedar_authorize(const char *input);
+//	char *cedar_parse(const char *input);
+//	char *cedar_validate(const char *input);
+//	void cedar_free(char *output);
+//
+// The inputs are objects with the fields of authorizeInput, parseInput and
+// validateInput. A problem with the input is reported in the "error" field
+// of the output rather than by the return value.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/analysis"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+)
+
+// main is required by -buildmode=c-shared, it isn't run
+func main() {}
+
+// entityRef is an entity of a request, either `User::"alice"` or
+// `{"type": "User", "id": "alice"}`
+type entityRef struct {
+	engine.EntityValue
+}
+
+func (e *entityRef) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		e.EntityValue, err = engine.ParseEntity(str)
+		return err
+	}
+	var value engine.JsonEntityType
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if value.Type == "" {
+		return fmt.Errorf("missing entity type")
+	}
+	e.EntityValue = engine.NewEntityValue(value.Type, value.Id)
+	return nil
+}
+
+// schemaInput is a JSON schema, or a string of the text format
+type schemaInput struct {
+	raw json.RawMessage
+}
+
+func (s *schemaInput) UnmarshalJSON(data []byte) error {
+	s.raw = append(json.RawMessage{}, data...)
+	return nil
+}
+
+// load returns the schema, nil if there isn't one
+func (s *schemaInput) load() (*schema.Schema, error) {
+	if s == nil || len(s.raw) == 0 || string(s.raw) == "null" {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(s.raw, &text); err == nil {
+		return schema.NewFromText(strings.NewReader(text))
+	}
+	return schema.NewFromJson(bytes.NewReader(s.raw))
+}
+
+type authorizeInput struct {
+	// Policies are in the Cedar policy language
+	Policies string       `json:"policies"`
+	Schema   *schemaInput `json:"schema"`
+	// Entities are in the Cedar entity JSON format
+	Entities  json.RawMessage `json:"entities"`
+	Principal entityRef       `json:"principal"`
+	Action    entityRef       `json:"action"`
+	Resource  entityRef       `json:"resource"`
+	Context   map[string]any  `json:"context"`
+}
+
+type authorizeOutput struct {
+	Decision string `json:"decision"`
+	// Matches are the ids of the policies which determined the decision
+	Matches []string         `json:"matches"`
+	Errors  []authorizeError `json:"errors"`
+	// Error is set when the request couldn't be evaluated
+	Error string `json:"error,omitempty"`
+}
+
+type authorizeError struct {
+	PolicyId string `json:"policyId"`
+	Message  string `json:"message"`
+}
+
+type parseInput struct {
+	Policies string `json:"policies"`
+}
+
+type parseOutput struct {
+	// Policies are in the Cedar policy JSON format
+	Policies any    `json:"policies"`
+	Error    string `json:"error,omitempty"`
+}
+
+type validateInput struct {
+	Policies string       `json:"policies"`
+	Schema   *schemaInput `json:"schema"`
+}
+
+type validateOutput struct {
+	Problems []string `json:"problems"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// authorizeJson evaluates the request, the decision is Deny when the request
+// couldn't be evaluated
+func authorizeJson(data []byte) []byte {
+	output := authorizeOutput{Decision: engine.Deny.String(), Matches: []string{}, Errors: []authorizeError{}}
+	detail, err := authorize(data)
+	if err != nil {
+		output.Error = err.Error()
+		return marshal(output)
+	}
+
+	if detail.IsAllowed {
+		output.Decision = engine.Allow.String()
+	}
+	if detail.Matches != nil {
+		output.Matches = detail.Matches
+	}
+	for _, item := range detail.Diagnostics.Errors {
+		output.Errors = append(output.Errors, authorizeError{PolicyId: item.PolicyId, Message: item.Err.Error()})
+	}
+	return marshal(output)
+}
+
+func authorize(data []byte) (*cedar.AuthDetail, error) {
+	var input authorizeInput
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+
+	policies, err := cedar.ParsePolicies(input.Policies)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse policies: %w", err)
+	}
+	sdef, err := input.Schema.load()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read schema: %w", err)
+	}
+
+	var opts []cedar.Option
+	if sdef != nil {
+		opts = append(opts, cedar.WithSchema(sdef))
+	}
+	if len(input.Entities) != 0 {
+		store, err := cedar.StoreFromJson(bytes.NewReader(input.Entities), sdef)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load entities: %w", err)
+		}
+		opts = append(opts, cedar.WithStore(store))
+	}
+
+	req := cedar.Request{
+		Principal: input.Principal.EntityValue,
+		Action:    input.Action.EntityValue,
+		Resource:  input.Resource.EntityValue,
+	}
+	if sdef != nil && input.Context != nil {
+		req.Context, err = sdef.NormalizeContext(input.Context, req.Principal, req.Action, req.Resource)
+	} else {
+		req.Context, err = cedar.NewContextFromMap(input.Context)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid context: %w", err)
+	}
+
+	return cedar.NewAuthorizer(policies, opts...).IsAuthorizedDetail(context.Background(), &req)
+}
+
+// parseJson converts the policies to the Cedar policy JSON format
+func parseJson(data []byte) []byte {
+	var input parseInput
+	if err := json.Unmarshal(data, &input); err != nil {
+		return marshal(parseOutput{Error: fmt.Sprintf("invalid input: %s", err)})
+	}
+	policies, err := cedar.ParsePolicies(input.Policies)
+	if err != nil {
+		return marshal(parseOutput{Error: err.Error()})
+	}
+	value, err := policies.ToJson()
+	if err != nil {
+		return marshal(parseOutput{Error: err.Error()})
+	}
+	return marshal(parseOutput{Policies: value})
+}
+
+// validateJson reports the entity types and actions the schema doesn't
+// declare, and the policies which can't apply to any request of the schema
+func validateJson(data []byte) []byte {
+	output := validateOutput{Problems: []string{}}
+
+	var input validateInput
+	if err := json.Unmarshal(data, &input); err != nil {
+		output.Error = fmt.Sprintf("invalid input: %s", err)
+		return marshal(output)
+	}
+	policies, err := cedar.ParsePolicies(input.Policies)
+	if err != nil {
+		output.Error = err.Error()
+		return marshal(output)
+	}
+	sdef, err := input.Schema.load()
+	if err != nil {
+		output.Error = fmt.Sprintf("unable to read schema: %s", err)
+		return marshal(output)
+	}
+	if sdef == nil {
+		output.Error = "schema must be provided"
+		return marshal(output)
+	}
+
+	for _, item := range analysis.FindUnknownTypes(policies, sdef) {
+		output.Problems = append(output.Problems, item.String())
+	}
+	for _, item := range analysis.FindUnreachablePolicies(policies, sdef) {
+		output.Problems = append(output.Problems, item.String())
+	}
+	return marshal(output)
+}
+
+// recoverCall runs fn on the input, a panic is reported in the "error" field
+// of the output rather than crashing the process which embeds the library
+func recoverCall(fn func([]byte) []byte, input []byte) (output []byte) {
+	defer func() {
+		if value := recover(); value != nil {
+			output = marshal(map[string]string{"error": fmt.Sprintf("internal error: %v", value)})
+		}
+	}()
+
+	return fn(input)
+}
+
+func marshal(value any) []byte {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	return data
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicies = `
+@id("view")
+permit(principal == User::"alice", action == Action::"view", resource)
+when { context.mfa && resource.owner == principal };
+`
+
+func TestAuthorizeJson(t *testing.T) {
+	input := `{
+		"policies": ` + quote(testPolicies) + `,
+		"entities": [{"uid": {"type": "Photo", "id": "a"}, "attrs": {"owner": {"__entity": {"type": "User", "id": "alice"}}}, "parents": []}],
+		"principal": "User::\"alice\"",
+		"action": {"type": "Action", "id": "view"},
+		"resource": {"type": "Photo", "id": "a"},
+		"context": {"mfa": true}
+	}`
+
+	var output authorizeOutput
+	require.NoError(t, json.Unmarshal(authorizeJson([]byte(input)), &output))
+	assert.Equal(t, authorizeOutput{Decision: "Allow", Matches: []string{"view"}, Errors: []authorizeError{}}, output)
+
+	// A problem with the input is a Deny with the error
+	require.NoError(t, json.Unmarshal(authorizeJson([]byte(`{"policies": "permit("}`)), &output))
+	assert.Equal(t, "Deny", output.Decision)
+	assert.Contains(t, output.Error, "unable to parse policies")
+
+	// An entity string is parsed strictly, as for the object form
+	output = authorizeOutput{}
+	require.NoError(t, json.Unmarshal(authorizeJson([]byte(`{"policies": "", "principal": "bogus"}`)), &output))
+	assert.Equal(t, "Deny", output.Decision)
+	assert.Contains(t, output.Error, `"bogus"`)
+}
+
+func TestRecoverCall(t *testing.T) {
+	output := recoverCall(func([]byte) []byte { panic("boom") }, []byte(`{}`))
+
+	var value map[string]string
+	require.NoError(t, json.Unmarshal(output, &value))
+	assert.Equal(t, map[string]string{"error": "internal error: boom"}, value)
+
+	assert.Equal(t, `{"ok":true}`, string(recoverCall(func(data []byte) []byte { return data }, []byte(`{"ok":true}`))))
+}
+
+func TestParseJson(t *testing.T) {
+	var output struct {
+		Policies []map[string]any `json:"policies"`
+		Error    string           `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(parseJson([]byte(`{"policies": `+quote(testPolicies)+`}`)), &output))
+	assert.Empty(t, output.Error)
+	require.Len(t, output.Policies, 1)
+	assert.Equal(t, "permit", output.Policies[0]["effect"])
+}
+
+func TestValidateJson(t *testing.T) {
+	schemaText := `entity User; entity Photo; action view appliesTo { principal: User, resource: Photo };`
+	input := `{"policies": "permit(principal, action == Action::\"edit\", resource);", "schema": ` + quote(schemaText) + `}`
+
+	var output validateOutput
+	require.NoError(t, json.Unmarshal(validateJson([]byte(input)), &output))
+	assert.Empty(t, output.Error)
+	assert.NotEmpty(t, output.Problems)
+
+	require.NoError(t, json.Unmarshal(validateJson([]byte(`{"policies": ""}`)), &output))
+	assert.Equal(t, "schema must be provided", output.Error)
+}
+
+func quote(value string) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
@@ -0,0 +1,115 @@
+package cedar
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/koblas/cedar-go/engine"
+)
+
+var ErrRouteNotFound = errors.New("no route matches the request")
+
+// RequestMapper builds the authorization request for an incoming HTTP
+// request, typically the principal comes from a verified token or session.
+type RequestMapper func(r *http.Request) (*Request, error)
+
+// Middleware authorizes each HTTP request before passing it to the handler,
+// requests which aren't authorized are denied with 403 Forbidden. When the
+// mapper returns ErrRouteNotFound the response is 404 Not Found.
+func Middleware(auth *SchemaAuthorizer, mapper RequestMapper) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			request, err := mapper(r)
+			if errors.Is(err, ErrRouteNotFound) {
+				http.NotFound(w, r)
+				return
+			}
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			allowed, err := auth.IsAuthorized(r.Context(), request)
+			if err != nil || !allowed {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RESTMapper maps requests onto actions named by the method and the first
+// of the route patterns that matches the path, e.g. `Action::"GET /photos/{id}"`.
+// In a pattern `{name}` matches a single segment and a final `{name...}` the
+// rest of the path.
+//
+// The resource is the path (e.g. `Path::"/photos/42"`) and the context holds
+// the `method`, `path` and the matched `params`. The principal is provided by
+// the principal function.
+func RESTMapper(principal func(r *http.Request) (engine.EntityValue, error), patterns ...string) RequestMapper {
+	return func(r *http.Request) (*Request, error) {
+		for _, pattern := range patterns {
+			params, ok := matchRoute(pattern, r.URL.Path)
+			if !ok {
+				continue
+			}
+
+			who, err := principal(r)
+			if err != nil {
+				return nil, err
+			}
+			vars, err := NewContextFromMap(map[string]any{
+				"method": r.Method,
+				"path":   r.URL.Path,
+				"params": params,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			return &Request{
+				Principal: who,
+				Action:    NewEntity("Action", r.Method+" "+pattern),
+				Resource:  NewEntity("Path", r.URL.Path),
+				Context:   vars,
+			}, nil
+		}
+
+		return nil, ErrRouteNotFound
+	}
+}
+
+// matchRoute matches the path against the pattern, returning the values of
+// the named segments
+func matchRoute(pattern, path string) (map[string]any, bool) {
+	want := strings.Split(strings.Trim(pattern, "/"), "/")
+	have := strings.Split(strings.Trim(path, "/"), "/")
+
+	params := map[string]any{}
+	for i, segment := range want {
+		name, isParam := strings.CutPrefix(segment, "{")
+		name, _ = strings.CutSuffix(name, "}")
+		if rest, found := strings.CutSuffix(name, "..."); isParam && found && i == len(want)-1 {
+			params[rest] = strings.Join(have[i:], "/")
+			return params, true
+		}
+		if i >= len(have) {
+			return nil, false
+		}
+		if !isParam {
+			if segment != have[i] {
+				return nil, false
+			}
+			continue
+		}
+		if have[i] == "" {
+			return nil, false
+		}
+		params[name] = have[i]
+	}
+
+	return params, len(want) == len(have)
+}
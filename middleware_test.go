@@ -0,0 +1,88 @@
+package cedar_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	policies, err := cedar.ParsePolicies(`
+	permit(principal, action == Action::"GET /photos/{id}", resource)
+		when { context.params.id != "private" };
+	permit(principal == User::"admin", action, resource);
+	`)
+	require.NoError(t, err)
+	auth := cedar.NewAuthorizer(policies)
+
+	principal := func(r *http.Request) (engine.EntityValue, error) {
+		user := r.Header.Get("X-User")
+		if user == "" {
+			return nil, errors.New("not authenticated")
+		}
+		return cedar.NewEntity("User", user), nil
+	}
+	mapper := cedar.RESTMapper(principal, "/photos/{id}", "/photos", "/files/{path...}")
+
+	handler := cedar.Middleware(auth, mapper)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method string
+		path   string
+		user   string
+		status int
+	}{
+		{http.MethodGet, "/photos/42", "alice", http.StatusOK},
+		{http.MethodGet, "/photos/private", "alice", http.StatusForbidden},
+		{http.MethodDelete, "/photos/42", "alice", http.StatusForbidden},
+		{http.MethodGet, "/photos", "alice", http.StatusForbidden},
+		{http.MethodGet, "/photos/42", "", http.StatusForbidden},
+		{http.MethodDelete, "/photos/42", "admin", http.StatusOK},
+		{http.MethodGet, "/files/a/b.txt", "admin", http.StatusOK},
+		{http.MethodGet, "/videos/42", "admin", http.StatusNotFound},
+		{http.MethodGet, "/photos/42/comments", "admin", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		if test.user != "" {
+			r.Header.Set("X-User", test.user)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		assert.Equal(t, test.status, w.Code, "%s %s as %q", test.method, test.path, test.user)
+	}
+}
+
+func TestRESTMapper(t *testing.T) {
+	principal := func(r *http.Request) (engine.EntityValue, error) {
+		return cedar.NewEntity("User", "alice"), nil
+	}
+	mapper := cedar.RESTMapper(principal, "/albums/{album}/photos/{id}", "/files/{path...}")
+
+	request, err := mapper(httptest.NewRequest(http.MethodPut, "/albums/holiday/photos/42", nil))
+	require.NoError(t, err)
+	assert.Equal(t, cedar.NewEntity("Action", "PUT /albums/{album}/photos/{id}"), request.Action)
+	assert.Equal(t, cedar.NewEntity("Path", "/albums/holiday/photos/42"), request.Resource)
+	params, found := request.Context.Get("params")
+	require.True(t, found)
+	id, _ := params.(*engine.VarValue).Get("id")
+	assert.Equal(t, engine.StrValue("42"), id)
+
+	request, err = mapper(httptest.NewRequest(http.MethodGet, "/files/a/b.txt", nil))
+	require.NoError(t, err)
+	params, _ = request.Context.Get("params")
+	path, _ := params.(*engine.VarValue).Get("path")
+	assert.Equal(t, engine.StrValue("a/b.txt"), path)
+
+	_, err = mapper(httptest.NewRequest(http.MethodGet, "/albums/holiday", nil))
+	assert.ErrorIs(t, err, cedar.ErrRouteNotFound)
+}
@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/koblas/cedar-go/scanner"
+	"github.com/koblas/cedar-go/token"
+)
+
+// ParseError is a syntax error of a policy source, with the line of the
+// source it is on
+type ParseError struct {
+	Pos  token.Position
+	Msg  string
+	Line string // the source line of the error, without the line ending
+}
+
+func (e *ParseError) Error() string {
+	if e.Pos.Filename != "" || e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Msg
+	}
+	return e.Msg
+}
+
+// Snippet returns the source line of the error followed by a line with a
+// caret under the column of the error, it is empty when the line is unknown
+func (e *ParseError) Snippet() string {
+	if e.Line == "" || e.Pos.Column < 1 {
+		return ""
+	}
+
+	prefix := e.Line
+	if e.Pos.Column-1 < len(prefix) {
+		prefix = prefix[:e.Pos.Column-1]
+	}
+
+	// Tabs are kept so the caret lines up however they are displayed
+	var marker strings.Builder
+	for _, ch := range prefix {
+		if ch == '\t' {
+			marker.WriteRune('\t')
+		} else {
+			marker.WriteRune(' ')
+		}
+	}
+	marker.WriteRune('^')
+
+	return e.Line + "\n" + marker.String()
+}
+
+// ParseErrors are the syntax errors of a policy source sorted by position,
+// ParseRules and ParseExpr return them rather than a scanner.ErrorList
+type ParseErrors []*ParseError
+
+// NewParseErrors converts the errors found while parsing src
+func NewParseErrors(list scanner.ErrorList, src []byte) ParseErrors {
+	lines := bytes.Split(src, []byte("\n"))
+
+	result := make(ParseErrors, 0, len(list))
+	for _, item := range list {
+		perr := &ParseError{Pos: item.Pos, Msg: item.Msg}
+		if item.Pos.Line >= 1 && item.Pos.Line <= len(lines) {
+			perr.Line = string(bytes.TrimSuffix(lines[item.Pos.Line-1], []byte("\r")))
+		}
+		result = append(result, perr)
+	}
+	return result
+}
+
+func (p ParseErrors) Error() string {
+	switch len(p) {
+	case 0:
+		return "no errors"
+	case 1:
+		return p[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", p[0], len(p)-1)
+}
+
+// Unwrap returns the errors of the list
+func (p ParseErrors) Unwrap() []error {
+	result := make([]error, len(p))
+	for i, item := range p {
+		result[i] = item
+	}
+	return result
+}
+
+// parseErrors converts a scanner.ErrorList to ParseErrors, other errors are
+// returned unchanged
+func parseErrors(err error, src []byte) error {
+	if list, ok := err.(scanner.ErrorList); ok {
+		return NewParseErrors(list, src)
+	}
+	return err
+}
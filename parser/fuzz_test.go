@@ -0,0 +1,41 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/koblas/cedar-go/cst"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/token"
+)
+
+func FuzzParseRules(f *testing.F) {
+	for _, seed := range []string{
+		`permit(principal, action, resource);`,
+		`@id("a") forbid(principal == User::"alice", action in [Action::"view", Action::"edit"], resource in Album::"jane");`,
+		`permit(principal == ?principal, action, resource is Photo in ?resource) when { context.ip.isInRange(ip("10.0.0.0/8")) };`,
+		`permit(principal, action, resource) when { if principal has age then principal.age >= 18 else false } unless { resource.name like "*.tmp" };`,
+		`permit(principal, action, resource) when { {a: [1, -2, "x\u{1F600}"], "b": decimal("1.5")}.a.containsAll([1]) && !(1 + 2 * 3 < 4) };`,
+		`// comment
+permit(principal, action, resource) /* block */ when { context["key"] == Ns::Type::"id" };`,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		// the policies are only required not to panic
+		parser.ParseRules(src)
+
+		file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ParseComments)
+		if err != nil {
+			return
+		}
+		// the canonical form of valid policies must parse
+		output, err := cst.Sprint(file)
+		if err != nil {
+			t.Fatalf("unable to print %q: %s", src, err)
+		}
+		if _, err := parser.ParseFile(token.NewFileSet(), "", output, parser.ParseComments); err != nil {
+			t.Fatalf("unable to parse the canonical form %q of %q: %s", output, src, err)
+		}
+	})
+}
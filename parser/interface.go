@@ -8,9 +8,13 @@ package parser
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"sort"
 
 	"github.com/koblas/cedar-go/cst"
 	"github.com/koblas/cedar-go/engine"
@@ -46,12 +50,100 @@ func readSource(filename string, src interface{}) ([]byte, error) {
 type Mode uint
 
 const (
-	ParseComments     Mode = 1 << iota // parse comments and add them to AST
-	Trace                              // print a trace of parsed productions
-	DeclarationErrors                  // report declaration errors
-	AllErrors                          // report all errors (not just the first 10 on different lines)
+	ParseComments        Mode = 1 << iota // parse comments and add them to AST
+	Trace                                 // print a trace of parsed productions
+	DeclarationErrors                     // report declaration errors
+	AllErrors                             // report all errors (not just the first 10 on different lines)
+	ArithmeticExtensions                  // allow the '/' and '%' operators which aren't part of Cedar
+	StrictSyntax                          // report the trailing commas of lists which Cedar doesn't allow
 )
 
+// An Option configures ParseRules and ParseExpr
+type Option func(*options)
+
+type options struct {
+	mode      Mode
+	stableIds bool
+	limits    limits
+}
+
+// limits of the parser, a limit which is zero isn't checked
+type limits struct {
+	maxBytes    int
+	maxNestLev  int
+	maxPolicies int
+	prior       int // the policies of the sources parsed before
+}
+
+// ErrDuplicatePolicyId is returned when two policies have the same id
+var ErrDuplicatePolicyId = errors.New("duplicate policy id")
+
+// ErrLimitExceeded is returned when the source is over one of the limits of
+// WithLimits
+var ErrLimitExceeded = errors.New("parse limit exceeded")
+
+// WithLimits bounds the input for services which parse policies submitted by
+// users: the size of the source in bytes, how deeply expressions are nested
+// and the number of policies. Each operator of a chain such as `a + b + c` is
+// a level of nesting. A limit of zero isn't checked, the nesting depth is
+// then bounded by a default which keeps the parser from exhausting the stack.
+// With ParseFiles the limits of size and policies are for all of the files
+// together.
+func WithLimits(maxBytes, maxNestingDepth, maxPolicies int) Option {
+	return func(opts *options) {
+		opts.limits = limits{maxBytes: maxBytes, maxNestLev: maxNestingDepth, maxPolicies: maxPolicies}
+	}
+}
+
+// WithArithmeticExtensions allows the `/` and `%` operators, which are not
+// part of the Cedar language, in expressions
+func WithArithmeticExtensions() Option {
+	return func(opts *options) {
+		opts.mode |= ArithmeticExtensions
+	}
+}
+
+// WithStrictSyntax reports a trailing comma in a set, an action list or the
+// arguments of a call as a syntax error, as Cedar does. By default they are
+// accepted, as policies written by other tools sometimes have them.
+func WithStrictSyntax() Option {
+	return func(opts *options) {
+		opts.mode |= StrictSyntax
+	}
+}
+
+// CompatibilityFlags names the behaviours of the parser with the options
+// which differ from the Cedar language: "arithmetic-extensions" for
+// WithArithmeticExtensions and "trailing-commas" unless WithStrictSyntax
+func CompatibilityFlags(opts ...Option) []string {
+	config := newOptions(0, opts)
+	flags := []string{}
+	if config.mode&ArithmeticExtensions != 0 {
+		flags = append(flags, "arithmetic-extensions")
+	}
+	if config.mode&StrictSyntax == 0 {
+		flags = append(flags, "trailing-commas")
+	}
+	return flags
+}
+
+// WithStableIds derives the id of a policy without an `@id` annotation from a
+// hash of its canonical text, rather than from its position in the source,
+// so that adding or removing a policy doesn't change the ids of the others
+func WithStableIds() Option {
+	return func(opts *options) {
+		opts.stableIds = true
+	}
+}
+
+func newOptions(mode Mode, opts []Option) options {
+	result := options{mode: mode}
+	for _, opt := range opts {
+		opt(&result)
+	}
+	return result
+}
+
 // ParseFile parses the source code of a single Go source file and returns
 // the corresponding cst.File node. The source code may be provided via
 // the filename of the source file, or via the src parameter.
@@ -81,6 +173,13 @@ func ParseFile(fset *token.FileSet, filename string, src interface{}, mode Mode)
 		return nil, err
 	}
 
+	f, _, err = parseFile(fset, filename, text, options{mode: mode})
+	return
+}
+
+// parseFile parses the source with the limits of the options, exceeded is
+// set when parsing stopped at a limit
+func parseFile(fset *token.FileSet, filename string, text []byte, config options) (f *cst.File, exceeded bool, err error) {
 	var p parser
 	defer func() {
 		if e := recover(); e != nil {
@@ -102,48 +201,240 @@ func ParseFile(fset *token.FileSet, filename string, src interface{}, mode Mode)
 		}
 
 		p.errors.Sort()
+		exceeded = p.exceeded
 		err = p.errors.Err()
 	}()
 
 	// parse source
-	p.init(fset, filename, text, mode)
+	p.init(fset, filename, text, config.mode)
+	p.setLimits(config.limits)
 	f = p.parseFile()
 
 	return
 }
 
-func ParseRules(src string) (engine.PolicyList, error) {
+// parseSource parses the source with the limits of the options, syntax
+// errors are returned as ParseErrors
+func parseSource(fset *token.FileSet, filename string, src string, config options) (*cst.File, error) {
+	if config.limits.maxBytes > 0 && len(src) > config.limits.maxBytes {
+		return nil, fmt.Errorf("%ssource is %d bytes, the limit is %d: %w", filePrefix(filename), len(src), config.limits.maxBytes, ErrLimitExceeded)
+	}
+
+	data, exceeded, err := parseFile(fset, filename, []byte(src), config)
+	if err != nil {
+		err = parseErrors(err, []byte(src))
+		if exceeded {
+			err = fmt.Errorf("%w: %w", ErrLimitExceeded, err)
+		}
+	}
+	return data, err
+}
+
+func filePrefix(filename string) string {
+	if filename == "" {
+		return ""
+	}
+	return filename + ": "
+}
+
+// ParseRules parses the policies, it is an error for two of them to have the
+// same id. Syntax errors are returned as ParseErrors.
+func ParseRules(src string, opts ...Option) (engine.PolicyList, error) {
+	return parseRules(src, newOptions(0, opts))
+}
+
+func ParseRulesTrace(src string) (engine.PolicyList, error) {
+	return parseRules(src, options{mode: Trace})
+}
+
+func parseRules(src string, config options) (engine.PolicyList, error) {
 	fset := token.NewFileSet()
-	data, err := ParseFile(fset, "", src, 0)
+	base := fset.Base()
+	data, err := parseSource(fset, "", src, config)
 	if err != nil {
 		return nil, err
 	}
 
-	var policies engine.PolicyList
-	// There is only one
-	fset.Iterate(func(file *token.File) bool {
-		policies, err = cst.ToAst(file, data)
-
-		return true
-	})
+	policies, err := toPolicies(fset.File(token.Pos(base)), data, config)
+	if err != nil {
+		return nil, err
+	}
 
-	return policies, err
+	return policies, checkIds(policies)
 }
 
-func ParseRulesTrace(src string) (engine.PolicyList, error) {
+// ParseRulesWithCST parses the policies along with the comments, returning
+// both the syntax tree of the source and the policies for tools such as
+// formatters, linters and documentation generators. The policies are in the
+// order of the statements of cst.File.Policies, the i-th policy is converted
+// from the i-th statement, and have the same ids as with ParseRules. The
+// positions of the syntax tree are those of the returned file set. With syntax
+// errors the syntax tree is partial and the errors are ParseErrors.
+func ParseRulesWithCST(src string, opts ...Option) (*cst.File, engine.PolicyList, *token.FileSet, error) {
+	config := newOptions(ParseComments, opts)
 	fset := token.NewFileSet()
-	data, err := ParseFile(fset, "", src, Trace)
+	base := fset.Base()
+	data, err := parseSource(fset, "", src, config)
+	if err != nil {
+		return data, nil, fset, err
+	}
+
+	policies, err := toPolicies(fset.File(token.Pos(base)), data, config)
+	if err == nil {
+		err = checkIds(policies)
+	}
+	if err != nil {
+		return data, nil, fset, err
+	}
+
+	return data, policies, fset, nil
+}
+
+// ParseFiles parses the policies of the sources keyed by their filename, the
+// policies are combined in the order of the filenames and each remembers the
+// file it is from in its StartPos. The syntax errors of all of the files are
+// returned together as ParseErrors. The ids of the policies without an `@id`
+// annotation are numbered across the files, as if they were one source.
+func ParseFiles(fset *token.FileSet, files map[string]string, opts ...Option) (engine.PolicyList, error) {
+	config := newOptions(0, opts)
+
+	filenames := make([]string, 0, len(files))
+	for filename := range files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	if config.limits.maxBytes > 0 {
+		size := 0
+		for _, src := range files {
+			size += len(src)
+		}
+		if size > config.limits.maxBytes {
+			return nil, fmt.Errorf("sources are %d bytes, the limit is %d: %w", size, config.limits.maxBytes, ErrLimitExceeded)
+		}
+	}
+
+	var errs ParseErrors
+	result := engine.PolicyList{}
+	for _, filename := range filenames {
+		src := files[filename]
+		base := fset.Base()
+		fileConfig := config
+		fileConfig.limits.prior = len(result)
+		data, err := parseSource(fset, filename, src, fileConfig)
+		var list ParseErrors
+		if errors.As(err, &list) && !errors.Is(err, ErrLimitExceeded) {
+			errs = append(errs, list...)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		policies, err := toPolicies(fset.File(token.Pos(base)), data, config)
+		if err != nil {
+			return nil, err
+		}
+		if !config.stableIds {
+			for idx, item := range policies {
+				if _, found := item.Annotations["id"]; !found {
+					item.Id = fmt.Sprintf("policy%d", len(result)+idx)
+				}
+			}
+		}
+		result = append(result, policies...)
+	}
+	if len(errs) != 0 {
+		return nil, errs
+	}
+
+	return result, checkIds(result)
+}
+
+// toPolicies converts the parsed file to its policies
+func toPolicies(file *token.File, data *cst.File, config options) (engine.PolicyList, error) {
+	policies, err := cst.ToAst(file, data)
+	if err == nil && config.stableIds {
+		err = setStableIds(data, policies)
+	}
 	if err != nil {
 		return nil, err
 	}
+	return policies, nil
+}
+
+// setStableIds replaces the ids of the policies without an `@id` annotation
+// with a hash of their canonical text, the policies are in the order of the
+// statements of the file
+func setStableIds(file *cst.File, policies engine.PolicyList) error {
+	idx := 0
+	for _, item := range file.Statements {
+		stmt, ok := item.(*cst.PolicyStmt)
+		if !ok {
+			continue
+		}
+		policy := policies[idx]
+		idx += 1
+		if _, found := policy.Annotations["id"]; found {
+			continue
+		}
+
+		text, err := cst.PolicyText(stmt)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256([]byte(text))
+		policy.Id = "policy" + hex.EncodeToString(sum[:8])
+	}
+	return nil
+}
+
+// checkIds returns an error for the first id shared by two policies
+func checkIds(policies engine.PolicyList) error {
+	seen := make(map[string]*engine.Policy, len(policies))
+	for _, item := range policies {
+		if prev, found := seen[item.Id]; found {
+			return fmt.Errorf("policy %q at %s and %s: %w", item.Id, prev.StartPos, item.StartPos, ErrDuplicatePolicyId)
+		}
+		seen[item.Id] = item
+	}
+	return nil
+}
+
+// ParseExpr parses a single expression, such as the condition of a policy
+// without the `when { }`, and returns its AST. Syntax errors are returned as
+// ParseErrors.
+func ParseExpr(src string, opts ...Option) (node engine.EvalNode, err error) {
+	config := newOptions(0, opts)
+	fset := token.NewFileSet()
+	if config.limits.maxBytes > 0 && len(src) > config.limits.maxBytes {
+		return nil, fmt.Errorf("source is %d bytes, the limit is %d: %w", len(src), config.limits.maxBytes, ErrLimitExceeded)
+	}
+
+	var p parser
+	var expr cst.Expr
+	defer func() {
+		if e := recover(); e != nil {
+			// resume same panic if it's not a bailout
+			if _, ok := e.(bailout); !ok {
+				panic(e)
+			}
+		}
 
-	var policies engine.PolicyList
-	// There is only one
-	fset.Iterate(func(file *token.File) bool {
-		policies, err = cst.ToAst(file, data)
+		p.errors.Sort()
+		if err = p.errors.Err(); err != nil {
+			node, err = nil, parseErrors(err, []byte(src))
+			if p.exceeded {
+				err = fmt.Errorf("%w: %w", ErrLimitExceeded, err)
+			}
+			return
+		}
+		node, err = cst.ExprToAst(p.file, expr)
+	}()
 
-		return true
-	})
+	p.init(fset, "", []byte(src), config.mode)
+	p.setLimits(config.limits)
+	expr = p.parseExpr()
+	p.expect(token.EOF)
 
-	return policies, err
+	return
 }
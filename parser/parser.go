@@ -19,6 +19,11 @@ type parser struct {
 	trace  bool // == (mode & Trace != 0)
 	indent int  // indentation used for tracing output
 
+	// Limits
+	limits   limits
+	nestLev  int  // expression nesting level
+	exceeded bool // parsing stopped at a limit
+
 	// Comments
 	comments    []*cst.CommentGroup
 	leadComment *cst.CommentGroup // last lead comment
@@ -45,6 +50,17 @@ func (p *parser) init(fset *token.FileSet, filename string, src []byte, mode Mod
 	p.next()
 }
 
+// maxNestLev is the nesting depth of expressions when it isn't limited by the
+// options, deeper expressions could exhaust the stack
+const maxNestLev = 10000
+
+func (p *parser) setLimits(limits limits) {
+	p.limits = limits
+	if p.limits.maxNestLev <= 0 {
+		p.limits.maxNestLev = maxNestLev
+	}
+}
+
 // ----------------------------------------------------------------------------
 // Parsing support
 
@@ -207,6 +223,26 @@ func (p *parser) error(pos token.Pos, msg string) {
 	p.errors.Add(epos, msg)
 }
 
+// exceed reports that the source is over a limit and stops parsing
+func (p *parser) exceed(pos token.Pos, msg string) {
+	p.errors.Add(p.file.Position(pos), msg)
+	p.exceeded = true
+	panic(bailout{})
+}
+
+// Usage pattern: defer decNestLev(incNestLev(p))
+func incNestLev(p *parser) *parser {
+	p.nestLev++
+	if p.nestLev > p.limits.maxNestLev {
+		p.exceed(p.pos, fmt.Sprintf("expression is nested more than %d deep", p.limits.maxNestLev))
+	}
+	return p
+}
+
+func decNestLev(p *parser) {
+	p.nestLev--
+}
+
 func (p *parser) errorExpected(pos token.Pos, msg string) {
 	msg = "expected " + msg
 	if pos == p.pos {
@@ -242,10 +278,22 @@ func (p *parser) parseReceiverInits() []cst.ReceiverInit {
 	}
 
 	var result []cst.ReceiverInit
+	seen := map[string]bool{}
 
 	for p.tok == token.STRINGLIT || p.tok == token.IDENTIFER {
 		lit := cst.BasicLit{ValuePos: p.pos, Kind: p.tok, Value: p.lit}
 		p.next()
+
+		// an invalid escape is reported when the tree is converted
+		key := lit.Value
+		if lit.Kind == token.STRINGLIT {
+			key, _ = scanner.Unquote(lit.Value)
+		}
+		if seen[key] {
+			p.error(lit.ValuePos, fmt.Sprintf("duplicate key %s in record", lit.Value))
+		}
+		seen[key] = true
+
 		p.expect(token.COLON)
 		expr := p.parseExpr()
 
@@ -266,7 +314,9 @@ func (p *parser) parseReceiverInits() []cst.ReceiverInit {
 }
 
 // ----------------------------------------------------------------------------
-// ExprList ::= Expr {',' Expr}
+// ExprList ::= Expr {',' Expr} [',']
+//
+// The trailing comma isn't part of Cedar, it is reported with StrictSyntax
 func (p *parser) parseExprList(endTok token.Token) ([]cst.Expr, token.Pos) {
 	if p.trace {
 		defer un(trace(p, "ExprList"))
@@ -278,7 +328,14 @@ func (p *parser) parseExprList(endTok token.Token) ([]cst.Expr, token.Pos) {
 
 	exprs := []cst.Expr{p.parseExpr()}
 	for p.tok == token.COMMA {
+		pos := p.pos
 		p.next()
+		if p.tok == endTok {
+			if p.mode&StrictSyntax != 0 {
+				p.error(pos, "trailing comma is not supported by Cedar")
+			}
+			break
+		}
 
 		exprs = append(exprs, p.parseExpr())
 	}
@@ -414,6 +471,7 @@ func (p *parser) parsePrimary() cst.Expr {
 		}
 	}
 
+	pos := p.pos
 	entity := p.parseEntityOrPath(false, false)
 
 	if ref, ok := entity.(*cst.EntityName); ok {
@@ -435,7 +493,11 @@ func (p *parser) parsePrimary() cst.Expr {
 		}
 	}
 
-	return nil
+	// the error has been reported, a bad expression keeps the tree valid
+	return &cst.BadExpr{
+		From: pos,
+		To:   p.pos,
+	}
 }
 
 // ----------------------------------------------------------------------------
@@ -462,7 +524,7 @@ func (p *parser) parseAccess() *cst.MemberAccess {
 		}
 	} else if p.tok == token.PERIOD {
 		p.next()
-		ident = p.parseIdent()
+		ident = p.parseAttrName()
 	} else {
 		return nil
 	}
@@ -537,6 +599,8 @@ func (p *parser) parseUnary() cst.Expr {
 		return p.parseMember()
 	}
 
+	defer decNestLev(incNestLev(p))
+
 	tok := p.tok
 	p.next()
 	return &cst.UnaryExpr{
@@ -548,26 +612,35 @@ func (p *parser) parseUnary() cst.Expr {
 
 // ----------------------------------------------------------------------------
 // Mult ::= Unary { '*' Unary}
+//
+// With ArithmeticExtensions '/' and '%' are also multiplicative operators
 func (p *parser) parseMult() cst.Expr {
 	if p.trace {
 		defer un(trace(p, "Mult"))
 	}
 
 	lhs := p.parseUnary()
-	if p.tok != token.MUL {
-		return lhs
+	// Each operator of a chain is a level of the tree, `1 + 2 + 3` is
+	// `(1 + 2) + 3`
+	defer func(nestLev int) { p.nestLev = nestLev }(p.nestLev)
+	for p.tok == token.MUL || p.tok == token.QUO || p.tok == token.REM {
+		incNestLev(p)
+		tok := p.tok
+		pos := p.pos
+		if tok != token.MUL && p.mode&ArithmeticExtensions == 0 {
+			p.error(pos, fmt.Sprintf("operator %s is not supported by Cedar", tok))
+		}
+		p.next()
+		lhs = &cst.BinaryExpr{
+			From:  lhs.Pos(),
+			X:     lhs,
+			OpPos: pos,
+			Op:    tok,
+			Y:     p.parseUnary(),
+		}
 	}
-	tok := p.tok
-	pos := p.pos
-	p.next()
-	rhs := p.parseMult()
 
-	return &cst.BinaryExpr{
-		X:     lhs,
-		OpPos: pos,
-		Op:    tok,
-		Y:     rhs,
-	}
+	return lhs
 }
 
 // ----------------------------------------------------------------------------
@@ -578,24 +651,28 @@ func (p *parser) parseAdd() cst.Expr {
 	}
 
 	lhs := p.parseMult()
-	if p.tok != token.ADD && p.tok != token.SUB {
-		return lhs
+	// Each operator of a chain is a level of the tree, `1 + 2 + 3` is
+	// `(1 + 2) + 3`
+	defer func(nestLev int) { p.nestLev = nestLev }(p.nestLev)
+	for p.tok == token.ADD || p.tok == token.SUB {
+		incNestLev(p)
+		tok := p.tok
+		pos := p.pos
+		p.next()
+		lhs = &cst.BinaryExpr{
+			From:  lhs.Pos(),
+			X:     lhs,
+			OpPos: pos,
+			Op:    tok,
+			Y:     p.parseMult(),
+		}
 	}
-	tok := p.tok
-	pos := p.pos
-	p.next()
-	rhs := p.parseAdd()
 
-	return &cst.BinaryExpr{
-		X:     lhs,
-		OpPos: pos,
-		Op:    tok,
-		Y:     rhs,
-	}
+	return lhs
 }
 
 // ----------------------------------------------------------------------------
-// Relation ::= Add [RELOP Add] | Add 'has' (IDENT | STR) | Add 'like' PAT
+// Relation ::= Add [RELOP Add] | Add 'has' (IDENT {'.' IDENT} | STR) | Add 'like' PAT | Add 'is' Path ['in' Add]
 func (p *parser) parseRelation() cst.Expr {
 	if p.trace {
 		defer un(trace(p, "Relation"))
@@ -614,6 +691,7 @@ func (p *parser) parseRelation() cst.Expr {
 		rhs := p.parseAdd()
 
 		return &cst.BinaryExpr{
+			From:  lhs.Pos(),
 			X:     lhs,
 			OpPos: pos,
 			Op:    tok,
@@ -621,7 +699,12 @@ func (p *parser) parseRelation() cst.Expr {
 		}
 	case token.HAS:
 		p.next()
-		if p.tok != token.STRINGLIT && p.tok != token.IDENTIFER {
+		var attr cst.Expr
+		if p.tok == token.STRINGLIT {
+			attr = p.parseString()
+		} else if p.tok == token.IDENTIFER || p.tok.IsKeyword() {
+			attr = p.parseAttrPath()
+		} else {
 			p.error(p.pos, "expected string")
 
 			bad := &cst.BadExpr{
@@ -632,14 +715,27 @@ func (p *parser) parseRelation() cst.Expr {
 
 			return bad
 		}
-		lit := &cst.BasicLit{ValuePos: p.pos, Kind: p.tok, Value: p.lit}
-		p.next()
 		return &cst.BinaryExpr{
+			From:  lhs.Pos(),
 			X:     lhs,
 			OpPos: pos,
 			Op:    tok,
-			Y:     lit,
+			Y:     attr,
+		}
+	case token.IS:
+		p.next()
+		// The error has been reported when it isn't a path
+		path, ok := p.parseEntityOrPath(false, true).(*cst.Path)
+		if !ok {
+			return &cst.BadExpr{From: lhs.Pos(), To: p.pos}
 		}
+		node := &cst.IsExpr{X: lhs, IsPos: pos, Type: path}
+		if p.tok == token.IN {
+			node.InPos = p.pos
+			p.next()
+			node.In = p.parseAdd()
+		}
+		return node
 	case token.LIKE:
 		p.next()
 		if p.tok != token.STRINGLIT {
@@ -649,6 +745,7 @@ func (p *parser) parseRelation() cst.Expr {
 		lit := &cst.BasicLit{ValuePos: p.pos, Kind: p.tok, Value: p.lit}
 		p.next()
 		return &cst.BinaryExpr{
+			From:  lhs.Pos(),
 			X:     lhs,
 			OpPos: pos,
 			Op:    tok,
@@ -670,12 +767,15 @@ func (p *parser) parseAnd() cst.Expr {
 	if p.tok != token.LAND {
 		return lhs
 	}
+	defer decNestLev(incNestLev(p))
+
 	tok := p.tok
 	pos := p.pos
 	p.next()
 	rhs := p.parseAnd()
 
 	return &cst.BinaryExpr{
+		From:  lhs.Pos(),
 		X:     lhs,
 		OpPos: pos,
 		Op:    tok,
@@ -694,12 +794,15 @@ func (p *parser) parseOr() cst.Expr {
 	if p.tok != token.LOR {
 		return lhs
 	}
+	defer decNestLev(incNestLev(p))
+
 	tok := p.tok
 	pos := p.pos
 	p.next()
 	rhs := p.parseOr()
 
 	return &cst.BinaryExpr{
+		From:  lhs.Pos(),
 		X:     lhs,
 		OpPos: pos,
 		Op:    tok,
@@ -734,6 +837,8 @@ func (p *parser) parseExpr() cst.Expr {
 	if p.trace {
 		defer un(trace(p, "Expr"))
 	}
+	defer decNestLev(incNestLev(p))
+
 	if p.tok == token.IF {
 		return p.parseIf()
 	} else {
@@ -838,17 +943,18 @@ func (p *parser) parsePrincipalResource(expect token.Token) cst.Variable {
 	}
 
 	if p.tok == token.IS {
-		p.next()
 		node.IsPos = p.pos
-		expr := p.parseEntityOrPath(false, true)
-		if expr != nil {
-			return node
-		}
-		path, ok := expr.(*cst.Path)
+		p.next()
+		// The error has been reported when it isn't a path
+		path, ok := p.parseEntityOrPath(false, true).(*cst.Path)
 		if !ok {
 			return node
 		}
 		node.IsCheck = &cst.EntityName{Path: append(path.Path, cst.BasicLit{Kind: token.STRINGLIT})}
+		// Only `in` can follow the type
+		if p.tok != token.IN {
+			return node
+		}
 	}
 
 	node.RelOp = p.tok
@@ -905,6 +1011,52 @@ func (p *parser) parseIdent() *cst.BasicLit {
 	return &cst.BasicLit{ValuePos: pos, Kind: token.IDENTIFER, Value: name}
 }
 
+// parseAttrName consumes the attribute name after `.` or `has`, which may be
+// a keyword such as `principal` but not a reserved word such as `if`
+func (p *parser) parseAttrName() *cst.BasicLit {
+	if p.trace {
+		defer un(trace(p, "AttrName"))
+	}
+
+	isName := p.tok == token.IDENTIFER || p.tok.IsKeyword() && p.tok != token.PRINCIPAL_SLOT && p.tok != token.RESOURCE_SLOT
+	if !isName {
+		return p.parseIdent()
+	}
+
+	pos := p.pos
+	name := p.lit
+	if token.IsReserved(name) {
+		p.error(pos, fmt.Sprintf("%s is a reserved word, use [%q] for the attribute", name, name))
+	}
+	p.next()
+	return &cst.BasicLit{ValuePos: pos, Kind: token.IDENTIFER, Value: name}
+}
+
+// parseAttrPath consumes the attributes of `has`, a path such as `owner.email`
+// is a member expression of the names
+func (p *parser) parseAttrPath() cst.Expr {
+	if p.trace {
+		defer un(trace(p, "AttrPath"))
+	}
+
+	first := p.parseAttrName()
+	if p.tok != token.PERIOD {
+		return first
+	}
+
+	var access []*cst.MemberAccess
+	for p.tok == token.PERIOD {
+		p.next()
+		ident := p.parseAttrName()
+		access = append(access, &cst.MemberAccess{Ident: ident, LparenPos: ident.End(), RparenPos: ident.End()})
+	}
+
+	return &cst.MemberExpr{
+		Primary: first,
+		Access:  access,
+	}
+}
+
 // Consume a string
 func (p *parser) parseString() *cst.BasicLit {
 	if p.trace {
@@ -923,13 +1075,14 @@ func (p *parser) parseString() *cst.BasicLit {
 }
 
 // ----------------------------------------------------------------------------
-// Annotation ::= '@'IDENT'('STR')'
+// Annotation ::= '@'IDENT['('STR')']
 func (p *parser) parseAnnotation() []*cst.AnnotationSpec {
 	if p.trace {
 		defer un(trace(p, "Annotations"))
 	}
 
 	var annotations []*cst.AnnotationSpec
+	seen := map[string]bool{}
 
 	for p.tok == token.AT {
 		node := &cst.AnnotationSpec{
@@ -937,15 +1090,22 @@ func (p *parser) parseAnnotation() []*cst.AnnotationSpec {
 		}
 		p.next()
 		node.Ident = p.parseIdent()
-		node.Lparen = p.expect(token.LPAREN)
-
-		if p.tok == token.STRINGLIT {
-			node.Value = *p.parseString()
-		} else {
-			p.expect(token.STRINGLIT) // use expect() error handling
+		if seen[node.Ident.Value] {
+			p.error(node.TokPos, fmt.Sprintf("duplicate annotation @%s", node.Ident.Value))
 		}
+		seen[node.Ident.Value] = true
 
-		node.Rparen = p.expect(token.RPAREN)
+		// The value is optional
+		if p.tok == token.LPAREN {
+			node.Lparen = p.pos
+			p.next()
+			if p.tok == token.STRINGLIT {
+				node.Value = *p.parseString()
+			} else {
+				p.expect(token.STRINGLIT) // use expect() error handling
+			}
+			node.Rparen = p.expect(token.RPAREN)
+		}
 
 		annotations = append(annotations, node)
 	}
@@ -996,6 +1156,9 @@ func (p *parser) parseFile() *cst.File {
 
 	var stmts []cst.Decl
 	for p.tok != token.EOF {
+		if limit := p.limits.maxPolicies; limit > 0 && p.limits.prior+len(stmts) >= limit {
+			p.exceed(p.pos, fmt.Sprintf("more than %d policies", limit))
+		}
 		stmts = append(stmts, p.parsePolicy())
 	}
 
@@ -1,12 +1,19 @@
 package parser_test
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
+	"github.com/koblas/cedar-go/cst"
+	"github.com/koblas/cedar-go/engine"
 	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/schema"
 	"github.com/koblas/cedar-go/token"
 )
 
@@ -50,6 +57,20 @@ func TestEntityRef(t *testing.T) {
 	`)
 }
 
+func TestAnnotations(t *testing.T) {
+	policies, err := parser.ParseRules(`
+	@id("view-all")
+	@note("say \"hi\"")
+	permit(principal, action, resource);
+	`)
+	assert.NoError(t, err)
+	assert.Len(t, policies, 1)
+
+	// Annotation values are string literals, the id doesn't keep its quotes
+	assert.Equal(t, "view-all", policies[0].Id)
+	assert.Equal(t, map[string]string{"id": "view-all", "note": `say "hi"`}, policies[0].Annotations)
+}
+
 func TestSimpleFail(t *testing.T) {
 	rule := `
 	permit(
@@ -64,6 +85,117 @@ func TestSimpleFail(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestStringEscapes(t *testing.T) {
+	policies, err := parser.ParseRules(`permit(principal, action, resource) when { "a*b" like "a\*b" };`)
+	assert.NoError(t, err)
+	assert.Len(t, policies, 1)
+
+	_, err = parser.ParseFile(token.NewFileSet(), "", `permit(principal, action, resource) when { "\q" };`, 0)
+	assert.ErrorContains(t, err, "1:45: unknown escape sequence")
+
+	_, err = parser.ParseRules(`permit(principal, action, resource) when { "\*" == "*" };`)
+	assert.ErrorContains(t, err, "1:45: escape sequence '\\*' is only valid in a pattern")
+
+	// The pattern escape is an error when parsing, before building the policies
+	_, err = parser.ParseFile(token.NewFileSet(), "", `permit(principal, action, resource) when { "\*" like "\*" };`, 0)
+	assert.ErrorContains(t, err, "1:45: escape sequence '\\*' is only valid in a pattern")
+	assert.NotContains(t, err.Error(), "1:54")
+
+	_, err = parser.ParseFile(token.NewFileSet(), "", `permit(principal, action, resource) when { "\0\x7f\u{1F600}" like "\0*" };`, 0)
+	assert.NoError(t, err)
+}
+
+func TestKeywordAttributes(t *testing.T) {
+	policies, err := parser.ParseRules(`permit(principal, action, resource) when {
+		context.principal == context.action &&
+		context has resource && context has "if" && context["if"].when
+	};`)
+	require.NoError(t, err)
+
+	result, err := engine.Eval(context.TODO(), policies, &engine.Request{
+		Store: schema.EntityStore{},
+		Context: engine.NewVarValue(map[string]engine.NamedType{
+			"principal": engine.IntValue(1),
+			"action":    engine.IntValue(1),
+			"resource":  engine.BoolValue(true),
+			"if":        engine.NewVarValue(map[string]engine.NamedType{"when": engine.BoolValue(true)}),
+		}),
+	})
+	require.NoError(t, err)
+	assert.Empty(t, result.Diagnostics.Errors)
+	assert.Equal(t, engine.Allow, result.Decision)
+
+	for _, word := range []string{"has", "like", "is", "then", "else", "if", "in", "true"} {
+		_, err := parser.ParseRules(`permit(principal, action, resource) when { context.` + word + ` };`)
+		assert.ErrorContains(t, err, "1:52: "+word+" is a reserved word", word)
+
+		_, err = parser.ParseRules(`permit(principal, action, resource) when { context has ` + word + ` };`)
+		assert.ErrorContains(t, err, "1:56: "+word+" is a reserved word", word)
+	}
+}
+
+func TestBracketAccess(t *testing.T) {
+	policies, err := parser.ParseRules(`permit(principal, action, resource) when {
+		context.headers["x-user id"] == "alice" && context["the tags"]["a b"].size == 2
+	};`)
+	require.NoError(t, err)
+
+	request := &engine.Request{
+		Store: schema.EntityStore{},
+		Context: engine.NewVarValue(map[string]engine.NamedType{
+			"headers": engine.NewVarValue(map[string]engine.NamedType{"x-user id": engine.StrValue("alice")}),
+			"the tags": engine.NewVarValue(map[string]engine.NamedType{
+				"a b": engine.NewVarValue(map[string]engine.NamedType{"size": engine.IntValue(2)}),
+			}),
+		}),
+	}
+	result, err := engine.Eval(context.TODO(), policies, request)
+	require.NoError(t, err)
+	assert.Empty(t, result.Diagnostics.Errors)
+	assert.Equal(t, engine.Allow, result.Decision)
+
+	// The index isn't dropped, a missing attribute is an error
+	request.Context = engine.NewVarValue(map[string]engine.NamedType{
+		"headers": engine.NewVarValue(map[string]engine.NamedType{}),
+	})
+	result, err = engine.Eval(context.TODO(), policies, request)
+	require.NoError(t, err)
+	require.Len(t, result.Diagnostics.Errors, 1)
+	assert.Equal(t, engine.Deny, result.Decision)
+}
+
+func TestHasPath(t *testing.T) {
+	policies, err := parser.ParseRules(`permit(principal, action, resource) when { resource has owner.contact.email };`)
+	require.NoError(t, err)
+
+	photo := engine.NewEntityValue("Photo", "a")
+	record := func(values map[string]engine.NamedType) *engine.VarValue {
+		return engine.NewVarValue(values)
+	}
+	for _, item := range []struct {
+		attrs  *engine.VarValue
+		expect engine.Decision
+	}{
+		{record(map[string]engine.NamedType{}), engine.Deny},
+		{record(map[string]engine.NamedType{"owner": record(map[string]engine.NamedType{})}), engine.Deny},
+		{record(map[string]engine.NamedType{"owner": record(map[string]engine.NamedType{"contact": record(map[string]engine.NamedType{})})}), engine.Deny},
+		{record(map[string]engine.NamedType{"owner": record(map[string]engine.NamedType{"contact": record(map[string]engine.NamedType{"email": engine.StrValue("a@b.c")})})}), engine.Allow},
+	} {
+		result, err := engine.Eval(context.TODO(), policies, &engine.Request{
+			Resource: photo,
+			Store:    schema.EntityStore{photo.String(): schema.NewEntityStoreItem(photo, nil, item.attrs)},
+		})
+		require.NoError(t, err)
+		assert.Empty(t, result.Diagnostics.Errors)
+		assert.Equal(t, item.expect, result.Decision, item.attrs.String())
+	}
+
+	_, err = parser.ParseRules(`permit(principal, action, resource) when { resource has owner.if };`)
+	assert.ErrorContains(t, err, "1:63: if is a reserved word")
+	_, err = parser.ParseRules(`permit(principal, action, resource) when { resource has owner.name() };`)
+	assert.Error(t, err)
+}
+
 // Tests from github.com/cedar-policy/cedar/blob/main/cedar-integration-tests/tests/multi
 type DecimalTestSuite struct {
 	suite.Suite
@@ -444,3 +576,338 @@ when
 func TestExampleSuite(t *testing.T) {
 	suite.Run(t, new(ExampleTestSuite))
 }
+
+func TestTemplateSlots(t *testing.T) {
+	policies, err := parser.ParseRules(`permit(principal == ?principal, action, resource in ?resource);`)
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+
+	scope := policies[0].Scope()
+	assert.True(t, scope.Principal.Slot)
+	assert.True(t, scope.Resource.Slot)
+}
+
+func TestArithmeticExtensions(t *testing.T) {
+	_, err := parser.ParseRules(`permit(principal, action, resource) when { 7 / 2 == 3 };`)
+	assert.ErrorContains(t, err, "operator / is not supported by Cedar")
+	_, err = parser.ParseExpr(`7 % 2`)
+	assert.ErrorContains(t, err, "operator % is not supported by Cedar")
+
+	request := &engine.Request{Store: schema.EntityStore{}}
+	expressions := []struct {
+		expr   string
+		expect engine.EvalValue
+		err    error
+	}{
+		{"7 / 2", engine.IntValue(3), nil},
+		{"7 % 2", engine.IntValue(1), nil},
+		{"1 + 6 / 2 * 3", engine.IntValue(10), nil},
+		{"1 / 0", nil, engine.ErrDivisionByZero},
+		{"1 % 0", nil, engine.ErrDivisionByZero},
+		{"-9223372036854775808 / -1", nil, engine.ErrOverflow},
+	}
+	for _, item := range expressions {
+		node, err := parser.ParseExpr(item.expr, parser.WithArithmeticExtensions())
+		require.NoError(t, err, item.expr)
+
+		value, err := engine.EvalExpr(context.TODO(), node, request)
+		if item.err != nil {
+			assert.ErrorIs(t, err, item.err, item.expr)
+		} else {
+			assert.Equal(t, item.expect, value, item.expr)
+		}
+	}
+}
+
+func TestTrailingCommas(t *testing.T) {
+	rules := `
+permit (
+	principal,
+	action in [
+		PhotoApp::Action::"viewPhoto",
+		PhotoApp::Action::"listPhotos",
+	],
+	resource
+) when {
+	context.tags.containsAny(["a", "b",]) &&
+	ip("10.0.0.1",).isLoopback() == false
+};
+`
+	policies, err := parser.ParseRules(rules)
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+
+	scope := policies[0].Scope()
+	assert.Equal(t, []engine.EntityValue{
+		engine.NewEntityValue("PhotoApp::Action", "viewPhoto"),
+		engine.NewEntityValue("PhotoApp::Action", "listPhotos"),
+	}, scope.Action.Entities)
+
+	_, err = parser.ParseRules(rules, parser.WithStrictSyntax())
+	var list parser.ParseErrors
+	require.ErrorAs(t, err, &list)
+	assert.Equal(t, 6, list[0].Pos.Line)
+	assert.Contains(t, list[0].Msg, "trailing comma")
+
+	for _, expr := range []string{`[,]`, `[1,,]`, `ip(,)`} {
+		_, err := parser.ParseExpr(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	policy := "permit(principal, action, resource) when { !!(((context.a))) };\n"
+	rules := strings.Repeat(policy, 3)
+
+	_, err := parser.ParseRules(rules, parser.WithLimits(len(rules), 6, 3))
+	require.NoError(t, err)
+
+	_, err = parser.ParseRules(rules, parser.WithLimits(len(rules)-1, 0, 0))
+	assert.ErrorIs(t, err, parser.ErrLimitExceeded)
+
+	_, err = parser.ParseRules(rules, parser.WithLimits(0, 5, 0))
+	assert.ErrorIs(t, err, parser.ErrLimitExceeded)
+	var list parser.ParseErrors
+	require.ErrorAs(t, err, &list)
+	assert.Equal(t, "expression is nested more than 5 deep", list[0].Msg)
+
+	_, err = parser.ParseRules(rules, parser.WithLimits(0, 0, 2))
+	assert.ErrorIs(t, err, parser.ErrLimitExceeded)
+	require.ErrorAs(t, err, &list)
+	assert.Equal(t, 3, list[0].Pos.Line)
+
+	_, err = parser.ParseFiles(token.NewFileSet(), map[string]string{"a.cedar": policy + policy, "b.cedar": policy}, parser.WithLimits(0, 0, 2))
+	assert.ErrorIs(t, err, parser.ErrLimitExceeded)
+
+	_, err = parser.ParseExpr("-"+strings.Repeat("(", 100)+"1"+strings.Repeat(")", 100), parser.WithLimits(0, 50, 0))
+	assert.ErrorIs(t, err, parser.ErrLimitExceeded)
+
+	// Without a limit the default keeps the parser from exhausting the stack
+	_, err = parser.ParseExpr(strings.Repeat("!", 1000000) + "true")
+	assert.ErrorIs(t, err, parser.ErrLimitExceeded)
+
+	// Each operator of a chain is a level of the tree
+	for _, op := range []string{" + ", " * ", " && ", " || "} {
+		expr := "1" + strings.Repeat(op+"1", 4)
+		_, err = parser.ParseExpr(expr, parser.WithLimits(0, 5, 0))
+		require.NoError(t, err, expr)
+		_, err = parser.ParseExpr(expr+op+"1", parser.WithLimits(0, 5, 0))
+		assert.ErrorIs(t, err, parser.ErrLimitExceeded, expr)
+	}
+	_, err = parser.ParseExpr("1" + strings.Repeat(" + 1", 100000))
+	assert.ErrorIs(t, err, parser.ErrLimitExceeded)
+
+	// Syntax errors are not limits
+	_, err = parser.ParseRules("permit(principal, action, resource) when { 1 + };", parser.WithLimits(100, 10, 1))
+	require.ErrorAs(t, err, &list)
+	assert.NotErrorIs(t, err, parser.ErrLimitExceeded)
+}
+
+// chainVisitor counts the binary expressions which don't record their start
+type chainVisitor struct {
+	count   int
+	missing int
+}
+
+func (v *chainVisitor) Visit(node cst.Node) cst.Visitor {
+	if expr, ok := node.(*cst.BinaryExpr); ok {
+		v.count += 1
+		if !expr.From.IsValid() {
+			v.missing += 1
+		}
+	}
+	return v
+}
+
+func TestLongChain(t *testing.T) {
+	terms := strings.Repeat(" + 1", 9000)
+	src := "permit(principal, action, resource) when { 1" + terms + " > 0 && 2" + strings.Repeat(" * 1", 9000) + " > 0 };"
+
+	// The position of a chain is recorded on each node rather than found by
+	// walking down the chain, which made parsing quadratic
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	require.NoError(t, err)
+	visitor := &chainVisitor{}
+	cst.Walk(visitor, file)
+	assert.Equal(t, 18003, visitor.count)
+	assert.Zero(t, visitor.missing)
+
+	start := time.Now()
+	policies, err := parser.ParseRules(src)
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	node, err := parser.ParseExpr("context.a" + terms)
+	require.NoError(t, err)
+	assert.Equal(t, 1, node.Pos().Column)
+}
+
+func TestStableIds(t *testing.T) {
+	ids := func(policies engine.PolicyList) []string {
+		output := []string{}
+		for _, item := range policies {
+			output = append(output, item.Id)
+		}
+		return output
+	}
+
+	policies, err := parser.ParseRules(`
+	permit(principal, action, resource);
+	@id("named") forbid(principal, action, resource);
+	permit(principal == User::"alice", action, resource) when { true };
+	`, parser.WithStableIds())
+	require.NoError(t, err)
+	all := ids(policies)
+	assert.Equal(t, "named", all[1])
+	assert.Regexp(t, "^policy[0-9a-f]{16}$", all[0])
+	assert.NotEqual(t, all[0], all[2])
+
+	// Removing a policy and reformatting another keeps the ids
+	policies, err = parser.ParseRules(`
+	// the comments and the layout aren't part of the id
+	permit(principal == User::"alice",
+	       action, resource)
+	when { true };
+	`, parser.WithStableIds())
+	require.NoError(t, err)
+	assert.Equal(t, []string{all[2]}, ids(policies))
+
+	policies, err = parser.ParseRules(`
+	permit(principal, action, resource);
+	@id("named") forbid(principal, action, resource);
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"policy0", "named"}, ids(policies))
+}
+
+func TestDuplicatePolicyIds(t *testing.T) {
+	_, err := parser.ParseRules(`
+	@id("a") permit(principal, action, resource);
+	@id("a") forbid(principal, action, resource);
+	`)
+	assert.ErrorIs(t, err, parser.ErrDuplicatePolicyId)
+	assert.ErrorContains(t, err, `policy "a" at 2:2 and 3:2`)
+
+	_, err = parser.ParseRules(`
+	permit(principal, action, resource);
+	@id("policy0") forbid(principal, action, resource);
+	`)
+	assert.ErrorIs(t, err, parser.ErrDuplicatePolicyId)
+
+	// Identical policies have the same stable id
+	_, err = parser.ParseRules(`
+	permit(principal, action, resource);
+	permit(principal, action, resource);
+	`, parser.WithStableIds())
+	assert.ErrorIs(t, err, parser.ErrDuplicatePolicyId)
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := parser.ParseRules("permit(principal, action, resource)\n\twhen { 1 + };\nforbid(principal action, resource);\n")
+	var list parser.ParseErrors
+	require.ErrorAs(t, err, &list)
+	require.Len(t, list, 2)
+
+	assert.Equal(t, 2, list[0].Pos.Line)
+	assert.Equal(t, 13, list[0].Pos.Column)
+	assert.Equal(t, "\twhen { 1 + };\n\t           ^", list[0].Snippet())
+	assert.Equal(t, "forbid(principal action, resource);\n                 ^", list[1].Snippet())
+	assert.Equal(t, list[0].Error(), err.Error()[:len(list[0].Error())])
+
+	var item *parser.ParseError
+	require.ErrorAs(t, err, &item)
+	assert.Equal(t, list[0], item)
+
+	_, err = parser.ParseExpr("1 +")
+	require.ErrorAs(t, err, &list)
+	assert.Equal(t, "1 +\n   ^", list[0].Snippet())
+
+	assert.Equal(t, "", (&parser.ParseError{Msg: "unknown"}).Snippet())
+}
+
+func TestDuplicateRecordKeys(t *testing.T) {
+	_, err := parser.ParseExpr(`{ a: 1, "b": 2 }`)
+	require.NoError(t, err)
+
+	for _, expr := range []string{`{ a: 1, a: 2 }`, `{ a: 1, "a": 2 }`, `{ "\u{61}": 1, a: { b: 1, b: 2 } }`} {
+		_, err := parser.ParseExpr(expr)
+		var list parser.ParseErrors
+		require.ErrorAs(t, err, &list, expr)
+		assert.Contains(t, list[0].Msg, "duplicate key", expr)
+	}
+}
+
+func TestParseFiles(t *testing.T) {
+	fset := token.NewFileSet()
+	policies, err := parser.ParseFiles(fset, map[string]string{
+		"b.cedar": "permit(principal, action, resource) when { principal.level > 1 };",
+		"a.cedar": "@id(\"admin\") permit(principal, action, resource);\n\nforbid(principal, action, resource);",
+	})
+	require.NoError(t, err)
+	require.Len(t, policies, 3)
+	assert.Equal(t, "admin", policies[0].Id)
+	assert.Equal(t, "a.cedar", policies[0].StartPos.Filename)
+	assert.Equal(t, "policy1", policies[1].Id)
+	assert.Equal(t, 3, policies[1].StartPos.Line)
+	assert.Equal(t, "policy2", policies[2].Id)
+	assert.Equal(t, "b.cedar", policies[2].StartPos.Filename)
+
+	// Evaluation errors name the file of the policy
+	result, err := engine.Eval(context.TODO(), policies, &engine.Request{
+		Principal: engine.NewEntityValue("User", "alice"),
+		Store:     schema.EntityStore{},
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Diagnostics.Errors, 1)
+	assert.Equal(t, "b.cedar", result.Diagnostics.Errors[0].Filename)
+	assert.Equal(t, "b.cedar", result.Diagnostics.Errors[0].Detail().Position.Filename)
+
+	// The syntax errors of all of the files are returned
+	_, err = parser.ParseFiles(token.NewFileSet(), map[string]string{
+		"a.cedar": "permit(principal, action, resource) when { 1 + };",
+		"b.cedar": "permit(principal action, resource);",
+		"c.cedar": "permit(principal, action, resource);",
+	})
+	var list parser.ParseErrors
+	require.ErrorAs(t, err, &list)
+	require.Len(t, list, 2)
+	assert.Equal(t, "a.cedar", list[0].Pos.Filename)
+	assert.Equal(t, "b.cedar", list[1].Pos.Filename)
+
+	_, err = parser.ParseFiles(token.NewFileSet(), map[string]string{
+		"a.cedar": `@id("x") permit(principal, action, resource);`,
+		"b.cedar": `@id("x") forbid(principal, action, resource);`,
+	})
+	assert.ErrorIs(t, err, parser.ErrDuplicatePolicyId)
+	assert.ErrorContains(t, err, "a.cedar:1:1 and b.cedar:1:1")
+}
+
+func TestParseRulesWithCST(t *testing.T) {
+	file, policies, fset, err := parser.ParseRulesWithCST(`// anyone can view
+permit(principal, action == Action::"view", resource);
+
+// admins can do anything
+@id("admin")
+permit(principal in Group::"admin", action, resource);
+`)
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+	require.Len(t, file.Comments, 2)
+	assert.Equal(t, "anyone can view\n", file.Comments[0].Text())
+
+	stmts := file.Policies()
+	require.Len(t, stmts, 2)
+	assert.Equal(t, "policy0", policies[0].Id)
+	assert.Equal(t, "admin", policies[1].Id)
+	for idx, stmt := range stmts {
+		assert.Equal(t, policies[idx].StartPos, fset.Position(stmt.Pos()))
+	}
+
+	// The partial syntax tree is returned with the errors
+	file, policies, _, err = parser.ParseRulesWithCST(`permit(principal, action, resource); permit(`)
+	var list parser.ParseErrors
+	require.ErrorAs(t, err, &list)
+	assert.NotNil(t, file)
+	assert.Nil(t, policies)
+}
@@ -0,0 +1,194 @@
+package policystore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileSuffix is the extension of the policy files in a FileStore
+const FileSuffix = ".cedar"
+
+// FileStore keeps each policy in a file named by its id within a directory.
+// Files are replaced atomically so readers never see a partial policy.
+type FileStore struct {
+	dir      string
+	interval time.Duration
+	watchers watchers
+
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+// NewFileStore returns a store for the policies in dir. When pollInterval is
+// positive the directory is polled while there are watchers, so changes made
+// outside of the store are also reported.
+func NewFileStore(dir string, pollInterval time.Duration) *FileStore {
+	return &FileStore{dir: dir, interval: pollInterval}
+}
+
+func (s *FileStore) List(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// ReadDir returns the entries sorted by name
+	output := []string{}
+	for _, entry := range entries {
+		if isPolicyFile(entry) {
+			output = append(output, strings.TrimSuffix(entry.Name(), FileSuffix))
+		}
+	}
+	return output, nil
+}
+
+func (s *FileStore) Get(ctx context.Context, id string) (string, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (s *FileStore) Put(ctx context.Context, id string, text string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	if _, err := parsePolicy(id, text); err != nil {
+		return err
+	}
+
+	// The temporary file is hidden so it's never listed
+	tmp, err := os.CreateTemp(s.dir, ".policy-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(text); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	s.watchers.publish()
+	return nil
+}
+
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.watchers.publish()
+	return nil
+}
+
+// Watch registers fn to be called after the policies change, with polling a
+// change made through the store may be reported more than once.
+func (s *FileStore) Watch(fn func()) func() {
+	cancel := s.watchers.add(fn)
+
+	s.mu.Lock()
+	if s.interval > 0 && s.stop == nil {
+		s.stop = make(chan struct{})
+		go s.poll(s.stop, s.snapshot())
+	}
+	s.mu.Unlock()
+
+	return func() {
+		cancel()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.stop != nil && s.watchers.len() == 0 {
+			close(s.stop)
+			s.stop = nil
+		}
+	}
+}
+
+// poll publishes a change whenever a policy file is added, removed or
+// modified until stop is closed
+func (s *FileStore) poll(stop chan struct{}, last string) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		next := s.snapshot()
+		if next != last {
+			last = next
+			s.watchers.publish()
+		}
+	}
+}
+
+// snapshot summarizes the names, sizes and modification times of the policy
+// files, errors are part of the summary so they are reported once.
+func (s *FileStore) snapshot() string {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err.Error()
+	}
+
+	var buf strings.Builder
+	for _, entry := range entries {
+		if !isPolicyFile(entry) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&buf, "%s:%d:%d\n", entry.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	return buf.String()
+}
+
+// path returns the file of the policy, the id must be usable as a file name
+func (s *FileStore) path(id string) (string, error) {
+	if id == "" || strings.HasPrefix(id, ".") || strings.ContainsAny(id, `/\`+"\x00") {
+		return "", fmt.Errorf("%q can't be used as a file name: %w", id, ErrInvalidId)
+	}
+	return filepath.Join(s.dir, id+FileSuffix), nil
+}
+
+// isPolicyFile excludes directories, other files and hidden files such as
+// those of a Put in progress
+func isPolicyFile(entry fs.DirEntry) bool {
+	name := entry.Name()
+	return !entry.IsDir() && strings.HasSuffix(name, FileSuffix) && !strings.HasPrefix(name, ".")
+}
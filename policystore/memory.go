@@ -0,0 +1,67 @@
+package policystore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// MemoryStore keeps the policies in memory, it is safe for concurrent use
+type MemoryStore struct {
+	mu       sync.RWMutex
+	policies map[string]string
+	watchers watchers
+}
+
+// NewMemoryStore returns an empty store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{policies: map[string]string{}}
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return sortedKeys(s.policies), nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	text, found := s.policies[id]
+	if !found {
+		return "", fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+	return text, nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, id string, text string) error {
+	if _, err := parsePolicy(id, text); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.policies[id] = text
+	s.mu.Unlock()
+
+	s.watchers.publish()
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	_, found := s.policies[id]
+	delete(s.policies, id)
+	s.mu.Unlock()
+
+	if !found {
+		return fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+	s.watchers.publish()
+	return nil
+}
+
+func (s *MemoryStore) Watch(fn func()) func() {
+	return s.watchers.add(fn)
+}
@@ -0,0 +1,149 @@
+// Package policystore defines the storage backend for the policies of a
+// policy management service, along with in-memory, filesystem and SQL
+// implementations.
+//
+// Each entry of a store is the source of a single policy keyed by its id, the
+// policies are parsed when they are stored so a store only ever holds valid
+// policies. Load reads the whole store into a PolicyList for the authorizer.
+package policystore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+)
+
+var ErrNotFound = errors.New("policy not found")
+var ErrInvalidId = errors.New("invalid policy id")
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// Store is the interface to the storage of policies
+type Store interface {
+	// List returns the ids of the policies in sorted order
+	List(ctx context.Context) ([]string, error)
+	// Get returns the source of the policy, or ErrNotFound
+	Get(ctx context.Context, id string) (string, error)
+	// Put parses and stores the policy, replacing any policy with the same id
+	Put(ctx context.Context, id string, text string) error
+	// Delete removes the policy, or returns ErrNotFound
+	Delete(ctx context.Context, id string) error
+	// Watch registers fn to be called after the policies change, the
+	// returned function cancels the registration.
+	Watch(fn func()) (cancel func())
+}
+
+// Load reads all of the policies from the store, the id of each policy is
+// the key it was stored under. The policies are in the order of their ids,
+// whatever the order of the List of the store.
+func Load(ctx context.Context, store Store) (engine.PolicyList, error) {
+	ids, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !sort.StringsAreSorted(ids) {
+		ids = append([]string(nil), ids...)
+		sort.Strings(ids)
+	}
+
+	output := make(engine.PolicyList, 0, len(ids))
+	for _, id := range ids {
+		text, err := store.Get(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			// deleted since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		policy, err := parsePolicy(id, text)
+		if err != nil {
+			return nil, err
+		}
+		output = append(output, policy)
+	}
+
+	return output, nil
+}
+
+// parsePolicy parses the source of a single policy
+func parsePolicy(id string, text string) (*engine.Policy, error) {
+	if id == "" {
+		return nil, fmt.Errorf("id is empty: %w", ErrInvalidId)
+	}
+	policies, err := parser.ParseRules(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", id, err, ErrInvalidPolicy)
+	}
+	if len(policies) != 1 {
+		return nil, fmt.Errorf("%s: expected a single policy got %d: %w", id, len(policies), ErrInvalidPolicy)
+	}
+	policy := policies[0]
+	policy.Id = id
+
+	return policy, nil
+}
+
+type watcher struct {
+	id int
+	fn func()
+}
+
+// watchers is the list of callbacks to notify of changes
+type watchers struct {
+	mu    sync.Mutex
+	next  int
+	items []watcher
+}
+
+func (w *watchers) add(fn func()) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id := w.next
+	w.next += 1
+	w.items = append(w.items, watcher{id: id, fn: fn})
+
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		for i, item := range w.items {
+			if item.id == id {
+				w.items = append(w.items[:i:i], w.items[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (w *watchers) len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return len(w.items)
+}
+
+func (w *watchers) publish() {
+	w.mu.Lock()
+	items := w.items
+	w.mu.Unlock()
+
+	for _, item := range items {
+		item.fn()
+	}
+}
+
+// sortedKeys returns the keys of the map in sorted order
+func sortedKeys(values map[string]string) []string {
+	output := make([]string, 0, len(values))
+	for key := range values {
+		output = append(output, key)
+	}
+	sort.Strings(output)
+	return output
+}
@@ -0,0 +1,137 @@
+package policystore_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/koblas/cedar-go/policystore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const viewPolicy = `permit(principal, action == Action::"view", resource);`
+const editPolicy = `permit(principal == User::"alice", action == Action::"edit", resource);`
+
+// testStore checks the behaviour common to all of the stores
+func testStore(t *testing.T, store policystore.Store) {
+	ctx := context.TODO()
+
+	changes := 0
+	cancel := store.Watch(func() { changes += 1 })
+	defer cancel()
+
+	ids, err := store.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	require.NoError(t, store.Put(ctx, "view", viewPolicy))
+	require.NoError(t, store.Put(ctx, "edit", viewPolicy))
+	require.NoError(t, store.Put(ctx, "edit", editPolicy))
+	assert.Equal(t, 3, changes)
+
+	ids, err = store.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"edit", "view"}, ids)
+
+	text, err := store.Get(ctx, "edit")
+	require.NoError(t, err)
+	assert.Equal(t, editPolicy, text)
+
+	policies, err := policystore.Load(ctx, store)
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+	assert.Equal(t, "edit", policies[0].Id)
+	assert.Equal(t, "view", policies[1].Id)
+
+	err = store.Put(ctx, "bad", `permit(principal, action, resource`)
+	assert.ErrorIs(t, err, policystore.ErrInvalidPolicy)
+	err = store.Put(ctx, "two", viewPolicy+editPolicy)
+	assert.ErrorIs(t, err, policystore.ErrInvalidPolicy)
+	_, err = store.Get(ctx, "bad")
+	assert.ErrorIs(t, err, policystore.ErrNotFound)
+
+	require.NoError(t, store.Delete(ctx, "view"))
+	assert.ErrorIs(t, store.Delete(ctx, "view"), policystore.ErrNotFound)
+	assert.Equal(t, 4, changes)
+
+	ids, err = store.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"edit"}, ids)
+
+	cancel()
+	require.NoError(t, store.Put(ctx, "view", viewPolicy))
+	assert.Equal(t, 4, changes)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, policystore.NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	testStore(t, policystore.NewFileStore(dir, 0))
+
+	// files which aren't policies are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("policies"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "nested.cedar"), 0o755))
+	ids, err := policystore.NewFileStore(dir, 0).List(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"edit", "view"}, ids)
+
+	store := policystore.NewFileStore(dir, 0)
+	for _, id := range []string{"", "../escape", ".hidden", `a\b`} {
+		assert.ErrorIs(t, store.Put(context.TODO(), id, viewPolicy), policystore.ErrInvalidId, id)
+	}
+}
+
+func TestFileStorePolling(t *testing.T) {
+	dir := t.TempDir()
+	store := policystore.NewFileStore(dir, 5*time.Millisecond)
+
+	changed := make(chan struct{}, 10)
+	cancel := store.Watch(func() { changed <- struct{}{} })
+	defer cancel()
+
+	// a change made outside of the store
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "view.cedar"), []byte(viewPolicy), 0o644))
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not reported")
+	}
+
+	ids, err := store.List(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"view"}, ids)
+}
+
+// reversedStore lists the ids in reverse, as a store without an order might
+type reversedStore struct {
+	*policystore.MemoryStore
+}
+
+func (s reversedStore) List(ctx context.Context) ([]string, error) {
+	ids, err := s.MemoryStore.List(ctx)
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+	return ids, err
+}
+
+func TestLoadOrder(t *testing.T) {
+	ctx := context.TODO()
+	store := reversedStore{policystore.NewMemoryStore()}
+	require.NoError(t, store.Put(ctx, "b", viewPolicy))
+	require.NoError(t, store.Put(ctx, "a", editPolicy))
+	require.NoError(t, store.Put(ctx, "c", viewPolicy))
+
+	policies, err := policystore.Load(ctx, store)
+	require.NoError(t, err)
+	require.Len(t, policies, 3)
+	assert.Equal(t, "a", policies[0].Id)
+	assert.Equal(t, "b", policies[1].Id)
+	assert.Equal(t, "c", policies[2].Id)
+}
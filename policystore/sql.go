@@ -0,0 +1,164 @@
+package policystore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// SQLStore keeps the policies in a table with an `id` and a `policy` column,
+// for example:
+//
+//	CREATE TABLE policies (id VARCHAR(255) PRIMARY KEY, policy TEXT NOT NULL)
+//
+// Only changes made through the store are reported to the watchers.
+type SQLStore struct {
+	db          *sql.DB
+	table       string
+	placeholder func(n int) string
+	lock        string
+	watchers    watchers
+}
+
+// SQLOption configures an SQLStore
+type SQLOption func(*SQLStore)
+
+// WithDollarPlaceholders uses the $1, $2... placeholders of PostgreSQL
+// rather than ?
+func WithDollarPlaceholders() SQLOption {
+	return func(s *SQLStore) {
+		s.placeholder = func(n int) string {
+			return "$" + strconv.Itoa(n)
+		}
+	}
+}
+
+// WithoutRowLocks doesn't lock the row of the policy while it's replaced,
+// for SQLite which has no `FOR UPDATE` as a write locks the whole database
+func WithoutRowLocks() SQLOption {
+	return func(s *SQLStore) {
+		s.lock = ""
+	}
+}
+
+// NewSQLStore returns a store for the policies in the table, the driver is
+// chosen by the caller when opening the database.
+func NewSQLStore(db *sql.DB, table string, options ...SQLOption) (*SQLStore, error) {
+	if !sqlIdentifier.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	store := SQLStore{
+		db:    db,
+		table: table,
+		placeholder: func(n int) string {
+			return "?"
+		},
+		lock: " FOR UPDATE",
+	}
+	for _, opt := range options {
+		opt(&store)
+	}
+	return &store, nil
+}
+
+// query substitutes the table name and placeholders, the arguments are
+// written as {table} and {1}, {2}...
+func (s *SQLStore) query(text string, args int) string {
+	text = strings.ReplaceAll(text, "{table}", s.table)
+	for n := 1; n <= args; n++ {
+		text = strings.ReplaceAll(text, "{"+strconv.Itoa(n)+"}", s.placeholder(n))
+	}
+	return text
+}
+
+func (s *SQLStore) List(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, s.query("SELECT id FROM {table} ORDER BY id", 0))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	output := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		output = append(output, id)
+	}
+	return output, rows.Err()
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (string, error) {
+	var text string
+	err := s.db.QueryRowContext(ctx, s.query("SELECT policy FROM {table} WHERE id = {1}", 1), id).Scan(&text)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+	return text, nil
+}
+
+// Put updates the policy or inserts it when it doesn't exist, rather than
+// an upsert which isn't portable across databases. Whether it exists is
+// checked by reading the row, as the count of an update which doesn't change
+// the row is 0 for some databases, e.g. MySQL.
+func (s *SQLStore) Put(ctx context.Context, id string, text string) error {
+	if _, err := parsePolicy(id, text); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// a no-op once committed
+	defer tx.Rollback()
+
+	var found int
+	err = tx.QueryRowContext(ctx, s.query("SELECT 1 FROM {table} WHERE id = {1}"+s.lock, 1), id).Scan(&found)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		_, err = tx.ExecContext(ctx, s.query("INSERT INTO {table} (id, policy) VALUES ({1}, {2})", 2), id, text)
+	case err == nil:
+		_, err = tx.ExecContext(ctx, s.query("UPDATE {table} SET policy = {1} WHERE id = {2}", 2), text, id)
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.watchers.publish()
+	return nil
+}
+
+func (s *SQLStore) Delete(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, s.query("DELETE FROM {table} WHERE id = {1}", 1), id)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+
+	s.watchers.publish()
+	return nil
+}
+
+func (s *SQLStore) Watch(fn func()) func() {
+	return s.watchers.add(fn)
+}
@@ -0,0 +1,170 @@
+package policystore_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/koblas/cedar-go/policystore"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDriver is a database/sql driver which understands just the queries
+// issued by SQLStore, for a table of policies held in memory. As MySQL, an
+// update which doesn't change the row isn't counted.
+type fakeDriver struct {
+	mu   sync.Mutex
+	rows map[string]string
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{d}, nil
+}
+
+type fakeConn struct {
+	driver *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c.driver, query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	return nil
+}
+
+type fakeStmt struct {
+	driver *fakeDriver
+	query  string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	d := s.driver
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch s.query {
+	case "UPDATE policies SET policy = $1 WHERE id = $2":
+		if text, found := d.rows[args[1].(string)]; !found || text == args[0].(string) {
+			return driver.RowsAffected(0), nil
+		}
+		d.rows[args[1].(string)] = args[0].(string)
+		return driver.RowsAffected(1), nil
+	case "INSERT INTO policies (id, policy) VALUES ($1, $2)":
+		if _, found := d.rows[args[0].(string)]; found {
+			return nil, fmt.Errorf("duplicate key %q", args[0])
+		}
+		d.rows[args[0].(string)] = args[1].(string)
+		return driver.RowsAffected(1), nil
+	case "DELETE FROM policies WHERE id = $1":
+		if _, found := d.rows[args[0].(string)]; !found {
+			return driver.RowsAffected(0), nil
+		}
+		delete(d.rows, args[0].(string))
+		return driver.RowsAffected(1), nil
+	}
+	return nil, fmt.Errorf("unexpected exec %q", s.query)
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	d := s.driver
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch s.query {
+	case "SELECT id FROM policies ORDER BY id":
+		rows := &fakeRows{column: "id"}
+		for id := range d.rows {
+			rows.values = append(rows.values, id)
+		}
+		sort.Strings(rows.values)
+		return rows, nil
+	case "SELECT policy FROM policies WHERE id = $1":
+		rows := &fakeRows{column: "policy"}
+		if text, found := d.rows[args[0].(string)]; found {
+			rows.values = append(rows.values, text)
+		}
+		return rows, nil
+	case "SELECT 1 FROM policies WHERE id = $1 FOR UPDATE":
+		rows := &fakeRows{column: "1"}
+		if _, found := d.rows[args[0].(string)]; found {
+			rows.values = append(rows.values, "1")
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("unexpected query %q", s.query)
+}
+
+type fakeRows struct {
+	column string
+	values []string
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{r.column}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.values[0]
+	r.values = r.values[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("policystore-fake", &fakeDriver{rows: map[string]string{}})
+}
+
+func TestSQLStore(t *testing.T) {
+	db, err := sql.Open("policystore-fake", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = policystore.NewSQLStore(db, "policies; DROP TABLE users")
+	require.Error(t, err)
+
+	store, err := policystore.NewSQLStore(db, "policies", policystore.WithDollarPlaceholders())
+	require.NoError(t, err)
+	testStore(t, store)
+
+	_, err = store.Get(context.TODO(), "missing")
+	require.ErrorIs(t, err, policystore.ErrNotFound)
+
+	// Putting the same policy again doesn't change the row
+	require.NoError(t, store.Put(context.TODO(), "view", viewPolicy))
+	require.NoError(t, store.Put(context.TODO(), "view", viewPolicy))
+	text, err := store.Get(context.TODO(), "view")
+	require.NoError(t, err)
+	require.Equal(t, viewPolicy, text)
+}
@@ -0,0 +1,340 @@
+// Package policytest runs declarative test files against a set of policies,
+// allowing policy repositories to ship executable tests next to the policies.
+//
+// A test file is YAML (or JSON) with the following form, file references are
+// relative to the test file and the entities may also be YAML:
+//
+//	name: photo sharing
+//	schema: schema.json
+//	policies: policies.cedar
+//	entities: entities.json
+//	cases:
+//	  - name: alice can view her photo
+//	    principal: User::"alice"
+//	    action: Action::"view"
+//	    resource: Photo::"vacation.jpg"
+//	    context: { authenticated: true }
+//	    decision: allow
+//	    reasons: [policy0]
+//
+// A case whose policies fail to evaluate only passes when its decision is
+// "error", an error is never counted as a deny.
+package policytest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/schema"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidTestFile = errors.New("invalid test file")
+
+// FileSuffixes are the file name endings recognized as test files
+var FileSuffixes = []string{".cedartest.yaml", ".cedartest.yml", ".cedartest.json"}
+
+// Case is a single request and the expected outcome
+type Case struct {
+	Name      string         `yaml:"name"`
+	Principal string         `yaml:"principal"`
+	Action    string         `yaml:"action"`
+	Resource  string         `yaml:"resource"`
+	Context   map[string]any `yaml:"context"`
+	// Decision is either "allow", "deny" or "error" when a policy is expected
+	// to fail to evaluate
+	Decision string `yaml:"decision"`
+	// Reasons when present must exactly match the policies that determined the decision
+	Reasons []string `yaml:"reasons"`
+}
+
+// Suite is the contents of a test file
+type Suite struct {
+	Name     string `yaml:"name"`
+	Schema   string `yaml:"schema"`
+	Policies string `yaml:"policies"`
+	Entities string `yaml:"entities"`
+	Cases    []Case `yaml:"cases"`
+
+	// Path of the test file, references are resolved relative to it
+	Path string `yaml:"-"`
+}
+
+// Result is the outcome of running a single test case
+type Result struct {
+	Suite   string
+	Case    string
+	Passed  bool
+	Message string
+}
+
+// Load reads a test file
+func Load(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	suite := Suite{}
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", path, err, ErrInvalidTestFile)
+	}
+	if suite.Policies == "" {
+		return nil, fmt.Errorf("%s: policies not provided: %w", path, ErrInvalidTestFile)
+	}
+	if suite.Name == "" {
+		suite.Name = path
+	}
+	suite.Path = path
+
+	return &suite, nil
+}
+
+// IsTestFile returns true if the file name is that of a test file
+func IsTestFile(name string) bool {
+	for _, suffix := range FileSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Find expands the patterns into the list of test files. A pattern is either
+// a file, a directory or a directory followed by `/...` to include all of the
+// subdirectories.
+func Find(patterns ...string) ([]string, error) {
+	seen := map[string]bool{}
+	output := []string{}
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			output = append(output, path)
+		}
+	}
+
+	for _, pattern := range patterns {
+		recursive := false
+		if pattern == "..." || strings.HasSuffix(pattern, "/...") {
+			recursive = true
+			pattern = strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+			if pattern == "" {
+				pattern = "."
+			}
+		}
+
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			add(pattern)
+			continue
+		}
+
+		err = filepath.WalkDir(pattern, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != pattern && !recursive {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if IsTestFile(path) {
+				add(path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(output)
+
+	return output, nil
+}
+
+func (s *Suite) readFile(name string) ([]byte, error) {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(filepath.Dir(s.Path), name)
+	}
+	return os.ReadFile(name)
+}
+
+func (s *Suite) authorizer(options ...cedar.Option) (*cedar.SchemaAuthorizer, *schema.Schema, error) {
+	sdef := schema.NewEmptySchema()
+	if s.Schema != "" {
+		data, err := s.readFile(s.Schema)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to read schema: %w", err)
+		}
+		if strings.HasSuffix(s.Schema, ".cedarschema") {
+			sdef, err = schema.NewFromText(bytes.NewReader(data))
+		} else {
+			sdef, err = schema.NewFromJson(bytes.NewReader(data))
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to parse schema: %w", err)
+		}
+	}
+
+	data, err := s.readFile(s.Policies)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read policies: %w", err)
+	}
+	policies, err := parser.ParseRules(string(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to parse policies: %w", err)
+	}
+
+	opts := append([]cedar.Option{cedar.WithSchema(sdef)}, options...)
+	if s.Entities != "" {
+		data, err := s.readFile(s.Entities)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to read entities: %w", err)
+		}
+		load := cedar.StoreFromJson
+		if strings.HasSuffix(s.Entities, ".yaml") || strings.HasSuffix(s.Entities, ".yml") {
+			load = cedar.StoreFromYaml
+		}
+		store, err := load(bytes.NewReader(data), sdef)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to load entities: %w", err)
+		}
+		opts = append(opts, cedar.WithStore(store))
+	}
+
+	return cedar.NewAuthorizer(policies, opts...), sdef, nil
+}
+
+// Run evaluates all of the test cases in the suite, an error is returned if
+// the referenced files can't be loaded.
+func (s *Suite) Run(ctx context.Context) ([]Result, error) {
+	auth, sdef, err := s.authorizer()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Path, err)
+	}
+
+	return s.run(ctx, auth, sdef), nil
+}
+
+// RunCoverage is Run which also reports the policies, conditions and
+// branches which none of the test cases exercised
+func (s *Suite) RunCoverage(ctx context.Context) ([]Result, *engine.CoverageReport, error) {
+	coverage := engine.NewCoverage()
+	auth, sdef, err := s.authorizer(cedar.WithCoverage(coverage))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", s.Path, err)
+	}
+
+	results := s.run(ctx, auth, sdef)
+	return results, coverage.Report(auth.Policies), nil
+}
+
+func (s *Suite) run(ctx context.Context, auth *cedar.SchemaAuthorizer, sdef *schema.Schema) []Result {
+	results := []Result{}
+	for idx, item := range s.Cases {
+		name := item.Name
+		if name == "" {
+			name = fmt.Sprintf("case %d", idx+1)
+		}
+		result := Result{Suite: s.Name, Case: name}
+		if msg := item.run(ctx, auth, sdef); msg != "" {
+			result.Message = msg
+		} else {
+			result.Passed = true
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// run returns a description of the failure or the empty string on success
+func (c *Case) run(ctx context.Context, auth *cedar.SchemaAuthorizer, sdef *schema.Schema) string {
+	expected := strings.ToLower(c.Decision)
+	if expected != "allow" && expected != "deny" && expected != "error" {
+		return fmt.Sprintf("decision must be allow, deny or error, got %q", c.Decision)
+	}
+
+	var uids [3]engine.EntityValue
+	for idx, value := range []string{c.Principal, c.Action, c.Resource} {
+		if value == "" {
+			continue
+		}
+		entity, err := engine.ParseEntity(value)
+		if err != nil {
+			return err.Error()
+		}
+		uids[idx] = entity
+	}
+	principal, action, resource := uids[0], uids[1], uids[2]
+
+	input := c.Context
+	if input == nil {
+		input = map[string]any{}
+	}
+	reqContext, err := sdef.NormalizeContext(input, principal, action, resource)
+	if err != nil {
+		return err.Error()
+	}
+
+	detail, err := auth.IsAuthorizedDetail(ctx, &cedar.Request{
+		Principal: principal,
+		Action:    action,
+		Resource:  resource,
+		Context:   reqContext,
+	})
+
+	if err == nil && len(detail.Diagnostics.Errors) != 0 {
+		errs := []error{}
+		for _, item := range detail.Diagnostics.Errors {
+			errs = append(errs, item)
+		}
+		err = errors.Join(errs...)
+	}
+
+	got := "deny"
+	if err != nil {
+		got = "error"
+	} else if detail.IsAllowed {
+		got = "allow"
+	}
+	if got != expected {
+		msg := fmt.Sprintf("expected %s got %s", expected, got)
+		if err != nil {
+			msg += ": " + err.Error()
+		}
+		return msg
+	}
+	if got == "error" {
+		return ""
+	}
+
+	if c.Reasons != nil && detail != nil {
+		want := append([]string{}, c.Reasons...)
+		have := append([]string{}, detail.Diagnostics.Forbids...)
+		if got == "allow" {
+			have = append([]string{}, detail.Diagnostics.Permits...)
+		}
+		sort.Strings(want)
+		sort.Strings(have)
+		if strings.Join(want, ",") != strings.Join(have, ",") {
+			return fmt.Sprintf("expected reasons [%s] got [%s]", strings.Join(want, ", "), strings.Join(have, ", "))
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,127 @@
+package policytest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/koblas/cedar-go/policytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFind(t *testing.T) {
+	files, err := policytest.Find("testdata/photos")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"testdata/photos/photos.cedartest.yaml"}, files)
+
+	files, err = policytest.Find("testdata/...")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"testdata/photos/nested/failing.cedartest.json",
+		"testdata/photos/photos.cedartest.yaml",
+	}, files)
+}
+
+func TestRun(t *testing.T) {
+	suite, err := policytest.Load("testdata/photos/photos.cedartest.yaml")
+	require.NoError(t, err)
+
+	results, err := suite.Run(context.TODO())
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	for _, item := range results {
+		assert.True(t, item.Passed, item.Message)
+	}
+
+	suite, err = policytest.Load("testdata/photos/nested/failing.cedartest.json")
+	require.NoError(t, err)
+
+	results, err = suite.Run(context.TODO())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.False(t, results[0].Passed)
+	assert.Equal(t, "expected allow got deny", results[0].Message)
+}
+
+func TestRunCoverage(t *testing.T) {
+	suite, err := policytest.Load("testdata/photos/photos.cedartest.yaml")
+	require.NoError(t, err)
+
+	results, report, err := suite.RunCoverage(context.TODO())
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	assert.Equal(t, 8, report.Outcomes)
+	assert.Equal(t, 7, report.Covered)
+	assert.Empty(t, report.UncoveredPolicies)
+	require.Len(t, report.Uncovered, 1)
+	assert.Equal(t, "owner-view", report.Uncovered[0].PolicyId)
+	assert.Equal(t, "when { resource.owner == principal } never false", report.Uncovered[0].Description)
+	assert.Equal(t, 3, report.Uncovered[0].Position.Line)
+}
+
+func TestRunInvalidEntity(t *testing.T) {
+	suite := policytest.Suite{
+		Name:     "invalid",
+		Policies: "policies.cedar",
+		Entities: "entities.json",
+		Path:     "testdata/photos/invalid.cedartest.yaml",
+		Cases: []policytest.Case{
+			{
+				Principal: `User::alice`,
+				Action:    `Action::"view"`,
+				Resource:  `Photo::"vacation.jpg"`,
+				Decision:  "deny",
+			},
+		},
+	}
+
+	results, err := suite.Run(context.TODO())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.False(t, results[0].Passed)
+	assert.Contains(t, results[0].Message, `"User::alice"`)
+}
+
+func TestRunError(t *testing.T) {
+	// no-private can't evaluate without context.private
+	suite := policytest.Suite{
+		Name:     "errors",
+		Policies: "policies.cedar",
+		Entities: "entities.json",
+		Path:     "testdata/photos/errors.cedartest.yaml",
+		Cases: []policytest.Case{
+			{
+				Name:      "error is not a deny",
+				Principal: `User::"bob"`,
+				Action:    `Action::"view"`,
+				Resource:  `Photo::"vacation.jpg"`,
+				Decision:  "deny",
+			},
+			{
+				Name:      "expected error",
+				Principal: `User::"bob"`,
+				Action:    `Action::"view"`,
+				Resource:  `Photo::"vacation.jpg"`,
+				Decision:  "error",
+			},
+			{
+				Name:      "unexpected success",
+				Principal: `User::"bob"`,
+				Action:    `Action::"view"`,
+				Resource:  `Photo::"vacation.jpg"`,
+				Context:   map[string]any{"private": false},
+				Decision:  "error",
+			},
+		},
+	}
+
+	results, err := suite.Run(context.TODO())
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.False(t, results[0].Passed)
+	assert.Contains(t, results[0].Message, "expected deny got error: policy no-private")
+	assert.True(t, results[1].Passed, results[1].Message)
+	assert.False(t, results[2].Passed)
+	assert.Equal(t, "expected error got deny", results[2].Message)
+}
@@ -0,0 +1,361 @@
+// Package redisstore is an engine.Store for entities kept in Redis, allowing
+// several instances of a service to share the entity data.
+//
+// The attributes of an entity are a hash where each field is an attribute
+// holding its value as JSON in the entities format, and the direct parents
+// are a set of `{"type": ..., "id": ...}` JSON objects:
+//
+//	HSET entity:User::"alice" age 42 manager '{"__entity": {"type": "User", "id": "bob"}}'
+//	SADD parents:User::"alice" '{"type": "Group", "id": "staff"}'
+//
+// The store depends on a small Client interface rather than a Redis client
+// library, an adapter for go-redis is:
+//
+//	type client struct{ rdb *redis.Client }
+//
+//	func (c client) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+//		return c.rdb.HGetAll(ctx, key).Result()
+//	}
+//
+//	func (c client) SMembers(ctx context.Context, keys ...string) ([][]string, error) {
+//		cmds := make([]*redis.StringSliceCmd, len(keys))
+//		_, err := c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+//			for i, key := range keys {
+//				cmds[i] = pipe.SMembers(ctx, key)
+//			}
+//			return nil
+//		})
+//		output := make([][]string, len(keys))
+//		for i, cmd := range cmds {
+//			output[i] = cmd.Val()
+//		}
+//		return output, err
+//	}
+package redisstore
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+)
+
+// Client is the subset of the Redis commands used by the store
+type Client interface {
+	// HGetAll returns the fields of the hash, empty if it doesn't exist
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	// SMembers returns the members of each of the sets, the commands should
+	// be pipelined so there is a single round trip
+	SMembers(ctx context.Context, keys ...string) ([][]string, error)
+}
+
+// Store loads entities from Redis, it is safe for concurrent use
+type Store struct {
+	client  Client
+	schema  *schema.Schema
+	prefix  string
+	timeout time.Duration
+	cache   *entityCache
+}
+
+var _ engine.Store = (*Store)(nil)
+
+// Option configures the store
+type Option func(*Store)
+
+// WithSchema decodes the attributes with the shapes of the entity types
+func WithSchema(sdef *schema.Schema) Option {
+	return func(s *Store) {
+		s.schema = sdef
+	}
+}
+
+// WithPrefix is prepended to every key, to share a database between
+// applications
+func WithPrefix(prefix string) Option {
+	return func(s *Store) {
+		s.prefix = prefix
+	}
+}
+
+// WithTimeout bounds each call to Redis, by default there is no limit
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Store) {
+		s.timeout = timeout
+	}
+}
+
+// WithCache keeps up to size entities in memory for at most ttl, so changes
+// made in Redis may not be seen for up to ttl.
+func WithCache(size int, ttl time.Duration) Option {
+	return func(s *Store) {
+		if size > 0 && ttl > 0 {
+			s.cache = newEntityCache(size, ttl)
+		}
+	}
+}
+
+// New creates a store using the client
+func New(client Client, options ...Option) *Store {
+	store := Store{client: client, schema: schema.NewEmptySchema()}
+	for _, opt := range options {
+		opt(&store)
+	}
+	return &store
+}
+
+// AttributesKey is the key of the hash holding the attributes of the entity
+func (s *Store) AttributesKey(uid engine.EntityValue) string {
+	return s.prefix + "entity:" + uid.String()
+}
+
+// ParentsKey is the key of the set holding the direct parents of the entity
+func (s *Store) ParentsKey(uid engine.EntityValue) string {
+	return s.prefix + "parents:" + uid.String()
+}
+
+// InvalidateCache drops the cached entities
+func (s *Store) InvalidateCache() {
+	if s.cache != nil {
+		s.cache.clear()
+	}
+}
+
+func (s *Store) Get(key engine.EntityValue, attr string) (engine.EvalValue, error) {
+	values, err := s.attributes(key)
+	if err != nil {
+		return nil, err
+	}
+	if values == nil {
+		return nil, engine.ErrValueNotFound
+	}
+	return values.OpLookup(engine.StrValue(attr), s)
+}
+
+// GetParents walks the hierarchy a level at a time, fetching the parents of
+// every entity of the level in a single round trip.
+func (s *Store) GetParents(key engine.EntityValue) ([]engine.EntityValue, error) {
+	seen := map[string]bool{key.String(): true}
+	output := []engine.EntityValue{key}
+	level := []engine.EntityValue{key}
+
+	for len(level) != 0 {
+		parents, err := s.parents(level)
+		if err != nil {
+			return nil, err
+		}
+
+		next := []engine.EntityValue{}
+		for _, items := range parents {
+			for _, item := range items {
+				if !seen[item.String()] {
+					seen[item.String()] = true
+					output = append(output, item)
+					next = append(next, item)
+				}
+			}
+		}
+		level = next
+	}
+
+	return output[1:], nil
+}
+
+func (s *Store) context() (context.Context, context.CancelFunc) {
+	if s.timeout > 0 {
+		return context.WithTimeout(context.Background(), s.timeout)
+	}
+	return context.Background(), func() {}
+}
+
+// attributes loads the attributes of the entity, nil if there are none
+func (s *Store) attributes(key engine.EntityValue) (*engine.VarValue, error) {
+	if s.cache != nil {
+		if entry, found := s.cache.get(key.String()); found && entry.hasValues {
+			return entry.values, nil
+		}
+	}
+
+	ctx, cancel := s.context()
+	defer cancel()
+
+	fields, err := s.client.HGetAll(ctx, s.AttributesKey(key))
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to load attributes: %w", key.String(), err)
+	}
+
+	var values *engine.VarValue
+	if len(fields) != 0 {
+		// Rebuild the JSON object so the whole record is decoded with the shape
+		raw := make(map[string]json.RawMessage, len(fields))
+		for name, value := range fields {
+			raw[name] = json.RawMessage(value)
+		}
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid attribute: %s: %w", key.String(), err, schema.ErrInvalidEntityFormat)
+		}
+		if values, err = s.schema.DecodeAttributes(key, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.cache != nil {
+		s.cache.update(key.String(), func(entry *cacheEntry) {
+			entry.values = values
+			entry.hasValues = true
+		})
+	}
+	return values, nil
+}
+
+// parents loads the direct parents of each of the entities
+func (s *Store) parents(entities []engine.EntityValue) ([][]engine.EntityValue, error) {
+	output := make([][]engine.EntityValue, len(entities))
+	keys := []string{}
+	missing := []int{}
+	for i, item := range entities {
+		if s.cache != nil {
+			if entry, found := s.cache.get(item.String()); found && entry.hasParents {
+				output[i] = entry.parents
+				continue
+			}
+		}
+		keys = append(keys, s.ParentsKey(item))
+		missing = append(missing, i)
+	}
+	if len(keys) == 0 {
+		return output, nil
+	}
+
+	ctx, cancel := s.context()
+	defer cancel()
+
+	members, err := s.client.SMembers(ctx, keys...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load parents: %w", err)
+	}
+	if len(members) != len(keys) {
+		return nil, fmt.Errorf("expected %d sets of parents got %d", len(keys), len(members))
+	}
+
+	for n, i := range missing {
+		parents, err := decodeParents(entities[i], members[n])
+		if err != nil {
+			return nil, err
+		}
+		output[i] = parents
+		if s.cache != nil {
+			s.cache.update(entities[i].String(), func(entry *cacheEntry) {
+				entry.parents = parents
+				entry.hasParents = true
+			})
+		}
+	}
+
+	return output, nil
+}
+
+// decodeParents converts the set members, which are sorted as the order of a
+// set is undefined
+func decodeParents(key engine.EntityValue, members []string) ([]engine.EntityValue, error) {
+	sort.Strings(members)
+
+	output := make([]engine.EntityValue, 0, len(members))
+	for _, member := range members {
+		var uid struct {
+			Type string `json:"type"`
+			Id   string `json:"id"`
+		}
+		if err := json.Unmarshal([]byte(member), &uid); err != nil || uid.Type == "" {
+			return nil, fmt.Errorf("%s: invalid parent %q: %w", key.String(), member, schema.ErrInvalidEntityFormat)
+		}
+		output = append(output, engine.NewEntityValue(uid.Type, uid.Id))
+	}
+	return output, nil
+}
+
+// entityCache is a LRU cache of the entities where each entry expires after
+// a fixed TTL.
+type entityCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List // front is the most recently used
+}
+
+type cacheEntry struct {
+	key        string
+	expires    time.Time
+	values     *engine.VarValue
+	hasValues  bool
+	parents    []engine.EntityValue
+	hasParents bool
+}
+
+func newEntityCache(size int, ttl time.Duration) *entityCache {
+	return &entityCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+func (c *entityCache) get(key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, found := c.entries[key]
+	if !found {
+		return cacheEntry{}, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return cacheEntry{}, false
+	}
+	c.order.MoveToFront(elem)
+
+	return *entry, true
+}
+
+// update applies fn to the entry of the key, an entry is created if needed
+// and the expiry is kept for an existing entry.
+func (c *entityCache) update(key string, fn func(entry *cacheEntry)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, found := c.entries[key]; found {
+		entry := *elem.Value.(*cacheEntry)
+		fn(&entry)
+		elem.Value = &entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	entry := &cacheEntry{key: key, expires: time.Now().Add(c.ttl)}
+	fn(entry)
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *entityCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[string]*list.Element{}
+	c.order.Init()
+}
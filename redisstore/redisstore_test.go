@@ -0,0 +1,146 @@
+package redisstore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/redisstore"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClient holds the hashes and sets in memory and counts the round trips
+type fakeClient struct {
+	hashes map[string]map[string]string
+	sets   map[string][]string
+	calls  int
+	err    error
+}
+
+func (c *fakeClient) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	c.calls += 1
+	if c.err != nil {
+		return nil, c.err
+	}
+	output := map[string]string{}
+	for field, value := range c.hashes[key] {
+		output[field] = value
+	}
+	return output, nil
+}
+
+func (c *fakeClient) SMembers(ctx context.Context, keys ...string) ([][]string, error) {
+	c.calls += 1
+	if c.err != nil {
+		return nil, c.err
+	}
+	output := make([][]string, len(keys))
+	for i, key := range keys {
+		output[i] = append([]string{}, c.sets[key]...)
+	}
+	return output, nil
+}
+
+func newClient() *fakeClient {
+	return &fakeClient{
+		hashes: map[string]map[string]string{
+			`entity:User::"alice"`: {
+				"age":     `42`,
+				"manager": `{"__entity": {"type": "User", "id": "bob"}}`,
+				"ip":      `{"__extn": {"fn": "ip", "arg": "10.0.0.1"}}`,
+			},
+			`entity:Photo::"vacation.jpg"`: {
+				"owner": `{"__entity": {"type": "User", "id": "alice"}}`,
+			},
+		},
+		sets: map[string][]string{
+			`parents:User::"alice"`:   {`{"type": "Group", "id": "staff"}`, `{"type": "Group", "id": "admins"}`},
+			`parents:Group::"staff"`:  {`{"type": "Group", "id": "everyone"}`},
+			`parents:Group::"admins"`: {`{"type": "Group", "id": "everyone"}`},
+		},
+	}
+}
+
+func TestStore(t *testing.T) {
+	client := newClient()
+	store := redisstore.New(client)
+	alice := engine.NewEntityValue("User", "alice")
+
+	value, err := store.Get(alice, "age")
+	require.NoError(t, err)
+	assert.Equal(t, engine.IntValue(42), value)
+	value, err = store.Get(alice, "manager")
+	require.NoError(t, err)
+	assert.Equal(t, engine.NewEntityValue("User", "bob"), value)
+	_, err = store.Get(engine.NewEntityValue("User", "carol"), "age")
+	assert.ErrorIs(t, err, engine.ErrValueNotFound)
+
+	// each level of the hierarchy is a single round trip
+	client.calls = 0
+	parents, err := store.GetParents(alice)
+	require.NoError(t, err)
+	assert.Equal(t, []engine.EntityValue{
+		engine.NewEntityValue("Group", "admins"),
+		engine.NewEntityValue("Group", "staff"),
+		engine.NewEntityValue("Group", "everyone"),
+	}, parents)
+	assert.Equal(t, 3, client.calls)
+
+	client.sets[`parents:User::"bob"`] = []string{`Group::"staff"`}
+	_, err = store.GetParents(engine.NewEntityValue("User", "bob"))
+	assert.ErrorIs(t, err, schema.ErrInvalidEntityFormat)
+
+	errDown := errors.New("connection refused")
+	client.err = errDown
+	_, err = store.Get(alice, "age")
+	assert.ErrorIs(t, err, errDown)
+}
+
+func TestStoreCache(t *testing.T) {
+	client := newClient()
+	store := redisstore.New(client, redisstore.WithCache(10, time.Minute), redisstore.WithTimeout(time.Second))
+
+	policies, err := cedar.ParsePolicies(`
+	permit(principal in Group::"everyone", action, resource)
+		when { resource.owner == principal && principal.ip.isInRange(ip("10.0.0.0/8")) };
+	`)
+	require.NoError(t, err)
+	auth := cedar.NewAuthorizer(policies, cedar.WithStore(store))
+	request := &cedar.Request{
+		Principal: cedar.NewEntity("User", "alice"),
+		Action:    cedar.NewEntity("Action", "view"),
+		Resource:  cedar.NewEntity("Photo", "vacation.jpg"),
+	}
+
+	for i := 0; i < 3; i++ {
+		ok, err := auth.IsAuthorized(context.TODO(), request)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	// two entities and three levels of the hierarchy
+	assert.Equal(t, 5, client.calls)
+
+	delete(client.hashes, `entity:User::"alice"`)
+	ok, err := auth.IsAuthorized(context.TODO(), request)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	store.InvalidateCache()
+	ok, _ = auth.IsAuthorized(context.TODO(), request)
+	assert.False(t, ok)
+}
+
+func TestStorePrefix(t *testing.T) {
+	store := redisstore.New(newClient(), redisstore.WithPrefix("app:"))
+	alice := engine.NewEntityValue("User", "alice")
+	assert.Equal(t, `app:entity:User::"alice"`, store.AttributesKey(alice))
+	assert.Equal(t, `app:parents:User::"alice"`, store.ParentsKey(alice))
+
+	_, err := store.Get(alice, "age")
+	assert.ErrorIs(t, err, engine.ErrValueNotFound)
+}
@@ -0,0 +1,137 @@
+package cedar
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/koblas/cedar-go/parser"
+	"github.com/koblas/cedar-go/token"
+)
+
+// ReloadingAuthorizer is an authorizer whose policies are the files of a
+// file system which match a glob. Reload replaces the policies when the files
+// have changed, a file which doesn't parse keeps the last policies which did.
+type ReloadingAuthorizer struct {
+	*SchemaAuthorizer
+	fsys fs.FS
+	glob string
+
+	// mu serializes the reloads and guards the fields below
+	mu   sync.Mutex
+	hash string
+	err  error
+}
+
+// NewReloadingAuthorizer creates an authorizer with the policies of the
+// files of fsys matching the glob, in the syntax of fs.Glob, e.g.
+//
+//	cedar.NewReloadingAuthorizer(os.DirFS("/etc/policies"), "*.cedar")
+//
+// The files must parse, afterwards call Reload, or Watch to poll for changes.
+func NewReloadingAuthorizer(fsys fs.FS, glob string, opts ...Option) (*ReloadingAuthorizer, error) {
+	auth := &ReloadingAuthorizer{fsys: fsys, glob: glob}
+
+	files, hash, err := auth.read()
+	if err != nil {
+		return nil, err
+	}
+	policies, err := parser.ParseFiles(token.NewFileSet(), files)
+	if err != nil {
+		return nil, err
+	}
+	auth.SchemaAuthorizer = NewAuthorizer(policies, opts...)
+	auth.hash = hash
+
+	return auth, nil
+}
+
+// read returns the content of the matching files keyed by their name and a
+// hash of the names and contents
+func (auth *ReloadingAuthorizer) read() (map[string]string, string, error) {
+	names, err := fs.Glob(auth.fsys, auth.glob)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Glob returns the names sorted
+	files := make(map[string]string, len(names))
+	sum := sha256.New()
+	for _, name := range names {
+		data, err := fs.ReadFile(auth.fsys, name)
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to read policy file: %w", err)
+		}
+		files[name] = string(data)
+		fmt.Fprintf(sum, "%q:%d:", name, len(data))
+		sum.Write(data)
+	}
+
+	return files, hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// Reload reads the files again and replaces the policies if they changed.
+// When a file can't be read or parsed the error is returned and the current
+// policies are kept. It is the integration point for a file watcher such as
+// fsnotify, call it for each event.
+func (auth *ReloadingAuthorizer) Reload() error {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	files, hash, err := auth.read()
+	if err == nil && hash == auth.hash {
+		auth.err = nil
+		return nil
+	}
+	if err != nil {
+		auth.err = err
+		return err
+	}
+
+	policies, err := parser.ParseFiles(token.NewFileSet(), files)
+	if err != nil {
+		auth.err = err
+		return err
+	}
+	auth.SetPolicies(policies)
+	auth.hash = hash
+	auth.err = nil
+
+	return nil
+}
+
+// Err returns the error of the last reload, nil when it succeeded
+func (auth *ReloadingAuthorizer) Err() error {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+	return auth.err
+}
+
+// Watch reloads the policies every interval until stop is called, onError
+// when not nil is called with the errors of the reloads.
+func (auth *ReloadingAuthorizer) Watch(interval time.Duration, onError func(error)) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if err := auth.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
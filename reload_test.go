@@ -0,0 +1,153 @@
+package cedar_test
+
+import (
+	"context"
+	"io/fs"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadingAuthorizer(t *testing.T) {
+	fsys := fstest.MapFS{
+		"view.cedar":   {Data: []byte(`@id("view") permit(principal, action == Action::"view", resource);`)},
+		"README.md":    {Data: []byte(`not a policy`)},
+		"nested/x.txt": {Data: []byte(`not a policy`)},
+	}
+
+	auth, err := cedar.NewReloadingAuthorizer(fsys, "*.cedar")
+	require.NoError(t, err)
+
+	isAllowed := func(action string) bool {
+		ok, err := auth.IsAuthorized(context.TODO(), &cedar.Request{
+			Principal: engine.NewEntityValue("User", "alice"),
+			Action:    engine.NewEntityValue("Action", action),
+			Resource:  engine.NewEntityValue("Photo", "a"),
+		})
+		require.NoError(t, err)
+		return ok
+	}
+	assert.True(t, isAllowed("view"))
+	assert.False(t, isAllowed("edit"))
+
+	changes := []cedar.Change{}
+	auth.Subscribe(func(change cedar.Change) {
+		changes = append(changes, change)
+	})
+
+	// Unchanged files don't replace the policies
+	require.NoError(t, auth.Reload())
+	assert.Empty(t, changes)
+
+	fsys["edit.cedar"] = &fstest.MapFile{Data: []byte(`@id("edit") permit(principal, action == Action::"edit", resource);`)}
+	require.NoError(t, auth.Reload())
+	assert.True(t, isAllowed("edit"))
+	require.Len(t, changes, 1)
+	assert.Equal(t, []string{"edit"}, changes[0].Added)
+
+	// A broken file keeps the last policies
+	fsys["edit.cedar"] = &fstest.MapFile{Data: []byte(`permit(principal, action`)}
+	err = auth.Reload()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "edit.cedar")
+	assert.Equal(t, err, auth.Err())
+	assert.True(t, isAllowed("edit"))
+	assert.Len(t, changes, 1)
+
+	// Changing the body of a policy in place reports it as modified
+	fsys["edit.cedar"] = &fstest.MapFile{Data: []byte(`@id("edit") forbid(principal, action == Action::"edit", resource);`)}
+	require.NoError(t, auth.Reload())
+	assert.False(t, isAllowed("edit"))
+	require.Len(t, changes, 2)
+	assert.Empty(t, changes[1].Added)
+	assert.Empty(t, changes[1].Removed)
+	assert.Equal(t, []string{"edit"}, changes[1].Modified)
+
+	delete(fsys, "edit.cedar")
+	require.NoError(t, auth.Reload())
+	assert.NoError(t, auth.Err())
+	assert.False(t, isAllowed("edit"))
+	assert.True(t, isAllowed("view"))
+	require.Len(t, changes, 3)
+	assert.Equal(t, []string{"edit"}, changes[2].Removed)
+	assert.Empty(t, changes[2].Modified)
+}
+
+func TestReloadingAuthorizerErrors(t *testing.T) {
+	_, err := cedar.NewReloadingAuthorizer(fstest.MapFS{
+		"bad.cedar": {Data: []byte(`permit(`)},
+	}, "*.cedar")
+	assert.Error(t, err)
+
+	_, err = cedar.NewReloadingAuthorizer(fstest.MapFS{}, "[")
+	assert.Error(t, err)
+}
+
+// swapFS is a file system whose content is replaced while it is polled
+type swapFS struct {
+	mu   sync.Mutex
+	fsys fstest.MapFS
+}
+
+func (s *swapFS) Open(name string) (fs.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fsys.Open(name)
+}
+
+func (s *swapFS) set(fsys fstest.MapFS) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fsys = fsys
+}
+
+func TestReloadingAuthorizerWatch(t *testing.T) {
+	fsys := &swapFS{fsys: fstest.MapFS{
+		"all.cedar": {Data: []byte(`@id("all") permit(principal, action, resource);`)},
+	}}
+	auth, err := cedar.NewReloadingAuthorizer(fsys, "*.cedar")
+	require.NoError(t, err)
+
+	changes := make(chan cedar.Change, 10)
+	auth.Subscribe(func(change cedar.Change) {
+		changes <- change
+	})
+	errs := make(chan error, 10)
+	stop := auth.Watch(time.Millisecond, func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	defer stop()
+
+	fsys.set(fstest.MapFS{
+		"all.cedar": {Data: []byte(`permit(`)},
+	})
+	select {
+	case err := <-errs:
+		assert.Contains(t, err.Error(), "all.cedar")
+	case <-time.After(time.Second):
+		t.Fatal("parse error not reported")
+	}
+
+	fsys.set(fstest.MapFS{
+		"none.cedar": {Data: []byte(`@id("none") forbid(principal, action, resource);`)},
+	})
+	select {
+	case change := <-changes:
+		assert.Equal(t, []string{"none"}, change.Added)
+		assert.Equal(t, []string{"all"}, change.Removed)
+	case <-time.After(time.Second):
+		t.Fatal("policies not reloaded")
+	}
+
+	stop()
+	stop()
+}
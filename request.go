@@ -0,0 +1,102 @@
+package cedar
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/koblas/cedar-go/engine"
+)
+
+var ErrInvalidRequest = errors.New("invalid request")
+
+// RequestBuilder builds a Request from the text of its entities, e.g.
+//
+//	request, err := cedar.NewRequest().
+//		Principal(`User::"alice"`).
+//		Action(`Action::"view"`).
+//		Resource(`Photo::"vacation.jpg"`).
+//		Context(map[string]any{"mfa": true}).
+//		Build()
+//
+// The first error is returned by Build, the methods after it have no effect.
+type RequestBuilder struct {
+	request Request
+	context map[string]any
+	err     error
+}
+
+// NewRequest starts a request, the principal, action and resource must be
+// set before it is built
+func NewRequest() *RequestBuilder {
+	return &RequestBuilder{}
+}
+
+// entity parses the entity of the part of the request
+func (b *RequestBuilder) entity(part string, value string, target *engine.EntityValue) *RequestBuilder {
+	if b.err != nil {
+		return b
+	}
+	entity, err := engine.ParseEntity(value)
+	if err != nil {
+		b.err = fmt.Errorf("%s: %w: %w", part, err, ErrInvalidRequest)
+		return b
+	}
+	*target = entity
+	return b
+}
+
+// Principal sets the principal from its Cedar syntax, e.g. `User::"alice"`
+func (b *RequestBuilder) Principal(entity string) *RequestBuilder {
+	return b.entity("principal", entity, &b.request.Principal)
+}
+
+// Action sets the action from its Cedar syntax, e.g. `Action::"view"`
+func (b *RequestBuilder) Action(entity string) *RequestBuilder {
+	return b.entity("action", entity, &b.request.Action)
+}
+
+// Resource sets the resource from its Cedar syntax, e.g. `Photo::"a.jpg"`
+func (b *RequestBuilder) Resource(entity string) *RequestBuilder {
+	return b.entity("resource", entity, &b.request.Resource)
+}
+
+// Context sets the context as with NewContextFromMap, it is an empty record
+// when it isn't set
+func (b *RequestBuilder) Context(values map[string]any) *RequestBuilder {
+	b.context = values
+	return b
+}
+
+// Entities sets the entities which come with the request, see Request.Entities
+func (b *RequestBuilder) Entities(store engine.Store) *RequestBuilder {
+	b.request.Entities = store
+	return b
+}
+
+// Build returns the request, or the first error of the builder
+func (b *RequestBuilder) Build() (*Request, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	for _, item := range []struct {
+		part  string
+		value engine.EntityValue
+	}{
+		{"principal", b.request.Principal},
+		{"action", b.request.Action},
+		{"resource", b.request.Resource},
+	} {
+		if item.value.IsZero() {
+			return nil, fmt.Errorf("%s is not set: %w", item.part, ErrInvalidRequest)
+		}
+	}
+
+	context, err := NewContextFromMap(b.context)
+	if err != nil {
+		return nil, fmt.Errorf("context: %w: %w", err, ErrInvalidRequest)
+	}
+
+	request := b.request
+	request.Context = context
+	return &request, nil
+}
@@ -0,0 +1,50 @@
+package cedar_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestBuilder(t *testing.T) {
+	request, err := cedar.NewRequest().
+		Principal(`User::"alice::admin"`).
+		Action(`Action::"view"`).
+		Resource(`Photo::"say \"cheese\".jpg"`).
+		Context(map[string]any{"mfa": true}).
+		Build()
+	require.NoError(t, err)
+	assert.Equal(t, engine.NewEntityValue("User", "alice::admin"), request.Principal)
+	assert.Equal(t, engine.NewEntityValue("Photo", `say "cheese".jpg`), request.Resource)
+
+	policies, err := cedar.ParsePolicies(`permit(principal == User::"alice::admin", action, resource) when { context.mfa };`)
+	require.NoError(t, err)
+	ok, err := cedar.NewAuthorizer(policies).IsAuthorized(context.TODO(), request)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// The context defaults to an empty record
+	request, err = cedar.NewRequest().Principal(`User::"a"`).Action(`Action::"view"`).Resource(`Photo::"b"`).Build()
+	require.NoError(t, err)
+	require.NotNil(t, request.Context)
+}
+
+func TestRequestBuilderErrors(t *testing.T) {
+	_, err := cedar.NewRequest().Principal(`User::"a"`).Action(`Action::"view"`).Build()
+	assert.ErrorIs(t, err, cedar.ErrInvalidRequest)
+	assert.ErrorContains(t, err, "resource is not set")
+
+	// The first error is reported
+	_, err = cedar.NewRequest().Principal(`User::alice`).Action(`view`).Resource(`Photo::"b"`).Build()
+	assert.ErrorIs(t, err, cedar.ErrInvalidRequest)
+	assert.ErrorIs(t, err, engine.ErrInvalidEntityFormat)
+	assert.ErrorContains(t, err, "principal:")
+
+	_, err = cedar.NewRequest().Principal(`User::"a"`).Action(`Action::"view"`).Resource(`Photo::"b"`).
+		Context(map[string]any{"ip": map[string]any{"__extn": map[string]any{"fn": "ip", "arg": "not an ip"}}}).Build()
+	assert.ErrorIs(t, err, cedar.ErrInvalidRequest)
+}
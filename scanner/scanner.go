@@ -36,11 +36,12 @@ type Scanner struct {
 	mode Mode         // scanning mode
 
 	// scanning state
-	ch         rune      // current character
-	offset     int       // character offset
-	rdOffset   int       // reading offset (position after current character)
-	lineOffset int       // current line offset
-	nlPos      token.Pos // position of newline in preceding comment
+	ch         rune        // current character
+	offset     int         // character offset
+	rdOffset   int         // reading offset (position after current character)
+	lineOffset int         // current line offset
+	nlPos      token.Pos   // position of newline in preceding comment
+	prev       token.Token // preceding token other than a comment
 
 	// public state - ok to modify
 	ErrorCount int // number of errors encountered
@@ -126,6 +127,7 @@ func (s *Scanner) Init(file *token.File, src []byte, err ErrorHandler, mode Mode
 	s.offset = 0
 	s.rdOffset = 0
 	s.lineOffset = 0
+	s.prev = token.ILLEGAL
 	s.ErrorCount = 0
 
 	s.next()
@@ -469,69 +471,10 @@ func invalidSep(x string) int {
 	return -1
 }
 
-// scanEscape parses an escape sequence where rune is the accepted
-// escaped quote. In case of a syntax error, it stops at the offending
-// character (without consuming it) and returns false. Otherwise
-// it returns true.
-func (s *Scanner) scanEscape(quote rune) bool {
-	offs := s.offset
-
-	var base, max uint32
-	switch s.ch {
-	case 'n', 'r', 't', '\\', '\'', '*', '0', quote:
-		s.next()
-		return true
-	// case 'x':
-	case 'u':
-		base = 16
-		max = unicode.MaxRune
-		s.next()
-		if s.ch != '{' {
-			s.error(offs, "expected { to start unicode escape")
-			return false
-		}
-		s.next()
-	default:
-		msg := "unknown escape sequence '\\" + string(s.ch) + "' in string"
-		if s.ch < 0 {
-			msg = "escape sequence not terminated"
-		}
-		s.error(offs, msg)
-		return false
-	}
-
-	var x uint32
-	for isHex(s.ch) {
-		d := uint32(digitVal(s.ch))
-		if d >= base {
-			msg := fmt.Sprintf("illegal character %#U in escape sequence", s.ch)
-			if s.ch < 0 {
-				msg = "escape sequence not terminated"
-			}
-			s.error(s.offset, msg)
-			return false
-		}
-		x = x*base + d
-		s.next()
-	}
-
-	if s.ch != '}' {
-		s.error(offs, "expected } to end unicode escape")
-		return false
-	}
-	s.next()
-
-	if x > max || 0xD800 <= x && x < 0xE000 {
-		s.error(offs, "escape sequence is invalid Unicode code point")
-		return false
-	}
-
-	return true
-}
-
 func (s *Scanner) scanString() string {
 	// '"' opening already consumed
 	offs := s.offset - 1
+	terminated := false
 
 	for {
 		ch := s.ch
@@ -541,15 +484,29 @@ func (s *Scanner) scanString() string {
 		}
 		s.next()
 		if ch == '"' {
+			terminated = true
 			break
 		}
-		if ch == '\\' {
-			s.scanEscape('"')
+		if ch == '\\' && s.ch != '\n' && s.ch >= 0 {
+			// skip the escaped character, escapes are validated below
+			s.next()
 		}
 	}
 
-	// return string(s.src[offs:s.offset])
-	return string(s.src[offs:s.offset])
+	lit := string(s.src[offs:s.offset])
+	if terminated {
+		// Only the pattern of a `like` accepts the \* escape
+		unquote := Unquote
+		if s.prev == token.LIKE {
+			unquote = UnquotePattern
+		}
+		if _, err := unquote(lit); err != nil {
+			escErr := err.(*EscapeError)
+			s.error(offs+escErr.Offset, escErr.Msg)
+		}
+	}
+
+	return lit
 }
 
 func stripCR(b []byte, comment bool) []byte {
@@ -640,6 +597,7 @@ scanAgain:
 		// containing newline, at position of first newline.
 		pos, tok, lit = s.nlPos, token.SEMICOLON, "\n"
 		s.nlPos = token.NoPos
+		s.prev = tok
 		return
 	}
 
@@ -669,6 +627,7 @@ scanAgain:
 			// we only reach here if s.insertSemi was
 			// set in the first place and exited early
 			// from s.skipWhitespace()
+			s.prev = token.SEMICOLON
 			return pos, token.SEMICOLON, "\n"
 		case '"':
 			tok = token.STRINGLIT
@@ -788,5 +747,8 @@ scanAgain:
 		}
 	}
 
+	if tok != token.COMMENT {
+		s.prev = tok
+	}
 	return
 }
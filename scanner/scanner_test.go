@@ -655,7 +655,7 @@ func checkError(t *testing.T, src string, tok token.Token, pos int, lit, err str
 	}
 }
 
-var errors = []struct {
+var errorTests = []struct {
 	src string
 	tok token.Token
 	pos int
@@ -673,6 +673,10 @@ var errors = []struct {
 	//
 	{`"\0"`, token.STRINGLIT, 0, `"\0"`, ""},
 	{`"\u{6}"`, token.STRINGLIT, 0, `"\u{6}"`, ""},
+	{`"\*"`, token.STRINGLIT, 1, `"\*"`, "escape sequence '\\*' is only valid in a pattern"},
+	{`"ab\q"`, token.STRINGLIT, 3, `"ab\q"`, "unknown escape sequence '\\q' in string"},
+	{`"\u{6"`, token.STRINGLIT, 1, `"\u{6"`, "expected 1 to 6 hex digits and } to end unicode escape"},
+	{`"\u{D800}"`, token.STRINGLIT, 1, `"\u{D800}"`, "escape sequence is invalid Unicode code point"},
 	//
 	{"``", token.STRINGLIT, 0, "``", ""},
 	{"`", token.STRINGLIT, 0, "`", "raw string literal not terminated"},
@@ -690,11 +694,32 @@ var errors = []struct {
 }
 
 func TestScanErrors(t *testing.T) {
-	for _, e := range errors {
+	for _, e := range errorTests {
 		checkError(t, e.src, e.tok, e.pos, e.lit, e.err)
 	}
 }
 
+func TestScanPatternEscape(t *testing.T) {
+	src := []byte(`"\*" like /* any */ "\*"`)
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+
+	var errs ErrorList
+	var s Scanner
+	s.Init(file, src, errs.Add, ScanComments)
+	for {
+		_, tok, _ := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+	}
+
+	// Only the string which isn't a pattern has an error
+	if len(errs) != 1 || errs[0].Pos.Offset != 1 {
+		t.Errorf("got errors %v, expected one at offset 1", errs)
+	}
+}
+
 func BenchmarkScan(b *testing.B) {
 	b.StopTimer()
 	fset := token.NewFileSet()
@@ -0,0 +1,164 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInvalidEscape is wrapped by every EscapeError
+var ErrInvalidEscape = errors.New("invalid escape sequence")
+
+// EscapeError reports an invalid escape sequence, Offset is the byte offset
+// of the offending sequence from the start of the literal.
+type EscapeError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *EscapeError) Error() string {
+	return e.Msg
+}
+
+func (e *EscapeError) Unwrap() error {
+	return ErrInvalidEscape
+}
+
+// Unquote returns the value of a double quoted string literal. The escapes
+// accepted are those of the Cedar grammar: \n \r \t \\ \0 \' \" \x and \u{}.
+func Unquote(lit string) (string, error) {
+	return unescape(lit, false)
+}
+
+// UnquotePattern returns the value of a `like` pattern literal, which also
+// accepts the \* escape. In the result a bare '*' is a wildcard while a
+// literal '*' or '\' is escaped with a backslash.
+func UnquotePattern(lit string) (string, error) {
+	return unescape(lit, true)
+}
+
+// Quote returns the double quoted string literal of the value, which Unquote
+// reads back. Quotes, backslashes and control characters are escaped, the
+// bytes which aren't UTF-8 are kept as is so distinct values stay distinct.
+func Quote(value string) string {
+	var buf strings.Builder
+	buf.Grow(len(value) + 2)
+	buf.WriteByte('"')
+	for i := 0; i < len(value); {
+		ch, size := utf8.DecodeRuneInString(value[i:])
+		switch {
+		case ch == utf8.RuneError && size == 1:
+			buf.WriteByte(value[i])
+		case ch == '"' || ch == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(ch)
+		case ch == '\n':
+			buf.WriteString(`\n`)
+		case ch == '\r':
+			buf.WriteString(`\r`)
+		case ch == '\t':
+			buf.WriteString(`\t`)
+		case ch == 0:
+			buf.WriteString(`\0`)
+		case unicode.IsControl(ch):
+			fmt.Fprintf(&buf, `\u{%x}`, ch)
+		default:
+			buf.WriteString(value[i : i+size])
+		}
+		i += size
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+func unescape(lit string, pattern bool) (string, error) {
+	if len(lit) < 2 || lit[0] != '"' || lit[len(lit)-1] != '"' {
+		return "", &EscapeError{0, "string literal not quoted"}
+	}
+	body := lit[1 : len(lit)-1]
+	if !strings.ContainsRune(body, '\\') {
+		return body, nil
+	}
+
+	var buf strings.Builder
+	buf.Grow(len(body))
+
+	// literal writes a character which didn't come from the source as is
+	literal := func(ch rune) {
+		if pattern && (ch == '*' || ch == '\\') {
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(ch)
+	}
+
+	for i := 0; i < len(body); {
+		ch, size := utf8.DecodeRuneInString(body[i:])
+		if ch != '\\' {
+			buf.WriteRune(ch)
+			i += size
+			continue
+		}
+
+		// offset of the backslash within the literal
+		offs := i + 1
+		i += 1
+		if i == len(body) {
+			return "", &EscapeError{offs, "escape sequence not terminated"}
+		}
+		ch, size = utf8.DecodeRuneInString(body[i:])
+		i += size
+
+		switch ch {
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		case 't':
+			buf.WriteByte('\t')
+		case '0':
+			buf.WriteByte(0)
+		case '\\', '\'', '"':
+			literal(ch)
+		case '*':
+			if !pattern {
+				return "", &EscapeError{offs, "escape sequence '\\*' is only valid in a pattern"}
+			}
+			buf.WriteString(`\*`)
+		case 'x':
+			if i+2 > len(body) || !isHex(rune(body[i])) || !isHex(rune(body[i+1])) {
+				return "", &EscapeError{offs, "expected two hex digits in escape sequence"}
+			}
+			value := digitVal(rune(body[i]))<<4 | digitVal(rune(body[i+1]))
+			if value > 0x7f {
+				return "", &EscapeError{offs, "escape sequence \\x must be ASCII (at most \\x7f)"}
+			}
+			literal(rune(value))
+			i += 2
+		case 'u':
+			if i == len(body) || body[i] != '{' {
+				return "", &EscapeError{offs, "expected { to start unicode escape"}
+			}
+			i += 1
+			start := i
+			value := 0
+			for i < len(body) && isHex(rune(body[i])) && i-start < 6 {
+				value = value<<4 | digitVal(rune(body[i]))
+				i += 1
+			}
+			if i == start || i == len(body) || body[i] != '}' {
+				return "", &EscapeError{offs, "expected 1 to 6 hex digits and } to end unicode escape"}
+			}
+			i += 1
+			if value > unicode.MaxRune || 0xD800 <= value && value < 0xE000 {
+				return "", &EscapeError{offs, "escape sequence is invalid Unicode code point"}
+			}
+			literal(rune(value))
+		default:
+			return "", &EscapeError{offs, fmt.Sprintf("unknown escape sequence '\\%c' in string", ch)}
+		}
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,89 @@
+package scanner_test
+
+import (
+	"testing"
+
+	"github.com/koblas/cedar-go/scanner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnquote(t *testing.T) {
+	cases := []struct {
+		input  string
+		expect string
+	}{
+		{`"abc"`, "abc"},
+		{`"\n"`, "\n"},
+		{`"\0"`, "\000"},
+		{`"\x41\x7f"`, "A\x7f"},
+		{`"\u{6}"`, "\u0006"},
+		{`"\u{10FFFF}"`, "\U0010FFFF"},
+		{`"\u{2}1\u{1b}\"\u{2}\u{2}\u{2}\u{2}"`, "\u00021\u001b\"\u0002\u0002\u0002\u0002"},
+		{`"it\'s \\ ok"`, `it's \ ok`},
+	}
+
+	for _, item := range cases {
+		output, err := scanner.Unquote(item.input)
+		require.NoError(t, err, item.input)
+		assert.Equal(t, item.expect, output)
+	}
+}
+
+func TestUnquoteErrors(t *testing.T) {
+	cases := []struct {
+		input  string
+		offset int
+	}{
+		{`"\u{6"`, 1},
+		{`"ab\u6"`, 3},
+		{`"\u{}"`, 1},
+		{`"\u{1234567}"`, 1},
+		{`"\u{D800}"`, 1},
+		{`"\u{110000}"`, 1},
+		{`"\x80"`, 1},
+		{`"\x4"`, 1},
+		{`"a\q"`, 2},
+		{`"\*"`, 1},
+		{`"abc\"`, 4},
+	}
+
+	for _, item := range cases {
+		_, err := scanner.Unquote(item.input)
+		require.ErrorIs(t, err, scanner.ErrInvalidEscape, item.input)
+
+		var escErr *scanner.EscapeError
+		require.ErrorAs(t, err, &escErr)
+		assert.Equal(t, item.offset, escErr.Offset, item.input)
+	}
+}
+
+func TestUnquotePattern(t *testing.T) {
+	cases := []struct {
+		input  string
+		expect string
+	}{
+		{`"a*b"`, `a*b`},
+		{`"a\*b"`, `a\*b`},
+		{`"a\\b*"`, `a\\b*`},
+		{`"\u{2a}"`, `\*`},
+		{`"\n*"`, "\n*"},
+	}
+
+	for _, item := range cases {
+		output, err := scanner.UnquotePattern(item.input)
+		require.NoError(t, err, item.input)
+		assert.Equal(t, item.expect, output)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for _, value := range []string{"abc", `a"b`, `a\b`, "a::\"b\"", "\n\r\t\000", "\u0007\u001b\u0085", "é日本", ""} {
+		lit := scanner.Quote(value)
+		output, err := scanner.Unquote(lit)
+		require.NoError(t, err, lit)
+		assert.Equal(t, value, output, lit)
+	}
+	assert.Equal(t, `"a\"b\\c\n"`, scanner.Quote("a\"b\\c\n"))
+	assert.Equal(t, `"\u{7}"`, scanner.Quote("\a"))
+}
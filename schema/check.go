@@ -0,0 +1,102 @@
+package schema
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/koblas/cedar-go/engine"
+)
+
+// ValidateContext checks the context of a request against the context shape
+// the schema declares for the action, the required attributes must be present
+// and the attributes of the declared type. A nil context is an empty record.
+// The context isn't checked when the schema doesn't declare one for the action
+// and the principal and resource types.
+func (schema *Schema) ValidateContext(context *engine.VarValue, principal, action, resource engine.EntityValue) error {
+	shape := schema.findActionShape(action, principal, resource)
+	if shape == nil {
+		return nil
+	}
+	if context == nil {
+		context = engine.NewVarValue(map[string]engine.NamedType{})
+	}
+
+	return checkValue("context", context, shape)
+}
+
+// valueTypeName is the name of the type of the value as it is reported in a
+// NormalizeError
+func valueTypeName(value engine.NamedType) string {
+	switch v := value.(type) {
+	case engine.BoolValue:
+		return "Boolean"
+	case engine.IntValue:
+		return "Long"
+	case engine.StrValue:
+		return "String"
+	case engine.SetValue:
+		return "Set"
+	case *engine.VarValue:
+		return "Record"
+	case engine.EntityValue:
+		return v.EntityType()
+	}
+	return value.TypeName()
+}
+
+// checkValue checks a converted value is of the type of the shape
+func checkValue(path string, value engine.NamedType, shape *EntityShape) error {
+	matches := false
+	switch shape.Type {
+	case SHAPE_BOOL:
+		_, matches = value.(engine.BoolValue)
+	case SHAPE_LONG:
+		_, matches = value.(engine.IntValue)
+	case SHAPE_STRING:
+		_, matches = value.(engine.StrValue)
+	case SHAPE_ENTITY:
+		entity, ok := value.(engine.EntityValue)
+		matches = ok && entity.EntityType() == shape.Name
+	case SHAPE_EXTENSION:
+		matches = value.TypeName() == shape.Name
+	case SHAPE_SET:
+		set, ok := value.(engine.SetValue)
+		if !ok {
+			break
+		}
+		if shape.Element != nil {
+			for idx, item := range set {
+				if err := checkValue(path+"."+strconv.Itoa(idx), item, shape.Element); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case SHAPE_RECORD:
+		record, ok := value.(*engine.VarValue)
+		if !ok {
+			break
+		}
+		children := map[string]engine.NamedType{}
+		for _, key := range record.Keys() {
+			child, found := record.Get(key)
+			if !found {
+				return fmt.Errorf("%s: invalid value: %w", path+"."+key, ErrInvalidEntityFormat)
+			}
+			if attr := shape.Attributes[key]; attr != nil {
+				if err := checkValue(path+"."+key, child, attr); err != nil {
+					return err
+				}
+			}
+			children[key] = child
+		}
+		return checkRecord(path, children, shape)
+	default:
+		matches = true
+	}
+
+	if !matches {
+		return typeMismatch(path, shape, valueTypeName(value))
+	}
+	return nil
+}
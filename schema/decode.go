@@ -0,0 +1,558 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/koblas/cedar-go/engine"
+)
+
+// jsonDecoder converts a JSON token stream into engine values guided by the
+// schema shape, this avoids building the intermediate map[string]any values.
+type jsonDecoder struct {
+	dec *json.Decoder
+}
+
+func newJsonDecoder(data []byte) *jsonDecoder {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	return &jsonDecoder{dec: dec}
+}
+
+func (d *jsonDecoder) token(path string) (json.Token, error) {
+	tok, err := d.dec.Token()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: unexpected end of input: %w", path, ErrInvalidEntityFormat)
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", path, err, ErrInvalidEntityFormat)
+	}
+	return tok, nil
+}
+
+func (d *jsonDecoder) value(path string, shape *EntityShape) (engine.NamedType, error) {
+	if shape != nil && shape.Type == SHAPE_EXTENSION {
+		var raw any
+		if err := d.dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, err, ErrInvalidEntityFormat)
+		}
+		return specialExtension(path, shape.Name, reflect.ValueOf(raw))
+	}
+	tok, err := d.token(path)
+	if err != nil {
+		return nil, err
+	}
+	return d.valueFrom(path, tok, shape)
+}
+
+func (d *jsonDecoder) valueFrom(path string, tok json.Token, shape *EntityShape) (engine.NamedType, error) {
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '[' {
+			var sub *EntityShape
+			if shape != nil {
+				if shape.Type != SHAPE_SET {
+					return nil, typeMismatch(path, shape, "Set")
+				}
+				sub = shape.Element
+			}
+			// Prefer empty list over nil
+			result := engine.SetValue{}
+			for i := 0; d.dec.More(); i++ {
+				val, err := d.value(fmt.Sprintf("%s.%d", path, i), sub)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, val)
+			}
+			if _, err := d.token(path); err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+
+		var sub *EntityShape
+		if shape == nil {
+			// nothing
+		} else if shape.Type == SHAPE_ENTITY {
+			return d.entity(path, true)
+		} else if shape.Type == SHAPE_RECORD {
+			sub = shape
+		} else {
+			return nil, typeMismatch(path, shape, "Record")
+		}
+		return d.record(path, sub)
+	case bool:
+		if shape != nil && shape.Type != SHAPE_BOOL {
+			return nil, typeMismatch(path, shape, "Boolean")
+		}
+		return engine.BoolValue(v), nil
+	case json.Number:
+		if shape != nil && shape.Type != SHAPE_LONG {
+			return nil, typeMismatch(path, shape, "Long")
+		}
+		return numberLong(path, v)
+	case string:
+		if shape != nil && shape.Type == SHAPE_ENTITY {
+			return legacyEntity(path, v)
+		}
+		if shape != nil && shape.Type != SHAPE_STRING {
+			return nil, typeMismatch(path, shape, "String")
+		}
+		return engine.StrValue(v), nil
+	}
+
+	return nil, fmt.Errorf("%s: unexpected value %v: %w", path, tok, ErrUnsupportedType)
+}
+
+// record decodes the body of an object, the opening '{' has been consumed
+func (d *jsonDecoder) record(path string, record *EntityShape) (engine.NamedType, error) {
+	var shape map[string]*EntityShape
+	if record != nil {
+		shape = record.Attributes
+	}
+	children := map[string]engine.NamedType{}
+	var special engine.NamedType
+
+	for d.dec.More() {
+		tok, err := d.token(path)
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		if _, found := children[key]; found {
+			return nil, fmt.Errorf("%s: %w: %w", attrPath(path, key), ErrDuplicateKey, ErrInvalidEntityFormat)
+		}
+
+		var sub *EntityShape
+		if shape != nil {
+			sub = shape[key]
+		}
+
+		switch {
+		case (sub != nil && sub.Type == SHAPE_ENTITY) || key == "__entity" || key == "__expr":
+			val, err := d.entityRef(attrPath(path, key), key != "__entity")
+			if err != nil {
+				return nil, err
+			}
+			if sub != nil && val.EntityType() != sub.Name {
+				return nil, typeMismatch(attrPath(path, key), sub, val.EntityType())
+			}
+			if key == "__entity" || key == "__expr" {
+				special = val
+			}
+			children[key] = val
+		case (sub != nil && sub.Type == SHAPE_EXTENSION) || key == "__extn":
+			kind := ""
+			if sub != nil {
+				kind = sub.Name
+			}
+			var raw any
+			if err := d.dec.Decode(&raw); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", path, err, ErrInvalidEntityFormat)
+			}
+			val, err := specialExtension(attrPath(path, key), kind, reflect.ValueOf(raw))
+			if err != nil {
+				return nil, err
+			}
+			if key == "__extn" {
+				special = val
+			}
+			children[key] = val
+		default:
+			val, err := d.value(path+"."+key, sub)
+			if err != nil {
+				return nil, err
+			}
+			children[key] = val
+		}
+	}
+	if _, err := d.token(path); err != nil {
+		return nil, err
+	}
+	if special != nil {
+		if err := specialKeys(path, len(children)); err != nil {
+			return nil, err
+		}
+		return special, nil
+	}
+
+	if err := checkRecord(path, children, record); err != nil {
+		return nil, err
+	}
+
+	return engine.NewVarValue(children), nil
+}
+
+func (d *jsonDecoder) expectObject(path string) error {
+	tok, err := d.token(path)
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("%s: expected map got %v for entity: %w", path, tok, ErrInvalidEntityFormat)
+	}
+	return nil
+}
+
+// entityRef decodes an entity reference, the legacy string form is only
+// accepted when allowUnderscore is set
+func (d *jsonDecoder) entityRef(path string, allowUnderscore bool) (engine.EntityValue, error) {
+	tok, err := d.token(path)
+	if err != nil {
+		return engine.EntityValue{}, err
+	}
+	if str, ok := tok.(string); ok && allowUnderscore {
+		return legacyEntity(path, str)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return engine.EntityValue{}, fmt.Errorf("%s: expected map got %v for entity: %w", path, tok, ErrInvalidEntityFormat)
+	}
+	return d.entity(path, allowUnderscore)
+}
+
+// entity decodes the body of an entity reference, the opening '{' has been consumed
+func (d *jsonDecoder) entity(path string, allowUnderscore bool) (engine.EntityValue, error) {
+	var id, kind *string
+	var nested engine.EntityValue
+	keys := 0
+
+	for d.dec.More() {
+		tok, err := d.token(path)
+		if err != nil {
+			return engine.EntityValue{}, err
+		}
+		key, _ := tok.(string)
+		keys++
+
+		switch key {
+		case "__entity":
+			if !allowUnderscore {
+				break
+			}
+			if err := d.expectObject(path); err != nil {
+				return engine.EntityValue{}, err
+			}
+			if nested, err = d.entity(path, false); err != nil {
+				return engine.EntityValue{}, err
+			}
+			continue
+		case "__expr":
+			if !allowUnderscore {
+				break
+			}
+			if nested, err = d.entityRef(path, true); err != nil {
+				return engine.EntityValue{}, err
+			}
+			continue
+		case "id", "type":
+			tok, err := d.token(path)
+			if err != nil {
+				return engine.EntityValue{}, err
+			}
+			str, ok := tok.(string)
+			if !ok {
+				return engine.EntityValue{}, fmt.Errorf("%s: '%s' type not string got %T for entity: %w", path, key, tok, ErrInvalidEntityFormat)
+			}
+			if key == "id" {
+				id = &str
+			} else {
+				kind = &str
+			}
+			continue
+		}
+
+		// Skip the value of any other key
+		var skip json.RawMessage
+		if err := d.dec.Decode(&skip); err != nil {
+			return engine.EntityValue{}, fmt.Errorf("%s: %s: %w", path, err, ErrInvalidEntityFormat)
+		}
+	}
+	if _, err := d.token(path); err != nil {
+		return engine.EntityValue{}, err
+	}
+
+	if !nested.IsZero() {
+		if err := specialKeys(path, keys); err != nil {
+			return engine.EntityValue{}, err
+		}
+		return nested, nil
+	}
+	if id == nil {
+		return engine.EntityValue{}, fmt.Errorf("%s: missing id field for entity: %w", path, ErrInvalidEntityFormat)
+	}
+	if kind == nil {
+		return engine.EntityValue{}, fmt.Errorf("%s: missing type field for entity: %w", path, ErrInvalidEntityFormat)
+	}
+
+	return engine.NewEntityValue(*kind, *id), nil
+}
+
+// decodeJson converts raw JSON into an engine value guided by the shape
+func decodeJson(path string, data json.RawMessage, shape *EntityShape) (engine.NamedType, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return engine.NewVarValue(map[string]engine.NamedType{}), nil
+	}
+
+	d := newJsonDecoder(data)
+	val, err := d.value(path, shape)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: unexpected data after value: %w", path, ErrInvalidEntityFormat)
+	}
+
+	return val, nil
+}
+
+// any decodes the next value as encoding/json does into an `any`, except
+// that numbers are a json.Number and a duplicate key is an error
+func (d *jsonDecoder) any(path string) (any, error) {
+	tok, err := d.token(path)
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+
+	if delim == '[' {
+		list := []any{}
+		for d.dec.More() {
+			item, err := d.any(fmt.Sprintf("%s.%d", path, len(list)))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		if _, err := d.token(path); err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+
+	object := map[string]any{}
+	for d.dec.More() {
+		tok, err := d.token(path)
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		if _, found := object[key]; found {
+			return nil, fmt.Errorf("%s: %w: %w", attrPath(path, key), ErrDuplicateKey, ErrInvalidEntityFormat)
+		}
+		if object[key], err = d.any(path + "." + key); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := d.token(path); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// unmarshalJson decodes the JSON document with the rules of jsonDecoder.any
+func unmarshalJson(data []byte) (any, error) {
+	d := newJsonDecoder(data)
+	value, err := d.any("")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unexpected data after value: %w", ErrInvalidEntityFormat)
+	}
+	return value, nil
+}
+
+// jsonObject is the value as an object, null is an empty one
+func jsonObject(name string, value any) (map[string]any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	object, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected map got %T: %w", name, value, ErrInvalidEntityFormat)
+	}
+	return object, nil
+}
+
+// DecodeAttributes converts the JSON attributes of an entity, for example a
+// column of a database, using the shape of the entity type when known
+func (schema *Schema) DecodeAttributes(uid engine.EntityValue, data []byte) (*engine.VarValue, error) {
+	shape, err := schema.FindDef(uid)
+	if err != nil {
+		return nil, err
+	}
+	values, err := decodeJson(uid.String(), data, shape)
+	if err != nil {
+		return nil, err
+	}
+	varval, ok := values.(*engine.VarValue)
+	if !ok {
+		return nil, fmt.Errorf("expected variable type got=%s: %w", values.TypeName(), ErrUnsupportedType)
+	}
+	return varval, nil
+}
+
+// entityItem decodes a single entity of the form `{"uid": ..., "attrs": ..., "parents": [...], "tags": ...}`
+func (d *jsonDecoder) entityItem(schema *Schema) (EntityStoreItem, error) {
+	if err := d.expectObject(""); err != nil {
+		return EntityStoreItem{}, err
+	}
+
+	var uid engine.EntityValue
+	var parents []engine.EntityValue
+	var values engine.NamedType
+	// attributes that preceded the uid are decoded once the shape is known
+	var pending json.RawMessage
+	var tags map[string]any
+	seen := map[string]bool{}
+
+	for d.dec.More() {
+		tok, err := d.token("")
+		if err != nil {
+			return EntityStoreItem{}, err
+		}
+		key, _ := tok.(string)
+		if seen[key] {
+			return EntityStoreItem{}, fmt.Errorf("entity field %s: %w: %w", key, ErrDuplicateKey, ErrInvalidEntityFormat)
+		}
+		seen[key] = true
+
+		switch key {
+		case "uid":
+			if err := d.expectObject(""); err != nil {
+				return EntityStoreItem{}, err
+			}
+			if uid, err = d.entity("", true); err != nil {
+				return EntityStoreItem{}, err
+			}
+		case "parents":
+			if tok, err := d.token(""); err != nil {
+				return EntityStoreItem{}, err
+			} else if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+				return EntityStoreItem{}, fmt.Errorf("expected list of parents got %v: %w", tok, ErrInvalidEntityFormat)
+			}
+			for d.dec.More() {
+				if err := d.expectObject(""); err != nil {
+					return EntityStoreItem{}, err
+				}
+				ent, err := d.entity("", true)
+				if err != nil {
+					return EntityStoreItem{}, err
+				}
+				parents = append(parents, ent)
+			}
+			if _, err := d.token(""); err != nil {
+				return EntityStoreItem{}, err
+			}
+		case "attrs":
+			if uid.IsZero() {
+				if err := d.dec.Decode(&pending); err != nil {
+					return EntityStoreItem{}, fmt.Errorf("%s: %w", err, ErrInvalidEntityFormat)
+				}
+				continue
+			}
+			shape, err := schema.FindDef(uid)
+			if err != nil {
+				return EntityStoreItem{}, err
+			}
+			if values, err = d.value(uid.String(), shape); err != nil {
+				return EntityStoreItem{}, err
+			}
+		case "tags":
+			// tags are rare and small, they're converted with the same
+			// rules as NormalizeEntites
+			raw, err := d.any(uid.String() + ".tags")
+			if err != nil {
+				return EntityStoreItem{}, err
+			}
+			if tags, err = jsonObject("tags", raw); err != nil {
+				return EntityStoreItem{}, err
+			}
+		default:
+			var skip json.RawMessage
+			if err := d.dec.Decode(&skip); err != nil {
+				return EntityStoreItem{}, fmt.Errorf("%s: %w", err, ErrInvalidEntityFormat)
+			}
+		}
+	}
+	if _, err := d.token(""); err != nil {
+		return EntityStoreItem{}, err
+	}
+
+	if uid.IsZero() {
+		return EntityStoreItem{}, fmt.Errorf("missing uid for entity: %w", ErrInvalidEntityFormat)
+	}
+	if values == nil {
+		shape, err := schema.FindDef(uid)
+		if err != nil {
+			return EntityStoreItem{}, err
+		}
+		if values, err = decodeJson(uid.String(), pending, shape); err != nil {
+			return EntityStoreItem{}, err
+		}
+	}
+	varval, ok := values.(*engine.VarValue)
+	if !ok {
+		return EntityStoreItem{}, fmt.Errorf("expected variable type got=%s: %w", values.TypeName(), ErrUnsupportedType)
+	}
+	tagValues, err := schema.normalizeTags(uid, tags)
+	if err != nil {
+		return EntityStoreItem{}, err
+	}
+
+	return EntityStoreItem{
+		entity:  uid,
+		values:  varval,
+		parents: parents,
+		tags:    tagValues,
+	}, nil
+}
+
+// DecodeEntities reads the JSON entities format and converts the attributes
+// directly into engine values without an intermediate representation.
+func (schema *Schema) DecodeEntities(reader io.Reader) (EntityStore, error) {
+	collection := EntityStore{}
+	if err := schema.StreamEntities(reader, collection.Add); err != nil {
+		return nil, err
+	}
+
+	return collection, nil
+}
+
+// StreamEntities reads the JSON entities format calling fn with each entity
+// as it is decoded, so only a single entity is held in memory at a time.
+// Decoding stops at the first error returned by fn.
+func (schema *Schema) StreamEntities(reader io.Reader, fn func(EntityStoreItem) error) error {
+	dec := json.NewDecoder(reader)
+	dec.UseNumber()
+	d := jsonDecoder{dec: dec}
+
+	if tok, err := d.token(""); err != nil {
+		return fmt.Errorf("unable to decode entities: %w", err)
+	} else if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("unable to decode entities expected list got %v: %w", tok, ErrInvalidEntityFormat)
+	}
+
+	for dec.More() {
+		item, err := d.entityItem(schema)
+		if err != nil {
+			return err
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	if _, err := d.token(""); err != nil {
+		return fmt.Errorf("unable to decode entities: %w", err)
+	}
+
+	return nil
+}
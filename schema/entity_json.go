@@ -1,5 +1,7 @@
 package schema
 
+import "fmt"
+
 // type JsonEntityValue struct {
 // 	Type string `json:"type,omitempty"`
 // 	Id   string `json:"id,omitempty"`
@@ -13,9 +15,62 @@ package schema
 type JsonEntityValue map[string]any
 
 type JsonEntityItem struct {
-	Uid     JsonEntityValue   `json:"uid"`
-	Parents []JsonEntityValue `json:"parents"`
-	Attrs   map[string]any    `json:"attrs"`
+	Uid     JsonEntityValue   `json:"uid" yaml:"uid"`
+	Parents []JsonEntityValue `json:"parents" yaml:"parents"`
+	Attrs   map[string]any    `json:"attrs" yaml:"attrs"`
+	Tags    map[string]any    `json:"tags,omitempty" yaml:"tags,omitempty"`
 }
 
 type JsonEntities []JsonEntityItem
+
+// UnmarshalJSON decodes the entity with the rules of DecodeEntities: numbers
+// are kept as a json.Number, so a long isn't rounded through a float64, and
+// a duplicate key is an error
+func (item *JsonEntityItem) UnmarshalJSON(data []byte) error {
+	raw, err := unmarshalJson(data)
+	if err != nil {
+		return err
+	}
+	object, ok := raw.(map[string]any)
+	if !ok {
+		return fmt.Errorf("expected map got %T for entity: %w", raw, ErrInvalidEntityFormat)
+	}
+
+	result := JsonEntityItem{}
+	for key, value := range object {
+		switch key {
+		case "uid":
+			uid, err := jsonObject(key, value)
+			if err != nil {
+				return err
+			}
+			result.Uid = uid
+		case "parents":
+			if value == nil {
+				continue
+			}
+			list, ok := value.([]any)
+			if !ok {
+				return fmt.Errorf("expected list of parents got %T: %w", value, ErrInvalidEntityFormat)
+			}
+			for _, parent := range list {
+				ref, err := jsonObject(key, parent)
+				if err != nil {
+					return err
+				}
+				result.Parents = append(result.Parents, ref)
+			}
+		case "attrs":
+			if result.Attrs, err = jsonObject(key, value); err != nil {
+				return err
+			}
+		case "tags":
+			if result.Tags, err = jsonObject(key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	*item = result
+	return nil
+}
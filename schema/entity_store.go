@@ -2,6 +2,8 @@ package schema
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 
 	"github.com/koblas/cedar-go/engine"
 )
@@ -10,10 +12,67 @@ type EntityStoreItem struct {
 	entity  engine.EntityValue
 	parents []engine.EntityValue
 	values  *engine.VarValue
+	tags    *engine.VarValue
+}
+
+// NewEntityStoreItem creates an entity for an EntityStore, values may be nil
+// when the entity has no attributes.
+func NewEntityStoreItem(entity engine.EntityValue, parents []engine.EntityValue, values *engine.VarValue) EntityStoreItem {
+	return EntityStoreItem{entity: entity, parents: parents, values: values}
+}
+
+// Entity returns the uid of the entity
+func (item EntityStoreItem) Entity() engine.EntityValue {
+	return item.entity
+}
+
+// Parents returns the direct parents of the entity
+func (item EntityStoreItem) Parents() []engine.EntityValue {
+	return item.parents
+}
+
+// Values returns the attributes of the entity
+func (item EntityStoreItem) Values() *engine.VarValue {
+	return item.values
+}
+
+// Tags returns the tags of the entity, nil when it has none
+func (item EntityStoreItem) Tags() *engine.VarValue {
+	return item.tags
+}
+
+// WithTags returns a copy of the entity with the tags
+func (item EntityStoreItem) WithTags(tags *engine.VarValue) EntityStoreItem {
+	item.tags = tags
+	return item
 }
 
 type EntityStore map[string]EntityStoreItem
 
+// Add inserts the entity into the store, replacing any entity with the same
+// uid. The store isn't safe for concurrent updates. The parents are kept
+// sorted so GetParents doesn't depend on the order they were listed in.
+func (store EntityStore) Add(item EntityStoreItem) error {
+	if item.entity.IsZero() {
+		return fmt.Errorf("missing uid for entity: %w", ErrInvalidEntityFormat)
+	}
+	item.parents = sortedEntities(item.parents)
+	store[item.entity.String()] = item
+	return nil
+}
+
+// sortedEntities returns the entities sorted by their uid, the list is only
+// copied when it isn't already sorted
+func sortedEntities(list []engine.EntityValue) []engine.EntityValue {
+	less := func(i, j int) bool { return list[i].String() < list[j].String() }
+	if sort.SliceIsSorted(list, less) {
+		return list
+	}
+	list = append([]engine.EntityValue(nil), list...)
+	sort.Slice(list, less)
+	return list
+}
+
 type EmptyStore struct{}
 
 var ErrNotFoundInStore = errors.New("not found in store")
@@ -25,7 +84,7 @@ func NewEmptyStore() *EmptyStore {
 }
 
 func (store *EmptyStore) Get(key engine.EntityValue, str string) (engine.EvalValue, error) {
-	return nil, nil
+	return nil, engine.ErrValueNotFound
 }
 
 func (store *EmptyStore) GetParents(key engine.EntityValue) ([]engine.EntityValue, error) {
@@ -33,6 +92,7 @@ func (store *EmptyStore) GetParents(key engine.EntityValue) ([]engine.EntityValu
 }
 
 var _ engine.Store = (EntityStore)(nil)
+var _ engine.TagStore = (EntityStore)(nil)
 
 func (store EntityStore) Get(key engine.EntityValue, str string) (engine.EvalValue, error) {
 	value, found := store[key.String()]
@@ -52,32 +112,56 @@ func (store EntityStore) Get(key engine.EntityValue, str string) (engine.EvalVal
 	return val, nil
 }
 
-func (store EntityStore) GetParents(key engine.EntityValue) ([]engine.EntityValue, error) {
-	seen := map[string]engine.EntityValue{}
-	todo := []engine.EntityValue{key}
+func (store EntityStore) GetTag(key engine.EntityValue, tag string) (engine.EvalValue, error) {
+	value, found := store[key.String()]
+	if !found || value.tags == nil {
+		return nil, engine.ErrValueNotFound
+	}
 
-	for len(todo) != 0 {
-		first := todo[0]
-		todo = todo[1:]
+	return value.tags.OpLookup(engine.StrValue(tag), store)
+}
 
-		lookup := first.String()
-		if _, found := seen[lookup]; found {
-			continue
-		}
-		seen[lookup] = first
+// GetParents returns the ancestors of the entity, nearest first and those at
+// the same distance in the order of their uid
+func (store EntityStore) GetParents(key engine.EntityValue) ([]engine.EntityValue, error) {
+	// The output doubles as the queue of the entities to visit, the seen
+	// lookup is only built once a linear scan of it gets costly
+	output := []engine.EntityValue{key}
+	var seen map[string]bool
 
-		value, found := store[lookup]
+	for idx := 0; idx < len(output); idx++ {
+		value, found := store[output[idx].String()]
 		if !found {
 			continue
 		}
 
-		todo = append(todo, value.parents...)
+		for _, parent := range value.parents {
+			if seen == nil && len(output) > 16 {
+				seen = make(map[string]bool, 2*len(output))
+				for _, item := range output {
+					seen[item.String()] = true
+				}
+			}
+			if seen != nil {
+				if seen[parent.String()] {
+					continue
+				}
+				seen[parent.String()] = true
+			} else if containsEntity(output, parent) {
+				continue
+			}
+			output = append(output, parent)
+		}
 	}
 
-	output := []engine.EntityValue{}
-	for _, value := range seen {
-		output = append(output, value)
-	}
+	return output[1:], nil
+}
 
-	return output, nil
+func containsEntity(list []engine.EntityValue, entity engine.EntityValue) bool {
+	for _, item := range list {
+		if item.String() == entity.String() {
+			return true
+		}
+	}
+	return false
 }
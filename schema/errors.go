@@ -1,8 +1,43 @@
 package schema
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var ErrInvalidEntityFormat = errors.New("invalid entity format")
 var ErrUnsupportedType = errors.New("unsupported type in store generation")
 var ErrInvalidMapKey = errors.New("invalid map key")
 var ErrValueNotFound = errors.New("value not found in store")
+var ErrUndeclaredAttribute = errors.New("attribute not declared by the schema")
+var ErrSchemaConflict = errors.New("conflicting schema definitions")
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// NormalizeError is a value of an entity or context which isn't of the type
+// the schema declares for it
+type NormalizeError struct {
+	// Path is the value from the entity or `context`, e.g. `User::"alice".address.zip`
+	Path string
+	// Expected is the type declared by the schema
+	Expected string
+	// Got is the type of the value
+	Got string
+}
+
+func (e *NormalizeError) Error() string {
+	return fmt.Sprintf("%s: expected %s got %s: %s", e.Path, e.Expected, e.Got, ErrInvalidEntityFormat)
+}
+
+// Unwrap returns ErrInvalidEntityFormat
+func (e *NormalizeError) Unwrap() error {
+	return ErrInvalidEntityFormat
+}
+
+// typeMismatch reports the value at path isn't of the type of the shape
+func typeMismatch(path string, shape *EntityShape, got string) error {
+	expected := shape.Type.String()
+	if shape.Type == SHAPE_ENTITY || shape.Type == SHAPE_EXTENSION {
+		expected = shape.Name
+	}
+	return &NormalizeError{Path: path, Expected: expected, Got: got}
+}
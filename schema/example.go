@@ -0,0 +1,169 @@
+package schema
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/koblas/cedar-go/engine"
+)
+
+// exampleCount is the number of entities generated for each entity type
+const exampleCount = 3
+
+var exampleWords = []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot"}
+
+// exampleGenerator holds the state for generating the example entities
+type exampleGenerator struct {
+	rng     *rand.Rand
+	parents map[string][]engine.EntityValue
+}
+
+// ExampleEntities generates entities of every entity type of the schema for
+// property based testing of policies, the same seed generates the same
+// entities. Each entity has the required attributes of its type and some of
+// the optional ones, entity references are to the generated entities and the
+// parents are of the memberOf types without creating a cycle. An attribute
+// whose type can't be generated, such as `duration`, is left out.
+func (schema *Schema) ExampleEntities(seed int64) EntityStore {
+	gen := exampleGenerator{
+		rng:     rand.New(rand.NewSource(seed)),
+		parents: map[string][]engine.EntityValue{},
+	}
+	store := EntityStore{}
+
+	for _, name := range schema.EntityTypeNames() {
+		def := schema.EntityTypes[name]
+		for idx := 0; idx < exampleCount; idx++ {
+			uid := exampleUid(name, idx)
+
+			values := engine.NewVarValue(map[string]engine.NamedType{})
+			if def.Shape != nil && def.Shape.Type == SHAPE_RECORD {
+				if record, ok := gen.value(def.Shape).(*engine.VarValue); ok {
+					values = record
+				}
+			}
+			item := NewEntityStoreItem(uid, sortedEntities(gen.memberOf(uid, def.MemberOfTypes)), values)
+			if def.Tags != nil {
+				item = item.WithTags(gen.tags(def.Tags))
+			}
+			store[uid.String()] = item
+		}
+	}
+
+	return store
+}
+
+// exampleUid returns the uid of a generated entity, e.g. `App::User::"user-0"`
+func exampleUid(entityType string, idx int) engine.EntityValue {
+	_, name := splitName(entityType)
+	return engine.NewEntityValue(entityType, fmt.Sprintf("%s-%d", strings.ToLower(name), idx))
+}
+
+func (g *exampleGenerator) word() string {
+	return exampleWords[g.rng.Intn(len(exampleWords))]
+}
+
+// memberOf picks the parents of the entity, skipping those which would make
+// the entity its own ancestor
+func (g *exampleGenerator) memberOf(uid engine.EntityValue, types []string) []engine.EntityValue {
+	parents := []engine.EntityValue{}
+	for _, kind := range types {
+		if g.rng.Intn(2) == 0 {
+			continue
+		}
+		parent := exampleUid(kind, g.rng.Intn(exampleCount))
+		if !g.isAncestor(uid, parent) {
+			parents = append(parents, parent)
+		}
+	}
+	g.parents[uid.String()] = parents
+
+	return parents
+}
+
+// isAncestor reports whether the entity is the same as or an ancestor of other
+func (g *exampleGenerator) isAncestor(entity engine.EntityValue, other engine.EntityValue) bool {
+	if entity.String() == other.String() {
+		return true
+	}
+	for _, parent := range g.parents[other.String()] {
+		if g.isAncestor(entity, parent) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *exampleGenerator) tags(shape *EntityShape) *engine.VarValue {
+	tags := map[string]engine.NamedType{}
+	for count := g.rng.Intn(3); count > 0; count-- {
+		if value := g.value(shape); value != nil {
+			tags[g.word()] = value
+		}
+	}
+	return engine.NewVarValue(tags)
+}
+
+// value generates a value of the shape, nil when it isn't possible
+func (g *exampleGenerator) value(shape *EntityShape) engine.NamedType {
+	switch shape.Type {
+	case SHAPE_BOOL:
+		return engine.BoolValue(g.rng.Intn(2) == 1)
+	case SHAPE_LONG:
+		return engine.IntValue(g.rng.Int63n(1000))
+	case SHAPE_STRING:
+		return engine.StrValue(fmt.Sprintf("%s-%d", g.word(), g.rng.Intn(100)))
+	case SHAPE_ENTITY:
+		return exampleUid(shape.Name, g.rng.Intn(exampleCount))
+	case SHAPE_SET:
+		values := []engine.NamedType{}
+		if shape.Element != nil {
+			for count := g.rng.Intn(4); count > 0; count-- {
+				if value := g.value(shape.Element); value != nil {
+					values = append(values, value)
+				}
+			}
+		}
+		return engine.NewSetValue(values...)
+	case SHAPE_EXTENSION:
+		return g.extension(shape.Name)
+	case SHAPE_RECORD:
+		// The attributes are visited in order so the seed decides the values
+		keys := make([]string, 0, len(shape.Attributes))
+		for key := range shape.Attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		children := map[string]engine.NamedType{}
+		for _, key := range keys {
+			attr := shape.Attributes[key]
+			if !attr.Required && g.rng.Intn(2) == 0 {
+				continue
+			}
+			if value := g.value(attr); value != nil {
+				children[key] = value
+			}
+		}
+		return engine.NewVarValue(children)
+	}
+	return nil
+}
+
+func (g *exampleGenerator) extension(name string) engine.NamedType {
+	switch name {
+	case "ipaddr":
+		value, err := engine.NewIpValue(fmt.Sprintf("10.%d.%d.%d", g.rng.Intn(256), g.rng.Intn(256), g.rng.Intn(256)))
+		if err == nil {
+			return value
+		}
+	case "decimal":
+		value, err := engine.NewDecimalValue(fmt.Sprintf("%d.%04d", g.rng.Intn(1000), g.rng.Intn(10000)))
+		if err == nil {
+			return value
+		}
+	}
+	return nil
+}
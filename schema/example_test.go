@@ -0,0 +1,50 @@
+package schema_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExampleEntities(t *testing.T) {
+	s, err := schema.NewFromText(strings.NewReader(photoTextSchema + `
+	entity Folder in [Folder] { server: ipaddr, size?: decimal } tags Long;
+	`))
+	require.NoError(t, err)
+
+	store := s.ExampleEntities(42)
+	assert.Len(t, store, 3*len(s.EntityTypes))
+	assert.Equal(t, store, s.ExampleEntities(42))
+
+	// The generated entities satisfy the schema
+	input := schema.JsonEntities{}
+	for _, item := range store {
+		entity := schema.JsonEntityItem{
+			Uid:   schema.JsonEntityValue{"type": item.Entity().EntityType(), "id": item.Entity().EntityId()},
+			Attrs: item.Values().AsJson().(map[string]any),
+		}
+		for _, parent := range item.Parents() {
+			entity.Parents = append(entity.Parents, schema.JsonEntityValue{"type": parent.EntityType(), "id": parent.EntityId()})
+		}
+		if item.Tags() != nil {
+			entity.Tags = item.Tags().AsJson().(map[string]any)
+		}
+		input = append(input, entity)
+	}
+	data, err := json.Marshal(input)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &input))
+
+	_, err = s.NormalizeEntites(input)
+	assert.NoError(t, err)
+
+	user, found := store[`PhotoApp::User::"user-0"`]
+	require.True(t, found)
+	name, found := user.Values().Get("name")
+	require.True(t, found)
+	assert.Equal(t, "string", name.TypeName())
+}
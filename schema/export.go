@@ -0,0 +1,339 @@
+package schema
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MarshalJSON writes the schema in the Cedar JSON schema format
+func (schema *Schema) MarshalJSON() ([]byte, error) {
+	return json.Marshal(schema.JsonSchema())
+}
+
+// JsonSchema returns the definition of the schema in the JSON schema format,
+// the common types are inlined where they were referenced
+func (schema *Schema) JsonSchema() JsonSchema {
+	output := JsonSchema{}
+	entry := func(namespace string) JsonSchemaEntry {
+		if item, found := output[namespace]; found {
+			return item
+		}
+		item := JsonSchemaEntry{EntityTypes: JsonEntityTypes{}, Actions: JsonActions{}}
+		output[namespace] = item
+		return item
+	}
+
+	for key, def := range schema.EntityTypes {
+		namespace, name := splitName(key)
+
+		item := JsonEntityType{
+			MemberOfTypes: append([]string{}, def.MemberOfTypes...),
+			Shape:         JsonEntityShape{Type: "Record", Required: true},
+		}
+		sort.Strings(item.MemberOfTypes)
+		if def.Shape != nil {
+			item.Shape = def.Shape.jsonShape()
+		}
+		if def.Tags != nil {
+			tags := def.Tags.jsonShape()
+			item.Tags = &tags
+		}
+		entry(namespace).EntityTypes[name] = item
+	}
+
+	for namespace, actions := range schema.Actions {
+		actionType := namespaceName(namespace, "")
+		for key, def := range actions {
+			item := JsonAction{}
+			for _, ref := range def.MemberOf {
+				member := JsonMemberOf{Id: ref.Id, Type: ref.Type}
+				if member.Type == actionType {
+					member.Type = ""
+				}
+				item.MemberOf = append(item.MemberOf, member)
+			}
+			if def.HasPrincipalTypes || def.HasResourceTypes || def.Context != nil {
+				item.AppliesTo = &JsonAppliesTo{}
+				if def.HasPrincipalTypes {
+					item.AppliesTo.PrincipalTypes = sortedKeys(def.PrincipalTypes)
+				}
+				if def.HasResourceTypes {
+					item.AppliesTo.ResourceTypes = sortedKeys(def.ResourceTypes)
+				}
+				if def.Context != nil {
+					context := def.Context.jsonShape()
+					item.AppliesTo.Context = &context
+				}
+			}
+			entry(namespace).Actions[strings.TrimPrefix(key, namespace+"::")] = item
+		}
+	}
+
+	return output
+}
+
+// jsonShape converts the runtime definition back to the JSON definition
+func (shape *EntityShape) jsonShape() JsonEntityShape {
+	output := JsonEntityShape{Type: shape.Type.String(), Required: shape.Required}
+
+	switch shape.Type {
+	case SHAPE_ENTITY, SHAPE_EXTENSION:
+		name := shape.Name
+		output.Name = &name
+	case SHAPE_SET:
+		if shape.Element != nil {
+			elem := shape.Element.jsonShape()
+			output.Element = &elem
+		}
+	case SHAPE_RECORD:
+		output.Attributes = map[string]JsonEntityShape{}
+		for key, value := range shape.Attributes {
+			output.Attributes[key] = value.jsonShape()
+		}
+		// Cedar's default is false, a closed record
+		if shape.AdditionalAttributes {
+			output.AdditionalAttributes = &shape.AdditionalAttributes
+		}
+	}
+
+	return output
+}
+
+// MarshalJSON writes the canonical form of the shape, only the properties
+// of its type are present and required is only written when it is false
+func (es JsonEntityShape) MarshalJSON() ([]byte, error) {
+	type entityShape struct {
+		Type                 string                      `json:"type"`
+		Required             *bool                       `json:"required,omitempty"`
+		Attributes           *map[string]JsonEntityShape `json:"attributes,omitempty"`
+		Name                 *string                     `json:"name,omitempty"`
+		Element              *JsonEntityShape            `json:"element,omitempty"`
+		AdditionalAttributes *bool                       `json:"additionalAttributes,omitempty"`
+	}
+
+	entry := entityShape{
+		Type:                 es.Type,
+		Name:                 es.Name,
+		Element:              es.Element,
+		AdditionalAttributes: es.AdditionalAttributes,
+	}
+	if !es.Required {
+		entry.Required = new(bool)
+	}
+	if es.Type == "Record" || es.Type == "" || len(es.Attributes) != 0 {
+		attributes := es.Attributes
+		if attributes == nil {
+			attributes = map[string]JsonEntityShape{}
+		}
+		entry.Attributes = &attributes
+	}
+
+	return json.Marshal(entry)
+}
+
+func sortedKeys(values map[string]bool) []string {
+	output := make([]string, 0, len(values))
+	for key := range values {
+		output = append(output, key)
+	}
+	sort.Strings(output)
+	return output
+}
+
+//
+//
+
+// FormatText returns the schema in the Cedar human-readable format, the
+// declarations are sorted by name and the common types are inlined
+func FormatText(schema *Schema) string {
+	defs := schema.JsonSchema()
+
+	namespaces := make([]string, 0, len(defs))
+	for namespace := range defs {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	w := textWriter{}
+	for _, namespace := range namespaces {
+		if w.Len() != 0 {
+			w.WriteString("\n")
+		}
+		w.namespace = namespace
+		if namespace != "" {
+			w.WriteString("namespace " + namespace + " {\n")
+			w.depth = 1
+		}
+		w.writeEntry(defs[namespace])
+		if namespace != "" {
+			w.depth = 0
+			w.WriteString("}\n")
+		}
+	}
+
+	return w.String()
+}
+
+// textWriter holds the state for writing a cedarschema document
+type textWriter struct {
+	strings.Builder
+	namespace string
+	depth     int
+}
+
+func (w *textWriter) indent(depth int) {
+	w.WriteString(strings.Repeat("\t", depth))
+}
+
+func (w *textWriter) writeEntry(entry JsonSchemaEntry) {
+	names := make([]string, 0, len(entry.EntityTypes))
+	for name := range entry.EntityTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		def := entry.EntityTypes[name]
+		w.indent(w.depth)
+		w.WriteString("entity " + name)
+		if len(def.MemberOfTypes) != 0 {
+			w.WriteString(" in " + w.typeList(def.MemberOfTypes))
+		}
+		if len(def.Shape.Attributes) != 0 {
+			w.WriteString(" ")
+			w.writeType(def.Shape, w.depth)
+		}
+		if def.Tags != nil {
+			w.WriteString(" tags ")
+			w.writeType(*def.Tags, w.depth)
+		}
+		w.WriteString(";\n")
+	}
+
+	names = names[:0]
+	for name := range entry.Actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		def := entry.Actions[name]
+		w.indent(w.depth)
+		w.WriteString("action " + strconv.Quote(name))
+		if len(def.MemberOf) != 0 {
+			refs := make([]string, 0, len(def.MemberOf))
+			for _, ref := range def.MemberOf {
+				if ref.Type == "" {
+					refs = append(refs, strconv.Quote(ref.Id))
+				} else {
+					refs = append(refs, w.relative(ref.Type)+"::"+strconv.Quote(ref.Id))
+				}
+			}
+			w.WriteString(" in [" + strings.Join(refs, ", ") + "]")
+		}
+		if applies := def.AppliesTo; applies != nil {
+			w.WriteString(" appliesTo {\n")
+			if applies.PrincipalTypes != nil {
+				w.indent(w.depth + 1)
+				w.WriteString("principal: " + w.typeList(applies.PrincipalTypes) + ",\n")
+			}
+			if applies.ResourceTypes != nil {
+				w.indent(w.depth + 1)
+				w.WriteString("resource: " + w.typeList(applies.ResourceTypes) + ",\n")
+			}
+			if applies.Context != nil {
+				w.indent(w.depth + 1)
+				w.WriteString("context: ")
+				w.writeType(*applies.Context, w.depth+1)
+				w.WriteString(",\n")
+			}
+			w.indent(w.depth)
+			w.WriteString("}")
+		}
+		w.WriteString(";\n")
+	}
+}
+
+// relative returns the name as it is written within the current namespace
+func (w *textWriter) relative(name string) string {
+	if namespace, local := splitName(name); namespace != "" && namespace == w.namespace {
+		return local
+	}
+	return name
+}
+
+func (w *textWriter) typeList(names []string) string {
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, w.relative(name))
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func (w *textWriter) writeType(shape JsonEntityShape, depth int) {
+	switch shape.Type {
+	case "String", "Long":
+		w.WriteString(shape.Type)
+	case "Boolean":
+		w.WriteString("Bool")
+	case "Set":
+		w.WriteString("Set<")
+		if shape.Element != nil {
+			w.writeType(*shape.Element, depth)
+		}
+		w.WriteString(">")
+	case "Entity", "Extension", "EntityOrCommon":
+		if shape.Name != nil {
+			w.WriteString(w.relative(*shape.Name))
+		}
+	case "Record", "":
+		if len(shape.Attributes) == 0 {
+			w.WriteString("{}")
+			return
+		}
+
+		keys := make([]string, 0, len(shape.Attributes))
+		for key := range shape.Attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		w.WriteString("{\n")
+		for _, key := range keys {
+			value := shape.Attributes[key]
+			w.indent(depth + 1)
+			if isTextIdent(key) {
+				w.WriteString(key)
+			} else {
+				w.WriteString(strconv.Quote(key))
+			}
+			if !value.Required {
+				w.WriteString("?")
+			}
+			w.WriteString(": ")
+			w.writeType(value, depth+1)
+			w.WriteString(",\n")
+		}
+		w.indent(depth)
+		w.WriteString("}")
+	default:
+		// A common type reference
+		w.WriteString(w.relative(shape.Type))
+	}
+}
+
+// isTextIdent reports whether the attribute name can be written without quotes
+func isTextIdent(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, ch := range name {
+		isAlpha := ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+		if !isAlpha && (i == 0 || ch < '0' || ch > '9') {
+			return false
+		}
+	}
+	return true
+}
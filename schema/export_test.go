@@ -0,0 +1,61 @@
+package schema_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportJson(t *testing.T) {
+	s, err := schema.NewFromText(strings.NewReader(photoTextSchema))
+	require.NoError(t, err)
+
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+
+	// Only the properties of the type are written
+	assert.Contains(t, string(data), `"address":{"type":"Record","attributes":{"street":{"type":"String"},"zip":{"type":"String","required":false}}}`)
+	assert.Contains(t, string(data), `"delete":{"memberOf":[{"id":"view"}]`)
+
+	other, err := schema.NewFromJson(strings.NewReader(string(data)))
+	require.NoError(t, err)
+	assert.Equal(t, s.EntityTypes, other.EntityTypes)
+	assert.Equal(t, s.Actions, other.Actions)
+
+	// A record is closed unless it says otherwise, as in Cedar
+	s, err = schema.NewFromJson(strings.NewReader(`{"": {"entityTypes": {
+		"Open": {"shape": {"type": "Record", "attributes": {}, "additionalAttributes": true}},
+		"Closed": {"shape": {"type": "Record", "attributes": {}}}
+	}, "actions": {}}}`))
+	require.NoError(t, err)
+	data, err = json.Marshal(s)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"Open":{"memberOfTypes":[],"shape":{"type":"Record","attributes":{},"additionalAttributes":true}}`)
+	assert.Contains(t, string(data), `"Closed":{"memberOfTypes":[],"shape":{"type":"Record","attributes":{}}}`)
+}
+
+func TestExportText(t *testing.T) {
+	s, err := schema.NewFromText(strings.NewReader(photoTextSchema + `
+	entity Admin in [PhotoApp::Group] { "full name": String } tags Long;
+	action manage appliesTo { principal: Admin, resource: PhotoApp::Album };
+	`))
+	require.NoError(t, err)
+
+	text := schema.FormatText(s)
+	assert.Contains(t, text, "entity Admin in [PhotoApp::Group] {\n\t\"full name\": String,\n} tags Long;\n")
+	assert.Contains(t, text, "namespace PhotoApp {\n")
+	assert.Contains(t, text, "\tentity User in [Group] {\n")
+	assert.Contains(t, text, "\taction \"delete\" in [\"view\"] appliesTo {\n")
+
+	other, err := schema.NewFromText(strings.NewReader(text))
+	require.NoError(t, err, text)
+	assert.Equal(t, s.EntityTypes, other.EntityTypes)
+	assert.Equal(t, s.Actions, other.Actions)
+
+	// Formatting is stable
+	assert.Equal(t, text, schema.FormatText(other))
+}
@@ -20,7 +20,7 @@ func (p Path) String() string {
 	return strings.Join(p, "::")
 }
 
-func (schema JsonSchema) verifyEntityShape(path Path, value JsonEntityShape, lookup JsonCommonTypes) error {
+func (schema JsonSchema) verifyEntityShape(path Path, value JsonEntityShape, lookup *names, namespace string) error {
 	noAttributes := true
 	noElement := true
 	noName := true
@@ -32,7 +32,7 @@ func (schema JsonSchema) verifyEntityShape(path Path, value JsonEntityShape, loo
 			return fmt.Errorf("%s: element property required: %w", path.String(), ErrInvalidSchema)
 		}
 		noElement = false
-	case "Entity", "Extension":
+	case "Entity", "Extension", "EntityOrCommon":
 		if value.Name == nil || *value.Name == "" {
 			return fmt.Errorf("%s: name property required: %w", path.String(), ErrInvalidSchema)
 		}
@@ -42,11 +42,7 @@ func (schema JsonSchema) verifyEntityShape(path Path, value JsonEntityShape, loo
 		// Attributes can be empty
 		noAttributes = false
 	default:
-		found := false
-		if lookup != nil {
-			_, found = lookup[value.Type]
-		}
-		if !found {
+		if _, found := lookup.commonType(namespace, value.Type); !found {
 			return fmt.Errorf("%s: unknown type name %s: %w", path.String(), value.Type, ErrInvalidSchema)
 		}
 	}
@@ -64,13 +60,18 @@ func (schema JsonSchema) verifyEntityShape(path Path, value JsonEntityShape, loo
 	return nil
 }
 
-func (schema JsonSchema) verifyEntityType(path Path, value JsonEntityType, lookup JsonCommonTypes, etypes JsonEntityTypes) error {
-	if err := schema.verifyEntityShape(path, value.Shape, lookup); err != nil {
+func (schema JsonSchema) verifyEntityType(path Path, value JsonEntityType, lookup *names, namespace string) error {
+	if err := schema.verifyEntityShape(path, value.Shape, lookup, namespace); err != nil {
 		return err
 	}
+	if value.Tags != nil {
+		if err := schema.verifyEntityShape(append(path, "tags"), *value.Tags, lookup, namespace); err != nil {
+			return err
+		}
+	}
 
 	for _, value := range value.MemberOfTypes {
-		if _, found := etypes[value]; !found {
+		if !lookup.entities[lookup.entity(namespace, value)] {
 			return fmt.Errorf("%s: memberOf property non-existent: %s: %w", path.String(), value, ErrInvalidSchema)
 		}
 	}
@@ -78,9 +79,9 @@ func (schema JsonSchema) verifyEntityType(path Path, value JsonEntityType, looku
 	return nil
 }
 
-func (schema JsonSchema) verifyAction(path []string, value JsonAction, lookup JsonCommonTypes) error {
+func (schema JsonSchema) verifyAction(path []string, value JsonAction, lookup *names, namespace string) error {
 	if value.AppliesTo != nil && value.AppliesTo.Context != nil {
-		if err := schema.verifyEntityShape(append(path, "context"), *value.AppliesTo.Context, lookup); err != nil {
+		if err := schema.verifyEntityShape(append(path, "context"), *value.AppliesTo.Context, lookup, namespace); err != nil {
 			return err
 		}
 	}
@@ -98,7 +99,9 @@ func hasWhiteSpace(str string) bool {
 	return false
 }
 
-func (schema JsonSchema) verifyNamespace(path Path, value JsonSchemaEntry) error {
+func (schema JsonSchema) verifyNamespace(path Path, value JsonSchemaEntry, lookup *names) error {
+	namespace := path[0]
+
 	// if len(value.EntityTypes) == 0 {
 	// 	return fmt.Errorf("%s: no entityTypes defined: %w", path.String(), ErrInvalidSchema)
 	// }
@@ -111,7 +114,7 @@ func (schema JsonSchema) verifyNamespace(path Path, value JsonSchemaEntry) error
 		if hasWhiteSpace(name) {
 			return fmt.Errorf("%s: whitespace in commonTypes name: %w", path.String(), ErrInvalidSchema)
 		}
-		err := schema.verifyEntityShape(path, entity, nil)
+		err := schema.verifyEntityShape(path, entity, lookup, namespace)
 		if err != nil {
 			return err
 		}
@@ -121,7 +124,7 @@ func (schema JsonSchema) verifyNamespace(path Path, value JsonSchemaEntry) error
 		if hasWhiteSpace(name) {
 			return fmt.Errorf("%s: whitespace in entityTypes name: %w", path.String(), ErrInvalidSchema)
 		}
-		err := schema.verifyEntityType(path, entity, value.CommonTypes, value.EntityTypes)
+		err := schema.verifyEntityType(path, entity, lookup, namespace)
 		if err != nil {
 			return err
 		}
@@ -129,7 +132,7 @@ func (schema JsonSchema) verifyNamespace(path Path, value JsonSchemaEntry) error
 	for name, action := range value.Actions {
 		path := append(path, "actions", name)
 		//  action names can have whitespace
-		err := schema.verifyAction(append(path, "actions", name), action, value.CommonTypes)
+		err := schema.verifyAction(append(path, "actions", name), action, lookup, namespace)
 		if err != nil {
 			return err
 		}
@@ -139,12 +142,12 @@ func (schema JsonSchema) verifyNamespace(path Path, value JsonSchemaEntry) error
 }
 
 func (schema *JsonSchema) VerifyConsistency() error {
-	// Verify the common types first
+	lookup := newNames(*schema)
 	for namespace, value := range *schema {
 		if hasWhiteSpace(namespace) {
 			return fmt.Errorf("%s: whitespace in namespace: %w", namespace, ErrInvalidSchema)
 		}
-		if err := schema.verifyNamespace(Path{namespace}, value); err != nil {
+		if err := schema.verifyNamespace(Path{namespace}, value, lookup); err != nil {
 			return err
 		}
 	}
@@ -155,8 +158,6 @@ func NewEmptySchema() *Schema {
 	return &Schema{}
 }
 
-type commonDefs map[string]*EntityShape
-
 func namespaceName(namespace string, name string) string {
 	if namespace == "" {
 		return name
@@ -167,28 +168,37 @@ func namespaceName(namespace string, name string) string {
 	return namespace + "::" + name
 }
 
-func namespaceTypes(namespace string, names []string) []string {
+// entityTypes resolves the entity type names of the declaration
+func (r *resolver) entityTypes(namespace string, names []string) []string {
 	if names == nil {
 		return nil
 	}
-	output := []string{}
-	if namespace == "" {
-		return names
-	}
+	output := make([]string, 0, len(names))
 	for _, item := range names {
-		if strings.Contains(item, "::") {
-			output = append(output, item)
-		} else {
-			output = append(output, namespace+"::"+item)
-		}
+		output = append(output, r.entity(namespace, item))
 	}
 	return output
 }
 
 // processEntityShape converts the Json definition to a runtime definition, this will also complete
 // all lookups of the type names to flatten out the schema
-func processEntityShape(ekey string, namespace string, input JsonEntityShape, common commonDefs) (*EntityShape, error) {
-	shape := EntityShape{}
+func processEntityShape(ekey string, namespace string, input JsonEntityShape, r *resolver) (*EntityShape, error) {
+	shape, err := processShape(ekey, namespace, input, r)
+	if err != nil {
+		return nil, err
+	}
+	if shape.Required != input.Required {
+		// The shapes of common types are shared, whether the attribute is
+		// required is up to each reference
+		output := *shape
+		output.Required = input.Required
+		shape = &output
+	}
+	return shape, nil
+}
+
+func processShape(ekey string, namespace string, input JsonEntityShape, r *resolver) (*EntityShape, error) {
+	shape := EntityShape{Required: input.Required}
 
 	switch input.Type {
 	case "String":
@@ -200,22 +210,40 @@ func processEntityShape(ekey string, namespace string, input JsonEntityShape, co
 		// Do nothing
 	case "Set":
 		shape.Type = SHAPE_SET
-		elem, err := processEntityShape(ekey, namespace, *input.Element, common)
+		elem, err := processEntityShape(ekey, namespace, *input.Element, r)
 		if err != nil {
 			return nil, err
 		}
 		shape.Element = elem
 	case "Entity":
 		shape.Type = SHAPE_ENTITY
-		shape.Name = namespaceName(namespace, *input.Name)
+		shape.Name = r.entity(namespace, *input.Name)
 	case "Extension":
 		shape.Type = SHAPE_EXTENSION
 		shape.Name = *input.Name
+	case "EntityOrCommon":
+		// A common type takes precedence over the built in types, which in
+		// turn take precedence over entity types
+		name := *input.Name
+		if key, found := r.commonType(namespace, name); found {
+			return r.common(ekey, key)
+		}
+		name = strings.TrimPrefix(name, "__cedar::")
+		if prim, found := primitiveTypes[name]; found {
+			return processEntityShape(ekey, namespace, JsonEntityShape{Type: prim}, r)
+		} else if extensionTypes[name] {
+			shape.Type = SHAPE_EXTENSION
+			shape.Name = name
+		} else {
+			shape.Type = SHAPE_ENTITY
+			shape.Name = r.entity(namespace, *input.Name)
+		}
 	case "Record":
 		shape.Type = SHAPE_RECORD
+		shape.AdditionalAttributes = input.AdditionalAttributes != nil && *input.AdditionalAttributes
 		shape.Attributes = map[string]*EntityShape{}
 		for key, value := range input.Attributes {
-			elem, err := processEntityShape(ekey, namespace, value, common)
+			elem, err := processEntityShape(ekey, namespace, value, r)
 			if err != nil {
 				return nil, err
 			}
@@ -224,34 +252,43 @@ func processEntityShape(ekey string, namespace string, input JsonEntityShape, co
 	default:
 		if input.Type == "" {
 			shape.Type = SHAPE_RECORD
+			shape.AdditionalAttributes = input.AdditionalAttributes != nil && *input.AdditionalAttributes
 			shape.Attributes = map[string]*EntityShape{}
 		} else {
-			lookup, found := common[input.Type]
+			key, found := r.commonType(namespace, input.Type)
 			if !found {
 				return nil, fmt.Errorf("%s: unknown type name %s: %w", ekey, input.Type, ErrInvalidSchema)
 			}
-			return lookup, nil
+			return r.common(ekey, key)
 		}
 	}
 
 	return &shape, nil
 }
 
-func processEntityType(ekey string, namespace string, input JsonEntityType, common commonDefs) (*EntityType, error) {
+func processEntityType(ekey string, namespace string, input JsonEntityType, r *resolver) (*EntityType, error) {
 	output := EntityType{
-		MemberOfTypes: namespaceTypes(namespace, input.MemberOfTypes),
+		MemberOfTypes: r.entityTypes(namespace, input.MemberOfTypes),
 	}
 
-	shape, err := processEntityShape(ekey, namespace, input.Shape, common)
+	shape, err := processEntityShape(ekey, namespace, input.Shape, r)
 	if err != nil {
 		return nil, err
 	}
 	output.Shape = shape
 
+	if input.Tags != nil {
+		tags, err := processEntityShape(ekey, namespace, *input.Tags, r)
+		if err != nil {
+			return nil, err
+		}
+		output.Tags = tags
+	}
+
 	return &output, nil
 }
 
-func processAction(ekey string, namespace string, input JsonAction, common commonDefs) (*Action, error) {
+func processAction(ekey string, namespace string, input JsonAction, r *resolver) (*Action, error) {
 	output := Action{}
 
 	for _, item := range input.MemberOf {
@@ -265,19 +302,19 @@ func processAction(ekey string, namespace string, input JsonAction, common commo
 			output.HasPrincipalTypes = True
 			output.PrincipalTypes = map[string]bool{}
 			for _, item := range input.AppliesTo.PrincipalTypes {
-				output.PrincipalTypes[namespaceName(namespace, item)] = true
+				output.PrincipalTypes[r.entity(namespace, item)] = true
 			}
 		}
 		if input.AppliesTo.ResourceTypes != nil {
 			output.HasResourceTypes = True
 			output.ResourceTypes = map[string]bool{}
 			for _, item := range input.AppliesTo.ResourceTypes {
-				output.ResourceTypes[namespaceName(namespace, item)] = true
+				output.ResourceTypes[r.entity(namespace, item)] = true
 			}
 		}
 
 		if input.AppliesTo.Context != nil {
-			shape, err := processEntityShape(ekey, namespace, *input.AppliesTo.Context, common)
+			shape, err := processEntityShape(ekey, namespace, *input.AppliesTo.Context, r)
 			if err != nil {
 				return nil, err
 			}
@@ -288,31 +325,12 @@ func processAction(ekey string, namespace string, input JsonAction, common commo
 	return &output, nil
 }
 
-func processCommonDefs(ekey string, namespace string, common JsonCommonTypes) (commonDefs, error) {
-	defs := commonDefs{}
-
-	if len(common) == 0 {
-		return defs, nil
-	}
-
-	// TODO - unclear from specification if there may be dependencies
-	// within a type.
-	for key, entry := range common {
-		shape, err := processEntityShape(ekey, namespace, entry, defs)
-		if err != nil {
-			return nil, err
-		}
-		defs[key] = shape
-	}
-
-	return defs, nil
-}
-
 func processSchema(input *JsonSchema) (*Schema, error) {
 	output := Schema{
 		EntityTypes: map[string]*EntityType{},
 		Actions:     map[string]map[string]*Action{},
 	}
+	r := newResolver(*input)
 
 	for ns, item := range *input {
 		prefix := ""
@@ -320,13 +338,16 @@ func processSchema(input *JsonSchema) (*Schema, error) {
 			prefix = ns + "::"
 		}
 
-		common, err := processCommonDefs(ns+"::commonTypes", ns, item.CommonTypes)
-		if err != nil {
-			return nil, err
+		// The common types are converted as they are referenced, this
+		// reports the errors of those which aren't
+		for key := range item.CommonTypes {
+			if _, err := r.common(ns+"::commonTypes", prefix+key); err != nil {
+				return nil, err
+			}
 		}
 
 		for key, value := range item.EntityTypes {
-			entity, err := processEntityType(ns+"::entityTypes", ns, value, common)
+			entity, err := processEntityType(ns+"::entityTypes", ns, value, r)
 			if err != nil {
 				return nil, err
 			}
@@ -336,7 +357,7 @@ func processSchema(input *JsonSchema) (*Schema, error) {
 
 		acts := map[string]*Action{}
 		for key, value := range item.Actions {
-			action, err := processAction(ns+"::actions", ns, value, common)
+			action, err := processAction(ns+"::actions", ns, value, r)
 			if err != nil {
 				return nil, err
 			}
@@ -375,14 +396,11 @@ func NewFromJson(reader io.Reader) (*Schema, error) {
 }
 
 func (schema *Schema) FindDef(entity engine.EntityValue) (*EntityShape, error) {
-	length := len(entity)
-	if length < 2 {
+	if entity.IsZero() {
 		return nil, fmt.Errorf("%s: %w", entity.String(), ErrInvalidEntityFormat)
 	}
 
-	path := entity[0 : length-1]
-
-	def, ok := schema.EntityTypes[strings.Join(path, "::")]
+	def, ok := schema.EntityTypes[entity.EntityType()]
 	if !ok {
 		return nil, nil
 	}
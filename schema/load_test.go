@@ -6,6 +6,7 @@ import (
 
 	"github.com/koblas/cedar-go/schema"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBasic(t *testing.T) {
@@ -92,3 +93,93 @@ func TestBasicError(t *testing.T) {
 
 	assert.Error(t, err)
 }
+
+func TestNamespaceResolution(t *testing.T) {
+	s, err := schema.NewFromJson(strings.NewReader(`{
+		"": {
+			"commonTypes": { "Shared": { "type": "Record", "attributes": { "id": { "type": "String" } } } },
+			"entityTypes": { "Base": {} },
+			"actions": {}
+		},
+		"Other": {
+			"commonTypes": { "Address": { "type": "Record", "attributes": { "zip": { "type": "String" } } } },
+			"entityTypes": { "Org": {} },
+			"actions": {}
+		},
+		"App": {
+			"commonTypes": {
+				"Level": { "type": "Rank" },
+				"Rank": { "type": "Long" }
+			},
+			"entityTypes": {
+				"User": {
+					"memberOfTypes": ["Base", "Other::Org", "Team"],
+					"shape": { "type": "Record", "attributes": {
+						"home": { "type": "Other::Address" },
+						"shared": { "type": "Shared" },
+						"level": { "type": "Level" },
+						"base": { "type": "Entity", "name": "Base" },
+						"manager": { "type": "Entity", "name": "User" },
+						"office": { "type": "EntityOrCommon", "name": "Other::Address" },
+						"org": { "type": "EntityOrCommon", "name": "Other::Org" },
+						"count": { "type": "EntityOrCommon", "name": "Long" },
+						"ip": { "type": "EntityOrCommon", "name": "ipaddr" }
+					} }
+				},
+				"Team": {}
+			},
+			"actions": {}
+		}
+	}`))
+	require.NoError(t, err)
+
+	user := s.EntityTypes["App::User"]
+	require.NotNil(t, user)
+	assert.Equal(t, []string{"Base", "Other::Org", "App::Team"}, user.MemberOfTypes)
+
+	attrs := user.Shape.Attributes
+	assert.Equal(t, schema.SHAPE_STRING, attrs["home"].Attributes["zip"].Type)
+	assert.Equal(t, schema.SHAPE_STRING, attrs["shared"].Attributes["id"].Type)
+	assert.Equal(t, schema.SHAPE_LONG, attrs["level"].Type)
+	assert.Equal(t, "Base", attrs["base"].Name)
+	assert.Equal(t, "App::User", attrs["manager"].Name)
+	assert.Equal(t, schema.SHAPE_RECORD, attrs["office"].Type)
+	assert.Equal(t, schema.SHAPE_ENTITY, attrs["org"].Type)
+	assert.Equal(t, "Other::Org", attrs["org"].Name)
+	assert.Equal(t, schema.SHAPE_LONG, attrs["count"].Type)
+	assert.Equal(t, schema.SHAPE_EXTENSION, attrs["ip"].Type)
+
+	errors := []string{
+		// the common type is declared in another namespace
+		`{ "App": { "entityTypes": { "User": { "shape": { "type": "Record", "attributes": { "a": { "type": "Address" } } } } }, "actions": {} },
+		   "Other": { "commonTypes": { "Address": { "type": "String" } }, "entityTypes": {}, "actions": {} } }`,
+		`{ "App": { "entityTypes": { "User": { "memberOfTypes": ["Other::Group"] } }, "actions": {} } }`,
+		`{ "App": { "commonTypes": { "A": { "type": "B" }, "B": { "type": "Set", "element": { "type": "A" } } }, "entityTypes": {}, "actions": {} } }`,
+	}
+	for _, item := range errors {
+		_, err := schema.NewFromJson(strings.NewReader(item))
+		assert.ErrorIs(t, err, schema.ErrInvalidSchema, item)
+	}
+}
+
+func TestTextNamespaceResolution(t *testing.T) {
+	s, err := schema.NewFromText(strings.NewReader(`
+		type Shared = { id: String };
+		entity Base;
+		namespace App {
+			entity User in [Base, Other::Org] { home: Other::Address, shared: Shared, org: Other::Org };
+		}
+		namespace Other {
+			type Address = { zip: String };
+			entity Org;
+		}
+	`))
+	require.NoError(t, err)
+
+	user := s.EntityTypes["App::User"]
+	require.NotNil(t, user)
+	assert.Equal(t, []string{"Base", "Other::Org"}, user.MemberOfTypes)
+	assert.Equal(t, schema.SHAPE_RECORD, user.Shape.Attributes["home"].Type)
+	assert.Equal(t, schema.SHAPE_STRING, user.Shape.Attributes["shared"].Attributes["id"].Type)
+	assert.Equal(t, "Other::Org", user.Shape.Attributes["org"].Name)
+}
@@ -0,0 +1,44 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Merge composes the schema fragments into a single schema. A declaration
+// may be repeated by both as long as it is the same, an entity type or
+// action defined differently is an ErrSchemaConflict. The declarations are
+// shared with the fragments rather than copied.
+func Merge(a, b *Schema) (*Schema, error) {
+	output := Schema{
+		EntityTypes: map[string]*EntityType{},
+		Actions:     map[string]map[string]*Action{},
+	}
+
+	for _, item := range []*Schema{a, b} {
+		if item == nil {
+			continue
+		}
+		for name, def := range item.EntityTypes {
+			if prev, found := output.EntityTypes[name]; found && !reflect.DeepEqual(prev, def) {
+				return nil, fmt.Errorf("entity type %s: %w", name, ErrSchemaConflict)
+			}
+			output.EntityTypes[name] = def
+		}
+		for ns, actions := range item.Actions {
+			merged := output.Actions[ns]
+			if merged == nil {
+				merged = map[string]*Action{}
+				output.Actions[ns] = merged
+			}
+			for name, def := range actions {
+				if prev, found := merged[name]; found && !reflect.DeepEqual(prev, def) {
+					return nil, fmt.Errorf("action %s: %w", name, ErrSchemaConflict)
+				}
+				merged[name] = def
+			}
+		}
+	}
+
+	return &output, nil
+}
@@ -0,0 +1,45 @@
+package schema_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	users, err := schema.NewFromText(strings.NewReader(`
+	namespace App {
+		entity User { name: String };
+		action "login" appliesTo { principal: User, resource: User };
+	}
+	`))
+	require.NoError(t, err)
+	photos, err := schema.NewFromText(strings.NewReader(`
+	namespace App {
+		entity User { name: String };
+		entity Photo { owner: User };
+		action "view" appliesTo { principal: User, resource: Photo };
+	}
+	`))
+	require.NoError(t, err)
+
+	merged, err := schema.Merge(users, photos)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"App::Photo", "App::User"}, merged.EntityTypeNames())
+	assert.NotNil(t, merged.LookupAction(engine.NewEntityValue("App::Action", "login")))
+	assert.NotNil(t, merged.LookupAction(engine.NewEntityValue("App::Action", "view")))
+
+	conflict, err := schema.NewFromText(strings.NewReader(`
+	namespace App {
+		entity User { name: Long };
+	}
+	`))
+	require.NoError(t, err)
+	_, err = schema.Merge(merged, conflict)
+	assert.ErrorIs(t, err, schema.ErrSchemaConflict)
+	assert.ErrorContains(t, err, "App::User")
+}
@@ -0,0 +1,239 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/koblas/cedar-go/engine"
+)
+
+// MutableEntityStore is an entity store which can be updated while it's in
+// use, for example to follow the change events of a database. It is safe for
+// concurrent use and reports each update to its subscribers.
+type MutableEntityStore struct {
+	mu    sync.RWMutex
+	items EntityStore
+	// ancestors caches the transitive closure of the parents by entity
+	ancestors map[string][]engine.EntityValue
+
+	subsMu sync.Mutex
+	nextId int
+	subs   map[int]func([]engine.EntityValue)
+}
+
+var _ engine.Store = (*MutableEntityStore)(nil)
+var _ engine.TagStore = (*MutableEntityStore)(nil)
+var _ engine.StoreNotifier = (*MutableEntityStore)(nil)
+
+// NewMutableEntityStore creates a store holding a copy of the entities
+func NewMutableEntityStore(initial EntityStore) *MutableEntityStore {
+	items := make(EntityStore, len(initial))
+	for key, item := range initial {
+		items[key] = item
+	}
+	return &MutableEntityStore{
+		items:     items,
+		ancestors: map[string][]engine.EntityValue{},
+		subs:      map[int]func([]engine.EntityValue){},
+	}
+}
+
+func (store *MutableEntityStore) Get(key engine.EntityValue, str string) (engine.EvalValue, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return store.items.Get(key, str)
+}
+
+func (store *MutableEntityStore) GetTag(key engine.EntityValue, tag string) (engine.EvalValue, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return store.items.GetTag(key, tag)
+}
+
+func (store *MutableEntityStore) GetParents(key engine.EntityValue) ([]engine.EntityValue, error) {
+	lookup := key.String()
+
+	store.mu.RLock()
+	cached, found := store.ancestors[lookup]
+	store.mu.RUnlock()
+	if found {
+		return cached, nil
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	parents, err := store.items.GetParents(key)
+	if err != nil {
+		return nil, err
+	}
+	store.ancestors[lookup] = parents
+
+	return parents, nil
+}
+
+// AddEntity inserts the entity, replacing any entity with the same uid
+func (store *MutableEntityStore) AddEntity(item EntityStoreItem) error {
+	err := store.update(true, func() error {
+		return store.items.Add(item)
+	})
+	if err != nil {
+		return err
+	}
+	store.publish(item.entity)
+	return nil
+}
+
+// RemoveEntity deletes the entity, entities which have it as a parent keep
+// the reference but no longer inherit its ancestors.
+func (store *MutableEntityStore) RemoveEntity(uid engine.EntityValue) error {
+	err := store.update(true, func() error {
+		key := uid.String()
+		if _, found := store.items[key]; !found {
+			return fmt.Errorf("%s: %w", key, ErrNotFoundInStore)
+		}
+		delete(store.items, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	store.publish(uid)
+	return nil
+}
+
+// SetAttribute sets an attribute of the entity, a nil value removes it
+func (store *MutableEntityStore) SetAttribute(uid engine.EntityValue, name string, value engine.NamedType) error {
+	err := store.modify(uid, false, func(item *EntityStoreItem) {
+		values := item.values
+		if values == nil {
+			values = engine.NewVarValue(map[string]engine.NamedType{})
+		}
+		item.values = values.With(name, value)
+	})
+	if err != nil {
+		return err
+	}
+	store.publish(uid)
+	return nil
+}
+
+// SetTag sets a tag of the entity, a nil value removes it
+func (store *MutableEntityStore) SetTag(uid engine.EntityValue, name string, value engine.NamedType) error {
+	err := store.modify(uid, false, func(item *EntityStoreItem) {
+		tags := item.tags
+		if tags == nil {
+			tags = engine.NewVarValue(map[string]engine.NamedType{})
+		}
+		item.tags = tags.With(name, value)
+	})
+	if err != nil {
+		return err
+	}
+	store.publish(uid)
+	return nil
+}
+
+// AddParent makes parent a direct parent of the entity
+func (store *MutableEntityStore) AddParent(uid, parent engine.EntityValue) error {
+	err := store.modify(uid, true, func(item *EntityStoreItem) {
+		// The parents are kept sorted, as by EntityStore.Add
+		key := parent.String()
+		idx := sort.Search(len(item.parents), func(i int) bool { return item.parents[i].String() >= key })
+		if idx < len(item.parents) && item.parents[idx].String() == key {
+			return
+		}
+		parents := make([]engine.EntityValue, 0, len(item.parents)+1)
+		parents = append(append(parents, item.parents[:idx]...), parent)
+		item.parents = append(parents, item.parents[idx:]...)
+	})
+	if err != nil {
+		return err
+	}
+	store.publish(uid)
+	return nil
+}
+
+// RemoveParent removes parent from the direct parents of the entity
+func (store *MutableEntityStore) RemoveParent(uid, parent engine.EntityValue) error {
+	err := store.modify(uid, true, func(item *EntityStoreItem) {
+		parents := make([]engine.EntityValue, 0, len(item.parents))
+		for _, existing := range item.parents {
+			if existing.String() != parent.String() {
+				parents = append(parents, existing)
+			}
+		}
+		item.parents = parents
+	})
+	if err != nil {
+		return err
+	}
+	store.publish(uid)
+	return nil
+}
+
+// Subscribe registers fn to be called after each update with the entity that
+// changed, the returned function cancels the subscription.
+func (store *MutableEntityStore) Subscribe(fn func(changed []engine.EntityValue)) func() {
+	store.subsMu.Lock()
+	defer store.subsMu.Unlock()
+
+	id := store.nextId
+	store.nextId += 1
+	store.subs[id] = fn
+
+	return func() {
+		store.subsMu.Lock()
+		defer store.subsMu.Unlock()
+
+		delete(store.subs, id)
+	}
+}
+
+// modify applies fn to a copy of the entity, the items are never changed in
+// place as readers may be holding them.
+func (store *MutableEntityStore) modify(uid engine.EntityValue, hierarchy bool, fn func(item *EntityStoreItem)) error {
+	return store.update(hierarchy, func() error {
+		key := uid.String()
+		item, found := store.items[key]
+		if !found {
+			return fmt.Errorf("%s: %w", key, ErrNotFoundInStore)
+		}
+		fn(&item)
+		store.items[key] = item
+		return nil
+	})
+}
+
+// update runs fn holding the write lock. A change to the hierarchy can alter
+// the ancestors of every descendant of the entity so the whole cache is
+// dropped.
+func (store *MutableEntityStore) update(hierarchy bool, fn func() error) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if err := fn(); err != nil {
+		return err
+	}
+	if hierarchy && len(store.ancestors) != 0 {
+		store.ancestors = map[string][]engine.EntityValue{}
+	}
+	return nil
+}
+
+func (store *MutableEntityStore) publish(uid engine.EntityValue) {
+	store.subsMu.Lock()
+	subs := make([]func([]engine.EntityValue), 0, len(store.subs))
+	for _, fn := range store.subs {
+		subs = append(subs, fn)
+	}
+	store.subsMu.Unlock()
+
+	changed := []engine.EntityValue{uid}
+	for _, fn := range subs {
+		fn(changed)
+	}
+}
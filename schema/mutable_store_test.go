@@ -0,0 +1,124 @@
+package schema_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMutableEntityStore(t *testing.T) {
+	alice := engine.NewEntityValue("User", "alice")
+	staff := engine.NewEntityValue("Group", "staff")
+	everyone := engine.NewEntityValue("Group", "everyone")
+
+	store := schema.NewMutableEntityStore(nil)
+	changed := []engine.EntityValue{}
+	cancel := store.Subscribe(func(entities []engine.EntityValue) {
+		changed = append(changed, entities...)
+	})
+
+	require.NoError(t, store.AddEntity(schema.NewEntityStoreItem(alice, []engine.EntityValue{staff}, nil)))
+	require.NoError(t, store.AddEntity(schema.NewEntityStoreItem(staff, nil, nil)))
+
+	parents, err := store.GetParents(alice)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []engine.EntityValue{staff}, parents)
+
+	// the cached ancestors of alice follow a change to her parent
+	require.NoError(t, store.AddParent(staff, everyone))
+	parents, err = store.GetParents(alice)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []engine.EntityValue{staff, everyone}, parents)
+
+	require.NoError(t, store.RemoveParent(alice, staff))
+	parents, err = store.GetParents(alice)
+	require.NoError(t, err)
+	assert.Empty(t, parents)
+
+	_, err = store.Get(alice, "age")
+	assert.ErrorIs(t, err, engine.ErrValueNotFound)
+	require.NoError(t, store.SetAttribute(alice, "age", engine.IntValue(42)))
+	value, err := store.Get(alice, "age")
+	require.NoError(t, err)
+	assert.Equal(t, engine.IntValue(42), value)
+	require.NoError(t, store.SetAttribute(alice, "age", nil))
+	_, err = store.Get(alice, "age")
+	assert.Error(t, err)
+
+	require.NoError(t, store.SetTag(alice, "dept", engine.StrValue("eng")))
+	value, err = store.GetTag(alice, "dept")
+	require.NoError(t, err)
+	assert.Equal(t, engine.StrValue("eng"), value)
+	require.NoError(t, store.SetTag(alice, "dept", nil))
+	_, err = store.GetTag(alice, "dept")
+	assert.ErrorIs(t, err, engine.ErrValueNotFound)
+
+	require.NoError(t, store.RemoveEntity(alice))
+	_, err = store.Get(alice, "age")
+	assert.ErrorIs(t, err, engine.ErrValueNotFound)
+
+	assert.ErrorIs(t, store.RemoveEntity(alice), schema.ErrNotFoundInStore)
+	assert.ErrorIs(t, store.SetAttribute(alice, "age", engine.IntValue(1)), schema.ErrNotFoundInStore)
+	assert.ErrorIs(t, store.AddParent(alice, staff), schema.ErrNotFoundInStore)
+
+	assert.Equal(t, []engine.EntityValue{alice, staff, staff, alice, alice, alice, alice, alice, alice}, changed)
+	cancel()
+	require.NoError(t, store.AddEntity(schema.NewEntityStoreItem(alice, nil, nil)))
+	assert.Len(t, changed, 9)
+}
+
+func TestMutableEntityStoreAddParentOrder(t *testing.T) {
+	alice := engine.NewEntityValue("User", "alice")
+	admins := engine.NewEntityValue("Group", "admins")
+	everyone := engine.NewEntityValue("Group", "everyone")
+	staff := engine.NewEntityValue("Group", "staff")
+
+	store := schema.NewMutableEntityStore(nil)
+	require.NoError(t, store.AddEntity(schema.NewEntityStoreItem(alice, []engine.EntityValue{staff}, nil)))
+
+	// the parents are in uid order whatever the order they're added in, as
+	// for an entity added with them
+	require.NoError(t, store.AddParent(alice, everyone))
+	require.NoError(t, store.AddParent(alice, admins))
+	require.NoError(t, store.AddParent(alice, everyone))
+	parents, err := store.GetParents(alice)
+	require.NoError(t, err)
+	assert.Equal(t, []engine.EntityValue{admins, everyone, staff}, parents)
+}
+
+func TestMutableEntityStoreConcurrent(t *testing.T) {
+	alice := engine.NewEntityValue("User", "alice")
+	store := schema.NewMutableEntityStore(schema.EntityStore{})
+	require.NoError(t, store.AddEntity(schema.NewEntityStoreItem(alice, nil, nil)))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		i := i
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				group := engine.NewEntityValue("Group", string(rune('a'+i)))
+				assert.NoError(t, store.AddParent(alice, group))
+				assert.NoError(t, store.SetAttribute(alice, "count", engine.IntValue(j)))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := store.GetParents(alice)
+				assert.NoError(t, err)
+				_, _ = store.Get(alice, "count")
+			}
+		}()
+	}
+	wg.Wait()
+
+	parents, err := store.GetParents(alice)
+	require.NoError(t, err)
+	assert.Len(t, parents, 4)
+}
@@ -0,0 +1,115 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// names resolves the type names used by the declarations of a schema. A
+// qualified name such as `Other::User` refers to the declaration of that
+// namespace, while an unqualified name is looked for in the namespace of the
+// declaration using it and then in the empty namespace.
+type names struct {
+	entities map[string]bool
+	common   map[string]JsonEntityShape
+}
+
+func newNames(schema JsonSchema) *names {
+	output := names{
+		entities: map[string]bool{},
+		common:   map[string]JsonEntityShape{},
+	}
+	for ns, entry := range schema {
+		for name := range entry.EntityTypes {
+			output.entities[qualifiedName(ns, name)] = true
+		}
+		for name, shape := range entry.CommonTypes {
+			output.common[qualifiedName(ns, name)] = shape
+		}
+	}
+	return &output
+}
+
+// qualifiedName is the name of the declaration within the namespace
+func qualifiedName(namespace string, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "::" + name
+}
+
+// splitName returns the namespace and the name of a qualified name
+func splitName(name string) (string, string) {
+	if idx := strings.LastIndex(name, "::"); idx >= 0 {
+		return name[:idx], name[idx+2:]
+	}
+	return "", name
+}
+
+// resolveName returns the qualified name of the declaration the name refers
+// to, found is false if there isn't one
+func resolveName[T any](decls map[string]T, namespace string, name string) (string, bool) {
+	if strings.Contains(name, "::") {
+		_, found := decls[name]
+		return name, found
+	}
+	if namespace != "" {
+		if _, found := decls[namespace+"::"+name]; found {
+			return namespace + "::" + name, true
+		}
+	}
+	_, found := decls[name]
+	return name, found
+}
+
+// entity returns the entity type the name refers to, a name which isn't
+// declared is taken to be of the namespace of the declaration
+func (n *names) entity(namespace string, name string) string {
+	if key, found := resolveName(n.entities, namespace, name); found {
+		return key
+	}
+	return namespaceName(namespace, name)
+}
+
+// commonType returns the qualified name of the common type the name refers to
+func (n *names) commonType(namespace string, name string) (string, bool) {
+	return resolveName(n.common, namespace, name)
+}
+
+// resolver converts the common types as they are referenced, so a common
+// type may use another whatever the order of their declaration
+type resolver struct {
+	*names
+	shapes map[string]*EntityShape
+	active map[string]bool
+}
+
+func newResolver(schema JsonSchema) *resolver {
+	return &resolver{
+		names:  newNames(schema),
+		shapes: map[string]*EntityShape{},
+		active: map[string]bool{},
+	}
+}
+
+// common returns the converted shape of the common type
+func (r *resolver) common(ekey string, key string) (*EntityShape, error) {
+	if shape, found := r.shapes[key]; found {
+		return shape, nil
+	}
+	if r.active[key] {
+		return nil, fmt.Errorf("%s: common type %s refers to itself: %w", ekey, key, ErrInvalidSchema)
+	}
+
+	r.active[key] = true
+	defer delete(r.active, key)
+
+	namespace, _ := splitName(key)
+	shape, err := processEntityShape(ekey, namespace, r.names.common[key], r)
+	if err != nil {
+		return nil, err
+	}
+	r.shapes[key] = shape
+
+	return shape, nil
+}
@@ -1,12 +1,21 @@
 package schema
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"net"
 	"reflect"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 	"unicode"
 
 	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/scanner"
 )
 
 func unwrapInterface(v reflect.Value) reflect.Value {
@@ -51,7 +60,14 @@ func specialExtension(path string, name string, v reflect.Value) (engine.NamedTy
 
 		if name != "" {
 			if val, found := byKey["__extn"]; found {
-				return specialExtension(path, "", val)
+				if err := specialKeys(path, len(byKey)); err != nil {
+					return nil, err
+				}
+				ext, err := specialExtension(path, "", val)
+				if err != nil {
+					return nil, err
+				}
+				return checkExtension(path, name, ext)
 			}
 		}
 
@@ -77,19 +93,53 @@ func specialExtension(path string, name string, v reflect.Value) (engine.NamedTy
 		value = arg.String()
 	}
 
+	var ext engine.NamedType
+	var err error
 	switch fn {
 	case "ip", "ipaddr":
-		return engine.NewIpValue(value)
+		ext, err = engine.NewIpValue(value)
 	case "decimal":
-		return engine.NewDecimalValue(value)
+		ext, err = engine.NewDecimalValue(value)
+	default:
+		return nil, fmt.Errorf("unknown extension type %s: %w", fn, ErrInvalidEntityFormat)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return checkExtension(path, name, ext)
+}
+
+// checkExtension checks the extension value is of the type the schema
+// expects, when there is one
+func checkExtension(path string, name string, ext engine.NamedType) (engine.NamedType, error) {
+	if name != "" && ext.TypeName() != name {
+		return nil, &NormalizeError{Path: path, Expected: name, Got: ext.TypeName()}
 	}
-	return nil, fmt.Errorf("unknown extension type %s: %w", fn, ErrInvalidEntityFormat)
+	return ext, nil
+}
+
+// legacyEntity parses an entity reference in its canonical string form,
+// e.g. `User::"alice"`, as written by older tools in place of the object
+func legacyEntity(path string, value string) (engine.EntityValue, error) {
+	idx := strings.Index(value, engine.ENTITY_PATH_SEP+"\"")
+	if idx <= 0 {
+		return engine.EntityValue{}, fmt.Errorf("%s: invalid entity reference %q: %w", path, value, ErrInvalidEntityFormat)
+	}
+	id, err := scanner.Unquote(value[idx+len(engine.ENTITY_PATH_SEP):])
+	if err != nil {
+		return engine.EntityValue{}, fmt.Errorf("%s: invalid entity reference %q: %w", path, value, ErrInvalidEntityFormat)
+	}
+
+	return engine.NewEntityValue(value[:idx], id), nil
 }
 
 func specialEntity(path string, v reflect.Value, allowUnderscore bool) (engine.EntityValue, error) {
 	v = unwrapInterface(v)
+	if v.Kind() == reflect.String && allowUnderscore {
+		return legacyEntity(path, v.String())
+	}
 	if v.Kind() != reflect.Map {
-		return nil, fmt.Errorf("%s: expected map got %s for entity: %w", path, v.Kind().String(), ErrInvalidEntityFormat)
+		return engine.EntityValue{}, fmt.Errorf("%s: expected map got %s for entity: %w", path, v.Kind().String(), ErrInvalidEntityFormat)
 	}
 
 	byKey := map[string]reflect.Value{}
@@ -102,32 +152,99 @@ func specialEntity(path string, v reflect.Value, allowUnderscore bool) (engine.E
 
 	if allowUnderscore {
 		if val, found := byKey["__entity"]; found {
+			if err := specialKeys(path, len(byKey)); err != nil {
+				return engine.EntityValue{}, err
+			}
 			return specialEntity(path, val, false)
 		}
+		if val, found := byKey["__expr"]; found {
+			if err := specialKeys(path, len(byKey)); err != nil {
+				return engine.EntityValue{}, err
+			}
+			return specialEntity(path, val, true)
+		}
 	}
 
 	id, found := byKey["id"]
 	if !found {
-		return nil, fmt.Errorf("%s: missing id field for entity: %w", path, ErrInvalidEntityFormat)
+		return engine.EntityValue{}, fmt.Errorf("%s: missing id field for entity: %w", path, ErrInvalidEntityFormat)
 	}
 	kind, found := byKey["type"]
 	if !found {
-		return nil, fmt.Errorf("%s: missing type field for entity: %w", path, ErrInvalidEntityFormat)
+		return engine.EntityValue{}, fmt.Errorf("%s: missing type field for entity: %w", path, ErrInvalidEntityFormat)
 	}
 	id = unwrapInterface(id)
 	kind = unwrapInterface(kind)
 
 	if id.Kind() != reflect.String {
-		return nil, fmt.Errorf("%s: 'id' type not string got %s for entity: %w", path, id.Kind().String(), ErrInvalidEntityFormat)
+		return engine.EntityValue{}, fmt.Errorf("%s: 'id' type not string got %s for entity: %w", path, id.Kind().String(), ErrInvalidEntityFormat)
 	}
 	if kind.Kind() != reflect.String {
-		return nil, fmt.Errorf("%s: 'type' type not string got %s for entity: %w", path, kind.Kind().String(), ErrInvalidEntityFormat)
+		return engine.EntityValue{}, fmt.Errorf("%s: 'type' type not string got %s for entity: %w", path, kind.Kind().String(), ErrInvalidEntityFormat)
 	}
 
 	return engine.NewEntityValue(kind.String(), id.String()), nil
 }
 
-func walkMap(path string, v reflect.Value, shape map[string]*EntityShape) (engine.NamedType, error) {
+// attrPath is the path of the attribute of the record at path, the special
+// keys are the value of the record itself
+func attrPath(path string, key string) string {
+	if key == "__entity" || key == "__expr" || key == "__extn" {
+		return path
+	}
+	return path + "." + key
+}
+
+// specialKeys checks that the key of an entity or extension reference, such
+// as `__entity`, is the only key of its object
+func specialKeys(path string, count int) error {
+	if count != 1 {
+		return fmt.Errorf("%s: unexpected keys next to the reference: %w", path, ErrInvalidEntityFormat)
+	}
+	return nil
+}
+
+// checkRecord checks the attributes of a record against its shape, the
+// required attributes must be present and the others declared unless the
+// shape allows additional attributes
+func checkRecord(path string, children map[string]engine.NamedType, record *EntityShape) error {
+	if record == nil {
+		return nil
+	}
+	if err := checkAdditional(path, children, record); err != nil {
+		return err
+	}
+	for key, item := range record.Attributes {
+		if !item.Required {
+			continue
+		}
+		if _, found := children[key]; found {
+			continue
+		}
+		return fmt.Errorf("%s: required field %s not provided: %w", path, key, ErrInvalidEntityFormat)
+	}
+	return nil
+}
+
+// checkAdditional checks the attributes are declared by the shape, unless it
+// allows additional attributes
+func checkAdditional(path string, children map[string]engine.NamedType, record *EntityShape) error {
+	if record == nil || record.AdditionalAttributes {
+		return nil
+	}
+	for key := range children {
+		if _, found := record.Attributes[key]; !found {
+			return fmt.Errorf("%s: %w: %w", attrPath(path, key), ErrUndeclaredAttribute, ErrInvalidEntityFormat)
+		}
+	}
+	return nil
+}
+
+func walkMap(path string, v reflect.Value, record *EntityShape) (engine.NamedType, error) {
+	var shape map[string]*EntityShape
+	if record != nil {
+		shape = record.Attributes
+	}
 	children := map[string]engine.NamedType{}
 	iter := v.MapRange()
 
@@ -154,17 +271,16 @@ func walkMap(path string, v reflect.Value, shape map[string]*EntityShape) (engin
 				sub = sval
 			}
 		}
-		if (sub != nil && sub.Type == SHAPE_ENTITY) || key == "__entity" {
-			val, err := specialEntity(path, iter.Value(), key != "__entity")
+		if (sub != nil && sub.Type == SHAPE_ENTITY) || key == "__entity" || key == "__expr" {
+			val, err := specialEntity(attrPath(path, key), iter.Value(), key != "__entity")
 			if err != nil {
 				return nil, err
 			}
 			if sub != nil && val.EntityType() != sub.Name {
-				return nil, fmt.Errorf("%s: entity of the wrong type got %s expected %s: %w",
-					path, val[len(val)-1], sub.Name, ErrInvalidEntityFormat)
+				return nil, typeMismatch(attrPath(path, key), sub, val.EntityType())
 			}
-			if key == "__entity" {
-				return val, nil
+			if key == "__entity" || key == "__expr" {
+				return val, specialKeys(path, v.Len())
 			}
 			children[key] = val
 			continue
@@ -174,12 +290,12 @@ func walkMap(path string, v reflect.Value, shape map[string]*EntityShape) (engin
 			if sub != nil {
 				kind = sub.Name
 			}
-			val, err := specialExtension(path, kind, iter.Value())
+			val, err := specialExtension(attrPath(path, key), kind, iter.Value())
 			if err != nil {
 				return nil, err
 			}
 			if key == "__extn" {
-				return val, nil
+				return val, specialKeys(path, v.Len())
 			}
 			children[key] = val
 			continue
@@ -193,52 +309,209 @@ func walkMap(path string, v reflect.Value, shape map[string]*EntityShape) (engin
 		children[key] = val
 	}
 
-	for key, item := range shape {
-		if !item.Required {
-			continue
+	if err := checkRecord(path, children, record); err != nil {
+		return nil, err
+	}
+
+	return engine.NewVarValue(children), nil
+}
+
+// EntityRef is a struct field type for a reference to an entity, it is
+// converted to the entity as with `{"__entity": {"type": ..., "id": ...}}`
+type EntityRef struct {
+	Type string
+	Id   string
+}
+
+var (
+	entityRefType = reflect.TypeOf(EntityRef{})
+	entityType    = reflect.TypeOf(engine.EntityValue{})
+	timeType      = reflect.TypeOf(time.Time{})
+	ipType        = reflect.TypeOf(net.IP{})
+	numberType    = reflect.TypeOf(json.Number(""))
+)
+
+// walkKnown converts the Go types which have a Cedar equivalent, returning
+// nil when the value isn't one of them
+func walkKnown(path string, v reflect.Value, shape *EntityShape) (engine.NamedType, error) {
+	var value engine.NamedType
+	switch v.Type() {
+	case entityRefType:
+		ref := v.Interface().(EntityRef)
+		if ref.Type == "" {
+			return nil, fmt.Errorf("%s: missing type for entity: %w", path, ErrInvalidEntityFormat)
+		}
+		value = engine.NewEntityValue(ref.Type, ref.Id)
+	case entityType:
+		value = v.Interface().(engine.EntityValue)
+	case timeType:
+		// Cedar has no time type, a time is compared as the Unix time
+		if shape != nil && shape.Type != SHAPE_LONG {
+			return nil, typeMismatch(path, shape, "Long")
 		}
-		if _, found := children[key]; found {
-			continue
+		return engine.IntValue(v.Interface().(time.Time).Unix()), nil
+	case numberType:
+		if shape != nil && shape.Type != SHAPE_LONG {
+			return nil, typeMismatch(path, shape, "Long")
+		}
+		return numberLong(path, v.Interface().(json.Number))
+	case ipType:
+		ip := v.Interface().(net.IP)
+		if len(ip) == 0 {
+			return nil, fmt.Errorf("%s: empty ip address: %w", path, ErrInvalidEntityFormat)
+		}
+		ipValue, err := engine.NewIpValue(ip.String())
+		return checkKnown(path, shape, ipValue, err)
+	default:
+		return nil, nil
+	}
+	return checkKnown(path, shape, value, nil)
+}
+
+// checkKnown checks the converted value against the shape, when there is one
+func checkKnown(path string, shape *EntityShape, value engine.NamedType, err error) (engine.NamedType, error) {
+	if err != nil || shape == nil {
+		return value, err
+	}
+	switch shape.Type {
+	case SHAPE_EXTENSION:
+		return checkExtension(path, shape.Name, value)
+	case SHAPE_ENTITY:
+		if _, ok := value.(engine.EntityValue); ok {
+			return value, nil
 		}
-		return nil, fmt.Errorf("%s: required field %s not provided: %w", path, key, ErrInvalidEntityFormat)
 	}
+	return nil, typeMismatch(path, shape, value.TypeName())
+}
 
-	return engine.NewVarValue(children), nil
+// structField is how a field is converted, from its `cedar` tag
+type structField struct {
+	name      string
+	omitEmpty bool
+	skip      bool
+}
+
+func parseStructField(field reflect.StructField) structField {
+	tag := field.Tag.Get("cedar")
+	if tag == "-" {
+		return structField{skip: true}
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+
+	output := structField{name: name}
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == "omitempty" {
+			output.omitEmpty = true
+		}
+	}
+	if name == "" {
+		// TODO - Technically this is a byte :(
+		output.name = string(unicode.ToLower(rune(field.Name[0]))) + field.Name[1:]
+	}
+	// Fields of an embedded struct are promoted unless the field is named
+	if field.Anonymous && name == "" && isPromoted(field.Type) {
+		output.name = ""
+	}
+	return output
 }
 
-func walkStruct(path string, v reflect.Value, shape map[string]*EntityShape) (engine.NamedType, error) {
+// isPromoted reports if the fields of an embedded struct of the type are
+// promoted, the types with a Cedar equivalent are kept as a single value
+func isPromoted(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case entityRefType, timeType:
+		return false
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// isEmptyValue is the test of omitempty, as with encoding/json
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// walkStruct converts the exported fields of the struct to a record, the
+// fields of embedded structs are added as if they were fields of the struct.
+func walkStruct(path string, v reflect.Value, record *EntityShape) (engine.NamedType, error) {
+	var shape map[string]*EntityShape
+	if record != nil {
+		shape = record.Attributes
+	}
 	children := map[string]engine.NamedType{}
 
+	if err := walkFields(path, v, shape, children); err != nil {
+		return nil, err
+	}
+	// the fields are not checked for the required attributes, a field with
+	// omitempty may be left out
+	if err := checkAdditional(path, children, record); err != nil {
+		return nil, err
+	}
+
+	return engine.NewVarValue(children), nil
+}
+
+// walkFields adds the fields of the struct which aren't already present, the
+// embedded structs are walked after the other fields so their fields are
+// hidden by those of the outer struct.
+func walkFields(path string, v reflect.Value, shape map[string]*EntityShape, children map[string]engine.NamedType) error {
 	t := v.Type()
+	embedded := []reflect.Value{}
 
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
+		info := parseStructField(field)
+		if info.skip || !field.IsExported() {
+			continue
+		}
+		value := v.Field(i)
 
-		name := field.Name
-		tag := field.Tag.Get("cedar")
-		if tag != "" {
-			name = tag
-		} else {
-			// TODO - Technically this is a byte :(
-			name = string(unicode.ToLower(rune(name[0]))) + name[1:]
+		if info.name == "" {
+			for value.Kind() == reflect.Ptr && !value.IsNil() {
+				value = value.Elem()
+			}
+			// a nil pointer has no fields to add
+			if value.Kind() == reflect.Struct {
+				embedded = append(embedded, value)
+			}
+			continue
+		}
+		if _, found := children[info.name]; found {
+			continue
+		}
+		if info.omitEmpty && isEmptyValue(value) {
+			continue
 		}
 
 		var sub *EntityShape
 		if shape != nil {
-			if sval, found := shape[name]; found {
+			if sval, found := shape[info.name]; found {
 				sub = sval
 			}
 		}
 
-		val, err := walkValue(path+"."+name, v.Field(i), sub)
+		val, err := walkValue(path+"."+info.name, value, sub)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		children[name] = val
+		children[info.name] = val
 	}
 
-	return engine.NewVarValue(children), nil
+	for _, value := range embedded {
+		if err := walkFields(path, value, shape, children); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func walkValue(path string, v reflect.Value, shape *EntityShape) (engine.NamedType, error) {
@@ -247,6 +520,14 @@ func walkValue(path string, v reflect.Value, shape *EntityShape) (engine.NamedTy
 	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
 		v = v.Elem()
 	}
+	if v.IsValid() {
+		if value, err := walkKnown(path, v, shape); value != nil || err != nil {
+			return value, err
+		}
+	}
+	if shape != nil && shape.Type == SHAPE_EXTENSION {
+		return specialExtension(path, shape.Name, v)
+	}
 	switch v.Kind() {
 	case reflect.Interface:
 		// Ignore
@@ -254,7 +535,7 @@ func walkValue(path string, v reflect.Value, shape *EntityShape) (engine.NamedTy
 		var sub *EntityShape
 		if shape != nil {
 			if shape.Type != SHAPE_SET {
-				return nil, fmt.Errorf("unexpected type at key %s expected record: %w", "", ErrInvalidEntityFormat)
+				return nil, typeMismatch(path, shape, "Set")
 			}
 			sub = shape.Element
 		}
@@ -264,17 +545,15 @@ func walkValue(path string, v reflect.Value, shape *EntityShape) (engine.NamedTy
 		}
 		return v, nil
 	case reflect.Map:
-		var sub map[string]*EntityShape
+		var sub *EntityShape
 		if shape == nil {
 			// nothing
 		} else if shape.Type == SHAPE_ENTITY {
 			return specialEntity(path, v, true)
-		} else if shape.Type == SHAPE_EXTENSION {
-			// TODO
 		} else if shape.Type == SHAPE_RECORD {
-			sub = shape.Attributes
+			sub = shape
 		} else {
-			return nil, fmt.Errorf("unexpected type at key %s expected record: %w", "", ErrInvalidEntityFormat)
+			return nil, typeMismatch(path, shape, "Record")
 		}
 		v, err := walkMap(path, v, sub)
 		if err != nil {
@@ -282,17 +561,15 @@ func walkValue(path string, v reflect.Value, shape *EntityShape) (engine.NamedTy
 		}
 		return v, nil
 	case reflect.Struct:
-		var sub map[string]*EntityShape
+		var sub *EntityShape
 		if shape == nil {
 			// nothing
 		} else if shape.Type == SHAPE_ENTITY {
 			// TODO
-		} else if shape.Type == SHAPE_EXTENSION {
-			// TODO
 		} else if shape.Type == SHAPE_RECORD {
-			sub = shape.Attributes
+			sub = shape
 		} else {
-			return nil, fmt.Errorf("unexpected type at key %s expected record: %w", "", ErrInvalidEntityFormat)
+			return nil, typeMismatch(path, shape, "Record")
 		}
 		v, err := walkStruct(path, v, sub)
 		if err != nil {
@@ -302,28 +579,33 @@ func walkValue(path string, v reflect.Value, shape *EntityShape) (engine.NamedTy
 
 	case reflect.Bool:
 		if shape != nil && shape.Type != SHAPE_BOOL {
-			return nil, fmt.Errorf("unexpected type at key %s expected bool: %w", "", ErrInvalidEntityFormat)
+			return nil, typeMismatch(path, shape, "Boolean")
 		}
 		return engine.BoolValue(v.Bool()), nil
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		if shape != nil && shape.Type != SHAPE_LONG {
-			return nil, fmt.Errorf("unexpected type at key %s expected long: %w", "", ErrInvalidEntityFormat)
+			return nil, typeMismatch(path, shape, "Long")
 		}
 		return engine.IntValue(v.Int()), nil
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		if shape != nil && shape.Type != SHAPE_LONG {
-			return nil, fmt.Errorf("unexpected type at key %s expected long: %w", "", ErrInvalidEntityFormat)
+			return nil, typeMismatch(path, shape, "Long")
+		}
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("value %d is out of range for long: %w", v.Uint(), ErrInvalidEntityFormat)
 		}
-		return engine.IntValue(int(v.Uint())), nil
+		return engine.IntValue(v.Uint()), nil
 	case reflect.Float32, reflect.Float64:
 		if shape != nil && shape.Type != SHAPE_LONG {
-			return nil, fmt.Errorf("unexpected type at key %s expected long: %w", "", ErrInvalidEntityFormat)
+			return nil, typeMismatch(path, shape, "Long")
 		}
-		return engine.IntValue(int(v.Float())), nil
-		// return engine.StrValue(fmt.Sprintf("%f", v.Float())), nil
+		return floatLong(path, v.Float())
 	case reflect.String:
+		if shape != nil && shape.Type == SHAPE_ENTITY {
+			return legacyEntity(path, v.String())
+		}
 		if shape != nil && shape.Type != SHAPE_STRING {
-			return nil, fmt.Errorf("unexpected type at key %s expected string: %w", "", ErrInvalidEntityFormat)
+			return nil, typeMismatch(path, shape, "String")
 		}
 		return engine.StrValue(v.String()), nil
 
@@ -337,36 +619,28 @@ func walkValue(path string, v reflect.Value, shape *EntityShape) (engine.NamedTy
 		// case reflect.UnsafePointer:
 
 	}
-	return nil, fmt.Errorf("unexpected type %s: %w", v.Kind().String(), ErrUnsupportedType)
+	return nil, fmt.Errorf("%s: unexpected type %s: %w", path, v.Kind().String(), ErrUnsupportedType)
 }
 
 func (schema *Schema) findActionShape(action, principal, resource engine.EntityValue) *EntityShape {
-	var namespace string
-	nlen := 0
-	if len(action) > 2 {
-		nlen = len(action) - 2
-		namespace = strings.Join(action[0:nlen], "::")
+	if action.IsZero() {
+		return nil
 	}
+	namespace := strings.TrimSuffix(strings.TrimSuffix(action.EntityType(), "Action"), "::")
 	nsrules, found := schema.Actions[namespace]
 	if !found {
 		return nil
 	}
-	rules, found := nsrules[action[len(action)-1]]
+	rules, found := nsrules[action.EntityId()]
 	if !found {
 		return nil
 	}
 	if rules.HasPrincipalTypes {
-		if len(principal) < nlen {
-			return nil
-		}
 		if !rules.PrincipalTypes[principal.EntityType()] {
 			return nil
 		}
 	}
 	if rules.HasResourceTypes {
-		if len(resource) < nlen {
-			return nil
-		}
 		if !rules.ResourceTypes[resource.EntityType()] {
 			return nil
 		}
@@ -378,9 +652,18 @@ func (schema *Schema) findActionShape(action, principal, resource engine.EntityV
 func (schema *Schema) NormalizeContext(input any, principal, action, resource engine.EntityValue) (*engine.VarValue, error) {
 	shape := schema.findActionShape(action, principal, resource)
 
-	output, err := walkValue("", reflect.ValueOf(input), shape)
+	// Without a shape to check against the records are only validated, and
+	// converted as the policies read them
+	if record, ok := input.(map[string]any); ok && shape == nil && !isSpecialJson(record) {
+		if err := validateJson(&jsonPath{root: "context"}, record); err != nil {
+			return nil, fmt.Errorf("unable to parse context: %w", err)
+		}
+		return engine.NewLazyVarValue(record, lazyJson), nil
+	}
+
+	output, err := walkJson(&jsonPath{root: "context"}, input, shape)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse context: %s", err)
+		return nil, fmt.Errorf("unable to parse context: %w", err)
 	}
 	varval, ok := output.(*engine.VarValue)
 	if !ok {
@@ -390,46 +673,151 @@ func (schema *Schema) NormalizeContext(input any, principal, action, resource en
 	return varval, nil
 }
 
-func (schema *Schema) NormalizeEntites(input JsonEntities) (EntityStore, error) {
-	collection := EntityStore{}
+// parallelThreshold is the number of entities before the normalization
+// is spread across multiple workers
+const parallelThreshold = 1024
+
+func (schema *Schema) normalizeEntity(item JsonEntityItem) (EntityStoreItem, error) {
+	uid, err := specialEntity("", reflect.ValueOf(item.Uid), true)
+	if err != nil {
+		return EntityStoreItem{}, err
+	}
+
+	var parents []engine.EntityValue
+	for _, item := range item.Parents {
+		ent, err := specialEntity("", reflect.ValueOf(item), true)
 
-	for _, item := range input {
-		uid, err := specialEntity("", reflect.ValueOf(item.Uid), true)
 		if err != nil {
-			return nil, err
+			return EntityStoreItem{}, err
 		}
 
-		var parents []engine.EntityValue
-		for _, item := range item.Parents {
-			ent, err := specialEntity("", reflect.ValueOf(item), true)
+		parents = append(parents, ent)
+	}
 
-			if err != nil {
-				return nil, err
-			}
+	shape, err := schema.FindDef(uid)
+	if err != nil {
+		return EntityStoreItem{}, err
+	}
 
-			parents = append(parents, ent)
-		}
+	output, err := walkJson(&jsonPath{root: uid.String()}, item.Attrs, shape)
+	if err != nil {
+		return EntityStoreItem{}, err
+	}
+	varval, ok := output.(*engine.VarValue)
+	if !ok {
+		return EntityStoreItem{}, fmt.Errorf("expected variable type got=%s: %w", output.TypeName(), ErrUnsupportedType)
+	}
 
-		shape, err := schema.FindDef(uid)
-		if err != nil {
-			return nil, err
+	tags, err := schema.normalizeTags(uid, item.Tags)
+	if err != nil {
+		return EntityStoreItem{}, err
+	}
+
+	return EntityStoreItem{
+		entity:  uid,
+		values:  varval,
+		parents: sortedEntities(parents),
+		tags:    tags,
+	}, nil
+}
+
+// normalizeTags converts the tags of the entity, the values must be of the
+// tag type of the entity type when the schema declares it. Entity types of
+// the schema without a tag type can't have tags.
+func (schema *Schema) normalizeTags(uid engine.EntityValue, tags map[string]any) (*engine.VarValue, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	var shape *EntityShape
+	if def, found := schema.EntityTypes[uid.EntityType()]; found {
+		if def.Tags == nil {
+			return nil, fmt.Errorf("%s: entity type %s doesn't have tags: %w", uid, uid.EntityType(), ErrInvalidEntityFormat)
 		}
+		shape = def.Tags
+	}
 
-		output, err := walkValue(uid.String(), reflect.ValueOf(item.Attrs), shape)
+	children := make(map[string]engine.NamedType, len(tags))
+	path := &jsonPath{root: uid.String() + ".tags"}
+	for key, value := range tags {
+		path.push(key)
+		val, err := walkJson(path, value, shape)
+		path.pop()
 		if err != nil {
 			return nil, err
 		}
-		varval, ok := output.(*engine.VarValue)
-		if !ok {
-			return nil, fmt.Errorf("expected variable type got=%s: %w", output.TypeName(), ErrUnsupportedType)
-		}
+		children[key] = val
+	}
+
+	return engine.NewVarValue(children), nil
+}
+
+// normalizeAll runs the conversion of count entities, large inputs are
+// processed concurrently. When multiple entities are invalid the error
+// reported is always for the first one in the input.
+func normalizeAll(count int, convert func(idx int) (EntityStoreItem, error)) (EntityStore, error) {
+	items := make([]EntityStoreItem, count)
+	errs := make([]error, count)
+
+	workers := runtime.GOMAXPROCS(0)
+	if count < parallelThreshold || workers < 2 {
+		workers = 1
+	}
+
+	var next int64 = -1
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				idx := int(atomic.AddInt64(&next, 1))
+				if idx >= count {
+					return
+				}
+				items[idx], errs[idx] = convert(idx)
+			}
+		}()
+	}
+	wg.Wait()
 
-		collection[uid.String()] = EntityStoreItem{
-			entity:  uid,
-			values:  varval,
-			parents: parents,
+	collection := make(EntityStore, count)
+	for idx, item := range items {
+		if errs[idx] != nil {
+			return nil, errs[idx]
 		}
+		collection[item.entity.String()] = item
 	}
 
 	return collection, nil
 }
+
+// NormalizeEntites converts the JSON entities into an EntityStore
+func (schema *Schema) NormalizeEntites(input JsonEntities) (EntityStore, error) {
+	return normalizeAll(len(input), func(idx int) (EntityStoreItem, error) {
+		return schema.normalizeEntity(input[idx])
+	})
+}
+
+// numberLong converts a JSON number to a long, a whole number written with
+// a fraction or exponent is accepted, e.g. 1.0
+func numberLong(path string, value json.Number) (engine.NamedType, error) {
+	if ival, err := value.Int64(); err == nil {
+		return engine.IntValue(ival), nil
+	}
+	if fval, err := value.Float64(); err == nil && strings.ContainsAny(value.String(), ".eE") {
+		if result, err := floatLong(path, fval); err == nil {
+			return result, nil
+		}
+	}
+	return nil, &NormalizeError{Path: path, Expected: "Long", Got: value.String()}
+}
+
+// floatLong converts a number decoded as a float to a long, it is an error
+// for the number to have a fraction or to be out of the range of a long
+func floatLong(path string, value float64) (engine.NamedType, error) {
+	if value != math.Trunc(value) || value < -(1<<63) || value >= 1<<63 {
+		return nil, &NormalizeError{Path: path, Expected: "Long", Got: strconv.FormatFloat(value, 'g', -1, 64)}
+	}
+	return engine.IntValue(value), nil
+}
@@ -0,0 +1,236 @@
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/koblas/cedar-go/engine"
+)
+
+// jsonPath is the stack of keys leading to the value being walked, it's only
+// rendered to a string when needed for an error. Building the path string
+// for every value was the bulk of the allocations for nested records.
+type jsonPath struct {
+	root string
+	keys []string
+}
+
+func (p *jsonPath) push(key string) {
+	p.keys = append(p.keys, key)
+}
+
+func (p *jsonPath) pop() {
+	p.keys = p.keys[:len(p.keys)-1]
+}
+
+func (p *jsonPath) String() string {
+	if len(p.keys) == 0 {
+		return p.root
+	}
+	return p.root + "." + strings.Join(p.keys, ".")
+}
+
+// walkJson is a reflection free version of walkValue for the types produced
+// by encoding/json when decoding into `any`, other types fall back to walkValue.
+func walkJson(path *jsonPath, value any, shape *EntityShape) (engine.NamedType, error) {
+	if shape != nil && shape.Type == SHAPE_EXTENSION {
+		return specialExtension(path.String(), shape.Name, reflect.ValueOf(value))
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		var sub *EntityShape
+		if shape == nil {
+			// nothing
+		} else if shape.Type == SHAPE_ENTITY {
+			return specialEntity(path.String(), reflect.ValueOf(v), true)
+		} else if shape.Type == SHAPE_RECORD {
+			sub = shape
+		} else {
+			return nil, typeMismatch(path.String(), shape, "Record")
+		}
+		return walkJsonMap(path, v, sub)
+	case []any:
+		var sub *EntityShape
+		if shape != nil {
+			if shape.Type != SHAPE_SET {
+				return nil, typeMismatch(path.String(), shape, "Set")
+			}
+			sub = shape.Element
+		}
+		// Prefer empty list over nil
+		result := engine.SetValue{}
+		for i, item := range v {
+			path.push(strconv.Itoa(i))
+			val, err := walkJson(path, item, sub)
+			path.pop()
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, val)
+		}
+		return result, nil
+	case bool:
+		if shape != nil && shape.Type != SHAPE_BOOL {
+			return nil, typeMismatch(path.String(), shape, "Boolean")
+		}
+		return engine.BoolValue(v), nil
+	case float64:
+		if shape != nil && shape.Type != SHAPE_LONG {
+			return nil, typeMismatch(path.String(), shape, "Long")
+		}
+		return floatLong(path.String(), v)
+	case json.Number:
+		if shape != nil && shape.Type != SHAPE_LONG {
+			return nil, typeMismatch(path.String(), shape, "Long")
+		}
+		return numberLong(path.String(), v)
+	case string:
+		if shape != nil && shape.Type == SHAPE_ENTITY {
+			return legacyEntity(path.String(), v)
+		}
+		if shape != nil && shape.Type != SHAPE_STRING {
+			return nil, typeMismatch(path.String(), shape, "String")
+		}
+		return engine.StrValue(v), nil
+	case json.RawMessage:
+		return decodeJson(path.String(), v, shape)
+	}
+
+	return walkValue(path.String(), reflect.ValueOf(value), shape)
+}
+
+// walkJsonMap is the reflection free version of walkMap
+func walkJsonMap(path *jsonPath, input map[string]any, record *EntityShape) (engine.NamedType, error) {
+	var shape map[string]*EntityShape
+	if record != nil {
+		shape = record.Attributes
+	}
+	children := make(map[string]engine.NamedType, len(input))
+
+	for key, value := range input {
+		var sub *EntityShape
+		if shape != nil {
+			sub = shape[key]
+		}
+		if (sub != nil && sub.Type == SHAPE_ENTITY) || key == "__entity" || key == "__expr" {
+			val, err := specialEntity(attrPath(path.String(), key), reflect.ValueOf(value), key != "__entity")
+			if err != nil {
+				return nil, err
+			}
+			if sub != nil && val.EntityType() != sub.Name {
+				return nil, typeMismatch(attrPath(path.String(), key), sub, val.EntityType())
+			}
+			if key == "__entity" || key == "__expr" {
+				return val, specialKeys(path.String(), len(input))
+			}
+			children[key] = val
+			continue
+		}
+		if (sub != nil && sub.Type == SHAPE_EXTENSION) || key == "__extn" {
+			kind := ""
+			if sub != nil {
+				kind = sub.Name
+			}
+			val, err := specialExtension(attrPath(path.String(), key), kind, reflect.ValueOf(value))
+			if err != nil {
+				return nil, err
+			}
+			if key == "__extn" {
+				return val, specialKeys(path.String(), len(input))
+			}
+			children[key] = val
+			continue
+		}
+
+		path.push(key)
+		val, err := walkJson(path, value, sub)
+		path.pop()
+		if err != nil {
+			return nil, err
+		}
+
+		children[key] = val
+	}
+
+	if record != nil {
+		if err := checkRecord(path.String(), children, record); err != nil {
+			return nil, err
+		}
+	}
+
+	return engine.NewVarValue(children), nil
+}
+
+// validateJson checks that walkJson would convert the value when there is no
+// shape, without building the result.
+func validateJson(path *jsonPath, value any) error {
+	switch v := value.(type) {
+	case map[string]any:
+		if isSpecialJson(v) {
+			_, err := walkJsonMap(path, v, nil)
+			return err
+		}
+		for key, item := range v {
+			path.push(key)
+			err := validateJson(path, item)
+			path.pop()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case []any:
+		for i, item := range v {
+			path.push(strconv.Itoa(i))
+			err := validateJson(path, item)
+			path.pop()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case bool, string:
+		return nil
+	}
+
+	_, err := walkJson(path, value, nil)
+	return err
+}
+
+// lazyJson is walkJson without a shape, except that records are converted
+// when their attributes are first read. The value must have been checked
+// with validateJson.
+func lazyJson(value any) (engine.NamedType, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		if !isSpecialJson(v) {
+			return engine.NewLazyVarValue(v, lazyJson), nil
+		}
+	case []any:
+		result := make(engine.SetValue, 0, len(v))
+		for _, item := range v {
+			val, err := lazyJson(item)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, val)
+		}
+		return result, nil
+	}
+
+	return walkJson(&jsonPath{}, value, nil)
+}
+
+// isSpecialJson reports if the object is an entity or extension reference
+func isSpecialJson(value map[string]any) bool {
+	if _, found := value["__entity"]; found {
+		return true
+	}
+	if _, found := value["__expr"]; found {
+		return true
+	}
+	_, found := value["__extn"]
+	return found
+}
@@ -2,6 +2,7 @@ package schema_test
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
 	"testing"
 
@@ -41,10 +42,10 @@ func TestNormalizeSmoke(t *testing.T) {
 	var4, err := schema.NormalizeContext(data4, nil, nil, nil)
 	assert.NoError(t, err)
 
-	assert.EqualValues(t, var1, var2)
-	assert.EqualValues(t, var1, var2)
-	assert.EqualValues(t, var1, var3)
-	assert.NotEqualValues(t, var1, var4)
+	// Records may be converted lazily so compare the contents
+	assert.EqualValues(t, var1.AsJson(), var2.AsJson())
+	assert.EqualValues(t, var1.AsJson(), var3.AsJson())
+	assert.NotEqualValues(t, var1.AsJson(), var4.AsJson())
 }
 
 func TestNormalizerBase(t *testing.T) {
@@ -128,3 +129,732 @@ func TestNormalizerBase(t *testing.T) {
 
 	require.EqualValues(t, "entity", value.TypeName())
 }
+
+func generateEntities(count int) schema.JsonEntities {
+	entities := schema.JsonEntities{}
+	for i := 0; i < count; i++ {
+		entities = append(entities, schema.JsonEntityItem{
+			Uid: schema.JsonEntityValue{"type": "User", "id": fmt.Sprintf("u%d", i)},
+			Parents: []schema.JsonEntityValue{
+				{"type": "Group", "id": "everyone"},
+			},
+			Attrs: map[string]any{
+				"name":  fmt.Sprintf("user %d", i),
+				"level": float64(i % 10),
+				"tags":  []any{"a", "b"},
+				"manager": map[string]any{
+					"__entity": map[string]any{"type": "User", "id": "boss"},
+				},
+			},
+		})
+	}
+	return entities
+}
+
+func TestNormalizeEntitiesParallel(t *testing.T) {
+	sdef := schema.NewEmptySchema()
+
+	entities := generateEntities(5000)
+	store, err := sdef.NormalizeEntites(entities)
+	require.NoError(t, err)
+	assert.Len(t, store, 5000)
+
+	value, err := store.Get(engine.NewEntityValue("User", "u4321"), "name")
+	require.NoError(t, err)
+	assert.Equal(t, engine.StrValue("user 4321"), value)
+	value, err = store.Get(engine.NewEntityValue("User", "u4321"), "manager")
+	require.NoError(t, err)
+	assert.Equal(t, engine.NewEntityValue("User", "boss"), value)
+
+	// The first invalid entity is always reported
+	bad := map[string]any{"__entity": map[string]any{"type": "User"}}
+	entities[4000].Attrs["manager"] = bad
+	entities[2500].Attrs["manager"] = bad
+	for i := 0; i < 5; i++ {
+		_, err = sdef.NormalizeEntites(entities)
+		require.ErrorIs(t, err, schema.ErrInvalidEntityFormat)
+		assert.Contains(t, err.Error(), `User::"u2500"`)
+	}
+}
+
+func BenchmarkNormalizeEntities(b *testing.B) {
+	sdef := schema.NewEmptySchema()
+	entities := generateEntities(10000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := sdef.NormalizeEntites(entities); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecodeEntities(t *testing.T) {
+	sdef := schema.NewEmptySchema()
+
+	store, err := sdef.DecodeEntities(strings.NewReader(`[
+		{
+			"attrs": {
+				"name": "alice",
+				"age": 9007199254740993,
+				"ip": { "__extn": { "fn": "ip", "arg": "10.0.0.1" } },
+				"manager": { "__entity": { "type": "User", "id": "bob" } },
+				"tags": ["a", "b"]
+			},
+			"uid": { "type": "User", "id": "alice" },
+			"parents": [{ "type": "Group", "id": "staff" }]
+		},
+		{ "uid": { "__entity": { "type": "User", "id": "bob" } } }
+	]`))
+	require.NoError(t, err)
+
+	alice := engine.NewEntityValue("User", "alice")
+	value, err := store.Get(alice, "age")
+	require.NoError(t, err)
+	assert.Equal(t, engine.IntValue(9007199254740993), value)
+	value, err = store.Get(alice, "manager")
+	require.NoError(t, err)
+	assert.Equal(t, engine.NewEntityValue("User", "bob"), value)
+	value, err = store.Get(alice, "tags")
+	require.NoError(t, err)
+	assert.Equal(t, engine.SetValue{engine.StrValue("a"), engine.StrValue("b")}, value)
+
+	parents, err := store.GetParents(alice)
+	require.NoError(t, err)
+	assert.Contains(t, parents, engine.NewEntityValue("Group", "staff"))
+
+	_, err = sdef.DecodeEntities(strings.NewReader(`[{ "uid": { "type": "User" } }]`))
+	assert.ErrorIs(t, err, schema.ErrInvalidEntityFormat)
+}
+
+// The ancestors are nearest first and sorted at the same distance, whatever
+// the order the parents were listed in or the decoder used
+func TestGetParentsOrder(t *testing.T) {
+	sdef := schema.NewEmptySchema()
+	alice := engine.NewEntityValue("User", "alice")
+	expected := []engine.EntityValue{
+		engine.NewEntityValue("Group", "a"),
+		engine.NewEntityValue("Group", "b"),
+		engine.NewEntityValue("Team", "c"),
+		engine.NewEntityValue("Group", "root"),
+	}
+
+	for _, parents := range []string{
+		`[{"type": "Team", "id": "c"}, {"type": "Group", "id": "b"}, {"type": "Group", "id": "a"}]`,
+		`[{"type": "Group", "id": "a"}, {"type": "Team", "id": "c"}, {"type": "Group", "id": "b"}]`,
+	} {
+		input := `[
+			{"uid": {"type": "User", "id": "alice"}, "attrs": {}, "parents": ` + parents + `},
+			{"uid": {"type": "Team", "id": "c"}, "attrs": {}, "parents": [{"type": "Group", "id": "root"}]}
+		]`
+
+		store, err := sdef.DecodeEntities(strings.NewReader(input))
+		require.NoError(t, err)
+		result, err := store.GetParents(alice)
+		require.NoError(t, err)
+		assert.Equal(t, expected, result)
+
+		entities := schema.JsonEntities{}
+		require.NoError(t, json.Unmarshal([]byte(input), &entities))
+		normalized, err := sdef.NormalizeEntites(entities)
+		require.NoError(t, err)
+		result, err = normalized.GetParents(alice)
+		require.NoError(t, err)
+		assert.Equal(t, expected, result)
+	}
+}
+
+func TestEntityTags(t *testing.T) {
+	sdef, err := schema.NewFromText(strings.NewReader(`
+		entity User tags Set<String>;
+		entity Doc;
+	`))
+	require.NoError(t, err)
+
+	alice := engine.NewEntityValue("User", "alice")
+	input := `[
+		{ "uid": { "type": "User", "id": "alice" }, "attrs": {}, "parents": [], "tags": { "dept": ["eng"] } },
+		{ "uid": { "type": "Team", "id": "a" }, "attrs": {}, "parents": [], "tags": { "size": 3 } }
+	]`
+	var entities schema.JsonEntities
+	require.NoError(t, json.Unmarshal([]byte(input), &entities))
+
+	normalized, err := sdef.NormalizeEntites(entities)
+	require.NoError(t, err)
+	decoded, err := sdef.DecodeEntities(strings.NewReader(input))
+	require.NoError(t, err)
+
+	for _, store := range []schema.EntityStore{normalized, decoded} {
+		value, err := store.GetTag(alice, "dept")
+		require.NoError(t, err)
+		assert.Equal(t, engine.SetValue{engine.StrValue("eng")}, value)
+		_, err = store.GetTag(alice, "team")
+		assert.ErrorIs(t, err, engine.ErrValueNotFound)
+		// tags are separate from the attributes
+		_, err = store.Get(alice, "dept")
+		assert.ErrorIs(t, err, engine.ErrValueNotFound)
+
+		value, err = store.GetTag(engine.NewEntityValue("Team", "a"), "size")
+		require.NoError(t, err)
+		assert.Equal(t, engine.IntValue(3), value)
+	}
+
+	invalid := []string{
+		`[{ "uid": { "type": "User", "id": "alice" }, "attrs": {}, "tags": { "dept": "eng" } }]`,
+		`[{ "uid": { "type": "Doc", "id": "a" }, "attrs": {}, "tags": { "dept": ["eng"] } }]`,
+	}
+	for _, item := range invalid {
+		_, err := sdef.DecodeEntities(strings.NewReader(item))
+		assert.ErrorIs(t, err, schema.ErrInvalidEntityFormat, item)
+
+		require.NoError(t, json.Unmarshal([]byte(item), &entities))
+		_, err = sdef.NormalizeEntites(entities)
+		assert.ErrorIs(t, err, schema.ErrInvalidEntityFormat, item)
+	}
+}
+
+func TestNormalizeErrorPath(t *testing.T) {
+	sdef, err := schema.NewFromText(strings.NewReader(`
+		entity User = { address: { zip: Long }, roles: Set<String>, manager?: User, ip?: ipaddr };
+		action view appliesTo { principal: User, resource: User, context: { mfa: Bool, level: Long } };
+	`))
+	require.NoError(t, err)
+
+	alice := engine.NewEntityValue("User", "alice")
+	view := engine.NewEntityValue("Action", "view")
+	_, err = sdef.NormalizeContext(map[string]any{"mfa": true, "level": "high"}, alice, view, alice)
+	var normErr *schema.NormalizeError
+	require.ErrorAs(t, err, &normErr)
+	assert.Equal(t, schema.NormalizeError{Path: "context.level", Expected: "Long", Got: "String"}, *normErr)
+	assert.ErrorIs(t, err, schema.ErrInvalidEntityFormat)
+
+	cases := []struct {
+		attrs string
+		err   schema.NormalizeError
+	}{
+		{`{ "address": { "zip": "94110" }, "roles": [] }`, schema.NormalizeError{Path: `User::"alice".address.zip`, Expected: "Long", Got: "String"}},
+		{`{ "address": { "zip": 94110 }, "roles": ["a", 1] }`, schema.NormalizeError{Path: `User::"alice".roles.1`, Expected: "String", Got: "Long"}},
+		{`{ "address": [], "roles": [] }`, schema.NormalizeError{Path: `User::"alice".address`, Expected: "Record", Got: "Set"}},
+		{`{ "address": { "zip": 1 }, "roles": [], "manager": { "type": "Group", "id": "a" } }`, schema.NormalizeError{Path: `User::"alice".manager`, Expected: "User", Got: "Group"}},
+		{`{ "address": { "zip": 1 }, "roles": [], "ip": { "__extn": { "fn": "decimal", "arg": "1.0" } } }`, schema.NormalizeError{Path: `User::"alice".ip`, Expected: "ipaddr", Got: "decimal"}},
+	}
+	for _, item := range cases {
+		input := `[{ "uid": { "type": "User", "id": "alice" }, "attrs": ` + item.attrs + ` }]`
+
+		var entities schema.JsonEntities
+		require.NoError(t, json.Unmarshal([]byte(input), &entities))
+		_, err := sdef.NormalizeEntites(entities)
+		require.ErrorAs(t, err, &normErr, item.attrs)
+		assert.Equal(t, item.err, *normErr, item.attrs)
+
+		_, err = sdef.DecodeEntities(strings.NewReader(input))
+		require.ErrorAs(t, err, &normErr, item.attrs)
+		assert.Equal(t, item.err, *normErr, item.attrs)
+	}
+}
+
+func TestAdditionalAttributes(t *testing.T) {
+	sdef, err := schema.NewFromJson(strings.NewReader(`{
+		"": {
+			"entityTypes": {
+				"Closed": { "shape": { "type": "Record", "additionalAttributes": false, "attributes": {
+					"name": { "type": "String" },
+					"address": { "type": "Record", "attributes": { "zip": { "type": "String" } } }
+				} } },
+				"Open": { "shape": { "type": "Record", "additionalAttributes": true, "attributes": {
+					"name": { "type": "String" }
+				} } },
+				"Default": { "shape": { "type": "Record", "attributes": {} } }
+			},
+			"actions": {
+				"view": { "appliesTo": { "principalTypes": ["Closed"], "resourceTypes": ["Closed"], "context": {
+					"type": "Record", "additionalAttributes": false, "attributes": { "mfa": { "type": "Boolean" } }
+				} } }
+			}
+		}
+	}`))
+	require.NoError(t, err)
+
+	// an undeclared attribute can only be ruled out for a closed shape
+	for _, item := range []struct {
+		entityType string
+		attr       string
+		declared   bool
+		known      bool
+	}{
+		{"Closed", "name", true, true},
+		{"Closed", "age", false, true},
+		{"Open", "name", true, false},
+		{"Open", "age", false, false},
+		{"Default", "age", false, true},
+		{"Missing", "age", false, false},
+	} {
+		declared, known := sdef.HasAttribute(item.entityType, item.attr)
+		assert.Equal(t, item.declared, declared, item.entityType+"."+item.attr)
+		assert.Equal(t, item.known, known, item.entityType+"."+item.attr)
+	}
+
+	cases := []struct {
+		entity string
+		valid  bool
+	}{
+		{`{ "uid": { "type": "Closed", "id": "a" }, "attrs": { "name": "a", "address": { "zip": "1" } } }`, true},
+		{`{ "uid": { "type": "Closed", "id": "a" }, "attrs": { "name": "a", "address": { "zip": "1" }, "age": 1 } }`, false},
+		// the nested record doesn't say, so is closed as in Cedar
+		{`{ "uid": { "type": "Closed", "id": "a" }, "attrs": { "name": "a", "address": { "zip": "1", "city": "x" } } }`, false},
+		{`{ "uid": { "type": "Open", "id": "a" }, "attrs": { "name": "a", "age": 1 } }`, true},
+		{`{ "uid": { "type": "Default", "id": "a" }, "attrs": { "age": 1 } }`, false},
+	}
+	for _, item := range cases {
+		input := "[" + item.entity + "]"
+		var entities schema.JsonEntities
+		require.NoError(t, json.Unmarshal([]byte(input), &entities))
+
+		_, normErr := sdef.NormalizeEntites(entities)
+		_, decodeErr := sdef.DecodeEntities(strings.NewReader(input))
+		if item.valid {
+			assert.NoError(t, normErr, item.entity)
+			assert.NoError(t, decodeErr, item.entity)
+		} else {
+			assert.ErrorIs(t, normErr, schema.ErrUndeclaredAttribute, item.entity)
+			assert.ErrorIs(t, decodeErr, schema.ErrUndeclaredAttribute, item.entity)
+			assert.ErrorContains(t, normErr, `::"a".`)
+		}
+	}
+
+	closed := engine.NewEntityValue("Closed", "a")
+	view := engine.NewEntityValue("Action", "view")
+	_, err = sdef.NormalizeContext(map[string]any{"mfa": true}, closed, view, closed)
+	assert.NoError(t, err)
+	_, err = sdef.NormalizeContext(map[string]any{"mfa": true, "ip": "1.2.3.4"}, closed, view, closed)
+	assert.ErrorIs(t, err, schema.ErrUndeclaredAttribute)
+	assert.ErrorIs(t, err, schema.ErrInvalidEntityFormat)
+	_, err = sdef.NormalizeContext(struct {
+		Mfa bool
+		Ip  string
+	}{true, "1.2.3.4"}, closed, view, closed)
+	assert.ErrorIs(t, err, schema.ErrUndeclaredAttribute)
+}
+
+// nestedContext builds a record `depth` levels deep with `width` keys at
+// each level, the leaves are integers.
+func nestedContext(depth, width int) map[string]any {
+	record := map[string]any{}
+	for i := 0; i < width; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if depth <= 1 {
+			record[key] = float64(i)
+		} else {
+			record[key] = nestedContext(depth-1, width)
+		}
+	}
+	return record
+}
+
+func TestNormalizeNestedContext(t *testing.T) {
+	sdef := schema.NewEmptySchema()
+	data := nestedContext(3, 2)
+	data["owner"] = map[string]any{"__entity": map[string]any{"type": "User", "id": "alice"}}
+	data["tags"] = []any{map[string]any{"name": "a"}}
+
+	record, err := sdef.NormalizeContext(data, nil, nil, nil)
+	require.NoError(t, err)
+
+	value, err := record.OpLookup(engine.StrValue("k1"), nil)
+	require.NoError(t, err)
+	value, err = value.(*engine.VarValue).OpLookup(engine.StrValue("k0"), nil)
+	require.NoError(t, err)
+	has, err := value.(*engine.VarValue).OpHas(engine.StrValue("k1"), nil)
+	require.NoError(t, err)
+	assert.True(t, bool(has))
+
+	value, err = record.OpLookup(engine.StrValue("owner"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, engine.NewEntityValue("User", "alice"), value)
+
+	_, err = record.OpLookup(engine.StrValue("missing"), nil)
+	assert.ErrorIs(t, err, engine.ErrValueNotFound)
+
+	assert.Equal(t, map[string]any{
+		"k0": map[string]any{
+			"k0": map[string]any{"k0": engine.IntValue(0), "k1": engine.IntValue(1)},
+			"k1": map[string]any{"k0": engine.IntValue(0), "k1": engine.IntValue(1)},
+		},
+		"k1": map[string]any{
+			"k0": map[string]any{"k0": engine.IntValue(0), "k1": engine.IntValue(1)},
+			"k1": map[string]any{"k0": engine.IntValue(0), "k1": engine.IntValue(1)},
+		},
+		"owner": engine.NewEntityValue("User", "alice").AsJson(),
+		"tags":  []any{map[string]any{"name": engine.StrValue("a")}},
+	}, record.AsJson())
+
+	// Invalid values deep in the record are still reported up front
+	data["k0"].(map[string]any)["k1"].(map[string]any)["bad"] = map[string]any{"__entity": map[string]any{"type": "User"}}
+	_, err = sdef.NormalizeContext(data, nil, nil, nil)
+	assert.ErrorContains(t, err, ".k0.k1")
+}
+
+func BenchmarkNormalizeNestedContext(b *testing.B) {
+	sdef := schema.NewEmptySchema()
+	data := nestedContext(5, 4)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := sdef.NormalizeContext(data, nil, nil, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestExtensionValues(t *testing.T) {
+	sdef, err := schema.NewFromJson(strings.NewReader(`{"": {
+		"entityTypes": {"User": {"shape": {"type": "Record", "attributes": {
+			"limits": {"type": "Set", "element": {"type": "Extension", "name": "decimal"}},
+			"nets": {"type": "Set", "element": {"type": "Extension", "name": "ipaddr"}},
+			"deep": {"type": "Record", "attributes": {"inner": {"type": "Record", "attributes": {
+				"ip": {"type": "Extension", "name": "ipaddr"}
+			}}}}
+		}}}},
+		"actions": {}
+	}}`))
+	require.NoError(t, err)
+
+	decimal := func(text string) engine.NamedType {
+		val, err := engine.NewDecimalValue(text)
+		require.NoError(t, err)
+		return val
+	}
+	ip := func(text string) engine.NamedType {
+		val, err := engine.NewIpValue(text)
+		require.NoError(t, err)
+		return val
+	}
+	alice := engine.NewEntityValue("User", "alice")
+
+	tests := []struct {
+		name  string
+		sdef  *schema.Schema
+		attrs string
+		// expected value of each attribute
+		expect map[string]engine.NamedType
+		err    error
+	}{
+		{
+			name: "no schema",
+			sdef: schema.NewEmptySchema(),
+			attrs: `{
+				"limits": [{"__extn": {"fn": "decimal", "arg": "1.5"}}, {"__extn": {"fn": "decimal", "arg": "2.5"}}],
+				"nets": [[{"__extn": {"fn": "ip", "arg": "10.0.0.1"}}]],
+				"deep": {"inner": {"ip": {"__extn": {"fn": "ip", "arg": "10.0.0.2"}}}}
+			}`,
+			expect: map[string]engine.NamedType{
+				"limits": engine.SetValue{decimal("1.5"), decimal("2.5")},
+				"nets":   engine.SetValue{engine.SetValue{ip("10.0.0.1")}},
+			},
+		},
+		{
+			name: "schema",
+			sdef: sdef,
+			attrs: `{
+				"limits": [{"__extn": {"fn": "decimal", "arg": "1.5"}}, {"fn": "decimal", "arg": "2.5"}, "3.5"],
+				"nets": [{"__extn": {"fn": "ip", "arg": "10.0.0.1"}}, "10.0.0.0/8"],
+				"deep": {"inner": {"ip": {"fn": "ip", "arg": "10.0.0.2"}}}
+			}`,
+			expect: map[string]engine.NamedType{
+				"limits": engine.SetValue{decimal("1.5"), decimal("2.5"), decimal("3.5")},
+				"nets":   engine.SetValue{ip("10.0.0.1"), ip("10.0.0.0/8")},
+			},
+		},
+		{
+			name:  "schema wrong extension",
+			sdef:  sdef,
+			attrs: `{"nets": [{"__extn": {"fn": "decimal", "arg": "1.5"}}]}`,
+			err:   schema.ErrInvalidEntityFormat,
+		},
+		{
+			name:  "schema invalid value",
+			sdef:  sdef,
+			attrs: `{"limits": ["1.5.1"]}`,
+			err:   engine.ErrTypeMismatch,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		data := fmt.Sprintf(`[{"uid": {"type": "User", "id": "alice"}, "attrs": %s}]`, test.attrs)
+
+		check := func(t *testing.T, store schema.EntityStore, err error) {
+			if test.err != nil {
+				require.ErrorIs(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			for key, expect := range test.expect {
+				value, err := store.Get(alice, key)
+				require.NoError(t, err)
+				assert.Equal(t, expect, value, key)
+			}
+			value, err := store.Get(alice, "deep")
+			require.NoError(t, err)
+			inner, _ := value.(*engine.VarValue).Get("inner")
+			value, _ = inner.(*engine.VarValue).Get("ip")
+			assert.Equal(t, ip("10.0.0.2"), value)
+		}
+
+		t.Run(test.name+" decode", func(t *testing.T) {
+			store, err := test.sdef.DecodeEntities(strings.NewReader(data))
+			check(t, store, err)
+		})
+		t.Run(test.name+" normalize", func(t *testing.T) {
+			var input schema.JsonEntities
+			require.NoError(t, json.Unmarshal([]byte(data), &input))
+			store, err := test.sdef.NormalizeEntites(input)
+			check(t, store, err)
+		})
+	}
+}
+
+func TestLegacyEntityReferences(t *testing.T) {
+	sdef, err := schema.NewFromText(strings.NewReader(`
+		entity User = { manager?: User, reviewers?: Set<User>, note?: String };
+		action view appliesTo { principal: User, resource: User, context: { owner: User } };
+	`))
+	require.NoError(t, err)
+
+	alice := engine.NewEntityValue("User", "alice")
+	bob := engine.NewEntityValue("User", "bob")
+	input := `[{ "uid": { "type": "User", "id": "alice" }, "attrs": {
+		"manager": "User::\"bob\"",
+		"reviewers": ["User::\"bob\"", { "__expr": "User::\"carol\"" }],
+		"note": "User::\"bob\""
+	} }]`
+
+	var entities schema.JsonEntities
+	require.NoError(t, json.Unmarshal([]byte(input), &entities))
+	normalized, err := sdef.NormalizeEntites(entities)
+	require.NoError(t, err)
+	decoded, err := sdef.DecodeEntities(strings.NewReader(input))
+	require.NoError(t, err)
+
+	for _, store := range []schema.EntityStore{normalized, decoded} {
+		value, err := store.Get(alice, "manager")
+		require.NoError(t, err)
+		assert.Equal(t, bob, value)
+		value, err = store.Get(alice, "reviewers")
+		require.NoError(t, err)
+		assert.Equal(t, engine.SetValue{bob, engine.NewEntityValue("User", "carol")}, value)
+		// Only where the schema declares an entity
+		value, err = store.Get(alice, "note")
+		require.NoError(t, err)
+		assert.Equal(t, engine.StrValue(`User::"bob"`), value)
+	}
+
+	// `__expr` doesn't need a schema
+	store, err := schema.NewEmptySchema().DecodeEntities(strings.NewReader(`[{ "uid": { "type": "User", "id": "alice" }, "attrs": {
+		"manager": { "__expr": "User::\"bob\"" }
+	} }]`))
+	require.NoError(t, err)
+	value, err := store.Get(alice, "manager")
+	require.NoError(t, err)
+	assert.Equal(t, bob, value)
+
+	view := engine.NewEntityValue("Action", "view")
+	context, err := sdef.NormalizeContext(map[string]any{"owner": `User::"bob"`}, alice, view, alice)
+	require.NoError(t, err)
+	value, err = context.OpLookup(engine.StrValue("owner"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, bob, value)
+
+	for _, item := range []string{`"bob"`, `"User::bob"`, `"::\"bob\""`} {
+		input := `[{ "uid": { "type": "User", "id": "alice" }, "attrs": { "manager": ` + item + ` } }]`
+		_, err := sdef.DecodeEntities(strings.NewReader(input))
+		assert.ErrorIs(t, err, schema.ErrInvalidEntityFormat, item)
+
+		require.NoError(t, json.Unmarshal([]byte(input), &entities))
+		_, err = sdef.NormalizeEntites(entities)
+		assert.ErrorIs(t, err, schema.ErrInvalidEntityFormat, item)
+	}
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	sdef := schema.NewEmptySchema()
+
+	for _, input := range []string{
+		`[{ "uid": { "type": "User", "id": "alice" }, "attrs": { "name": "a", "name": "b" } }]`,
+		`[{ "uid": { "type": "User", "id": "alice" }, "attrs": { "address": { "zip": 1, "zip": 2 } } }]`,
+		`[{ "uid": { "type": "User", "id": "alice" }, "attrs": {}, "attrs": { "name": "a" } }]`,
+	} {
+		_, err := sdef.DecodeEntities(strings.NewReader(input))
+		assert.ErrorIs(t, err, schema.ErrDuplicateKey, input)
+		assert.ErrorIs(t, err, schema.ErrInvalidEntityFormat, input)
+	}
+
+	_, err := sdef.DecodeAttributes(engine.NewEntityValue("User", "alice"), []byte(`{ "a": 1, "a": 1 }`))
+	assert.ErrorIs(t, err, schema.ErrDuplicateKey)
+}
+
+// A number is a long only when it is whole and in the range of an int64
+func TestLongAttributes(t *testing.T) {
+	sdef := schema.NewEmptySchema()
+	alice := engine.NewEntityValue("User", "alice")
+
+	for _, item := range []struct {
+		number string
+		expect engine.NamedType
+	}{
+		{"42", engine.IntValue(42)},
+		{"-7", engine.IntValue(-7)},
+		{"2.0", engine.IntValue(2)},
+		{"1e3", engine.IntValue(1000)},
+		{"1.5", nil},
+		{"-0.25", nil},
+		{"1e30", nil},
+		{"9223372036854775808", nil},
+		{"-9223372036854775809", nil},
+		{"1e400", nil},
+	} {
+		input := `[{ "uid": { "type": "User", "id": "alice" }, "attrs": { "n": ` + item.number + ` } }]`
+
+		decoded, decodeErr := sdef.DecodeEntities(strings.NewReader(input))
+		var entities schema.JsonEntities
+		var normalized schema.EntityStore
+		normErr := json.Unmarshal([]byte(input), &entities)
+		if normErr == nil {
+			normalized, normErr = sdef.NormalizeEntites(entities)
+		}
+
+		if item.expect == nil {
+			assert.ErrorIs(t, decodeErr, schema.ErrInvalidEntityFormat, item.number)
+			assert.ErrorIs(t, normErr, schema.ErrInvalidEntityFormat, item.number)
+			continue
+		}
+		require.NoError(t, decodeErr, item.number)
+		require.NoError(t, normErr, item.number)
+		for _, store := range []schema.EntityStore{decoded, normalized} {
+			value, err := store.Get(alice, "n")
+			require.NoError(t, err, item.number)
+			assert.Equal(t, item.expect, value, item.number)
+		}
+	}
+
+	// Floats of Go values are converted the same way
+	_, err := sdef.NormalizeEntites(schema.JsonEntities{{
+		Uid:   schema.JsonEntityValue{"type": "User", "id": "alice"},
+		Attrs: map[string]any{"n": float32(1.5)},
+	}})
+	assert.ErrorIs(t, err, schema.ErrInvalidEntityFormat)
+	store, err := sdef.NormalizeEntites(schema.JsonEntities{{
+		Uid:   schema.JsonEntityValue{"type": "User", "id": "alice"},
+		Attrs: map[string]any{"n": float32(3)},
+	}})
+	require.NoError(t, err)
+	value, err := store.Get(alice, "n")
+	require.NoError(t, err)
+	assert.Equal(t, engine.IntValue(3), value)
+}
+
+type (
+	reflectRecord map[string]any
+	reflectSet    []any
+)
+
+// reflectOnly converts the records and sets to types which encoding/json
+// doesn't produce, so they are converted by reflection
+func reflectOnly(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		output := reflectRecord{}
+		for key, item := range v {
+			output[key] = reflectOnly(item)
+		}
+		return output
+	case []any:
+		output := reflectSet{}
+		for _, item := range v {
+			output = append(output, reflectOnly(item))
+		}
+		return output
+	}
+	return value
+}
+
+// The decoder, the map path of NormalizeEntites and the reflection path
+// agree on the same input
+func TestDecodePathsAgree(t *testing.T) {
+	sdef := schema.NewEmptySchema()
+	alice := engine.NewEntityValue("User", "alice")
+	ip, err := engine.NewIpValue("10.0.0.1")
+	require.NoError(t, err)
+
+	paths := map[string]func(input string) (schema.EntityStore, error){
+		"decoder": func(input string) (schema.EntityStore, error) {
+			return sdef.DecodeEntities(strings.NewReader(input))
+		},
+		"map": func(input string) (schema.EntityStore, error) {
+			var entities schema.JsonEntities
+			if err := json.Unmarshal([]byte(input), &entities); err != nil {
+				return nil, err
+			}
+			return sdef.NormalizeEntites(entities)
+		},
+		"reflection": func(input string) (schema.EntityStore, error) {
+			var entities schema.JsonEntities
+			if err := json.Unmarshal([]byte(input), &entities); err != nil {
+				return nil, err
+			}
+			for _, item := range entities {
+				for key, value := range item.Attrs {
+					item.Attrs[key] = reflectOnly(value)
+				}
+			}
+			return sdef.NormalizeEntites(entities)
+		},
+	}
+
+	for _, item := range []struct {
+		entity string
+		expect engine.NamedType // nil when the input is invalid
+	}{
+		{`"attrs": { "a": 9007199254740993 }`, engine.IntValue(9007199254740993)},
+		{`"attrs": { "a": -9223372036854775808 }`, engine.IntValue(-9223372036854775808)},
+		{`"attrs": { "a": 2.0 }`, engine.IntValue(2)},
+		{`"attrs": { "a": 1.5 }`, nil},
+		{`"attrs": { "a": 9223372036854775808 }`, nil},
+		{`"attrs": { "a": [1, "x", true] }`, engine.SetValue{engine.IntValue(1), engine.StrValue("x"), engine.BoolValue(true)}},
+		{`"attrs": { "a": { "__entity": { "type": "User", "id": "bob" } } }`, engine.NewEntityValue("User", "bob")},
+		{`"attrs": { "a": { "__entity": { "type": "User", "id": "bob" }, "extra": 1 } }`, nil},
+		{`"attrs": { "a": { "__expr": "User::\"bob\"", "extra": 1 } }`, nil},
+		{`"attrs": { "a": { "__extn": { "fn": "ip", "arg": "10.0.0.1" } } }`, ip},
+		{`"attrs": { "a": { "__extn": { "fn": "ip", "arg": "10.0.0.1" }, "extra": 1 } }`, nil},
+		{`"attrs": { "a": { "b": 1, "b": 2 } }`, nil},
+		{`"attrs": { "a": 1, "a": 2 }`, nil},
+		{`"attrs": { "a": 1 }, "attrs": { "a": 2 }`, nil},
+		{`"attrs": { "a": 1 }, "parents": [{ "__entity": { "type": "Group", "id": "staff" }, "extra": 1 }]`, nil},
+	} {
+		input := `[{ "uid": { "type": "User", "id": "alice" }, ` + item.entity + ` }]`
+		for name, decode := range paths {
+			store, err := decode(input)
+			if item.expect == nil {
+				assert.ErrorIs(t, err, schema.ErrInvalidEntityFormat, name+": "+item.entity)
+				continue
+			}
+			require.NoError(t, err, name+": "+item.entity)
+			value, err := store.Get(alice, "a")
+			require.NoError(t, err, name+": "+item.entity)
+			assert.Equal(t, item.expect, value, name+": "+item.entity)
+		}
+	}
+
+	// The uid too, the tags are decoded with the same rules
+	for _, entity := range []string{
+		`{ "uid": { "__entity": { "type": "User", "id": "alice" }, "extra": 1 } }`,
+		`{ "uid": { "type": "User", "id": "alice" }, "tags": { "a": 1.5 } }`,
+		`{ "uid": { "type": "User", "id": "alice" }, "tags": { "a": 1, "a": 2 } }`,
+	} {
+		for name, decode := range paths {
+			_, err := decode("[" + entity + "]")
+			assert.ErrorIs(t, err, schema.ErrInvalidEntityFormat, name+": "+entity)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package schema
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/koblas/cedar-go/engine"
+)
+
+// actionType returns the entity type used for actions in the namespace
+func actionType(namespace string) string {
+	if namespace == "" {
+		return "Action"
+	}
+	return namespace + "::Action"
+}
+
+// EntityTypeNames returns the sorted list of fully qualified entity type names
+func (schema *Schema) EntityTypeNames() []string {
+	names := []string{}
+	for name := range schema.EntityTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ActionEntities returns every action declared in the schema as an entity
+// value (e.g. `Action::"view"`) sorted by the string form.
+func (schema *Schema) ActionEntities() []engine.EntityValue {
+	output := []engine.EntityValue{}
+	for ns, acts := range schema.Actions {
+		prefix := ""
+		if ns != "" {
+			prefix = ns + "::"
+		}
+		for name := range acts {
+			output = append(output, engine.NewEntityValue(actionType(ns), strings.TrimPrefix(name, prefix)))
+		}
+	}
+	sort.Slice(output, func(i, j int) bool {
+		return output[i].String() < output[j].String()
+	})
+
+	return output
+}
+
+// LookupAction finds the schema definition of the given action entity
+func (schema *Schema) LookupAction(action engine.EntityValue) *Action {
+	if action.IsZero() {
+		return nil
+	}
+	ns := strings.TrimSuffix(strings.TrimSuffix(action.EntityType(), "Action"), "::")
+	acts, found := schema.Actions[ns]
+	if !found {
+		return nil
+	}
+	id := action.EntityId()
+	if def, found := acts[id]; found {
+		return def
+	}
+	if ns != "" {
+		return acts[ns+"::"+id]
+	}
+	return nil
+}
+
+// IsMemberOfType reports whether entities of the type child may be, either
+// directly or transitively, members of entities of the type parent.
+func (schema *Schema) IsMemberOfType(child, parent string) bool {
+	seen := map[string]bool{}
+	todo := []string{child}
+
+	for len(todo) != 0 {
+		name := todo[0]
+		todo = todo[1:]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		def, found := schema.EntityTypes[name]
+		if !found {
+			continue
+		}
+		for _, item := range def.MemberOfTypes {
+			if item == parent {
+				return true
+			}
+			todo = append(todo, item)
+		}
+	}
+
+	return false
+}
+
+// IsActionIn reports whether the action is a member of the action group,
+// the relationship is reflexive and transitive.
+func (schema *Schema) IsActionIn(action, group engine.EntityValue) bool {
+	target := group.String()
+	for _, item := range schema.ActionAncestors(action) {
+		if item.String() == target {
+			return true
+		}
+	}
+	return false
+}
+
+// ActionAncestors returns the action along with every action group it is
+// transitively a member of
+func (schema *Schema) ActionAncestors(action engine.EntityValue) []engine.EntityValue {
+	seen := map[string]bool{}
+	output := []engine.EntityValue{}
+	todo := []engine.EntityValue{action}
+
+	for len(todo) != 0 {
+		item := todo[0]
+		todo = todo[1:]
+		key := item.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		output = append(output, item)
+
+		def := schema.LookupAction(item)
+		if def == nil {
+			continue
+		}
+		for _, parent := range def.MemberOf {
+			kind := parent.Type
+			if kind == "" || !strings.HasSuffix(kind, "Action") {
+				kind = item.EntityType()
+			}
+			todo = append(todo, engine.NewEntityValue(kind, parent.Id))
+		}
+	}
+
+	return output
+}
+
+// ActionStore returns a store holding the action hierarchy of the schema, so
+// `action in Action::"readOnly"` is resolved without the actions being part
+// of the entities
+func (schema *Schema) ActionStore() engine.Store {
+	return actionStore{schema}
+}
+
+type actionStore struct {
+	schema *Schema
+}
+
+func (s actionStore) Get(key engine.EntityValue, attr string) (engine.EvalValue, error) {
+	return nil, engine.ErrValueNotFound
+}
+
+func (s actionStore) GetParents(key engine.EntityValue) ([]engine.EntityValue, error) {
+	if s.schema.LookupAction(key) == nil {
+		return nil, nil
+	}
+	return s.schema.ActionAncestors(key)[1:], nil
+}
+
+// HasAttribute reports whether the attribute is declared on the entity type,
+// known is false when the entity type isn't part of the schema or its shape
+// allows additional attributes, as then an undeclared one can still exist.
+func (schema *Schema) HasAttribute(entityType, attr string) (bool, bool) {
+	def, found := schema.EntityTypes[entityType]
+	if !found || def.Shape == nil || def.Shape.Type != SHAPE_RECORD {
+		return false, false
+	}
+	_, declared := def.Shape.Attributes[attr]
+
+	return declared, !def.Shape.AdditionalAttributes
+}
+
+// TagType returns the type of the tags of the entity type, nil when the
+// entity type has no tags or isn't part of the schema.
+func (schema *Schema) TagType(entityType string) *EntityShape {
+	def, found := schema.EntityTypes[entityType]
+	if !found {
+		return nil
+	}
+
+	return def.Tags
+}
@@ -0,0 +1,539 @@
+package schema
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/koblas/cedar-go/scanner"
+	"github.com/koblas/cedar-go/token"
+)
+
+// The Cedar human-readable schema format (cedarschema)
+//
+//	Schema    ::= {Namespace}
+//	Namespace ::= ('namespace' Path '{' {Decl} '}') | Decl
+//	Decl      ::= Entity | Action | TypeDecl
+//	Entity    ::= 'entity' Idents ['in' EntOrTyps] [['='] RecType] ['tags' Type] ';'
+//	Action    ::= 'action' Names ['in' RefOrRefs] [AppliesTo] ';'
+//	TypeDecl  ::= 'type' IDENT '=' Type ';'
+//	Type      ::= Path | 'Set' '<' Type '>' | RecType
+//	RecType   ::= '{' [AttrDecls] '}'
+//	AttrDecls ::= Name ['?'] ':' Type [',' | ',' AttrDecls]
+//	AppliesTo ::= 'appliesTo' '{' AppDecls '}'
+
+var extensionTypes = map[string]bool{
+	"ipaddr":   true,
+	"decimal":  true,
+	"datetime": true,
+	"duration": true,
+}
+
+var primitiveTypes = map[string]string{
+	"String":  "String",
+	"Long":    "Long",
+	"Bool":    "Boolean",
+	"Boolean": "Boolean",
+}
+
+// textParser holds the state for parsing a cedarschema document
+type textParser struct {
+	file    *token.File
+	errors  scanner.ErrorList
+	scanner scanner.Scanner
+
+	pos token.Pos
+	tok token.Token
+	lit string
+
+	// Type references are resolved once all of the declarations are known
+	pending []pendingShape
+	output  JsonSchema
+}
+
+// textType is the parsed form of a type expression before name resolution
+type textType struct {
+	name    string // type name or path for references
+	element *textType
+	record  bool
+	attrs   []textAttr
+}
+
+type textAttr struct {
+	name     string
+	required bool
+	kind     *textType
+}
+
+// pendingShape is a declaration whose shape is converted after parsing
+type pendingShape struct {
+	namespace string
+	kind      *textType
+	assign    func(JsonEntityShape)
+}
+
+// A bailout panic is raised to indicate early termination.
+type textBailout struct{}
+
+func (p *textParser) init(filename string, src []byte) {
+	fset := token.NewFileSet()
+	p.file = fset.AddFile(filename, -1, len(src))
+	eh := func(pos token.Position, msg string) { p.errors.Add(pos, msg) }
+	p.scanner.Init(p.file, src, eh, 0)
+	p.output = JsonSchema{}
+
+	p.next()
+}
+
+func (p *textParser) next() {
+	p.pos, p.tok, p.lit = p.scanner.Scan()
+}
+
+func (p *textParser) error(pos token.Pos, msg string) {
+	p.errors.Add(p.file.Position(pos), msg)
+	panic(textBailout{})
+}
+
+func (p *textParser) errorExpected(msg string) {
+	found := p.tok.String()
+	if p.tok.IsLiteral() || p.tok.IsKeyword() {
+		found = p.lit
+	}
+	p.error(p.pos, "expected "+msg+", found '"+found+"'")
+}
+
+func (p *textParser) expect(tok token.Token) token.Pos {
+	pos := p.pos
+	if p.tok != tok {
+		p.errorExpected("'" + tok.String() + "'")
+	}
+	p.next()
+	return pos
+}
+
+// isWord returns true if the current token is the given identifier or keyword
+func (p *textParser) isWord(word string) bool {
+	return (p.tok == token.IDENTIFER || p.tok.IsKeyword()) && p.lit == word
+}
+
+// The Cedar policy scanner has no '=' token, it's reported as ILLEGAL
+func (p *textParser) isAssign() bool {
+	return p.tok == token.ILLEGAL && p.lit == "="
+}
+
+func (p *textParser) expectAssign() {
+	if !p.isAssign() {
+		p.errorExpected("'='")
+	}
+	p.next()
+}
+
+// parseIdent accepts identifiers and keywords, since within the schema
+// language words like `principal` or `in` are valid names.
+func (p *textParser) parseIdent() string {
+	if p.tok != token.IDENTIFER && !p.tok.IsKeyword() {
+		p.errorExpected("identifier")
+	}
+	name := p.lit
+	p.next()
+	return name
+}
+
+// Name ::= IDENT | STR
+func (p *textParser) parseName() string {
+	if p.tok == token.STRINGLIT {
+		name, err := scanner.Unquote(p.lit)
+		if err != nil {
+			p.error(p.pos, err.Error())
+		}
+		p.next()
+		return name
+	}
+	return p.parseIdent()
+}
+
+// Path ::= IDENT {'::' IDENT}
+func (p *textParser) parsePath() string {
+	parts := []string{p.parseIdent()}
+	for p.tok == token.PATH {
+		p.next()
+		parts = append(parts, p.parseIdent())
+	}
+	return strings.Join(parts, "::")
+}
+
+// Annotation ::= '@' IDENT ['(' STR ')']
+func (p *textParser) skipAnnotations() {
+	for p.tok == token.AT {
+		p.next()
+		p.parseIdent()
+		if p.tok == token.LPAREN {
+			p.next()
+			p.expect(token.STRINGLIT)
+			p.expect(token.RPAREN)
+		}
+	}
+}
+
+func (p *textParser) parseSchema() {
+	for p.tok != token.EOF {
+		p.skipAnnotations()
+		if p.isWord("namespace") {
+			p.next()
+			name := p.parsePath()
+			p.expect(token.LBRACE)
+			entry := p.namespace(name)
+			for p.tok != token.RBRACE && p.tok != token.EOF {
+				p.parseDecl(name, entry)
+			}
+			p.expect(token.RBRACE)
+		} else {
+			p.parseDecl("", p.namespace(""))
+		}
+	}
+}
+
+func (p *textParser) namespace(name string) *JsonSchemaEntry {
+	entry, found := p.output[name]
+	if !found {
+		entry = JsonSchemaEntry{
+			EntityTypes: JsonEntityTypes{},
+			Actions:     JsonActions{},
+			CommonTypes: JsonCommonTypes{},
+		}
+		p.output[name] = entry
+	}
+	return &entry
+}
+
+func (p *textParser) parseDecl(namespace string, entry *JsonSchemaEntry) {
+	p.skipAnnotations()
+
+	switch {
+	case p.isWord("entity"):
+		p.next()
+		p.parseEntity(namespace, entry)
+	case p.isWord("action"):
+		p.next()
+		p.parseAction(namespace, entry)
+	case p.isWord("type"):
+		p.next()
+		pos := p.pos
+		name := p.parseIdent()
+		p.expectAssign()
+		kind := p.parseType()
+		if _, found := entry.CommonTypes[name]; found {
+			p.error(pos, fmt.Sprintf("duplicate type declaration %s", name))
+		}
+		entry.CommonTypes[name] = JsonEntityShape{}
+		p.later(namespace, kind, func(shape JsonEntityShape) {
+			entry.CommonTypes[name] = shape
+		})
+	default:
+		p.errorExpected("'entity', 'action' or 'type'")
+	}
+	p.expect(token.SEMICOLON)
+}
+
+// EntOrTyps ::= Path | '[' [Path {',' Path}] ']'
+func (p *textParser) parseTypeList() []string {
+	if p.tok != token.LBRACK {
+		return []string{p.parsePath()}
+	}
+	p.next()
+	output := []string{}
+	for p.tok != token.RBRACK {
+		output = append(output, p.parsePath())
+		if p.tok != token.COMMA {
+			break
+		}
+		p.next()
+	}
+	p.expect(token.RBRACK)
+	return output
+}
+
+func (p *textParser) parseEntity(namespace string, entry *JsonSchemaEntry) {
+	positions := []token.Pos{p.pos}
+	names := []string{p.parseIdent()}
+	for p.tok == token.COMMA {
+		p.next()
+		positions = append(positions, p.pos)
+		names = append(names, p.parseIdent())
+	}
+
+	def := JsonEntityType{MemberOfTypes: []string{}}
+	if p.tok == token.IN {
+		p.next()
+		def.MemberOfTypes = p.parseTypeList()
+	}
+	if p.isAssign() {
+		p.next()
+	}
+	kind := &textType{record: true}
+	if p.tok == token.LBRACE {
+		kind = p.parseRecord()
+	}
+	var tags *textType
+	if p.isWord("tags") {
+		p.next()
+		tags = p.parseType()
+	}
+
+	for idx, name := range names {
+		if _, found := entry.EntityTypes[name]; found {
+			p.error(positions[idx], fmt.Sprintf("duplicate entity declaration %s", name))
+		}
+		entry.EntityTypes[name] = def
+
+		name := name
+		p.later(namespace, kind, func(shape JsonEntityShape) {
+			item := entry.EntityTypes[name]
+			item.Shape = shape
+			entry.EntityTypes[name] = item
+		})
+		if tags != nil {
+			p.later(namespace, tags, func(shape JsonEntityShape) {
+				item := entry.EntityTypes[name]
+				item.Tags = &shape
+				entry.EntityTypes[name] = item
+			})
+		}
+	}
+}
+
+// Ref ::= Path '::' STR | Name
+func (p *textParser) parseRef() JsonMemberOf {
+	if p.tok == token.STRINGLIT {
+		return JsonMemberOf{Id: p.parseName()}
+	}
+
+	parts := []string{p.parseIdent()}
+	for p.tok == token.PATH {
+		p.next()
+		if p.tok == token.STRINGLIT {
+			return JsonMemberOf{Type: strings.Join(parts, "::"), Id: p.parseName()}
+		}
+		parts = append(parts, p.parseIdent())
+	}
+	if len(parts) != 1 {
+		p.errorExpected("action reference")
+	}
+	return JsonMemberOf{Id: parts[0]}
+}
+
+func (p *textParser) parseAction(namespace string, entry *JsonSchemaEntry) {
+	positions := []token.Pos{p.pos}
+	names := []string{p.parseName()}
+	for p.tok == token.COMMA {
+		p.next()
+		positions = append(positions, p.pos)
+		names = append(names, p.parseName())
+	}
+
+	def := JsonAction{}
+	if p.tok == token.IN {
+		p.next()
+		if p.tok == token.LBRACK {
+			p.next()
+			for p.tok != token.RBRACK {
+				def.MemberOf = append(def.MemberOf, p.parseRef())
+				if p.tok != token.COMMA {
+					break
+				}
+				p.next()
+			}
+			p.expect(token.RBRACK)
+		} else {
+			def.MemberOf = append(def.MemberOf, p.parseRef())
+		}
+	}
+
+	if p.isWord("appliesTo") {
+		p.next()
+		def.AppliesTo = p.parseAppliesTo(namespace)
+	}
+
+	for idx, name := range names {
+		if _, found := entry.Actions[name]; found {
+			p.error(positions[idx], fmt.Sprintf("duplicate action declaration %s", name))
+		}
+		entry.Actions[name] = def
+	}
+}
+
+// AppDecls ::= ('principal' | 'resource') ':' EntOrTyps | 'context' ':' (Path | RecType)
+func (p *textParser) parseAppliesTo(namespace string) *JsonAppliesTo {
+	applies := &JsonAppliesTo{}
+	p.expect(token.LBRACE)
+	for p.tok != token.RBRACE {
+		switch p.tok {
+		case token.PRINCIPAL:
+			p.next()
+			p.expect(token.COLON)
+			applies.PrincipalTypes = p.parseTypeList()
+		case token.RESOURCE:
+			p.next()
+			p.expect(token.COLON)
+			applies.ResourceTypes = p.parseTypeList()
+		case token.CONTEXT:
+			p.next()
+			p.expect(token.COLON)
+			p.later(namespace, p.parseType(), func(shape JsonEntityShape) {
+				applies.Context = &shape
+			})
+		default:
+			p.errorExpected("'principal', 'resource' or 'context'")
+		}
+		if p.tok != token.COMMA {
+			break
+		}
+		p.next()
+	}
+	p.expect(token.RBRACE)
+
+	return applies
+}
+
+// RecType ::= '{' [AttrDecls] '}'
+func (p *textParser) parseRecord() *textType {
+	kind := &textType{record: true}
+	seen := map[string]bool{}
+
+	p.expect(token.LBRACE)
+	for p.tok != token.RBRACE {
+		p.skipAnnotations()
+		pos := p.pos
+		attr := textAttr{name: p.parseName(), required: true}
+		if p.tok == token.IDENTIFER && p.lit == "?" {
+			attr.required = false
+			p.next()
+		}
+		p.expect(token.COLON)
+		attr.kind = p.parseType()
+		if seen[attr.name] {
+			p.error(pos, fmt.Sprintf("duplicate attribute %s", attr.name))
+		}
+		seen[attr.name] = true
+		kind.attrs = append(kind.attrs, attr)
+
+		if p.tok != token.COMMA {
+			break
+		}
+		p.next()
+	}
+	p.expect(token.RBRACE)
+
+	return kind
+}
+
+// Type ::= Path | 'Set' '<' Type '>' | RecType
+func (p *textParser) parseType() *textType {
+	if p.tok == token.LBRACE {
+		return p.parseRecord()
+	}
+
+	name := p.parsePath()
+	if name == "Set" && p.tok == token.LSS {
+		p.next()
+		elem := p.parseType()
+		p.expect(token.GTR)
+		return &textType{name: name, element: elem}
+	}
+
+	return &textType{name: name}
+}
+
+// later queues the conversion of a parsed type until the end of the parse
+func (p *textParser) later(namespace string, kind *textType, assign func(JsonEntityShape)) {
+	p.pending = append(p.pending, pendingShape{namespace: namespace, kind: kind, assign: assign})
+}
+
+// resolve converts the parsed types now that all declarations are known
+func (p *textParser) resolve() {
+	for _, item := range p.pending {
+		item.assign(p.convert(item.namespace, item.kind))
+	}
+}
+
+func (p *textParser) convert(namespace string, kind *textType) JsonEntityShape {
+	shape := JsonEntityShape{Required: true}
+
+	if kind.record {
+		shape.Type = "Record"
+		shape.Attributes = map[string]JsonEntityShape{}
+		for _, attr := range kind.attrs {
+			value := p.convert(namespace, attr.kind)
+			value.Required = attr.required
+			shape.Attributes[attr.name] = value
+		}
+		return shape
+	}
+	if kind.element != nil {
+		elem := p.convert(namespace, kind.element)
+		shape.Type = "Set"
+		shape.Element = &elem
+		return shape
+	}
+
+	name := strings.TrimPrefix(kind.name, "__cedar::")
+	if _, found := p.output[namespace].CommonTypes[kind.name]; found {
+		shape.Type = kind.name
+	} else if prim, found := primitiveTypes[name]; found {
+		shape.Type = prim
+	} else if extensionTypes[name] {
+		shape.Type = "Extension"
+		shape.Name = &name
+	} else {
+		// A common type of another namespace or an entity type, which is
+		// decided once all of the namespaces are known
+		ref := kind.name
+		shape.Type = "EntityOrCommon"
+		shape.Name = &ref
+	}
+
+	return shape
+}
+
+// ParseText parses a schema in the Cedar human-readable format and
+// returns the equivalent JSON schema definition.
+func ParseText(filename string, src []byte) (schema JsonSchema, err error) {
+	var p textParser
+
+	defer func() {
+		if e := recover(); e != nil {
+			// resume same panic if it's not a bailout
+			if _, ok := e.(textBailout); !ok {
+				panic(e)
+			}
+		}
+		if len(p.errors) != 0 {
+			schema = nil
+			err = p.errors.Err()
+		}
+	}()
+
+	p.init(filename, src)
+	p.parseSchema()
+	p.resolve()
+
+	return p.output, nil
+}
+
+// NewFromText reads a schema in the Cedar human-readable format (cedarschema)
+func NewFromText(reader io.Reader) (*Schema, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	jschema, err := ParseText("", data)
+	if err != nil {
+		return nil, err
+	}
+	if err := jschema.VerifyConsistency(); err != nil {
+		return nil, err
+	}
+
+	return processSchema(&jschema)
+}
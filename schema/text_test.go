@@ -0,0 +1,108 @@
+package schema_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const photoTextSchema = `
+// The photo sharing application
+namespace PhotoApp {
+	type Address = { street: String, zip?: String };
+
+	entity Group;
+	entity User in [Group] {
+		name: String,
+		address: Address,
+		roles: Set<String>,
+	};
+	entity Photo in Album = { owner: User, private: Bool };
+	entity Album;
+
+	action "view", comment appliesTo {
+		principal: [User],
+		resource: Photo,
+		context: { ip: ipaddr, authenticated: Bool },
+	};
+	action delete in [view] appliesTo { principal: User, resource: [Photo, Album] };
+}
+`
+
+func TestTextSchema(t *testing.T) {
+	s, err := schema.NewFromText(strings.NewReader(photoTextSchema))
+	require.NoError(t, err)
+
+	assert.Len(t, s.EntityTypes, 4)
+	user := s.EntityTypes["PhotoApp::User"]
+	require.NotNil(t, user)
+	assert.Equal(t, []string{"PhotoApp::Group"}, user.MemberOfTypes)
+	assert.Equal(t, schema.SHAPE_RECORD, user.Shape.Attributes["address"].Type)
+	assert.False(t, user.Shape.Attributes["address"].Attributes["zip"].Required)
+	assert.Equal(t, schema.SHAPE_SET, user.Shape.Attributes["roles"].Type)
+
+	photo := s.EntityTypes["PhotoApp::Photo"]
+	require.NotNil(t, photo)
+	assert.Equal(t, schema.SHAPE_ENTITY, photo.Shape.Attributes["owner"].Type)
+	assert.Equal(t, "PhotoApp::User", photo.Shape.Attributes["owner"].Name)
+
+	view := s.LookupAction(engine.NewEntityValue("PhotoApp::Action", "view"))
+	require.NotNil(t, view)
+	assert.True(t, view.PrincipalTypes["PhotoApp::User"])
+	assert.Equal(t, schema.SHAPE_EXTENSION, view.Context.Attributes["ip"].Type)
+
+	assert.True(t, s.IsActionIn(
+		engine.NewEntityValue("PhotoApp::Action", "delete"),
+		engine.NewEntityValue("PhotoApp::Action", "view"),
+	))
+}
+
+func TestTextSchemaTags(t *testing.T) {
+	s, err := schema.NewFromText(strings.NewReader(`
+	namespace App {
+		entity User { name: String } tags Set<String>;
+		entity Team tags String;
+		entity Doc;
+	}
+	`))
+	require.NoError(t, err)
+
+	tags := s.TagType("App::User")
+	require.NotNil(t, tags)
+	assert.Equal(t, schema.SHAPE_SET, tags.Type)
+	assert.Equal(t, schema.SHAPE_STRING, tags.Element.Type)
+	assert.Equal(t, schema.SHAPE_STRING, s.TagType("App::Team").Type)
+	assert.Nil(t, s.TagType("App::Doc"))
+
+	s, err = schema.NewFromJson(strings.NewReader(`{
+		"": { "entityTypes": { "User": { "tags": { "type": "Long" } } }, "actions": {} }
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, schema.SHAPE_LONG, s.TagType("User").Type)
+
+	_, err = schema.NewFromJson(strings.NewReader(`{
+		"": { "entityTypes": { "User": { "tags": { "type": "Unknown" } } }, "actions": {} }
+	}`))
+	assert.ErrorIs(t, err, schema.ErrInvalidSchema)
+}
+
+func TestTextSchemaErrors(t *testing.T) {
+	cases := []string{
+		`entity User`,
+		`entity User; entity User;`,
+		`action view appliesTo { owner: User };`,
+		`type = String;`,
+	}
+
+	for _, item := range cases {
+		_, err := schema.NewFromText(strings.NewReader(item))
+		assert.Error(t, err, item)
+	}
+
+	_, err := schema.ParseText("schema.cedarschema", []byte("entity User {\n  name String };"))
+	assert.ErrorContains(t, err, "schema.cedarschema:2:8")
+}
@@ -11,11 +11,15 @@ type JsonEntityShape struct {
 	Name *string `json:"name"`
 	// Set type (required)
 	Element *JsonEntityShape `json:"element"`
+	// Record type, false rejects the attributes which aren't declared
+	AdditionalAttributes *bool `json:"additionalAttributes,omitempty"`
 }
 
 type JsonEntityType struct {
 	MemberOfTypes []string        `json:"memberOfTypes"`
 	Shape         JsonEntityShape `json:"shape"`
+	// Tags is the type of the values of the entity tags, nil without tags
+	Tags *JsonEntityShape `json:"tags,omitempty"`
 }
 
 type JsonEntityTypes map[string]JsonEntityType
@@ -23,7 +27,7 @@ type JsonEntityTypes map[string]JsonEntityType
 // Action
 type JsonMemberOf struct {
 	Id   string `json:"id"`
-	Type string `json:"type"`
+	Type string `json:"type,omitempty"`
 }
 
 type JsonAppliesTo struct {
@@ -33,8 +37,8 @@ type JsonAppliesTo struct {
 }
 
 type JsonAction struct {
-	MemberOf  []JsonMemberOf `json:"memberOf"`
-	AppliesTo *JsonAppliesTo `json:"appliesTo"`
+	MemberOf  []JsonMemberOf `json:"memberOf,omitempty"`
+	AppliesTo *JsonAppliesTo `json:"appliesTo,omitempty"`
 }
 
 type JsonActions map[string]JsonAction
@@ -60,6 +64,8 @@ func (es *JsonEntityShape) UnmarshalJSON(data []byte) error {
 		Name *string `json:"name"`
 		// Set type (required)
 		Element *JsonEntityShape `json:"element"`
+		// Record type
+		AdditionalAttributes *bool `json:"additionalAttributes,omitempty"`
 	}
 
 	entry := entityShape{
@@ -88,6 +94,24 @@ const (
 	SHAPE_RECORD    ShapeType = iota
 )
 
+var shapeTypeNames = map[ShapeType]string{
+	SHAPE_BOOL:      "Boolean",
+	SHAPE_LONG:      "Long",
+	SHAPE_STRING:    "String",
+	SHAPE_ENTITY:    "Entity",
+	SHAPE_SET:       "Set",
+	SHAPE_EXTENSION: "Extension",
+	SHAPE_RECORD:    "Record",
+}
+
+// String returns the name of the type in the JSON schema format
+func (t ShapeType) String() string {
+	if name, found := shapeTypeNames[t]; found {
+		return name
+	}
+	return "Invalid"
+}
+
 type EntityShape struct {
 	Type     ShapeType `json:"type"`
 	Required bool      `json:"required"`
@@ -97,11 +121,16 @@ type EntityShape struct {
 	Name string
 	// Set type (required)
 	Element *EntityShape `json:"element"`
+	// AdditionalAttributes permits the attributes of a record which aren't
+	// declared, it is only true when the schema says so as in Cedar
+	AdditionalAttributes bool `json:"additionalAttributes"`
 }
 
 type EntityType struct {
 	MemberOfTypes []string     `json:"memberOfTypes"`
 	Shape         *EntityShape `json:"shape"`
+	// Tags is the type of the values of the entity tags, nil without tags
+	Tags *EntityShape `json:"tags,omitempty"`
 }
 
 type MemberOf struct {
@@ -0,0 +1,244 @@
+// Package sqlstore is an engine.Store which loads the attributes and parents
+// of entities from an SQL database as the policies reference them.
+//
+// The queries are configurable so the store can be fitted to an existing
+// database, by default it expects the tables:
+//
+//	CREATE TABLE entities (type TEXT, id TEXT, attrs TEXT, PRIMARY KEY (type, id));
+//	CREATE TABLE entity_parents (type TEXT, id TEXT, parent_type TEXT, parent_id TEXT);
+//
+// where attrs holds the attributes as a JSON object in the entities format.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+)
+
+// Queries are the statements used to load the entities, each is given the
+// entity type and id as its two parameters.
+type Queries struct {
+	// Attributes selects a single row with a single column holding the
+	// attributes of the entity as a JSON object
+	Attributes string
+	// Parents selects a row with the type and id of each direct parent
+	Parents string
+}
+
+// DefaultQueries are the queries for the tables described by the package
+// documentation, using ? placeholders
+var DefaultQueries = Queries{
+	Attributes: "SELECT attrs FROM entities WHERE type = ? AND id = ?",
+	Parents:    "SELECT parent_type, parent_id FROM entity_parents WHERE type = ? AND id = ?",
+}
+
+// Store loads entities with prepared statements, it is safe for concurrent
+// use. See Cached for reusing the entities loaded while serving a request.
+type Store struct {
+	schema     *schema.Schema
+	attributes *sql.Stmt
+	parents    *sql.Stmt
+}
+
+var _ engine.Store = (*Store)(nil)
+
+// Option configures the store
+type Option func(*Store)
+
+// WithSchema decodes the attributes with the shapes of the entity types
+func WithSchema(sdef *schema.Schema) Option {
+	return func(s *Store) {
+		s.schema = sdef
+	}
+}
+
+// New prepares the queries, Close releases the statements
+func New(ctx context.Context, db *sql.DB, queries Queries, options ...Option) (*Store, error) {
+	store := Store{schema: schema.NewEmptySchema()}
+	for _, opt := range options {
+		opt(&store)
+	}
+
+	var err error
+	if store.attributes, err = db.PrepareContext(ctx, queries.Attributes); err != nil {
+		return nil, fmt.Errorf("unable to prepare attributes query: %w", err)
+	}
+	if store.parents, err = db.PrepareContext(ctx, queries.Parents); err != nil {
+		store.attributes.Close()
+		return nil, fmt.Errorf("unable to prepare parents query: %w", err)
+	}
+
+	return &store, nil
+}
+
+// Close releases the prepared statements
+func (s *Store) Close() error {
+	return errors.Join(s.attributes.Close(), s.parents.Close())
+}
+
+func (s *Store) Get(key engine.EntityValue, attr string) (engine.EvalValue, error) {
+	values, err := s.load(key)
+	if err != nil {
+		return nil, err
+	}
+	return lookup(values, attr, s)
+}
+
+func (s *Store) GetParents(key engine.EntityValue) ([]engine.EntityValue, error) {
+	return ancestors(key, s.directParents)
+}
+
+// Cached returns a view of the store which keeps every entity it loads, so
+// attributes and parents are only queried once. The view is meant to live for
+// a single request, it never sees later changes to the database.
+func (s *Store) Cached() engine.Store {
+	return &cachedStore{
+		store:   s,
+		values:  map[string]cachedValues{},
+		parents: map[string]cachedParents{},
+	}
+}
+
+// load queries the attributes of the entity, nil if it doesn't exist
+func (s *Store) load(key engine.EntityValue) (*engine.VarValue, error) {
+	if key.IsZero() {
+		return nil, nil
+	}
+
+	var data sql.NullString
+	err := s.attributes.QueryRow(key.EntityType(), key.EntityId()).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to load attributes: %w", key.String(), err)
+	}
+
+	return s.schema.DecodeAttributes(key, []byte(data.String))
+}
+
+// directParents queries the parents of the entity
+func (s *Store) directParents(key engine.EntityValue) ([]engine.EntityValue, error) {
+	if key.IsZero() {
+		return nil, nil
+	}
+
+	rows, err := s.parents.Query(key.EntityType(), key.EntityId())
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to load parents: %w", key.String(), err)
+	}
+	defer rows.Close()
+
+	output := []engine.EntityValue{}
+	for rows.Next() {
+		var kind, id string
+		if err := rows.Scan(&kind, &id); err != nil {
+			return nil, fmt.Errorf("%s: unable to load parents: %w", key.String(), err)
+		}
+		output = append(output, engine.NewEntityValue(kind, id))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: unable to load parents: %w", key.String(), err)
+	}
+	// the rows are in no particular order without an ORDER BY
+	sort.Slice(output, func(i, j int) bool { return output[i].String() < output[j].String() })
+	return output, nil
+}
+
+// lookup returns the attribute of the entity in the same way as
+// schema.EntityStore
+func lookup(values *engine.VarValue, attr string, store engine.Store) (engine.EvalValue, error) {
+	if values == nil {
+		return nil, engine.ErrValueNotFound
+	}
+	return values.OpLookup(engine.StrValue(attr), store)
+}
+
+// ancestors walks the parents breadth first, the entity itself is left out
+// as with schema.EntityStore
+func ancestors(key engine.EntityValue, direct func(engine.EntityValue) ([]engine.EntityValue, error)) ([]engine.EntityValue, error) {
+	seen := map[string]bool{}
+	output := []engine.EntityValue{}
+	todo := []engine.EntityValue{key}
+
+	for len(todo) != 0 {
+		item := todo[0]
+		todo = todo[1:]
+		if seen[item.String()] {
+			continue
+		}
+		seen[item.String()] = true
+		output = append(output, item)
+
+		parents, err := direct(item)
+		if err != nil {
+			return nil, err
+		}
+		todo = append(todo, parents...)
+	}
+
+	return output[1:], nil
+}
+
+type cachedValues struct {
+	values *engine.VarValue
+	err    error
+}
+
+type cachedParents struct {
+	parents []engine.EntityValue
+	err     error
+}
+
+// cachedStore remembers the entities loaded from the store
+type cachedStore struct {
+	store   *Store
+	mu      sync.Mutex
+	values  map[string]cachedValues
+	parents map[string]cachedParents
+}
+
+func (c *cachedStore) Get(key engine.EntityValue, attr string) (engine.EvalValue, error) {
+	c.mu.Lock()
+	item, found := c.values[key.String()]
+	c.mu.Unlock()
+
+	if !found {
+		values, err := c.store.load(key)
+		item = cachedValues{values: values, err: err}
+
+		c.mu.Lock()
+		c.values[key.String()] = item
+		c.mu.Unlock()
+	}
+	if item.err != nil {
+		return nil, item.err
+	}
+	return lookup(item.values, attr, c)
+}
+
+func (c *cachedStore) GetParents(key engine.EntityValue) ([]engine.EntityValue, error) {
+	return ancestors(key, func(item engine.EntityValue) ([]engine.EntityValue, error) {
+		c.mu.Lock()
+		cached, found := c.parents[item.String()]
+		c.mu.Unlock()
+		if found {
+			return cached.parents, cached.err
+		}
+
+		parents, err := c.store.directParents(item)
+
+		c.mu.Lock()
+		c.parents[item.String()] = cachedParents{parents: parents, err: err}
+		c.mu.Unlock()
+
+		return parents, err
+	})
+}
@@ -0,0 +1,200 @@
+package sqlstore_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/schema"
+	"github.com/koblas/cedar-go/sqlstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDriver answers the default queries from fixed tables and counts the
+// queries made
+type fakeDriver struct {
+	attrs   map[string]string
+	parents map[string][][2]string
+	queries atomic.Int32
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{d}, nil
+}
+
+type fakeConn struct {
+	driver *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	if query != sqlstore.DefaultQueries.Attributes && query != sqlstore.DefaultQueries.Parents {
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+	return &fakeStmt{c.driver, query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions not supported")
+}
+
+type fakeStmt struct {
+	driver *fakeDriver
+	query  string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return 2
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("exec not supported")
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.driver.queries.Add(1)
+	key := fmt.Sprintf("%s::%s", args[0], args[1])
+
+	rows := &fakeRows{}
+	if s.query == sqlstore.DefaultQueries.Attributes {
+		rows.columns = []string{"attrs"}
+		if attrs, found := s.driver.attrs[key]; found {
+			rows.values = append(rows.values, []driver.Value{attrs})
+		}
+	} else {
+		rows.columns = []string{"parent_type", "parent_id"}
+		for _, parent := range s.driver.parents[key] {
+			rows.values = append(rows.values, []driver.Value{parent[0], parent[1]})
+		}
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+var fake = &fakeDriver{
+	attrs: map[string]string{
+		"User::alice":         `{"age": 42, "manager": {"__entity": {"type": "User", "id": "bob"}}}`,
+		"User::bob":           `{"age": 50}`,
+		"Photo::vacation.jpg": `{"owner": {"__entity": {"type": "User", "id": "alice"}}}`,
+	},
+	parents: map[string][][2]string{
+		"User::alice":  {{"Group", "staff"}},
+		"Group::staff": {{"Group", "everyone"}},
+	},
+}
+
+func init() {
+	sql.Register("sqlstore-fake", fake)
+}
+
+func newStore(t *testing.T) *sqlstore.Store {
+	db, err := sql.Open("sqlstore-fake", "")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	store, err := sqlstore.New(context.TODO(), db, sqlstore.DefaultQueries)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestStore(t *testing.T) {
+	store := newStore(t)
+	alice := engine.NewEntityValue("User", "alice")
+
+	value, err := store.Get(alice, "age")
+	require.NoError(t, err)
+	assert.Equal(t, engine.IntValue(42), value)
+	value, err = store.Get(alice, "manager")
+	require.NoError(t, err)
+	assert.Equal(t, engine.NewEntityValue("User", "bob"), value)
+
+	_, err = store.Get(engine.NewEntityValue("User", "carol"), "age")
+	assert.ErrorIs(t, err, engine.ErrValueNotFound)
+
+	parents, err := store.GetParents(alice)
+	require.NoError(t, err)
+	assert.Equal(t, []engine.EntityValue{
+		engine.NewEntityValue("Group", "staff"),
+		engine.NewEntityValue("Group", "everyone"),
+	}, parents)
+}
+
+func TestCachedStore(t *testing.T) {
+	policies, err := cedar.ParsePolicies(`
+	permit(principal in Group::"everyone", action, resource)
+		when { resource.owner == principal && principal.age > 18 && principal.manager.age > 18 };
+	`)
+	require.NoError(t, err)
+	store := newStore(t)
+
+	request := &cedar.Request{
+		Principal: cedar.NewEntity("User", "alice"),
+		Action:    cedar.NewEntity("Action", "view"),
+		Resource:  cedar.NewEntity("Photo", "vacation.jpg"),
+	}
+
+	cached := store.Cached()
+	auth := cedar.NewAuthorizer(policies, cedar.WithStore(cached))
+	before := fake.queries.Load()
+	for i := 0; i < 3; i++ {
+		ok, err := auth.IsAuthorized(context.TODO(), request)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	// three entities and three levels of the hierarchy are loaded once
+	assert.Equal(t, int32(6), fake.queries.Load()-before)
+
+	// A schema shapes the decoding of the attributes
+	sdef, err := schema.NewFromJson(strings.NewReader(`{"": {
+		"entityTypes": {"User": {"shape": {"type": "Record", "attributes": {
+			"age": {"type": "String"}
+		}}}},
+		"actions": {}
+	}}`))
+	require.NoError(t, err)
+	db, err := sql.Open("sqlstore-fake", "")
+	require.NoError(t, err)
+	defer db.Close()
+	shaped, err := sqlstore.New(context.TODO(), db, sqlstore.DefaultQueries, sqlstore.WithSchema(sdef))
+	require.NoError(t, err)
+	defer shaped.Close()
+	_, err = shaped.Get(engine.NewEntityValue("User", "bob"), "age")
+	assert.ErrorIs(t, err, schema.ErrInvalidEntityFormat)
+}
@@ -0,0 +1,197 @@
+package cedar
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/token"
+)
+
+// ChangeKind identifies what part of the authorizer changed
+type ChangeKind int
+
+const (
+	PoliciesChanged ChangeKind = iota
+	StoreChanged
+)
+
+// Change summarizes an update to the policies or entities of an authorizer
+type Change struct {
+	Kind ChangeKind
+	// Policy ids that were added, removed or kept with a new body by
+	// SetPolicies
+	Added    []string
+	Removed  []string
+	Modified []string
+	// Entities updated within the store, empty when the store was replaced
+	Entities []engine.EntityValue
+}
+
+type subscriber struct {
+	id int
+	fn func(Change)
+}
+
+// subscribers is the list of callbacks to notify of changes, in the order
+// they subscribed.
+type subscribers struct {
+	mu    sync.Mutex
+	next  int
+	items []subscriber
+}
+
+func (s *subscribers) add(fn func(Change)) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.next
+	s.next += 1
+	s.items = append(s.items, subscriber{id: id, fn: fn})
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		for i, item := range s.items {
+			if item.id == id {
+				s.items = append(s.items[:i:i], s.items[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (s *subscribers) publish(change Change) {
+	s.mu.Lock()
+	items := s.items
+	s.mu.Unlock()
+
+	for _, item := range items {
+		item.fn(change)
+	}
+}
+
+// Subscribe registers fn to be called after the policies or store are
+// replaced, or the store reports an update. The returned function cancels
+// the subscription.
+func (auth *SchemaAuthorizer) Subscribe(fn func(Change)) (cancel func()) {
+	return auth.subs.add(fn)
+}
+
+// onChange drops the decisions made with the previous policies or entities
+func (auth *SchemaAuthorizer) onChange(change Change) {
+	auth.InvalidateCache()
+}
+
+// watchStore subscribes to updates of the current store, if it reports
+// them. It's called with auth.mu held.
+func (auth *SchemaAuthorizer) watchStore() {
+	if auth.unwatch != nil {
+		auth.unwatch()
+		auth.unwatch = nil
+	}
+	if notifier, ok := auth.Store.(engine.StoreNotifier); ok {
+		auth.unwatch = notifier.Subscribe(func(changed []engine.EntityValue) {
+			auth.subs.publish(Change{Kind: StoreChanged, Entities: changed})
+		})
+	}
+}
+
+// policyChanges lists the ids of the policies added, removed and modified
+func policyChanges(before, after engine.PolicyList) Change {
+	change := Change{Kind: PoliciesChanged}
+
+	seen := map[string]*engine.Policy{}
+	for _, item := range before {
+		seen[item.Id] = item
+	}
+	for _, item := range after {
+		prev, found := seen[item.Id]
+		if !found {
+			change.Added = append(change.Added, item.Id)
+		} else if !samePolicy(prev, item) {
+			change.Modified = append(change.Modified, item.Id)
+		}
+		delete(seen, item.Id)
+	}
+	for _, item := range before {
+		if _, found := seen[item.Id]; found {
+			change.Removed = append(change.Removed, item.Id)
+		}
+	}
+
+	return change
+}
+
+var (
+	positionType   = reflect.TypeOf(token.Position{})
+	provenanceType = reflect.TypeOf(engine.Provenance{})
+)
+
+// samePolicy compares the content of the policies, where they are in the
+// source and their provenance don't make a policy different
+func samePolicy(a, b *engine.Policy) bool {
+	return sameNode(reflect.ValueOf(a), reflect.ValueOf(b))
+}
+
+// sameNode is reflect.DeepEqual of the policy nodes without the positions,
+// the values are read directly as the nodes have unexported fields
+func sameNode(a, b reflect.Value) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return sameNode(a.Elem(), b.Elem())
+	case reflect.Struct:
+		if a.Type() == positionType || a.Type() == provenanceType {
+			return true
+		}
+		for i := 0; i < a.NumField(); i++ {
+			if !sameNode(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !sameNode(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		iter := a.MapRange()
+		for iter.Next() {
+			value := b.MapIndex(iter.Key())
+			if !value.IsValid() || !sameNode(iter.Value(), value) {
+				return false
+			}
+		}
+		return true
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() == b.Float()
+	case reflect.String:
+		return a.String() == b.String()
+	}
+
+	// Functions and channels are only the same when neither is set
+	return a.IsZero() && b.IsZero()
+}
@@ -0,0 +1,170 @@
+package cedar_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/engine"
+	"github.com/koblas/cedar-go/policystore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// notifyingStore is a countingStore which reports updates to subscribers
+type notifyingStore struct {
+	countingStore
+	subscribers []func([]engine.EntityValue)
+}
+
+func (s *notifyingStore) Subscribe(fn func([]engine.EntityValue)) func() {
+	s.subscribers = append(s.subscribers, fn)
+	return func() { s.subscribers = nil }
+}
+
+func (s *notifyingStore) update(entities ...engine.EntityValue) {
+	for _, fn := range s.subscribers {
+		fn(entities)
+	}
+}
+
+func TestSubscribePolicies(t *testing.T) {
+	before, err := cedar.ParsePolicies(`
+	@id("a") permit(principal, action, resource);
+	@id("b") permit(principal, action, resource);
+	`)
+	require.NoError(t, err)
+	after, err := cedar.ParsePolicies(`
+	@id("b") permit(principal, action, resource);
+	@id("c") forbid(principal, action, resource);
+	`)
+	require.NoError(t, err)
+
+	auth := cedar.NewAuthorizer(before)
+	changes := []cedar.Change{}
+	cancel := auth.Subscribe(func(change cedar.Change) {
+		changes = append(changes, change)
+	})
+
+	auth.SetPolicies(after)
+	require.Len(t, changes, 1)
+	assert.Equal(t, cedar.PoliciesChanged, changes[0].Kind)
+	assert.Equal(t, []string{"c"}, changes[0].Added)
+	assert.Equal(t, []string{"a"}, changes[0].Removed)
+	assert.Empty(t, changes[0].Modified)
+
+	// The index follows the new policies
+	result, err := auth.IsAuthorized(context.TODO(), &cedar.Request{
+		Principal: cedar.NewEntity("User", "alice"),
+		Action:    cedar.NewEntity("Action", "view"),
+		Resource:  cedar.NewEntity("Photo", "vacation.jpg"),
+	})
+	require.NoError(t, err)
+	assert.False(t, result)
+
+	cancel()
+	auth.SetPolicies(before)
+	assert.Len(t, changes, 1)
+}
+
+func TestSubscribeModifiedPolicies(t *testing.T) {
+	before, err := cedar.ParsePolicies(`
+	@id("a") permit(principal, action, resource) when { context.x == 1 };
+	@id("b") permit(principal, action, resource) when { context.x == 1 };
+	@id("c") permit(principal, action, resource) when { context.x == 1 };
+	@id("d") permit(principal, action == Action::"view", resource);
+	`)
+	require.NoError(t, err)
+	// a only moves, b changes its condition, c its effect and d its scope
+	after, err := cedar.ParsePolicies(`
+
+	@id("a")
+	permit(principal, action, resource) when { context.x == 1 };
+	@id("b") permit(principal, action, resource) when { context.x == 2 };
+	@id("c") forbid(principal, action, resource) when { context.x == 1 };
+	@id("d") permit(principal, action == Action::"edit", resource);
+	`)
+	require.NoError(t, err)
+
+	auth := cedar.NewAuthorizer(before)
+	changes := []cedar.Change{}
+	auth.Subscribe(func(change cedar.Change) {
+		changes = append(changes, change)
+	})
+
+	auth.SetPolicies(after)
+	require.Len(t, changes, 1)
+	assert.Empty(t, changes[0].Added)
+	assert.Empty(t, changes[0].Removed)
+	assert.Equal(t, []string{"b", "c", "d"}, changes[0].Modified)
+}
+
+func TestSubscribeStore(t *testing.T) {
+	policies, err := cedar.ParsePolicies(`permit(principal, action, resource) when { principal.active };`)
+	require.NoError(t, err)
+
+	store := &notifyingStore{}
+	auth := cedar.NewAuthorizer(policies,
+		cedar.WithStore(store),
+		cedar.WithDecisionCache(10, time.Minute),
+	)
+	changes := []cedar.Change{}
+	auth.Subscribe(func(change cedar.Change) {
+		changes = append(changes, change)
+	})
+
+	req := cedar.Request{
+		Principal: cedar.NewEntity("User", "alice"),
+		Action:    cedar.NewEntity("Action", "view"),
+		Resource:  cedar.NewEntity("Photo", "vacation.jpg"),
+	}
+	for i := 0; i < 2; i++ {
+		_, err = auth.IsAuthorized(context.TODO(), &req)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, store.gets)
+
+	// An update from the store drops the cached decisions
+	store.update(req.Principal)
+	require.Len(t, changes, 1)
+	assert.Equal(t, cedar.StoreChanged, changes[0].Kind)
+	assert.Equal(t, []engine.EntityValue{req.Principal}, changes[0].Entities)
+
+	_, err = auth.IsAuthorized(context.TODO(), &req)
+	require.NoError(t, err)
+	assert.Equal(t, 2, store.gets)
+
+	// Replacing the store stops listening to the old one
+	auth.SetStore(&countingStore{})
+	assert.Empty(t, store.subscribers)
+	assert.Len(t, changes, 2)
+}
+
+func TestLoadPolicies(t *testing.T) {
+	ctx := context.TODO()
+	store := policystore.NewMemoryStore()
+	require.NoError(t, store.Put(ctx, "deny", `forbid(principal, action, resource);`))
+
+	auth := cedar.NewAuthorizer(engine.PolicyList{})
+	cancel := store.Watch(func() {
+		require.NoError(t, auth.LoadPolicies(ctx, store))
+	})
+	defer cancel()
+	require.NoError(t, auth.LoadPolicies(ctx, store))
+
+	request := &cedar.Request{
+		Principal: cedar.NewEntity("User", "alice"),
+		Action:    cedar.NewEntity("Action", "view"),
+		Resource:  cedar.NewEntity("Photo", "vacation.jpg"),
+	}
+	detail, err := auth.IsAuthorizedDetail(ctx, request)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"deny"}, detail.Diagnostics.Forbids)
+
+	require.NoError(t, store.Delete(ctx, "deny"))
+	require.NoError(t, store.Put(ctx, "allow", `permit(principal, action, resource);`))
+	result, err := auth.IsAuthorized(ctx, request)
+	require.NoError(t, err)
+	assert.True(t, result)
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
 // -----------------------------------------------------------------------------
@@ -97,6 +99,7 @@ type File struct {
 	size int    // file size as provided to AddFile
 
 	// lines and infos are protected by mutex
+	mutex sync.Mutex
 	lines []int // lines contains the offset of the first character for each line (the first entry is always 0)
 	infos []lineInfo
 }
@@ -118,7 +121,9 @@ func (f *File) Size() int {
 
 // LineCount returns the number of lines in file f.
 func (f *File) LineCount() int {
+	f.mutex.Lock()
 	n := len(f.lines)
+	f.mutex.Unlock()
 	return n
 }
 
@@ -126,6 +131,8 @@ func (f *File) LineCount() int {
 // The line offset must be larger than the offset for the previous line
 // and smaller than the file size; otherwise the line offset is ignored.
 func (f *File) AddLine(offset int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
 	if i := len(f.lines); (i == 0 || f.lines[i-1] < offset) && offset < f.size {
 		f.lines = append(f.lines, offset)
 	}
@@ -139,6 +146,8 @@ func (f *File) MergeLine(line int) {
 	if line < 1 {
 		panic(fmt.Sprintf("invalid line number %d (should be >= 1)", line))
 	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
 	if line >= len(f.lines) {
 		panic(fmt.Sprintf("invalid line number %d (should be < %d)", line, len(f.lines)))
 	}
@@ -154,7 +163,9 @@ func (f *File) MergeLine(line int) {
 // Lines returns the effective line offset table of the form described by [File.SetLines].
 // Callers must not mutate the result.
 func (f *File) Lines() []int {
+	f.mutex.Lock()
 	lines := f.lines
+	f.mutex.Unlock()
 	return lines
 }
 
@@ -176,7 +187,9 @@ func (f *File) SetLines(lines []int) bool {
 	}
 
 	// set lines table
+	f.mutex.Lock()
 	f.lines = lines
+	f.mutex.Unlock()
 	return true
 }
 
@@ -196,7 +209,9 @@ func (f *File) SetLinesForContent(content []byte) {
 	}
 
 	// set lines table
+	f.mutex.Lock()
 	f.lines = lines
+	f.mutex.Unlock()
 }
 
 // LineStart returns the [Pos] value of the start of the specified line.
@@ -206,6 +221,8 @@ func (f *File) LineStart(line int) Pos {
 	if line < 1 {
 		panic(fmt.Sprintf("invalid line number %d (should be >= 1)", line))
 	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
 	if line > len(f.lines) {
 		panic(fmt.Sprintf("invalid line number %d (should be < %d)", line, len(f.lines)))
 	}
@@ -237,6 +254,8 @@ func (f *File) AddLineInfo(offset int, filename string, line int) {
 // AddLineColumnInfo is typically used to register alternative position
 // information for line directives such as //line filename:line:column.
 func (f *File) AddLineColumnInfo(offset int, filename string, line, column int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
 	if i := len(f.infos); (i == 0 || f.infos[i-1].Offset < offset) && offset < f.size {
 		f.infos = append(f.infos, lineInfo{offset, filename, line, column})
 	}
@@ -276,6 +295,7 @@ func searchLineInfos(a []lineInfo, x int) int {
 // If adjusted is set, unpack will return the filename and line information
 // possibly adjusted by //line comments; otherwise those comments are ignored.
 func (f *File) unpack(offset int, adjusted bool) (filename string, line, column int) {
+	f.mutex.Lock()
 	filename = f.name
 	if i := searchInts(f.lines, offset); i >= 0 {
 		line, column = i+1, offset-f.lines[i]+1
@@ -305,6 +325,7 @@ func (f *File) unpack(offset int, adjusted bool) (filename string, line, column
 	}
 	// TODO(mvdan): move Unlock back under Lock with a defer statement once
 	// https://go.dev/issue/38471 is fixed to remove the performance penalty.
+	f.mutex.Unlock()
 	return
 }
 
@@ -361,9 +382,10 @@ func (f *File) Position(p Pos) (pos Position) {
 // A [File] may be removed from a FileSet when it is no longer needed.
 // This may reduce memory usage in a long-running application.
 type FileSet struct {
-	base  int     // base offset for the next file
-	files []*File // list of files in the order added to the set
-	last  *File   // cache of last file looked up
+	mutex sync.RWMutex         // protects the file set
+	base  int                  // base offset for the next file
+	files []*File              // list of files in the order added to the set
+	last  atomic.Pointer[File] // cache of last file looked up
 }
 
 // NewFileSet creates a new file set.
@@ -376,7 +398,9 @@ func NewFileSet() *FileSet {
 // Base returns the minimum base offset that must be provided to
 // [FileSet.AddFile] when adding the next file.
 func (s *FileSet) Base() int {
+	s.mutex.RLock()
 	b := s.base
+	s.mutex.RUnlock()
 	return b
 }
 
@@ -399,6 +423,8 @@ func (s *FileSet) AddFile(filename string, base, size int) *File {
 	// Allocate f outside the critical section.
 	f := &File{name: filename, size: size, lines: []int{0}}
 
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	if base < 0 {
 		base = s.base
 	}
@@ -417,7 +443,7 @@ func (s *FileSet) AddFile(filename string, base, size int) *File {
 	// add the file to the file set
 	s.base = base
 	s.files = append(s.files, f)
-	s.last = f
+	s.last.Store(f)
 	return f
 }
 
@@ -428,9 +454,10 @@ func (s *FileSet) AddFile(filename string, base, size int) *File {
 //
 // Removing a file that does not belong to the set has no effect.
 func (s *FileSet) RemoveFile(file *File) {
-	if s.last == file {
-		s.last = nil
-	}
+	s.last.CompareAndSwap(file, nil) // clear last file cache
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
 	if i := searchFiles(s.files, file.base); i >= 0 && s.files[i] == file {
 		last := &s.files[len(s.files)-1]
@@ -444,9 +471,11 @@ func (s *FileSet) RemoveFile(file *File) {
 func (s *FileSet) Iterate(f func(*File) bool) {
 	for i := 0; ; i++ {
 		var file *File
+		s.mutex.RLock()
 		if i < len(s.files) {
 			file = s.files[i]
 		}
+		s.mutex.RUnlock()
 		if file == nil || !f(file) {
 			break
 		}
@@ -459,10 +488,13 @@ func searchFiles(a []*File, x int) int {
 
 func (s *FileSet) file(p Pos) *File {
 	// common case: p is in last file.
-	if f := s.last; f != nil && f.base <= int(p) && int(p) <= f.base+f.size {
+	if f := s.last.Load(); f != nil && f.base <= int(p) && int(p) <= f.base+f.size {
 		return f
 	}
 
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
 	// p is not in last file - search all files
 	if i := searchFiles(s.files, int(p)); i >= 0 {
 		f := s.files[i]
@@ -470,7 +502,7 @@ func (s *FileSet) file(p Pos) *File {
 		if int(p) <= f.base+f.size {
 			// Update cache of last file. A race is ok,
 			// but an exclusive lock causes heavy contention.
-			s.last = f
+			s.last.Store(f)
 			return f
 		}
 	}
@@ -25,6 +25,7 @@ func (s *FileSet) Read(decode func(any) error) error {
 		return err
 	}
 
+	s.mutex.Lock()
 	s.base = ss.Base
 	files := make([]*File, len(ss.Files))
 	for i := 0; i < len(ss.Files); i++ {
@@ -38,7 +39,8 @@ func (s *FileSet) Read(decode func(any) error) error {
 		}
 	}
 	s.files = files
-	s.last = nil
+	s.last.Store(nil)
+	s.mutex.Unlock()
 
 	return nil
 }
@@ -47,9 +49,11 @@ func (s *FileSet) Read(decode func(any) error) error {
 func (s *FileSet) Write(encode func(any) error) error {
 	var ss serializedFileSet
 
+	s.mutex.Lock()
 	ss.Base = s.base
 	files := make([]serializedFile, len(s.files))
 	for i, f := range s.files {
+		f.mutex.Lock()
 		files[i] = serializedFile{
 			Name:  f.name,
 			Base:  f.base,
@@ -57,8 +61,10 @@ func (s *FileSet) Write(encode func(any) error) error {
 			Lines: append([]int(nil), f.lines...),
 			Infos: append([]lineInfo(nil), f.infos...),
 		}
+		f.mutex.Unlock()
 	}
 	ss.Files = files
+	s.mutex.Unlock()
 
 	return encode(ss)
 }
@@ -208,6 +208,19 @@ func IsKeyword(name string) bool {
 	return ok
 }
 
+// reserved are the words which can't be an identifier in Cedar, even where a
+// keyword such as `principal` can
+var reserved = map[string]bool{
+	"true": true, "false": true, "if": true, "then": true, "else": true,
+	"in": true, "is": true, "like": true, "has": true, "__cedar": true,
+}
+
+// IsReserved reports whether name is a reserved word of Cedar, such as "if"
+// or "has", which can't be an attribute name after `.` or `has`.
+func IsReserved(name string) bool {
+	return reserved[name]
+}
+
 // IsIdentifier reports whether name is a Go identifier, that is, a non-empty
 // string made up of letters, digits, and underscores, where the first character
 // is not a digit. Keywords are not identifiers.
@@ -0,0 +1,69 @@
+package cedar
+
+import (
+	"runtime/debug"
+
+	"github.com/koblas/cedar-go/parser"
+)
+
+// moduleVersion is the release of this module, used when the build
+// information isn't available (e.g. running the tests of this module)
+const moduleVersion = "0.1.0" // x-release-please-version
+
+const modulePath = "github.com/koblas/cedar-go"
+
+// languageVersions are the versions of the Cedar policy language specification
+// supported by the engine, it follows the specification rather than the
+// releases of this module so is updated with the language support and the
+// integration tests. 4.1 added entity tags and 4.2 the isEmpty method.
+var languageVersions = []string{"4.2"}
+
+// VersionInfo describes the engine that produced a decision, intended to be
+// included in audit logs and debugging endpoints.
+type VersionInfo struct {
+	// Module is the version of this Go module (e.g. "v0.1.0")
+	Module string `json:"module"`
+	// Language are the supported Cedar language versions
+	Language []string `json:"language"`
+	// Flags are the enabled compatibility flags, the behaviours which differ
+	// from the Cedar language, see parser.CompatibilityFlags
+	Flags []string `json:"flags"`
+}
+
+// Version returns the build metadata of the engine, the options are those
+// the policies are parsed with
+func Version(opts ...parser.Option) VersionInfo {
+	info := VersionInfo{
+		Module:   "v" + moduleVersion,
+		Language: append([]string{}, languageVersions...),
+		Flags:    parser.CompatibilityFlags(opts...),
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if version := buildVersion(build); version != "" {
+			info.Module = version
+		}
+	}
+
+	return info
+}
+
+// buildVersion returns the version of this module in the build, which is the
+// main module when it's the command of this module and otherwise one of the
+// dependencies. It's empty for a development build.
+func buildVersion(build *debug.BuildInfo) string {
+	modules := append([]*debug.Module{&build.Main}, build.Deps...)
+	for _, mod := range modules {
+		if mod.Path != modulePath {
+			continue
+		}
+		if mod.Replace != nil && mod.Replace.Version != "" {
+			mod = mod.Replace
+		}
+		if mod.Version != "" && mod.Version != "(devel)" {
+			return mod.Version
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,34 @@
+package cedar_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/koblas/cedar-go"
+	"github.com/koblas/cedar-go/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersion(t *testing.T) {
+	info := cedar.Version()
+	assert.Equal(t, []string{"4.2"}, info.Language)
+	assert.Equal(t, []string{"trailing-commas"}, info.Flags)
+
+	// The version is kept in step with the release by release-please
+	data, err := os.ReadFile(".release-please-manifest.json")
+	require.NoError(t, err)
+	manifest := map[string]string{}
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	assert.Equal(t, "v"+manifest["."], info.Module)
+
+	data, err = json.Marshal(info)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"module": "v`+manifest["."]+`", "language": ["4.2"], "flags": ["trailing-commas"]}`, string(data))
+
+	// The flags follow the options the policies are parsed with
+	assert.Equal(t, []string{}, cedar.Version(parser.WithStrictSyntax()).Flags)
+	assert.Equal(t, []string{"arithmetic-extensions", "trailing-commas"}, cedar.Version(parser.WithArithmeticExtensions()).Flags)
+	assert.Equal(t, []string{"arithmetic-extensions"}, cedar.Version(parser.WithArithmeticExtensions(), parser.WithStrictSyntax()).Flags)
+}